@@ -1,32 +1,94 @@
 package main
 
 import (
+	"bufio"
 	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/milkiss/vanish/backend/internal/api"
 	"github.com/milkiss/vanish/backend/internal/auth"
+	"github.com/milkiss/vanish/backend/internal/backup"
+	"github.com/milkiss/vanish/backend/internal/buildinfo"
+	"github.com/milkiss/vanish/backend/internal/columncrypt"
 	"github.com/milkiss/vanish/backend/internal/config"
 	"github.com/milkiss/vanish/backend/internal/database"
-	"github.com/milkiss/vanish/backend/internal/integrations/email"
-	"github.com/milkiss/vanish/backend/internal/integrations/okta"
-	"github.com/milkiss/vanish/backend/internal/integrations/slack"
+	"github.com/milkiss/vanish/backend/internal/grpcapi"
+	"github.com/milkiss/vanish/backend/internal/integrations/vault"
+	"github.com/milkiss/vanish/backend/internal/lifecycle"
+	"github.com/milkiss/vanish/backend/internal/messages"
+	"github.com/milkiss/vanish/backend/internal/models"
 	"github.com/milkiss/vanish/backend/internal/repository"
 	"github.com/milkiss/vanish/backend/internal/storage"
+	"github.com/milkiss/vanish/backend/internal/tlsutil"
+	"github.com/milkiss/vanish/backend/internal/tracing"
 )
 
 func main() {
+	reencryptKeys := flag.Bool("reencrypt-keys", false,
+		"re-encrypt stored message keys and Slack bot tokens under the current METADATA_ENCRYPTION_KEYS version, then exit")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [admin reset-password | restore <file>]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// admin reset-password gives the default admin a new password, prints
+	// it and exits; it needs the server's environment, so only operators
+	// with access to the host can run it
+	//
+	// restore <file> loads a backup from POST /admin/backup into an empty
+	// database, decrypting it with BACKUP_PASSPHRASE, and exits
+	command := strings.Join(flag.Args(), " ")
+	var restoreFile string
+	if flag.Arg(0) == "restore" {
+		if flag.NArg() != 2 {
+			log.Fatalf("Usage: %s restore <file>", os.Args[0])
+		}
+		command, restoreFile = "restore", flag.Arg(1)
+	}
+	if command != "" && command != "admin reset-password" && command != "restore" {
+		log.Fatalf("Unknown command %q; the commands are admin reset-password and restore <file>", command)
+	}
+
+	log.Printf("Starting %s", buildinfo.String())
+
 	// Load configuration
 	cfg, err := config.Load()
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
 
+	// Every password hashed from here on (including the default admin's)
+	// uses BCRYPT_COST
+	if err := models.SetPasswordCost(cfg.Password.BcryptCost); err != nil {
+		log.Fatalf("Invalid BCRYPT_COST: %v", err)
+	}
+
+	// Set up tracing first: the database, Redis and HTTP clients created
+	// below are instrumented only if it is enabled
+	shutdownTracing := func(context.Context) error { return nil }
+	if cfg.Tracing.Enabled {
+		shutdownTracing, err = tracing.Setup(context.Background(), tracing.Options{
+			ServiceName: cfg.Tracing.ServiceName,
+			Endpoint:    cfg.Tracing.Endpoint,
+		})
+		if err != nil {
+			log.Fatalf("Failed to set up tracing: %v", err)
+		}
+		log.Printf("Exporting traces to %s", cfg.Tracing.Endpoint)
+	}
+
 	// Initialize PostgreSQL database
 	db, err := database.NewPostgresDB(database.Config{
 		Host:     cfg.Database.Host,
@@ -53,6 +115,31 @@ func main() {
 	// Initialize repositories (needed for admin creation)
 	userRepo := repository.NewUserRepository(db)
 
+	if command == "admin reset-password" {
+		password, err := database.ResetDefaultAdminPassword(context.Background(), userRepo)
+		if err != nil {
+			log.Fatalf("Failed to reset the default admin password: %v", err)
+		}
+		database.LogCredentials("DEFAULT ADMIN PASSWORD RESET", password)
+		return
+	}
+
+	// Restore before the default admin is created: the database must be
+	// empty, and the backup brings its own admins
+	if command == "restore" {
+		manifest, err := restoreBackup(context.Background(), repository.NewBackupRepository(db), restoreFile, cfg.Backup.Passphrase)
+		if err != nil {
+			log.Fatalf("Failed to restore %s: %v", restoreFile, err)
+		}
+		log.Printf("Restored the backup of %s (server %s, schema version %d)",
+			manifest.CreatedAt.Format(time.RFC3339), manifest.ServerVersion, manifest.SchemaVersion)
+		for _, table := range manifest.Tables {
+			log.Printf("  %s: %d rows", table.Name, table.Rows)
+		}
+		log.Printf("Note: %s", manifest.Note)
+		return
+	}
+
 	// Create default admin account on first run
 	adminCreated, err := database.CreateDefaultAdmin(db, userRepo)
 	if err != nil {
@@ -60,9 +147,37 @@ func main() {
 	} else if adminCreated {
 		log.Println("Default admin account created successfully")
 	}
+	checkDefaultAdmin(cfg, userRepo)
+
+	// Initialize metadata repository, encrypting stored message keys when
+	// master keys are configured
+	keyring, err := loadMetadataKeyring(cfg)
+	if err != nil {
+		log.Fatalf("Failed to load metadata encryption keys: %v", err)
+	}
+	if keyring != nil {
+		log.Printf("Encrypting stored message keys with key version %s", keyring.CurrentVersion())
+	}
+	metadataRepo := repository.NewMetadataRepository(db, keyring)
+	slackRepo := repository.NewSlackInstallationRepository(db, keyring)
+
+	// One-off migration: seal plaintext and old-version keys, then exit
+	if *reencryptKeys {
+		count, err := metadataRepo.ReencryptKeys(context.Background())
+		if err != nil {
+			log.Fatalf("Failed to re-encrypt message keys after %d rows: %v", count, err)
+		}
+		log.Printf("Re-encrypted %d message keys", count)
+		count, err = slackRepo.ReencryptTokens(context.Background())
+		if err != nil {
+			log.Fatalf("Failed to re-encrypt Slack bot tokens after %d rows: %v", count, err)
+		}
+		log.Printf("Re-encrypted %d Slack bot tokens", count)
+		return
+	}
 
 	// Initialize Redis storage
-	store, err := storage.NewRedisStorage(
+	defaultStore, err := storage.NewRedisStorage(
 		cfg.Redis.Address,
 		cfg.Redis.Password,
 		cfg.Redis.DB,
@@ -70,12 +185,20 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to connect to Redis: %v", err)
 	}
-	defer store.Close()
 
-	log.Println("Successfully connected to Redis")
+	// Messages to users tagged with a region go to that region's cluster
+	regionStores := make(map[string]storage.Storage, len(cfg.Redis.Regions))
+	for _, region := range cfg.Redis.Regions {
+		regionStore, err := storage.NewRedisStorage(region.Address, region.Password, region.DB)
+		if err != nil {
+			log.Fatalf("Failed to connect to Redis of region %s: %v", region.Name, err)
+		}
+		regionStores[region.Name] = regionStore
+	}
+	store := storage.NewRegionalStorage(defaultStore, regionStores)
+	defer store.Close()
 
-	// Initialize metadata repository
-	metadataRepo := repository.NewMetadataRepository(db)
+	log.Printf("Successfully connected to Redis (%d regional clusters)", len(regionStores))
 
 	// Initialize JWT manager
 	jwtManager := auth.NewJWTManager(
@@ -83,83 +206,236 @@ func main() {
 		time.Duration(cfg.JWT.TokenDuration)*time.Hour,
 	)
 
-	// Initialize Okta client (if enabled)
-	var oktaClient interface{}
-	if cfg.Okta.Enabled {
-		client, err := okta.NewClient(context.Background(), &okta.Config{
-			Domain:       cfg.Okta.Domain,
-			ClientID:     cfg.Okta.ClientID,
-			ClientSecret: cfg.Okta.ClientSecret,
-			RedirectURL:  cfg.Okta.RedirectURL,
-		})
+	// Initialize the integration clients (Slack, email, Okta) that are
+	// enabled. A failing Okta is left disabled; the others still start
+	clients, err := api.BuildIntegrationClients(context.Background(), cfg)
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	logIntegrations(clients)
+
+	// Handlers look the clients up per request, so a reload can swap them
+	integrations := api.NewIntegrations(clients)
+	reloader := api.NewConfigReloader(cfg, config.Load, integrations)
+
+	// Components with background goroutines register here so shutdown can
+	// stop them in order
+	components := lifecycle.NewManager()
+
+	// TTL policy rules apply to messages from every transport
+	ttlPolicies := repository.NewTTLPolicyRepository(db)
+
+	// Setup router
+	router, err := api.SetupRouter(api.Dependencies{
+		Config:         cfg,
+		Storage:        store,
+		UserStore:      userRepo,
+		MetadataStore:  metadataRepo,
+		AccessLogStore: repository.NewAccessLogRepository(db),
+		JWTManager:     jwtManager,
+		Integrations:   integrations,
+		Reloader:       reloader,
+		Lifecycle:      components,
+
+		SlackInstallations: slackRepo,
+		DigestStore:        repository.NewDigestRepository(db),
+		TTLPolicyStore:     ttlPolicies,
+		BackupStore:        repository.NewBackupRepository(db),
+	})
+	if err != nil {
+		log.Fatalf("Failed to setup router: %v", err)
+	}
+
+	// Create HTTP server
+	server := api.NewServer(cfg.Server, router)
+
+	// Terminate TLS in-process when a certificate is configured
+	var certReloader *tlsutil.CertReloader
+	if cfg.Server.TLS.Enabled() {
+		certReloader, err = tlsutil.NewCertReloader(cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile)
 		if err != nil {
-			log.Printf("Warning: Failed to initialize Okta client: %v", err)
-		} else {
-			oktaClient = client
-			log.Println("Okta SSO enabled")
+			log.Fatalf("Failed to load TLS certificate: %v", err)
 		}
+		server.TLSConfig = tlsutil.ServerConfig(certReloader)
 	}
 
-	// Initialize Slack client (if enabled)
-	var slackClient *slack.Client
-	if cfg.Slack.Enabled {
-		slackClient = slack.NewClient(&slack.Config{
-			BotToken:      cfg.Slack.BotToken,
-			WebhookURL:    cfg.Slack.WebhookURL,
-			SigningSecret: cfg.Slack.SigningSecret,
-		})
-		log.Println("Slack integration enabled")
+	// Listeners are registered after the workers so they stop first:
+	// no new requests arrive while background work drains
+	components.Register(lifecycle.HTTPServer("http-server", server, certReloader != nil))
+	if certReloader != nil {
+		log.Printf("Serving on %s (TLS)", server.Addr)
+	} else {
+		log.Printf("Serving on %s", server.Addr)
 	}
 
-	// Initialize Email client (if enabled)
-	var emailClient *email.Client
-	if cfg.Email.Enabled {
-		emailClient = email.NewClient(&email.Config{
-			SMTPHost:     cfg.Email.SMTPHost,
-			SMTPPort:     cfg.Email.SMTPPort,
-			SMTPUser:     cfg.Email.SMTPUser,
-			SMTPPassword: cfg.Email.SMTPPassword,
-			FromAddress:  cfg.Email.FromAddress,
-			FromName:     cfg.Email.FromName,
+	// Optional gRPC listener for automation, sharing the HTTP server's
+	// certificate and the message service's rules
+	if cfg.GRPC.Enabled {
+		var grpcTLS *tls.Config
+		if certReloader != nil {
+			grpcTLS = tlsutil.ServerConfig(certReloader)
+		}
+		grpcServer := grpcapi.NewServer(grpcapi.Dependencies{
+			Messages:   messages.NewService(store, metadataRepo, cfg.Message.MaxPendingPerRecipient, userRepo, ttlPolicies),
+			UserStore:  userRepo,
+			JWTManager: jwtManager,
+			TLS:        grpcTLS,
 		})
-		log.Println("Email integration enabled")
+		grpcAddr := net.JoinHostPort(cfg.Server.Host, cfg.GRPC.Port)
+		components.Register(lifecycle.GRPCServer("grpc-server", grpcAddr, grpcServer))
+		log.Printf("Serving gRPC on %s", grpcAddr)
 	}
 
-	// Setup router
-	router := api.SetupRouter(cfg, store, userRepo, metadataRepo, jwtManager, oktaClient, slackClient, emailClient)
-
-	// Create HTTP server
-	addr := cfg.Address()
-	server := &http.Server{
-		Addr:           addr,
-		Handler:        router,
-		ReadTimeout:    10 * time.Second,
-		WriteTimeout:   10 * time.Second,
-		MaxHeaderBytes: 1 << 20, // 1 MB
+	// Optional plain-HTTP listener that only redirects to HTTPS
+	if certReloader != nil && cfg.Server.TLS.RedirectPort != "" {
+		redirectServer := &http.Server{
+			Addr:              net.JoinHostPort(cfg.Server.Host, cfg.Server.TLS.RedirectPort),
+			Handler:           tlsutil.RedirectHandler(cfg.Server.Port),
+			ReadHeaderTimeout: cfg.Server.Timeouts.ReadHeader,
+			IdleTimeout:       cfg.Server.Timeouts.Idle,
+			MaxHeaderBytes:    1 << 20,
+		}
+		components.Register(lifecycle.HTTPServer("https-redirect", redirectServer, false))
+		log.Printf("Redirecting HTTP on %s to HTTPS", redirectServer.Addr)
 	}
 
-	// Start server in a goroutine
-	go func() {
-		log.Printf("Starting server on %s", addr)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
-		}
-	}()
+	// Root context for every component; cancelled on shutdown
+	rootCtx, cancelRoot := context.WithCancel(context.Background())
+	defer cancelRoot()
+
+	if err := components.Start(rootCtx); err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
 
 	// Wait for interrupt signal to gracefully shutdown the server
+	// SIGHUP reloads the TLS certificate and the configuration instead
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range quit {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		if certReloader != nil {
+			if err := certReloader.Reload(); err != nil {
+				log.Printf("Warning: TLS certificate reload failed, keeping previous certificate: %v", err)
+			} else {
+				log.Println("TLS certificate reloaded")
+			}
+		}
+		result, err := reloader.Reload(rootCtx)
+		if err != nil {
+			log.Printf("Warning: configuration reload failed, keeping previous configuration: %v", err)
+			continue
+		}
+		log.Printf("Configuration reloaded: %d settings applied, %d require a restart",
+			len(result.Applied), len(result.RequiresRestart))
+		logIntegrations(integrations.Clients())
+	}
 
 	log.Println("Shutting down server...")
 
-	// Graceful shutdown with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	// Stop listeners, then workers, within one shared deadline. Each worker's
+	// context is cancelled as it is stopped; cancelling the root context only
+	// afterwards keeps workers alive while in-flight requests still use them
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.Timeouts.Shutdown)
 	defer cancel()
 
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+	if err := components.Stop(ctx); err != nil {
+		log.Printf("Some components did not stop cleanly: %v", err)
+	}
+	cancelRoot()
+
+	// Flush spans of the last requests
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
 	}
 
 	log.Println("Server exited")
 }
+
+// restoreBackup restores the backup in path, encrypted with passphrase, in
+// one transaction and returns its manifest
+func restoreBackup(ctx context.Context, repo *repository.BackupRepository, path, passphrase string) (*backup.Manifest, error) {
+	if passphrase == "" {
+		return nil, errors.New("BACKUP_PASSPHRASE is not set")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	src, err := backup.NewReader(bufio.NewReader(f), passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.Restore(ctx, src); err != nil {
+		return nil, err
+	}
+	return src.Manifest(), nil
+}
+
+// logIntegrations reports which integrations are enabled
+func logIntegrations(clients api.IntegrationClients) {
+	if clients.Okta != nil {
+		log.Println("Okta SSO enabled")
+	}
+	if clients.Slack != nil {
+		log.Println("Slack integration enabled")
+	}
+	if clients.Email != nil {
+		log.Println("Email integration enabled")
+	}
+}
+
+// loadMetadataKeyring builds the keyring for stored message keys from
+// METADATA_ENCRYPTION_KEYS, falling back to Vault when it is enabled
+// Returns nil when no keys are configured
+func loadMetadataKeyring(cfg *config.Config) (*columncrypt.Keyring, error) {
+	keys := cfg.Crypto.Keys
+	if keys == "" && cfg.Vault.Enabled {
+		client, err := vault.NewClient(&vault.Config{
+			Address:   cfg.Vault.Address,
+			Token:     cfg.Vault.Token,
+			Namespace: cfg.Vault.Namespace,
+		})
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		keys, err = client.GetMetadataEncryptionKeys(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return columncrypt.Parse(keys, cfg.Crypto.KeyVersion)
+}
+
+// checkDefaultAdmin deactivates the default admin when DISABLE_DEFAULT_ADMIN
+// is set and another admin exists, and warns while it stays active unused
+func checkDefaultAdmin(cfg *config.Config, userRepo *repository.UserRepository) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if cfg.Server.DisableDefaultAdmin {
+		disabled, err := database.DisableDefaultAdmin(ctx, userRepo)
+		switch {
+		case errors.Is(err, database.ErrOnlyAdmin):
+			log.Printf("Warning: DISABLE_DEFAULT_ADMIN is set but %s is the only active admin; keeping it active", database.DefaultAdminEmail)
+		case err != nil:
+			log.Printf("Warning: Failed to disable default admin: %v", err)
+		case disabled:
+			log.Printf("Default admin account %s deactivated (DISABLE_DEFAULT_ADMIN)", database.DefaultAdminEmail)
+		}
+	}
+
+	stale, err := database.DefaultAdminStale(ctx, userRepo, time.Now())
+	if err != nil {
+		log.Printf("Warning: Failed to check default admin: %v", err)
+	} else if stale {
+		log.Printf("Warning: Default admin account %s is active but has not signed in for %d days; "+
+			"set DISABLE_DEFAULT_ADMIN=true once another admin exists, or rotate its password with `admin reset-password`",
+			database.DefaultAdminEmail, int(database.DefaultAdminStaleAfter.Hours()/24))
+	}
+}
@@ -0,0 +1,134 @@
+// Package accesslog writes the message access audit log off the request
+// path: handlers hand entries to a Recorder, which stores them in batches.
+// Recording is best effort; a slow or failing database never delays or
+// fails a read
+package accesslog
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+)
+
+const (
+	// DefaultBufferSize is how many entries may wait to be stored before
+	// new ones are dropped
+	DefaultBufferSize = 10000
+	// batchSize is the most entries stored by one insert
+	batchSize = 200
+	// flushInterval is how long an entry may wait for a full batch
+	flushInterval = 2 * time.Second
+	// shutdownTimeout bounds the final flush once Run is cancelled
+	shutdownTimeout = 5 * time.Second
+)
+
+// Recorder queues access entries and stores them in batches
+type Recorder struct {
+	store   persistence.AccessLogStore
+	queue   chan *models.AccessLogEntry
+	flushMu sync.Mutex // one batch in flight, so a flush observes earlier ones
+	dropped atomic.Int64
+}
+
+// NewRecorder creates a recorder for store holding up to bufferSize
+// unstored entries (DefaultBufferSize if not positive)
+func NewRecorder(store persistence.AccessLogStore, bufferSize int) *Recorder {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+	return &Recorder{store: store, queue: make(chan *models.AccessLogEntry, bufferSize)}
+}
+
+// Record queues an entry without blocking. When the queue is full the entry
+// is dropped and counted, so audit logging can never stall a request
+// A nil Recorder discards entries
+func (r *Recorder) Record(entry *models.AccessLogEntry) {
+	if r == nil {
+		return
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now().UTC()
+	}
+	select {
+	case r.queue <- entry:
+	default:
+		r.dropped.Add(1)
+	}
+}
+
+// Dropped returns how many entries were discarded because the queue was full
+func (r *Recorder) Dropped() int64 {
+	return r.dropped.Load()
+}
+
+// Run stores queued entries every flushInterval until ctx is cancelled,
+// then stores what is left; run it as a lifecycle worker
+func (r *Recorder) Run(ctx context.Context) {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			// ctx is already cancelled; give the last batch its own deadline
+			final, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+			r.Flush(final)
+			cancel()
+			return
+		case <-ticker.C:
+			r.Flush(ctx)
+		}
+	}
+}
+
+// Flush stores every queued entry now. A failed batch is logged and
+// discarded rather than retried, so a database outage cannot grow memory
+func (r *Recorder) Flush(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	for {
+		batch := r.take()
+		if len(batch) == 0 {
+			return
+		}
+		if err := r.store.RecordAccess(ctx, batch); err != nil {
+			requestid.Logger(ctx).Warn("failed to record message access", "entries", len(batch), "error", err)
+		}
+		if len(batch) < batchSize {
+			return
+		}
+	}
+}
+
+// List stores queued entries and then returns the latest attempts on a
+// message, so an attempt made just before is always included
+func (r *Recorder) List(ctx context.Context, messageID string, limit int) ([]*models.AccessLogEntry, error) {
+	if r == nil {
+		return []*models.AccessLogEntry{}, nil
+	}
+	r.Flush(ctx)
+	return r.store.ListAccess(ctx, messageID, limit)
+}
+
+// take removes up to batchSize entries from the queue
+func (r *Recorder) take() []*models.AccessLogEntry {
+	var batch []*models.AccessLogEntry
+	for len(batch) < batchSize {
+		select {
+		case e := <-r.queue:
+			batch = append(batch, e)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
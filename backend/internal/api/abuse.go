@@ -0,0 +1,207 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+	"github.com/milkiss/vanish/backend/internal/storage"
+)
+
+// abuseNotifyTimeout bounds the sender and webhook notifications of one alert
+const abuseNotifyTimeout = 30 * time.Second
+
+// AbuseDetector raises an alert when one message receives more than
+// cfg.Threshold denied access attempts within cfg.Window. Attempts are
+// counted in Redis, so every backend instance shares the count
+type AbuseDetector struct {
+	cfg          config.AbuseConfig
+	storage      storage.Storage
+	metadataRepo persistence.MetadataStore
+	userRepo     persistence.UserStore
+	integrations *Integrations // Slack and email reach the sender
+	httpClient   *http.Client  // posts to cfg.WebhookURL
+	events       *EventLog     // counts alerts for the admin digest; nil counts none
+}
+
+// NewAbuseDetector creates a detector, or returns nil when cfg.Threshold is
+// not positive; a nil detector ignores every attempt
+func NewAbuseDetector(
+	cfg config.AbuseConfig,
+	storage storage.Storage,
+	metadataRepo persistence.MetadataStore,
+	userRepo persistence.UserStore,
+	integrations *Integrations,
+	httpClient *http.Client,
+	events *EventLog,
+) *AbuseDetector {
+	if cfg.Threshold <= 0 {
+		return nil
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &AbuseDetector{
+		cfg:          cfg,
+		storage:      storage,
+		metadataRepo: metadataRepo,
+		userRepo:     userRepo,
+		integrations: integrations,
+		httpClient:   httpClient,
+		events:       events,
+	}
+}
+
+// Observe counts a denied attempt on the message from ip. The attempt that
+// takes the count past the threshold revokes the message (if enabled)
+// before returning and notifies the sender and the webhook in the
+// background; later attempts in the same window do not alert again
+func (d *AbuseDetector) Observe(ctx context.Context, metadata *models.MessageMetadata, ip string) {
+	if d == nil || metadata == nil {
+		return
+	}
+	logger := requestid.Logger(ctx)
+
+	attempts, sources, err := d.storage.RecordDenied(ctx, metadata.MessageID, ip, d.cfg.Window)
+	if err != nil {
+		logger.Warn("failed to count denied access", "error", err)
+		return
+	}
+	if attempts != d.cfg.Threshold+1 {
+		return
+	}
+
+	alert := models.AbuseAlert{
+		Event:         models.AbuseAlertEvent,
+		MessageID:     metadata.MessageID,
+		SenderID:      metadata.SenderID,
+		RecipientID:   metadata.RecipientID,
+		Attempts:      attempts,
+		WindowSeconds: int64(d.cfg.Window.Seconds()),
+		SourceIPs:     sources,
+		DetectedAt:    time.Now().UTC(),
+	}
+	if d.cfg.AutoRevoke {
+		alert.Revoked = d.revoke(ctx, metadata)
+	}
+	d.events.Record(ctx, models.EventAbuseAlert)
+	logger.Warn("repeated denied access to message",
+		"message_id", alert.MessageID, "attempts", alert.Attempts, "source_ips", alert.SourceIPs, "revoked", alert.Revoked)
+
+	// The request has been answered; notify without holding it up
+	notifyCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abuseNotifyTimeout)
+	go func() {
+		defer cancel()
+		d.notify(notifyCtx, alert)
+	}()
+}
+
+// revoke expires the message and burns its payload, reporting whether the
+// message can no longer be read
+func (d *AbuseDetector) revoke(ctx context.Context, metadata *models.MessageMetadata) bool {
+	logger := requestid.Logger(ctx)
+
+	if _, err := d.metadataRepo.ExpirePendingForRecipient(ctx, metadata.RecipientID, []string{metadata.MessageID}); err != nil {
+		logger.Warn("failed to expire abused message", "error", err)
+		return false
+	}
+	// A claimed payload is held under its claim and lapses with it
+	if _, err := d.storage.GetAndDelete(ctx, metadata.MessageID); err != nil && err != models.ErrMessageNotFound {
+		logger.Warn("failed to burn abused message", "error", err)
+		return false
+	}
+	return true
+}
+
+// notify sends the alert to the sender and the abuse webhook
+// Failures are logged; the alert is not retried
+func (d *AbuseDetector) notify(ctx context.Context, alert models.AbuseAlert) {
+	logger := requestid.Logger(ctx)
+
+	if err := d.notifySender(ctx, alert); err != nil {
+		logger.Warn("failed to alert sender of denied access", "error", err)
+	}
+	if d.cfg.WebhookURL != "" {
+		if err := d.postWebhook(ctx, alert); err != nil {
+			logger.Warn("failed to post abuse webhook", "error", err)
+		}
+	}
+}
+
+// notifySender messages the sender over Slack, falling back to email when
+// Slack is disabled or the DM fails
+func (d *AbuseDetector) notifySender(ctx context.Context, alert models.AbuseAlert) error {
+	clients := d.integrations.Clients()
+	if clients.Slack == nil && clients.Email == nil {
+		return nil
+	}
+
+	sender, err := d.userRepo.FindByID(ctx, alert.SenderID)
+	if err != nil {
+		return fmt.Errorf("failed to load sender: %w", err)
+	}
+	recipientName := "the recipient"
+	if recipient, err := d.userRepo.FindByID(ctx, alert.RecipientID); err == nil {
+		recipientName = recipient.Name
+	}
+	body := abuseAlertText(alert, recipientName)
+
+	if clients.Slack != nil {
+		err = clients.Slack.SendDirectMessage(ctx, sender.Email, body)
+		if err == nil || clients.Email == nil {
+			return err
+		}
+	}
+	return clients.Email.SendAlert(ctx, sender.Email, "Vanish: repeated attempts to open your message", body)
+}
+
+// postWebhook posts the alert as JSON to the configured webhook
+func (d *AbuseDetector) postWebhook(ctx context.Context, alert models.AbuseAlert) error {
+	return postJSON(ctx, d.httpClient, d.cfg.WebhookURL, alert)
+}
+
+// postJSON posts v as JSON to url, failing unless the answer is a 2xx
+func postJSON(ctx context.Context, client *http.Client, url string, v interface{}) error {
+	payload, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// abuseAlertText describes the alert to the sender
+func abuseAlertText(alert models.AbuseAlert, recipientName string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "There were repeated refused attempts to open a message you sent to %s.\n\n", recipientName)
+	fmt.Fprintf(&b, "Message ID: %s\n", alert.MessageID)
+	fmt.Fprintf(&b, "Denied attempts: %d in the last %s\n", alert.Attempts, time.Duration(alert.WindowSeconds)*time.Second)
+	fmt.Fprintf(&b, "Source IPs: %s\n\n", strings.Join(alert.SourceIPs, ", "))
+	if alert.Revoked {
+		b.WriteString("The message has been revoked and can no longer be read. Send the secret again over a trusted channel if it is still needed.")
+	} else {
+		b.WriteString("The message is still readable by its recipient. Consider rotating the secret if the link may have leaked.")
+	}
+	return b.String()
+}
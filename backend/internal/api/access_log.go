@@ -0,0 +1,121 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/storage"
+)
+
+// maxUserAgentLength matches the access_log.user_agent column
+const maxUserAgentLength = 512
+
+// recordAccess adds the finished request to the access log. Call it
+// deferred: the outcome is read from the response status. metadata is the
+// message's row, or nil when it was not found or not loaded
+// Malformed requests, missing credentials and server faults are not
+// attempts on a message and are not recorded. Denied attempts also feed
+// the abuse detector
+func (h *MessageHandler) recordAccess(c *gin.Context, id string, action models.AccessAction, metadata *models.MessageMetadata) {
+	outcome, ok := accessOutcome(c.Writer.Status(), action, metadata)
+	if !ok {
+		return
+	}
+	userID, ok := c.Get("user_id")
+	if !ok {
+		return
+	}
+
+	userAgent := c.Request.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+
+	ip := ClientIP(c)
+	h.access.Record(&models.AccessLogEntry{
+		MessageID: id,
+		UserID:    userID.(int64),
+		Action:    action,
+		Outcome:   outcome,
+		IP:        ip,
+		UserAgent: userAgent,
+		CreatedAt: time.Now().UTC(),
+	})
+
+	if outcome == models.AccessDenied {
+		h.abuse.Observe(c.Request.Context(), metadata, ip)
+	}
+}
+
+// accessOutcome classifies a response to a message endpoint
+func accessOutcome(status int, action models.AccessAction, metadata *models.MessageMetadata) (models.AccessOutcome, bool) {
+	switch status {
+	case http.StatusOK:
+		if action == models.AccessActionRead {
+			return models.AccessRead, true
+		}
+		return models.AccessAllowed, true
+	case http.StatusForbidden, http.StatusConflict:
+		return models.AccessDenied, true
+	case http.StatusGone:
+		return models.AccessGone, true
+	case http.StatusTooEarly:
+		return models.AccessEarly, true
+	case http.StatusNotFound:
+		// Metadata without a payload means the message ran out of time
+		if metadata != nil && (metadata.Status == models.StatusExpired || !time.Now().Before(metadata.ExpiresAt)) {
+			return models.AccessExpired, true
+		}
+		return models.AccessGone, true
+	default:
+		return "", false
+	}
+}
+
+// ListAccess handles GET /api/messages/:id/access
+// Shows the sender every attempt to read or inspect their message,
+// including refused ones
+func (h *MessageHandler) ListAccess(c *gin.Context) {
+	currentUserID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
+		return
+	}
+
+	id := c.Param("id")
+	if !storage.ValidID(id) {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidMessageID, "Invalid message ID"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	metadata, err := h.metadataRepo.FindByMessageID(ctx, id)
+	if errors.Is(err, models.ErrMessageNotFound) {
+		c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeMessageNotFound, "Message not found"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to retrieve message metadata"))
+		return
+	}
+
+	if metadata.SenderID != currentUserID.(int64) {
+		c.JSON(http.StatusForbidden, errorResponse(c, models.ErrorCodeForbidden, "Only the sender can see who accessed this message"))
+		return
+	}
+
+	entries, err := h.access.List(ctx, id, models.MaxAccessLogEntries)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to retrieve access log"))
+		return
+	}
+
+	resp := models.MessageAccessResponse{MessageID: id, Entries: make([]models.AccessLogEntry, len(entries))}
+	for i, e := range entries {
+		resp.Entries[i] = *e
+	}
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+	"github.com/milkiss/vanish/backend/internal/storage"
+)
+
+// anonymizeAccount deletes a user without erasing their counterparts' history
+// Open messages are expired and burned first, then the user row becomes a
+// tombstone and its API keys are revoked in one transaction; credentials go
+// last so a failure part way leaves the account usable rather than
+// half-deleted. Existing tokens stop working once the account is inactive
+// (see ActiveUserMiddleware)
+func anonymizeAccount(ctx context.Context, userRepo persistence.UserStore, metadataRepo persistence.MetadataStore, store storage.Storage, userID int64) error {
+	ids, err := metadataRepo.ExpireUserMessages(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to expire messages: %w", err)
+	}
+
+	for _, id := range ids {
+		// Claimed messages are no longer under their ID and lapse with the claim
+		if _, err := store.GetAndDelete(ctx, id); err != nil && !errors.Is(err, models.ErrMessageNotFound) {
+			requestid.Logger(ctx).Warn("failed to burn message of deleted account", "error", err)
+		}
+	}
+
+	return userRepo.Anonymize(ctx, userID)
+}
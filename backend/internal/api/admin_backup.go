@@ -0,0 +1,71 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/backup"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+)
+
+// BackupHandler serves encrypted disaster-recovery backups of the database.
+// Only operators holding BACKUP_PASSPHRASE can read them, so an admin
+// account alone is not enough to see password hashes or sealed keys
+type BackupHandler struct {
+	store      persistence.BackupStore // nil when backups are unavailable
+	passphrase string                  // BACKUP_PASSPHRASE; empty disables backups
+}
+
+// NewBackupHandler creates a backup handler
+func NewBackupHandler(store persistence.BackupStore, passphrase string) *BackupHandler {
+	return &BackupHandler{store: store, passphrase: passphrase}
+}
+
+// CreateBackup streams an encrypted backup of the accounts, message history
+// and settings. Message contents are in Redis and not included; restore it
+// with `vanish-server restore <file>`
+func (h *BackupHandler) CreateBackup(c *gin.Context) {
+	if h.store == nil || h.passphrase == "" {
+		c.JSON(http.StatusServiceUnavailable, errorResponse(c, models.ErrorCodeIntegrationDisabled, "Backups not configured; set BACKUP_PASSPHRASE"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	adminID, _ := c.Get("user_id")
+	dst, err := backup.NewWriter(c.Writer, h.passphrase)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to create backup"))
+		return
+	}
+
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="vanish-backup-%s.vbk"`, time.Now().UTC().Format("20060102-150405")))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	err = h.store.Export(ctx, dst)
+	if err == nil {
+		err = dst.Close()
+	}
+	if err != nil {
+		requestid.Logger(ctx).Error("backup failed", "admin_id", adminID, "error", err)
+		// Until the first rows are flushed nothing was sent; afterwards the
+		// download just ends, and restore rejects the truncated file
+		if !c.Writer.Written() {
+			c.Header("Content-Type", "")
+			c.Header("Content-Disposition", "")
+			c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to create backup"))
+		}
+		return
+	}
+
+	var rows int64
+	for _, table := range dst.Manifest().Tables {
+		rows += table.Rows
+	}
+	requestid.Logger(ctx).Info("backup created", "admin_id", adminID, "tables", len(dst.Manifest().Tables), "rows", rows)
+}
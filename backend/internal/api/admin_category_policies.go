@@ -0,0 +1,146 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+)
+
+// ListCategoryPolicies handles GET /api/admin/category-policies
+// Lists the category policies ordered by category
+func (h *AdminHandler) ListCategoryPolicies(c *gin.Context) {
+	if !h.categoryPoliciesAvailable(c) {
+		return
+	}
+
+	policies, err := h.policies.ListCategoryPolicies(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to list category policies"))
+		return
+	}
+
+	c.JSON(http.StatusOK, policies)
+}
+
+// GetCategoryPolicy handles GET /api/admin/category-policies/:category
+func (h *AdminHandler) GetCategoryPolicy(c *gin.Context) {
+	if !h.categoryPoliciesAvailable(c) {
+		return
+	}
+	category, ok := policyCategory(c)
+	if !ok {
+		return
+	}
+
+	policy, err := h.policies.GetCategoryPolicy(c.Request.Context(), category)
+	if err != nil {
+		if errors.Is(err, models.ErrCategoryPolicyNotFound) {
+			c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeCategoryPolicyNotFound, "Category policy not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to get category policy"))
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// PutCategoryPolicy handles PUT /api/admin/category-policies/:category
+// Creates the policy of a category, answering 201, or replaces it
+func (h *AdminHandler) PutCategoryPolicy(c *gin.Context) {
+	if !h.categoryPoliciesAvailable(c) {
+		return
+	}
+	category, ok := policyCategory(c)
+	if !ok {
+		return
+	}
+	req, ok := bindCategoryPolicy(c)
+	if !ok {
+		return
+	}
+
+	policy := &models.CategoryPolicy{Category: category, DefaultTTL: req.DefaultTTL, MaxTTL: req.MaxTTL, NotificationStyle: req.NotificationStyle}
+	created, err := h.policies.PutCategoryPolicy(c.Request.Context(), policy)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to save category policy"))
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	requestid.Logger(c.Request.Context()).Info("category policy saved",
+		"admin_id", adminID, "category", category, "created", created,
+		"default_ttl", policy.DefaultTTL, "max_ttl", policy.MaxTTL, "notification_style", policy.NotificationStyle)
+
+	if created {
+		c.JSON(http.StatusCreated, policy)
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// DeleteCategoryPolicy handles DELETE /api/admin/category-policies/:category
+// Messages already filed under the category keep their TTL
+func (h *AdminHandler) DeleteCategoryPolicy(c *gin.Context) {
+	if !h.categoryPoliciesAvailable(c) {
+		return
+	}
+	category, ok := policyCategory(c)
+	if !ok {
+		return
+	}
+
+	if err := h.policies.DeleteCategoryPolicy(c.Request.Context(), category); err != nil {
+		if errors.Is(err, models.ErrCategoryPolicyNotFound) {
+			c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeCategoryPolicyNotFound, "Category policy not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to delete category policy"))
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	requestid.Logger(c.Request.Context()).Info("category policy deleted", "admin_id", adminID, "category", category)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Category policy deleted"})
+}
+
+// categoryPoliciesAvailable answers 503 when no policy store is configured
+func (h *AdminHandler) categoryPoliciesAvailable(c *gin.Context) bool {
+	if h.policies == nil {
+		c.JSON(http.StatusServiceUnavailable, errorResponse(c, models.ErrorCodeUnavailable, "Category policies are not available"))
+		return false
+	}
+	return true
+}
+
+// policyCategory reads the :category parameter, answering 400 when it is
+// not a valid category name
+func policyCategory(c *gin.Context) (string, bool) {
+	category := c.Param("category")
+	if !models.ValidCategory(category) {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Invalid category"))
+		return "", false
+	}
+	return category, true
+}
+
+// bindCategoryPolicy reads and validates a policy, answering 400 when it is
+// invalid
+func bindCategoryPolicy(c *gin.Context) (*models.CategoryPolicyRequest, bool) {
+	var req models.CategoryPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindError(c, err))
+		return nil, false
+	}
+	if details := req.Validate(); details != nil {
+		resp := errorResponse(c, models.ErrorCodeValidationFailed, "Invalid request: "+summarize(details))
+		resp.Details = details
+		c.JSON(http.StatusBadRequest, resp)
+		return nil, false
+	}
+	return &req, true
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+)
+
+const (
+	// csvImportMaxRows caps the users one import creates
+	csvImportMaxRows = 10000
+	// csvImportMaxFieldLength caps each value of an imported row
+	csvImportMaxFieldLength = 256
+	// csvImportMaxErrors caps the row errors an import reports; the rest
+	// are only counted
+	csvImportMaxErrors = 100
+	// csvImportFormMemory is how much of an upload is kept in memory; larger
+	// files are spooled to a temporary file
+	csvImportFormMemory = 1 << 20 // 1 MB
+	// csvImportProgressRows is how often an import logs its progress
+	csvImportProgressRows = 1000
+)
+
+// csvImportColumns are the columns of a user import, in order; the last is optional
+var csvImportColumns = []string{"email", "name", "password", "is_admin"}
+
+// csvImportExpected describes csvImportColumns in error messages
+const csvImportExpected = "email,name,password[,is_admin]"
+
+// userCSVReader streams the rows of a user import, holding one row at a time
+// Files saved by Windows tools are accepted: a UTF-8 byte order mark is
+// dropped and CRLF or lone CR line endings read as LF. Error messages are
+// written for the admin who uploaded the file
+type userCSVReader struct {
+	reader *csv.Reader
+	rows   int
+}
+
+// newUserCSVReader reads and checks the header of a user import
+func newUserCSVReader(r io.Reader) (*userCSVReader, error) {
+	reader := csv.NewReader(&lfReader{r: bufio.NewReader(r)})
+	reader.FieldsPerRecord = -1 // short rows are reported per row
+	reader.ReuseRecord = true
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("CSV file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid CSV file: %v", err)
+	}
+	if err := checkUserCSVHeader(header); err != nil {
+		return nil, err
+	}
+	return &userCSVReader{reader: reader}, nil
+}
+
+// Next returns the next row and its line in the file, counting the header
+// as line 1, or io.EOF after the last. The row is only valid until the next
+// call
+func (r *userCSVReader) Next() ([]string, int, error) {
+	record, err := r.reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, 0, io.EOF
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("Invalid CSV file: %v", err)
+	}
+	if r.rows == csvImportMaxRows {
+		return nil, 0, fmt.Errorf("CSV file has more than %d rows; split it into several imports", csvImportMaxRows)
+	}
+	r.rows++
+	return record, r.rows + 1, nil
+}
+
+// checkUserCSV reads a whole user import without keeping it, so a file that
+// is malformed or too long is refused before any user is created
+func checkUserCSV(r io.Reader) error {
+	reader, err := newUserCSVReader(r)
+	if err != nil {
+		return err
+	}
+	for {
+		_, _, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if reader.rows == 0 {
+		return errors.New("CSV file is empty")
+	}
+	return nil
+}
+
+// utf8BOM is the byte order mark Windows tools put before UTF-8 text
+var utf8BOM = []byte("\xef\xbb\xbf")
+
+// lfReader drops a leading UTF-8 byte order mark and reads CRLF and lone CR
+// line endings as LF
+type lfReader struct {
+	r          *bufio.Reader
+	bomSkipped bool
+}
+
+func (l *lfReader) Read(p []byte) (int, error) {
+	if !l.bomSkipped {
+		l.bomSkipped = true
+		if prefix, _ := l.r.Peek(len(utf8BOM)); bytes.Equal(prefix, utf8BOM) {
+			_, _ = l.r.Discard(len(utf8BOM))
+		}
+	}
+
+	n := 0
+	for n < len(p) {
+		b, err := l.r.ReadByte()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		if b == '\r' {
+			b = '\n'
+			if next, err := l.r.Peek(1); err == nil && next[0] == '\n' {
+				_, _ = l.r.Discard(1)
+			}
+		}
+		p[n] = b
+		n++
+		if l.r.Buffered() == 0 {
+			break // don't wait on the file with bytes to return
+		}
+	}
+	return n, nil
+}
+
+// checkUserCSVHeader accepts the columns of csvImportColumns in order,
+// ignoring case and surrounding spaces, and names any column it does not know
+func checkUserCSVHeader(header []string) error {
+	var unknown []string
+	matches := len(header) >= len(csvImportColumns)-1 && len(header) <= len(csvImportColumns)
+	for i, column := range header {
+		column = strings.ToLower(strings.TrimSpace(column))
+		known := false
+		for _, want := range csvImportColumns {
+			known = known || column == want
+		}
+		if !known {
+			unknown = append(unknown, strconv.Quote(column))
+		}
+		matches = matches && i < len(csvImportColumns) && column == csvImportColumns[i]
+	}
+
+	if len(unknown) > 0 {
+		return fmt.Errorf("Unknown CSV columns %s. Expected: %s", strings.Join(unknown, ", "), csvImportExpected)
+	}
+	if !matches {
+		return fmt.Errorf("Invalid CSV format. Expected: %s", csvImportExpected)
+	}
+	return nil
+}
+
+// checkUserCSVRow reports an import row with missing or extra columns, or
+// the first value that is too long
+func checkUserCSVRow(record []string) error {
+	if len(record) < len(csvImportColumns)-1 {
+		return errors.New("insufficient columns")
+	}
+	if len(record) > len(csvImportColumns) {
+		return errors.New("too many columns")
+	}
+	for i, value := range record {
+		if len(value) > csvImportMaxFieldLength {
+			return fmt.Errorf("%s is longer than %d characters", csvImportColumns[i], csvImportMaxFieldLength)
+		}
+	}
+	return nil
+}
+
+// csvSafe neutralizes a value a spreadsheet would run as a formula by
+// prefixing it with a quote, which spreadsheets show as text
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// ExportUsersCSV handles GET /api/admin/users/export
+// Lists every account as CSV for spreadsheets. Names and emails are
+// user-chosen, so values that would run as formulas are made text
+func (h *AdminHandler) ExportUsersCSV(c *gin.Context) {
+	ctx := c.Request.Context()
+	users, err := h.userRepo.ListAll(ctx)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to export users"))
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="vanish-users.csv"`)
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "email", "name", "is_admin", "is_service"})
+	for _, u := range users {
+		w.Write([]string{
+			strconv.FormatInt(u.ID, 10),
+			csvSafe(u.Email),
+			csvSafe(u.Name),
+			strconv.FormatBool(u.IsAdmin),
+			strconv.FormatBool(u.IsService),
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		requestid.Logger(ctx).Warn("user export aborted", "error", err)
+	}
+}
@@ -0,0 +1,141 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+	"github.com/milkiss/vanish/backend/internal/storage"
+)
+
+// ttlDriftTolerance is how far the Redis TTL and the metadata expiry may
+// drift apart before they are reported as disagreeing
+const ttlDriftTolerance = time.Minute
+
+// diagnosticsAccessEntries is how many access attempts a diagnosis lists
+const diagnosticsAccessEntries = 50
+
+// DiagnoseMessage handles GET /api/admin/messages/:id/diagnose
+// Reports why a message can or cannot be opened, comparing the metadata row
+// with what Redis holds. Never returns the ciphertext or the encryption key
+func (h *AdminHandler) DiagnoseMessage(c *gin.Context) {
+	ctx := c.Request.Context()
+	messageID := c.Param("id")
+
+	adminID, _ := c.Get("user_id")
+	requestid.Logger(ctx).Info("message diagnosed", "admin_id", adminID, "message_id", messageID)
+
+	metadata, err := h.metadataRepo.FindByMessageID(ctx, messageID)
+	if errors.Is(err, models.ErrMessageNotFound) {
+		c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeMessageNotFound, "Message not found"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to load message metadata"))
+		return
+	}
+
+	storedTTL, err := h.storage.GetTTL(ctx, messageID)
+	stored := err == nil
+	if err != nil && !errors.Is(err, models.ErrMessageNotFound) {
+		c.JSON(http.StatusServiceUnavailable, errorResponse(c, models.ErrorCodeUnavailable, "Failed to query message storage"))
+		return
+	}
+
+	report := models.MessageDiagnostics{
+		MessageID:          metadata.MessageID,
+		Status:             metadata.Status,
+		SenderID:           metadata.SenderID,
+		SenderName:         metadata.SenderName,
+		RecipientID:        metadata.RecipientID,
+		RecipientName:      metadata.RecipientName,
+		CreatedVia:         metadata.CreatedVia,
+		CreatedAt:          metadata.CreatedAt,
+		ReadAt:             metadata.ReadAt,
+		ExpiresAt:          metadata.ExpiresAt,
+		StoredPayload:      stored,
+		MetadataTTLSeconds: int64(time.Until(metadata.ExpiresAt).Seconds()),
+	}
+	if report.RecipientName == "" {
+		if recipient, err := h.userRepo.FindByID(ctx, metadata.RecipientID); err == nil {
+			report.RecipientName = recipient.Name
+		}
+	}
+	if stored && storedTTL != storage.NoExpiry {
+		seconds := int64(storedTTL.Seconds())
+		report.StorageTTLSeconds = &seconds
+	}
+
+	report.Consistent, report.Findings = diagnose(metadata, stored, storedTTL)
+
+	// The access log is supporting detail; a failure to load it still
+	// leaves a useful report
+	report.Access = []models.AccessLogEntry{}
+	access, err := h.access.List(ctx, messageID, diagnosticsAccessEntries)
+	if err != nil {
+		requestid.Logger(ctx).Warn("failed to load access log", "error", err)
+	}
+	for _, e := range access {
+		report.Access = append(report.Access, *e)
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// diagnose compares a metadata row with the state of its payload in storage
+// and explains the outcome. storedTTL is only meaningful when stored is true
+func diagnose(metadata *models.MessageMetadata, stored bool, storedTTL time.Duration) (bool, []string) {
+	remaining := time.Until(metadata.ExpiresAt)
+
+	switch metadata.Status {
+	case models.StatusRead:
+		findings := []string{"The message was read and burned; it cannot be opened again"}
+		if stored {
+			return false, append(findings, "The payload is still in storage even though the message was read")
+		}
+		return true, findings
+
+	case models.StatusExpired:
+		findings := []string{"The message expired before it was read"}
+		if stored {
+			return false, append(findings, "The payload is still in storage even though the message is marked expired")
+		}
+		return true, findings
+
+	case models.StatusClaimed:
+		if stored {
+			return false, []string{"The message is marked claimed but its payload was not moved out of storage"}
+		}
+		return true, []string{"The recipient claimed the message; it can only be fetched with their claim token"}
+	}
+
+	// Pending
+	if !stored {
+		if remaining <= 0 {
+			return true, []string{"The message expired in storage; the metadata will be marked expired by the next cleanup"}
+		}
+		return false, []string{fmt.Sprintf(
+			"The payload is missing from storage although the metadata expires in %s; it may have been evicted or lost in a Redis restart",
+			remaining.Round(time.Second))}
+	}
+
+	if storedTTL == storage.NoExpiry {
+		return false, []string{"The payload has no expiry in storage and will never be removed automatically"}
+	}
+
+	drift := storedTTL - remaining
+	if drift < 0 {
+		drift = -drift
+	}
+	if drift > ttlDriftTolerance {
+		return false, []string{
+			"The message is waiting to be read by the recipient",
+			fmt.Sprintf("Storage and metadata disagree on the expiry by %s", drift.Round(time.Second)),
+		}
+	}
+	return true, []string{"The message is waiting to be read by the recipient"}
+}
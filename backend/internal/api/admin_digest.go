@@ -0,0 +1,310 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/cron"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+)
+
+const (
+	// digestEventRetention is how long events are kept after a digest
+	digestEventRetention = 90 * 24 * time.Hour
+	// digestTimeFormat shows the bounds of a period in the digest
+	digestTimeFormat = "Mon Jan 2 15:04 MST"
+)
+
+var (
+	// errDigestDisabled is returned by Send without DIGEST_SCHEDULE or a
+	// digest store
+	errDigestDisabled = errors.New("admin digest is not configured")
+	// errDigestSlackDisabled is returned by Send while Slack is disabled
+	errDigestSlackDisabled = errors.New("slack integration not enabled")
+	// errDigestPostFailed is returned, wrapped, when Slack refused the digest
+	errDigestPostFailed = errors.New("failed to post digest to Slack")
+)
+
+// EventLog counts the notable events the admin digest reports. Recording
+// never fails the caller: errors are logged. A nil log records nothing
+type EventLog struct {
+	store persistence.DigestStore
+}
+
+// NewEventLog creates a log over store, or returns nil when store is nil
+func NewEventLog(store persistence.DigestStore) *EventLog {
+	if store == nil {
+		return nil
+	}
+	return &EventLog{store: store}
+}
+
+// Record counts one event of kind
+func (l *EventLog) Record(ctx context.Context, kind models.DigestEvent) {
+	if l == nil {
+		return
+	}
+	if err := l.store.RecordEvent(ctx, kind); err != nil {
+		requestid.Logger(ctx).Warn("failed to record digest event", "kind", kind, "error", err)
+	}
+}
+
+// DigestReporter posts a summary of each period of DIGEST_SCHEDULE to
+// DIGEST_SLACK_CHANNEL: the admin statistics plus failed notifications,
+// abuse alerts and recipients near their inbox cap. Each period is posted
+// once, even with several backend instances
+type DigestReporter struct {
+	store        persistence.DigestStore
+	userRepo     persistence.UserStore
+	metadataRepo persistence.MetadataStore
+	integrations *Integrations
+	schedule     *cron.Schedule // nil when the digest is disabled
+	channel      string
+	maxPending   int // MAX_PENDING_PER_RECIPIENT; 0 leaves near-cap recipients out
+}
+
+// NewDigestReporter creates a reporter for cfg; it is disabled when cfg has
+// no schedule or store is nil
+func NewDigestReporter(
+	cfg config.DigestConfig,
+	maxPending int,
+	store persistence.DigestStore,
+	userRepo persistence.UserStore,
+	metadataRepo persistence.MetadataStore,
+	integrations *Integrations,
+) (*DigestReporter, error) {
+	r := &DigestReporter{
+		store:        store,
+		userRepo:     userRepo,
+		metadataRepo: metadataRepo,
+		integrations: integrations,
+		channel:      cfg.SlackChannel,
+		maxPending:   maxPending,
+	}
+	if cfg.Enabled() && store != nil {
+		schedule, err := cron.Parse(cfg.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		r.schedule = schedule
+	}
+	return r, nil
+}
+
+// Enabled reports whether digests are scheduled
+func (r *DigestReporter) Enabled() bool {
+	return r.schedule != nil
+}
+
+// Run posts the digest whenever a period ends until ctx is cancelled; run
+// it as a lifecycle worker. It first posts the latest period if nobody has,
+// e.g. because the server was down when it ended
+func (r *DigestReporter) Run(ctx context.Context) {
+	r.sendScheduled(ctx, time.Now())
+	for {
+		next := r.schedule.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		r.sendScheduled(ctx, next)
+	}
+}
+
+// sendScheduled posts the digest of the period ended at now and logs the outcome
+func (r *DigestReporter) sendScheduled(ctx context.Context, now time.Time) {
+	logger := requestid.Logger(ctx)
+	result, err := r.Send(ctx, now)
+	if err != nil {
+		logger.Warn("failed to send admin digest", "error", err)
+		return
+	}
+	if result.Sent {
+		logger.Info("sent admin digest", "period", result.Digest.Period, "channel", r.channel)
+	}
+}
+
+// Send compiles the digest of the latest period ended at or before now and
+// posts it, unless it was posted already. A digest that could not be posted
+// is not marked sent, so the next attempt retries it
+func (r *DigestReporter) Send(ctx context.Context, now time.Time) (*models.DigestSendResponse, error) {
+	if !r.Enabled() {
+		return nil, errDigestDisabled
+	}
+	slackClient := r.integrations.Slack()
+	if slackClient == nil {
+		return nil, errDigestSlackDisabled
+	}
+
+	to := r.schedule.Prev(now)
+	from := r.schedule.Prev(to.Add(-time.Minute))
+	if to.IsZero() || from.IsZero() {
+		return nil, fmt.Errorf("no digest period ends before %s", now.Format(time.RFC3339))
+	}
+
+	digest, err := r.compile(ctx, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile digest: %w", err)
+	}
+
+	claimed, err := r.store.ClaimDigest(ctx, digest.Period)
+	if err != nil {
+		return nil, err
+	}
+	if !claimed {
+		return &models.DigestSendResponse{Sent: false, Digest: digest}, nil
+	}
+
+	text, blocks := digestMessage(digest)
+	if _, err := slackClient.PostToChannel(ctx, r.channel, text, blocks); err != nil {
+		if releaseErr := r.store.ReleaseDigest(ctx, digest.Period); releaseErr != nil {
+			requestid.Logger(ctx).Warn("failed to release admin digest", "period", digest.Period, "error", releaseErr)
+		}
+		return nil, fmt.Errorf("%w: %v", errDigestPostFailed, err)
+	}
+
+	if _, err := r.store.PurgeEventsBefore(ctx, now.Add(-digestEventRetention)); err != nil {
+		requestid.Logger(ctx).Warn("failed to purge digest events", "error", err)
+	}
+	return &models.DigestSendResponse{Sent: true, Digest: digest}, nil
+}
+
+// compile gathers the aggregate numbers of [from, to)
+func (r *DigestReporter) compile(ctx context.Context, from, to time.Time) (*models.Digest, error) {
+	stats, err := collectStatistics(ctx, r.userRepo, r.metadataRepo, nil)
+	if err != nil {
+		return nil, err
+	}
+	digest := &models.Digest{
+		Period:     to.UTC().Format(time.RFC3339),
+		From:       from,
+		To:         to,
+		Statistics: *stats,
+	}
+
+	if digest.Created, err = r.countMessages(ctx, models.MetricCreated, from, to); err != nil {
+		return nil, err
+	}
+	if digest.Read, err = r.countMessages(ctx, models.MetricRead, from, to); err != nil {
+		return nil, err
+	}
+
+	events, err := r.store.CountEvents(ctx, from, to)
+	if err != nil {
+		return nil, err
+	}
+	digest.NotificationFailures = events[models.EventNotificationFailed]
+	digest.AbuseAlerts = events[models.EventAbuseAlert]
+
+	if r.maxPending > 0 {
+		atLeast := max((r.maxPending*models.DigestNearCapPercent+99)/100, 1)
+		near, err := r.metadataRepo.CountRecipientsWithPending(ctx, atLeast)
+		if err != nil {
+			return nil, err
+		}
+		digest.RecipientsNearInboxCap = &near
+	}
+	return digest, nil
+}
+
+// countMessages sums a metric over [from, to)
+func (r *DigestReporter) countMessages(ctx context.Context, metric models.StatisticsMetric, from, to time.Time) (int, error) {
+	points, err := r.metadataRepo.CountByBucket(ctx, metric, models.IntervalWeek, from, to)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, p := range points {
+		total += int(p.Count)
+	}
+	return total, nil
+}
+
+// digestMessage renders the digest as Block Kit, with a plain-text fallback
+func digestMessage(d *models.Digest) (string, []map[string]interface{}) {
+	period := fmt.Sprintf("%s – %s", d.From.Format(digestTimeFormat), d.To.Format(digestTimeFormat))
+	text := fmt.Sprintf("Vanish digest for %s: %d messages created, %d read, %d failed notifications, %d abuse alerts",
+		period, d.Created, d.Read, d.NotificationFailures, d.AbuseAlerts)
+
+	stats := d.Statistics
+	activity := []string{
+		fmt.Sprintf("*Created*\n%d", d.Created),
+		fmt.Sprintf("*Read*\n%d", d.Read),
+		fmt.Sprintf("*Users*\n%d (%d admins)", stats.Users.Total, stats.Users.Admins),
+		fmt.Sprintf("*Messages*\n%d pending · %d read · %d expired", stats.Messages.Pending, stats.Messages.Read, stats.Messages.Expired),
+	}
+	notable := []string{
+		fmt.Sprintf("*Failed notifications*\n%d", d.NotificationFailures),
+		fmt.Sprintf("*Abuse alerts*\n%d", d.AbuseAlerts),
+	}
+	if d.RecipientsNearInboxCap != nil {
+		notable = append(notable, fmt.Sprintf("*Recipients near inbox cap*\n%d", *d.RecipientsNearInboxCap))
+	}
+
+	var clients []string
+	for _, client := range models.Clients {
+		clients = append(clients, fmt.Sprintf("%s %d", client, stats.Messages.ByClient[client]))
+	}
+
+	blocks := []map[string]interface{}{
+		{"type": "header", "text": plainText("Vanish digest")},
+		{"type": "context", "elements": []map[string]interface{}{markdownText(period)}},
+		{"type": "section", "fields": markdownFields(activity)},
+		{"type": "section", "fields": markdownFields(notable)},
+		{"type": "context", "elements": []map[string]interface{}{markdownText("All messages by client: " + strings.Join(clients, " · "))}},
+	}
+	return text, blocks
+}
+
+func plainText(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "plain_text", "text": text}
+}
+
+func markdownText(text string) map[string]interface{} {
+	return map[string]interface{}{"type": "mrkdwn", "text": text}
+}
+
+func markdownFields(fields []string) []map[string]interface{} {
+	out := make([]map[string]interface{}, len(fields))
+	for i, field := range fields {
+		out[i] = markdownText(field)
+	}
+	return out
+}
+
+// SendDigest handles POST /api/admin/digest/send
+// Posts the digest of the latest period now, e.g. to test the setup. A
+// period already posted is not posted again; the response then has sent
+// false and shows the digest
+func (r *DigestReporter) SendDigest(c *gin.Context) {
+	ctx := c.Request.Context()
+	result, err := r.Send(ctx, time.Now())
+	switch {
+	case errors.Is(err, errDigestDisabled):
+		c.JSON(http.StatusServiceUnavailable, errorResponse(c, models.ErrorCodeIntegrationDisabled, "Admin digest not configured; set DIGEST_SCHEDULE and DIGEST_SLACK_CHANNEL"))
+	case errors.Is(err, errDigestSlackDisabled):
+		c.JSON(http.StatusServiceUnavailable, errorResponse(c, models.ErrorCodeIntegrationDisabled, "Slack integration not enabled"))
+	case errors.Is(err, errDigestPostFailed):
+		requestid.Logger(ctx).Error("failed to send admin digest", "error", err)
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeUpstreamFailed, "Failed to post admin digest to Slack"))
+	case err != nil:
+		requestid.Logger(ctx).Error("failed to send admin digest", "error", err)
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to send admin digest"))
+	default:
+		c.JSON(http.StatusOK, result)
+	}
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+)
+
+// ListDuplicateAccounts handles GET /api/admin/users/duplicates
+// Lists the accounts whose emails differ only in case. They were created
+// before emails were normalized; logins reach only the oldest of each set,
+// and the unique index on emails is not created until they are merged
+func (h *AdminHandler) ListDuplicateAccounts(c *gin.Context) {
+	users, err := h.userRepo.ListEmailDuplicates(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to list duplicate accounts"))
+		return
+	}
+
+	duplicates := []models.DuplicateAccounts{}
+	for _, user := range users {
+		email := models.NormalizeEmail(user.Email)
+		if n := len(duplicates); n == 0 || duplicates[n-1].Email != email {
+			duplicates = append(duplicates, models.DuplicateAccounts{Email: email})
+		}
+		last := &duplicates[len(duplicates)-1]
+		last.Accounts = append(last.Accounts, user.ToProvisionedUser())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"duplicates": duplicates})
+}
+
+// MergeUser handles POST /api/admin/users/:id/merge/:duplicateId
+// Merges a duplicate account, such as a local account and the SSO account
+// created for the same person, into the account :id. The messages the
+// duplicate sent or received, its API keys and its access log rows move to
+// :id in one transaction, and the duplicate is deactivated and left as a
+// tombstone. The same transaction records the merge, with the acting admin,
+// in the admin audit log. The kept account's name and admin flag are
+// unchanged, and its email is normalized
+func (h *AdminHandler) MergeUser(c *gin.Context) {
+	keepID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Invalid user ID"))
+		return
+	}
+	duplicateID, err := strconv.ParseInt(c.Param("duplicateId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Invalid duplicate user ID"))
+		return
+	}
+	if keepID == duplicateID {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Cannot merge an account into itself"))
+		return
+	}
+	adminID, _ := c.Get("user_id")
+	if adminID.(int64) == duplicateID {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeCannotDeleteSelf, "Cannot merge away your own account"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	keep, err := h.userRepo.FindByID(ctx, keepID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeUserNotFound, "User not found"))
+		return
+	}
+	duplicate, err := h.userRepo.FindByID(ctx, duplicateID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeUserNotFound, "Duplicate user not found"))
+		return
+	}
+	if keep.IsService || duplicate.IsService || keep.IsAnonymized() || duplicate.IsAnonymized() {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Only regular accounts can be merged"))
+		return
+	}
+
+	moved, err := h.userRepo.MergeUsers(ctx, adminID.(int64), keepID, duplicateID)
+	if err != nil {
+		requestid.Logger(ctx).Error("failed to merge accounts", "keep_id", keepID, "duplicate_id", duplicateID, "error", err)
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to merge accounts"))
+		return
+	}
+
+	requestid.Logger(ctx).Info("accounts merged",
+		"keep_id", keepID, "duplicate_id", duplicateID,
+		"moved_messages", moved.Messages, "moved_api_keys", moved.APIKeys, "moved_access_log", moved.AccessLog,
+		"admin_id", adminID)
+
+	if merged, err := h.userRepo.FindByID(ctx, keepID); err == nil {
+		keep = merged
+	}
+	c.JSON(http.StatusOK, models.MergeUserResponse{Moved: *moved, User: keep.ToProvisionedUser()})
+}
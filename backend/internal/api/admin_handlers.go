@@ -1,28 +1,51 @@
 package api
 
 import (
-	"encoding/csv"
+	"context"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/accesslog"
+	"github.com/milkiss/vanish/backend/internal/config"
 	"github.com/milkiss/vanish/backend/internal/models"
-	"github.com/milkiss/vanish/backend/internal/repository"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+	"github.com/milkiss/vanish/backend/internal/storage"
 )
 
 // AdminHandler handles admin-only operations
 type AdminHandler struct {
-	userRepo     *repository.UserRepository
-	metadataRepo *repository.MetadataRepository
+	userRepo     persistence.UserStore
+	metadataRepo persistence.MetadataStore
+	storage      storage.Storage
+	access       *accesslog.Recorder // source of the access attempts in diagnostics
+	settings     AdminSettingsResponse
+	reloader     *ConfigReloader // when set, settings follow configuration reloads
+	orphans      *OrphanScanner
+	leaderboards bool
+	policies     persistence.TTLPolicyStore
 }
 
 // NewAdminHandler creates a new admin handler
-func NewAdminHandler(userRepo *repository.UserRepository, metadataRepo *repository.MetadataRepository) *AdminHandler {
+// access may be nil, leaving the access attempts out of diagnostics;
+// reloader may be nil, reporting the settings of cfg; policies may be nil,
+// leaving TTL policies unavailable
+func NewAdminHandler(userRepo persistence.UserStore, metadataRepo persistence.MetadataStore, storage storage.Storage, access *accesslog.Recorder, cfg *config.Config, reloader *ConfigReloader, policies persistence.TTLPolicyStore) *AdminHandler {
 	return &AdminHandler{
 		userRepo:     userRepo,
 		metadataRepo: metadataRepo,
+		storage:      storage,
+		access:       access,
+		settings:     adminSettings(cfg),
+		reloader:     reloader,
+		orphans:      NewOrphanScanner(storage, metadataRepo, cfg.Message.OrphanGracePeriod),
+		leaderboards: cfg.Stats.LeaderboardsEnabled,
+		policies:     policies,
 	}
 }
 
@@ -34,42 +57,36 @@ func (h *AdminHandler) CreateUser(c *gin.Context) {
 		Name     string `json:"name" binding:"required,min=2,max=100"`
 		Password string `json:"password" binding:"required,min=8"`
 		IsAdmin  bool   `json:"is_admin"`
+		Region   string `json:"region" binding:"omitempty,region"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Invalid request: " + err.Error(),
-		})
+		c.JSON(http.StatusBadRequest, bindError(c, err))
 		return
 	}
 
 	// Hash password
 	hashedPassword, err := models.HashPassword(req.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to hash password",
-		})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to hash password"))
 		return
 	}
 
 	// Create user
 	user := &models.User{
-		Email:    req.Email,
+		Email:    models.NormalizeEmail(req.Email),
 		Name:     req.Name,
 		Password: hashedPassword,
 		IsAdmin:  req.IsAdmin,
+		Region:   req.Region,
 	}
 
 	if err := h.userRepo.Create(c.Request.Context(), user); err != nil {
 		if err == models.ErrUserExists {
-			c.JSON(http.StatusConflict, models.ErrorResponse{
-				Error: "User with this email already exists",
-			})
+			c.JSON(http.StatusConflict, errorResponse(c, models.ErrorCodeUserExists, "User with this email already exists"))
 			return
 		}
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to create user",
-		})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to create user"))
 		return
 	}
 
@@ -81,9 +98,7 @@ func (h *AdminHandler) CreateUser(c *gin.Context) {
 func (h *AdminHandler) UpdateUser(c *gin.Context) {
 	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Invalid user ID",
-		})
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Invalid user ID"))
 		return
 	}
 
@@ -92,37 +107,36 @@ func (h *AdminHandler) UpdateUser(c *gin.Context) {
 		Name     *string `json:"name" binding:"omitempty,min=2,max=100"`
 		Password *string `json:"password" binding:"omitempty,min=8"`
 		IsAdmin  *bool   `json:"is_admin"`
+		Region   *string `json:"region" binding:"omitempty,region"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Invalid request: " + err.Error(),
-		})
+		c.JSON(http.StatusBadRequest, bindError(c, err))
 		return
 	}
 
 	// Get existing user
 	user, err := h.userRepo.FindByID(c.Request.Context(), userID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, models.ErrorResponse{
-			Error: "User not found",
-		})
+		c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeUserNotFound, "User not found"))
 		return
 	}
 
 	// Update fields if provided
 	if req.Email != nil {
-		user.Email = *req.Email
+		user.Email = models.NormalizeEmail(*req.Email)
 	}
 	if req.Name != nil {
 		user.Name = *req.Name
 	}
 	if req.Password != nil {
+		if user.IsDirectoryAccount() {
+			c.JSON(http.StatusConflict, errorResponse(c, models.ErrorCodePasswordManaged, "This account signs in through LDAP; reset its password in the directory"))
+			return
+		}
 		hashedPassword, err := models.HashPassword(*req.Password)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-				Error: "Failed to hash password",
-			})
+			c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to hash password"))
 			return
 		}
 		user.Password = hashedPassword
@@ -130,12 +144,18 @@ func (h *AdminHandler) UpdateUser(c *gin.Context) {
 	if req.IsAdmin != nil {
 		user.IsAdmin = *req.IsAdmin
 	}
+	if req.Region != nil {
+		// Messages already sent stay where they are; the region applies to new ones
+		user.Region = *req.Region
+	}
 
 	// Update user
 	if err := h.userRepo.Update(c.Request.Context(), user); err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to update user",
-		})
+		if err == models.ErrUserExists {
+			c.JSON(http.StatusConflict, errorResponse(c, models.ErrorCodeUserExists, "User with this email already exists"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to update user"))
 		return
 	}
 
@@ -143,94 +163,133 @@ func (h *AdminHandler) UpdateUser(c *gin.Context) {
 }
 
 // DeleteUser handles DELETE /api/admin/users/:id
-// Admin deletes a user
+// Admin deletes a user. Like self-service deletion the account is
+// anonymized, keeping other users' message history intact
 func (h *AdminHandler) DeleteUser(c *gin.Context) {
-	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Invalid user ID",
-		})
+	userID, ok := deletableUserID(c)
+	if !ok {
 		return
 	}
 
-	// Prevent deleting yourself
-	currentUserID, _ := c.Get("user_id")
-	if currentUserID.(int64) == userID {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Cannot delete your own account",
-		})
+	if _, err := h.userRepo.FindByID(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeUserNotFound, "User not found"))
 		return
 	}
 
-	if err := h.userRepo.Delete(c.Request.Context(), userID); err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to delete user",
-		})
+	if err := anonymizeAccount(c.Request.Context(), h.userRepo, h.metadataRepo, h.storage, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to delete user"))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
 
+// PurgeUser handles DELETE /api/admin/users/:id/purge
+// Admin permanently removes a user. This cascades to the metadata of every
+// message they sent or received, erasing it from the other party's history too
+func (h *AdminHandler) PurgeUser(c *gin.Context) {
+	userID, ok := deletableUserID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.userRepo.Delete(c.Request.Context(), userID); err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to purge user"))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User purged successfully"})
+}
+
+// deletableUserID parses the :id parameter and refuses the caller's own ID
+// It writes the error response itself and reports whether to continue
+func deletableUserID(c *gin.Context) (int64, bool) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Invalid user ID"))
+		return 0, false
+	}
+
+	// Prevent deleting yourself
+	currentUserID, _ := c.Get("user_id")
+	if currentUserID.(int64) == userID {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeCannotDeleteSelf, "Cannot delete your own account"))
+		return 0, false
+	}
+
+	return userID, true
+}
+
 // ImportUsersCSV handles POST /api/admin/users/import
-// Import users from CSV file
+// Import users from CSV file. The file is streamed twice, first to refuse a
+// malformed or oversized file before any user is created, then to create
+// the users, so it is never held in memory whole
 func (h *AdminHandler) ImportUsersCSV(c *gin.Context) {
+	ctx := c.Request.Context()
+	if err := c.Request.ParseMultipartForm(csvImportFormMemory); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "No file uploaded"))
+		return
+	}
+	defer c.Request.MultipartForm.RemoveAll()
 	file, err := c.FormFile("file")
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "No file uploaded",
-		})
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "No file uploaded"))
 		return
 	}
 
 	// Open the file
 	f, err := file.Open()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to open file",
-		})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to open file"))
 		return
 	}
 	defer f.Close()
 
-	// Parse CSV
-	reader := csv.NewReader(f)
-	records, err := reader.ReadAll()
-	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Invalid CSV file",
-		})
+	// Check the whole file, then start over to import it
+	if err := checkUserCSV(f); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidCSV, err.Error()))
 		return
 	}
-
-	if len(records) < 2 {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "CSV file is empty",
-		})
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to read CSV file"))
 		return
 	}
-
-	// Validate header
-	header := records[0]
-	if len(header) < 3 || header[0] != "email" || header[1] != "name" || header[2] != "password" {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Invalid CSV format. Expected: email,name,password[,is_admin]",
-		})
+	reader, err := newUserCSVReader(f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to read CSV file"))
 		return
 	}
 
 	var created, failed int
-	var errors []string
+	errors := []string{}
+	rowFailed := func(format string, args ...any) {
+		failed++
+		if len(errors) < csvImportMaxErrors {
+			errors = append(errors, fmt.Sprintf(format, args...))
+		}
+	}
 
 	// Process each row
-	for i, record := range records[1:] {
-		if len(record) < 3 {
-			errors = append(errors, fmt.Sprintf("Row %d: insufficient columns", i+2))
-			failed++
+	for {
+		record, line, err := reader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// The file changed since it was checked
+			c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to read CSV file"))
+			return
+		}
+		if processed := created + failed; processed > 0 && processed%csvImportProgressRows == 0 {
+			requestid.Logger(ctx).Info("user import in progress", "rows", processed, "created", created, "failed", failed)
+		}
+
+		if err := checkUserCSVRow(record); err != nil {
+			rowFailed("Row %d: %v", line, err)
 			continue
 		}
 
-		email := strings.TrimSpace(record[0])
+		email := models.NormalizeEmail(record[0])
 		name := strings.TrimSpace(record[1])
 		password := strings.TrimSpace(record[2])
 		isAdmin := false
@@ -241,8 +300,7 @@ func (h *AdminHandler) ImportUsersCSV(c *gin.Context) {
 		// Hash password
 		hashedPassword, err := models.HashPassword(password)
 		if err != nil {
-			errors = append(errors, fmt.Sprintf("Row %d: failed to hash password", i+2))
-			failed++
+			rowFailed("Row %d: failed to hash password", line)
 			continue
 		}
 
@@ -254,14 +312,17 @@ func (h *AdminHandler) ImportUsersCSV(c *gin.Context) {
 			IsAdmin:  isAdmin,
 		}
 
-		if err := h.userRepo.Create(c.Request.Context(), user); err != nil {
-			errors = append(errors, fmt.Sprintf("Row %d (%s): %v", i+2, email, err))
-			failed++
+		if err := h.userRepo.Create(ctx, user); err != nil {
+			rowFailed("Row %d (%s): %v", line, email, err)
 			continue
 		}
 
 		created++
 	}
+	if failed > len(errors) {
+		errors = append(errors, fmt.Sprintf("%d more rows failed", failed-len(errors)))
+	}
+	requestid.Logger(ctx).Info("user import finished", "created", created, "failed", failed)
 
 	c.JSON(http.StatusOK, gin.H{
 		"created": created,
@@ -273,75 +334,306 @@ func (h *AdminHandler) ImportUsersCSV(c *gin.Context) {
 // GetStatistics handles GET /api/admin/statistics
 // Get system statistics
 func (h *AdminHandler) GetStatistics(c *gin.Context) {
-	// Get user count
-	users, err := h.userRepo.ListAll(c.Request.Context())
+	stats, err := collectStatistics(c.Request.Context(), h.userRepo, h.metadataRepo, storageRegions(h.storage))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to get statistics",
-		})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to get statistics"))
 		return
 	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// collectStatistics counts users and messages; the digest reports the same
+// numbers as GET /api/admin/statistics. Messages are counted per region by
+// the prefix of their IDs; regions lists the configured ones, which appear
+// even without messages
+func collectStatistics(ctx context.Context, userRepo persistence.UserStore, metadataRepo persistence.MetadataStore, regions []string) (*models.SystemStatistics, error) {
+	users, err := userRepo.ListAll(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	adminCount := 0
+	stats := &models.SystemStatistics{}
+	stats.Users.Total = len(users)
 	for _, user := range users {
 		if user.IsAdmin {
-			adminCount++
+			stats.Users.Admins++
 		}
 	}
+	stats.Users.Regular = stats.Users.Total - stats.Users.Admins
 
 	// Get message history for statistics
 	// Note: This is a simplified version - you might want to add dedicated queries
-	history, err := h.metadataRepo.GetUserHistory(c.Request.Context(), 0, 10000)
+	history, err := metadataRepo.GetUserHistory(ctx, 0, "", models.Page{Limit: 10000})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to get message statistics",
-		})
-		return
+		return nil, err
 	}
 
-	pendingCount := 0
-	readCount := 0
-	expiredCount := 0
-
+	stats.Messages.Total = len(history)
+	stats.Messages.ByClient = make(map[models.Client]int, len(models.Clients))
+	for _, client := range models.Clients {
+		stats.Messages.ByClient[client] = 0
+	}
+	stats.Messages.ByRegion = map[string]int{models.DefaultRegion: 0}
+	for _, region := range regions {
+		stats.Messages.ByRegion[region] = 0
+	}
 	for _, msg := range history {
+		stats.Messages.ByClient[msg.CreatedVia]++
+		region := storage.RegionOf(msg.MessageID)
+		if region == "" {
+			region = models.DefaultRegion
+		}
+		stats.Messages.ByRegion[region]++
 		switch msg.Status {
 		case models.StatusPending:
-			pendingCount++
+			stats.Messages.Pending++
 		case models.StatusRead:
-			readCount++
+			stats.Messages.Read++
 		case models.StatusExpired:
-			expiredCount++
+			stats.Messages.Expired++
 		}
 	}
+	return stats, nil
+}
 
-	c.JSON(http.StatusOK, gin.H{
-		"users": gin.H{
-			"total":  len(users),
-			"admins": adminCount,
-			"regular": len(users) - adminCount,
-		},
-		"messages": gin.H{
-			"total":   len(history),
-			"pending": pendingCount,
-			"read":    readCount,
-			"expired": expiredCount,
-		},
-	})
+// storageRegions returns the regions store routes messages to, none when
+// it keeps every message in one cluster
+func storageRegions(store storage.Storage) []string {
+	if router, ok := store.(storage.RegionRouter); ok {
+		return router.Regions()
+	}
+	return nil
 }
 
 // CleanupExpired handles POST /api/admin/cleanup
-// Manually trigger cleanup of expired messages
+// Manually trigger cleanup of expired messages, deleting whatever Redis
+// still holds of them
 func (h *AdminHandler) CleanupExpired(c *gin.Context) {
-	count, err := h.metadataRepo.CleanupExpired(c.Request.Context())
+	report, err := expireMessages(c.Request.Context(), h.metadataRepo, h.storage)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to cleanup expired messages",
-		})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to cleanup expired messages"))
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Cleanup completed",
-		"expired_count": count,
-	})
+	c.JSON(http.StatusOK, report)
+}
+
+const (
+	// maxTimeSeriesBuckets bounds the range of a time-series query
+	maxTimeSeriesBuckets = 400
+	// leaderboardSize is how many users each leaderboard lists
+	leaderboardSize = 10
+)
+
+// GetTimeSeries handles GET /api/admin/statistics/timeseries
+// Counts messages per UTC day or week for charting. from and to accept
+// RFC 3339 timestamps or YYYY-MM-DD dates (a date "to" includes that day);
+// the range is widened to whole buckets and empty buckets are returned as 0
+func (h *AdminHandler) GetTimeSeries(c *gin.Context) {
+	metric := models.StatisticsMetric(c.DefaultQuery("metric", string(models.MetricCreated)))
+	interval := models.StatisticsInterval(c.DefaultQuery("interval", string(models.IntervalDay)))
+	if !metric.Valid() {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "metric must be one of created, read, expired"))
+		return
+	}
+	if !interval.Valid() {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "interval must be day or week"))
+		return
+	}
+
+	to := time.Now().UTC()
+	if raw := c.Query("to"); raw != "" {
+		t, dateOnly, err := parseStatisticsTime(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Invalid to: "+err.Error()))
+			return
+		}
+		if dateOnly {
+			t = t.AddDate(0, 0, 1)
+		}
+		to = t
+	}
+
+	from := to.AddDate(0, 0, -30)
+	if interval == models.IntervalWeek {
+		from = to.AddDate(0, 0, -7*12)
+	}
+	if raw := c.Query("from"); raw != "" {
+		t, _, err := parseStatisticsTime(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Invalid from: "+err.Error()))
+			return
+		}
+		from = t
+	}
+
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "from must be before to"))
+		return
+	}
+
+	// Widen to whole buckets: to becomes the end of the bucket holding its last instant
+	from = interval.Truncate(from)
+	to = interval.Next(interval.Truncate(to.Add(-time.Nanosecond)))
+
+	buckets := []time.Time{}
+	for b := from; b.Before(to); b = interval.Next(b) {
+		if len(buckets) == maxTimeSeriesBuckets {
+			c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, fmt.Sprintf("Range too large: at most %d buckets", maxTimeSeriesBuckets)))
+			return
+		}
+		buckets = append(buckets, b)
+	}
+
+	ctx := c.Request.Context()
+	counts, err := h.metadataRepo.CountByBucket(ctx, metric, interval, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to get statistics"))
+		return
+	}
+
+	byBucket := make(map[time.Time]int64, len(counts))
+	for _, p := range counts {
+		byBucket[p.Bucket.UTC()] = p.Count
+	}
+	points := make([]models.TimeSeriesPoint, len(buckets))
+	for i, b := range buckets {
+		points[i] = models.TimeSeriesPoint{Bucket: b, Count: byBucket[b]}
+	}
+
+	resp := models.TimeSeriesResponse{
+		Metric:              metric,
+		Interval:            interval,
+		From:                from,
+		To:                  to,
+		Points:              points,
+		LeaderboardsEnabled: h.leaderboards,
+	}
+
+	if h.leaderboards {
+		if resp.TopSenders, err = h.metadataRepo.TopSenders(ctx, from, to, leaderboardSize); err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to get statistics"))
+			return
+		}
+		if resp.TopRecipients, err = h.metadataRepo.TopRecipients(ctx, from, to, leaderboardSize); err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to get statistics"))
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// parseStatisticsTime parses an RFC 3339 timestamp or a YYYY-MM-DD date
+// (midnight UTC) and reports which form was used
+func parseStatisticsTime(raw string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", raw); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("expected RFC 3339 timestamp or YYYY-MM-DD date")
+	}
+	return t.UTC(), false, nil
+}
+
+// AdminSettingsResponse describes security-relevant server settings
+// Secrets (tokens, passwords) are never included
+type AdminSettingsResponse struct {
+	Okta  IntegrationSettings `json:"okta"`
+	Email IntegrationSettings `json:"email"`
+	Slack SlackSettings       `json:"slack"`
+
+	// TTLPolicies are the rules of /api/admin/ttl-policies in evaluation order
+	TTLPolicies []*models.TTLPolicyRule `json:"ttl_policies"`
+	// CategoryPolicies are the policies of /api/admin/category-policies
+	CategoryPolicies []*models.CategoryPolicy `json:"category_policies"`
+	// BannedDomains are the domains of /api/admin/banned-domains
+	BannedDomains []*models.BannedDomain `json:"banned_domains"`
+	// DLPPatterns are the patterns of /api/admin/dlp-patterns
+	DLPPatterns []*models.DLPPattern `json:"dlp_patterns"`
+}
+
+// IntegrationSettings reports whether an integration is enabled
+type IntegrationSettings struct {
+	Enabled bool `json:"enabled"`
+}
+
+// SlackSettings reports how Slack-created secrets are keyed
+type SlackSettings struct {
+	Enabled     bool   `json:"enabled"`
+	StoreKey    bool   `json:"store_key"`
+	KeyHandling string `json:"key_handling"` // explains the trade-off of StoreKey
+}
+
+const (
+	slackKeyStored = "Slack secrets are encrypted by the server and the key is stored with the message metadata " +
+		"so recipients can reopen the link from their history. Anyone with database and Redis access can decrypt them. " +
+		"Set SLACK_STORE_KEY=false to discard the key after the recipient's DM is sent."
+	slackKeyDiscarded = "Slack secrets are encrypted by the server and the key is only sent to the recipient by Slack DM, then discarded. " +
+		"Operators cannot decrypt stored messages, but recipients cannot reopen the link from their history."
+)
+
+// adminSettings builds the settings snapshot reported to admins
+func adminSettings(cfg *config.Config) AdminSettingsResponse {
+	keyHandling := slackKeyStored
+	if !cfg.Slack.StoreKey {
+		keyHandling = slackKeyDiscarded
+	}
+
+	return AdminSettingsResponse{
+		Okta:  IntegrationSettings{Enabled: cfg.Okta.Enabled},
+		Email: IntegrationSettings{Enabled: cfg.Email.Enabled},
+		Slack: SlackSettings{
+			Enabled:     cfg.Slack.Enabled,
+			StoreKey:    cfg.Slack.StoreKey,
+			KeyHandling: keyHandling,
+		},
+	}
+}
+
+// GetSettings handles GET /api/admin/settings
+// Reports integration settings and their security trade-offs, the TTL
+// policy rules, the category policies and the sender policy
+func (h *AdminHandler) GetSettings(c *gin.Context) {
+	settings := h.settings
+	if h.reloader != nil {
+		settings = adminSettings(h.reloader.Current())
+	}
+
+	settings.TTLPolicies = []*models.TTLPolicyRule{}
+	if h.policies != nil {
+		rules, err := h.policies.ListTTLPolicies(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to list TTL policies"))
+			return
+		}
+		settings.TTLPolicies = rules
+	}
+	settings.CategoryPolicies = []*models.CategoryPolicy{}
+	if h.policies != nil {
+		policies, err := h.policies.ListCategoryPolicies(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to list category policies"))
+			return
+		}
+		settings.CategoryPolicies = policies
+	}
+	settings.BannedDomains = []*models.BannedDomain{}
+	settings.DLPPatterns = []*models.DLPPattern{}
+	if h.policies != nil {
+		domains, err := h.policies.ListBannedDomains(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to list banned domains"))
+			return
+		}
+		settings.BannedDomains = domains
+		patterns, err := h.policies.ListDLPPatterns(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to list DLP patterns"))
+			return
+		}
+		settings.DLPPatterns = patterns
+	}
+	c.JSON(http.StatusOK, settings)
 }
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+)
+
+// inactiveDays parses the inactive_days query parameter, def when absent
+// It writes the error response itself and reports whether to continue
+func inactiveDays(c *gin.Context, def int) (int, bool) {
+	raw := c.Query("inactive_days")
+	if raw == "" {
+		return def, true
+	}
+	days, err := strconv.Atoi(raw)
+	if err != nil || days < 1 || days > models.MaxInactiveDays {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest,
+			fmt.Sprintf("inactive_days must be between 1 and %d", models.MaxInactiveDays)))
+		return 0, false
+	}
+	return days, true
+}
+
+// ListUsers handles GET /api/admin/users
+// Lists every regular account, deactivated ones included, with its last
+// sign-in. With inactive_days only those that have not signed in for that
+// many days, or never, are listed
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	days, ok := inactiveDays(c, 0)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	var users []*models.User
+	var err error
+	if days > 0 {
+		users, err = h.userRepo.ListInactive(ctx, models.InactiveCutoff(days, time.Now()))
+	} else {
+		users, err = h.userRepo.ListAccounts(ctx)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to list users"))
+		return
+	}
+
+	accounts := make([]models.AdminUser, 0, len(users))
+	for _, user := range users {
+		accounts = append(accounts, user.ToAdminUser())
+	}
+	c.JSON(http.StatusOK, gin.H{"users": accounts})
+}
+
+// ListInactiveUsers handles GET /api/admin/users/inactive
+// Lists the active accounts that never signed in or have not for
+// inactive_days (default 90), the candidates for deactivation
+func (h *AdminHandler) ListInactiveUsers(c *gin.Context) {
+	days, ok := inactiveDays(c, models.DefaultInactiveDays)
+	if !ok {
+		return
+	}
+
+	cutoff := models.InactiveCutoff(days, time.Now())
+	users, err := h.userRepo.ListInactive(c.Request.Context(), cutoff)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to list inactive users"))
+		return
+	}
+
+	accounts := []models.AdminUser{}
+	for _, user := range users {
+		if user.IsActive {
+			accounts = append(accounts, user.ToAdminUser())
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"inactive_days": days,
+		"cutoff":        cutoff.UTC(),
+		"users":         accounts,
+	})
+}
+
+// DeactivateInactiveUsers handles POST /api/admin/users/inactive/deactivate
+// Deactivates the listed accounts that are still inactive for
+// inactive_days. Accounts that signed in since they were listed, are
+// already deactivated, are unknown or are the caller's own are skipped
+func (h *AdminHandler) DeactivateInactiveUsers(c *gin.Context) {
+	var req models.DeactivateInactiveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindError(c, err))
+		return
+	}
+
+	ctx := c.Request.Context()
+	users, err := h.userRepo.ListInactive(ctx, models.InactiveCutoff(req.InactiveDays, time.Now()))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to list inactive users"))
+		return
+	}
+	inactive := make(map[int64]*models.User, len(users))
+	for _, user := range users {
+		if user.IsActive {
+			inactive[user.ID] = user
+		}
+	}
+
+	currentUserID, _ := c.Get("user_id")
+	resp := models.DeactivateInactiveResponse{Deactivated: []int64{}, Skipped: []int64{}}
+	for _, id := range req.UserIDs {
+		user, ok := inactive[id]
+		if !ok || id == currentUserID.(int64) {
+			resp.Skipped = append(resp.Skipped, id)
+			continue
+		}
+		delete(inactive, id) // listed twice
+		user.IsActive = false
+		if err := h.userRepo.Update(ctx, user); err != nil {
+			requestid.Logger(ctx).Error("failed to deactivate inactive user", "user_id", id, "error", err)
+			c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to deactivate users"))
+			return
+		}
+		resp.Deactivated = append(resp.Deactivated, id)
+	}
+
+	requestid.Logger(ctx).Info("admin deactivated inactive users",
+		"inactive_days", req.InactiveDays, "deactivated", resp.Deactivated, "skipped", len(resp.Skipped))
+	c.JSON(http.StatusOK, resp)
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+)
+
+// GetUserByEmail handles GET /api/admin/users/by-email/:email
+// Lets provisioning tools such as Terraform read an account back and detect
+// drift by its ETag; a matching If-None-Match is answered with 304
+func (h *AdminHandler) GetUserByEmail(c *gin.Context) {
+	user, ok := h.provisionedUser(c)
+	if !ok {
+		return
+	}
+	if user == nil {
+		c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeUserNotFound, "User not found"))
+		return
+	}
+
+	resource := user.ToProvisionedUser()
+	etag := resourceETag(resource)
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.JSON(http.StatusOK, resource)
+}
+
+// UpsertUserByEmail handles PUT /api/admin/users/by-email/:email
+// Creates the account or brings an existing one to the requested name, role
+// and active state, so repeating the same request changes nothing. The
+// password of an existing account is never touched. The response says
+// whether the account was created (201), updated or left unchanged (200)
+func (h *AdminHandler) UpsertUserByEmail(c *gin.Context) {
+	var req models.ProvisionUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindError(c, err))
+		return
+	}
+	active := req.Active == nil || *req.Active
+
+	user, ok := h.provisionedUser(c)
+	if !ok {
+		return
+	}
+
+	status, result := http.StatusOK, models.ProvisionUnchanged
+	if user == nil {
+		if user, ok = h.createProvisionedUser(c, &req, active); !ok {
+			return
+		}
+		status, result = http.StatusCreated, models.ProvisionCreated
+	} else {
+		if user.IsService {
+			c.JSON(http.StatusConflict, errorResponse(c, models.ErrorCodeUserExists, "A service account already uses this email"))
+			return
+		}
+		currentUserID, _ := c.Get("user_id")
+		if !active && user.ID == currentUserID.(int64) {
+			c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeCannotDeleteSelf, "Cannot deactivate your own account"))
+			return
+		}
+
+		if user.Name != req.Name || user.IsAdmin != req.IsAdmin || user.IsActive != active {
+			user.Name = req.Name
+			user.IsAdmin = req.IsAdmin
+			user.IsActive = active
+			if err := h.userRepo.Update(c.Request.Context(), user); err != nil {
+				c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to update user"))
+				return
+			}
+			result = models.ProvisionUpdated
+		}
+	}
+
+	if result != models.ProvisionUnchanged {
+		adminID, _ := c.Get("user_id")
+		requestid.Logger(c.Request.Context()).Info("user provisioned",
+			"result", result, "user_id", user.ID, "admin_id", adminID)
+	}
+
+	resource := user.ToProvisionedUser()
+	c.Header("ETag", resourceETag(resource))
+	c.JSON(status, models.ProvisionUserResponse{Result: result, User: resource})
+}
+
+// provisionedUser looks up the account named by the :email parameter,
+// returning nil when there is none. It writes the error response itself
+// and reports whether to continue
+func (h *AdminHandler) provisionedUser(c *gin.Context) (*models.User, bool) {
+	email := models.NormalizeEmail(c.Param("email"))
+	if !validEmail(email) {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Invalid email address"))
+		return nil, false
+	}
+
+	user, err := h.userRepo.FindByEmail(c.Request.Context(), email)
+	if errors.Is(err, models.ErrInvalidCredentials) {
+		return nil, true
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to look up user"))
+		return nil, false
+	}
+	return user, true
+}
+
+// createProvisionedUser creates the account for an upsert. Without a
+// password it can only sign in through SSO, like accounts created by Okta
+func (h *AdminHandler) createProvisionedUser(c *gin.Context, req *models.ProvisionUserRequest, active bool) (*models.User, bool) {
+	user := &models.User{
+		Email:   models.NormalizeEmail(c.Param("email")),
+		Name:    req.Name,
+		IsAdmin: req.IsAdmin,
+	}
+	if req.Password != "" {
+		hashedPassword, err := models.HashPassword(req.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to hash password"))
+			return nil, false
+		}
+		user.Password = hashedPassword
+	}
+
+	if err := h.userRepo.Create(c.Request.Context(), user); err != nil {
+		if err == models.ErrUserExists {
+			// Created concurrently; the caller retries and gets an update
+			c.JSON(http.StatusConflict, errorResponse(c, models.ErrorCodeUserExists, "User with this email already exists"))
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to create user"))
+		return nil, false
+	}
+
+	if !active {
+		user.IsActive = false
+		if err := h.userRepo.Update(c.Request.Context(), user); err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to deactivate user"))
+			return nil, false
+		}
+	}
+	return user, true
+}
+
+// resourceETag returns a strong ETag for the JSON representation of resource,
+// which changes whenever any reported field does
+func resourceETag(resource interface{}) string {
+	body, _ := json.Marshal(resource)
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
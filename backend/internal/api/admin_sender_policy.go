@@ -0,0 +1,201 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+)
+
+// ListBannedDomains handles GET /api/admin/banned-domains
+// Lists the banned email domains ordered by domain
+func (h *AdminHandler) ListBannedDomains(c *gin.Context) {
+	if !h.senderPolicyAvailable(c) {
+		return
+	}
+
+	domains, err := h.policies.ListBannedDomains(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to list banned domains"))
+		return
+	}
+
+	c.JSON(http.StatusOK, domains)
+}
+
+// PutBannedDomain handles PUT /api/admin/banned-domains/:domain
+// Bans a domain and its subdomains, answering 201, or replaces the reason
+// of its ban. External recipients and new accounts with an email there are
+// refused; existing accounts and messages are left alone
+func (h *AdminHandler) PutBannedDomain(c *gin.Context) {
+	if !h.senderPolicyAvailable(c) {
+		return
+	}
+	name, ok := bannedDomain(c)
+	if !ok {
+		return
+	}
+	var req models.BannedDomainRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, bindError(c, err))
+			return
+		}
+	}
+
+	domain := &models.BannedDomain{Domain: name, Reason: req.Reason}
+	created, err := h.policies.PutBannedDomain(c.Request.Context(), domain)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to ban domain"))
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	requestid.Logger(c.Request.Context()).Info("domain banned",
+		"admin_id", adminID, "domain", name, "created", created)
+
+	if created {
+		c.JSON(http.StatusCreated, domain)
+		return
+	}
+	c.JSON(http.StatusOK, domain)
+}
+
+// DeleteBannedDomain handles DELETE /api/admin/banned-domains/:domain
+func (h *AdminHandler) DeleteBannedDomain(c *gin.Context) {
+	if !h.senderPolicyAvailable(c) {
+		return
+	}
+	name, ok := bannedDomain(c)
+	if !ok {
+		return
+	}
+
+	if err := h.policies.DeleteBannedDomain(c.Request.Context(), name); err != nil {
+		if errors.Is(err, models.ErrBannedDomainNotFound) {
+			c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeBannedDomainNotFound, "Domain is not banned"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to lift domain ban"))
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	requestid.Logger(c.Request.Context()).Info("domain ban lifted", "admin_id", adminID, "domain", name)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Domain ban lifted"})
+}
+
+// ListDLPPatterns handles GET /api/admin/dlp-patterns
+// Lists the DLP patterns ordered by name
+func (h *AdminHandler) ListDLPPatterns(c *gin.Context) {
+	if !h.senderPolicyAvailable(c) {
+		return
+	}
+
+	patterns, err := h.policies.ListDLPPatterns(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to list DLP patterns"))
+		return
+	}
+
+	c.JSON(http.StatusOK, patterns)
+}
+
+// PutDLPPattern handles PUT /api/admin/dlp-patterns/:name
+// Creates a DLP pattern, answering 201, or replaces it
+func (h *AdminHandler) PutDLPPattern(c *gin.Context) {
+	if !h.senderPolicyAvailable(c) {
+		return
+	}
+	name, ok := dlpPatternName(c)
+	if !ok {
+		return
+	}
+	var req models.DLPPatternRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindError(c, err))
+		return
+	}
+	if details := req.Validate(); details != nil {
+		resp := errorResponse(c, models.ErrorCodeValidationFailed, "Invalid request: "+summarize(details))
+		resp.Details = details
+		c.JSON(http.StatusBadRequest, resp)
+		return
+	}
+
+	pattern := &models.DLPPattern{Name: name, Pattern: req.Pattern, Description: req.Description}
+	created, err := h.policies.PutDLPPattern(c.Request.Context(), pattern)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to save DLP pattern"))
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	requestid.Logger(c.Request.Context()).Info("dlp pattern saved",
+		"admin_id", adminID, "name", name, "created", created)
+
+	if created {
+		c.JSON(http.StatusCreated, pattern)
+		return
+	}
+	c.JSON(http.StatusOK, pattern)
+}
+
+// DeleteDLPPattern handles DELETE /api/admin/dlp-patterns/:name
+func (h *AdminHandler) DeleteDLPPattern(c *gin.Context) {
+	if !h.senderPolicyAvailable(c) {
+		return
+	}
+	name, ok := dlpPatternName(c)
+	if !ok {
+		return
+	}
+
+	if err := h.policies.DeleteDLPPattern(c.Request.Context(), name); err != nil {
+		if errors.Is(err, models.ErrDLPPatternNotFound) {
+			c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeDLPPatternNotFound, "DLP pattern not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to delete DLP pattern"))
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	requestid.Logger(c.Request.Context()).Info("dlp pattern deleted", "admin_id", adminID, "name", name)
+
+	c.JSON(http.StatusOK, gin.H{"message": "DLP pattern deleted"})
+}
+
+// senderPolicyAvailable answers 503 when no policy store is configured
+func (h *AdminHandler) senderPolicyAvailable(c *gin.Context) bool {
+	if h.policies == nil {
+		c.JSON(http.StatusServiceUnavailable, errorResponse(c, models.ErrorCodeUnavailable, "Sender policies are not available"))
+		return false
+	}
+	return true
+}
+
+// bannedDomain reads the :domain parameter in its stored form, answering
+// 400 when it is not a domain
+func bannedDomain(c *gin.Context) (string, bool) {
+	domain, err := models.NormalizeDomain(c.Param("domain"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Invalid domain: "+err.Error()))
+		return "", false
+	}
+	return domain, true
+}
+
+// dlpPatternName reads the :name parameter, answering 400 when it does not
+// follow the rules of a category name
+func dlpPatternName(c *gin.Context) (string, bool) {
+	name := c.Param("name")
+	if !models.ValidCategory(name) {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Invalid DLP pattern name"))
+		return "", false
+	}
+	return name, true
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+)
+
+// CreateServiceAccount handles POST /api/admin/service-accounts
+// Service accounts represent integrations: they have no password, cannot
+// log in interactively and authenticate with API keys. Messages they create
+// are shown as sent via the integration named after the account
+func (h *AdminHandler) CreateServiceAccount(c *gin.Context) {
+	var req struct {
+		Email string `json:"email" binding:"required,email"`
+		Name  string `json:"name" binding:"required,min=2,max=100"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindError(c, err))
+		return
+	}
+
+	// An empty password hash never matches, so the account cannot log in
+	user := &models.User{
+		Email:     req.Email,
+		Name:      req.Name,
+		IsService: true,
+	}
+
+	if err := h.userRepo.Create(c.Request.Context(), user); err != nil {
+		if err == models.ErrUserExists {
+			c.JSON(http.StatusConflict, errorResponse(c, models.ErrorCodeUserExists, "User with this email already exists"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to create service account"))
+		return
+	}
+
+	c.JSON(http.StatusCreated, user.ToUserInfo())
+}
+
+// CreateAPIKey handles POST /api/admin/service-accounts/:id/keys
+// The key is returned once; only its hash is stored
+func (h *AdminHandler) CreateAPIKey(c *gin.Context) {
+	user, ok := h.serviceAccount(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Name string `json:"name" binding:"required,min=1,max=100"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindError(c, err))
+		return
+	}
+
+	key, hash, err := models.GenerateAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to generate API key"))
+		return
+	}
+
+	apiKey := &models.APIKey{
+		UserID: user.ID,
+		Name:   req.Name,
+		Prefix: models.APIKeyDisplayPrefix(key),
+		Hash:   hash,
+	}
+	if err := h.userRepo.CreateAPIKey(c.Request.Context(), apiKey); err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to create API key"))
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	requestid.Logger(c.Request.Context()).Info("api key created",
+		"admin_id", adminID, "service_account_id", user.ID, "key_id", apiKey.ID)
+
+	c.JSON(http.StatusCreated, models.CreateAPIKeyResponse{Key: key, APIKey: apiKey})
+}
+
+// ListAPIKeys handles GET /api/admin/service-accounts/:id/keys
+func (h *AdminHandler) ListAPIKeys(c *gin.Context) {
+	user, ok := h.serviceAccount(c)
+	if !ok {
+		return
+	}
+
+	keys, err := h.userRepo.ListAPIKeys(c.Request.Context(), user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to list API keys"))
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+// RevokeAPIKey handles DELETE /api/admin/service-accounts/:id/keys/:keyId
+// Requests with the key are refused from then on
+func (h *AdminHandler) RevokeAPIKey(c *gin.Context) {
+	user, ok := h.serviceAccount(c)
+	if !ok {
+		return
+	}
+
+	keyID, err := strconv.ParseInt(c.Param("keyId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Invalid API key ID"))
+		return
+	}
+
+	if err := h.userRepo.RevokeAPIKey(c.Request.Context(), user.ID, keyID); err != nil {
+		if err == models.ErrAPIKeyNotFound {
+			c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeAPIKeyNotFound, "API key not found or already revoked"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to revoke API key"))
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	requestid.Logger(c.Request.Context()).Info("api key revoked",
+		"admin_id", adminID, "service_account_id", user.ID, "key_id", keyID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
+
+// serviceAccount loads the active service account named by the :id
+// parameter, writing an error response if there is none
+func (h *AdminHandler) serviceAccount(c *gin.Context) (*models.User, bool) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Invalid user ID"))
+		return nil, false
+	}
+
+	user, err := h.userRepo.FindByID(c.Request.Context(), userID)
+	if err != nil || !user.IsActive || !user.IsService {
+		c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeUserNotFound, "Service account not found"))
+		return nil, false
+	}
+	return user, true
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+)
+
+// ListTTLPolicies handles GET /api/admin/ttl-policies
+// Lists the TTL policy rules in evaluation order
+func (h *AdminHandler) ListTTLPolicies(c *gin.Context) {
+	if !h.ttlPoliciesAvailable(c) {
+		return
+	}
+
+	rules, err := h.policies.ListTTLPolicies(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to list TTL policies"))
+		return
+	}
+
+	c.JSON(http.StatusOK, rules)
+}
+
+// CreateTTLPolicy handles POST /api/admin/ttl-policies
+// Adds a rule; without a position it is evaluated after the others
+func (h *AdminHandler) CreateTTLPolicy(c *gin.Context) {
+	if !h.ttlPoliciesAvailable(c) {
+		return
+	}
+	req, ok := bindTTLPolicy(c)
+	if !ok {
+		return
+	}
+
+	rule := &models.TTLPolicyRule{RecipientDomainGlob: req.RecipientDomainGlob, DefaultTTL: req.DefaultTTL, MaxTTL: req.MaxTTL}
+	if err := h.policies.CreateTTLPolicy(c.Request.Context(), rule, req.Position); err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to create TTL policy"))
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	requestid.Logger(c.Request.Context()).Info("ttl policy created",
+		"admin_id", adminID, "rule_id", rule.ID, "domain_glob", rule.RecipientDomainGlob,
+		"default_ttl", rule.DefaultTTL, "max_ttl", rule.MaxTTL)
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateTTLPolicy handles PUT /api/admin/ttl-policies/:id
+// Replaces a rule, keeping its position unless the request gives one
+func (h *AdminHandler) UpdateTTLPolicy(c *gin.Context) {
+	if !h.ttlPoliciesAvailable(c) {
+		return
+	}
+	id, ok := ttlPolicyID(c)
+	if !ok {
+		return
+	}
+	req, ok := bindTTLPolicy(c)
+	if !ok {
+		return
+	}
+
+	rule := &models.TTLPolicyRule{ID: id, RecipientDomainGlob: req.RecipientDomainGlob, DefaultTTL: req.DefaultTTL, MaxTTL: req.MaxTTL}
+	if err := h.policies.UpdateTTLPolicy(c.Request.Context(), rule, req.Position); err != nil {
+		if errors.Is(err, models.ErrTTLPolicyNotFound) {
+			c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeTTLPolicyNotFound, "TTL policy not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to update TTL policy"))
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	requestid.Logger(c.Request.Context()).Info("ttl policy updated",
+		"admin_id", adminID, "rule_id", rule.ID, "domain_glob", rule.RecipientDomainGlob,
+		"default_ttl", rule.DefaultTTL, "max_ttl", rule.MaxTTL)
+
+	c.JSON(http.StatusOK, rule)
+}
+
+// DeleteTTLPolicy handles DELETE /api/admin/ttl-policies/:id
+func (h *AdminHandler) DeleteTTLPolicy(c *gin.Context) {
+	if !h.ttlPoliciesAvailable(c) {
+		return
+	}
+	id, ok := ttlPolicyID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.policies.DeleteTTLPolicy(c.Request.Context(), id); err != nil {
+		if errors.Is(err, models.ErrTTLPolicyNotFound) {
+			c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeTTLPolicyNotFound, "TTL policy not found"))
+			return
+		}
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to delete TTL policy"))
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	requestid.Logger(c.Request.Context()).Info("ttl policy deleted", "admin_id", adminID, "rule_id", id)
+
+	c.JSON(http.StatusOK, gin.H{"message": "TTL policy deleted"})
+}
+
+// ttlPoliciesAvailable answers 503 when no TTL policy store is configured
+func (h *AdminHandler) ttlPoliciesAvailable(c *gin.Context) bool {
+	if h.policies == nil {
+		c.JSON(http.StatusServiceUnavailable, errorResponse(c, models.ErrorCodeUnavailable, "TTL policies are not available"))
+		return false
+	}
+	return true
+}
+
+// ttlPolicyID reads the :id parameter, answering 400 when it is not a number
+func ttlPolicyID(c *gin.Context) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Invalid TTL policy ID"))
+		return 0, false
+	}
+	return id, true
+}
+
+// bindTTLPolicy reads and validates a rule, answering 400 when it is invalid
+func bindTTLPolicy(c *gin.Context) (*models.TTLPolicyRuleRequest, bool) {
+	var req models.TTLPolicyRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindError(c, err))
+		return nil, false
+	}
+	if details := req.Validate(); details != nil {
+		resp := errorResponse(c, models.ErrorCodeValidationFailed, "Invalid request: "+summarize(details))
+		resp.Details = details
+		c.JSON(http.StatusBadRequest, resp)
+		return nil, false
+	}
+	return &req, true
+}
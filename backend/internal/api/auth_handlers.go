@@ -1,25 +1,38 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/milkiss/vanish/backend/internal/auth"
+	"github.com/milkiss/vanish/backend/internal/auth/ldap"
+	"github.com/milkiss/vanish/backend/internal/messages"
 	"github.com/milkiss/vanish/backend/internal/models"
-	"github.com/milkiss/vanish/backend/internal/repository"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/requestid"
 )
 
 // AuthHandler handles authentication endpoints
 type AuthHandler struct {
-	userRepo   *repository.UserRepository
+	userRepo   persistence.UserStore
 	jwtManager *auth.JWTManager
+	cookies    *SessionCookies     // nil unless cookie auth is enabled
+	directory  *ldap.Authenticator // nil unless LDAP sign-in is enabled
+	messages   *messages.Service   // refuses registrations from banned domains; nil refuses none
 }
 
 // NewAuthHandler creates a new auth handler
-func NewAuthHandler(userRepo *repository.UserRepository, jwtManager *auth.JWTManager) *AuthHandler {
+func NewAuthHandler(userRepo persistence.UserStore, jwtManager *auth.JWTManager, cookies *SessionCookies, directory *ldap.Authenticator, messages *messages.Service) *AuthHandler {
 	return &AuthHandler{
 		userRepo:   userRepo,
 		jwtManager: jwtManager,
+		cookies:    cookies,
+		directory:  directory,
+		messages:   messages,
 	}
 }
 
@@ -28,18 +41,20 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	var req models.RegisterRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Invalid request: " + err.Error(),
-		})
+		c.JSON(http.StatusBadRequest, bindError(c, err))
 		return
 	}
+	if h.messages != nil {
+		if err := h.messages.CheckRegistration(c.Request.Context(), req.Email); err != nil {
+			messageFailure(c, err, nil)
+			return
+		}
+	}
 
 	// Hash password
 	hashedPassword, err := models.HashPassword(req.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to process registration",
-		})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to process registration"))
 		return
 	}
 
@@ -53,24 +68,22 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	err = h.userRepo.Create(c.Request.Context(), user)
 	if err != nil {
 		if err == models.ErrUserExists {
-			c.JSON(http.StatusConflict, models.ErrorResponse{
-				Error: "User with this email already exists",
-			})
+			c.JSON(http.StatusConflict, errorResponse(c, models.ErrorCodeUserExists, "User with this email already exists"))
 			return
 		}
 
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to create user",
-		})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to create user"))
 		return
 	}
 
 	// Generate token
 	token, err := h.jwtManager.Generate(user.ID, user.Email)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to generate token",
-		})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to generate token"))
+		return
+	}
+	if err := h.cookies.Set(c, token); err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to start session"))
 		return
 	}
 
@@ -85,61 +98,178 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	var req models.LoginRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Invalid request: " + err.Error(),
-		})
+		c.JSON(http.StatusBadRequest, bindError(c, err))
 		return
 	}
 
 	// Find user by email
+	logger := requestid.Logger(c.Request.Context()).With("client_ip", ClientIP(c))
 	user, err := h.userRepo.FindByEmail(c.Request.Context(), req.Email)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-			Error: "Invalid email or password",
-		})
+	if err != nil && !errors.Is(err, models.ErrInvalidCredentials) {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to look up user"))
+		return
+	}
+
+	// Unknown emails and LDAP-backed accounts are checked against the
+	// directory; local accounts never are
+	checked := false
+	if h.directory != nil && (user == nil || user.IsDirectoryAccount()) {
+		if user, err = h.directoryLogin(c, logger, &req, user); err != nil {
+			return
+		}
+		checked = true
+	} else if user == nil {
+		// Spend as long as a password check would
+		models.RejectPassword(req.Password)
+		logger.Warn("login failed", "reason", "unknown email")
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeInvalidCredentials, "Invalid email or password"))
 		return
 	}
 
-	// Check password
-	if !user.CheckPassword(req.Password) {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-			Error: "Invalid email or password",
-		})
+	// Service accounts have no password and use API keys instead; answer
+	// as for a wrong password so the account type is not disclosed
+	if user.IsService {
+		models.RejectPassword(req.Password)
+		logger.Warn("login failed", "reason", "service account", "user_id", user.ID)
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeInvalidCredentials, "Invalid email or password"))
+		return
+	}
+
+	// Check password. LDAP-backed accounts store none, so they cannot sign
+	// in while the directory is disabled
+	if !checked && !user.CheckPassword(req.Password) {
+		logger.Warn("login failed", "reason", "wrong password", "user_id", user.ID)
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeInvalidCredentials, "Invalid email or password"))
+		return
+	}
+
+	// Deactivated accounts keep their password until reactivated
+	if !user.IsActive {
+		logger.Warn("login failed", "reason", "account inactive", "user_id", user.ID)
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeAccountInactive, "Account is no longer active"))
 		return
 	}
 
 	// Generate token
 	token, err := h.jwtManager.Generate(user.ID, user.Email)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to generate token",
-		})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to generate token"))
 		return
 	}
+	if err := h.cookies.Set(c, token); err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to start session"))
+		return
+	}
+
+	recordLogin(c.Request.Context(), h.userRepo, user.ID)
 
+	logger.Info("login succeeded", "user_id", user.ID)
 	c.JSON(http.StatusOK, models.AuthResponse{
 		Token: token,
 		User:  user.ToUserInfo(),
 	})
 }
 
+// recordLoginTimeout bounds the write of a user's last sign-in
+const recordLoginTimeout = 5 * time.Second
+
+// recordLogin sets the user's last sign-in in the background, so the write
+// adds nothing to the latency of signing in. Failures are only logged
+func recordLogin(ctx context.Context, users persistence.UserStore, userID int64) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), recordLoginTimeout)
+	go func() {
+		defer cancel()
+		if err := users.RecordLogin(ctx, userID); err != nil {
+			requestid.Logger(ctx).Warn("failed to record login", "user_id", userID, "error", err)
+		}
+	}()
+}
+
+// directoryLogin checks the password against the LDAP directory and brings
+// the local record of the account, nil for a first sign-in, up to date with
+// it. It writes the error response itself when sign-in fails
+func (h *AuthHandler) directoryLogin(c *gin.Context, logger *slog.Logger, req *models.LoginRequest, user *models.User) (*models.User, error) {
+	identity, err := h.directory.Authenticate(req.Email, req.Password)
+	if errors.Is(err, ldap.ErrInvalidCredentials) {
+		logger.Warn("login failed", "reason", "rejected by directory")
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeInvalidCredentials, "Invalid email or password"))
+		return nil, err
+	}
+	if err != nil {
+		logger.Error("login failed", "reason", "directory unavailable", "error", err)
+		c.JSON(http.StatusBadGateway, errorResponse(c, models.ErrorCodeUpstreamFailed, "Directory is unavailable"))
+		return nil, err
+	}
+
+	ctx := c.Request.Context()
+	if user == nil {
+		// The directory may know the user by another spelling of their email
+		user, err = h.userRepo.FindByEmail(ctx, identity.Email)
+		if err != nil && !errors.Is(err, models.ErrInvalidCredentials) {
+			c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to look up user"))
+			return nil, err
+		}
+		if user != nil && !user.IsDirectoryAccount() {
+			// A local account must not be taken over by whoever holds the
+			// directory entry with its email
+			logger.Warn("login failed", "reason", "local account has directory email", "user_id", user.ID)
+			c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeInvalidCredentials, "Invalid email or password"))
+			return nil, models.ErrUserExists
+		}
+	}
+
+	if user == nil {
+		user = &models.User{
+			Email:      identity.Email,
+			Name:       identity.Name,
+			IsAdmin:    identity.IsAdmin,
+			AuthSource: models.AuthSourceLDAP,
+		}
+		if err := h.userRepo.Create(ctx, user); err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to create user"))
+			return nil, err
+		}
+		logger.Info("directory user created", "user_id", user.ID, "is_admin", user.IsAdmin)
+		return user, nil
+	}
+
+	// Without an admin group, admins are granted in Vanish as for local accounts
+	isAdmin := user.IsAdmin
+	if h.directory.AdminsManaged() {
+		isAdmin = identity.IsAdmin
+	}
+	if user.Name != identity.Name || user.IsAdmin != isAdmin {
+		user.Name = identity.Name
+		user.IsAdmin = isAdmin
+		if err := h.userRepo.Update(ctx, user); err != nil {
+			c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to update user"))
+			return nil, err
+		}
+		logger.Info("directory user updated", "user_id", user.ID, "is_admin", user.IsAdmin)
+	}
+	return user, nil
+}
+
+// Logout handles user logout
+// Clears the session cookies; bearer tokens simply expire
+func (h *AuthHandler) Logout(c *gin.Context) {
+	h.cookies.Clear(c)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
 // Me returns the current authenticated user
 func (h *AuthHandler) Me(c *gin.Context) {
 	// Get user ID from context (set by auth middleware)
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-			Error: "Unauthorized",
-		})
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
 		return
 	}
 
 	// Find user
 	user, err := h.userRepo.FindByID(c.Request.Context(), userID.(int64))
 	if err != nil {
-		c.JSON(http.StatusNotFound, models.ErrorResponse{
-			Error: "User not found",
-		})
+		c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeUserNotFound, "User not found"))
 		return
 	}
 
@@ -150,9 +280,7 @@ func (h *AuthHandler) Me(c *gin.Context) {
 func (h *AuthHandler) ListUsers(c *gin.Context) {
 	users, err := h.userRepo.ListAll(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to list users",
-		})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to list users"))
 		return
 	}
 
@@ -7,40 +7,53 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/milkiss/vanish/backend/internal/auth"
 	"github.com/milkiss/vanish/backend/internal/models"
-	"github.com/milkiss/vanish/backend/internal/repository"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/requestid"
 )
 
 // AuthMiddleware creates a middleware that validates JWT tokens
 func AuthMiddleware(jwtManager *auth.JWTManager) gin.HandlerFunc {
+	return SessionAuthMiddleware(jwtManager, nil, nil)
+}
+
+// SessionAuthMiddleware validates a JWT from the Authorization header or,
+// when cookies is non-nil and no header is sent, from the session cookie.
+// Cookie-authenticated requests are marked so CSRFMiddleware can check them.
+// When apiKeys is non-nil, a bearer token starting with models.APIKeyPrefix
+// is checked as the API key of a service account instead of as a JWT
+func SessionAuthMiddleware(jwtManager *auth.JWTManager, cookies *SessionCookies, apiKeys persistence.UserStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		var tokenString string
+
 		// Get Authorization header
 		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-				Error: "Authorization header required",
-			})
-			c.Abort()
-			return
-		}
+		if authHeader != "" {
+			// Check Bearer scheme
+			parts := strings.SplitN(authHeader, " ", 2)
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Invalid authorization header format"))
+				c.Abort()
+				return
+			}
+			tokenString = parts[1]
 
-		// Check Bearer scheme
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-				Error: "Invalid authorization header format",
-			})
+			if apiKeys != nil && models.IsAPIKey(tokenString) {
+				authenticateAPIKey(c, apiKeys, tokenString)
+				return
+			}
+		} else if token, ok := cookies.token(c); ok {
+			tokenString = token
+			c.Set("auth_method", authMethodCookie)
+		} else {
+			c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Authorization header required"))
 			c.Abort()
 			return
 		}
 
-		tokenString := parts[1]
-
 		// Verify token
 		claims, err := jwtManager.Verify(tokenString)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-				Error: "Invalid or expired token",
-			})
+			c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Invalid or expired token"))
 			c.Abort()
 			return
 		}
@@ -53,14 +66,58 @@ func AuthMiddleware(jwtManager *auth.JWTManager) gin.HandlerFunc {
 	}
 }
 
-// AdminMiddleware ensures the user is an admin
-func AdminMiddleware(userRepo *repository.UserRepository) gin.HandlerFunc {
+// authenticateAPIKey sets the service account owning key as the caller
+// Messages it creates are attributed to the integration named after it
+func authenticateAPIKey(c *gin.Context, apiKeys persistence.UserStore, key string) {
+	user, err := apiKeys.AuthenticateAPIKey(c.Request.Context(), models.HashAPIKey(key))
+	if err != nil || !user.IsService || !user.IsActive {
+		if err != nil && err != models.ErrAPIKeyNotFound {
+			requestid.Logger(c.Request.Context()).Error("api key lookup failed", "error", err)
+		}
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Invalid or revoked API key"))
+		c.Abort()
+		return
+	}
+
+	c.Set("user_id", user.ID)
+	c.Set("user_email", user.Email)
+	c.Set("auth_method", authMethodAPIKey)
+	c.Set("integration_name", user.Name)
+
+	c.Next()
+}
+
+// ActiveUserMiddleware rejects tokens of deleted accounts
+// JWTs cannot be recalled, so every authenticated request re-checks that the
+// account still exists and is active
+func ActiveUserMiddleware(userRepo persistence.UserStore) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		userID, exists := c.Get("user_id")
 		if !exists {
-			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-				Error: "Unauthorized",
-			})
+			c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
+			c.Abort()
+			return
+		}
+
+		user, err := userRepo.FindByID(c.Request.Context(), userID.(int64))
+		if err != nil || !user.IsActive {
+			c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeAccountInactive, "Account is no longer active"))
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// AdminMiddleware ensures the user is an admin. Other users get 403, or,
+// with stealth set, the 404 of an unknown route, so probing cannot tell
+// which admin endpoints exist. Unauthenticated requests get 401 either way
+func AdminMiddleware(userRepo persistence.UserStore, stealth bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := c.Get("user_id")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
 			c.Abort()
 			return
 		}
@@ -68,21 +125,83 @@ func AdminMiddleware(userRepo *repository.UserRepository) gin.HandlerFunc {
 		// Get user from database to check admin status
 		user, err := userRepo.FindByID(c.Request.Context(), userID.(int64))
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-				Error: "User not found",
-			})
+			c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUserNotFound, "User not found"))
 			c.Abort()
 			return
 		}
 
 		if !user.IsAdmin {
-			c.JSON(http.StatusForbidden, models.ErrorResponse{
-				Error: "Admin access required",
-			})
+			requestid.Logger(c.Request.Context()).Warn("admin access denied",
+				"user_id", user.ID,
+				"route", c.FullPath(),
+				"client_ip", ClientIP(c),
+			)
+			if stealth {
+				routeNotFound(c)
+				return
+			}
+			c.JSON(http.StatusForbidden, errorResponse(c, models.ErrorCodeForbidden, "Admin access required"))
 			c.Abort()
 			return
 		}
 
 		c.Next()
+
+		// Audit every admin action with the acting user and real client address
+		requestid.Logger(c.Request.Context()).Info("admin action",
+			"user_id", user.ID,
+			"method", c.Request.Method,
+			"route", c.FullPath(),
+			"status", c.Writer.Status(),
+			"client_ip", ClientIP(c),
+		)
 	}
 }
+
+// MessageAccessHeader carries the signed access token of an external
+// recipient's link to GET /api/messages/:id, in place of a session
+const MessageAccessHeader = "X-Vanish-Access-Token"
+
+// messageAccessKey marks a request admitted by MessageAccessMiddleware
+const messageAccessKey = "message_access"
+
+// MessageAccessMiddleware admits an external recipient to GET
+// /api/messages/:id by the access token of their link, which is bound to
+// the message in the path. Requests without MessageAccessHeader pass on to
+// session authentication; a token that fails verification is rejected.
+// signer nil disables external access, leaving the header ignored
+func MessageAccessMiddleware(signer *auth.JWTManager) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader(MessageAccessHeader)
+		if signer == nil || token == "" {
+			c.Next()
+			return
+		}
+
+		if err := signer.VerifyMessageAccess(c.Param("id"), token); err != nil {
+			c.JSON(http.StatusForbidden, errorResponse(c, models.ErrorCodeInvalidAccessToken, "Invalid or expired access link"))
+			c.Abort()
+			return
+		}
+		c.Set(messageAccessKey, true)
+		c.Next()
+	}
+}
+
+// UnlessMessageAccess runs next only for requests MessageAccessMiddleware
+// did not admit, so an external recipient skips session authentication
+func UnlessMessageAccess(next gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool(messageAccessKey) {
+			c.Next()
+			return
+		}
+		next(c)
+	}
+}
+
+// routeNotFound answers exactly as gin does for a request matching no route
+func routeNotFound(c *gin.Context) {
+	c.Data(http.StatusNotFound, "text/plain", []byte("404 page not found"))
+	c.Abort()
+}
@@ -0,0 +1,170 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/milkiss/vanish/backend/internal/models"
+)
+
+// Validation errors name fields as clients send them (recipient_id rather
+// than RecipientID), the region rule checks data residency regions and the
+// category rule message categories.
+// Gin's validator is global, so this is set up once for every handler in
+// the package
+func init() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+	// An empty region is the default cluster
+	_ = v.RegisterValidation("region", func(fl validator.FieldLevel) bool {
+		region := fl.Field().String()
+		return region == "" || models.ValidRegion(region)
+	})
+	// An empty category files the message under none
+	_ = v.RegisterValidation("category", func(fl validator.FieldLevel) bool {
+		category := fl.Field().String()
+		return category == "" || models.ValidCategory(category)
+	})
+}
+
+// bindError builds the 400 body for a request that failed to bind
+// Validation failures list each field in Details with a readable message;
+// malformed JSON gets a generic message so parser internals are not echoed
+func bindError(c *gin.Context, err error) models.ErrorResponse {
+	details := validationDetails(err)
+	if details == nil {
+		return errorResponse(c, models.ErrorCodeInvalidRequest, "Invalid request body: expected a JSON object matching the documented schema")
+	}
+
+	resp := errorResponse(c, models.ErrorCodeValidationFailed, "Invalid request: "+summarize(details))
+	resp.Details = details
+	return resp
+}
+
+// validationDetails maps each invalid field to a message, or returns nil
+// when err is not a validation failure
+func validationDetails(err error) map[string]string {
+	var errs validator.ValidationErrors
+	if !errors.As(err, &errs) {
+		return nil
+	}
+
+	details := make(map[string]string, len(errs))
+	for _, fe := range errs {
+		field := fieldPath(fe)
+		if _, seen := details[field]; !seen {
+			details[field] = fieldMessage(fe)
+		}
+	}
+	return details
+}
+
+// fieldPath is the field's JSON path without the root struct name,
+// e.g. "email" or "messages[0]" for a nested field
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if _, rest, ok := strings.Cut(ns, "."); ok {
+		return rest
+	}
+	return fe.Field()
+}
+
+// fieldMessage describes one failed rule for an end user
+func fieldMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "required_without":
+		return fmt.Sprintf("is required unless %s is set", jsonName(fe.Param()))
+	case "excluded_with":
+		return fmt.Sprintf("must not be set together with %s", jsonName(fe.Param()))
+	case "email":
+		return "must be a valid email address"
+	case "base64":
+		return "must be base64-encoded"
+	case "base64url":
+		return "must be base64url-encoded"
+	case "region":
+		return fmt.Sprintf("must be lowercase letters and digits, starting with a letter, at most %d characters", models.MaxRegionLength)
+	case "category":
+		return fmt.Sprintf("must be lowercase letters, digits and dashes, starting with a letter, at most %d characters", models.MaxCategoryLength)
+	case "min":
+		return sizeMessage(fe, "at least")
+	case "max":
+		return sizeMessage(fe, "at most")
+	default:
+		return "is invalid"
+	}
+}
+
+// sizeMessage words min/max for strings, lists and numbers
+func sizeMessage(fe validator.FieldError, bound string) string {
+	switch fe.Kind() {
+	case reflect.String:
+		return fmt.Sprintf("must be %s %s characters", bound, fe.Param())
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return fmt.Sprintf("must contain %s %s items", bound, fe.Param())
+	default:
+		return fmt.Sprintf("must be %s %s", bound, fe.Param())
+	}
+}
+
+// jsonName converts a Go field name in a rule parameter (SealedKey) to the
+// JSON name clients use (sealed_key)
+func jsonName(field string) string {
+	var b strings.Builder
+	for i, r := range field {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// summarize joins the details into one line for clients that only show Error
+func summarize(details map[string]string) string {
+	fields := make([]string, 0, len(details))
+	for field := range details {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	parts := make([]string, len(fields))
+	for i, field := range fields {
+		parts[i] = field + " " + details[field]
+	}
+	return strings.Join(parts, "; ")
+}
+
+// ValidationSummary describes a failed binding.Validator check in one line,
+// worded as the HTTP API reports it, for the gRPC API
+func ValidationSummary(err error) string {
+	details := validationDetails(err)
+	if details == nil {
+		return "request is invalid"
+	}
+	return summarize(details)
+}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/models"
+)
+
+const (
+	// DefaultBodyLimit caps the JSON bodies of every route without a limit
+	// of its own: profiles, notifications, admin settings and SCIM users
+	DefaultBodyLimit = 64 << 10 // 64 KB
+
+	// AuthBodyLimit caps sign-in and registration bodies, which carry an
+	// email, a name and a password
+	AuthBodyLimit = 64 << 10 // 64 KB
+
+	// CSVImportBodyLimit caps the user import upload
+	CSVImportBodyLimit = 10 << 20 // 10 MB
+
+	// messageBodyOverhead leaves room in a message body for the fields
+	// besides the ciphertext: the IV, the key, the recipient and a schedule
+	messageBodyOverhead = 16 << 10 // 16 KB
+)
+
+// MessageBodyLimit is the largest body accepted when creating one message
+// whose ciphertext may be up to maxMessageBytes; 0 selects the default
+func MessageBodyLimit(maxMessageBytes int64) int64 {
+	if maxMessageBytes <= 0 {
+		maxMessageBytes = config.DefaultMaxMessageBytes
+	}
+	return maxMessageBytes + messageBodyOverhead
+}
+
+// BodyLimitMiddleware rejects request bodies larger than limit with 413
+// before the handler runs, instead of letting binding buffer them whole
+// Bodies of unknown length (chunked uploads) are read up to the limit first
+func BodyLimitMiddleware(limit int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch length := c.Request.ContentLength; {
+		case length == 0:
+			// Nothing to read
+		case length > limit:
+			requestTooLarge(c, limit)
+			return
+		case length > 0:
+			// The server already stops at Content-Length
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		default:
+			body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, limit))
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				requestTooLarge(c, limit)
+				return
+			}
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Failed to read request body"))
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		c.Next()
+	}
+}
+
+func requestTooLarge(c *gin.Context, limit int64) {
+	c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, errorResponse(c, models.ErrorCodeRequestTooLarge,
+		fmt.Sprintf("Request body must not exceed %d bytes", limit)))
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// forwardedForHeader is the only header consulted for the client address
+const forwardedForHeader = "X-Forwarded-For"
+
+// TrustedProxies are the proxies (IPs or CIDRs) whose forwarded headers are
+// believed. The nil value trusts no proxy
+type TrustedProxies struct {
+	cidrs []*net.IPNet
+}
+
+// ConfigureTrustedProxies restricts X-Forwarded-For handling to the given
+// proxies (IPs or CIDRs). An empty list trusts no proxy, so the header is
+// ignored and the TCP peer address is used. The proxies are returned for
+// the other forwarded headers, which gin does not read
+func ConfigureTrustedProxies(router *gin.Engine, proxies []string) (*TrustedProxies, error) {
+	router.ForwardedByClientIP = true
+	router.RemoteIPHeaders = []string{forwardedForHeader}
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		return nil, err
+	}
+	return parseTrustedProxies(proxies)
+}
+
+// parseTrustedProxies parses proxies the way gin does: a bare IP is a
+// single-address network
+func parseTrustedProxies(proxies []string) (*TrustedProxies, error) {
+	trusted := &TrustedProxies{}
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid proxy address %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			trusted.cidrs = append(trusted.cidrs, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, cidr, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy network %q: %w", proxy, err)
+		}
+		trusted.cidrs = append(trusted.cidrs, cidr)
+	}
+	return trusted, nil
+}
+
+// Peer reports whether the direct peer of the request is a trusted proxy,
+// the rule ClientIP applies before reading X-Forwarded-For
+func (p *TrustedProxies) Peer(c *gin.Context) bool {
+	if p == nil {
+		return false
+	}
+	ip := net.ParseIP(c.RemoteIP())
+	if ip == nil {
+		return false
+	}
+	for _, cidr := range p.cidrs {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the end user's address for rate limiting and audit logs
+// X-Forwarded-For is honoured only when the direct peer is a trusted proxy;
+// a forged header from an untrusted peer is ignored and the peer address returned
+func ClientIP(c *gin.Context) string {
+	return c.ClientIP()
+}
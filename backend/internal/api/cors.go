@@ -0,0 +1,164 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+)
+
+// originPattern is a parsed ALLOWED_ORIGINS entry
+// For wildcard patterns ("https://*.vanish.dev") host holds the suffix
+// after the wildcard label ("vanish.dev")
+type originPattern struct {
+	scheme   string
+	host     string
+	port     string
+	wildcard bool
+}
+
+// CORSMiddleware configures CORS for the allowed origins
+// Entries are exact origins ("https://vanish.example.com"), "*" for any
+// origin, or single-label wildcard subdomains ("https://*.vanish.dev").
+// "*" cannot be combined with credentials.
+func CORSMiddleware(allowedOrigins []string, allowCredentials bool) (gin.HandlerFunc, error) {
+	corsConfig := cors.Config{
+		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "HEAD", "OPTIONS"},
+		AllowHeaders:     []string{"Content-Type", "Origin", "Authorization", "Accept-Version", requestid.Header, CSRFHeader, ClientHeader, MessageAccessHeader},
+		ExposeHeaders:    []string{APIVersionHeader, "Deprecation", "Link", requestid.Header, MessageIDHeader, ReadAtHeader, MessageStatusHeader},
+		AllowCredentials: allowCredentials,
+		MaxAge:           12 * time.Hour,
+	}
+
+	patterns, allowAll, err := parseOriginPatterns(allowedOrigins)
+	if err != nil {
+		return nil, err
+	}
+
+	if allowAll {
+		if allowCredentials {
+			return nil, errors.New(`allowed origin "*" cannot be used with credentials`)
+		}
+		corsConfig.AllowAllOrigins = true
+	} else {
+		corsConfig.AllowOriginFunc = func(origin string) bool {
+			if originAllowed(patterns, origin) {
+				return true
+			}
+			slog.Debug("cors origin rejected", "origin", origin)
+			return false
+		}
+	}
+
+	return cors.New(corsConfig), nil
+}
+
+// parseOriginPatterns validates ALLOWED_ORIGINS entries
+func parseOriginPatterns(origins []string) ([]originPattern, bool, error) {
+	if len(origins) == 0 {
+		return nil, false, errors.New("at least one allowed origin is required")
+	}
+
+	var patterns []originPattern
+	allowAll := false
+	for _, origin := range origins {
+		origin = strings.TrimSpace(origin)
+		if origin == "*" {
+			allowAll = true
+			continue
+		}
+
+		pattern, err := parseOriginPattern(origin)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid allowed origin %q: %w", origin, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, allowAll, nil
+}
+
+// parseOriginPattern parses "scheme://host[:port]" where host may start
+// with a "*." wildcard label
+func parseOriginPattern(origin string) (originPattern, error) {
+	scheme, rest, ok := strings.Cut(strings.ToLower(origin), "://")
+	if !ok || (scheme != "http" && scheme != "https") {
+		return originPattern{}, errors.New("must start with http:// or https://")
+	}
+
+	pattern := originPattern{scheme: scheme}
+	if strings.HasPrefix(rest, "*.") {
+		pattern.wildcard = true
+		rest = strings.TrimPrefix(rest, "*.")
+	}
+	if strings.ContainsAny(rest, "*/?#@") {
+		return originPattern{}, errors.New(`only a leading "*." wildcard label is allowed and no path, query or userinfo`)
+	}
+
+	u, err := url.Parse(scheme + "://" + rest)
+	if err != nil || u.Hostname() == "" {
+		return originPattern{}, errors.New("missing host")
+	}
+	pattern.host = u.Hostname()
+	pattern.port = u.Port()
+
+	// A wildcard directly under a public suffix ("*.dev") would be far too broad
+	if pattern.wildcard && !strings.Contains(pattern.host, ".") {
+		return originPattern{}, errors.New("wildcard must be followed by at least two labels")
+	}
+
+	return pattern, nil
+}
+
+// originAllowed reports whether a request Origin matches any pattern
+// Wildcards match exactly one extra DNS label, so "https://*.vanish.dev"
+// accepts https://pr-123.vanish.dev but not https://evil-vanish.dev,
+// https://vanish.dev.evil.com or https://a.b.vanish.dev
+func originAllowed(patterns []originPattern, origin string) bool {
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return false
+	}
+	host := u.Hostname()
+	if host == "" {
+		return false
+	}
+
+	for _, p := range patterns {
+		if u.Scheme != p.scheme || u.Port() != p.port {
+			continue
+		}
+		if !p.wildcard {
+			if host == p.host {
+				return true
+			}
+			continue
+		}
+
+		label, ok := strings.CutSuffix(host, "."+p.host)
+		if ok && isDNSLabel(label) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isDNSLabel reports whether s is a single non-empty hostname label
+func isDNSLabel(s string) bool {
+	if s == "" || len(s) > 63 || s[0] == '-' || s[len(s)-1] == '-' {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z') && !(r >= '0' && r <= '9') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
@@ -1,94 +0,0 @@
-package api
-
-import (
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"encoding/base64"
-	"fmt"
-	"io"
-)
-
-// EncryptedMessage represents an encrypted message with its components
-type EncryptedMessage struct {
-	Ciphertext string
-	IV         string
-	Key        string
-}
-
-// encryptMessage encrypts a plaintext message using AES-256-GCM
-// This mimics the client-side encryption but happens server-side for Slack integration
-func encryptMessage(plaintext string) (*EncryptedMessage, error) {
-	// Generate a random 256-bit encryption key
-	key := make([]byte, 32) // 32 bytes = 256 bits
-	if _, err := io.ReadFull(rand.Reader, key); err != nil {
-		return nil, fmt.Errorf("failed to generate encryption key: %w", err)
-	}
-
-	// Create AES cipher
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher: %w", err)
-	}
-
-	// Create GCM mode
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
-	}
-
-	// Generate a random nonce/IV
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, fmt.Errorf("failed to generate nonce: %w", err)
-	}
-
-	// Encrypt the plaintext
-	ciphertext := gcm.Seal(nil, nonce, []byte(plaintext), nil)
-
-	// Encode to base64 for storage
-	return &EncryptedMessage{
-		Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
-		IV:         base64.StdEncoding.EncodeToString(nonce),
-		Key:        base64.URLEncoding.EncodeToString(key),
-	}, nil
-}
-
-// decryptMessage decrypts a message (used for verification/testing)
-func decryptMessage(ciphertext, iv, keyStr string) (string, error) {
-	// Decode base64
-	key, err := base64.URLEncoding.DecodeString(keyStr)
-	if err != nil {
-		return "", fmt.Errorf("failed to decode key: %w", err)
-	}
-
-	nonce, err := base64.StdEncoding.DecodeString(iv)
-	if err != nil {
-		return "", fmt.Errorf("failed to decode IV: %w", err)
-	}
-
-	ciphertextBytes, err := base64.StdEncoding.DecodeString(ciphertext)
-	if err != nil {
-		return "", fmt.Errorf("failed to decode ciphertext: %w", err)
-	}
-
-	// Create AES cipher
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
-	}
-
-	// Create GCM mode
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", fmt.Errorf("failed to create GCM: %w", err)
-	}
-
-	// Decrypt
-	plaintext, err := gcm.Open(nil, nonce, ciphertextBytes, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to decrypt: %w", err)
-	}
-
-	return string(plaintext), nil
-}
@@ -1,190 +1,680 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/milkiss/vanish/backend/internal/accesslog"
+	"github.com/milkiss/vanish/backend/internal/auth"
+	"github.com/milkiss/vanish/backend/internal/messages"
 	"github.com/milkiss/vanish/backend/internal/models"
-	"github.com/milkiss/vanish/backend/internal/repository"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/requestid"
 	"github.com/milkiss/vanish/backend/internal/storage"
+	"github.com/milkiss/vanish/backend/internal/urlbuilder"
 )
 
+// Headers of GET /api/messages/:id, so clients can tell what happened to a
+// message without another call or parsing error text
+const (
+	// MessageIDHeader and ReadAtHeader are set when a message is burned
+	MessageIDHeader = "X-Vanish-Message-Id"
+	ReadAtHeader    = "X-Vanish-Read-At"
+	// MessageStatusHeader is set on 404 and 410 for a message of the caller
+	// that is gone: read, expired or revoked
+	MessageStatusHeader = "X-Vanish-Status"
+)
+
+// ClientHeader tells which kind of client creates a message (see
+// models.Client); without it the message counts as an API call
+const ClientHeader = "X-Vanish-Client"
+
+// DryRunHeader is the header form of ?dry_run=true on message creation
+const DryRunHeader = "X-Vanish-Dry-Run"
+
 // MessageHandler handles all message-related HTTP requests
 type MessageHandler struct {
-	storage    storage.Storage
-	metadataRepo *repository.MetadataRepository
+	messages     *messages.Service
+	storage      storage.Storage
+	metadataRepo persistence.MetadataStore
+	access       *accesslog.Recorder   // audit log of read attempts; nil records nothing
+	abuse        *AbuseDetector        // alerts on repeated denied attempts; nil disables
+	users        persistence.UserStore // checks that recipients exist; nil skips the check
+	external     *externalRecipients   // nil rejects messages to external recipients
+}
+
+// externalRecipients signs and mails the links of messages to recipients
+// without an account
+type externalRecipients struct {
+	signer       *auth.JWTManager
+	integrations *Integrations       // mails the link when the email integration is on
+	links        *urlbuilder.Builder // nil mails nothing
 }
 
 // NewMessageHandler creates a new message handler
-func NewMessageHandler(storage storage.Storage, metadataRepo *repository.MetadataRepository) *MessageHandler {
+// maxPendingPerRecipient caps a recipient's unread messages (0 for no cap);
+// access may be nil to skip the access log, abuse nil to skip detection,
+// users nil to leave unknown recipients to the database and policies nil to
+// apply no TTL policy
+func NewMessageHandler(storage storage.Storage, metadataRepo persistence.MetadataStore, maxPendingPerRecipient int, access *accesslog.Recorder, abuse *AbuseDetector, users persistence.UserStore, policies persistence.TTLPolicyStore) *MessageHandler {
 	return &MessageHandler{
-		storage:    storage,
+		messages:     messages.NewService(storage, metadataRepo, maxPendingPerRecipient, users, policies),
+		storage:      storage,
 		metadataRepo: metadataRepo,
+		access:       access,
+		abuse:        abuse,
+		users:        users,
 	}
 }
 
+// EnableExternalRecipients lets senders address messages to an email
+// address without an account. The recipient reads with a link carrying an
+// access token signed by signer; when the sender stores the link key, the
+// link is built by links and mailed over the email integration. links may
+// be nil to leave sharing the link to the sender
+func (h *MessageHandler) EnableExternalRecipients(signer *auth.JWTManager, integrations *Integrations, links *urlbuilder.Builder) {
+	h.external = &externalRecipients{signer: signer, integrations: integrations, links: links}
+}
+
 // CreateMessage handles POST /api/messages
 // Stores an encrypted message and returns an ID
 // Requires authentication - sender must be logged in
+// With ?dry_run=true it only validates, answering 200 with a synthetic ID
 func (h *MessageHandler) CreateMessage(c *gin.Context) {
 	// Get sender ID from auth middleware
 	senderID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-			Error: "Unauthorized",
-		})
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
 		return
 	}
 
 	var req models.CreateMessageRequest
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Invalid request: " + err.Error(),
-		})
+		c.JSON(http.StatusBadRequest, bindError(c, err))
+		return
+	}
+
+	opts, ok := createOptions(c)
+	if !ok {
 		return
 	}
 
-	// Validate TTL
-	ttlSeconds, err := models.ValidateTTL(req.TTL)
+	resp, err := h.createMessage(c.Request.Context(), senderID.(int64), opts, &req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: err.Error(),
-		})
+		messageFailure(c, err, nil)
 		return
 	}
 
-	// Create message object (encrypted content for Redis)
-	msg := &models.Message{
-		Ciphertext: req.Ciphertext,
-		IV:         req.IV,
-		CreatedAt:  time.Now().UTC(),
+	if resp.DryRun {
+		c.JSON(http.StatusOK, resp)
+		return
 	}
+	c.JSON(http.StatusCreated, resp)
+}
 
-	// Store encrypted message in Redis with TTL
-	id, err := h.storage.Store(c.Request.Context(), msg, time.Duration(ttlSeconds)*time.Second)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to store message",
-		})
+// BulkCreateMessages handles POST /api/messages/bulk
+// Creates up to models.MaxBulkMessages messages in order and reports each
+// outcome in a 207 Multi-Status envelope. A malformed envelope or oversized
+// batch is rejected whole with 400, and a batch that would overflow a
+// recipient's unread messages whole with 429; otherwise items succeed or
+// fail independently and stored items are kept even when later ones fail
+func (h *MessageHandler) BulkCreateMessages(c *gin.Context) {
+	senderID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
+		return
+	}
+
+	var req models.BulkCreateMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindError(c, err))
 		return
 	}
+	if len(req.Messages) == 0 || len(req.Messages) > models.MaxBulkMessages {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeBatchSize, fmt.Sprintf("A batch must contain between 1 and %d messages", models.MaxBulkMessages)))
+		return
+	}
+	opts, ok := createOptions(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	batch := make(map[int64]int)
+	for _, item := range req.Messages {
+		if item.ExternalRecipientEmail == "" && item.RecipientID > 0 {
+			batch[item.RecipientID]++
+		}
+	}
+	if err := h.messages.CheckBatchQuota(ctx, batch); err != nil {
+		messageFailure(c, err, nil)
+		return
+	}
+
+	resp := models.BulkCreateMessageResponse{Results: make([]models.BulkMessageResult, len(req.Messages)), DryRun: opts.DryRun}
+	for i := range req.Messages {
+		result := models.BulkMessageResult{Index: i}
+
+		if ctx.Err() != nil {
+			// Client went away; report the rest as not attempted
+			result.Status = http.StatusServiceUnavailable
+			result.Error = "Not processed: request cancelled"
+			result.Code = models.ErrorCodeUnavailable
+		} else if err := binding.Validator.ValidateStruct(&req.Messages[i]); err != nil {
+			result.Status = http.StatusBadRequest
+			result.Code = models.ErrorCodeValidationFailed
+			result.Details = validationDetails(err)
+			result.Error = "Invalid request: " + summarize(result.Details)
+		} else if created, err := h.createMessage(ctx, senderID.(int64), opts, &req.Messages[i]); err != nil {
+			failure := serviceError(err)
+			result.Status = messageStatus(failure.Code)
+			result.Error = failure.Message
+			result.Code = failure.Code
+		} else {
+			result.Status = http.StatusCreated
+			if created.DryRun {
+				result.Status = http.StatusOK
+			}
+			result.ID = created.ID
+			result.ExpiresAt = &created.ExpiresAt
+			result.TTLLimitedByPolicy = created.TTLLimitedByPolicy
+		}
+
+		if result.Status == http.StatusCreated || result.Status == http.StatusOK {
+			resp.Succeeded++
+		} else {
+			resp.Failed++
+		}
+		resp.Results[i] = result
+	}
+
+	c.JSON(http.StatusMultiStatus, resp)
+}
+
+// createMessage stores one message through the message service; shared by
+// the single and bulk create endpoints. opts carries the request-wide
+// options from createOptions; the message fills in its key and schedule
+func (h *MessageHandler) createMessage(ctx context.Context, senderID int64, opts messages.CreateOptions, req *models.CreateMessageRequest) (*models.CreateMessageResponse, error) {
+	if req.ExternalRecipientEmail != "" {
+		if h.external == nil {
+			return nil, &messages.Error{Code: models.ErrorCodeForbidden, Message: "Sending to recipients without an account is not enabled"}
+		}
+		opts.ExternalRecipientEmail = models.NormalizeEmail(req.ExternalRecipientEmail)
+		opts.Notify = h.external.notify(h.users, senderID, req.EncryptionKey)
+	} else if h.users != nil {
+		_, err := h.users.FindByID(ctx, req.RecipientID)
+		if errors.Is(err, models.ErrUserNotFound) {
+			return nil, &messages.Error{Code: models.ErrorCodeUserNotFound, Message: "Recipient not found"}
+		}
+		if err != nil {
+			requestid.Logger(ctx).Error("failed to look up recipient", "error", err)
+			return nil, &messages.Error{Code: models.ErrorCodeInternal, Message: "Failed to look up recipient"}
+		}
+	}
+
+	opts.EncryptionKey = req.EncryptionKey // Store key for recipient link generation
+	opts.SealedKey = req.SealedKey         // Or the key sealed to the recipient, which only they can open
+	opts.AvailableAt = req.AvailableAt
+	opts.Category = req.Category
+	metadata, err := h.messages.CreateEncrypted(ctx, senderID, req.RecipientID,
+		messages.Payload{Ciphertext: req.Ciphertext, IV: req.IV, ContentEncoding: req.ContentEncoding}, req.TTL, opts)
+	if errors.Is(err, messages.ErrNotifyFailed) {
+		// The message is kept: the sender can pass on the link built from
+		// the access token in the response
+		requestid.Logger(ctx).Warn("failed to email external recipient", "error", err)
+	} else if err != nil {
+		return nil, err
+	}
 
-	// Calculate expiration time
-	expiresAt := msg.CreatedAt.Add(time.Duration(ttlSeconds) * time.Second)
+	accessToken := ""
+	if metadata.ExternalRecipientEmail != "" && !opts.DryRun {
+		accessToken = h.external.signer.SignMessageAccess(metadata.MessageID, metadata.ExpiresAt)
+	}
+
+	return &models.CreateMessageResponse{
+		ID:          metadata.MessageID,
+		ExpiresAt:   metadata.ExpiresAt,
+		AvailableAt: metadata.AvailableAt,
+		DryRun:      opts.DryRun,
+
+		TTLLimitedByPolicy: metadata.TTLLimitedByPolicy,
+		Category:           metadata.Category,
+		CategoryPolicy:     metadata.CategoryPolicy,
+		AccessToken:        accessToken,
+	}, nil
+}
+
+// notify returns the CreateOptions.Notify mailing an external recipient
+// their link, or nil when it cannot be built or sent: without the link key
+// from the sender, links or the email integration
+func (e *externalRecipients) notify(users persistence.UserStore, senderID int64, key string) func(context.Context, *models.MessageMetadata) error {
+	emailClient := e.integrations.Email()
+	if key == "" || e.links == nil || emailClient == nil {
+		return nil
+	}
+	return func(ctx context.Context, metadata *models.MessageMetadata) error {
+		senderName := ""
+		if users != nil {
+			if sender, err := users.FindByID(ctx, senderID); err == nil {
+				senderName = sender.Name
+			}
+		}
+		from := models.SenderLabel(senderName, metadata.SenderType, metadata.IntegrationName)
+		link := e.links.ExternalMessageURL(metadata.MessageID, e.signer.SignMessageAccess(metadata.MessageID, metadata.ExpiresAt), key)
+		return emailClient.SendSecretNotification(ctx, metadata.ExternalRecipientEmail, metadata.ExternalRecipientEmail, from, link, metadata.CategoryPolicy.Style())
+	}
+}
 
-	// Store metadata in PostgreSQL (sender, recipient, but NOT content)
-	metadata := &models.MessageMetadata{
-		MessageID:     id,
-		SenderID:      senderID.(int64),
-		RecipientID:   req.RecipientID,
-		EncryptionKey: req.EncryptionKey, // Store key for recipient link generation
-		Status:        models.StatusPending,
-		CreatedAt:     msg.CreatedAt,
-		ExpiresAt:     expiresAt,
+// createOptions reads the request-wide options of a create: the integration
+// of a service account authenticated by API key, ClientHeader and the dry
+// run flag. It answers 400 and returns false when a header is invalid
+func createOptions(c *gin.Context) (messages.CreateOptions, bool) {
+	via, ok := createdVia(c)
+	if !ok {
+		return messages.CreateOptions{}, false
 	}
+	dryRun, ok := dryRunRequested(c)
+	if !ok {
+		return messages.CreateOptions{}, false
+	}
+	return messages.CreateOptions{Integration: c.GetString("integration_name"), CreatedVia: via, DryRun: dryRun}, true
+}
 
-	err = h.metadataRepo.Create(c.Request.Context(), metadata)
+// dryRunRequested reads ?dry_run, or DryRunHeader without it, answering 400
+// for a value that is not a boolean
+func dryRunRequested(c *gin.Context) (bool, bool) {
+	raw, ok := c.GetQuery("dry_run")
+	name := "dry_run"
+	if !ok {
+		raw, name = c.GetHeader(DryRunHeader), DryRunHeader
+	}
+	if raw == "" {
+		return false, true
+	}
+	dryRun, err := strconv.ParseBool(raw)
 	if err != nil {
-		// If metadata creation fails, we should clean up the Redis message
-		// But for now, we'll log and continue (message will expire anyway)
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to store message metadata",
-		})
-		return
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, name+" must be true or false"))
+		return false, false
 	}
+	return dryRun, true
+}
 
-	// Return response
-	c.JSON(http.StatusCreated, models.CreateMessageResponse{
-		ID:        id,
-		ExpiresAt: expiresAt,
-	})
+// createdVia reads ClientHeader, answering 400 for a value that is not a
+// models.Client. The header is the client's own claim: it tells honest
+// clients apart for audits, but does not prove anything
+func createdVia(c *gin.Context) (models.Client, bool) {
+	header := strings.ToLower(strings.TrimSpace(c.GetHeader(ClientHeader)))
+	if header == "" {
+		return models.ClientAPI, true
+	}
+	via := models.Client(header)
+	if !via.Valid() {
+		names := make([]string, len(models.Clients))
+		for i, known := range models.Clients {
+			names[i] = string(known)
+		}
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest,
+			fmt.Sprintf("%s must be one of %s", ClientHeader, strings.Join(names, ", "))))
+		return "", false
+	}
+	return via, true
 }
 
 // GetMessage handles GET /api/messages/:id
 // Retrieves and burns (deletes) a message atomically
-// CRITICAL: Verifies that the current user is the intended recipient
+// CRITICAL: Verifies that the current user is the intended recipient, or
+// that MessageAccessMiddleware admitted an external recipient by their link
 func (h *MessageHandler) GetMessage(c *gin.Context) {
+	if c.GetBool(messageAccessKey) {
+		h.readExternal(c)
+		return
+	}
+
 	// Get current user ID from auth middleware
 	currentUserID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-			Error: "Unauthorized",
-		})
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
 		return
 	}
 
 	id := c.Param("id")
 
-	if id == "" {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Message ID is required",
-		})
+	var metadata *models.MessageMetadata
+	defer func() { h.recordAccess(c, id, models.AccessActionRead, metadata) }()
+
+	// With a claim token, fetch the payload claimed earlier; otherwise burn
+	// directly, which a pending claim blocks
+	var msg *models.Message
+	var err error
+	if token := c.Query("claim"); token != "" {
+		msg, metadata, err = h.messages.ReadClaimed(c.Request.Context(), currentUserID.(int64), id, token)
+	} else {
+		msg, metadata, err = h.messages.Read(c.Request.Context(), currentUserID.(int64), id)
+	}
+	if err != nil {
+		setGoneHeaders(c, err, metadata)
+		messageFailure(c, err, metadata)
 		return
 	}
 
-	// Check metadata and verify recipient
-	metadata, err := h.metadataRepo.FindByMessageID(c.Request.Context(), id)
+	writeBurned(c, id, msg)
+}
+
+// readExternal burns a message for the external recipient holding its
+// signed link. There is no user to record in the access log; the metadata
+// names the recipient's address
+func (h *MessageHandler) readExternal(c *gin.Context) {
+	id := c.Param("id")
+	msg, metadata, err := h.messages.ReadExternal(c.Request.Context(), id)
 	if err != nil {
-		if err == models.ErrMessageNotFound {
-			c.JSON(http.StatusNotFound, models.ErrorResponse{
-				Error: "Message not found or already burned",
-			})
-			return
-		}
+		setGoneHeaders(c, err, metadata)
+		messageFailure(c, err, metadata)
+		return
+	}
 
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to retrieve message metadata",
-		})
+	writeBurned(c, id, msg)
+}
+
+// ReadMessage handles POST /api/messages/:id/read
+// Burns the message like GET /api/messages/:id, but only with a one-time
+// intent token from the link preview (GET /m-preview/:id), so a share link
+// prefetched by a mail or chat client cannot burn it
+func (h *MessageHandler) ReadMessage(c *gin.Context) {
+	currentUserID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
 		return
 	}
 
-	// CRITICAL SECURITY CHECK: Verify the current user is the intended recipient
-	if metadata.RecipientID != currentUserID.(int64) {
-		c.JSON(http.StatusForbidden, models.ErrorResponse{
-			Error: "You are not the intended recipient of this message",
-		})
+	id := c.Param("id")
+
+	var req models.ReadMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Invalid request: intent_token is required"))
 		return
 	}
 
-	// Check if already read
-	if metadata.Status == models.StatusRead {
-		c.JSON(http.StatusGone, models.ErrorResponse{
-			Error: "Message has already been read and burned",
-		})
+	var metadata *models.MessageMetadata
+	defer func() { h.recordAccess(c, id, models.AccessActionRead, metadata) }()
+
+	msg, metadata, err := h.messages.ReadWithIntent(c.Request.Context(), currentUserID.(int64), id, req.IntentToken)
+	if err != nil {
+		setGoneHeaders(c, err, metadata)
+		messageFailure(c, err, metadata)
 		return
 	}
 
-	// Atomically get and delete the message from Redis (burn-on-read)
-	msg, err := h.storage.GetAndDelete(c.Request.Context(), id)
+	writeBurned(c, id, msg)
+}
+
+// writeBurned answers a read with the encrypted message it burned
+func writeBurned(c *gin.Context, id string, msg *models.Message) {
+	c.Header(MessageIDHeader, id)
+	c.Header(ReadAtHeader, time.Now().UTC().Format(time.RFC3339))
+	c.JSON(http.StatusOK, models.MessageResponse{
+		Ciphertext:      msg.Ciphertext,
+		IV:              msg.IV,
+		ContentEncoding: msg.ContentEncoding,
+	})
+}
+
+// LinkPreview handles GET /m-preview/:id
+// The public interstitial of a share link: it reports whether the message
+// can still be opened and issues a one-time intent token for POST
+// /api/messages/:id/read. Anyone may call it, so a message that cannot be
+// opened now, for whatever reason, is answered like an unknown one. It
+// never burns the message, so link prefetchers can call it any number of
+// times. Answers are never cached by proxies
+func (h *MessageHandler) LinkPreview(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("X-Robots-Tag", "noindex")
+
+	id := c.Param("id")
+	token, expiresAt, err := h.messages.IssueReadIntent(c.Request.Context(), id)
 	if err != nil {
-		if err == models.ErrMessageNotFound {
-			// Message exists in metadata but not in Redis (expired or race condition)
-			c.JSON(http.StatusNotFound, models.ErrorResponse{
-				Error: "Message not found or already burned",
-			})
-			return
+		messageFailure(c, err, nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.LinkPreviewResponse{
+		ID:              id,
+		IntentToken:     token,
+		IntentExpiresAt: expiresAt,
+	})
+}
+
+// setGoneHeaders reports why a message the recipient asked for can no
+// longer be read, and when it was read if it was. Callers that are not the
+// recipient learn nothing: they get 403 before the message's state is told
+func setGoneHeaders(c *gin.Context, err error, metadata *models.MessageMetadata) {
+	code := serviceError(err).Code
+	if metadata == nil || (code != models.ErrorCodeMessageNotFound && messageStatus(code) != http.StatusGone) {
+		return
+	}
+
+	switch {
+	case metadata.Status == models.StatusRead:
+		c.Header(MessageStatusHeader, string(models.StatusRead))
+		if metadata.ReadAt != nil {
+			c.Header(ReadAtHeader, metadata.ReadAt.UTC().Format(time.RFC3339))
 		}
+	case metadata.Status == models.StatusExpired && time.Now().Before(metadata.ExpiresAt):
+		c.Header(MessageStatusHeader, string(models.StatusRevoked))
+	case time.Now().Before(metadata.ExpiresAt):
+		// Still open yet without payload: a concurrent read burned it
+		c.Header(MessageStatusHeader, string(models.StatusRead))
+	default:
+		// Expired, possibly before the janitor marked it so
+		c.Header(MessageStatusHeader, string(models.StatusExpired))
+	}
+}
 
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to retrieve message",
-		})
+// ClaimMessage handles POST /api/messages/:id/claim
+// Moves the message into a short claim window bound to the recipient and
+// returns a token for GET /api/messages/:id?claim=<token>. If the claim
+// response is lost, claiming again returns the same token, so a dropped
+// connection no longer destroys the secret
+func (h *MessageHandler) ClaimMessage(c *gin.Context) {
+	currentUserID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
 		return
 	}
 
-	// Mark as read in metadata
-	err = h.metadataRepo.MarkAsRead(c.Request.Context(), id)
+	id := c.Param("id")
+
+	var metadata *models.MessageMetadata
+	defer func() { h.recordAccess(c, id, models.AccessActionClaim, metadata) }()
+
+	token, expiresAt, metadata, err := h.messages.Claim(c.Request.Context(), currentUserID.(int64), id)
 	if err != nil {
-		// Message was burned from Redis, but we couldn't update metadata
-		// Log this but still return the message to user
-		// The metadata will be marked as expired by cleanup job
+		messageFailure(c, err, metadata)
+		return
 	}
 
-	// Return the encrypted message
-	c.JSON(http.StatusOK, models.MessageResponse{
-		Ciphertext: msg.Ciphertext,
-		IV:         msg.IV,
+	c.JSON(http.StatusOK, models.ClaimMessageResponse{
+		ClaimToken: token,
+		ExpiresAt:  expiresAt,
+	})
+}
+
+// PreviewMessage handles GET /api/messages/:id/preview
+// Describes a pending message to its recipient without burning it, so the
+// UI and CLI can ask for confirmation before the one-time read
+func (h *MessageHandler) PreviewMessage(c *gin.Context) {
+	currentUserID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
+		return
+	}
+
+	id := c.Param("id")
+
+	var metadata *models.MessageMetadata
+	defer func() { h.recordAccess(c, id, models.AccessActionPreview, metadata) }()
+
+	// Only the recipient may learn who sent a message and when it expires
+	preview, metadata, err := h.messages.Preview(c.Request.Context(), currentUserID.(int64), id)
+	if err != nil {
+		messageFailure(c, err, metadata)
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+// GetMessageStatus handles GET /api/messages/:id/status
+// Reports the status of a message to its sender or recipient without
+// burning it, like the gRPC GetMessageStatus
+func (h *MessageHandler) GetMessageStatus(c *gin.Context) {
+	currentUserID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
+		return
+	}
+
+	id := c.Param("id")
+
+	var metadata *models.MessageMetadata
+	defer func() { h.recordAccess(c, id, models.AccessActionStatus, metadata) }()
+
+	metadata, err := h.messages.Status(c.Request.Context(), currentUserID.(int64), id)
+	if err != nil {
+		messageFailure(c, err, nil)
+		return
+	}
+
+	// As in X-Vanish-Status, a message expired before its time was revoked
+	status := metadata.Status
+	if status == models.StatusExpired && time.Now().Before(metadata.ExpiresAt) {
+		status = models.StatusRevoked
+	}
+
+	c.JSON(http.StatusOK, models.MessageStatusResponse{
+		ID:          metadata.MessageID,
+		Status:      status,
+		SenderID:    metadata.SenderID,
+		RecipientID: metadata.RecipientID,
+		CreatedAt:   metadata.CreatedAt,
+		ExpiresAt:   metadata.ExpiresAt,
+		ReadAt:      metadata.ReadAt,
+		AvailableAt: metadata.AvailableAt,
+
+		ExternalRecipientEmail: metadata.ExternalRecipientEmail,
+	})
+}
+
+// RevokeMessage handles DELETE /api/messages/:id
+// Lets the sender burn a message before it is read
+func (h *MessageHandler) RevokeMessage(c *gin.Context) {
+	currentUserID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
+		return
+	}
+
+	id := c.Param("id")
+	if err := h.messages.Revoke(c.Request.Context(), currentUserID.(int64), id); err != nil {
+		messageFailure(c, err, nil)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Message revoked"})
+}
+
+// serviceError returns err as a messages.Error, treating anything else as
+// an internal failure
+func serviceError(err error) *messages.Error {
+	var failure *messages.Error
+	if errors.As(err, &failure) {
+		return failure
+	}
+	return &messages.Error{Code: models.ErrorCodeInternal, Message: "Internal server error"}
+}
+
+// messageStatus maps a message service error code to its HTTP status
+func messageStatus(code string) int {
+	switch code {
+	case models.ErrorCodeInvalidMessageID, models.ErrorCodeTTLOutOfRange, models.ErrorCodeInvalidSchedule:
+		return http.StatusBadRequest
+	case models.ErrorCodeNotRecipient, models.ErrorCodeInvalidClaimToken, models.ErrorCodeInvalidReadIntent, models.ErrorCodeForbidden,
+		models.ErrorCodeDomainBanned:
+		return http.StatusForbidden
+	case models.ErrorCodeMessageNotFound, models.ErrorCodeClaimNotFound, models.ErrorCodeUserNotFound:
+		return http.StatusNotFound
+	case models.ErrorCodeMessageClaimed:
+		return http.StatusConflict
+	case models.ErrorCodeMessageAlreadyRead, models.ErrorCodeMessageExpired, models.ErrorCodeMessageRevoked:
+		return http.StatusGone
+	case models.ErrorCodeNotYetAvailable:
+		return http.StatusTooEarly
+	case models.ErrorCodeRecipientInboxFull:
+		return http.StatusTooManyRequests
+	case models.ErrorCodeUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// messageFailure answers a message service error. A message that is not
+// released yet gets 425 with its release time, and one that is gone 410
+// with when it was read or expired, read from metadata
+func messageFailure(c *gin.Context, err error, metadata *models.MessageMetadata) {
+	failure := serviceError(err)
+	if failure.Code == models.ErrorCodeNotYetAvailable && metadata != nil && metadata.AvailableAt != nil {
+		writeTooEarly(c, metadata)
+		return
+	}
+	if messageStatus(failure.Code) == http.StatusGone && metadata != nil {
+		writeGone(c, failure, metadata)
+		return
+	}
+	c.JSON(messageStatus(failure.Code), errorResponse(c, failure.Code, failure.Message))
+}
+
+// writeGone answers 410 for a message its recipient can no longer read.
+// Only the service tells read, expired and revoked apart, after checking
+// that the caller is the recipient, so nobody else learns the timestamps
+func writeGone(c *gin.Context, failure *messages.Error, metadata *models.MessageMetadata) {
+	resp := models.MessageGoneResponse{ErrorResponse: errorResponse(c, failure.Code, failure.Message)}
+	switch failure.Code {
+	case models.ErrorCodeMessageAlreadyRead:
+		resp.ReadAt = metadata.ReadAt
+	case models.ErrorCodeMessageExpired:
+		expiresAt := metadata.ExpiresAt
+		resp.ExpiresAt = &expiresAt
+	}
+	c.JSON(http.StatusGone, resp)
+}
+
+// tooEarly answers 425 Too Early, with the release time and Retry-After,
+// when a scheduled message is not released yet
+func tooEarly(c *gin.Context, metadata *models.MessageMetadata) bool {
+	if !metadata.Scheduled(time.Now()) {
+		return false
+	}
+	writeTooEarly(c, metadata)
+	return true
+}
+
+// writeTooEarly answers 425 Too Early for a message released at
+// metadata.AvailableAt
+func writeTooEarly(c *gin.Context, metadata *models.MessageMetadata) {
+	wait := time.Until(*metadata.AvailableAt)
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	c.JSON(http.StatusTooEarly, models.NotYetAvailableResponse{
+		ErrorResponse: errorResponse(c, models.ErrorCodeNotYetAvailable, "Message is scheduled and not available yet"),
+		AvailableAt:   *metadata.AvailableAt,
 	})
 }
 
@@ -193,10 +683,11 @@ func (h *MessageHandler) GetMessage(c *gin.Context) {
 func (h *MessageHandler) CheckMessage(c *gin.Context) {
 	id := c.Param("id")
 
-	if id == "" {
+	if !storage.ValidID(id) {
 		c.Status(http.StatusBadRequest)
 		return
 	}
+	defer h.recordAccess(c, id, models.AccessActionStatus, nil)
 
 	exists, err := h.storage.Exists(c.Request.Context(), id)
 	if err != nil {
@@ -211,6 +702,19 @@ func (h *MessageHandler) CheckMessage(c *gin.Context) {
 	}
 }
 
+// GetSenderPolicy handles GET /api/policy
+// Lists the banned recipient domains and the DLP patterns clients match
+// secrets against before encrypting them. Matching is left to the client:
+// the server never sees the plaintext
+func (h *MessageHandler) GetSenderPolicy(c *gin.Context) {
+	policy, err := h.messages.SenderPolicy(c.Request.Context())
+	if err != nil {
+		messageFailure(c, err, nil)
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
 // Health handles GET /health
 // Returns the health status of the service
 func (h *MessageHandler) Health(c *gin.Context) {
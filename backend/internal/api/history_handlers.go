@@ -1,50 +1,206 @@
 package api
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/milkiss/vanish/backend/internal/models"
-	"github.com/milkiss/vanish/backend/internal/repository"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+	"github.com/milkiss/vanish/backend/internal/storage"
+	"github.com/milkiss/vanish/backend/internal/urlbuilder"
 )
 
+const (
+	// historyLimit is the default page size of GetMyHistory
+	historyLimit = 50
+	// inboxLimit is the default page size of GetInbox
+	inboxLimit = 200
+	// maxPageLimit caps ?limit= on both listings
+	maxPageLimit = 200
+	// maxHistorySearch caps the length of ?q= on GetMyHistory
+	maxHistorySearch = 100
+)
+
+// readPage parses the ?limit=, ?offset= and ?cursor= parameters of a
+// listing. A ?cursor= parameter, even an empty one for the first page,
+// asks for the envelope with next_cursor; without it the listing is the
+// bare array it has always been. The error is written for the caller
+func readPage(c *gin.Context, defaultLimit int) (page models.Page, paged bool, err error) {
+	page.Limit = defaultLimit
+	if raw := c.Query("limit"); raw != "" {
+		page.Limit, err = strconv.Atoi(raw)
+		if err != nil || page.Limit < 1 || page.Limit > maxPageLimit {
+			return page, false, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+		}
+	}
+	if raw := c.Query("offset"); raw != "" {
+		page.Offset, err = strconv.Atoi(raw)
+		if err != nil || page.Offset < 0 {
+			return page, false, errors.New("offset must be a non-negative integer")
+		}
+	}
+
+	cursor, paged := c.GetQuery("cursor")
+	if cursor != "" {
+		if page.Offset > 0 {
+			return page, false, errors.New("offset cannot be combined with cursor")
+		}
+		page.After, err = models.DecodeCursor(cursor)
+		if err != nil {
+			return page, false, errors.New("Invalid cursor")
+		}
+	}
+	return page, paged, nil
+}
+
 // HistoryHandler handles message history endpoints
 type HistoryHandler struct {
-	metadataRepo *repository.MetadataRepository
+	metadataRepo persistence.MetadataStore
+	storage      storage.Storage
+	links        *urlbuilder.Builder // nil leaves inbox messages without URLs
 }
 
 // NewHistoryHandler creates a new history handler
-func NewHistoryHandler(metadataRepo *repository.MetadataRepository) *HistoryHandler {
+func NewHistoryHandler(metadataRepo persistence.MetadataStore, storage storage.Storage, links *urlbuilder.Builder) *HistoryHandler {
 	return &HistoryHandler{
 		metadataRepo: metadataRepo,
+		storage:      storage,
+		links:        links,
 	}
 }
 
 // GetMyHistory returns the current user's message history (sent and received)
+// ?q= narrows it to messages whose counterpart's name or email, or whose
+// category, contains the text
 func (h *HistoryHandler) GetMyHistory(c *gin.Context) {
 	// Get user ID from auth middleware
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-			Error: "Unauthorized",
-		})
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
+		return
+	}
+
+	page, paged, err := readPage(c, historyLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, err.Error()))
+		return
+	}
+
+	search := strings.TrimSpace(c.Query("q"))
+	if utf8.RuneCountInString(search) > maxHistorySearch {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest,
+			fmt.Sprintf("q must be at most %d characters", maxHistorySearch)))
+		return
+	}
+
+	history, err := h.metadataRepo.GetUserHistory(c.Request.Context(), userID.(int64), search, page)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to retrieve history"))
+		return
+	}
+
+	if !paged {
+		c.JSON(http.StatusOK, history)
+		return
+	}
+	resp := models.HistoryPage{Messages: history}
+	if n := len(history); n == page.Limit {
+		resp.NextCursor = models.Cursor{Time: history[n-1].CreatedAt, ID: history[n-1].ID}.Encode()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetInbox handles GET /api/inbox
+// Lists the messages waiting for the caller, soonest to expire first, with
+// a ready-to-open link for each message whose key the server keeps
+func (h *HistoryHandler) GetInbox(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
+		return
+	}
+
+	page, paged, err := readPage(c, inboxLimit)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, err.Error()))
+		return
+	}
+
+	pending, err := h.metadataRepo.ListInbox(c.Request.Context(), userID.(int64), page)
+	if err != nil {
+		requestid.Logger(c.Request.Context()).Error("failed to list inbox", "error", err)
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to retrieve inbox"))
+		return
+	}
+
+	now := time.Now()
+	inbox := make([]models.InboxMessage, 0, len(pending))
+	for _, m := range pending {
+		item := models.InboxMessage{
+			MessageID:        m.MessageID,
+			SenderName:       m.SenderName,
+			SenderLabel:      models.SenderLabel(m.SenderName, m.SenderType, m.IntegrationName),
+			SenderType:       m.SenderType,
+			IntegrationName:  m.IntegrationName,
+			CreatedVia:       m.CreatedVia,
+			CreatedAt:        m.CreatedAt,
+			ExpiresAt:        m.ExpiresAt,
+			ExpiresInSeconds: int64(m.ExpiresAt.Sub(now).Seconds()),
+			SealedKey:        m.SealedKey,
+		}
+		if m.EncryptionKey != "" && h.links != nil {
+			item.URL = h.links.MessageURL(m.MessageID, m.EncryptionKey)
+		}
+		inbox = append(inbox, item)
+	}
+
+	if !paged {
+		c.JSON(http.StatusOK, inbox)
+		return
+	}
+	resp := models.InboxPage{Messages: inbox}
+	if n := len(pending); n == page.Limit {
+		resp.NextCursor = models.Cursor{Time: pending[n-1].ExpiresAt, ID: pending[n-1].ID}.Encode()
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// ExpirePending handles POST /api/history/expire-pending
+// Lets a recipient discard unread messages in bulk, e.g. after a runaway
+// script flooded their inbox. Only messages pending for the caller are
+// expired and burned; other IDs are silently skipped
+func (h *HistoryHandler) ExpirePending(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
 		return
 	}
 
-	// Get history limit from query param (default 50)
-	limit := 50
-	if limitParam := c.Query("limit"); limitParam != "" {
-		// Parse limit (omitting error handling for brevity)
-		// In production, add proper parsing with max limit validation
+	var req models.ExpirePendingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindError(c, err))
+		return
 	}
 
-	history, err := h.metadataRepo.GetUserHistory(c.Request.Context(), userID.(int64), limit)
+	ctx := c.Request.Context()
+	expired, err := h.metadataRepo.ExpirePendingForRecipient(ctx, userID.(int64), req.MessageIDs)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to retrieve history",
-		})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to expire messages"))
 		return
 	}
 
-	c.JSON(http.StatusOK, history)
+	for _, id := range expired {
+		if _, err := h.storage.GetAndDelete(ctx, id); err != nil && err != models.ErrMessageNotFound {
+			requestid.Logger(ctx).Warn("failed to burn expired message", "error", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, models.ExpirePendingResponse{Expired: expired, Count: len(expired)})
 }
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/integrations/email"
+	"github.com/milkiss/vanish/backend/internal/integrations/okta"
+	"github.com/milkiss/vanish/backend/internal/integrations/slack"
+)
+
+// IntegrationClients is one consistent set of integration clients
+// A nil client means the integration is disabled
+type IntegrationClients struct {
+	Slack *slack.Client
+	Email *email.Client
+	Okta  *okta.Client
+}
+
+// Integrations holds the integration clients in effect. Handlers look the
+// clients up on every request, so a configuration reload can swap them
+// without a restart; requests already running keep the clients they started
+// with. A nil *Integrations has every integration disabled
+type Integrations struct {
+	clients atomic.Pointer[IntegrationClients]
+}
+
+// NewIntegrations returns a holder for clients
+func NewIntegrations(clients IntegrationClients) *Integrations {
+	i := &Integrations{}
+	i.Store(clients)
+	return i
+}
+
+// Store swaps in a new set of clients
+func (i *Integrations) Store(clients IntegrationClients) {
+	i.clients.Store(&clients)
+}
+
+// Clients returns the clients in effect
+func (i *Integrations) Clients() IntegrationClients {
+	if i == nil {
+		return IntegrationClients{}
+	}
+	return *i.clients.Load()
+}
+
+// Slack returns the Slack client, or nil when Slack is disabled
+func (i *Integrations) Slack() *slack.Client { return i.Clients().Slack }
+
+// Email returns the email client, or nil when email is disabled
+func (i *Integrations) Email() *email.Client { return i.Clients().Email }
+
+// Okta returns the Okta client, or nil when Okta is disabled
+func (i *Integrations) Okta() *okta.Client { return i.Clients().Okta }
+
+// newSlackClient builds the Slack client of cfg
+func newSlackClient(cfg config.SlackConfig, httpClient *http.Client) *slack.Client {
+	return slack.NewClient(&slack.Config{
+		BotToken:      cfg.BotToken,
+		WebhookURL:    cfg.WebhookURL,
+		SigningSecret: cfg.SigningSecret,
+		HTTPClient:    httpClient,
+		ClientID:      cfg.ClientID,
+		ClientSecret:  cfg.ClientSecret,
+		RedirectURL:   cfg.RedirectURL,
+		Scopes:        cfg.Scopes,
+		AllowedTeams:  cfg.AllowedTeams,
+	})
+}
+
+// BuildIntegrationClients builds a client for every integration enabled in
+// cfg. Okta fetches its OIDC discovery document, bounded by ctx. When only
+// Okta fails the other clients are still returned, with Okta nil
+func BuildIntegrationClients(ctx context.Context, cfg *config.Config) (IntegrationClients, error) {
+	var clients IntegrationClients
+
+	if cfg.Slack.Enabled {
+		httpClient, err := cfg.Outbound.HTTPClient(0)
+		if err != nil {
+			return IntegrationClients{}, fmt.Errorf("failed to configure outbound HTTP client: %w", err)
+		}
+		clients.Slack = newSlackClient(cfg.Slack, httpClient)
+	}
+
+	if cfg.Email.Enabled {
+		clients.Email = email.NewClient(&email.Config{
+			SMTPHost:     cfg.Email.SMTPHost,
+			SMTPPort:     cfg.Email.SMTPPort,
+			SMTPUser:     cfg.Email.SMTPUser,
+			SMTPPassword: cfg.Email.SMTPPassword,
+			FromAddress:  cfg.Email.FromAddress,
+			FromName:     cfg.Email.FromName,
+		})
+	}
+
+	if cfg.Okta.Enabled {
+		httpClient, err := cfg.Outbound.HTTPClient(cfg.Okta.Timeout)
+		if err != nil {
+			return IntegrationClients{}, fmt.Errorf("failed to configure outbound HTTP client: %w", err)
+		}
+		client, err := okta.NewClient(ctx, &okta.Config{
+			Domain:       cfg.Okta.Domain,
+			ClientID:     cfg.Okta.ClientID,
+			ClientSecret: cfg.Okta.ClientSecret,
+			RedirectURL:  cfg.Okta.RedirectURL,
+			RegionClaim:  cfg.Okta.RegionClaim,
+			Timeout:      cfg.Okta.Timeout,
+			HTTPClient:   httpClient,
+		})
+		if err != nil {
+			return clients, fmt.Errorf("failed to initialize Okta client: %w", err)
+		}
+		clients.Okta = client
+	}
+
+	return clients, nil
+}
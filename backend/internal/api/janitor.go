@@ -0,0 +1,146 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/lifecycle"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+	"github.com/milkiss/vanish/backend/internal/storage"
+)
+
+const (
+	// janitorInterval is how often the message janitor sweeps
+	janitorInterval = 5 * time.Minute
+	// janitorBatchSize is how many pending messages are checked per query
+	janitorBatchSize = 500
+	// cleanupDeleteBatchSize is how many expired messages each Redis
+	// pipeline deletes
+	cleanupDeleteBatchSize = 100
+)
+
+// MessageJanitor keeps message metadata in line with Redis: it marks
+// expired messages and corrects expiries that drifted from the Redis TTL.
+// It also prunes the access log
+type MessageJanitor struct {
+	metadataRepo persistence.MetadataStore
+	storage      storage.Storage
+	accessLog    persistence.AccessLogStore
+	retention    time.Duration
+}
+
+// NewMessageJanitor creates a janitor over the given stores
+// Access attempts older than retention are deleted; a nil accessLog or a
+// zero retention keeps them forever
+func NewMessageJanitor(metadataRepo persistence.MetadataStore, storage storage.Storage, accessLog persistence.AccessLogStore, retention time.Duration) *MessageJanitor {
+	return &MessageJanitor{metadataRepo: metadataRepo, storage: storage, accessLog: accessLog, retention: retention}
+}
+
+// Run sweeps every five minutes until ctx is cancelled; run it as a
+// lifecycle worker
+func (j *MessageJanitor) Run(ctx context.Context) {
+	lifecycle.Every(janitorInterval, j.Sweep)(ctx)
+}
+
+// Sweep marks expired messages, reconciles the expiry of every pending
+// message with its Redis TTL and prunes the access log
+func (j *MessageJanitor) Sweep(ctx context.Context) {
+	logger := requestid.Logger(ctx)
+
+	report, err := expireMessages(ctx, j.metadataRepo, j.storage)
+	if err != nil {
+		logger.Warn("failed to mark expired messages", "error", err)
+	}
+	if report.ExpiredMetadata > 0 {
+		logger.Info("marked expired messages",
+			"count", report.ExpiredMetadata, "redis_deleted", report.RedisDeleted, "errors", report.Errors)
+	}
+
+	corrected, err := j.reconcileExpiries(ctx)
+	if err != nil {
+		logger.Warn("failed to reconcile message expiries", "error", err)
+	}
+	if corrected > 0 {
+		logger.Info("reconciled message expiries", "count", corrected)
+	}
+
+	if j.accessLog != nil && j.retention > 0 {
+		purged, err := j.accessLog.PurgeAccessBefore(ctx, time.Now().Add(-j.retention))
+		if err != nil {
+			logger.Warn("failed to prune access log", "error", err)
+		}
+		if purged > 0 {
+			logger.Info("pruned access log", "count", purged)
+		}
+	}
+}
+
+// expireMessages marks expired messages as expired and deletes them from
+// Redis in batches. A batch Redis fails to delete is counted in Errors and
+// the rest carry on; the report is never nil
+func expireMessages(ctx context.Context, metadataRepo persistence.MetadataStore, store storage.Storage) (*models.CleanupReport, error) {
+	report := &models.CleanupReport{}
+	ids, err := metadataRepo.CleanupExpired(ctx)
+	if err != nil {
+		return report, err
+	}
+	report.ExpiredMetadata = int64(len(ids))
+
+	for start := 0; start < len(ids); start += cleanupDeleteBatchSize {
+		batch := ids[start:min(start+cleanupDeleteBatchSize, len(ids))]
+		deleted, err := store.Delete(ctx, batch)
+		if err != nil {
+			requestid.Logger(ctx).Warn("failed to delete expired messages from Redis", "count", len(batch), "error", err)
+			report.Errors += int64(len(batch))
+			continue
+		}
+		report.RedisDeleted += int64(deleted)
+		report.RedisMissing += int64(len(batch) - deleted)
+	}
+	return report, nil
+}
+
+// reconcileExpiries updates ExpiresAt of pending messages whose Redis TTL
+// differs by more than ttlDriftTolerance and returns how many changed
+// Messages missing from Redis are left for CleanupExpired
+func (j *MessageJanitor) reconcileExpiries(ctx context.Context) (int, error) {
+	corrected := 0
+	var afterID int64
+	for {
+		pending, err := j.metadataRepo.ListPending(ctx, afterID, janitorBatchSize)
+		if err != nil {
+			return corrected, err
+		}
+
+		for _, m := range pending {
+			ttl, err := j.storage.GetTTL(ctx, m.MessageID)
+			if errors.Is(err, models.ErrMessageNotFound) || ttl == storage.NoExpiry {
+				continue
+			}
+			if err != nil {
+				return corrected, err
+			}
+
+			live := time.Now().Add(ttl).UTC()
+			drift := live.Sub(m.ExpiresAt)
+			if drift < 0 {
+				drift = -drift
+			}
+			if drift <= ttlDriftTolerance {
+				continue
+			}
+			if err := j.metadataRepo.UpdateExpiresAt(ctx, m.MessageID, live); err != nil {
+				return corrected, err
+			}
+			corrected++
+		}
+
+		if len(pending) < janitorBatchSize {
+			return corrected, nil
+		}
+		afterID = pending[len(pending)-1].ID
+	}
+}
@@ -1,11 +1,13 @@
 package api
 
 import (
+	"fmt"
 	"io"
+	"strings"
 	"time"
 
-	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/config"
 )
 
 // NoBodyLoggingMiddleware prevents request bodies from being logged
@@ -18,34 +20,53 @@ func NoBodyLoggingMiddleware() gin.HandlerFunc {
 	}
 }
 
-// CORSMiddleware configures CORS for the allowed origins
-func CORSMiddleware(allowedOrigins []string) gin.HandlerFunc {
-	return cors.New(cors.Config{
-		AllowOrigins:     allowedOrigins,
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "HEAD", "OPTIONS"},
-		AllowHeaders:     []string{"Content-Type", "Origin", "Authorization"},
-		AllowCredentials: false,
-		MaxAge:           12 * time.Hour,
-	})
-}
-
 // SecurityHeadersMiddleware adds security headers to all responses
-func SecurityHeadersMiddleware() gin.HandlerFunc {
+// Empty CSP or permissions policy values fall back to the defaults in config.
+// X-Forwarded-Proto is believed only from proxies
+func SecurityHeadersMiddleware(cfg config.SecurityHeadersConfig, proxies *TrustedProxies) gin.HandlerFunc {
+	csp := cfg.ContentSecurityPolicy
+	if csp == "" {
+		csp = config.DefaultContentSecurityPolicy
+	}
+	if cfg.FrameAncestors != "" && !strings.Contains(csp, "frame-ancestors") {
+		csp += "; frame-ancestors " + cfg.FrameAncestors
+	}
+
+	permissionsPolicy := cfg.PermissionsPolicy
+	if permissionsPolicy == "" {
+		permissionsPolicy = config.DefaultPermissionsPolicy
+	}
+
+	maxAge := cfg.HSTSMaxAge
+	if maxAge <= 0 {
+		maxAge = config.DefaultHSTSMaxAge
+	}
+	hsts := fmt.Sprintf("max-age=%d; includeSubDomains", maxAge)
+
+	frameOptions := frameOptionsFor(cfg.FrameAncestors)
+
 	return func(c *gin.Context) {
 		// Prevent MIME type sniffing
 		c.Header("X-Content-Type-Options", "nosniff")
 
-		// Prevent clickjacking
-		c.Header("X-Frame-Options", "DENY")
+		// Prevent clickjacking (legacy header; CSP frame-ancestors supersedes it)
+		if frameOptions != "" {
+			c.Header("X-Frame-Options", frameOptions)
+		}
 
 		// Enable XSS protection
 		c.Header("X-XSS-Protection", "1; mode=block")
 
-		// HSTS header (only if using HTTPS in production)
-		c.Header("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+		// HSTS header, only when the request reached us (or our proxy) over HTTPS
+		if cfg.HSTSEnabled && isHTTPS(c, proxies) {
+			c.Header("Strict-Transport-Security", hsts)
+		}
 
 		// Content Security Policy
-		c.Header("Content-Security-Policy", "default-src 'self'")
+		c.Header("Content-Security-Policy", csp)
+
+		// Disable browser features the app never uses
+		c.Header("Permissions-Policy", permissionsPolicy)
 
 		// Referrer policy
 		c.Header("Referrer-Policy", "no-referrer")
@@ -54,8 +75,31 @@ func SecurityHeadersMiddleware() gin.HandlerFunc {
 	}
 }
 
+// frameOptionsFor maps CSP frame-ancestors to the closest X-Frame-Options
+// value; origin lists have no equivalent, so the header is omitted for them
+func frameOptionsFor(frameAncestors string) string {
+	switch strings.TrimSpace(frameAncestors) {
+	case "", "'none'":
+		return "DENY"
+	case "'self'":
+		return "SAMEORIGIN"
+	default:
+		return ""
+	}
+}
+
+// isHTTPS reports whether the request arrived over TLS, directly or via a
+// trusted proxy that set X-Forwarded-Proto; anyone else could forge it
+func isHTTPS(c *gin.Context, proxies *TrustedProxies) bool {
+	if c.Request.TLS != nil {
+		return true
+	}
+	return proxies.Peer(c) && strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")
+}
+
 // SetupGinWithNoLogging configures Gin to not log request bodies
-func SetupGinWithNoLogging() *gin.Engine {
+// Panics are recovered into 500s and handed to alerts, which may be nil
+func SetupGinWithNoLogging(alerts *PanicAlerter) *gin.Engine {
 	// Disable debug mode in production
 	gin.SetMode(gin.ReleaseMode)
 
@@ -65,8 +109,8 @@ func SetupGinWithNoLogging() *gin.Engine {
 	// Create engine with custom logger that only logs metadata
 	router := gin.New()
 
-	// Recovery middleware
-	router.Use(gin.Recovery())
+	// Recovery middleware; logs through slog, since DefaultWriter is discarded
+	router.Use(RecoveryMiddleware(alerts))
 
 	// Custom logger that excludes request bodies
 	router.Use(customLogger())
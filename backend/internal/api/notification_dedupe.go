@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/integrations/email"
+	"github.com/milkiss/vanish/backend/internal/integrations/slack"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+	"github.com/milkiss/vanish/backend/internal/storage"
+)
+
+// NotificationDeduper collapses repeats of a notification, such as a bulk
+// job sending one user many messages, into the first one. Notifications
+// are counted in Redis, so every backend instance shares the count. A
+// repeat over Slack edits the first DM to show the count, "(x5)", and the
+// latest link; a repeat by email is not sent, the message waiting in the
+// recipient's inbox instead
+type NotificationDeduper struct {
+	window  time.Duration
+	storage storage.Storage
+}
+
+// NewNotificationDeduper creates a deduper, or returns nil when
+// cfg.DedupeWindow is not positive; a nil deduper sends every notification
+func NewNotificationDeduper(cfg config.NotificationConfig, storage storage.Storage) *NotificationDeduper {
+	if cfg.DedupeWindow <= 0 {
+		return nil
+	}
+	return &NotificationDeduper{window: cfg.DedupeWindow, storage: storage}
+}
+
+// dedupeKey identifies a notification by its channel, its recipient and
+// its text without the link, which is unique to each message. The text
+// only varies with the sender label, so that stands in for it; the link
+// is never stored, as it carries the message key
+func dedupeKey(channel string, recipientID int64, from string) string {
+	sum := sha256.Sum256([]byte(channel + "\x00" + strconv.FormatInt(recipientID, 10) + "\x00" + from))
+	return hex.EncodeToString(sum[:])
+}
+
+// sendSlack sends a Slack notification worded in style, or folds it into
+// the one sent within the window, which then takes the latest wording. It
+// reports whether the notification was collapsed
+func (d *NotificationDeduper) sendSlack(ctx context.Context, client *slack.Client, recipient *models.User, from, link string, style models.NotificationStyle) (bool, error) {
+	return d.deliver(ctx, models.NotificationChannelSlack, recipient.ID, from,
+		func(count int) (string, error) {
+			return client.PostSecretNotification(ctx, recipient.Email, from, link, count, style)
+		},
+		func(ref string, count int) error {
+			return client.UpdateSecretNotification(ctx, ref, from, link, count, style)
+		},
+	)
+}
+
+// sendEmail sends an email notification worded in style unless one was
+// sent within the window. It reports whether the notification was collapsed
+func (d *NotificationDeduper) sendEmail(ctx context.Context, client *email.Client, recipient *models.User, from, link string, style models.NotificationStyle) (bool, error) {
+	return d.deliver(ctx, models.NotificationChannelEmail, recipient.ID, from,
+		func(int) (string, error) {
+			return "", client.SendSecretNotification(ctx, recipient.Email, recipient.Name, from, link, style)
+		},
+		nil,
+	)
+}
+
+// deliver sends the first notification of a window with post, which
+// returns a reference to what it sent ("" when there is none), and passes
+// repeats to update with that reference and the count. Channels that
+// cannot edit a sent message have a nil update and drop repeats. When
+// the count cannot be read the notification is sent: a duplicate is
+// better than a lost link
+func (d *NotificationDeduper) deliver(
+	ctx context.Context,
+	channel string,
+	recipientID int64,
+	from string,
+	post func(count int) (string, error),
+	update func(ref string, count int) error,
+) (bool, error) {
+	if d == nil {
+		_, err := post(1)
+		return false, err
+	}
+	logger := requestid.Logger(ctx)
+
+	key := dedupeKey(channel, recipientID, from)
+	count, ref, err := d.storage.RecordNotification(ctx, key, d.window)
+	if err != nil {
+		logger.Warn("failed to count notification", "channel", channel, "error", err)
+		_, err := post(1)
+		return false, err
+	}
+
+	if count == 1 {
+		ref, err := post(1)
+		if err != nil {
+			// Let the next attempt send rather than be collapsed into nothing
+			if err := d.storage.ForgetNotification(ctx, key); err != nil {
+				logger.Warn("failed to forget notification", "channel", channel, "error", err)
+			}
+			return false, err
+		}
+		d.setRef(ctx, key, ref)
+		return false, nil
+	}
+
+	// A repeat whose first notification is still in flight, or cannot be
+	// edited, is dropped
+	if ref == "" || update == nil {
+		return true, nil
+	}
+	err = update(ref, count)
+	if err == nil {
+		return true, nil
+	}
+	logger.Warn("failed to update notification", "channel", channel, "error", err)
+
+	// The first message is gone (deleted by the recipient, say): post the
+	// count and the latest link afresh and update that one from now on
+	ref, err = post(count)
+	if err != nil {
+		return false, err
+	}
+	d.setRef(ctx, key, ref)
+	return true, nil
+}
+
+// setRef stores the reference of a posted notification for later repeats
+func (d *NotificationDeduper) setRef(ctx context.Context, key, ref string) {
+	if ref == "" {
+		return
+	}
+	if err := d.storage.SetNotificationRef(ctx, key, ref); err != nil {
+		requestid.Logger(ctx).Warn("failed to store notification reference", "error", err)
+	}
+}
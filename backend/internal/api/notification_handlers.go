@@ -1,36 +1,58 @@
 package api
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/milkiss/vanish/backend/internal/integrations/email"
-	"github.com/milkiss/vanish/backend/internal/integrations/slack"
 	"github.com/milkiss/vanish/backend/internal/models"
-	"github.com/milkiss/vanish/backend/internal/repository"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+	"github.com/milkiss/vanish/backend/internal/storage"
+	"github.com/milkiss/vanish/backend/internal/urlbuilder"
 )
 
+// resendInterval is the minimum time between two resends of one message
+const resendInterval = 10 * time.Minute
+
 // NotificationHandler handles notification-related HTTP requests
 type NotificationHandler struct {
-	userRepo     *repository.UserRepository
-	metadataRepo *repository.MetadataRepository
-	emailClient  *email.Client
-	slackClient  *slack.Client
+	userRepo     persistence.UserStore
+	metadataRepo persistence.MetadataStore
+	integrations *Integrations
+	links        *urlbuilder.Builder        // rebuilds message links for resends; nil when no integration is enabled
+	deduper      *NotificationDeduper       // collapses repeated notifications; nil sends every one
+	events       *EventLog                  // counts failed notifications for the admin digest; nil counts none
+	policies     persistence.TTLPolicyStore // words notifications by message category; nil words all alike
+
+	mu      sync.Mutex
+	resends map[string]time.Time // last resend per message (use Redis when running several instances)
 }
 
 // NewNotificationHandler creates a new notification handler
 func NewNotificationHandler(
-	userRepo *repository.UserRepository,
-	metadataRepo *repository.MetadataRepository,
-	emailClient *email.Client,
-	slackClient *slack.Client,
+	userRepo persistence.UserStore,
+	metadataRepo persistence.MetadataStore,
+	integrations *Integrations,
+	links *urlbuilder.Builder,
+	deduper *NotificationDeduper,
+	events *EventLog,
+	policies persistence.TTLPolicyStore,
 ) *NotificationHandler {
 	return &NotificationHandler{
 		userRepo:     userRepo,
 		metadataRepo: metadataRepo,
-		emailClient:  emailClient,
-		slackClient:  slackClient,
+		integrations: integrations,
+		links:        links,
+		deduper:      deduper,
+		events:       events,
+		policies:     policies,
+		resends:      make(map[string]time.Time),
 	}
 }
 
@@ -42,122 +64,295 @@ type SendNotificationRequest struct {
 
 // SendSlackNotification handles POST /api/notifications/send-slack
 func (h *NotificationHandler) SendSlackNotification(c *gin.Context) {
-	if h.slackClient == nil {
-		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
-			Error: "Slack integration is not enabled",
-		})
+	slackClient := h.integrations.Slack()
+	if slackClient == nil {
+		c.JSON(http.StatusServiceUnavailable, errorResponse(c, models.ErrorCodeIntegrationDisabled, "Slack integration not enabled"))
 		return
 	}
 
 	// Get sender ID from auth middleware
 	senderID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-			Error: "Unauthorized",
-		})
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
 		return
 	}
 
 	var req SendNotificationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Invalid request: " + err.Error(),
-		})
+		c.JSON(http.StatusBadRequest, bindError(c, err))
 		return
 	}
 
 	// Verify sender
 	sender, err := h.userRepo.FindByID(c.Request.Context(), senderID.(int64))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to retrieve sender information",
-		})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to retrieve sender information"))
 		return
 	}
 
 	// Retrieve recipient
 	recipient, err := h.userRepo.FindByID(c.Request.Context(), req.RecipientID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, models.ErrorResponse{
-			Error: "Recipient not found",
-		})
+		c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeUserNotFound, "Recipient not found"))
+		return
+	}
+
+	// Notifications about a scheduled message wait for its release
+	message, ok := h.linkedMessage(c, senderID.(int64), &req)
+	if !ok {
+		return
+	}
+	from := senderLabel(c, sender)
+	if h.deferNotification(c, models.NotificationChannelSlack, message, from) {
 		return
 	}
 
-	// Send notification
-	err = h.slackClient.SendSecretNotification(
-		c.Request.Context(),
-		recipient.Email,
-		sender.Name,
-		req.MessageURL,
-	)
+	// Send notification, unless it repeats one the recipient just got
+	style := h.notificationStyle(c.Request.Context(), message)
+	collapsed, err := h.deduper.sendSlack(c.Request.Context(), slackClient, recipient, from, req.MessageURL, style)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: fmt.Sprintf("Failed to send Slack notification: %v", err),
-		})
+		h.events.Record(c.Request.Context(), models.EventNotificationFailed)
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeUpstreamFailed, fmt.Sprintf("Failed to send Slack notification: %v", err)))
 		return
 	}
+	if collapsed {
+		requestid.Logger(c.Request.Context()).Info("notification collapsed into an earlier one",
+			"recipient_id", recipient.ID, "channel", models.NotificationChannelSlack)
+	}
 
 	c.Status(http.StatusOK)
 }
 
 // SendEmailNotification handles POST /api/notifications/send-email
 func (h *NotificationHandler) SendEmailNotification(c *gin.Context) {
-	if h.emailClient == nil {
-		c.JSON(http.StatusServiceUnavailable, models.ErrorResponse{
-			Error: "Email integration is not enabled",
-		})
+	emailClient := h.integrations.Email()
+	if emailClient == nil {
+		c.JSON(http.StatusServiceUnavailable, errorResponse(c, models.ErrorCodeIntegrationDisabled, "Email integration not enabled"))
 		return
 	}
 
 	// Get sender ID from auth middleware
 	senderID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-			Error: "Unauthorized",
-		})
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
 		return
 	}
 
 	var req SendNotificationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Invalid request: " + err.Error(),
-		})
+		c.JSON(http.StatusBadRequest, bindError(c, err))
 		return
 	}
 
 	// Verify sender
 	sender, err := h.userRepo.FindByID(c.Request.Context(), senderID.(int64))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to retrieve sender information",
-		})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to retrieve sender information"))
 		return
 	}
 
 	// Retrieve recipient
 	recipient, err := h.userRepo.FindByID(c.Request.Context(), req.RecipientID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, models.ErrorResponse{
-			Error: "Recipient not found",
-		})
+		c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeUserNotFound, "Recipient not found"))
+		return
+	}
+
+	// Notifications about a scheduled message wait for its release
+	message, ok := h.linkedMessage(c, senderID.(int64), &req)
+	if !ok {
+		return
+	}
+	from := senderLabel(c, sender)
+	if h.deferNotification(c, models.NotificationChannelEmail, message, from) {
 		return
 	}
 
-	// Send notification
-	err = h.emailClient.SendSecretNotification(
-		recipient.Email,
-		recipient.Name,
-		sender.Name,
-		req.MessageURL,
-	)
+	// Send notification, unless it repeats one the recipient just got
+	style := h.notificationStyle(c.Request.Context(), message)
+	collapsed, err := h.deduper.sendEmail(c.Request.Context(), emailClient, recipient, from, req.MessageURL, style)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: fmt.Sprintf("Failed to send Email notification: %v", err),
-		})
+		h.events.Record(c.Request.Context(), models.EventNotificationFailed)
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeUpstreamFailed, fmt.Sprintf("Failed to send Email notification: %v", err)))
 		return
 	}
+	if collapsed {
+		requestid.Logger(c.Request.Context()).Info("notification collapsed into an earlier one",
+			"recipient_id", recipient.ID, "channel", models.NotificationChannelEmail)
+	}
 
 	c.Status(http.StatusOK)
 }
+
+// ResendNotification handles POST /api/messages/:id/resend-notification
+// The sender of a pending message can notify the recipient again, at most
+// once per resendInterval. The link is rebuilt from the stored key, over
+// Slack when enabled and email otherwise (or when the Slack DM fails).
+// Messages whose key is not stored (zero-knowledge Slack messages, keys
+// sealed to the recipient) cannot be resent
+func (h *NotificationHandler) ResendNotification(c *gin.Context) {
+	currentUserID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
+		return
+	}
+
+	id := c.Param("id")
+	if !storage.ValidID(id) {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidMessageID, "Invalid message ID"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	metadata, err := h.metadataRepo.FindByMessageID(ctx, id)
+	if errors.Is(err, models.ErrMessageNotFound) {
+		c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeMessageNotFound, "Message not found"))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to retrieve message metadata"))
+		return
+	}
+
+	if metadata.SenderID != currentUserID.(int64) {
+		c.JSON(http.StatusForbidden, errorResponse(c, models.ErrorCodeForbidden, "Only the sender can resend the notification"))
+		return
+	}
+
+	switch {
+	case metadata.Status == models.StatusRead:
+		c.JSON(http.StatusGone, errorResponse(c, models.ErrorCodeMessageAlreadyRead, "Message has already been read"))
+		return
+	case metadata.Status == models.StatusClaimed:
+		c.JSON(http.StatusConflict, errorResponse(c, models.ErrorCodeMessageClaimed, "The recipient has already opened this message"))
+		return
+	case metadata.Status != models.StatusPending || time.Now().After(metadata.ExpiresAt):
+		c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeMessageNotFound, "Message has expired"))
+		return
+	}
+	if tooEarly(c, metadata) {
+		return
+	}
+
+	key, err := h.metadataRepo.GetEncryptionKey(ctx, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to retrieve message key"))
+		return
+	}
+	if key == "" {
+		c.JSON(http.StatusConflict, errorResponse(c, models.ErrorCodeCannotResend,
+			"Cannot resend: the link key of this message is not stored on the server. Share the original link or create a new message"))
+		return
+	}
+
+	clients := h.integrations.Clients()
+	if h.links == nil || (clients.Slack == nil && clients.Email == nil) {
+		c.JSON(http.StatusServiceUnavailable, errorResponse(c, models.ErrorCodeIntegrationDisabled, "Neither Slack nor email integration is enabled"))
+		return
+	}
+
+	recipient, err := h.userRepo.FindByID(ctx, metadata.RecipientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeUserNotFound, "Recipient not found"))
+		return
+	}
+
+	if wait := h.reserveResend(id, time.Now()); wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(wait.Round(time.Second).Seconds())))
+		c.JSON(http.StatusTooManyRequests, errorResponse(c, models.ErrorCodeQuotaExceeded, "Notification already resent; try again later"))
+		return
+	}
+
+	from := models.SenderLabel(metadata.SenderName, metadata.SenderType, metadata.IntegrationName)
+	channel, err := notify(ctx, clients, recipient, from, h.links.MessageURL(id, key), h.notificationStyle(ctx, metadata))
+	if err != nil {
+		h.releaseResend(id)
+		h.events.Record(ctx, models.EventNotificationFailed)
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeUpstreamFailed, fmt.Sprintf("Failed to resend notification: %v", err)))
+		return
+	}
+
+	requestid.Logger(ctx).Info("notification resent",
+		"sender_id", metadata.SenderID, "recipient_id", recipient.ID, "channel", channel)
+
+	c.JSON(http.StatusOK, models.ResendNotificationResponse{Channel: channel})
+}
+
+// notify sends the message link to the recipient over Slack, falling back
+// to email when Slack is disabled or the DM fails, and returns the channel
+// used. The sender asked for this notification, so it is never collapsed
+// into an earlier one
+func notify(ctx context.Context, clients IntegrationClients, recipient *models.User, from, secretURL string, style models.NotificationStyle) (string, error) {
+	var err error
+	if clients.Slack != nil {
+		err = clients.Slack.SendSecretNotification(ctx, recipient.Email, from, secretURL, style)
+		if err == nil {
+			return models.NotificationChannelSlack, nil
+		}
+		if clients.Email == nil {
+			return "", err
+		}
+	}
+	if err := clients.Email.SendSecretNotification(ctx, recipient.Email, recipient.Name, from, secretURL, style); err != nil {
+		return "", err
+	}
+	return models.NotificationChannelEmail, nil
+}
+
+// notificationStyle returns the wording of notifications about message:
+// that of its category's policy, standard for a nil message or one without
+// a policy. A policy that cannot be loaded falls back to standard rather
+// than holding back the notification
+func (h *NotificationHandler) notificationStyle(ctx context.Context, message *models.MessageMetadata) models.NotificationStyle {
+	if message == nil || message.Category == "" || h.policies == nil {
+		return models.NotificationStandard
+	}
+	policy, err := h.policies.GetCategoryPolicy(ctx, message.Category)
+	if err != nil {
+		if !errors.Is(err, models.ErrCategoryPolicyNotFound) {
+			requestid.Logger(ctx).Warn("failed to load category policy", "category", message.Category, "error", err)
+		}
+		return models.NotificationStandard
+	}
+	return policy.Style()
+}
+
+// reserveResend records a resend of a message at now and returns zero, or
+// returns how long the sender must wait if it was resent within resendInterval
+func (h *NotificationHandler) reserveResend(messageID string, now time.Time) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if last, ok := h.resends[messageID]; ok {
+		if wait := last.Add(resendInterval).Sub(now); wait > 0 {
+			return wait
+		}
+	}
+
+	// Drop stale entries so the map only holds messages inside the window
+	for message, last := range h.resends {
+		if now.Sub(last) >= resendInterval {
+			delete(h.resends, message)
+		}
+	}
+	h.resends[messageID] = now
+	return 0
+}
+
+// releaseResend forgets a reservation whose notification could not be
+// delivered, so the sender can retry straight away
+func (h *NotificationHandler) releaseResend(messageID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.resends, messageID)
+}
+
+// senderLabel names the sender in a notification; a service account
+// authenticated by API key is shown as its integration
+func senderLabel(c *gin.Context, sender *models.User) string {
+	integration := c.GetString("integration_name")
+	if integration == "" {
+		return sender.Name
+	}
+	return models.SenderLabel(sender.Name, models.SenderTypeIntegration, integration)
+}
@@ -4,51 +4,74 @@ import (
 	"context"
 	"crypto/rand"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/milkiss/vanish/backend/internal/auth"
 	"github.com/milkiss/vanish/backend/internal/integrations/okta"
+	"github.com/milkiss/vanish/backend/internal/lifecycle"
 	"github.com/milkiss/vanish/backend/internal/models"
-	"github.com/milkiss/vanish/backend/internal/repository"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/requestid"
 )
 
 // OktaHandler handles Okta OAuth authentication
 type OktaHandler struct {
-	oktaClient *okta.Client
-	userRepo   *repository.UserRepository
-	jwtManager *auth.JWTManager
-	states     map[string]time.Time // CSRF state tracking (use Redis in production)
+	integrations *Integrations
+	userRepo     persistence.UserStore
+	jwtManager   *auth.JWTManager
+	cookies      *SessionCookies // nil unless cookie auth is enabled
+
+	mu     sync.Mutex
+	states map[string]time.Time // CSRF state tracking (use Redis in production)
 }
 
 // NewOktaHandler creates a new Okta handler
-func NewOktaHandler(oktaClient *okta.Client, userRepo *repository.UserRepository, jwtManager *auth.JWTManager) *OktaHandler {
+func NewOktaHandler(integrations *Integrations, userRepo persistence.UserStore, jwtManager *auth.JWTManager, cookies *SessionCookies) *OktaHandler {
 	return &OktaHandler{
-		oktaClient: oktaClient,
-		userRepo:   userRepo,
-		jwtManager: jwtManager,
-		states:     make(map[string]time.Time),
+		integrations: integrations,
+		userRepo:     userRepo,
+		jwtManager:   jwtManager,
+		cookies:      cookies,
+		states:       make(map[string]time.Time),
 	}
 }
 
+// client returns the Okta client in effect. When Okta is disabled it
+// answers 503 and returns nil
+func (h *OktaHandler) client(c *gin.Context) *okta.Client {
+	oktaClient := h.integrations.Okta()
+	if oktaClient == nil {
+		c.JSON(http.StatusServiceUnavailable, errorResponse(c, models.ErrorCodeIntegrationDisabled, "Okta integration not enabled"))
+	}
+	return oktaClient
+}
+
 // InitiateLogin redirects to Okta for authentication
 func (h *OktaHandler) InitiateLogin(c *gin.Context) {
+	oktaClient := h.client(c)
+	if oktaClient == nil {
+		return
+	}
+
 	// Generate CSRF state token
 	state, err := h.generateState()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to generate state",
-		})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to generate state"))
 		return
 	}
 
 	// Store state with expiration (5 minutes)
+	h.mu.Lock()
 	h.states[state] = time.Now().Add(5 * time.Minute)
+	h.mu.Unlock()
 
 	// Get Okta authorization URL
-	authURL := h.oktaClient.GetAuthURL(state)
+	authURL := oktaClient.GetAuthURL(state)
 
 	// Redirect to Okta
 	c.Redirect(http.StatusFound, authURL)
@@ -56,72 +79,74 @@ func (h *OktaHandler) InitiateLogin(c *gin.Context) {
 
 // HandleCallback handles the OAuth callback from Okta
 func (h *OktaHandler) HandleCallback(c *gin.Context) {
+	oktaClient := h.client(c)
+	if oktaClient == nil {
+		return
+	}
+
 	// Verify state (CSRF protection)
 	state := c.Query("state")
 	if !h.validateState(state) {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Invalid state parameter",
-		})
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Invalid state parameter"))
 		return
 	}
 
 	// Clean up used state
+	h.mu.Lock()
 	delete(h.states, state)
+	h.mu.Unlock()
 
 	// Check for error from Okta
 	if errMsg := c.Query("error"); errMsg != "" {
 		errorDesc := c.Query("error_description")
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: fmt.Sprintf("Okta error: %s - %s", errMsg, errorDesc),
-		})
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeUpstreamFailed, fmt.Sprintf("Okta error: %s - %s", errMsg, errorDesc)))
 		return
 	}
 
 	// Get authorization code
 	code := c.Query("code")
 	if code == "" {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Missing authorization code",
-		})
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Missing authorization code"))
 		return
 	}
 
 	// Exchange code for tokens
 	ctx := c.Request.Context()
-	token, err := h.oktaClient.ExchangeCode(ctx, code)
+	token, err := oktaClient.ExchangeCode(ctx, code)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to exchange code for token",
-		})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeUpstreamFailed, "Failed to exchange code for token"))
 		return
 	}
 
 	// Get user info from Okta
-	userInfo, err := h.oktaClient.GetUserInfo(ctx, token)
+	userInfo, err := oktaClient.GetUserInfo(ctx, token)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to get user info",
-		})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeUpstreamFailed, "Failed to get user info"))
 		return
 	}
 
 	// Find or create user in our database
 	user, err := h.findOrCreateUser(ctx, userInfo)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to process user",
-		})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to process user"))
+		return
+	}
+	if user.IsService {
+		c.JSON(http.StatusForbidden, errorResponse(c, models.ErrorCodeForbidden, "Service accounts cannot sign in"))
 		return
 	}
 
 	// Generate our own JWT token for API access
 	jwtToken, err := h.jwtManager.Generate(user.ID, user.Email)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to generate token",
-		})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to generate token"))
+		return
+	}
+	if err := h.cookies.Set(c, jwtToken); err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to start session"))
 		return
 	}
+	recordLogin(ctx, h.userRepo, user.ID)
 
 	// Return token and user info
 	c.JSON(http.StatusOK, models.AuthResponse{
@@ -132,11 +157,14 @@ func (h *OktaHandler) HandleCallback(c *gin.Context) {
 
 // ValidateOktaToken validates an Okta access token (alternative to JWT)
 func (h *OktaHandler) ValidateOktaToken(c *gin.Context) {
+	oktaClient := h.client(c)
+	if oktaClient == nil {
+		return
+	}
+
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-			Error: "Authorization header required",
-		})
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Authorization header required"))
 		return
 	}
 
@@ -145,33 +173,32 @@ func (h *OktaHandler) ValidateOktaToken(c *gin.Context) {
 	if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
 		token = authHeader[7:]
 	} else {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-			Error: "Invalid authorization header format",
-		})
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Invalid authorization header format"))
 		return
 	}
 
 	// Validate with Okta
 	ctx := c.Request.Context()
-	userInfo, err := h.oktaClient.ValidateAccessToken(ctx, token)
+	userInfo, err := oktaClient.ValidateAccessToken(ctx, token)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-			Error: "Invalid or expired token",
-		})
+		// Only a verdict from Okta about the token is a 401; an unreachable
+		// or failing Okta must not look like a bad credential
+		var statusErr *okta.StatusError
+		if errors.Is(err, okta.ErrTokenInactive) ||
+			(errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnauthorized) {
+			c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Invalid or expired token"))
+			return
+		}
+		requestid.Logger(ctx).Error("okta token validation failed", "error", err)
+		c.JSON(http.StatusBadGateway, errorResponse(c, models.ErrorCodeUpstreamFailed, "Okta is unavailable"))
 		return
 	}
 
-	// Find user in our database
-	user, err := h.userRepo.FindByEmail(ctx, userInfo.Email)
+	// Find user in our database, or create one that exists in Okta only
+	user, err := h.findOrCreateUser(ctx, userInfo)
 	if err != nil {
-		// User exists in Okta but not in our DB - create them
-		user, err = h.createUserFromOkta(ctx, userInfo)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-				Error: "Failed to create user",
-			})
-			return
-		}
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to create user"))
+		return
 	}
 
 	c.JSON(http.StatusOK, user.ToUserInfo())
@@ -188,6 +215,9 @@ func (h *OktaHandler) generateState() (string, error) {
 }
 
 func (h *OktaHandler) validateState(state string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
 	expiration, exists := h.states[state]
 	if !exists {
 		return false
@@ -202,22 +232,45 @@ func (h *OktaHandler) validateState(state string) bool {
 	return true
 }
 
+// findOrCreateUser returns the account of userInfo, creating it on first
+// sign-in. A region claim updates the account's region; without one the
+// region set by an admin stays
 func (h *OktaHandler) findOrCreateUser(ctx context.Context, userInfo *okta.UserInfo) (*models.User, error) {
+	region := oktaRegion(ctx, userInfo)
+
 	// Try to find existing user
 	user, err := h.userRepo.FindByEmail(ctx, userInfo.Email)
-	if err == nil {
-		return user, nil
+	if err != nil {
+		// User doesn't exist, create new one
+		return h.createUserFromOkta(ctx, userInfo, region)
 	}
 
-	// User doesn't exist, create new one
-	return h.createUserFromOkta(ctx, userInfo)
+	if region != "" && region != user.Region {
+		requestid.Logger(ctx).Info("region updated from okta claim", "user_id", user.ID, "old_region", user.Region, "region", region)
+		user.Region = region
+		if err := h.userRepo.Update(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
 }
 
-func (h *OktaHandler) createUserFromOkta(ctx context.Context, userInfo *okta.UserInfo) (*models.User, error) {
+// oktaRegion returns the region claimed for the user, ignoring one that is
+// not a valid region name
+func oktaRegion(ctx context.Context, userInfo *okta.UserInfo) string {
+	if userInfo.Region == "" || models.ValidRegion(userInfo.Region) {
+		return userInfo.Region
+	}
+	requestid.Logger(ctx).Warn("ignoring invalid region claim from okta", "region", userInfo.Region)
+	return ""
+}
+
+func (h *OktaHandler) createUserFromOkta(ctx context.Context, userInfo *okta.UserInfo, region string) (*models.User, error) {
 	// Create user with Okta info
 	user := &models.User{
-		Email: userInfo.Email,
-		Name:  userInfo.Name,
+		Email:  models.NormalizeEmail(userInfo.Email),
+		Name:   userInfo.Name,
+		Region: region,
 		// No password - Okta handles authentication
 		Password: "", // Empty password for SSO users
 	}
@@ -230,18 +283,22 @@ func (h *OktaHandler) createUserFromOkta(ctx context.Context, userInfo *okta.Use
 	return user, nil
 }
 
-// CleanupExpiredStates periodically removes expired CSRF states
-// Should be called in a goroutine
-func (h *OktaHandler) CleanupExpiredStates() {
-	ticker := time.NewTicker(5 * time.Minute)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		now := time.Now()
-		for state, expiration := range h.states {
-			if now.After(expiration) {
-				delete(h.states, state)
-			}
+// CleanupExpiredStates removes expired CSRF states every five minutes
+// until ctx is cancelled; run it as a lifecycle worker
+func (h *OktaHandler) CleanupExpiredStates(ctx context.Context) {
+	lifecycle.Every(5*time.Minute, func(context.Context) {
+		h.pruneExpiredStates(time.Now())
+	})(ctx)
+}
+
+// pruneExpiredStates drops every state that expired before now
+func (h *OktaHandler) pruneExpiredStates(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for state, expiration := range h.states {
+		if now.After(expiration) {
+			delete(h.states, state)
 		}
 	}
 }
@@ -0,0 +1,21 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/openapi"
+)
+
+// GetOpenAPISpec handles GET /api/openapi.json
+// Serves the embedded OpenAPI 3 specification
+func GetOpenAPISpec(c *gin.Context) {
+	spec, err := openapi.JSON()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to load API specification"))
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", spec)
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/lifecycle"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+	"github.com/milkiss/vanish/backend/internal/storage"
+)
+
+const (
+	// orphanScanBatchSize is how many keys each SCAN asks Redis for
+	orphanScanBatchSize = 200
+	// orphanScanPause spaces the batches out so a scan of a large keyspace
+	// never competes with requests for Redis
+	orphanScanPause = 10 * time.Millisecond
+)
+
+// OrphanScanner finds messages in Redis without metadata. They are left
+// behind when the metadata insert fails after the message was stored, or
+// were stored before metadata existed; nobody can open them, but they use
+// memory until their TTL. It also counts the messages Redis holds
+type OrphanScanner struct {
+	storage      storage.Storage
+	metadataRepo persistence.MetadataStore
+	grace        time.Duration
+
+	// running serializes scans, so a manual scan waits for a scheduled one
+	running sync.Mutex
+}
+
+// NewOrphanScanner creates a scanner that leaves messages younger than
+// grace alone
+func NewOrphanScanner(storage storage.Storage, metadataRepo persistence.MetadataStore, grace time.Duration) *OrphanScanner {
+	return &OrphanScanner{storage: storage, metadataRepo: metadataRepo, grace: grace}
+}
+
+// Scan walks the message keyspace in batches, checking each message for
+// metadata, and deletes the orphans when remove is set
+func (s *OrphanScanner) Scan(ctx context.Context, remove bool) (*models.OrphanScanReport, error) {
+	s.running.Lock()
+	defer s.running.Unlock()
+
+	start := time.Now()
+	cutoff := start.Add(-s.grace)
+	report := &models.OrphanScanReport{GracePeriodSeconds: int64(s.grace.Seconds())}
+	defer func() { report.DurationMs = time.Since(start).Milliseconds() }()
+
+	var cursor uint64
+	for {
+		batch, next, err := s.storage.Scan(ctx, cursor, orphanScanBatchSize)
+		if err != nil {
+			return report, err
+		}
+
+		for _, m := range batch {
+			report.Scanned++
+			_, err := s.metadataRepo.FindByMessageID(ctx, m.ID)
+			if err == nil {
+				continue
+			}
+			if !errors.Is(err, models.ErrMessageNotFound) {
+				return report, err
+			}
+			// Messages that do not record when they were stored predate
+			// this scan by far
+			if m.CreatedAt.After(cutoff) {
+				report.Recent++
+				continue
+			}
+
+			report.Orphans++
+			if !remove {
+				continue
+			}
+			_, err = s.storage.GetAndDelete(ctx, m.ID)
+			if errors.Is(err, models.ErrMessageNotFound) {
+				continue // expired since it was listed
+			}
+			if err != nil {
+				return report, fmt.Errorf("failed to delete orphaned message: %w", err)
+			}
+			report.Deleted++
+		}
+
+		if cursor = next; cursor == 0 {
+			return report, nil
+		}
+		select {
+		case <-ctx.Done():
+			return report, ctx.Err()
+		case <-time.After(orphanScanPause):
+		}
+	}
+}
+
+// Run scans every interval until ctx is cancelled, deleting the orphans
+// when remove is set; run it as a lifecycle worker
+func (s *OrphanScanner) Run(interval time.Duration, remove bool) func(ctx context.Context) {
+	return lifecycle.Every(interval, func(ctx context.Context) {
+		report, err := s.Scan(ctx, remove)
+		logOrphanScan(ctx, report, err)
+	})
+}
+
+// logOrphanScan records the outcome of a scan; monitoring reads the
+// message count from it
+func logOrphanScan(ctx context.Context, report *models.OrphanScanReport, err error) {
+	logger := requestid.Logger(ctx)
+	if err != nil {
+		logger.Warn("orphan scan failed", "scanned", report.Scanned, "error", err)
+		return
+	}
+	logger.Info("orphan scan finished",
+		"messages", report.Scanned, "orphans", report.Orphans, "recent", report.Recent,
+		"deleted", report.Deleted, "duration_ms", report.DurationMs)
+}
+
+// ScanOrphans handles POST /api/admin/maintenance/scan-orphans
+// Reports how many messages Redis holds and how many of them have no
+// metadata; with ?delete=true the orphans are deleted too. The scan runs
+// while the request waits, and after any scan already in progress
+func (h *AdminHandler) ScanOrphans(c *gin.Context) {
+	remove, err := strconv.ParseBool(c.DefaultQuery("delete", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "delete must be true or false"))
+		return
+	}
+
+	ctx := c.Request.Context()
+	adminID, _ := c.Get("user_id")
+	requestid.Logger(ctx).Info("orphan scan started", "admin_id", adminID, "delete", remove)
+
+	report, err := h.orphans.Scan(ctx, remove)
+	logOrphanScan(ctx, report, err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Orphan scan failed"))
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -1,22 +1,43 @@
 package api
 
 import (
+	"encoding/json"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/milkiss/vanish/backend/internal/models"
-	"github.com/milkiss/vanish/backend/internal/repository"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+	"github.com/milkiss/vanish/backend/internal/storage"
+)
+
+const (
+	// exportInterval is how often a user may download a data export
+	exportInterval = time.Hour
+	// exportPageSize is how many history rows are read per query while exporting
+	exportPageSize = 100
 )
 
 // ProfileHandler handles user profile operations
 type ProfileHandler struct {
-	userRepo *repository.UserRepository
+	userRepo     persistence.UserStore
+	metadataRepo persistence.MetadataStore
+	storage      storage.Storage
+
+	mu      sync.Mutex
+	exports map[int64]time.Time // last export per user (use Redis when running several instances)
 }
 
 // NewProfileHandler creates a new profile handler
-func NewProfileHandler(userRepo *repository.UserRepository) *ProfileHandler {
+func NewProfileHandler(userRepo persistence.UserStore, metadataRepo persistence.MetadataStore, storage storage.Storage) *ProfileHandler {
 	return &ProfileHandler{
-		userRepo: userRepo,
+		userRepo:     userRepo,
+		metadataRepo: metadataRepo,
+		storage:      storage,
+		exports:      make(map[int64]time.Time),
 	}
 }
 
@@ -25,9 +46,7 @@ func NewProfileHandler(userRepo *repository.UserRepository) *ProfileHandler {
 func (h *ProfileHandler) UpdateProfile(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-			Error: "Unauthorized",
-		})
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
 		return
 	}
 
@@ -37,18 +56,14 @@ func (h *ProfileHandler) UpdateProfile(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Invalid request: " + err.Error(),
-		})
+		c.JSON(http.StatusBadRequest, bindError(c, err))
 		return
 	}
 
 	// Get existing user
 	user, err := h.userRepo.FindByID(c.Request.Context(), userID.(int64))
 	if err != nil {
-		c.JSON(http.StatusNotFound, models.ErrorResponse{
-			Error: "User not found",
-		})
+		c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeUserNotFound, "User not found"))
 		return
 	}
 
@@ -62,9 +77,7 @@ func (h *ProfileHandler) UpdateProfile(c *gin.Context) {
 
 	// Update user (password remains unchanged)
 	if err := h.userRepo.Update(c.Request.Context(), user); err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to update profile",
-		})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to update profile"))
 		return
 	}
 
@@ -76,9 +89,7 @@ func (h *ProfileHandler) UpdateProfile(c *gin.Context) {
 func (h *ProfileHandler) ChangePassword(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-			Error: "Unauthorized",
-		})
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
 		return
 	}
 
@@ -88,57 +99,84 @@ func (h *ProfileHandler) ChangePassword(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Invalid request: " + err.Error(),
-		})
+		c.JSON(http.StatusBadRequest, bindError(c, err))
 		return
 	}
 
 	// Get user
 	user, err := h.userRepo.FindByID(c.Request.Context(), userID.(int64))
 	if err != nil {
-		c.JSON(http.StatusNotFound, models.ErrorResponse{
-			Error: "User not found",
-		})
+		c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeUserNotFound, "User not found"))
+		return
+	}
+
+	// LDAP accounts have no password here to change
+	if user.IsDirectoryAccount() {
+		c.JSON(http.StatusConflict, errorResponse(c, models.ErrorCodePasswordManaged, "Your password is managed by LDAP; change it in your directory"))
 		return
 	}
 
 	// Verify current password
 	if !user.CheckPassword(req.CurrentPassword) {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-			Error: "Current password is incorrect",
-		})
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeIncorrectPassword, "Current password is incorrect"))
 		return
 	}
 
 	// Hash new password
 	hashedPassword, err := models.HashPassword(req.NewPassword)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to hash password",
-		})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to hash password"))
 		return
 	}
 
 	// Update password
 	if err := h.userRepo.UpdatePassword(c.Request.Context(), userID.(int64), hashedPassword); err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to update password",
-		})
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to update password"))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Password updated successfully"})
 }
 
+// UpdatePublicKey handles PUT /api/profile/publickey
+// Senders seal link keys to this key instead of storing them in plaintext;
+// an empty key removes it and new messages fall back to the stored key
+func (h *ProfileHandler) UpdatePublicKey(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
+		return
+	}
+
+	var req models.UpdatePublicKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, bindError(c, err))
+		return
+	}
+
+	if req.PublicKey != "" {
+		if err := models.ValidatePublicKey(req.PublicKey); err != nil {
+			c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidPublicKey, err.Error()))
+			return
+		}
+	}
+
+	if err := h.userRepo.UpdatePublicKey(c.Request.Context(), userID.(int64), req.PublicKey); err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to update public key"))
+		return
+	}
+
+	requestid.Logger(c.Request.Context()).Info("public key updated", "user_id", userID, "removed", req.PublicKey == "")
+	c.JSON(http.StatusOK, gin.H{"message": "Public key updated successfully"})
+}
+
 // DeleteAccount handles DELETE /api/profile
-// User deletes their own account
+// User deletes their own account. The account is anonymized rather than
+// removed so the people they exchanged messages with keep their history
 func (h *ProfileHandler) DeleteAccount(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-			Error: "Unauthorized",
-		})
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
 		return
 	}
 
@@ -147,36 +185,132 @@ func (h *ProfileHandler) DeleteAccount(c *gin.Context) {
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.ErrorResponse{
-			Error: "Invalid request: " + err.Error(),
-		})
+		c.JSON(http.StatusBadRequest, bindError(c, err))
 		return
 	}
 
 	// Get user
 	user, err := h.userRepo.FindByID(c.Request.Context(), userID.(int64))
 	if err != nil {
-		c.JSON(http.StatusNotFound, models.ErrorResponse{
-			Error: "User not found",
-		})
+		c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeUserNotFound, "User not found"))
 		return
 	}
 
 	// Verify password
 	if !user.CheckPassword(req.Password) {
-		c.JSON(http.StatusUnauthorized, models.ErrorResponse{
-			Error: "Password is incorrect",
-		})
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeIncorrectPassword, "Password is incorrect"))
 		return
 	}
 
-	// Delete user
-	if err := h.userRepo.Delete(c.Request.Context(), userID.(int64)); err != nil {
-		c.JSON(http.StatusInternalServerError, models.ErrorResponse{
-			Error: "Failed to delete account",
-		})
+	// Anonymize user
+	if err := anonymizeAccount(c.Request.Context(), h.userRepo, h.metadataRepo, h.storage, userID.(int64)); err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to delete account"))
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully"})
 }
+
+// ExportData handles GET /api/profile/export
+// Streams everything Vanish stores about the caller: the profile and the
+// metadata of every message they sent or received. Message content and
+// encryption keys are never included
+func (h *ProfileHandler) ExportData(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Unauthorized"))
+		return
+	}
+	id := userID.(int64)
+	ctx := c.Request.Context()
+
+	if wait := h.reserveExport(id, time.Now()); wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(wait.Round(time.Second).Seconds())))
+		c.JSON(http.StatusTooManyRequests, errorResponse(c, models.ErrorCodeQuotaExceeded, "Export already requested; try again later"))
+		return
+	}
+
+	user, err := h.userRepo.FindByID(ctx, id)
+	if err != nil {
+		h.releaseExport(id)
+		c.JSON(http.StatusNotFound, errorResponse(c, models.ErrorCodeUserNotFound, "User not found"))
+		return
+	}
+
+	// Read the first page before committing to a 200 so an early database
+	// failure still gets a proper error response
+	page, err := h.metadataRepo.ListUserMessages(ctx, id, 0, exportPageSize)
+	if err != nil {
+		h.releaseExport(id)
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to export data"))
+		return
+	}
+
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="vanish-export.json"`)
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	enc := json.NewEncoder(w)
+	w.WriteString(`{"exported_at":`)
+	enc.Encode(time.Now().UTC())
+	w.WriteString(`,"profile":`)
+	enc.Encode(user)
+	w.WriteString(`,"messages":[`)
+
+	first := true
+	for len(page) > 0 {
+		for _, m := range page {
+			if !first {
+				w.WriteString(",")
+			}
+			first = false
+			enc.Encode(m)
+		}
+		w.Flush()
+
+		if len(page) < exportPageSize {
+			break
+		}
+		page, err = h.metadataRepo.ListUserMessages(ctx, id, page[len(page)-1].ID, exportPageSize)
+		if err != nil {
+			// Headers are gone; leave the document unterminated so clients
+			// cannot mistake a partial export for a complete one
+			requestid.Logger(ctx).Warn("data export aborted", "error", err)
+			return
+		}
+	}
+
+	w.WriteString("]}\n")
+}
+
+// reserveExport records an export for userID at now and returns zero, or
+// returns how long the user must wait if they exported within exportInterval
+func (h *ProfileHandler) reserveExport(userID int64, now time.Time) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if last, ok := h.exports[userID]; ok {
+		if wait := last.Add(exportInterval).Sub(now); wait > 0 {
+			return wait
+		}
+	}
+
+	// Drop stale entries so the map only holds users inside the window
+	for user, last := range h.exports {
+		if now.Sub(last) >= exportInterval {
+			delete(h.exports, user)
+		}
+	}
+	h.exports[userID] = now
+	return 0
+}
+
+// releaseExport forgets a reservation whose export failed before any data
+// was sent, so the user can retry straight away
+func (h *ProfileHandler) releaseExport(userID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.exports, userID)
+}
@@ -0,0 +1,144 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+)
+
+const (
+	// panicAlertInterval is the least time between two alerts for one route;
+	// panics in between are counted into the next alert
+	panicAlertInterval = time.Minute
+	// panicAlertTimeout bounds posting one alert
+	panicAlertTimeout = 10 * time.Second
+	// maxPanicValueLength bounds the recovered value quoted in an alert
+	maxPanicValueLength = 200
+)
+
+// panics counts the handler panics recovered since the process started
+var panics atomic.Int64
+
+// PanicCount returns how many handler panics were recovered since the
+// process started
+func PanicCount() int64 {
+	return panics.Load()
+}
+
+// RecoveryMiddleware turns a panic in a later handler into a 500 with the
+// usual error body. The panic and its stack are logged with the request ID,
+// never the body (NFR-02), counted, and handed to alerts, which may be nil.
+// gin.Recovery wrote the stack to gin.DefaultWriter, which is discarded
+func RecoveryMiddleware(alerts *PanicAlerter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			// net/http aborts the response silently for this one
+			if err, ok := recovered.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(recovered)
+			}
+
+			count := panics.Add(1)
+			ctx := c.Request.Context()
+			requestid.Logger(ctx).Error("handler panicked",
+				"method", c.Request.Method,
+				"route", c.FullPath(),
+				"panic", fmt.Sprint(recovered),
+				"stack", string(debug.Stack()),
+				"panics", count,
+			)
+			alerts.Alert(ctx, models.PanicAlert{
+				RequestID: c.GetString("request_id"),
+				Method:    c.Request.Method,
+				Route:     c.FullPath(),
+				Panic:     fmt.Sprint(recovered),
+			})
+
+			if c.Writer.Written() {
+				// Too late for an error body; cut the response short
+				c.Abort()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Internal server error"))
+		}()
+		c.Next()
+	}
+}
+
+// PanicAlerter posts an alert to the alert webhook when a handler panics,
+// at most once per route every panicAlertInterval
+type PanicAlerter struct {
+	webhookURL string
+	httpClient *http.Client
+
+	mu         sync.Mutex
+	lastSent   map[string]time.Time // by route
+	suppressed map[string]int       // by route, since the last alert
+}
+
+// NewPanicAlerter creates an alerter, or returns nil when cfg.OnPanic is
+// off; a nil alerter ignores every panic
+func NewPanicAlerter(cfg config.AlertConfig, httpClient *http.Client) *PanicAlerter {
+	if !cfg.OnPanic || cfg.WebhookURL == "" {
+		return nil
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &PanicAlerter{
+		webhookURL: cfg.WebhookURL,
+		httpClient: httpClient,
+		lastSent:   make(map[string]time.Time),
+		suppressed: make(map[string]int),
+	}
+}
+
+// Alert fills in the rest of alert and posts it in the background, unless
+// the route alerted within panicAlertInterval. Failures are logged; the
+// alert is not retried
+func (a *PanicAlerter) Alert(ctx context.Context, alert models.PanicAlert) {
+	if a == nil {
+		return
+	}
+
+	now := time.Now()
+	a.mu.Lock()
+	if last, ok := a.lastSent[alert.Route]; ok && now.Sub(last) < panicAlertInterval {
+		a.suppressed[alert.Route]++
+		a.mu.Unlock()
+		return
+	}
+	a.lastSent[alert.Route] = now
+	alert.Suppressed = a.suppressed[alert.Route]
+	delete(a.suppressed, alert.Route)
+	a.mu.Unlock()
+
+	if runes := []rune(alert.Panic); len(runes) > maxPanicValueLength {
+		alert.Panic = string(runes[:maxPanicValueLength]) + "…"
+	}
+	alert.Event = "server.panic"
+	alert.At = now.UTC()
+	alert.Text = fmt.Sprintf("Vanish: %s %s panicked (request %s): %s", alert.Method, alert.Route, alert.RequestID, alert.Panic)
+
+	// The request is over by the time the webhook answers
+	postCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), panicAlertTimeout)
+	go func() {
+		defer cancel()
+		if err := postJSON(postCtx, a.httpClient, a.webhookURL, alert); err != nil {
+			requestid.Logger(postCtx).Warn("failed to post panic alert", "error", err)
+		}
+	}()
+}
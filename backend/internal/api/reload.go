@@ -0,0 +1,99 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+)
+
+// ConfigReloader applies configuration changes without a restart. It loads
+// the configuration again and swaps in integration clients built from it;
+// changed settings that only take effect at startup are reported instead
+type ConfigReloader struct {
+	load         func() (*config.Config, error)
+	integrations *Integrations
+
+	mu      sync.Mutex // one reload at a time
+	current *config.Config
+}
+
+// NewConfigReloader creates a reloader for a server started with current
+// whose clients are held by integrations; load reads the new configuration
+func NewConfigReloader(current *config.Config, load func() (*config.Config, error), integrations *Integrations) *ConfigReloader {
+	return &ConfigReloader{load: load, integrations: integrations, current: current}
+}
+
+// ReloadResult lists the settings a reload found changed
+type ReloadResult struct {
+	Applied         []string `json:"applied"`          // now in effect
+	RequiresRestart []string `json:"requires_restart"` // ignored until the server restarts
+}
+
+// Current returns the configuration in effect
+func (r *ConfigReloader) Current() *config.Config {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.current
+}
+
+// Reload loads the configuration and applies what changed. On any error,
+// an invalid configuration or an integration that cannot be set up, the
+// running clients are kept
+func (r *ConfigReloader) Reload(ctx context.Context) (*ReloadResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	next, err := r.load()
+	if err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	result := &ReloadResult{Applied: []string{}, RequiresRestart: []string{}}
+	changes := config.Diff(r.current, next)
+	for _, change := range changes {
+		if change.Reloadable {
+			result.Applied = append(result.Applied, change.Key)
+		} else {
+			result.RequiresRestart = append(result.RequiresRestart, change.Key)
+		}
+	}
+
+	if len(result.Applied) > 0 {
+		clients, err := BuildIntegrationClients(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+		r.integrations.Store(clients)
+		r.current = r.current.ApplyReloadable(next)
+	}
+
+	logger := requestid.Logger(ctx)
+	for _, change := range changes {
+		args := []any{"key", change.Key, "applied", change.Reloadable}
+		if !change.Secret {
+			args = append(args, "old", change.Old, "new", change.New)
+		}
+		logger.Info("configuration changed", args...)
+	}
+	if len(result.RequiresRestart) > 0 {
+		logger.Warn("some changed settings require a restart", "keys", result.RequiresRestart)
+	}
+	return result, nil
+}
+
+// ReloadConfig handles POST /api/admin/reload
+func (r *ConfigReloader) ReloadConfig(c *gin.Context) {
+	result, err := r.Reload(c.Request.Context())
+	if err != nil {
+		requestid.Logger(c.Request.Context()).Error("configuration reload failed", "error", err)
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeReloadFailed, "Configuration reload failed, previous configuration kept: "+err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+)
+
+// RequestIDMiddleware assigns every request a correlation ID
+// A valid incoming X-Request-ID is reused, otherwise a UUID is generated.
+// The ID is stored in the Gin context, the request context and the response header
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+
+		c.Set("request_id", id)
+		c.Request = c.Request.WithContext(requestid.NewContext(c.Request.Context(), id))
+		c.Header(requestid.Header, id)
+
+		c.Next()
+	}
+}
+
+// RequestLogMiddleware writes one structured log line per request
+// Only the route template is logged, never the raw path (which contains
+// message IDs), query string or body (NFR-02)
+func RequestLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		requestid.Logger(c.Request.Context()).Info("request",
+			"method", c.Request.Method,
+			"route", c.FullPath(),
+			"status", c.Writer.Status(),
+			"client_ip", ClientIP(c),
+			"duration_ms", time.Since(start).Milliseconds(),
+		)
+	}
+}
+
+// errorResponse builds an error body tagged with the current request ID
+// code is one of the models.ErrorCode* values; message is for people
+func errorResponse(c *gin.Context, code, message string) models.ErrorResponse {
+	return models.ErrorResponse{
+		Error:     message,
+		Code:      code,
+		RequestID: c.GetString("request_id"),
+	}
+}
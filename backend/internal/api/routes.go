@@ -1,135 +1,535 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/accesslog"
 	"github.com/milkiss/vanish/backend/internal/auth"
+	"github.com/milkiss/vanish/backend/internal/auth/ldap"
 	"github.com/milkiss/vanish/backend/internal/config"
 	"github.com/milkiss/vanish/backend/internal/integrations/email"
 	"github.com/milkiss/vanish/backend/internal/integrations/okta"
 	"github.com/milkiss/vanish/backend/internal/integrations/slack"
-	"github.com/milkiss/vanish/backend/internal/repository"
+	"github.com/milkiss/vanish/backend/internal/lifecycle"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
 	"github.com/milkiss/vanish/backend/internal/storage"
+	"github.com/milkiss/vanish/backend/internal/tracing"
+	"github.com/milkiss/vanish/backend/internal/urlbuilder"
+	"github.com/milkiss/vanish/backend/internal/webui"
 )
 
+// Dependencies holds everything SetupRouter needs to build the API
+// Config, Storage, UserStore, MetadataStore, AccessLogStore and JWTManager are required;
+// integration clients are optional and left nil when the integration is disabled
+type Dependencies struct {
+	Config         *config.Config
+	Storage        storage.Storage
+	UserStore      persistence.UserStore
+	MetadataStore  persistence.MetadataStore
+	AccessLogStore persistence.AccessLogStore
+	JWTManager     *auth.JWTManager
+
+	OktaClient  *okta.Client  // nil if Okta disabled
+	SlackClient *slack.Client // nil if Slack disabled
+	EmailClient *email.Client // nil if Email disabled
+
+	// SlackInstallations holds the bot tokens of workspaces the Slack app
+	// was installed into. When nil installing is unavailable and every
+	// workspace uses SLACK_BOT_TOKEN
+	SlackInstallations persistence.SlackInstallationStore
+
+	// DigestStore keeps the events and sent periods of the admin digest.
+	// When nil the digest is unavailable and no events are counted
+	DigestStore persistence.DigestStore
+
+	// TTLPolicyStore holds the TTL policy rules per recipient domain and the
+	// category policies. When nil no policy applies and none can be edited
+	TTLPolicyStore persistence.TTLPolicyStore
+
+	// BackupStore reads the tables of POST /admin/backup. When nil, or
+	// without BACKUP_PASSPHRASE, backups are unavailable
+	BackupStore persistence.BackupStore
+
+	// Integrations holds the clients handlers use, swapped by config reloads
+	// When nil it is built from the clients above
+	Integrations *Integrations
+	// Reloader applies configuration changes for POST /admin/reload
+	// When nil one reading config.Load is used
+	Reloader *ConfigReloader
+
+	// Frontend holds the web UI files served at / when SERVE_FRONTEND is set
+	// When nil the files embedded in the binary are used
+	Frontend fs.FS
+
+	// Lifecycle receives background workers owned by handlers
+	// When nil the workers are not run (e.g. in tests)
+	Lifecycle *lifecycle.Manager
+}
+
+// validate ensures all required dependencies are present
+func (d Dependencies) validate() error {
+	switch {
+	case d.Config == nil:
+		return errors.New("config is required")
+	case d.Storage == nil:
+		return errors.New("storage is required")
+	case d.UserStore == nil:
+		return errors.New("user store is required")
+	case d.MetadataStore == nil:
+		return errors.New("metadata store is required")
+	case d.AccessLogStore == nil:
+		return errors.New("access log store is required")
+	case d.JWTManager == nil:
+		return errors.New("JWT manager is required")
+	}
+	return nil
+}
+
+// integrationClients returns the Slack and Email clients to use, building them
+// from configuration when the integration is enabled but no client was injected.
+// A nil client means the integration is disabled.
+func integrationClients(deps Dependencies) (*slack.Client, *email.Client) {
+	cfg := deps.Config
+
+	slackClient := deps.SlackClient
+	if !cfg.Slack.Enabled {
+		slackClient = nil
+	} else if slackClient == nil {
+		// The proxy was checked by config.Load; on error nil selects the default client
+		httpClient, _ := cfg.Outbound.HTTPClient(0)
+		slackClient = newSlackClient(cfg.Slack, httpClient)
+	}
+
+	emailClient := deps.EmailClient
+	if !cfg.Email.Enabled {
+		emailClient = nil
+	} else if emailClient == nil {
+		emailClient = email.NewClient(&email.Config{
+			SMTPHost:     cfg.Email.SMTPHost,
+			SMTPPort:     cfg.Email.SMTPPort,
+			SMTPUser:     cfg.Email.SMTPUser,
+			SMTPPassword: cfg.Email.SMTPPassword,
+			FromAddress:  cfg.Email.FromAddress,
+			FromName:     cfg.Email.FromName,
+		})
+	}
+
+	return slackClient, emailClient
+}
+
+// directoryAuthenticator builds the LDAP authenticator, or returns nil when
+// LDAP sign-in is disabled
+func directoryAuthenticator(cfg config.LDAPConfig) (*ldap.Authenticator, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	return ldap.New(ldap.Config{
+		URL:                cfg.URL,
+		StartTLS:           cfg.StartTLS,
+		InsecureSkipVerify: cfg.TLSSkipVerify,
+		CACertFile:         cfg.CAFile,
+		BindDN:             cfg.BindDN,
+		BindPassword:       cfg.BindPassword,
+		UserDNTemplate:     cfg.UserDNTemplate,
+		SearchBase:         cfg.SearchBase,
+		UserFilter:         cfg.UserFilter,
+		EmailAttribute:     cfg.EmailAttribute,
+		NameAttribute:      cfg.NameAttribute,
+		GroupAttribute:     cfg.GroupAttribute,
+		AdminGroupDN:       cfg.AdminGroupDN,
+		Timeout:            cfg.Timeout,
+	})
+}
+
 // SetupRouter creates and configures the Gin router with all routes
-func SetupRouter(
-	cfg *config.Config,
-	store storage.Storage,
-	userRepo *repository.UserRepository,
-	metadataRepo *repository.MetadataRepository,
-	jwtManager *auth.JWTManager,
-	oktaClient interface{}, // *okta.Client or nil if Okta disabled
-	slackClient *slack.Client, // *slack.Client or nil if Slack disabled
-	emailClient *email.Client, // *email.Client or nil if Email disabled
-) *gin.Engine {
+func SetupRouter(deps Dependencies) (*gin.Engine, error) {
+	if err := deps.validate(); err != nil {
+		return nil, fmt.Errorf("invalid router dependencies: %w", err)
+	}
+
+	cfg := deps.Config
+	store := deps.Storage
+	userRepo := deps.UserStore
+	metadataRepo := deps.MetadataStore
+	jwtManager := deps.JWTManager
+	integrations := deps.Integrations
+	if integrations == nil {
+		slackClient, emailClient := integrationClients(deps)
+		clients := IntegrationClients{Slack: slackClient, Email: emailClient}
+		if cfg.Okta.Enabled {
+			clients.Okta = deps.OktaClient
+		}
+		integrations = NewIntegrations(clients)
+	}
+	reloader := deps.Reloader
+	if reloader == nil {
+		reloader = NewConfigReloader(cfg, config.Load, integrations)
+	}
+	access := accesslog.NewRecorder(deps.AccessLogStore, accesslog.DefaultBufferSize)
+	// Webhooks are admin-supplied URLs, so their client refuses internal
+	// destinations
+	webhookClient, err := cfg.Outbound.WebhookClient()
+	if err != nil {
+		return nil, fmt.Errorf("invalid outbound configuration: %w", err)
+	}
+	// Failed notifications and abuse alerts are counted for the admin digest
+	events := NewEventLog(deps.DigestStore)
+	abuse := NewAbuseDetector(cfg.Abuse, store, metadataRepo, userRepo, integrations, webhookClient, events)
+	digest, err := NewDigestReporter(cfg.Digest, cfg.Message.MaxPendingPerRecipient, deps.DigestStore, userRepo, metadataRepo, integrations)
+	if err != nil {
+		return nil, fmt.Errorf("invalid digest configuration: %w", err)
+	}
+
+	// Message links are sent by the Slack and email integrations and listed
+	// in the inbox
+	var links *urlbuilder.Builder
+	if cfg.Server.FrontendBaseURL != "" || cfg.Slack.Enabled || cfg.Email.Enabled {
+		var err error
+		if links, err = urlbuilder.New(cfg.Server.FrontendBaseURL); err != nil {
+			return nil, fmt.Errorf("invalid frontend base URL: %w", err)
+		}
+	}
+
+	// LDAP sign-in (nil when AUTH_LDAP_ENABLED is off)
+	directory, err := directoryAuthenticator(cfg.LDAP)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP configuration: %w", err)
+	}
+
 	// Create router with no default logging (security requirement)
-	router := SetupGinWithNoLogging()
+	router := SetupGinWithNoLogging(NewPanicAlerter(cfg.Alert, webhookClient))
+	proxies, err := ConfigureTrustedProxies(router, cfg.Server.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	// Cookie sessions need credentialed CORS, which also rules out "*"
+	allowCredentials := cfg.Server.CORSAllowCredentials || cfg.Cookie.Enabled
+	corsMiddleware, err := CORSMiddleware(cfg.Server.AllowedOrigins, allowCredentials)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CORS configuration: %w", err)
+	}
 
 	// Apply middleware
-	router.Use(SecurityHeadersMiddleware())
-	router.Use(CORSMiddleware(cfg.Server.AllowedOrigins))
+	router.Use(RequestIDMiddleware())
+	if tracing.Enabled() {
+		router.Use(TracingMiddleware())
+	}
+	router.Use(RequestLogMiddleware())
+	router.Use(SecurityHeadersMiddleware(cfg.Server.SecurityHeaders, proxies))
+	router.Use(corsMiddleware)
+	router.Use(APIVersionMiddleware())
+
+	// Session cookies for browser clients (nil when AUTH_COOKIE_ENABLED is off)
+	cookies := NewSessionCookies(cfg.Cookie, time.Duration(cfg.JWT.TokenDuration)*time.Hour)
+
+	// Create handlers. Slack creates messages through the same service as
+	// the API, so both apply the same limits
+	message := NewMessageHandler(store, metadataRepo, cfg.Message.MaxPendingPerRecipient, access, abuse, userRepo, deps.TTLPolicyStore)
+	var messageAccess *auth.JWTManager
+	if cfg.Message.ExternalRecipients {
+		message.EnableExternalRecipients(jwtManager, integrations, links)
+		messageAccess = jwtManager
+	}
+	h := &routeHandlers{
+		auth:         NewAuthHandler(userRepo, jwtManager, cookies, directory, message.messages),
+		message:      message,
+		history:      NewHistoryHandler(metadataRepo, store, links),
+		admin:        NewAdminHandler(userRepo, metadataRepo, store, access, cfg, reloader, deps.TTLPolicyStore),
+		profile:      NewProfileHandler(userRepo, metadataRepo, store),
+		notification: NewNotificationHandler(userRepo, metadataRepo, integrations, links, NewNotificationDeduper(cfg.Notify, store), events, deps.TTLPolicyStore),
+		okta:         NewOktaHandler(integrations, userRepo, jwtManager, cookies),
+		slack:        NewSlackHandler(integrations, deps.SlackInstallations, message.messages, userRepo, links, cfg.Slack.StoreKey, events),
+		slackInstall: NewSlackInstallHandler(integrations, store, deps.SlackInstallations),
+		digest:       digest,
+		backup:       NewBackupHandler(deps.BackupStore, cfg.Backup.Passphrase),
+		reloader:     reloader,
+		jwtManager:   jwtManager,
+		userRepo:     userRepo,
+		cookies:      cookies,
+		adminStealth: cfg.Server.AdminStealthMode,
+
+		uploadTimeout:    cfg.Server.Timeouts.Upload,
+		messageBodyLimit: MessageBodyLimit(cfg.Message.MaxMessageBytes),
+		messageAccess:    messageAccess,
+	}
 
-	// Create handlers
-	authHandler := NewAuthHandler(userRepo, jwtManager)
-	messageHandler := NewMessageHandler(store, metadataRepo)
-	historyHandler := NewHistoryHandler(metadataRepo)
-	adminHandler := NewAdminHandler(userRepo, metadataRepo)
-	profileHandler := NewProfileHandler(userRepo)
-	notificationHandler := NewNotificationHandler(userRepo, metadataRepo, emailClient, slackClient)
+	// Periodically expire stale metadata, correct drifted expiries and prune
+	// the access log; store recorded access attempts in batches
+	if deps.Lifecycle != nil {
+		janitor := NewMessageJanitor(metadataRepo, store, deps.AccessLogStore, cfg.Message.AccessLogRetention)
+		deps.Lifecycle.Register(lifecycle.Worker("message-janitor", janitor.Run))
+		deps.Lifecycle.Register(lifecycle.Worker("access-log", access.Run))
+	}
+
+	// Scan Redis for messages without metadata, sharing the admin
+	// endpoint's scanner so the two never run at once
+	if deps.Lifecycle != nil && cfg.Message.OrphanScanInterval > 0 {
+		orphanScan := h.admin.orphans.Run(cfg.Message.OrphanScanInterval, cfg.Message.OrphanScanDelete)
+		deps.Lifecycle.Register(lifecycle.Worker("orphan-scan", orphanScan))
+	}
+
+	// Send notifications held back for scheduled messages once released and
+	// drop expired Okta CSRF states. Both run even while their integrations
+	// are disabled, since a reload can enable them
+	if deps.Lifecycle != nil {
+		deps.Lifecycle.Register(lifecycle.Worker("scheduled-notifications", h.notification.RunScheduled))
+		deps.Lifecycle.Register(lifecycle.Worker("okta-state-cleanup", h.okta.CleanupExpiredStates))
+	}
+
+	// Post the admin digest at the end of every DIGEST_SCHEDULE period
+	if deps.Lifecycle != nil && digest.Enabled() {
+		deps.Lifecycle.Register(lifecycle.Worker("admin-digest", digest.Run))
+	}
+
+	// Record the health history behind the public status page
+	if deps.Lifecycle != nil {
+		sampler := NewStatusSampler(metadataRepo, store)
+		deps.Lifecycle.Register(lifecycle.Worker("status-sampler", sampler.Run))
+	}
 
 	// Health check endpoint (public)
-	router.GET("/health", messageHandler.Health)
+	router.GET("/health", h.message.Health)
 
-	// API routes
-	api := router.Group("/api")
-	{
-		// Public auth endpoints
-		auth := api.Group("/auth")
+	// Coarse service status for recipients (public, cached)
+	router.GET("/api/status", NewStatusHandler(store).GetStatus)
+
+	// Share link interstitial (public); issues the intent token that burning
+	// a message from its link needs, and never burns it
+	router.GET("/m-preview/:id", h.message.LinkPreview)
+
+	// Version discovery (public)
+	router.GET("/api/versions", ListAPIVersions)
+	router.GET("/api/version", GetServerVersion(cfg.Server.MinClientVersion))
+
+	// API contract (public)
+	router.GET("/api/openapi.json", GetOpenAPISpec)
+
+	// Current API version
+	registerAPIRoutes(router.Group(APIVersionPrefix), h)
+
+	// Unversioned aliases kept for older clients; marked deprecated
+	registerAPIRoutes(router.Group(LegacyAPIPrefix, DeprecationMiddleware(APIVersionPrefix)), h)
+
+	// SCIM provisioning for the identity provider, with its own token
+	if cfg.SCIM.Enabled {
+		scimHandler := NewSCIMHandler(userRepo, metadataRepo, store)
+		scim := router.Group("/scim/v2", SCIMAuthMiddleware(cfg.SCIM.Token), BodyLimitMiddleware(DefaultBodyLimit))
 		{
-			auth.POST("/register", authHandler.Register)
-			auth.POST("/login", authHandler.Login)
+			scim.GET("/Users", scimHandler.ListUsers)
+			scim.POST("/Users", scimHandler.CreateUser)
+			scim.GET("/Users/:id", scimHandler.GetUser)
+			scim.PUT("/Users/:id", scimHandler.ReplaceUser)
+			scim.PATCH("/Users/:id", scimHandler.PatchUser)
+			scim.DELETE("/Users/:id", scimHandler.DeleteUser)
 		}
+	}
 
-		// Okta OAuth endpoints (if enabled)
-		if cfg.Okta.Enabled && oktaClient != nil {
-			oktaHandler := NewOktaHandler(oktaClient.(*okta.Client), userRepo, jwtManager)
+	// Web UI for every other path, unless the frontend is served separately
+	if cfg.Server.ServeFrontend {
+		frontend, err := frontendHandler(deps.Frontend)
+		if err != nil {
+			return nil, fmt.Errorf("cannot serve frontend: %w", err)
+		}
+		router.NoRoute(frontend)
+	}
 
-			// Start cleanup goroutine for CSRF states
-			go oktaHandler.CleanupExpiredStates()
+	return router, nil
+}
 
-			auth.GET("/okta/login", oktaHandler.InitiateLogin)
-			auth.GET("/okta/callback", oktaHandler.HandleCallback)
-			auth.POST("/okta/validate", oktaHandler.ValidateOktaToken)
+// frontendHandler serves the web UI from files, or from the embedded build
+// when files is nil. Unknown /api paths stay plain 404s rather than
+// falling back to the app
+func frontendHandler(files fs.FS) (gin.HandlerFunc, error) {
+	if files == nil {
+		var err error
+		if files, err = webui.Embedded(); err != nil {
+			return nil, err
+		}
+	}
+	serve, err := webui.Handler(files)
+	if err != nil {
+		return nil, err
+	}
+	return func(c *gin.Context) {
+		p := c.Request.URL.Path
+		if p == LegacyAPIPrefix || strings.HasPrefix(p, LegacyAPIPrefix+"/") {
+			return
 		}
+		serve(c)
+	}, nil
+}
+
+// routeHandlers holds the handlers shared by every mounted API prefix
+type routeHandlers struct {
+	auth         *AuthHandler
+	message      *MessageHandler
+	history      *HistoryHandler
+	admin        *AdminHandler
+	profile      *ProfileHandler
+	notification *NotificationHandler
+	okta         *OktaHandler  // answers 503 while Okta is disabled
+	slack        *SlackHandler // answers 503 while Slack is disabled
+	slackInstall *SlackInstallHandler
+	digest       *DigestReporter // answers 503 while the digest is not configured
+	backup       *BackupHandler  // answers 503 while backups are not configured
+	reloader     *ConfigReloader
+	jwtManager   *auth.JWTManager
+	userRepo     persistence.UserStore
+	cookies      *SessionCookies // nil unless cookie auth is enabled
+	adminStealth bool            // hide admin routes from non-admins
+
+	uploadTimeout    time.Duration    // read/write deadline for upload routes
+	messageBodyLimit int64            // largest body for creating one message
+	messageAccess    *auth.JWTManager // verifies external recipients' links; nil while they are disabled
+}
 
-		// Protected endpoints (require authentication)
-		protected := api.Group("")
-		protected.Use(AuthMiddleware(jwtManager))
+// registerAPIRoutes mounts all API endpoints on the given prefix group
+func registerAPIRoutes(api *gin.RouterGroup, h *routeHandlers) {
+	// Public auth endpoints
+	authGroup := api.Group("/auth", BodyLimitMiddleware(AuthBodyLimit))
+	{
+		authGroup.POST("/register", h.auth.Register)
+		authGroup.POST("/login", h.auth.Login)
+		authGroup.POST("/logout", h.auth.Logout)
+	}
+
+	// Okta OAuth endpoints
+	authGroup.GET("/okta/login", h.okta.InitiateLogin)
+	authGroup.GET("/okta/callback", h.okta.HandleCallback)
+	authGroup.POST("/okta/validate", h.okta.ValidateOktaToken)
+
+	// Protected endpoints (require authentication)
+	sessionAuth := []gin.HandlerFunc{
+		SessionAuthMiddleware(h.jwtManager, h.cookies, h.userRepo),
+		ActiveUserMiddleware(h.userRepo),
+		CSRFMiddleware(),
+	}
+	protected := api.Group("")
+	protected.Use(sessionAuth...)
+
+	// Burning a message takes a session, or the signed link of an external
+	// recipient in its place
+	read := []gin.HandlerFunc{MessageAccessMiddleware(h.messageAccess)}
+	for _, mw := range append(sessionAuth, RequireCSRF()) {
+		read = append(read, UnlessMessageAccess(mw))
+	}
+	api.GET("/messages/:id", append(read, h.message.GetMessage)...) // burns the message
+	{
+		// User endpoints
+		protected.GET("/auth/me", h.auth.Me)
+		protected.GET("/users", h.auth.ListUsers)
+		protected.GET("/policy", h.message.GetSenderPolicy) // checked by clients before sending
+
+		// Message endpoints (all now require auth)
+		messages := protected.Group("/messages", BodyLimitMiddleware(h.messageBodyLimit))
 		{
-			// User endpoints
-			protected.GET("/auth/me", authHandler.Me)
-			protected.GET("/users", authHandler.ListUsers)
-
-			// Message endpoints (all now require auth)
-			messages := protected.Group("/messages")
-			{
-				messages.POST("", messageHandler.CreateMessage)
-				messages.GET("/:id", messageHandler.GetMessage)
-				messages.HEAD("/:id", messageHandler.CheckMessage)
-			}
-
-			// Notification endpoints
-			notifications := protected.Group("/notifications")
-			{
-				notifications.POST("/send-slack", notificationHandler.SendSlackNotification)
-				notifications.POST("/send-email", notificationHandler.SendEmailNotification)
-			}
-
-			// History endpoints
-			protected.GET("/history", historyHandler.GetMyHistory)
-
-			// User profile management
-			profile := protected.Group("/profile")
-			{
-				profile.PUT("", profileHandler.UpdateProfile)
-				profile.POST("/password", profileHandler.ChangePassword)
-				profile.DELETE("", profileHandler.DeleteAccount)
-			}
-
-			// Admin endpoints (require admin role)
-			admin := protected.Group("/admin")
-			admin.Use(AdminMiddleware(userRepo))
-			{
-				// User management
-				admin.POST("/users", adminHandler.CreateUser)
-				admin.PUT("/users/:id", adminHandler.UpdateUser)
-				admin.DELETE("/users/:id", adminHandler.DeleteUser)
-				admin.POST("/users/import", adminHandler.ImportUsersCSV)
-
-				// System management
-				admin.GET("/statistics", adminHandler.GetStatistics)
-				admin.POST("/cleanup", adminHandler.CleanupExpired)
-			}
+			messages.POST("", h.message.CreateMessage)
+			messages.HEAD("/:id", h.message.CheckMessage)
+			messages.DELETE("/:id", h.message.RevokeMessage)  // sender only
+			messages.POST("/:id/read", h.message.ReadMessage) // burns the message, with a link preview's intent token
+			messages.GET("/:id/status", h.message.GetMessageStatus)
+			messages.GET("/:id/preview", h.message.PreviewMessage)
+			messages.POST("/:id/claim", h.message.ClaimMessage)
+			messages.GET("/:id/access", h.message.ListAccess) // sender only
+			// Sender only; notifies the recipient again over Slack or email
+			messages.POST("/:id/resend-notification", h.notification.ResendNotification)
 		}
+		// Outside the group, whose limit fits one message
+		protected.POST("/messages/bulk", BodyLimitMiddleware(models.MaxBulkMessages*h.messageBodyLimit), h.message.BulkCreateMessages)
 
-		// Slack integration endpoints (public, authenticated by Slack signature)
-		if cfg.Slack.Enabled && slackClient != nil {
-			slackHandler := NewSlackHandler(
-				slackClient,
-				store,
-				metadataRepo,
-				userRepo,
-				cfg.Slack.SigningSecret,
-				cfg.Server.BaseURL,
-			)
-
-			slack := api.Group("/slack")
-			{
-				slack.POST("/command", slackHandler.HandleSlashCommand)
-				slack.POST("/interaction", slackHandler.HandleInteraction)
-			}
+		// Notification endpoints
+		notifications := protected.Group("/notifications", BodyLimitMiddleware(DefaultBodyLimit))
+		{
+			notifications.POST("/send-slack", h.notification.SendSlackNotification)
+			notifications.POST("/send-email", h.notification.SendEmailNotification)
 		}
+
+		// History endpoints
+		protected.GET("/history", h.history.GetMyHistory)
+		protected.GET("/inbox", h.history.GetInbox)
+		protected.POST("/history/expire-pending", BodyLimitMiddleware(DefaultBodyLimit), h.history.ExpirePending)
+
+		// User profile management
+		profile := protected.Group("/profile", BodyLimitMiddleware(DefaultBodyLimit))
+		{
+			profile.PUT("", h.profile.UpdateProfile)
+			profile.POST("/password", h.profile.ChangePassword)
+			profile.PUT("/publickey", h.profile.UpdatePublicKey)
+			profile.DELETE("", h.profile.DeleteAccount)
+			profile.GET("/export", h.profile.ExportData)
+		}
+
+		// Admin endpoints (require admin role)
+		requireAdmin := AdminMiddleware(h.userRepo, h.adminStealth)
+		admin := protected.Group("/admin", requireAdmin, BodyLimitMiddleware(DefaultBodyLimit))
+		{
+			// User management
+			admin.GET("/users", h.admin.ListUsers)
+			admin.POST("/users", h.admin.CreateUser)
+			admin.PUT("/users/:id", h.admin.UpdateUser)
+			admin.GET("/users/by-email/:email", h.admin.GetUserByEmail)
+			admin.PUT("/users/by-email/:email", h.admin.UpsertUserByEmail)
+			admin.DELETE("/users/:id", h.admin.DeleteUser)
+			admin.DELETE("/users/:id/purge", h.admin.PurgeUser)
+			admin.GET("/users/duplicates", h.admin.ListDuplicateAccounts)
+			admin.GET("/users/inactive", h.admin.ListInactiveUsers)
+			admin.POST("/users/inactive/deactivate", h.admin.DeactivateInactiveUsers)
+			admin.POST("/users/:id/merge/:duplicateId", h.admin.MergeUser)
+			admin.GET("/users/export", h.admin.ExportUsersCSV)
+
+			// Service accounts and their API keys
+			admin.POST("/service-accounts", h.admin.CreateServiceAccount)
+			admin.GET("/service-accounts/:id/keys", h.admin.ListAPIKeys)
+			admin.POST("/service-accounts/:id/keys", h.admin.CreateAPIKey)
+			admin.DELETE("/service-accounts/:id/keys/:keyId", h.admin.RevokeAPIKey)
+
+			// System management
+			admin.GET("/statistics", h.admin.GetStatistics)
+			admin.GET("/statistics/timeseries", h.admin.GetTimeSeries)
+			admin.GET("/settings", h.admin.GetSettings)
+			admin.GET("/ttl-policies", h.admin.ListTTLPolicies)
+			admin.POST("/ttl-policies", h.admin.CreateTTLPolicy)
+			admin.PUT("/ttl-policies/:id", h.admin.UpdateTTLPolicy)
+			admin.DELETE("/ttl-policies/:id", h.admin.DeleteTTLPolicy)
+			admin.GET("/category-policies", h.admin.ListCategoryPolicies)
+			admin.GET("/category-policies/:category", h.admin.GetCategoryPolicy)
+			admin.PUT("/category-policies/:category", h.admin.PutCategoryPolicy)
+			admin.DELETE("/category-policies/:category", h.admin.DeleteCategoryPolicy)
+			admin.GET("/banned-domains", h.admin.ListBannedDomains)
+			admin.PUT("/banned-domains/:domain", h.admin.PutBannedDomain)
+			admin.DELETE("/banned-domains/:domain", h.admin.DeleteBannedDomain)
+			admin.GET("/dlp-patterns", h.admin.ListDLPPatterns)
+			admin.PUT("/dlp-patterns/:name", h.admin.PutDLPPattern)
+			admin.DELETE("/dlp-patterns/:name", h.admin.DeleteDLPPattern)
+			admin.POST("/reload", h.reloader.ReloadConfig)
+			admin.POST("/cleanup", h.admin.CleanupExpired)
+			admin.GET("/messages/:id/diagnose", h.admin.DiagnoseMessage)
+			admin.POST("/maintenance/scan-orphans", h.admin.ScanOrphans)
+			admin.POST("/digest/send", h.digest.SendDigest)
+			admin.POST("/backup", h.backup.CreateBackup)
+		}
+		// Outside the group, whose limit is too small for an upload
+		protected.POST("/admin/users/import", requireAdmin, BodyLimitMiddleware(CSVImportBodyLimit), RouteTimeoutMiddleware(h.uploadTimeout), h.admin.ImportUsersCSV)
 	}
 
-	return router
+	// Slack integration endpoints (public, authenticated by Slack signature)
+	slackGroup := api.Group("/slack", BodyLimitMiddleware(maxSlackBodyBytes))
+	{
+		slackGroup.POST("/commands", h.slack.HandleSlashCommand)
+		slackGroup.POST("/interactions", h.slack.HandleInteraction)
+
+		// App installation into workspaces (OAuth v2), opened in a browser
+		slackGroup.GET("/install", h.slackInstall.Install)
+		slackGroup.GET("/oauth/callback", h.slackInstall.HandleCallback)
+
+		// Legacy paths kept for Slack apps configured with the old request URLs
+		slackGroup.POST("/command", h.slack.HandleSlashCommand)
+		slackGroup.POST("/interaction", h.slack.HandleInteraction)
+	}
 }
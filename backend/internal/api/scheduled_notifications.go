@@ -0,0 +1,168 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/lifecycle"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+	"github.com/milkiss/vanish/backend/internal/storage"
+)
+
+const (
+	// dispatchInterval is how often due scheduled notifications are sent
+	dispatchInterval = 30 * time.Second
+	// dispatchBatchSize is how many due notifications are taken per query
+	dispatchBatchSize = 100
+)
+
+// linkedMessage returns the metadata of the message the request links to
+// when it is a message of this sender to this recipient, and nil otherwise.
+// It answers 500 and returns false when the metadata cannot be read
+func (h *NotificationHandler) linkedMessage(c *gin.Context, senderID int64, req *SendNotificationRequest) (*models.MessageMetadata, bool) {
+	id := messageIDFromURL(req.MessageURL)
+	if id == "" {
+		return nil, true
+	}
+
+	metadata, err := h.metadataRepo.FindByMessageID(c.Request.Context(), id)
+	if errors.Is(err, models.ErrMessageNotFound) {
+		return nil, true
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to retrieve message metadata"))
+		return nil, false
+	}
+	if metadata.SenderID != senderID || metadata.RecipientID != req.RecipientID {
+		return nil, true
+	}
+	return metadata, true
+}
+
+// deferNotification holds back a notification about message, found by
+// linkedMessage, until the message is released, answering 202 with the
+// send time. It returns false, leaving the request to be sent now, when
+// message is nil or not scheduled
+func (h *NotificationHandler) deferNotification(c *gin.Context, channel string, metadata *models.MessageMetadata, from string) bool {
+	if metadata == nil || !metadata.Scheduled(time.Now()) {
+		return false
+	}
+
+	ctx := c.Request.Context()
+	err := h.metadataRepo.ScheduleNotification(ctx, &models.ScheduledNotification{
+		MessageID:   metadata.MessageID,
+		Channel:     channel,
+		SenderLabel: from,
+		SendAt:      *metadata.AvailableAt,
+	})
+	if err != nil {
+		requestid.Logger(ctx).Error("failed to schedule notification", "error", err)
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to schedule notification"))
+		return true
+	}
+
+	c.JSON(http.StatusAccepted, models.ScheduledNotificationResponse{ScheduledFor: *metadata.AvailableAt})
+	return true
+}
+
+// messageIDFromURL returns the message ID of a share link
+// ({base}/m/{id}#{key}), or "" when the URL is not one
+func messageIDFromURL(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	i := strings.LastIndex(u.Path, "/m/")
+	if i < 0 {
+		return ""
+	}
+	id := u.Path[i+len("/m/"):]
+	if !storage.ValidID(id) {
+		return ""
+	}
+	return id
+}
+
+// RunScheduled sends due scheduled notifications every thirty seconds
+// until ctx is cancelled; run it as a lifecycle worker
+func (h *NotificationHandler) RunScheduled(ctx context.Context) {
+	lifecycle.Every(dispatchInterval, h.DispatchDue)(ctx)
+}
+
+// DispatchDue sends every scheduled notification whose message has been
+// released. Each is attempted once: failures are logged, not retried, as
+// for notifications sent straight away. While neither Slack nor email is
+// enabled nothing is taken, so a reload enabling one still sends them
+func (h *NotificationHandler) DispatchDue(ctx context.Context) {
+	if clients := h.integrations.Clients(); clients.Slack == nil && clients.Email == nil {
+		return
+	}
+
+	logger := requestid.Logger(ctx)
+	for {
+		due, err := h.metadataRepo.TakeDueNotifications(ctx, time.Now(), dispatchBatchSize)
+		if err != nil {
+			logger.Warn("failed to take due notifications", "error", err)
+			return
+		}
+
+		for _, n := range due {
+			if err := h.dispatch(ctx, n); err != nil {
+				h.events.Record(ctx, models.EventNotificationFailed)
+				logger.Warn("failed to send scheduled notification", "channel", n.Channel, "error", err)
+			}
+		}
+
+		if len(due) < dispatchBatchSize {
+			return
+		}
+	}
+}
+
+// dispatch sends one scheduled notification, rebuilding the link from the
+// stored key and collapsing repeats like notifications sent straight away. Messages read, expired or discarded meanwhile are skipped;
+// sealed messages get a link without key, which the recipient's key opens
+func (h *NotificationHandler) dispatch(ctx context.Context, n *models.ScheduledNotification) error {
+	metadata, err := h.metadataRepo.FindByMessageID(ctx, n.MessageID)
+	if errors.Is(err, models.ErrMessageNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if metadata.Status != models.StatusPending || time.Now().After(metadata.ExpiresAt) {
+		return nil
+	}
+
+	key, err := h.metadataRepo.GetEncryptionKey(ctx, n.MessageID)
+	if err != nil {
+		return err
+	}
+	recipient, err := h.userRepo.FindByID(ctx, metadata.RecipientID)
+	if err != nil {
+		return err
+	}
+	if h.links == nil {
+		return errors.New("frontend base URL is not configured")
+	}
+	link := h.links.MessageURL(n.MessageID, key)
+	style := h.notificationStyle(ctx, metadata)
+
+	clients := h.integrations.Clients()
+	switch {
+	case n.Channel == models.NotificationChannelSlack && clients.Slack != nil:
+		_, err := h.deduper.sendSlack(ctx, clients.Slack, recipient, n.SenderLabel, link, style)
+		return err
+	case n.Channel == models.NotificationChannelEmail && clients.Email != nil:
+		_, err := h.deduper.sendEmail(ctx, clients.Email, recipient, n.SenderLabel, link, style)
+		return err
+	default:
+		return errors.New(n.Channel + " integration is no longer enabled")
+	}
+}
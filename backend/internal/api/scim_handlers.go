@@ -0,0 +1,472 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+	"github.com/milkiss/vanish/backend/internal/storage"
+)
+
+// SCIM list paging limits
+const (
+	scimDefaultCount = 100
+	scimMaxCount     = 500
+)
+
+// scimUserNameFilter matches the one filter supported, `userName eq "..."`,
+// which is what Okta sends to look an account up
+var scimUserNameFilter = regexp.MustCompile(`(?i)^\s*userName\s+eq\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+// SCIMHandler serves a minimal SCIM 2.0 Users endpoint, so an identity
+// provider creates, updates, deactivates and deletes accounts. Accounts
+// are identified by email (userName) and created without a password, to
+// sign in through SSO. Service accounts are not exposed
+type SCIMHandler struct {
+	userRepo     persistence.UserStore
+	metadataRepo persistence.MetadataStore
+	storage      storage.Storage
+}
+
+// NewSCIMHandler creates a new SCIM handler
+func NewSCIMHandler(userRepo persistence.UserStore, metadataRepo persistence.MetadataStore, storage storage.Storage) *SCIMHandler {
+	return &SCIMHandler{userRepo: userRepo, metadataRepo: metadataRepo, storage: storage}
+}
+
+// SCIMAuthMiddleware admits requests bearing the SCIM token. The identity
+// provider is not a user, so no user ID is set
+func SCIMAuthMiddleware(token string) gin.HandlerFunc {
+	// Compare digests so the comparison takes the same time for any length
+	want := sha256.Sum256([]byte(token))
+	return func(c *gin.Context) {
+		scheme, got, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+		sum := sha256.Sum256([]byte(got))
+		if !ok || scheme != "Bearer" || subtle.ConstantTimeCompare(sum[:], want[:]) != 1 {
+			requestid.Logger(c.Request.Context()).Warn("scim request rejected", "client_ip", ClientIP(c))
+			scimError(c, http.StatusUnauthorized, "", "Invalid or missing SCIM token")
+			return
+		}
+		c.Next()
+	}
+}
+
+// ListUsers handles GET /scim/v2/Users
+// Pages through the accounts, or finds one with filter=userName eq "..."
+func (h *SCIMHandler) ListUsers(c *gin.Context) {
+	startIndex, err := scimQueryInt(c, "startIndex", 1)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidValue", "startIndex must be an integer")
+		return
+	}
+	count, err := scimQueryInt(c, "count", scimDefaultCount)
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidValue", "count must be an integer")
+		return
+	}
+	startIndex = max(startIndex, 1)
+	count = min(max(count, 0), scimMaxCount)
+
+	var users []*models.User
+	if filter := c.Query("filter"); filter != "" {
+		m := scimUserNameFilter.FindStringSubmatch(filter)
+		if m == nil {
+			scimError(c, http.StatusBadRequest, "invalidFilter", `Only filter=userName eq "..." is supported`)
+			return
+		}
+		var email string
+		if err := json.Unmarshal([]byte(`"`+m[1]+`"`), &email); err != nil {
+			scimError(c, http.StatusBadRequest, "invalidFilter", "Invalid userName in filter")
+			return
+		}
+		user, ok := h.findByEmail(c, models.NormalizeEmail(email))
+		if !ok {
+			return
+		}
+		if user != nil && scimVisible(user) {
+			users = append(users, user)
+		}
+	} else {
+		if users, err = h.userRepo.ListAccounts(c.Request.Context()); err != nil {
+			scimError(c, http.StatusInternalServerError, "", "Failed to list users")
+			return
+		}
+	}
+
+	page := []models.SCIMUser{}
+	for i := startIndex - 1; i < len(users) && len(page) < count; i++ {
+		page = append(page, scimResource(users[i]))
+	}
+	scimJSON(c, http.StatusOK, models.SCIMListResponse{
+		Schemas:      []string{models.SCIMListResponseSchema},
+		TotalResults: len(users),
+		StartIndex:   startIndex,
+		ItemsPerPage: len(page),
+		Resources:    page,
+	})
+}
+
+// GetUser handles GET /scim/v2/Users/:id
+func (h *SCIMHandler) GetUser(c *gin.Context) {
+	user, ok := h.account(c)
+	if !ok {
+		return
+	}
+	scimJSON(c, http.StatusOK, scimResource(user))
+}
+
+// CreateUser handles POST /scim/v2/Users
+// The account has no password and signs in through SSO. Its name is
+// name.formatted, else displayName, else given and family name, else the email
+func (h *SCIMHandler) CreateUser(c *gin.Context) {
+	var req models.SCIMUser
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+		return
+	}
+	req.UserName = models.NormalizeEmail(req.UserName)
+	if !validEmail(req.UserName) {
+		scimError(c, http.StatusBadRequest, "invalidValue", "userName must be an email address")
+		return
+	}
+
+	existing, ok := h.findByEmail(c, req.UserName)
+	if !ok {
+		return
+	}
+	if existing != nil {
+		scimError(c, http.StatusConflict, "uniqueness", "A user with this userName already exists")
+		return
+	}
+
+	user := &models.User{Email: req.UserName, Name: req.UserName}
+	for _, name := range scimNames(&req) {
+		if name, ok := scimAccountName(name); ok {
+			user.Name = name
+			break
+		}
+	}
+	if err := h.userRepo.Create(c.Request.Context(), user); err != nil {
+		if err == models.ErrUserExists {
+			scimError(c, http.StatusConflict, "uniqueness", "A user with this userName already exists")
+			return
+		}
+		scimError(c, http.StatusInternalServerError, "", "Failed to create user")
+		return
+	}
+	if req.Active != nil && !*req.Active {
+		user.IsActive = false
+		if err := h.userRepo.Update(c.Request.Context(), user); err != nil {
+			scimError(c, http.StatusInternalServerError, "", "Failed to deactivate user")
+			return
+		}
+	}
+
+	requestid.Logger(c.Request.Context()).Info("scim user created", "user_id", user.ID, "active", user.IsActive)
+	scimJSON(c, http.StatusCreated, scimResource(user))
+}
+
+// ReplaceUser handles PUT /scim/v2/Users/:id
+// Sets userName, name and active from the full resource; an omitted
+// active leaves the account as it is
+func (h *SCIMHandler) ReplaceUser(c *gin.Context) {
+	user, ok := h.account(c)
+	if !ok {
+		return
+	}
+
+	var req models.SCIMUser
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "Invalid request body")
+		return
+	}
+
+	changes := scimChanges{email: &req.UserName, active: req.Active}
+	if names := scimNames(&req); len(names) > 0 {
+		changes.name = &names[0]
+	}
+	h.apply(c, user, changes)
+}
+
+// PatchUser handles PATCH /scim/v2/Users/:id
+// Supports add and replace of active, userName, displayName and
+// name.formatted, with or without a path; other attributes are ignored
+func (h *SCIMHandler) PatchUser(c *gin.Context) {
+	user, ok := h.account(c)
+	if !ok {
+		return
+	}
+
+	var req models.SCIMPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "Invalid PatchOp body")
+		return
+	}
+
+	var changes scimChanges
+	for _, op := range req.Operations {
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+		default:
+			scimError(c, http.StatusBadRequest, "invalidValue", fmt.Sprintf("Unsupported operation %q", op.Op))
+			return
+		}
+
+		values := map[string]json.RawMessage{op.Path: op.Value}
+		if op.Path == "" {
+			if err := json.Unmarshal(op.Value, &values); err != nil {
+				scimError(c, http.StatusBadRequest, "invalidValue", "A PatchOp without a path needs an object value")
+				return
+			}
+		}
+		for attr, value := range values {
+			if err := changes.set(attr, value); err != nil {
+				scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+				return
+			}
+		}
+	}
+	if changes.name == nil {
+		changes.name = changes.displayName
+	}
+	h.apply(c, user, changes)
+}
+
+// DeleteUser handles DELETE /scim/v2/Users/:id
+// Deletes the account like DELETE /api/admin/users/:id: it is anonymized
+// and its open messages expired. Okta deactivates rather than deletes, by
+// setting active to false, which can be undone
+func (h *SCIMHandler) DeleteUser(c *gin.Context) {
+	user, ok := h.account(c)
+	if !ok {
+		return
+	}
+
+	if err := anonymizeAccount(c.Request.Context(), h.userRepo, h.metadataRepo, h.storage, user.ID); err != nil {
+		scimError(c, http.StatusInternalServerError, "", "Failed to delete user")
+		return
+	}
+
+	requestid.Logger(c.Request.Context()).Info("scim user deleted", "user_id", user.ID)
+	c.Status(http.StatusNoContent)
+}
+
+// scimChanges are the account attributes a PUT or PATCH sets; nil leaves
+// an attribute unchanged
+type scimChanges struct {
+	email       *string
+	name        *string // name.formatted
+	displayName *string // used when name.formatted is not set
+	active      *bool
+}
+
+// set records one patched attribute. Attribute names are case-insensitive
+func (ch *scimChanges) set(attr string, value json.RawMessage) error {
+	switch strings.ToLower(attr) {
+	case "active":
+		active, err := scimBool(value)
+		if err != nil {
+			return errors.New("active must be a boolean")
+		}
+		ch.active = &active
+	case "username":
+		return scimString(value, "userName", &ch.email)
+	case "name.formatted":
+		return scimString(value, "name.formatted", &ch.name)
+	case "displayname":
+		return scimString(value, "displayName", &ch.displayName)
+	case "name":
+		var name models.SCIMName
+		if err := json.Unmarshal(value, &name); err != nil {
+			return errors.New("name must be an object")
+		}
+		if name.Formatted != "" {
+			ch.name = &name.Formatted
+		}
+	}
+	return nil
+}
+
+// apply updates user with changes and writes the resulting resource
+func (h *SCIMHandler) apply(c *gin.Context, user *models.User, changes scimChanges) {
+	updated := *user
+
+	if changes.email != nil && models.NormalizeEmail(*changes.email) != user.Email {
+		email := models.NormalizeEmail(*changes.email)
+		if !validEmail(email) {
+			scimError(c, http.StatusBadRequest, "invalidValue", "userName must be an email address")
+			return
+		}
+		existing, ok := h.findByEmail(c, email)
+		if !ok {
+			return
+		}
+		if existing != nil && existing.ID != user.ID {
+			scimError(c, http.StatusConflict, "uniqueness", "A user with this userName already exists")
+			return
+		}
+		updated.Email = email
+	}
+	if changes.name != nil {
+		name, ok := scimAccountName(*changes.name)
+		if !ok {
+			scimError(c, http.StatusBadRequest, "invalidValue", "name must be 2 to 100 characters")
+			return
+		}
+		updated.Name = name
+	}
+	if changes.active != nil {
+		updated.IsActive = *changes.active
+	}
+
+	if updated != *user {
+		if err := h.userRepo.Update(c.Request.Context(), &updated); err != nil {
+			scimError(c, http.StatusInternalServerError, "", "Failed to update user")
+			return
+		}
+		requestid.Logger(c.Request.Context()).Info("scim user updated", "user_id", updated.ID, "active", updated.IsActive)
+	}
+	scimJSON(c, http.StatusOK, scimResource(&updated))
+}
+
+// account loads the account named by the :id parameter. Unknown IDs,
+// service accounts and tombstones are all not found. It writes the error
+// response itself and reports whether to continue
+func (h *SCIMHandler) account(c *gin.Context) (*models.User, bool) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		scimError(c, http.StatusNotFound, "", "User not found")
+		return nil, false
+	}
+	user, err := h.userRepo.FindByID(c.Request.Context(), id)
+	if err != nil || !scimVisible(user) {
+		scimError(c, http.StatusNotFound, "", "User not found")
+		return nil, false
+	}
+	return user, true
+}
+
+// findByEmail looks up an account of any kind by email, returning nil when
+// there is none. It writes the error response itself and reports whether
+// to continue
+func (h *SCIMHandler) findByEmail(c *gin.Context, email string) (*models.User, bool) {
+	user, err := h.userRepo.FindByEmail(c.Request.Context(), email)
+	if errors.Is(err, models.ErrInvalidCredentials) {
+		return nil, true
+	}
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", "Failed to look up user")
+		return nil, false
+	}
+	return user, true
+}
+
+// scimVisible reports whether user is exposed over SCIM
+func scimVisible(user *models.User) bool {
+	return !user.IsService && !user.IsAnonymized()
+}
+
+// scimResource converts a User to its SCIM representation
+func scimResource(user *models.User) models.SCIMUser {
+	active := user.IsActive
+	return models.SCIMUser{
+		Schemas:     []string{models.SCIMUserSchema},
+		ID:          strconv.FormatInt(user.ID, 10),
+		UserName:    user.Email,
+		Name:        &models.SCIMName{Formatted: user.Name},
+		DisplayName: user.Name,
+		Emails:      []models.SCIMEmail{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta: &models.SCIMMeta{
+			ResourceType: "User",
+			Created:      user.CreatedAt,
+			LastModified: user.UpdatedAt,
+		},
+	}
+}
+
+// scimNames lists the candidate names of a SCIM user, most preferred first
+func scimNames(u *models.SCIMUser) []string {
+	var names []string
+	if u.Name != nil && u.Name.Formatted != "" {
+		names = append(names, u.Name.Formatted)
+	}
+	if u.DisplayName != "" {
+		names = append(names, u.DisplayName)
+	}
+	if u.Name != nil {
+		if full := strings.TrimSpace(u.Name.GivenName + " " + u.Name.FamilyName); full != "" {
+			names = append(names, full)
+		}
+	}
+	return names
+}
+
+// scimAccountName fits name to the 2 to 100 characters of an account name,
+// cutting longer names. It reports false for names that are too short
+func scimAccountName(name string) (string, bool) {
+	runes := []rune(strings.TrimSpace(name))
+	if len(runes) > 100 {
+		runes = []rune(strings.TrimSpace(string(runes[:100])))
+	}
+	return string(runes), len(runes) >= 2
+}
+
+// scimBool decodes a boolean, also accepting "true" and "false" strings as
+// some identity providers send them
+func scimBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return false, err
+	}
+	return strconv.ParseBool(strings.ToLower(s))
+}
+
+// scimString decodes a string attribute into *dst
+func scimString(value json.RawMessage, attr string, dst **string) error {
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return fmt.Errorf("%s must be a string", attr)
+	}
+	*dst = &s
+	return nil
+}
+
+// scimQueryInt parses an optional integer query parameter
+func scimQueryInt(c *gin.Context, key string, fallback int) (int, error) {
+	raw := c.Query(key)
+	if raw == "" {
+		return fallback, nil
+	}
+	return strconv.Atoi(raw)
+}
+
+// scimJSON writes body with the SCIM media type
+func scimJSON(c *gin.Context, status int, body interface{}) {
+	c.Header("Content-Type", models.SCIMContentType+"; charset=utf-8")
+	c.JSON(status, body)
+}
+
+// scimError writes a SCIM error response and aborts the request
+func scimError(c *gin.Context, status int, scimType, detail string) {
+	scimJSON(c, status, models.SCIMError{
+		Schemas:  []string{models.SCIMErrorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+	c.Abort()
+}
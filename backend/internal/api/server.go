@@ -0,0 +1,40 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/config"
+)
+
+// NewServer creates the HTTP server for handler with the configured timeouts
+// ReadHeaderTimeout reaps connections that stall before sending a request;
+// Read/Write bound every request unless a route extends them
+func NewServer(cfg config.ServerConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              cfg.Host + ":" + cfg.Port,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.Timeouts.ReadHeader,
+		ReadTimeout:       cfg.Timeouts.Read,
+		WriteTimeout:      cfg.Timeouts.Write,
+		IdleTimeout:       cfg.Timeouts.Idle,
+		MaxHeaderBytes:    1 << 20, // 1 MB
+	}
+}
+
+// RouteTimeoutMiddleware replaces the server-wide read and write deadlines
+// for one route, e.g. to give uploads on slow links more time
+// A zero duration leaves the server defaults in place
+func RouteTimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if timeout > 0 {
+			deadline := time.Now().Add(timeout)
+			rc := http.NewResponseController(c.Writer)
+			// Not supported by test recorders; the server defaults then apply
+			_ = rc.SetReadDeadline(deadline)
+			_ = rc.SetWriteDeadline(deadline)
+		}
+		c.Next()
+	}
+}
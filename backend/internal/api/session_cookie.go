@@ -0,0 +1,130 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/models"
+)
+
+const (
+	// CSRFCookieName holds the double-submit token; readable by scripts
+	CSRFCookieName = "vanish_csrf"
+	// CSRFHeader must echo the CSRF cookie on cookie-authenticated requests
+	CSRFHeader = "X-CSRF-Token"
+
+	// authMethodCookie marks requests authenticated by the session cookie
+	authMethodCookie = "cookie"
+	// authMethodAPIKey marks requests authenticated by a service account's API key
+	authMethodAPIKey = "api_key"
+)
+
+// SessionCookies issues and clears the session and CSRF cookies used by
+// browser clients. A nil *SessionCookies means cookie auth is disabled and
+// every method is a no-op.
+type SessionCookies struct {
+	cfg    config.AuthCookieConfig
+	maxAge int
+}
+
+// NewSessionCookies returns nil unless cookie auth is enabled
+// Cookies live as long as the JWT they carry
+func NewSessionCookies(cfg config.AuthCookieConfig, tokenDuration time.Duration) *SessionCookies {
+	if !cfg.Enabled {
+		return nil
+	}
+	return &SessionCookies{cfg: cfg, maxAge: int(tokenDuration.Seconds())}
+}
+
+// Set stores token in an HttpOnly session cookie and issues a fresh CSRF token
+func (s *SessionCookies) Set(c *gin.Context, token string) error {
+	if s == nil {
+		return nil
+	}
+
+	csrf := make([]byte, 32)
+	if _, err := rand.Read(csrf); err != nil {
+		return fmt.Errorf("failed to generate CSRF token: %w", err)
+	}
+
+	http.SetCookie(c.Writer, s.cookie(s.cfg.Name, token, s.maxAge, true))
+	http.SetCookie(c.Writer, s.cookie(CSRFCookieName, base64.RawURLEncoding.EncodeToString(csrf), s.maxAge, false))
+	return nil
+}
+
+// Clear expires both cookies
+func (s *SessionCookies) Clear(c *gin.Context) {
+	if s == nil {
+		return
+	}
+	http.SetCookie(c.Writer, s.cookie(s.cfg.Name, "", -1, true))
+	http.SetCookie(c.Writer, s.cookie(CSRFCookieName, "", -1, false))
+}
+
+// token returns the JWT from the session cookie, if any
+func (s *SessionCookies) token(c *gin.Context) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	token, err := c.Cookie(s.cfg.Name)
+	if err != nil || token == "" {
+		return "", false
+	}
+	return token, true
+}
+
+func (s *SessionCookies) cookie(name, value string, maxAge int, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   s.cfg.Domain,
+		MaxAge:   maxAge,
+		Secure:   s.cfg.Secure,
+		HttpOnly: httpOnly,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// CSRFMiddleware enforces double-submit CSRF protection on state-changing
+// requests authenticated by the session cookie. Bearer-token requests are
+// not sent automatically by browsers and are left alone.
+func CSRFMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		requireCSRF(c)
+	}
+}
+
+// RequireCSRF applies the CSRF check regardless of method, for safe-looking
+// routes with side effects (e.g. GET /messages/:id burns the message)
+func RequireCSRF() gin.HandlerFunc {
+	return requireCSRF
+}
+
+func requireCSRF(c *gin.Context) {
+	if c.GetString("auth_method") != authMethodCookie {
+		c.Next()
+		return
+	}
+
+	cookie, err := c.Cookie(CSRFCookieName)
+	header := c.GetHeader(CSRFHeader)
+	if err != nil || cookie == "" || subtle.ConstantTimeCompare([]byte(cookie), []byte(header)) != 1 {
+		c.JSON(http.StatusForbidden, errorResponse(c, models.ErrorCodeCSRFFailed, "Missing or invalid CSRF token"))
+		c.Abort()
+		return
+	}
+
+	c.Next()
+}
@@ -1,54 +1,91 @@
 package api
 
 import (
+	"bytes"
 	"context"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/mail"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/milkiss/vanish/backend/internal/integrations/slack"
+	"github.com/milkiss/vanish/backend/internal/messages"
 	"github.com/milkiss/vanish/backend/internal/models"
-	"github.com/milkiss/vanish/backend/internal/repository"
-	"github.com/milkiss/vanish/backend/internal/storage"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+	"github.com/milkiss/vanish/backend/internal/urlbuilder"
+	"github.com/zafrem/vanish/shared/crypto"
 )
 
 // SlackHandler handles Slack slash commands and interactions
 type SlackHandler struct {
-	slackClient  *slack.Client
-	storage      storage.Storage
-	metadataRepo *repository.MetadataRepository
-	userRepo     *repository.UserRepository
-	signingSecret string
-	baseURL      string
+	integrations  *Integrations                      // the Slack client also carries the signing secret
+	installations persistence.SlackInstallationStore // bot tokens of installed workspaces; nil uses the default client for all
+	messages      *messages.Service
+	userRepo      persistence.UserStore
+	links         *urlbuilder.Builder
+	storeKey      bool      // false: the key only travels in the recipient's DM and is then discarded
+	events        *EventLog // counts failed notifications for the admin digest; nil counts none
 }
 
 // NewSlackHandler creates a new Slack handler
 func NewSlackHandler(
-	slackClient *slack.Client,
-	storage storage.Storage,
-	metadataRepo *repository.MetadataRepository,
-	userRepo *repository.UserRepository,
-	signingSecret string,
-	baseURL string,
+	integrations *Integrations,
+	installations persistence.SlackInstallationStore,
+	messages *messages.Service,
+	userRepo persistence.UserStore,
+	links *urlbuilder.Builder,
+	storeKey bool,
+	events *EventLog,
 ) *SlackHandler {
 	return &SlackHandler{
-		slackClient:  slackClient,
-		storage:      storage,
-		metadataRepo: metadataRepo,
-		userRepo:     userRepo,
-		signingSecret: signingSecret,
-		baseURL:      baseURL,
+		integrations:  integrations,
+		installations: installations,
+		messages:      messages,
+		userRepo:      userRepo,
+		links:         links,
+		storeKey:      storeKey,
+		events:        events,
 	}
 }
 
+// workspaceClient returns the client for the workspace a request came
+// from, calling Slack with the bot token stored when the app was installed
+// there. Workspaces without an installation use the default client and its
+// SLACK_BOT_TOKEN. When neither has a token it answers the request and
+// returns nil
+func (h *SlackHandler) workspaceClient(c *gin.Context, defaultClient *slack.Client, teamID string) *slack.Client {
+	if h.installations == nil || teamID == "" {
+		return defaultClient
+	}
+
+	installation, err := h.installations.FindSlackInstallation(c.Request.Context(), teamID)
+	switch {
+	case err == nil:
+		return defaultClient.WithBotToken(installation.BotToken)
+	case !errors.Is(err, models.ErrSlackNotInstalled):
+		requestid.Logger(c.Request.Context()).Error("failed to look up Slack installation", "team_id", teamID, "error", err)
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to look up the Slack workspace"))
+		return nil
+	case defaultClient.HasBotToken():
+		return defaultClient
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"response_type": "ephemeral",
+		"text":          "Vanish is not installed in this workspace. Ask a workspace admin to install the app.",
+	})
+	return nil
+}
+
 // SlashCommandPayload represents the payload from Slack slash command
 type SlashCommandPayload struct {
 	Token       string `form:"token"`
@@ -66,12 +103,13 @@ type SlashCommandPayload struct {
 
 // InteractionPayload represents a Slack interaction payload
 type InteractionPayload struct {
-	Type        string                 `json:"type"`
-	User        InteractionUser        `json:"user"`
-	TriggerID   string                 `json:"trigger_id"`
-	Team        InteractionTeam        `json:"team"`
-	View        *InteractionView       `json:"view,omitempty"`
-	ResponseURL string                 `json:"response_url,omitempty"`
+	Type        string              `json:"type"`
+	User        InteractionUser     `json:"user"`
+	TriggerID   string              `json:"trigger_id"`
+	Team        InteractionTeam     `json:"team"`
+	View        *InteractionView    `json:"view,omitempty"`
+	ResponseURL string              `json:"response_url,omitempty"`
+	Actions     []InteractionAction `json:"actions,omitempty"` // set for block_actions
 }
 
 type InteractionUser struct {
@@ -86,21 +124,31 @@ type InteractionTeam struct {
 }
 
 type InteractionView struct {
-	ID            string                 `json:"id"`
-	Type          string                 `json:"type"`
-	State         InteractionViewState   `json:"state"`
+	ID              string               `json:"id"`
+	Hash            string               `json:"hash,omitempty"`
+	Type            string               `json:"type"`
+	State           InteractionViewState `json:"state"`
 	PrivateMetadata string               `json:"private_metadata"`
 }
 
+// InteractionAction is an element the user changed in a block_actions
+// interaction
+type InteractionAction struct {
+	ActionID       string             `json:"action_id"`
+	BlockID        string             `json:"block_id"`
+	Type           string             `json:"type"`
+	SelectedOption *InteractionOption `json:"selected_option,omitempty"`
+}
+
 type InteractionViewState struct {
 	Values map[string]map[string]InteractionValue `json:"values"`
 }
 
 type InteractionValue struct {
-	Type           string                  `json:"type"`
-	Value          string                  `json:"value,omitempty"`
-	SelectedUser   string                  `json:"selected_user,omitempty"`
-	SelectedOption *InteractionOption      `json:"selected_option,omitempty"`
+	Type           string             `json:"type"`
+	Value          string             `json:"value,omitempty"`
+	SelectedUser   string             `json:"selected_user,omitempty"`
+	SelectedOption *InteractionOption `json:"selected_option,omitempty"`
 }
 
 type InteractionOption struct {
@@ -116,25 +164,35 @@ type InteractionText struct {
 
 // HandleSlashCommand handles the /vanishPW slash command
 func (h *SlackHandler) HandleSlashCommand(c *gin.Context) {
-	// Verify Slack request signature
-	if !h.verifySlackRequest(c) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+	slackClient := h.integrations.Slack()
+	if slackClient == nil {
+		c.JSON(http.StatusServiceUnavailable, errorResponse(c, models.ErrorCodeIntegrationDisabled, "Slack integration not enabled"))
+		return
+	}
+
+	// Verify Slack request signature before anything parses the body
+	form, err := verifiedForm(c, slackClient)
+	if err != nil {
+		rejectSlackRequest(c, err)
 		return
 	}
 
 	var payload SlashCommandPayload
-	if err := c.ShouldBind(&payload); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+	if err := binding.MapFormWithTag(&payload, form, "form"); err != nil {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Invalid payload"))
+		return
+	}
+	if slackClient = h.workspaceClient(c, slackClient, payload.TeamID); slackClient == nil {
 		return
 	}
 
 	// Open modal for password input
-	modal := h.buildPasswordModal()
+	modal := h.passwordModal(c.Request.Context(), "")
 
-	if err := h.slackClient.OpenModal(c.Request.Context(), payload.TriggerID, modal); err != nil {
+	if err := slackClient.OpenModal(c.Request.Context(), payload.TriggerID, modal); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"response_type": "ephemeral",
-			"text": fmt.Sprintf("Failed to open modal: %v", err),
+			"text":          fmt.Sprintf("Failed to open modal: %v", err),
 		})
 		return
 	}
@@ -143,68 +201,114 @@ func (h *SlackHandler) HandleSlashCommand(c *gin.Context) {
 	c.Status(http.StatusOK)
 }
 
-// HandleInteraction handles Slack interactive components (modal submissions)
+// HandleInteraction handles Slack interactive components: modal submissions
+// and the category select, which narrows the expiration times of the modal
 func (h *SlackHandler) HandleInteraction(c *gin.Context) {
-	// Verify Slack request signature
-	if !h.verifySlackRequest(c) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+	slackClient := h.integrations.Slack()
+	if slackClient == nil {
+		c.JSON(http.StatusServiceUnavailable, errorResponse(c, models.ErrorCodeIntegrationDisabled, "Slack integration not enabled"))
+		return
+	}
+
+	// Verify Slack request signature before anything parses the body
+	form, err := verifiedForm(c, slackClient)
+	if err != nil {
+		rejectSlackRequest(c, err)
 		return
 	}
 
 	// Parse the payload from form data
-	payloadStr := c.PostForm("payload")
+	payloadStr := form.Get("payload")
 	if payloadStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing payload"})
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Missing payload"))
 		return
 	}
 
 	var payload InteractionPayload
 	if err := json.Unmarshal([]byte(payloadStr), &payload); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid payload"})
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Invalid payload"))
 		return
 	}
 
 	// Handle view submission (modal submit)
 	if payload.Type == "view_submission" && payload.View != nil {
-		h.handleModalSubmission(c, &payload)
+		if slackClient = h.workspaceClient(c, slackClient, payload.Team.ID); slackClient == nil {
+			return
+		}
+		h.handleModalSubmission(c, slackClient, &payload)
+		return
+	}
+
+	// Handle a category picked in the open modal
+	if payload.Type == "block_actions" && payload.View != nil {
+		if slackClient = h.workspaceClient(c, slackClient, payload.Team.ID); slackClient == nil {
+			return
+		}
+		h.handleCategoryChange(c, slackClient, &payload)
 		return
 	}
 
 	c.Status(http.StatusOK)
 }
 
-// handleModalSubmission processes the modal submission
-func (h *SlackHandler) handleModalSubmission(c *gin.Context, payload *InteractionPayload) {
+// handleCategoryChange rebuilds the modal for the category picked, offering
+// only the expiration times its policy allows. Slack only needs the
+// acknowledgement, so failures are logged
+func (h *SlackHandler) handleCategoryChange(c *gin.Context, slackClient *slack.Client, payload *InteractionPayload) {
 	ctx := c.Request.Context()
+	for _, action := range payload.Actions {
+		if action.ActionID != categoryInput {
+			continue
+		}
+		category := ""
+		if action.SelectedOption != nil && action.SelectedOption.Value != noCategory {
+			category = action.SelectedOption.Value
+		}
+		if err := slackClient.UpdateView(ctx, payload.View.ID, payload.View.Hash, h.passwordModal(ctx, category)); err != nil {
+			requestid.Logger(ctx).Warn("failed to update Slack modal", "error", err)
+		}
+	}
+	c.Status(http.StatusOK)
+}
 
-	// Extract values from modal
-	values := payload.View.State.Values
+// handleModalSubmission processes the modal submission
+func (h *SlackHandler) handleModalSubmission(c *gin.Context, slackClient *slack.Client, payload *InteractionPayload) {
+	ctx := c.Request.Context()
 
-	recipientEmail := values["recipient_block"]["recipient_input"].Value
-	password := values["password_block"]["password_input"].Value
-	ttlStr := values["ttl_block"]["ttl_input"].SelectedOption.Value
+	// Extract and validate values from modal
+	submission, fieldErrors := parseModalSubmission(payload.View.State.Values)
+	if len(fieldErrors) > 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"response_action": "errors",
+			"errors":          fieldErrors,
+		})
+		return
+	}
+	recipientEmail := submission.recipientEmail
+	password := submission.secret
 
-	// Parse TTL
-	ttlSeconds, err := strconv.ParseInt(ttlStr, 10, 64)
+	// The modal only offers TTLs the category allows, but the policy may
+	// have changed since it was opened
+	policy, err := h.messages.CategoryPolicy(ctx, submission.category)
 	if err != nil {
-		ttlSeconds = models.DefaultTTL
+		sendEphemeralError(ctx, slackClient, payload.User.ID, serviceError(err).Message)
+		c.Status(http.StatusOK)
+		return
 	}
-
-	// Validate TTL
-	if ttlSeconds < models.MinTTL || ttlSeconds > models.MaxTTL {
+	if submission.ttlSeconds != nil && !policy.AllowsTTL(*submission.ttlSeconds) {
 		c.JSON(http.StatusOK, gin.H{
 			"response_action": "errors",
-			"errors": gin.H{
-				"ttl_block": "Invalid expiration time",
+			"errors": map[string]string{
+				ttlBlockID(submission.category): fmt.Sprintf("The %s category allows at most %s", submission.category, ttlLabel(policy.MaxTTL)),
 			},
 		})
 		return
 	}
 
 	// Get sender's Slack user info to find their email
-	senderInfo, err := h.slackClient.GetUserInfo(ctx, payload.User.ID)
+	senderInfo, err := slackClient.GetUserInfo(ctx, payload.User.ID)
 	if err != nil {
-		h.sendEphemeralError(ctx, payload.User.ID, "Failed to get your user information")
+		sendEphemeralError(ctx, slackClient, payload.User.ID, "Failed to get your user information")
 		c.Status(http.StatusOK)
 		return
 	}
@@ -212,7 +316,7 @@ func (h *SlackHandler) handleModalSubmission(c *gin.Context, payload *Interactio
 	// Find sender in database by email
 	sender, err := h.userRepo.FindByEmail(ctx, senderInfo.Email)
 	if err != nil {
-		h.sendEphemeralError(ctx, payload.User.ID, "You must be registered in Vanish to send messages. Please register at "+h.baseURL)
+		sendEphemeralError(ctx, slackClient, payload.User.ID, "You must be registered in Vanish to send messages. Please register at "+h.links.Base())
 		c.Status(http.StatusOK)
 		return
 	}
@@ -220,62 +324,49 @@ func (h *SlackHandler) handleModalSubmission(c *gin.Context, payload *Interactio
 	// Find recipient in database
 	recipient, err := h.userRepo.FindByEmail(ctx, recipientEmail)
 	if err != nil {
-		h.sendEphemeralError(ctx, payload.User.ID, "Recipient not found. They must be registered in Vanish first.")
+		sendEphemeralError(ctx, slackClient, payload.User.ID, "Recipient not found. They must be registered in Vanish first.")
 		c.Status(http.StatusOK)
 		return
 	}
 
-	// Encrypt the password using server-side encryption (similar to client-side AES-256-GCM)
-	encryptedMsg, err := encryptMessage(password)
+	// Encrypt the password server-side with the same AES-256-GCM scheme as
+	// the web client and the CLI
+	encryptedMsg, err := crypto.EncryptMessage(password)
 	if err != nil {
-		h.sendEphemeralError(ctx, payload.User.ID, "Failed to encrypt message")
+		sendEphemeralError(ctx, slackClient, payload.User.ID, "Failed to encrypt message")
 		c.Status(http.StatusOK)
 		return
 	}
 
-	// Create message object
-	msg := &models.Message{
-		Ciphertext: encryptedMsg.Ciphertext,
-		IV:         encryptedMsg.IV,
-		CreatedAt:  time.Now().UTC(),
-	}
-
-	// Store encrypted message in Redis with TTL
-	id, err := h.storage.Store(ctx, msg, time.Duration(ttlSeconds)*time.Second)
-	if err != nil {
-		h.sendEphemeralError(ctx, payload.User.ID, "Failed to store message")
-		c.Status(http.StatusOK)
-		return
+	// Without storeKey the key is never persisted: only the recipient's DM
+	// carries it, so the operator cannot decrypt the message afterwards
+	secretURL := ""
+	opts := messages.CreateOptions{
+		Integration: models.IntegrationSlack,
+		CreatedVia:  models.ClientSlack,
+		Category:    submission.category,
+		Notify: func(ctx context.Context, metadata *models.MessageMetadata) error {
+			// Send DM to recipient with the URL, worded for the category
+			secretURL = h.links.MessageURL(metadata.MessageID, encryptedMsg.Key)
+			from := models.SenderLabel(sender.Name, metadata.SenderType, metadata.IntegrationName)
+			return slackClient.SendSecretNotification(ctx, recipient.Email, from, secretURL, metadata.CategoryPolicy.Style())
+		},
 	}
-
-	// Calculate expiration time
-	expiresAt := msg.CreatedAt.Add(time.Duration(ttlSeconds) * time.Second)
-
-	// Store metadata in PostgreSQL
-	metadata := &models.MessageMetadata{
-		MessageID:     id,
-		SenderID:      sender.ID,
-		RecipientID:   recipient.ID,
-		EncryptionKey: encryptedMsg.Key,
-		Status:        models.StatusPending,
-		CreatedAt:     msg.CreatedAt,
-		ExpiresAt:     expiresAt,
+	if h.storeKey {
+		opts.EncryptionKey = encryptedMsg.Key
 	}
 
-	if err := h.metadataRepo.Create(ctx, metadata); err != nil {
-		h.sendEphemeralError(ctx, payload.User.ID, "Failed to store message metadata")
+	content := messages.Payload{Ciphertext: encryptedMsg.Ciphertext, IV: encryptedMsg.IV}
+	metadata, err := h.messages.CreateEncrypted(ctx, sender.ID, recipient.ID, content, submission.ttlSeconds, opts)
+	if errors.Is(err, messages.ErrNotifyFailed) {
+		// The message is kept - sender can still share URL manually
+		h.events.Record(ctx, models.EventNotificationFailed)
+		sendEphemeralError(ctx, slackClient, payload.User.ID, fmt.Sprintf("Message created but failed to notify recipient via Slack. Share this URL manually: %s", secretURL))
 		c.Status(http.StatusOK)
 		return
 	}
-
-	// Build the shareable URL with encryption key
-	secretURL := fmt.Sprintf("%s/m/%s#%s", h.baseURL, id, encryptedMsg.Key)
-
-	// Send DM to recipient with the URL
-	err = h.slackClient.SendSecretNotification(ctx, recipient.Email, sender.Name, secretURL)
 	if err != nil {
-		// Log error but don't fail - sender can still share URL manually
-		h.sendEphemeralError(ctx, payload.User.ID, fmt.Sprintf("Message created but failed to notify recipient via Slack. Share this URL manually: %s", secretURL))
+		sendEphemeralError(ctx, slackClient, payload.User.ID, serviceError(err).Message)
 		c.Status(http.StatusOK)
 		return
 	}
@@ -284,18 +375,215 @@ func (h *SlackHandler) handleModalSubmission(c *gin.Context, payload *Interactio
 	confirmMsg := fmt.Sprintf("✅ Secure message sent to %s (%s)\n\nThey will receive a notification in Slack with a one-time access link.\n\nExpires: %s",
 		recipient.Name,
 		recipient.Email,
-		expiresAt.Format(time.RFC1123),
+		metadata.ExpiresAt.Format(time.RFC1123),
 	)
-	h.slackClient.SendEphemeralMessage(ctx, payload.User.ID, confirmMsg)
+	slackClient.SendEphemeralMessage(ctx, payload.User.ID, confirmMsg)
 
 	// Return success (closes modal)
 	c.Status(http.StatusOK)
 }
 
-// buildPasswordModal creates the modal view for password input
-func (h *SlackHandler) buildPasswordModal() map[string]interface{} {
+// Block IDs of the password modal, used as keys for field-level errors
+const (
+	recipientBlock = "recipient_block"
+	passwordBlock  = "password_block"
+	categoryBlock  = "category_block"
+	ttlBlock       = "ttl_block"
+)
+
+const (
+	// categoryInput is the action ID of the category select; picking a
+	// category sends a block_actions interaction
+	categoryInput = "category_input"
+	// noCategory is the value of the category option for none
+	noCategory = "none"
+	// maxCategoryOptions keeps the category select within Slack's limit of
+	// 100 options, the one for none included
+	maxCategoryOptions = 99
+)
+
+// modalSubmission holds the validated fields of the password modal
+type modalSubmission struct {
+	recipientEmail string
+	secret         string
+	category       string // empty for none
+	ttlSeconds     *int64 // nil when no TTL was picked
+}
+
+// parseModalSubmission extracts the modal fields without assuming any block
+// is present. Problems are returned keyed by block ID, ready for Slack's
+// response_action=errors; a missing TTL selection falls back to the default.
+func parseModalSubmission(values map[string]map[string]InteractionValue) (modalSubmission, map[string]string) {
+	fieldErrors := make(map[string]string)
+	submission := modalSubmission{}
+
+	recipient, _ := modalValue(values, recipientBlock, "recipient_input")
+	submission.recipientEmail = strings.TrimSpace(recipient.Value)
+	switch {
+	case submission.recipientEmail == "":
+		fieldErrors[recipientBlock] = "Recipient email is required"
+	case !validEmail(submission.recipientEmail):
+		fieldErrors[recipientBlock] = "Enter a valid email address"
+	}
+
+	secret, _ := modalValue(values, passwordBlock, "password_input")
+	submission.secret = secret.Value
+	if strings.TrimSpace(submission.secret) == "" {
+		fieldErrors[passwordBlock] = "Secret message is required"
+	}
+
+	if category, ok := modalValue(values, categoryBlock, categoryInput); ok && category.SelectedOption != nil &&
+		category.SelectedOption.Value != noCategory {
+		if models.ValidCategory(category.SelectedOption.Value) {
+			submission.category = category.SelectedOption.Value
+		} else {
+			fieldErrors[categoryBlock] = "Invalid category"
+		}
+	}
+
+	block := ttlBlockID(submission.category)
+	if ttl, ok := modalValue(values, block, "ttl_input"); ok && ttl.SelectedOption != nil {
+		ttlSeconds, err := strconv.ParseInt(ttl.SelectedOption.Value, 10, 64)
+		if err != nil || ttlSeconds < models.MinTTL || ttlSeconds > models.MaxTTL {
+			fieldErrors[block] = "Invalid expiration time"
+		} else {
+			submission.ttlSeconds = &ttlSeconds
+		}
+	}
+
+	return submission, fieldErrors
+}
+
+// ttlBlockID is the block ID of the expiration select for category. Slack
+// keeps the selection of a block across view updates, so each category
+// gets its own block and a selection the category does not allow is reset
+func ttlBlockID(category string) string {
+	if category == "" {
+		return ttlBlock
+	}
+	return ttlBlock + "_" + category
+}
+
+// modalValue looks up an input by block and action ID
+func modalValue(values map[string]map[string]InteractionValue, blockID, actionID string) (InteractionValue, bool) {
+	block, ok := values[blockID]
+	if !ok {
+		return InteractionValue{}, false
+	}
+	value, ok := block[actionID]
+	return value, ok
+}
+
+// validEmail reports whether s is a bare email address (no display name)
+func validEmail(s string) bool {
+	addr, err := mail.ParseAddress(s)
+	return err == nil && addr.Address == s
+}
+
+// ttlChoices are the expiration times the password modal offers
+var ttlChoices = []int64{3600, 86400, 259200, 604800}
+
+// ttlLabel words a TTL in seconds for the password modal
+func ttlLabel(seconds int64) string {
+	switch {
+	case seconds%86400 == 0 && seconds > 86400:
+		return fmt.Sprintf("%d days", seconds/86400)
+	case seconds%3600 == 0 && seconds > 3600:
+		return fmt.Sprintf("%d hours", seconds/3600)
+	case seconds == 3600:
+		return "1 hour"
+	default:
+		return fmt.Sprintf("%d minutes", seconds/60)
+	}
+}
+
+// selectOption builds an option of a static_select
+func selectOption(text, value string) map[string]interface{} {
 	return map[string]interface{}{
-		"type": "modal",
+		"text": map[string]interface{}{
+			"type": "plain_text",
+			"text": text,
+		},
+		"value": value,
+	}
+}
+
+// passwordModal builds the password modal for the category picked, empty
+// for none. When the category policies cannot be loaded the modal offers
+// no categories rather than failing
+func (h *SlackHandler) passwordModal(ctx context.Context, category string) map[string]interface{} {
+	policies, err := h.messages.CategoryPolicies(ctx)
+	if err != nil {
+		requestid.Logger(ctx).Warn("failed to load category policies for the Slack modal", "error", err)
+		policies = nil
+	}
+	return buildPasswordModal(policies, category)
+}
+
+// buildPasswordModal creates the modal view for password input. With
+// policies it lets the sender pick a category, and offers only the
+// expiration times the policy of category allows, starting at its default
+func buildPasswordModal(policies []*models.CategoryPolicy, category string) map[string]interface{} {
+	var selected *models.CategoryPolicy
+	for _, policy := range policies {
+		if policy.Category == category {
+			selected = policy
+		}
+	}
+
+	blocks := []map[string]interface{}{
+		{
+			"type":     "input",
+			"block_id": recipientBlock,
+			"element": map[string]interface{}{
+				"type":      "plain_text_input",
+				"action_id": "recipient_input",
+				"placeholder": map[string]interface{}{
+					"type": "plain_text",
+					"text": "recipient@example.com",
+				},
+			},
+			"label": map[string]interface{}{
+				"type": "plain_text",
+				"text": "Recipient Email",
+			},
+		},
+		{
+			"type":     "input",
+			"block_id": passwordBlock,
+			"element": map[string]interface{}{
+				"type":      "plain_text_input",
+				"action_id": "password_input",
+				"multiline": true,
+				"placeholder": map[string]interface{}{
+					"type": "plain_text",
+					"text": "Enter the password or secret message",
+				},
+			},
+			"label": map[string]interface{}{
+				"type": "plain_text",
+				"text": "Secret Message",
+			},
+		},
+	}
+	if len(policies) > 0 {
+		blocks = append(blocks, categorySelectBlock(policies, selected))
+	}
+	blocks = append(blocks,
+		ttlSelectBlock(selected, category),
+		map[string]interface{}{
+			"type": "context",
+			"elements": []map[string]interface{}{
+				{
+					"type": "mrkdwn",
+					"text": "🔒 Your message will be encrypted and can only be read once. It will be permanently destroyed after the recipient views it or when it expires.",
+				},
+			},
+		},
+	)
+
+	return map[string]interface{}{
+		"type":        "modal",
 		"callback_id": "vanish_password_modal",
 		"title": map[string]interface{}{
 			"type": "plain_text",
@@ -309,149 +597,137 @@ func (h *SlackHandler) buildPasswordModal() map[string]interface{} {
 			"type": "plain_text",
 			"text": "Cancel",
 		},
-		"blocks": []map[string]interface{}{
-			{
-				"type": "input",
-				"block_id": "recipient_block",
-				"element": map[string]interface{}{
-					"type": "plain_text_input",
-					"action_id": "recipient_input",
-					"placeholder": map[string]interface{}{
-						"type": "plain_text",
-						"text": "recipient@example.com",
-					},
-				},
-				"label": map[string]interface{}{
-					"type": "plain_text",
-					"text": "Recipient Email",
-				},
-			},
-			{
-				"type": "input",
-				"block_id": "password_block",
-				"element": map[string]interface{}{
-					"type": "plain_text_input",
-					"action_id": "password_input",
-					"multiline": true,
-					"placeholder": map[string]interface{}{
-						"type": "plain_text",
-						"text": "Enter the password or secret message",
-					},
-				},
-				"label": map[string]interface{}{
-					"type": "plain_text",
-					"text": "Secret Message",
-				},
-			},
-			{
-				"type": "input",
-				"block_id": "ttl_block",
-				"element": map[string]interface{}{
-					"type": "static_select",
-					"action_id": "ttl_input",
-					"placeholder": map[string]interface{}{
-						"type": "plain_text",
-						"text": "Select expiration time",
-					},
-					"initial_option": map[string]interface{}{
-						"text": map[string]interface{}{
-							"type": "plain_text",
-							"text": "24 hours",
-						},
-						"value": "86400",
-					},
-					"options": []map[string]interface{}{
-						{
-							"text": map[string]interface{}{
-								"type": "plain_text",
-								"text": "1 hour",
-							},
-							"value": "3600",
-						},
-						{
-							"text": map[string]interface{}{
-								"type": "plain_text",
-								"text": "24 hours",
-							},
-							"value": "86400",
-						},
-						{
-							"text": map[string]interface{}{
-								"type": "plain_text",
-								"text": "3 days",
-							},
-							"value": "259200",
-						},
-						{
-							"text": map[string]interface{}{
-								"type": "plain_text",
-								"text": "7 days",
-							},
-							"value": "604800",
-						},
-					},
-				},
-				"label": map[string]interface{}{
-					"type": "plain_text",
-					"text": "Expires In",
-				},
-			},
-			{
-				"type": "context",
-				"elements": []map[string]interface{}{
-					{
-						"type": "mrkdwn",
-						"text": "🔒 Your message will be encrypted and can only be read once. It will be permanently destroyed after the recipient views it or when it expires.",
-					},
-				},
-			},
-		},
+		"blocks": blocks,
 	}
 }
 
-// verifySlackRequest verifies the Slack request signature
-func (h *SlackHandler) verifySlackRequest(c *gin.Context) bool {
-	// Skip verification if signing secret is not configured (dev mode)
-	if h.signingSecret == "" {
-		return true
+// categorySelectBlock lets the sender pick one of the categories with a
+// policy. It dispatches its action so the modal can follow the choice
+func categorySelectBlock(policies []*models.CategoryPolicy, selected *models.CategoryPolicy) map[string]interface{} {
+	none := selectOption("No category", noCategory)
+	options := []map[string]interface{}{none}
+	initial := none
+	for _, policy := range policies {
+		if len(options) > maxCategoryOptions {
+			break
+		}
+		option := selectOption(fmt.Sprintf("%s (up to %s)", policy.Category, ttlLabel(policy.MaxTTL)), policy.Category)
+		options = append(options, option)
+		if policy == selected {
+			initial = option
+		}
 	}
 
-	timestamp := c.GetHeader("X-Slack-Request-Timestamp")
-	signature := c.GetHeader("X-Slack-Signature")
+	return map[string]interface{}{
+		"type":            "input",
+		"block_id":        categoryBlock,
+		"dispatch_action": true,
+		"optional":        true,
+		"element": map[string]interface{}{
+			"type":           "static_select",
+			"action_id":      categoryInput,
+			"initial_option": initial,
+			"options":        options,
+		},
+		"label": map[string]interface{}{
+			"type": "plain_text",
+			"text": "Category",
+		},
+	}
+}
 
-	if timestamp == "" || signature == "" {
-		return false
+// ttlSelectBlock offers the expiration times policy allows, all of them
+// when it is nil, starting at the longest one up to its default TTL
+func ttlSelectBlock(policy *models.CategoryPolicy, category string) map[string]interface{} {
+	defaultTTL := int64(models.DefaultTTL)
+	if policy != nil {
+		defaultTTL = policy.DefaultTTL
 	}
 
-	// Check timestamp (protect against replay attacks)
-	ts, err := strconv.ParseInt(timestamp, 10, 64)
-	if err != nil {
-		return false
+	var options []map[string]interface{}
+	var initial map[string]interface{}
+	for _, seconds := range ttlChoices {
+		if !policy.AllowsTTL(seconds) {
+			continue
+		}
+		option := selectOption(ttlLabel(seconds), strconv.FormatInt(seconds, 10))
+		options = append(options, option)
+		if initial == nil || seconds <= defaultTTL {
+			initial = option
+		}
 	}
 
-	if time.Now().Unix()-ts > 300 { // 5 minutes
-		return false
+	return map[string]interface{}{
+		"type":     "input",
+		"block_id": ttlBlockID(category),
+		"element": map[string]interface{}{
+			"type":      "static_select",
+			"action_id": "ttl_input",
+			"placeholder": map[string]interface{}{
+				"type": "plain_text",
+				"text": "Select expiration time",
+			},
+			"initial_option": initial,
+			"options":        options,
+		},
+		"label": map[string]interface{}{
+			"type": "plain_text",
+			"text": "Expires In",
+		},
 	}
+}
+
+// maxSlackBodyBytes bounds the request body read for signature checks
+// Slash commands are a few KB and interaction payloads, which carry the
+// view of a modal, stay well below it
+const maxSlackBodyBytes = 256 << 10 // 256 KB
 
-	// Read body
-	body, err := io.ReadAll(c.Request.Body)
+// errInvalidSlackForm marks a correctly signed body that is not a valid form
+var errInvalidSlackForm = errors.New("invalid Slack form payload")
+
+// verifiedForm reads the raw body exactly once, verifies its Slack signature
+// against those bytes and parses the form from them. The parsed form is
+// cached on the request so later binding never re-reads the body.
+func verifiedForm(c *gin.Context, slackClient *slack.Client) (url.Values, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxSlackBodyBytes))
 	if err != nil {
-		return false
+		return nil, errInvalidSlackForm
 	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
 
-	// Restore body for later use
-	c.Request.Body = io.NopCloser(strings.NewReader(string(body)))
+	// Skip verification if signing secret is not configured (dev mode)
+	if secret := slackClient.SigningSecret(); secret != "" {
+		err := slack.VerifySignature(
+			secret,
+			c.GetHeader("X-Slack-Request-Timestamp"),
+			c.GetHeader("X-Slack-Signature"),
+			body,
+			time.Now(),
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	// Calculate signature
-	baseString := fmt.Sprintf("v0:%s:%s", timestamp, body)
-	hash := hmac.New(sha256.New, []byte(h.signingSecret))
-	hash.Write([]byte(baseString))
-	expectedSignature := "v0=" + hex.EncodeToString(hash.Sum(nil))
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, errInvalidSlackForm
+	}
+	c.Request.PostForm = form
+	c.Request.Form = form
+	return form, nil
+}
 
-	return hmac.Equal([]byte(expectedSignature), []byte(signature))
+// rejectSlackRequest answers a request that failed verifiedForm
+func rejectSlackRequest(c *gin.Context, err error) {
+	if errors.Is(err, errInvalidSlackForm) {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Invalid payload"))
+		return
+	}
+	c.JSON(http.StatusUnauthorized, errorResponse(c, models.ErrorCodeUnauthorized, "Invalid signature"))
 }
 
 // sendEphemeralError sends an ephemeral error message to a user
-func (h *SlackHandler) sendEphemeralError(ctx context.Context, userID, message string) {
-	h.slackClient.SendEphemeralMessage(ctx, userID, "❌ "+message)
+func sendEphemeralError(ctx context.Context, slackClient *slack.Client, userID, message string) {
+	slackClient.SendEphemeralMessage(ctx, userID, "❌ "+message)
 }
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/integrations/slack"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+	"github.com/milkiss/vanish/backend/internal/storage"
+)
+
+// slackStateTTL is how long a workspace admin has to approve an install
+const slackStateTTL = 10 * time.Minute
+
+// SlackInstallHandler installs the Slack app into workspaces with the OAuth
+// v2 flow, storing each workspace's bot token. The state parameter is kept
+// in Redis, so the callback may reach any backend instance
+type SlackInstallHandler struct {
+	integrations  *Integrations
+	storage       storage.Storage
+	installations persistence.SlackInstallationStore // nil disables installation
+}
+
+// NewSlackInstallHandler creates a new Slack install handler
+func NewSlackInstallHandler(integrations *Integrations, storage storage.Storage, installations persistence.SlackInstallationStore) *SlackInstallHandler {
+	return &SlackInstallHandler{
+		integrations:  integrations,
+		storage:       storage,
+		installations: installations,
+	}
+}
+
+// client returns the Slack client in effect. When Slack is disabled or
+// has no OAuth credentials it answers 503 and returns nil
+func (h *SlackInstallHandler) client(c *gin.Context) *slack.Client {
+	slackClient := h.integrations.Slack()
+	if slackClient == nil {
+		c.JSON(http.StatusServiceUnavailable, errorResponse(c, models.ErrorCodeIntegrationDisabled, "Slack integration not enabled"))
+		return nil
+	}
+	if !slackClient.CanInstall() || h.installations == nil {
+		c.JSON(http.StatusServiceUnavailable, errorResponse(c, models.ErrorCodeIntegrationDisabled, "Slack app installation not configured"))
+		return nil
+	}
+	return slackClient
+}
+
+// Install handles GET /api/slack/install
+// Redirects to Slack, where a workspace admin approves installing the app
+func (h *SlackInstallHandler) Install(c *gin.Context) {
+	slackClient := h.client(c)
+	if slackClient == nil {
+		return
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to generate state"))
+		return
+	}
+	state := base64.RawURLEncoding.EncodeToString(b)
+	if err := h.storage.SaveOAuthState(c.Request.Context(), state, slackStateTTL); err != nil {
+		c.JSON(http.StatusServiceUnavailable, errorResponse(c, models.ErrorCodeUnavailable, "Failed to store state"))
+		return
+	}
+
+	c.Redirect(http.StatusFound, slackClient.InstallURL(state))
+}
+
+// HandleCallback handles GET /api/slack/oauth/callback
+// Exchanges the code of an approved install for the workspace's bot token
+// and stores it; installing again replaces the token
+func (h *SlackInstallHandler) HandleCallback(c *gin.Context) {
+	slackClient := h.client(c)
+	if slackClient == nil {
+		return
+	}
+	ctx := c.Request.Context()
+
+	// Verify state (CSRF protection); each state is accepted once
+	ok, err := h.storage.TakeOAuthState(ctx, c.Query("state"))
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, errorResponse(c, models.ErrorCodeUnavailable, "Failed to check state"))
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Invalid state parameter"))
+		return
+	}
+
+	// The admin declined, for one
+	if errMsg := c.Query("error"); errMsg != "" {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeUpstreamFailed, "Slack error: "+errMsg))
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		c.JSON(http.StatusBadRequest, errorResponse(c, models.ErrorCodeInvalidRequest, "Missing authorization code"))
+		return
+	}
+
+	installed, err := slackClient.ExchangeCode(ctx, code)
+	if err != nil {
+		requestid.Logger(ctx).Warn("failed to exchange Slack install code", "error", err)
+		c.JSON(http.StatusBadGateway, errorResponse(c, models.ErrorCodeUpstreamFailed, "Failed to exchange code for token"))
+		return
+	}
+	if !slackClient.AllowsTeam(installed.TeamID) {
+		requestid.Logger(ctx).Warn("refused Slack install into workspace not allowed", "team_id", installed.TeamID)
+		c.JSON(http.StatusForbidden, errorResponse(c, models.ErrorCodeForbidden, "This workspace may not install Vanish"))
+		return
+	}
+
+	installation := &models.SlackInstallation{
+		TeamID:      installed.TeamID,
+		TeamName:    installed.TeamName,
+		BotUserID:   installed.BotUserID,
+		BotToken:    installed.BotToken,
+		Scope:       installed.Scope,
+		InstalledBy: installed.InstalledBy,
+	}
+	if err := h.installations.SaveSlackInstallation(ctx, installation); err != nil {
+		requestid.Logger(ctx).Error("failed to save Slack installation", "team_id", installed.TeamID, "error", err)
+		c.JSON(http.StatusInternalServerError, errorResponse(c, models.ErrorCodeInternal, "Failed to save installation"))
+		return
+	}
+
+	requestid.Logger(ctx).Info("slack app installed", "team_id", installation.TeamID, "installed_by", installation.InstalledBy)
+	c.JSON(http.StatusOK, models.SlackInstallResponse{TeamID: installation.TeamID, TeamName: installation.TeamName})
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/lifecycle"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+	"github.com/milkiss/vanish/backend/internal/storage"
+)
+
+const (
+	// statusSampleInterval is how often each instance checks its
+	// dependencies for the public status
+	statusSampleInterval = 30 * time.Second
+	// statusCheckTimeout bounds each check; a slower dependency counts as
+	// degraded
+	statusCheckTimeout = 2 * time.Second
+	// statusWindow is how far back the public status looks
+	statusWindow = 15 * time.Minute
+	// statusCacheTTL is how long a computed status is served, by this
+	// instance and by browsers and proxies
+	statusCacheTTL = 30 * time.Second
+)
+
+// statusCacheControl lets any cache keep the status for statusCacheTTL and
+// serve it a little longer while revalidating
+const statusCacheControl = "public, max-age=30, stale-while-revalidate=30"
+
+// StatusSampler checks Redis, PostgreSQL and the scheduled notification
+// queue and records the results in Redis, where GET /api/status reads them
+type StatusSampler struct {
+	metadataRepo persistence.MetadataStore
+	storage      storage.Storage
+}
+
+// NewStatusSampler creates a sampler over the given stores
+func NewStatusSampler(metadataRepo persistence.MetadataStore, storage storage.Storage) *StatusSampler {
+	return &StatusSampler{metadataRepo: metadataRepo, storage: storage}
+}
+
+// Run samples every thirty seconds until ctx is cancelled; run it as a
+// lifecycle worker
+func (s *StatusSampler) Run(ctx context.Context) {
+	s.Sample(ctx)
+	lifecycle.Every(statusSampleInterval, s.Sample)(ctx)
+}
+
+// Sample runs one round of checks and records it. PostgreSQL is checked by
+// counting the due notifications, which is also the queue depth
+func (s *StatusSampler) Sample(ctx context.Context) {
+	sample := models.HealthSample{At: time.Now(), QueueDepth: -1}
+
+	pingCtx, cancel := context.WithTimeout(ctx, statusCheckTimeout)
+	sample.Redis = s.storage.Ping(pingCtx) == nil
+	cancel()
+
+	countCtx, cancel := context.WithTimeout(ctx, statusCheckTimeout)
+	depth, err := s.metadataRepo.CountDueNotifications(countCtx, sample.At)
+	cancel()
+	if err == nil {
+		sample.Postgres, sample.QueueDepth = true, depth
+	}
+
+	if err := s.storage.RecordHealthSample(ctx, sample, statusWindow); err != nil {
+		requestid.Logger(ctx).Warn("failed to record health sample", "error", err)
+	}
+}
+
+// StatusHandler answers GET /api/status from the samples in Redis alone, so
+// a flood of status checks during an outage never reaches PostgreSQL
+type StatusHandler struct {
+	storage storage.Storage
+
+	mu       sync.Mutex
+	cached   models.ServiceStatus
+	cachedAt time.Time
+}
+
+// NewStatusHandler creates a status handler reading samples from storage
+func NewStatusHandler(storage storage.Storage) *StatusHandler {
+	return &StatusHandler{storage: storage}
+}
+
+// GetStatus handles GET /api/status
+// Reports coarse availability over the last fifteen minutes without
+// authentication. The result is computed at most every thirty seconds per
+// instance and may be cached publicly for as long
+func (h *StatusHandler) GetStatus(c *gin.Context) {
+	c.Header("Cache-Control", statusCacheControl)
+	c.JSON(http.StatusOK, h.status(c.Request.Context()))
+}
+
+// status returns the cached status, recomputing it once stale
+func (h *StatusHandler) status(ctx context.Context) models.ServiceStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	if !h.cachedAt.IsZero() && now.Sub(h.cachedAt) < statusCacheTTL {
+		return h.cached
+	}
+
+	samples, err := h.storage.HealthSamples(ctx, now.Add(-statusWindow))
+	if err != nil {
+		// Unreadable samples say Redis is in trouble but nothing of the rest
+		requestid.Logger(ctx).Warn("failed to read health samples", "error", err)
+		samples = nil
+	}
+	h.cached = models.SummarizeHealth(samples, statusWindow)
+	if err != nil {
+		h.cached.Status, h.cached.Redis = models.ServiceDegraded, models.ComponentDegraded
+	}
+	h.cachedAt = now
+	return h.cached
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/buildinfo"
+)
+
+const (
+	// APIVersion is the current API version served by this build
+	APIVersion = "v1"
+	// APIVersionPrefix is the path prefix of the current API version
+	APIVersionPrefix = "/api/" + APIVersion
+	// LegacyAPIPrefix is the unversioned prefix kept as a deprecated alias
+	LegacyAPIPrefix = "/api"
+
+	// APIVersionHeader is set on every response with the current API version
+	APIVersionHeader = "X-Vanish-API-Version"
+	// ServerVersionHeader is set on every response with the server release
+	ServerVersionHeader = "X-Vanish-Version"
+)
+
+// APIVersionInfo describes one mounted API prefix
+type APIVersionInfo struct {
+	Version    string `json:"version"`
+	Prefix     string `json:"prefix"`
+	Status     string `json:"status"` // "current" or "deprecated"
+	AliasOf    string `json:"alias_of,omitempty"`
+	Deprecated bool   `json:"deprecated"`
+}
+
+// APIVersionsResponse is returned by GET /api/versions
+type APIVersionsResponse struct {
+	Current  string           `json:"current"`
+	Versions []APIVersionInfo `json:"versions"`
+}
+
+// ServerVersionResponse is returned by GET /api/version
+type ServerVersionResponse struct {
+	Version          string `json:"version"`
+	Commit           string `json:"commit"`
+	BuildDate        string `json:"build_date"`
+	APIVersion       string `json:"api_version"`
+	MinClientVersion string `json:"min_client_version,omitempty"`
+}
+
+// APIVersionMiddleware adds the X-Vanish-API-Version and X-Vanish-Version
+// headers to all responses
+func APIVersionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header(APIVersionHeader, APIVersion)
+		c.Header(ServerVersionHeader, buildinfo.Version)
+		c.Next()
+	}
+}
+
+// DeprecationMiddleware marks responses from a legacy prefix as deprecated
+// and links to the equivalent path under the successor prefix
+func DeprecationMiddleware(successorPrefix string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		successor := successorPrefix + strings.TrimPrefix(c.Request.URL.Path, LegacyAPIPrefix)
+		c.Header("Deprecation", "true")
+		c.Header("Link", "<"+successor+`>; rel="successor-version"`)
+		c.Next()
+	}
+}
+
+// ListAPIVersions handles GET /api/versions
+// Returns a machine-readable mapping of mounted prefixes to API versions
+func ListAPIVersions(c *gin.Context) {
+	c.JSON(http.StatusOK, APIVersionsResponse{
+		Current: APIVersion,
+		Versions: []APIVersionInfo{
+			{
+				Version: APIVersion,
+				Prefix:  APIVersionPrefix,
+				Status:  "current",
+			},
+			{
+				Version:    APIVersion,
+				Prefix:     LegacyAPIPrefix,
+				Status:     "deprecated",
+				AliasOf:    APIVersionPrefix,
+				Deprecated: true,
+			},
+		},
+	})
+}
+
+// GetServerVersion returns the handler for GET /api/version
+// Clients compare min_client_version with their own release to warn users
+// running a CLI too old for this server
+func GetServerVersion(minClientVersion string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, ServerVersionResponse{
+			Version:          buildinfo.Version,
+			Commit:           buildinfo.Commit,
+			BuildDate:        buildinfo.BuildDate,
+			APIVersion:       APIVersion,
+			MinClientVersion: minClientVersion,
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// accessTokenContext separates the key of message access tokens from the
+// JWT signing key, so neither kind of token can stand in for the other
+const accessTokenContext = "vanish message access token"
+
+// SignMessageAccess returns the access token of an external recipient's
+// link to message messageID, valid until expiresAt. It is an HMAC over the
+// message ID and the expiry, so it is never stored: the message burning on
+// read is what makes it single-use
+func (m *JWTManager) SignMessageAccess(messageID string, expiresAt time.Time) string {
+	expiry := expiresAt.Unix()
+	return strconv.FormatInt(expiry, 10) + "." + base64.RawURLEncoding.EncodeToString(m.accessMAC(messageID, expiry))
+}
+
+// VerifyMessageAccess checks that token was signed by SignMessageAccess for
+// message messageID and has not expired. The signature is compared in
+// constant time
+func (m *JWTManager) VerifyMessageAccess(messageID, token string) error {
+	rawExpiry, rawMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return ErrInvalidToken
+	}
+	expiry, err := strconv.ParseInt(rawExpiry, 10, 64)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(rawMAC)
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	// The expiry is only trusted once the signature covering it checks out
+	if !hmac.Equal(mac, m.accessMAC(messageID, expiry)) {
+		return ErrInvalidToken
+	}
+	if !time.Now().Before(time.Unix(expiry, 0)) {
+		return ErrExpiredToken
+	}
+	return nil
+}
+
+// accessMAC signs messageID and expiry with a key derived from the secret
+func (m *JWTManager) accessMAC(messageID string, expiry int64) []byte {
+	derive := hmac.New(sha256.New, []byte(m.secretKey))
+	derive.Write([]byte(accessTokenContext))
+
+	mac := hmac.New(sha256.New, derive.Sum(nil))
+	mac.Write([]byte(messageID + "\n" + strconv.FormatInt(expiry, 10)))
+	return mac.Sum(nil)
+}
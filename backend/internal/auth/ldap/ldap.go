@@ -0,0 +1,267 @@
+// Package ldap authenticates users against an LDAP directory such as
+// Active Directory or OpenLDAP by binding as them.
+package ldap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+)
+
+// ErrInvalidCredentials is returned when the directory has no such user or
+// rejects the password
+var ErrInvalidCredentials = errors.New("invalid directory credentials")
+
+// DefaultTimeout bounds dialing and each directory operation when Config
+// leaves Timeout unset
+const DefaultTimeout = 10 * time.Second
+
+// Config describes how to reach the directory and find users in it. Users
+// are found either directly by binding as UserDNTemplate with the login
+// substituted for %s, or by searching SearchBase with UserFilter, bound as
+// BindDN (anonymously when it is empty), and then binding as the entry found
+type Config struct {
+	URL                string // ldap://host:389 or ldaps://host:636
+	StartTLS           bool   // upgrade an ldap:// connection before binding
+	InsecureSkipVerify bool
+	CACertFile         string // PEM bundle trusted instead of the system roots
+
+	BindDN       string
+	BindPassword string
+
+	UserDNTemplate string // e.g. uid=%s,ou=people,dc=example,dc=com
+	SearchBase     string
+	UserFilter     string // e.g. (mail=%s); the login is escaped
+
+	EmailAttribute string // defaults to mail
+	NameAttribute  string // defaults to cn
+	GroupAttribute string // defaults to memberOf
+	AdminGroupDN   string // members are admins; empty leaves is_admin to Vanish
+
+	Timeout time.Duration
+}
+
+// Identity is what the directory says about an authenticated user
+type Identity struct {
+	DN      string
+	Email   string
+	Name    string
+	IsAdmin bool
+}
+
+// Authenticator checks passwords against the directory
+type Authenticator struct {
+	cfg Config
+	tls *tls.Config
+}
+
+// New validates cfg and returns an Authenticator for it
+func New(cfg Config) (*Authenticator, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		return nil, fmt.Errorf("URL must be an ldap:// or ldaps:// URL")
+	}
+	if cfg.StartTLS && u.Scheme == "ldaps" {
+		return nil, fmt.Errorf("StartTLS cannot be used with ldaps://")
+	}
+	if cfg.UserDNTemplate == "" && cfg.SearchBase == "" {
+		return nil, fmt.Errorf("either a user DN template or a search base is required")
+	}
+	if cfg.UserDNTemplate != "" && strings.Count(cfg.UserDNTemplate, "%s") != 1 {
+		return nil, fmt.Errorf("user DN template must contain %%s once")
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(mail=%s)"
+	}
+	if cfg.SearchBase != "" && strings.Count(cfg.UserFilter, "%s") != 1 {
+		return nil, fmt.Errorf("user filter must contain %%s once")
+	}
+	if cfg.EmailAttribute == "" {
+		cfg.EmailAttribute = "mail"
+	}
+	if cfg.NameAttribute == "" {
+		cfg.NameAttribute = "cn"
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = "memberOf"
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: cfg.InsecureSkipVerify, // #nosec G402 -- opt-in via AUTH_LDAP_TLS_SKIP_VERIFY
+		MinVersion:         tls.VersionTLS12,
+	}
+	if cfg.CACertFile != "" {
+		pem, err := os.ReadFile(cfg.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA file %s contains no certificates", cfg.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &Authenticator{cfg: cfg, tls: tlsConfig}, nil
+}
+
+// Authenticate binds to the directory as the user with the given login,
+// normally their email address, and returns their identity. A user the
+// directory does not know and a wrong password both return
+// ErrInvalidCredentials; any other error means the directory could not be
+// asked
+func (a *Authenticator) Authenticate(login, password string) (*Identity, error) {
+	// An empty password would be an unauthenticated bind, which many
+	// directories accept for any DN
+	if login == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var entry *goldap.Entry
+	if a.cfg.UserDNTemplate != "" {
+		dn := fmt.Sprintf(a.cfg.UserDNTemplate, goldap.EscapeDN(login))
+		if err := bindUser(conn, dn, password); err != nil {
+			return nil, err
+		}
+		// Read the entry as the user, who can normally see their own
+		if entry, err = a.lookup(conn, dn, goldap.ScopeBaseObject, "(objectClass=*)"); err != nil {
+			return nil, err
+		}
+	} else {
+		if err := a.bindService(conn); err != nil {
+			return nil, err
+		}
+		filter := fmt.Sprintf(a.cfg.UserFilter, goldap.EscapeFilter(login))
+		if entry, err = a.lookup(conn, a.cfg.SearchBase, goldap.ScopeWholeSubtree, filter); err != nil {
+			return nil, err
+		}
+		if err := bindUser(conn, entry.DN, password); err != nil {
+			return nil, err
+		}
+	}
+
+	return a.identity(entry, login), nil
+}
+
+// dial connects to the directory, upgrading to TLS when configured
+func (a *Authenticator) dial() (*goldap.Conn, error) {
+	conn, err := goldap.DialURL(a.cfg.URL,
+		goldap.DialWithDialer(&net.Dialer{Timeout: a.cfg.Timeout}),
+		goldap.DialWithTLSConfig(a.tls),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to directory: %w", err)
+	}
+	conn.SetTimeout(a.cfg.Timeout)
+
+	if a.cfg.StartTLS {
+		if err := conn.StartTLS(a.tls); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to start TLS: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// bindService binds as the search account, or stays anonymous without one
+func (a *Authenticator) bindService(conn *goldap.Conn) error {
+	if a.cfg.BindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+		return fmt.Errorf("failed to bind as %s: %w", a.cfg.BindDN, err)
+	}
+	return nil
+}
+
+// bindUser binds as the user, mapping a rejected password to
+// ErrInvalidCredentials
+func bindUser(conn *goldap.Conn, dn, password string) error {
+	err := conn.Bind(dn, password)
+	if goldap.IsErrorWithCode(err, goldap.LDAPResultInvalidCredentials) {
+		return ErrInvalidCredentials
+	}
+	if err != nil {
+		return fmt.Errorf("failed to bind as user: %w", err)
+	}
+	return nil
+}
+
+// lookup returns the single entry matching filter. No match, or more than
+// one, is reported as ErrInvalidCredentials so as not to reveal which
+// logins exist
+func (a *Authenticator) lookup(conn *goldap.Conn, base string, scope int, filter string) (*goldap.Entry, error) {
+	req := goldap.NewSearchRequest(base, scope, goldap.NeverDerefAliases, 2, int(a.cfg.Timeout.Seconds()), false,
+		filter, []string{a.cfg.EmailAttribute, a.cfg.NameAttribute, a.cfg.GroupAttribute}, nil)
+
+	res, err := conn.Search(req)
+	if goldap.IsErrorWithCode(err, goldap.LDAPResultNoSuchObject) || goldap.IsErrorWithCode(err, goldap.LDAPResultSizeLimitExceeded) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to search directory: %w", err)
+	}
+	if len(res.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	return res.Entries[0], nil
+}
+
+// identity reads the user's attributes. Without an email attribute the
+// login stands in, and without a name the email does
+func (a *Authenticator) identity(entry *goldap.Entry, login string) *Identity {
+	id := &Identity{
+		DN:    entry.DN,
+		Email: strings.ToLower(entry.GetAttributeValue(a.cfg.EmailAttribute)),
+		Name:  entry.GetAttributeValue(a.cfg.NameAttribute),
+	}
+	if id.Email == "" {
+		id.Email = strings.ToLower(login)
+	}
+	if id.Name == "" {
+		id.Name = id.Email
+	}
+	if a.cfg.AdminGroupDN != "" {
+		for _, group := range entry.GetAttributeValues(a.cfg.GroupAttribute) {
+			if sameDN(group, a.cfg.AdminGroupDN) {
+				id.IsAdmin = true
+				break
+			}
+		}
+	}
+	return id
+}
+
+// sameDN compares two DNs the way directories do, ignoring case and
+// spacing; unparseable DNs only match exactly
+func sameDN(a, b string) bool {
+	x, errX := goldap.ParseDN(a)
+	y, errY := goldap.ParseDN(b)
+	if errX != nil || errY != nil {
+		return strings.EqualFold(a, b)
+	}
+	return x.EqualFold(y)
+}
+
+// AdminsManaged reports whether the directory decides who is an admin
+func (a *Authenticator) AdminsManaged() bool {
+	return a.cfg.AdminGroupDN != ""
+}
@@ -0,0 +1,255 @@
+// Package backup reads and writes encrypted disaster-recovery backups of
+// the PostgreSQL tables. A backup is a tar archive of a manifest followed by
+// the rows of each table as JSON lines, encrypted with AES-256-GCM under a
+// key derived from an operator passphrase with Argon2id. Which tables are
+// backed up, and how they are read and restored, is up to the repository
+// package; this package only handles the file format
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/buildinfo"
+)
+
+// PendingMessagesNote is stored in every manifest: restoring brings back
+// accounts, settings and history, but not the messages themselves
+const PendingMessagesNote = "Message contents live in Redis and are not part of this backup: " +
+	"messages still unread when it was taken cannot be read after a restore"
+
+var (
+	// ErrSchemaVersion is returned when restoring a backup of another
+	// schema version
+	ErrSchemaVersion = errors.New("backup does not match this server's schema")
+	// ErrNotEmpty is returned when restoring into a database with data
+	ErrNotEmpty = errors.New("database is not empty")
+)
+
+const (
+	// manifestName is the first entry of the archive
+	manifestName = "manifest.json"
+	// partSize is roughly how many bytes of rows go in one archive entry;
+	// rows are buffered per entry because tar needs each entry's size first
+	partSize = 1 << 20
+)
+
+// Manifest describes a backup
+type Manifest struct {
+	SchemaVersion int          `json:"schema_version"` // database.SchemaVersion of the server that wrote it
+	CreatedAt     time.Time    `json:"created_at"`
+	ServerVersion string       `json:"server_version"`
+	Tables        []TableCount `json:"tables"` // in restore order
+	Note          string       `json:"note"`
+}
+
+// TableCount is how many rows of a table a backup holds
+type TableCount struct {
+	Name string `json:"name"`
+	Rows int64  `json:"rows"`
+}
+
+// Writer writes an encrypted backup. Call Begin once, WriteRow for every
+// row, table by table, then Close; a backup without Close cannot be read
+type Writer struct {
+	enc      *encryptWriter
+	tw       *tar.Writer
+	manifest *Manifest
+
+	table string
+	part  int
+	buf   bytes.Buffer
+}
+
+// NewWriter creates a writer encrypting to w under passphrase. Nothing is
+// written to w until enough rows are buffered or Close is called, so a
+// caller can still report an error that happens before
+func NewWriter(w io.Writer, passphrase string) (*Writer, error) {
+	enc, err := newEncryptWriter(w, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{enc: enc, tw: tar.NewWriter(enc)}, nil
+}
+
+// Begin writes the manifest of a backup of tables, listed in restore order
+func (w *Writer) Begin(schemaVersion int, tables []TableCount) error {
+	if w.manifest != nil {
+		return errors.New("backup already begun")
+	}
+	w.manifest = &Manifest{
+		SchemaVersion: schemaVersion,
+		CreatedAt:     time.Now().UTC().Truncate(time.Second),
+		ServerVersion: buildinfo.Version,
+		Tables:        tables,
+		Note:          PendingMessagesNote,
+	}
+	data, err := json.MarshalIndent(w.manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return w.writeEntry(manifestName, data)
+}
+
+// Manifest returns the manifest written by Begin, or nil before it
+func (w *Writer) Manifest() *Manifest {
+	return w.manifest
+}
+
+// WriteRow adds one row of table, encoded as a single line of JSON
+func (w *Writer) WriteRow(table string, row []byte) error {
+	if w.manifest == nil {
+		return errors.New("backup not begun")
+	}
+	if bytes.IndexByte(row, '\n') >= 0 {
+		return fmt.Errorf("row of %s spans several lines", table)
+	}
+	if table != w.table {
+		if err := w.flush(); err != nil {
+			return err
+		}
+		w.table, w.part = table, 0
+	}
+	w.buf.Write(row)
+	w.buf.WriteByte('\n')
+	if w.buf.Len() >= partSize {
+		return w.flush()
+	}
+	return nil
+}
+
+// Close writes the buffered rows and the end of the backup. It does not
+// close the writer given to NewWriter
+func (w *Writer) Close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	if err := w.tw.Close(); err != nil {
+		return err
+	}
+	return w.enc.Close()
+}
+
+// flush writes the buffered rows of the current table as its next entry
+func (w *Writer) flush() error {
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	w.part++
+	name := fmt.Sprintf("%s/%06d.jsonl", w.table, w.part)
+	err := w.writeEntry(name, w.buf.Bytes())
+	w.buf.Reset()
+	return err
+}
+
+func (w *Writer) writeEntry(name string, data []byte) error {
+	err := w.tw.WriteHeader(&tar.Header{
+		Name:     name,
+		Mode:     0600,
+		Size:     int64(len(data)),
+		ModTime:  w.manifest.CreatedAt,
+		Typeflag: tar.TypeReg,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.tw.Write(data)
+	return err
+}
+
+// Reader reads an encrypted backup row by row
+type Reader struct {
+	dec      *decryptReader
+	tr       *tar.Reader
+	manifest *Manifest
+
+	table string
+	rows  *bufio.Reader
+}
+
+// NewReader decrypts the backup in r with passphrase and reads its manifest.
+// It fails with ErrNotBackup, or ErrDecrypt for a wrong passphrase
+func NewReader(r io.Reader, passphrase string) (*Reader, error) {
+	dec, err := newDecryptReader(r, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	tr := tar.NewReader(dec)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, archiveError(err)
+	}
+	if hdr.Name != manifestName {
+		return nil, fmt.Errorf("%w: first entry is %q, not the manifest", ErrCorrupt, hdr.Name)
+	}
+	var manifest Manifest
+	if err := json.NewDecoder(tr).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("%w: invalid manifest: %v", ErrCorrupt, err)
+	}
+	return &Reader{dec: dec, tr: tr, manifest: &manifest}, nil
+}
+
+// Manifest returns the manifest of the backup
+func (r *Reader) Manifest() *Manifest {
+	return r.manifest
+}
+
+// Next returns the next row and its table. After the last row it returns
+// io.EOF, once the end of the backup was authenticated; a damaged or
+// truncated backup fails instead
+func (r *Reader) Next() (table string, row []byte, err error) {
+	for {
+		if r.rows != nil {
+			line, err := r.rows.ReadBytes('\n')
+			if err == nil {
+				return r.table, line[:len(line)-1], nil
+			}
+			if !errors.Is(err, io.EOF) {
+				return "", nil, archiveError(err)
+			}
+			if len(line) > 0 {
+				return "", nil, fmt.Errorf("%w: unterminated row in %s", ErrCorrupt, r.table)
+			}
+			r.rows = nil
+		}
+
+		hdr, err := r.tr.Next()
+		if errors.Is(err, io.EOF) {
+			// Reading to the end authenticates the last chunk
+			if _, err := io.Copy(io.Discard, r.dec); err != nil {
+				return "", nil, err
+			}
+			return "", nil, io.EOF
+		}
+		if err != nil {
+			return "", nil, archiveError(err)
+		}
+		table := path.Dir(hdr.Name)
+		if hdr.Typeflag != tar.TypeReg || table == "." || path.Ext(hdr.Name) != ".jsonl" {
+			return "", nil, fmt.Errorf("%w: unexpected entry %q", ErrCorrupt, hdr.Name)
+		}
+		r.table = table
+		r.rows = bufio.NewReader(r.tr)
+	}
+}
+
+// archiveError keeps the errors of the decrypting reader, which tar wraps
+// or replaces, and reports other archive errors as damage
+func archiveError(err error) error {
+	for _, known := range []error{ErrDecrypt, ErrCorrupt, ErrTruncated} {
+		if errors.Is(err, known) {
+			return known
+		}
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrTruncated
+	}
+	return fmt.Errorf("%w: %v", ErrCorrupt, err)
+}
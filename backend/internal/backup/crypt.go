@@ -0,0 +1,262 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// The encrypted stream is a header followed by chunks. The header holds
+// the magic, the format version and the Argon2id parameters and salt the
+// key was derived with; it is authenticated as additional data of every
+// chunk. Each chunk is a 4-byte big-endian length and an AES-256-GCM
+// ciphertext whose plaintext starts with a flag marking the last chunk.
+// Chunks are numbered by their nonce, so they cannot be reordered, and a
+// stream without its last chunk is reported as truncated
+const (
+	magic         = "VANISHBK"
+	formatVersion = 1
+
+	saltSize    = 16
+	keySize     = 32
+	chunkSize   = 64 << 10
+	maxSealSize = 1 + chunkSize + 16 // flag, plaintext and GCM tag
+
+	// Argon2id parameters of new backups
+	argonTime    = 3
+	argonMemory  = 64 << 10 // KiB
+	argonThreads = 4
+
+	// Largest parameters accepted when reading, so a crafted header cannot
+	// make a restore exhaust memory or spin for hours
+	maxArgonTime   = 16
+	maxArgonMemory = 1 << 20 // KiB
+)
+
+const headerSize = len(magic) + 1 + 4 + 4 + 1 + saltSize
+
+var (
+	// ErrNotBackup is returned for input that is not a Vanish backup
+	ErrNotBackup = errors.New("not a Vanish backup")
+	// ErrDecrypt is returned when the first chunk fails to decrypt: the
+	// passphrase is wrong or the file is damaged
+	ErrDecrypt = errors.New("wrong passphrase or damaged backup")
+	// ErrCorrupt is returned when a later chunk fails to decrypt
+	ErrCorrupt = errors.New("backup is damaged")
+	// ErrTruncated is returned when the stream ends before its last chunk
+	ErrTruncated = errors.New("backup is truncated")
+)
+
+// header holds the key derivation parameters stored at the start of a stream
+type header struct {
+	time, memory uint32
+	threads      uint8
+	salt         []byte
+}
+
+func (h header) marshal() []byte {
+	b := make([]byte, 0, headerSize)
+	b = append(b, magic...)
+	b = append(b, formatVersion)
+	b = binary.BigEndian.AppendUint32(b, h.time)
+	b = binary.BigEndian.AppendUint32(b, h.memory)
+	b = append(b, h.threads)
+	return append(b, h.salt...)
+}
+
+func parseHeader(b []byte) (header, error) {
+	if !bytes.HasPrefix(b, []byte(magic)) {
+		return header{}, ErrNotBackup
+	}
+	b = b[len(magic):]
+	if b[0] != formatVersion {
+		return header{}, fmt.Errorf("unsupported backup format version %d", b[0])
+	}
+	h := header{
+		time:    binary.BigEndian.Uint32(b[1:5]),
+		memory:  binary.BigEndian.Uint32(b[5:9]),
+		threads: b[9],
+		salt:    b[10:],
+	}
+	if h.time == 0 || h.time > maxArgonTime || h.memory == 0 || h.memory > maxArgonMemory || h.threads == 0 {
+		return header{}, fmt.Errorf("%w: unsupported key derivation parameters", ErrNotBackup)
+	}
+	return h, nil
+}
+
+// aead derives the key of h from passphrase
+func (h header) aead(passphrase string) (cipher.AEAD, error) {
+	key := argon2.IDKey([]byte(passphrase), h.salt, h.time, h.memory, h.threads, keySize)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonce numbers chunk i
+func nonce(aead cipher.AEAD, i uint64) []byte {
+	n := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(n[len(n)-8:], i)
+	return n
+}
+
+// encryptWriter encrypts what is written to it in chunks. Nothing reaches
+// the underlying writer before the first chunk is full or Close is called
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	buf    []byte
+	chunks uint64
+	err    error
+}
+
+func newEncryptWriter(w io.Writer, passphrase string) (*encryptWriter, error) {
+	h := header{time: argonTime, memory: argonMemory, threads: argonThreads, salt: make([]byte, saltSize)}
+	if _, err := rand.Read(h.salt); err != nil {
+		return nil, err
+	}
+	aead, err := h.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, aead: aead, header: h.marshal(), buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 && e.err == nil {
+		n := copy(e.buf[len(e.buf):chunkSize], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+		if len(e.buf) == chunkSize {
+			e.seal(false)
+		}
+	}
+	return written, e.err
+}
+
+// Close writes the last chunk; it does not close the underlying writer
+func (e *encryptWriter) Close() error {
+	if e.err == nil {
+		e.seal(true)
+	}
+	return e.err
+}
+
+// seal encrypts the buffered plaintext as the next chunk
+func (e *encryptWriter) seal(last bool) {
+	flag := byte(0)
+	if last {
+		flag = 1
+	}
+	plaintext := append([]byte{flag}, e.buf...)
+	sealed := e.aead.Seal(nil, nonce(e.aead, e.chunks), plaintext, e.header)
+
+	var out []byte
+	if e.chunks == 0 {
+		out = append(out, e.header...)
+	}
+	out = binary.BigEndian.AppendUint32(out, uint32(len(sealed)))
+	out = append(out, sealed...)
+	if _, err := e.w.Write(out); err != nil {
+		e.err = err
+	}
+	e.chunks++
+	e.buf = e.buf[:0]
+}
+
+// decryptReader decrypts a stream written by encryptWriter. It returns
+// io.EOF only after the last chunk was authenticated
+type decryptReader struct {
+	r      io.Reader
+	aead   cipher.AEAD
+	header []byte
+	plain  []byte
+	chunks uint64
+	done   bool
+}
+
+func newDecryptReader(r io.Reader, passphrase string) (*decryptReader, error) {
+	raw := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, ErrNotBackup
+		}
+		return nil, err
+	}
+	h, err := parseHeader(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := h.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{r: r, aead: aead, header: raw}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+// open reads and decrypts the next chunk
+func (d *decryptReader) open() error {
+	var size [4]byte
+	if _, err := io.ReadFull(d.r, size[:]); err != nil {
+		return d.readError(err)
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n < uint32(d.aead.Overhead()+1) || n > maxSealSize {
+		return ErrCorrupt
+	}
+	sealed := make([]byte, n)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return d.readError(err)
+	}
+
+	plaintext, err := d.aead.Open(sealed[:0], nonce(d.aead, d.chunks), sealed, d.header)
+	if err != nil {
+		if d.chunks == 0 {
+			return ErrDecrypt
+		}
+		return ErrCorrupt
+	}
+	d.chunks++
+	d.done = plaintext[0] == 1
+	d.plain = plaintext[1:]
+	if d.done {
+		// Anything after the last chunk was not written by encryptWriter
+		var extra [1]byte
+		if n, _ := d.r.Read(extra[:]); n > 0 {
+			return ErrCorrupt
+		}
+	}
+	return nil
+}
+
+func (d *decryptReader) readError(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrTruncated
+	}
+	return err
+}
@@ -0,0 +1,26 @@
+// Package buildinfo holds values stamped into the binary at build time
+//
+//	go build -ldflags "-X github.com/milkiss/vanish/backend/internal/buildinfo.Version=1.4.0 \
+//	  -X github.com/milkiss/vanish/backend/internal/buildinfo.Commit=$(git rev-parse --short HEAD) \
+//	  -X github.com/milkiss/vanish/backend/internal/buildinfo.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/server
+package buildinfo
+
+import "fmt"
+
+// Stamped with -ldflags; the defaults identify an unstamped development build
+var (
+	Version   = "dev"     // release version
+	Commit    = "unknown" // git commit the binary was built from
+	BuildDate = "unknown" // UTC build time, RFC 3339
+)
+
+// String describes the build for startup logs and support tickets
+func String() string {
+	return fmt.Sprintf("vanish %s (commit %s, built %s)", Version, Commit, BuildDate)
+}
+
+// Release reports whether the binary was stamped with a release version
+// Development builds may relax settings that releases must keep safe
+func Release() bool {
+	return Version != "dev"
+}
@@ -0,0 +1,207 @@
+// Package columncrypt encrypts individual database columns at rest
+//
+// Values are sealed with AES-256-GCM under a versioned master key and
+// stored as "enc:<version>:<base64url(nonce|ciphertext)>". The version
+// selects the key on read, so old keys can stay in the keyring while rows
+// are re-encrypted under a new one. Values without the prefix were written
+// before encryption was enabled and are returned unchanged
+package columncrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// prefix marks an encrypted value
+const prefix = "enc:"
+
+// KeySize is the length of a master key in bytes
+const KeySize = 32
+
+// ErrUnknownKeyVersion is returned when a value was sealed under a key
+// that is not in the keyring
+var ErrUnknownKeyVersion = errors.New("unknown column encryption key version")
+
+// validVersion limits versions to characters that cannot be confused with
+// the separators of the stored format
+var validVersion = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+// Keyring holds the master keys by version and the version new values are
+// sealed under
+// A nil *Keyring disables encryption: values are stored and read as-is
+type Keyring struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+// New creates a keyring from 32-byte master keys keyed by version
+func New(keys map[string][]byte, current string) (*Keyring, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, fmt.Errorf("current key version %q is not in the keyring", current)
+	}
+
+	k := &Keyring{current: current, aeads: make(map[string]cipher.AEAD, len(keys))}
+	for version, key := range keys {
+		if !validVersion.MatchString(version) {
+			return nil, fmt.Errorf("invalid key version %q", version)
+		}
+		if len(key) != KeySize {
+			return nil, fmt.Errorf("key %q must be %d bytes, got %d", version, KeySize, len(key))
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.aeads[version] = aead
+	}
+	return k, nil
+}
+
+// Parse creates a keyring from a comma-separated list of version:key pairs
+// with base64-encoded keys, e.g. "v1:<key>,v2:<key>". current selects the
+// version new values are sealed under and defaults to the last pair
+// An empty spec returns a nil keyring, which disables encryption
+func Parse(spec, current string) (*Keyring, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		if current != "" {
+			return nil, fmt.Errorf("key version %q set without any keys", current)
+		}
+		return nil, nil
+	}
+
+	var last string
+	keys := make(map[string][]byte)
+	for _, pair := range strings.Split(spec, ",") {
+		version, encoded, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			return nil, fmt.Errorf("key entry must be version:base64-key")
+		}
+		if _, dup := keys[version]; dup {
+			return nil, fmt.Errorf("duplicate key version %q", version)
+		}
+		key, err := decodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %w", version, err)
+		}
+		keys[version] = key
+		last = version
+	}
+
+	if current == "" {
+		current = last
+	}
+	return New(keys, current)
+}
+
+// decodeKey accepts standard or URL-safe base64, padded or not
+func decodeKey(encoded string) ([]byte, error) {
+	encoded = strings.TrimRight(strings.TrimSpace(encoded), "=")
+	if key, err := base64.RawStdEncoding.DecodeString(encoded); err == nil {
+		return key, nil
+	}
+	key, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("not valid base64")
+	}
+	return key, nil
+}
+
+// CurrentVersion returns the version new values are sealed under
+func (k *Keyring) CurrentVersion() string {
+	if k == nil {
+		return ""
+	}
+	return k.current
+}
+
+// Encrypt seals plaintext under the current key
+// Empty values are left empty so NULL handling stays with the caller
+func (k *Keyring) Encrypt(plaintext string) (string, error) {
+	if k == nil || plaintext == "" {
+		return plaintext, nil
+	}
+	return k.seal(k.current, plaintext)
+}
+
+// Decrypt opens a value sealed by Encrypt under any key in the keyring
+// Values without the encrypted prefix are returned unchanged
+func (k *Keyring) Decrypt(value string) (string, error) {
+	version, sealed, ok := split(value)
+	if !ok {
+		return value, nil
+	}
+	if k == nil {
+		return "", fmt.Errorf("%w %q: column encryption is not configured", ErrUnknownKeyVersion, version)
+	}
+	aead, found := k.aeads[version]
+	if !found {
+		return "", fmt.Errorf("%w %q", ErrUnknownKeyVersion, version)
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(version))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value sealed under key %q", version)
+	}
+	return string(plaintext), nil
+}
+
+// Rotate re-encrypts value under the current key if it is plaintext or was
+// sealed under another version, and reports whether it changed
+func (k *Keyring) Rotate(value string) (string, bool, error) {
+	if k == nil {
+		return "", false, fmt.Errorf("column encryption is not configured")
+	}
+	if value == "" {
+		return value, false, nil
+	}
+	if version, _, ok := split(value); ok && version == k.current {
+		return value, false, nil
+	}
+
+	plaintext, err := k.Decrypt(value)
+	if err != nil {
+		return "", false, err
+	}
+	rotated, err := k.seal(k.current, plaintext)
+	if err != nil {
+		return "", false, err
+	}
+	return rotated, true, nil
+}
+
+// seal encrypts plaintext under the given version, binding the version as
+// additional data so a value cannot be relabelled
+func (k *Keyring) seal(version, plaintext string) (string, error) {
+	aead := k.aeads[version]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	data := aead.Seal(nonce, nonce, []byte(plaintext), []byte(version))
+	return prefix + version + ":" + base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// split parses "enc:<version>:<data>"
+func split(value string) (version, sealed string, ok bool) {
+	rest, found := strings.CutPrefix(value, prefix)
+	if !found {
+		return "", "", false
+	}
+	return strings.Cut(rest, ":")
+}
@@ -1,10 +1,21 @@
 package config
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/buildinfo"
+	"github.com/milkiss/vanish/backend/internal/cron"
+	"github.com/milkiss/vanish/backend/internal/httpclient"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/urlbuilder"
+	"golang.org/x/crypto/bcrypt"
 )
 
 // Config holds all application configuration
@@ -13,19 +24,96 @@ type Config struct {
 	Redis    RedisConfig
 	Database DatabaseConfig
 	JWT      JWTConfig
+	Password PasswordConfig
+	Cookie   AuthCookieConfig
 	Message  MessageConfig
 	Okta     OktaConfig
+	SCIM     SCIMConfig
+	LDAP     LDAPConfig
 	Vault    VaultConfig
+	Crypto   ColumnEncryptionConfig
 	Slack    SlackConfig
 	Email    EmailConfig
+	Notify   NotificationConfig
+	Stats    StatsConfig
+	Abuse    AbuseConfig
+	Alert    AlertConfig
+	Digest   DigestConfig
+	Backup   BackupConfig
+	Outbound OutboundConfig
+	Tracing  TracingConfig
+	GRPC     GRPCConfig
 }
 
 // ServerConfig holds HTTP server configuration
 type ServerConfig struct {
-	Port           string
-	Host           string
-	BaseURL        string
-	AllowedOrigins []string
+	Port                 string
+	Host                 string
+	FrontendBaseURL      string   // origin (and optional path) of the web UI, used for every generated link
+	AllowedOrigins       []string // exact origins, "*" or wildcard subdomains like https://*.vanish.dev
+	CORSAllowCredentials bool
+	TrustedProxies       []string // CIDRs/IPs whose X-Forwarded-For is honoured; empty trusts none
+	MinClientVersion     string   // oldest CLI release the server supports, reported by /api/version; empty for none
+	ServeFrontend        bool     // serve the embedded web UI at /
+	AdminStealthMode     bool     // answer non-admins on admin routes as if the route did not exist
+	DisableDefaultAdmin  bool     // deactivate admin@vanish.local at startup once another admin exists
+	SecurityHeaders      SecurityHeadersConfig
+	TLS                  TLSConfig
+	Timeouts             TimeoutConfig
+}
+
+// TimeoutConfig holds HTTP server timeouts
+// Read/Write apply to every request; UploadTimeout extends them on
+// routes that accept large or slow uploads (e.g. CSV import)
+type TimeoutConfig struct {
+	ReadHeader time.Duration
+	Read       time.Duration
+	Write      time.Duration
+	Idle       time.Duration
+	Shutdown   time.Duration
+	Upload     time.Duration
+}
+
+// TLSConfig holds settings for terminating TLS in the server itself
+type TLSConfig struct {
+	CertFile     string
+	KeyFile      string
+	RedirectPort string // optional plain-HTTP listener that redirects to HTTPS
+}
+
+// Enabled reports whether both a certificate and key are configured
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+// SecurityHeadersConfig holds HTTP security header settings
+type SecurityHeadersConfig struct {
+	ContentSecurityPolicy string
+	FrameAncestors        string // appended to the CSP as frame-ancestors when set
+	HSTSEnabled           bool
+	HSTSMaxAge            int64 // in seconds
+	PermissionsPolicy     string
+}
+
+// Security header defaults
+const (
+	DefaultContentSecurityPolicy = "default-src 'self'"
+	// DefaultFrontendContentSecurityPolicy also lets the served web UI load
+	// the data: images its stylesheet inlines
+	DefaultFrontendContentSecurityPolicy = "default-src 'self'; img-src 'self' data:; object-src 'none'; base-uri 'self'; form-action 'self'"
+	DefaultHSTSMaxAge                    = 31536000 // 1 year
+	DefaultPermissionsPolicy             = "camera=(), microphone=(), geolocation=(), payment=(), usb=()"
+)
+
+// DefaultSecurityHeaders returns the security header settings used when
+// no overrides are configured
+func DefaultSecurityHeaders() SecurityHeadersConfig {
+	return SecurityHeadersConfig{
+		ContentSecurityPolicy: DefaultContentSecurityPolicy,
+		HSTSEnabled:           true,
+		HSTSMaxAge:            DefaultHSTSMaxAge,
+		PermissionsPolicy:     DefaultPermissionsPolicy,
+	}
 }
 
 // RedisConfig holds Redis connection configuration
@@ -33,6 +121,25 @@ type RedisConfig struct {
 	Address  string
 	Password string
 	DB       int
+
+	// Regions are the clusters keeping the messages of users tagged with
+	// a data residency region; the cluster above keeps everyone else's
+	Regions []RedisRegion
+}
+
+// RedisRegion is the Redis cluster of one data residency region, read
+// from REDIS_<NAME>_ADDRESS, REDIS_<NAME>_PASSWORD and REDIS_<NAME>_DB for
+// each name listed in REDIS_REGIONS
+type RedisRegion struct {
+	Name     string
+	Address  string
+	Password string
+	DB       int
+}
+
+// String describes the region without its password, for diffs
+func (r RedisRegion) String() string {
+	return fmt.Sprintf("%s=%s/%d", r.Name, r.Address, r.DB)
 }
 
 // DatabaseConfig holds PostgreSQL configuration
@@ -51,11 +158,60 @@ type JWTConfig struct {
 	TokenDuration int64 // in hours
 }
 
+// PasswordConfig holds password hashing settings
+type PasswordConfig struct {
+	// BcryptCost is the cost of new password hashes. Lower costs speed up
+	// logins in load tests; release builds refuse anything below
+	// MinReleaseBcryptCost
+	BcryptCost int
+}
+
+// MinReleaseBcryptCost is the lowest BCRYPT_COST a release build accepts
+const MinReleaseBcryptCost = bcrypt.DefaultCost
+
+// AuthCookieConfig holds settings for cookie-based browser sessions
+// When enabled, login also sets an HttpOnly session cookie carrying the JWT
+// and a readable CSRF cookie for double-submit protection
+type AuthCookieConfig struct {
+	Enabled bool
+	Name    string
+	Domain  string // empty: host-only cookie
+	Secure  bool   // disable only for plain-HTTP development
+}
+
+// DefaultMaxMessageBytes is the MAX_MESSAGE_BYTES default
+const DefaultMaxMessageBytes = 1 << 20 // 1 MB
+
 // MessageConfig holds message-related configuration
 type MessageConfig struct {
 	DefaultTTL int64
 	MaxTTL     int64
 	MinTTL     int64
+
+	// MaxPendingPerRecipient caps unread messages waiting for one user; 0 disables the cap
+	MaxPendingPerRecipient int
+
+	// MaxMessageBytes is the largest ciphertext, as sent, accepted for one
+	// message; request bodies for /messages are capped at this plus room
+	// for the other fields
+	MaxMessageBytes int64
+
+	// AccessLogRetention is how long access attempts are kept; 0 keeps them forever
+	AccessLogRetention time.Duration
+
+	// OrphanScanInterval is how often Redis is scanned for messages without
+	// metadata; 0 leaves the scan to POST /admin/maintenance/scan-orphans
+	OrphanScanInterval time.Duration
+	// OrphanScanDelete makes the scheduled scan delete the orphans it finds
+	// rather than only report them
+	OrphanScanDelete bool
+	// OrphanGracePeriod is how old a message without metadata must be to
+	// count as an orphan, leaving time for the metadata of new messages
+	OrphanGracePeriod time.Duration
+
+	// ExternalRecipients lets senders address messages to an email address
+	// without an account, read with a signed link instead of signing in
+	ExternalRecipients bool
 }
 
 // OktaConfig holds Okta OIDC configuration
@@ -65,6 +221,42 @@ type OktaConfig struct {
 	ClientID     string
 	ClientSecret string
 	RedirectURL  string
+	RegionClaim  string        // claim setting the user's data residency region at sign-in; empty to ignore
+	Timeout      time.Duration // per-request timeout for Okta API calls
+}
+
+// SCIMConfig holds the SCIM 2.0 provisioning endpoint, which lets an
+// identity provider such as Okta create and deactivate accounts
+type SCIMConfig struct {
+	Enabled bool
+	Token   string // bearer token the identity provider authenticates with
+}
+
+// MinSCIMTokenLength is the shortest SCIM_TOKEN accepted
+const MinSCIMTokenLength = 32
+
+// LDAPConfig holds LDAP/Active Directory sign-in. Users are found by binding
+// as UserDNTemplate, or else by searching SearchBase with UserFilter
+type LDAPConfig struct {
+	Enabled       bool
+	URL           string
+	StartTLS      bool
+	TLSSkipVerify bool
+	CAFile        string
+
+	BindDN       string
+	BindPassword string
+
+	UserDNTemplate string
+	SearchBase     string
+	UserFilter     string
+
+	EmailAttribute string
+	NameAttribute  string
+	GroupAttribute string
+	AdminGroupDN   string // members of this group are admins
+
+	Timeout time.Duration
 }
 
 // VaultConfig holds HashiCorp Vault configuration
@@ -75,12 +267,28 @@ type VaultConfig struct {
 	Namespace string
 }
 
+// ColumnEncryptionConfig holds the master keys that encrypt stored message
+// keys in PostgreSQL
+type ColumnEncryptionConfig struct {
+	Keys       string // comma-separated version:base64-key pairs; empty reads them from Vault when enabled, else stores keys in plaintext
+	KeyVersion string // version new values are sealed under; defaults to the last key listed
+}
+
 // SlackConfig holds Slack integration configuration
 type SlackConfig struct {
 	Enabled       bool
 	BotToken      string
 	WebhookURL    string
 	SigningSecret string
+	StoreKey      bool // persist the server-generated key so recipients can reopen links from history
+
+	// OAuth credentials for installing the app into workspaces; BotToken
+	// then only serves workspaces without an installation of their own
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string // bot scopes requested at install; empty uses slack.DefaultScopes
+	AllowedTeams []string // workspace IDs the app may be installed into; empty allows any
 }
 
 // EmailConfig holds SMTP email configuration
@@ -94,19 +302,167 @@ type EmailConfig struct {
 	FromName     string
 }
 
+// NotificationConfig holds settings shared by Slack and email notifications
+type NotificationConfig struct {
+	DedupeWindow time.Duration // repeats of a notification to one recipient within this window are collapsed; 0 disables
+}
+
+// AbuseConfig holds the detector for repeated denied reads of one message
+type AbuseConfig struct {
+	Threshold  int           // alert once a message has more than this many denied attempts within Window; 0 disables
+	Window     time.Duration // sliding window the attempts are counted over
+	AutoRevoke bool          // also burn the message when the threshold is crossed
+	WebhookURL string        // receives a JSON alert for admins; empty sends none
+}
+
+// AlertConfig holds alerts to operators about faults in the server itself
+type AlertConfig struct {
+	OnPanic    bool   // post an alert to WebhookURL when a request handler panics
+	WebhookURL string // receives a JSON alert whose "text" field Slack incoming webhooks display
+}
+
+// DigestConfig holds the periodic admin digest posted to Slack
+type DigestConfig struct {
+	Schedule     string // cron expression in the server's local time, e.g. "0 9 * * 1"; empty disables the digest
+	SlackChannel string // channel ID or name the digest is posted to
+}
+
+// Enabled reports whether a digest schedule is configured
+func (d DigestConfig) Enabled() bool {
+	return d.Schedule != ""
+}
+
+// BackupConfig holds the encrypted backups of POST /admin/backup and the
+// restore command
+type BackupConfig struct {
+	Passphrase string // backups are encrypted with a key derived from it; empty disables POST /admin/backup
+}
+
+// MinBackupPassphraseLength is the shortest BACKUP_PASSPHRASE accepted
+const MinBackupPassphraseLength = 16
+
+// OutboundConfig holds settings for HTTP calls to integrations (Slack, Okta)
+// Okta keeps its own OKTA_TIMEOUT
+type OutboundConfig struct {
+	Timeout             time.Duration // per-request timeout
+	Proxy               string        // explicit proxy URL; empty uses HTTP_PROXY/HTTPS_PROXY/NO_PROXY
+	MaxIdleConnsPerHost int           // idle keep-alive connections kept per destination
+	AllowedNetworks     []string      // internal CIDRs webhooks may reach anyway; all others are refused
+}
+
+// HTTPClient builds the outbound client; timeout overrides OUTBOUND_HTTP_TIMEOUT when positive
+func (o OutboundConfig) HTTPClient(timeout time.Duration) (*http.Client, error) {
+	if timeout <= 0 {
+		timeout = o.Timeout
+	}
+	return httpclient.New(httpclient.Options{
+		Timeout:             timeout,
+		Proxy:               o.Proxy,
+		MaxIdleConnsPerHost: o.MaxIdleConnsPerHost,
+	})
+}
+
+// EgressPolicy returns the restrictions on admin-supplied destinations such
+// as webhooks: public addresses and OUTBOUND_ALLOWED_NETWORKS only, and
+// https only in release builds
+func (o OutboundConfig) EgressPolicy() *httpclient.EgressPolicy {
+	allowed, _ := httpclient.ParseAllowedNetworks(o.AllowedNetworks) // checked by Load
+	return &httpclient.EgressPolicy{Allowed: allowed, RequireHTTPS: buildinfo.Release()}
+}
+
+// WebhookClient builds the outbound client for webhooks, which enforces
+// EgressPolicy on every connection and follows no redirects
+func (o OutboundConfig) WebhookClient() (*http.Client, error) {
+	return httpclient.New(httpclient.Options{
+		Timeout:             o.Timeout,
+		Proxy:               o.Proxy,
+		MaxIdleConnsPerHost: o.MaxIdleConnsPerHost,
+		Egress:              o.EgressPolicy(),
+	})
+}
+
+// webhookCheckTimeout bounds resolving a webhook host while loading
+const webhookCheckTimeout = 5 * time.Second
+
+// validateWebhookURL checks a configured webhook against the egress policy
+func validateWebhookURL(policy *httpclient.EgressPolicy, key, raw string) error {
+	if raw == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), webhookCheckTimeout)
+	defer cancel()
+	if err := policy.ValidateURL(ctx, raw); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+// TracingConfig holds OpenTelemetry trace export settings
+// When disabled no instrumentation is installed at all
+type TracingConfig struct {
+	Enabled     bool
+	Endpoint    string // OTLP/HTTP collector base URL; /v1/traces is appended
+	ServiceName string // service.name of exported spans
+}
+
+// GRPCConfig holds settings for the optional gRPC listener
+// It shares SERVER_HOST and the TLS certificate with the HTTP server
+type GRPCConfig struct {
+	Enabled bool
+	Port    string
+}
+
+// StatsConfig holds admin statistics settings
+type StatsConfig struct {
+	LeaderboardsEnabled bool // rank users by messages sent and received; disable for privacy
+}
+
 // Load loads configuration from environment variables
 func Load() (*Config, error) {
+	serveFrontend := getEnvAsBool("SERVE_FRONTEND", false)
+	defaultCSP := DefaultContentSecurityPolicy
+	if serveFrontend {
+		defaultCSP = DefaultFrontendContentSecurityPolicy
+	}
+
 	config := &Config{
 		Server: ServerConfig{
-			Port:           getEnv("SERVER_PORT", "8080"),
-			Host:           getEnv("SERVER_HOST", "0.0.0.0"),
-			BaseURL:        getEnv("BASE_URL", "http://localhost:5173"),
-			AllowedOrigins: getEnvAsSlice("ALLOWED_ORIGINS", []string{"http://localhost:5173", "http://localhost:3000"}),
+			Port:                 getEnv("SERVER_PORT", "8080"),
+			Host:                 getEnv("SERVER_HOST", "0.0.0.0"),
+			FrontendBaseURL:      getEnv("FRONTEND_BASE_URL", getEnv("BASE_URL", "http://localhost:5173")),
+			AllowedOrigins:       getEnvAsSlice("ALLOWED_ORIGINS", []string{"http://localhost:5173", "http://localhost:3000"}),
+			CORSAllowCredentials: getEnvAsBool("CORS_ALLOW_CREDENTIALS", false),
+			TrustedProxies:       getEnvAsSlice("TRUSTED_PROXIES", nil),
+			MinClientVersion:     getEnv("MIN_CLIENT_VERSION", ""),
+			ServeFrontend:        serveFrontend,
+			AdminStealthMode:     getEnvAsBool("ADMIN_STEALTH_MODE", false),
+			DisableDefaultAdmin:  getEnvAsBool("DISABLE_DEFAULT_ADMIN", false),
+			SecurityHeaders: SecurityHeadersConfig{
+				ContentSecurityPolicy: getEnv("CSP_POLICY", defaultCSP),
+				FrameAncestors:        getEnv("CSP_FRAME_ANCESTORS", ""),
+				HSTSEnabled:           getEnvAsBool("HSTS_ENABLED", true),
+				HSTSMaxAge:            getEnvAsInt64("HSTS_MAX_AGE", DefaultHSTSMaxAge),
+				PermissionsPolicy:     getEnv("PERMISSIONS_POLICY", DefaultPermissionsPolicy),
+			},
+			Timeouts: TimeoutConfig{
+				ReadHeader: getEnvAsDuration("SERVER_READ_HEADER_TIMEOUT", 10*time.Second),
+				Read:       getEnvAsDuration("SERVER_READ_TIMEOUT", 30*time.Second),
+				Write:      getEnvAsDuration("SERVER_WRITE_TIMEOUT", 30*time.Second),
+				Idle:       getEnvAsDuration("SERVER_IDLE_TIMEOUT", 120*time.Second),
+				Shutdown:   getEnvAsDuration("SERVER_SHUTDOWN_TIMEOUT", 15*time.Second),
+				Upload:     getEnvAsDuration("SERVER_UPLOAD_TIMEOUT", 5*time.Minute),
+			},
+			TLS: TLSConfig{
+				CertFile:     getEnv("TLS_CERT_FILE", ""),
+				KeyFile:      getEnv("TLS_KEY_FILE", ""),
+				RedirectPort: getEnv("TLS_REDIRECT_PORT", ""),
+			},
 		},
 		Redis: RedisConfig{
 			Address:  getEnv("REDIS_ADDRESS", "localhost:6379"),
 			Password: getEnv("REDIS_PASSWORD", ""),
 			DB:       getEnvAsInt("REDIS_DB", 0),
+			Regions:  redisRegions(getEnvAsSlice("REDIS_REGIONS", nil)),
 		},
 		Database: DatabaseConfig{
 			Host:     getEnv("DB_HOST", "localhost"),
@@ -120,10 +476,29 @@ func Load() (*Config, error) {
 			SecretKey:     getEnv("JWT_SECRET", "change-me-in-production"),
 			TokenDuration: getEnvAsInt64("JWT_DURATION", 24), // 24 hours
 		},
+		Password: PasswordConfig{
+			BcryptCost: getEnvAsInt("BCRYPT_COST", bcrypt.DefaultCost),
+		},
+		Cookie: AuthCookieConfig{
+			Enabled: getEnvAsBool("AUTH_COOKIE_ENABLED", false),
+			Name:    getEnv("AUTH_COOKIE_NAME", "vanish_session"),
+			Domain:  getEnv("AUTH_COOKIE_DOMAIN", ""),
+			Secure:  getEnvAsBool("AUTH_COOKIE_SECURE", true),
+		},
 		Message: MessageConfig{
-			DefaultTTL: getEnvAsInt64("DEFAULT_TTL", 86400),  // 24 hours
-			MaxTTL:     getEnvAsInt64("MAX_TTL", 604800),     // 7 days
-			MinTTL:     getEnvAsInt64("MIN_TTL", 3600),       // 1 hour
+			DefaultTTL: getEnvAsInt64("DEFAULT_TTL", 86400), // 24 hours
+			MaxTTL:     getEnvAsInt64("MAX_TTL", 604800),    // 7 days
+			MinTTL:     getEnvAsInt64("MIN_TTL", 3600),      // 1 hour
+
+			MaxPendingPerRecipient: getEnvAsInt("MAX_PENDING_PER_RECIPIENT", 100),
+			MaxMessageBytes:        getEnvAsInt64("MAX_MESSAGE_BYTES", DefaultMaxMessageBytes),
+			AccessLogRetention:     getEnvAsDuration("ACCESS_LOG_RETENTION", 90*24*time.Hour),
+
+			OrphanScanInterval: getEnvAsDuration("ORPHAN_SCAN_INTERVAL", 0),
+			OrphanScanDelete:   getEnvAsBool("ORPHAN_SCAN_DELETE", false),
+			OrphanGracePeriod:  getEnvAsDuration("ORPHAN_GRACE_PERIOD", time.Hour),
+
+			ExternalRecipients: getEnvAsBool("EXTERNAL_RECIPIENTS_ENABLED", false),
 		},
 		Okta: OktaConfig{
 			Enabled:      getEnvAsBool("OKTA_ENABLED", false),
@@ -131,6 +506,29 @@ func Load() (*Config, error) {
 			ClientID:     getEnv("OKTA_CLIENT_ID", ""),
 			ClientSecret: getEnv("OKTA_CLIENT_SECRET", ""),
 			RedirectURL:  getEnv("OKTA_REDIRECT_URL", ""),
+			RegionClaim:  getEnv("OKTA_REGION_CLAIM", ""),
+			Timeout:      getEnvAsDuration("OKTA_TIMEOUT", 10*time.Second),
+		},
+		SCIM: SCIMConfig{
+			Enabled: getEnvAsBool("SCIM_ENABLED", false),
+			Token:   getEnv("SCIM_TOKEN", ""),
+		},
+		LDAP: LDAPConfig{
+			Enabled:        getEnvAsBool("AUTH_LDAP_ENABLED", false),
+			URL:            getEnv("AUTH_LDAP_URL", ""),
+			StartTLS:       getEnvAsBool("AUTH_LDAP_START_TLS", false),
+			TLSSkipVerify:  getEnvAsBool("AUTH_LDAP_TLS_SKIP_VERIFY", false),
+			CAFile:         getEnv("AUTH_LDAP_CA_FILE", ""),
+			BindDN:         getEnv("AUTH_LDAP_BIND_DN", ""),
+			BindPassword:   getEnv("AUTH_LDAP_BIND_PASSWORD", ""),
+			UserDNTemplate: getEnv("AUTH_LDAP_USER_DN_TEMPLATE", ""),
+			SearchBase:     getEnv("AUTH_LDAP_USER_SEARCH_BASE", ""),
+			UserFilter:     getEnv("AUTH_LDAP_USER_FILTER", "(mail=%s)"),
+			EmailAttribute: getEnv("AUTH_LDAP_EMAIL_ATTRIBUTE", "mail"),
+			NameAttribute:  getEnv("AUTH_LDAP_NAME_ATTRIBUTE", "cn"),
+			GroupAttribute: getEnv("AUTH_LDAP_GROUP_ATTRIBUTE", "memberOf"),
+			AdminGroupDN:   getEnv("AUTH_LDAP_ADMIN_GROUP_DN", ""),
+			Timeout:        getEnvAsDuration("AUTH_LDAP_TIMEOUT", 10*time.Second),
 		},
 		Vault: VaultConfig{
 			Enabled:   getEnvAsBool("VAULT_ENABLED", false),
@@ -138,11 +536,21 @@ func Load() (*Config, error) {
 			Token:     getEnv("VAULT_TOKEN", ""),
 			Namespace: getEnv("VAULT_NAMESPACE", ""),
 		},
+		Crypto: ColumnEncryptionConfig{
+			Keys:       getEnv("METADATA_ENCRYPTION_KEYS", ""),
+			KeyVersion: getEnv("METADATA_ENCRYPTION_KEY_VERSION", ""),
+		},
 		Slack: SlackConfig{
 			Enabled:       getEnvAsBool("SLACK_ENABLED", false),
 			BotToken:      getEnv("SLACK_BOT_TOKEN", ""),
 			WebhookURL:    getEnv("SLACK_WEBHOOK_URL", ""),
 			SigningSecret: getEnv("SLACK_SIGNING_SECRET", ""),
+			StoreKey:      getEnvAsBool("SLACK_STORE_KEY", true),
+			ClientID:      getEnv("SLACK_CLIENT_ID", ""),
+			ClientSecret:  getEnv("SLACK_CLIENT_SECRET", ""),
+			RedirectURL:   getEnv("SLACK_REDIRECT_URL", ""),
+			Scopes:        getEnvAsSlice("SLACK_SCOPES", nil),
+			AllowedTeams:  getEnvAsSlice("SLACK_ALLOWED_TEAMS", nil),
 		},
 		Email: EmailConfig{
 			Enabled:      getEnvAsBool("EMAIL_ENABLED", false),
@@ -153,11 +561,179 @@ func Load() (*Config, error) {
 			FromAddress:  getEnv("EMAIL_FROM_ADDRESS", "noreply@vanish.local"),
 			FromName:     getEnv("EMAIL_FROM_NAME", "Vanish"),
 		},
+		Notify: NotificationConfig{
+			DedupeWindow: getEnvAsDuration("NOTIFICATION_DEDUPE_WINDOW", 10*time.Minute),
+		},
+		Stats: StatsConfig{
+			LeaderboardsEnabled: getEnvAsBool("STATS_LEADERBOARDS_ENABLED", true),
+		},
+		Abuse: AbuseConfig{
+			Threshold:  getEnvAsInt("ABUSE_DENIED_THRESHOLD", 5),
+			Window:     getEnvAsDuration("ABUSE_WINDOW", time.Hour),
+			AutoRevoke: getEnvAsBool("AUTO_REVOKE_ON_ABUSE", false),
+			WebhookURL: getEnv("ABUSE_WEBHOOK_URL", ""),
+		},
+		Alert: AlertConfig{
+			OnPanic:    getEnvAsBool("ALERT_ON_PANIC", false),
+			WebhookURL: getEnv("ALERT_WEBHOOK_URL", ""),
+		},
+		Digest: DigestConfig{
+			Schedule:     getEnv("DIGEST_SCHEDULE", ""),
+			SlackChannel: getEnv("DIGEST_SLACK_CHANNEL", ""),
+		},
+		Backup: BackupConfig{
+			Passphrase: getEnv("BACKUP_PASSPHRASE", ""),
+		},
+		Outbound: OutboundConfig{
+			Timeout:             getEnvAsDuration("OUTBOUND_HTTP_TIMEOUT", httpclient.DefaultTimeout),
+			Proxy:               getEnv("OUTBOUND_HTTP_PROXY", ""),
+			MaxIdleConnsPerHost: getEnvAsInt("OUTBOUND_HTTP_MAX_IDLE_CONNS_PER_HOST", httpclient.DefaultMaxIdleConnsPerHost),
+			AllowedNetworks:     getEnvAsSlice("OUTBOUND_ALLOWED_NETWORKS", nil),
+		},
+		Tracing: TracingConfig{
+			Enabled:     getEnvAsBool("OTEL_ENABLED", false),
+			Endpoint:    getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://localhost:4318"),
+			ServiceName: getEnv("OTEL_SERVICE_NAME", "vanish-backend"),
+		},
+		GRPC: GRPCConfig{
+			Enabled: getEnvAsBool("GRPC_ENABLED", false),
+			Port:    getEnv("GRPC_PORT", "9090"),
+		},
+	}
+
+	tls := config.Server.TLS
+	if (tls.CertFile == "") != (tls.KeyFile == "") {
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	if tls.RedirectPort != "" && !tls.Enabled() {
+		return nil, fmt.Errorf("TLS_REDIRECT_PORT requires TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	if config.GRPC.Enabled && (config.GRPC.Port == config.Server.Port || config.GRPC.Port == tls.RedirectPort) {
+		return nil, fmt.Errorf("GRPC_PORT must differ from SERVER_PORT and TLS_REDIRECT_PORT")
+	}
+	if err := validateRedisRegions(config.Redis.Regions); err != nil {
+		return nil, err
+	}
+	if config.SCIM.Enabled && len(config.SCIM.Token) < MinSCIMTokenLength {
+		return nil, fmt.Errorf("SCIM_TOKEN must be at least %d characters when SCIM_ENABLED is set", MinSCIMTokenLength)
+	}
+	if config.LDAP.Enabled {
+		if u, err := url.Parse(config.LDAP.URL); err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+			return nil, fmt.Errorf("AUTH_LDAP_URL must be an ldap:// or ldaps:// URL when AUTH_LDAP_ENABLED is set")
+		}
+		if config.LDAP.UserDNTemplate == "" && config.LDAP.SearchBase == "" {
+			return nil, fmt.Errorf("AUTH_LDAP_USER_DN_TEMPLATE or AUTH_LDAP_USER_SEARCH_BASE is required when AUTH_LDAP_ENABLED is set")
+		}
+		if (config.LDAP.BindDN == "") != (config.LDAP.BindPassword == "") {
+			return nil, fmt.Errorf("AUTH_LDAP_BIND_DN and AUTH_LDAP_BIND_PASSWORD must be set together")
+		}
+	}
+	if err := urlbuilder.Validate(config.Server.FrontendBaseURL); err != nil {
+		return nil, fmt.Errorf("FRONTEND_BASE_URL: %w", err)
+	}
+	if err := httpclient.ValidateProxy(config.Outbound.Proxy); err != nil {
+		return nil, fmt.Errorf("OUTBOUND_HTTP_PROXY: %w", err)
+	}
+	if config.Message.MaxMessageBytes <= 0 {
+		return nil, fmt.Errorf("MAX_MESSAGE_BYTES must be positive")
+	}
+	if config.Message.OrphanScanInterval < 0 || config.Message.OrphanGracePeriod < 0 {
+		return nil, fmt.Errorf("ORPHAN_SCAN_INTERVAL and ORPHAN_GRACE_PERIOD must not be negative")
+	}
+	if config.Notify.DedupeWindow < 0 {
+		return nil, fmt.Errorf("NOTIFICATION_DEDUPE_WINDOW must not be negative")
+	}
+	if config.Abuse.Threshold > 0 && config.Abuse.Window <= 0 {
+		return nil, fmt.Errorf("ABUSE_WINDOW must be positive when ABUSE_DENIED_THRESHOLD is set")
+	}
+	if config.Digest.Enabled() {
+		if _, err := cron.Parse(config.Digest.Schedule); err != nil {
+			return nil, fmt.Errorf("DIGEST_SCHEDULE: %w", err)
+		}
+		if config.Digest.SlackChannel == "" {
+			return nil, fmt.Errorf("DIGEST_SLACK_CHANNEL is required when DIGEST_SCHEDULE is set")
+		}
+	}
+	if config.Backup.Passphrase != "" && len(config.Backup.Passphrase) < MinBackupPassphraseLength {
+		return nil, fmt.Errorf("BACKUP_PASSPHRASE must be at least %d characters", MinBackupPassphraseLength)
+	}
+	if _, err := httpclient.ParseAllowedNetworks(config.Outbound.AllowedNetworks); err != nil {
+		return nil, fmt.Errorf("OUTBOUND_ALLOWED_NETWORKS: %w", err)
+	}
+	egress := config.Outbound.EgressPolicy()
+	if err := validateWebhookURL(egress, "ABUSE_WEBHOOK_URL", config.Abuse.WebhookURL); err != nil {
+		return nil, err
+	}
+	if err := validateWebhookURL(egress, "SLACK_WEBHOOK_URL", config.Slack.WebhookURL); err != nil {
+		return nil, err
+	}
+	if config.Alert.OnPanic && config.Alert.WebhookURL == "" {
+		return nil, fmt.Errorf("ALERT_WEBHOOK_URL is required when ALERT_ON_PANIC is enabled")
+	}
+	if err := validateWebhookURL(egress, "ALERT_WEBHOOK_URL", config.Alert.WebhookURL); err != nil {
+		return nil, err
+	}
+	if config.Slack.ClientID != "" {
+		if config.Slack.ClientSecret == "" {
+			return nil, fmt.Errorf("SLACK_CLIENT_SECRET is required when SLACK_CLIENT_ID is set")
+		}
+		if u, err := url.Parse(config.Slack.RedirectURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("SLACK_REDIRECT_URL must be an absolute http(s) URL when SLACK_CLIENT_ID is set")
+		}
+	}
+	if config.Tracing.Enabled {
+		if u, err := url.Parse(config.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("OTEL_EXPORTER_OTLP_ENDPOINT must be an absolute http(s) URL when OTEL_ENABLED is set")
+		}
+	}
+	if cost := config.Password.BcryptCost; cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("BCRYPT_COST must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	if buildinfo.Release() && config.Password.BcryptCost < MinReleaseBcryptCost {
+		return nil, fmt.Errorf("BCRYPT_COST must be at least %d in release builds", MinReleaseBcryptCost)
+	}
+	if config.Cookie.Enabled && config.Cookie.Name == "" {
+		return nil, fmt.Errorf("AUTH_COOKIE_NAME must not be empty when AUTH_COOKIE_ENABLED is set")
 	}
 
 	return config, nil
 }
 
+// redisRegions reads the cluster of each named region
+func redisRegions(names []string) []RedisRegion {
+	regions := make([]RedisRegion, 0, len(names))
+	for _, name := range names {
+		prefix := "REDIS_" + strings.ToUpper(name) + "_"
+		regions = append(regions, RedisRegion{
+			Name:     name,
+			Address:  getEnv(prefix+"ADDRESS", ""),
+			Password: getEnv(prefix+"PASSWORD", ""),
+			DB:       getEnvAsInt(prefix+"DB", 0),
+		})
+	}
+	return regions
+}
+
+// validateRedisRegions checks that every region has a valid, unique name
+// and an address
+func validateRedisRegions(regions []RedisRegion) error {
+	seen := make(map[string]bool, len(regions))
+	for _, region := range regions {
+		if !models.ValidRegion(region.Name) {
+			return fmt.Errorf("REDIS_REGIONS: %q is not a valid region name (lowercase letters and digits, at most %d, not %q)",
+				region.Name, models.MaxRegionLength, models.DefaultRegion)
+		}
+		if seen[region.Name] {
+			return fmt.Errorf("REDIS_REGIONS: region %q is listed twice", region.Name)
+		}
+		seen[region.Name] = true
+		if region.Address == "" {
+			return fmt.Errorf("REDIS_%s_ADDRESS is required for region %q", strings.ToUpper(region.Name), region.Name)
+		}
+	}
+	return nil
+}
+
 // getEnvAsBool gets an environment variable as boolean
 func getEnvAsBool(key string, defaultValue bool) bool {
 	valueStr := getEnv(key, "")
@@ -191,6 +767,26 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return value
 }
 
+// getEnvAsDuration gets an environment variable as a duration ("30s", "5m")
+// Plain integers are interpreted as seconds
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+
+	if seconds, err := strconv.ParseInt(valueStr, 10, 64); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	value, err := time.ParseDuration(valueStr)
+	if err != nil {
+		return defaultValue
+	}
+
+	return value
+}
+
 // getEnvAsInt64 gets an environment variable as int64 with a fallback
 func getEnvAsInt64(key string, defaultValue int64) int64 {
 	valueStr := getEnv(key, "")
@@ -213,7 +809,13 @@ func getEnvAsSlice(key string, defaultValue []string) []string {
 		return defaultValue
 	}
 
-	return strings.Split(valueStr, ",")
+	var values []string
+	for _, v := range strings.Split(valueStr, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
 }
 
 // Address returns the full server address
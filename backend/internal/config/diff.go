@@ -0,0 +1,210 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Change is one setting that differs between two configurations
+type Change struct {
+	Key        string // environment variable, e.g. SLACK_ENABLED
+	Old, New   string // empty for secrets, which are never reported
+	Secret     bool
+	Reloadable bool // applied by a reload; otherwise it needs a restart
+}
+
+// setting describes how one environment variable is compared
+type setting struct {
+	key        string
+	secret     bool
+	reloadable bool
+	value      func(*Config) interface{}
+}
+
+// settings lists every variable Load reads. Only the integration clients
+// (Slack, email, Okta and the outbound HTTP settings they are built with)
+// can be swapped while the server runs; everything else is wired into
+// connections, listeners or handlers at startup
+var settings = []setting{
+	{"SERVER_PORT", false, false, func(c *Config) interface{} { return c.Server.Port }},
+	{"SERVER_HOST", false, false, func(c *Config) interface{} { return c.Server.Host }},
+	{"FRONTEND_BASE_URL", false, false, func(c *Config) interface{} { return c.Server.FrontendBaseURL }},
+	{"ALLOWED_ORIGINS", false, false, func(c *Config) interface{} { return strings.Join(c.Server.AllowedOrigins, ",") }},
+	{"CORS_ALLOW_CREDENTIALS", false, false, func(c *Config) interface{} { return c.Server.CORSAllowCredentials }},
+	{"TRUSTED_PROXIES", false, false, func(c *Config) interface{} { return strings.Join(c.Server.TrustedProxies, ",") }},
+	{"MIN_CLIENT_VERSION", false, false, func(c *Config) interface{} { return c.Server.MinClientVersion }},
+	{"SERVE_FRONTEND", false, false, func(c *Config) interface{} { return c.Server.ServeFrontend }},
+	{"ADMIN_STEALTH_MODE", false, false, func(c *Config) interface{} { return c.Server.AdminStealthMode }},
+	{"DISABLE_DEFAULT_ADMIN", false, false, func(c *Config) interface{} { return c.Server.DisableDefaultAdmin }},
+	{"CSP_POLICY", false, false, func(c *Config) interface{} { return c.Server.SecurityHeaders.ContentSecurityPolicy }},
+	{"CSP_FRAME_ANCESTORS", false, false, func(c *Config) interface{} { return c.Server.SecurityHeaders.FrameAncestors }},
+	{"HSTS_ENABLED", false, false, func(c *Config) interface{} { return c.Server.SecurityHeaders.HSTSEnabled }},
+	{"HSTS_MAX_AGE", false, false, func(c *Config) interface{} { return c.Server.SecurityHeaders.HSTSMaxAge }},
+	{"PERMISSIONS_POLICY", false, false, func(c *Config) interface{} { return c.Server.SecurityHeaders.PermissionsPolicy }},
+	{"SERVER_READ_HEADER_TIMEOUT", false, false, func(c *Config) interface{} { return c.Server.Timeouts.ReadHeader }},
+	{"SERVER_READ_TIMEOUT", false, false, func(c *Config) interface{} { return c.Server.Timeouts.Read }},
+	{"SERVER_WRITE_TIMEOUT", false, false, func(c *Config) interface{} { return c.Server.Timeouts.Write }},
+	{"SERVER_IDLE_TIMEOUT", false, false, func(c *Config) interface{} { return c.Server.Timeouts.Idle }},
+	{"SERVER_SHUTDOWN_TIMEOUT", false, false, func(c *Config) interface{} { return c.Server.Timeouts.Shutdown }},
+	{"SERVER_UPLOAD_TIMEOUT", false, false, func(c *Config) interface{} { return c.Server.Timeouts.Upload }},
+	{"TLS_CERT_FILE", false, false, func(c *Config) interface{} { return c.Server.TLS.CertFile }},
+	{"TLS_KEY_FILE", false, false, func(c *Config) interface{} { return c.Server.TLS.KeyFile }},
+	{"TLS_REDIRECT_PORT", false, false, func(c *Config) interface{} { return c.Server.TLS.RedirectPort }},
+
+	{"REDIS_ADDRESS", false, false, func(c *Config) interface{} { return c.Redis.Address }},
+	{"REDIS_PASSWORD", true, false, func(c *Config) interface{} { return c.Redis.Password }},
+	{"REDIS_DB", false, false, func(c *Config) interface{} { return c.Redis.DB }},
+	{"REDIS_REGIONS", false, false, func(c *Config) interface{} { return c.Redis.Regions }},
+	{"REDIS_<NAME>_PASSWORD", true, false, func(c *Config) interface{} { return redisRegionPasswords(c.Redis.Regions) }},
+
+	{"DB_HOST", false, false, func(c *Config) interface{} { return c.Database.Host }},
+	{"DB_PORT", false, false, func(c *Config) interface{} { return c.Database.Port }},
+	{"DB_USER", false, false, func(c *Config) interface{} { return c.Database.User }},
+	{"DB_PASSWORD", true, false, func(c *Config) interface{} { return c.Database.Password }},
+	{"DB_NAME", false, false, func(c *Config) interface{} { return c.Database.DBName }},
+	{"DB_SSLMODE", false, false, func(c *Config) interface{} { return c.Database.SSLMode }},
+
+	{"JWT_SECRET", true, false, func(c *Config) interface{} { return c.JWT.SecretKey }},
+	{"JWT_DURATION", false, false, func(c *Config) interface{} { return c.JWT.TokenDuration }},
+	{"BCRYPT_COST", false, false, func(c *Config) interface{} { return c.Password.BcryptCost }},
+
+	{"AUTH_COOKIE_ENABLED", false, false, func(c *Config) interface{} { return c.Cookie.Enabled }},
+	{"AUTH_COOKIE_NAME", false, false, func(c *Config) interface{} { return c.Cookie.Name }},
+	{"AUTH_COOKIE_DOMAIN", false, false, func(c *Config) interface{} { return c.Cookie.Domain }},
+	{"AUTH_COOKIE_SECURE", false, false, func(c *Config) interface{} { return c.Cookie.Secure }},
+
+	{"DEFAULT_TTL", false, false, func(c *Config) interface{} { return c.Message.DefaultTTL }},
+	{"MAX_TTL", false, false, func(c *Config) interface{} { return c.Message.MaxTTL }},
+	{"MIN_TTL", false, false, func(c *Config) interface{} { return c.Message.MinTTL }},
+	{"MAX_PENDING_PER_RECIPIENT", false, false, func(c *Config) interface{} { return c.Message.MaxPendingPerRecipient }},
+	{"MAX_MESSAGE_BYTES", false, false, func(c *Config) interface{} { return c.Message.MaxMessageBytes }},
+	{"ACCESS_LOG_RETENTION", false, false, func(c *Config) interface{} { return c.Message.AccessLogRetention }},
+	{"ORPHAN_SCAN_INTERVAL", false, false, func(c *Config) interface{} { return c.Message.OrphanScanInterval }},
+	{"ORPHAN_SCAN_DELETE", false, false, func(c *Config) interface{} { return c.Message.OrphanScanDelete }},
+	{"ORPHAN_GRACE_PERIOD", false, false, func(c *Config) interface{} { return c.Message.OrphanGracePeriod }},
+	{"EXTERNAL_RECIPIENTS_ENABLED", false, false, func(c *Config) interface{} { return c.Message.ExternalRecipients }},
+
+	{"OKTA_ENABLED", false, true, func(c *Config) interface{} { return c.Okta.Enabled }},
+	{"OKTA_DOMAIN", false, true, func(c *Config) interface{} { return c.Okta.Domain }},
+	{"OKTA_CLIENT_ID", false, true, func(c *Config) interface{} { return c.Okta.ClientID }},
+	{"OKTA_CLIENT_SECRET", true, true, func(c *Config) interface{} { return c.Okta.ClientSecret }},
+	{"OKTA_REDIRECT_URL", false, true, func(c *Config) interface{} { return c.Okta.RedirectURL }},
+	{"OKTA_REGION_CLAIM", false, true, func(c *Config) interface{} { return c.Okta.RegionClaim }},
+	{"OKTA_TIMEOUT", false, true, func(c *Config) interface{} { return c.Okta.Timeout }},
+
+	{"SCIM_ENABLED", false, false, func(c *Config) interface{} { return c.SCIM.Enabled }},
+	{"SCIM_TOKEN", true, false, func(c *Config) interface{} { return c.SCIM.Token }},
+
+	{"AUTH_LDAP_ENABLED", false, false, func(c *Config) interface{} { return c.LDAP.Enabled }},
+	{"AUTH_LDAP_URL", false, false, func(c *Config) interface{} { return c.LDAP.URL }},
+	{"AUTH_LDAP_START_TLS", false, false, func(c *Config) interface{} { return c.LDAP.StartTLS }},
+	{"AUTH_LDAP_TLS_SKIP_VERIFY", false, false, func(c *Config) interface{} { return c.LDAP.TLSSkipVerify }},
+	{"AUTH_LDAP_CA_FILE", false, false, func(c *Config) interface{} { return c.LDAP.CAFile }},
+	{"AUTH_LDAP_BIND_DN", false, false, func(c *Config) interface{} { return c.LDAP.BindDN }},
+	{"AUTH_LDAP_BIND_PASSWORD", true, false, func(c *Config) interface{} { return c.LDAP.BindPassword }},
+	{"AUTH_LDAP_USER_DN_TEMPLATE", false, false, func(c *Config) interface{} { return c.LDAP.UserDNTemplate }},
+	{"AUTH_LDAP_USER_SEARCH_BASE", false, false, func(c *Config) interface{} { return c.LDAP.SearchBase }},
+	{"AUTH_LDAP_USER_FILTER", false, false, func(c *Config) interface{} { return c.LDAP.UserFilter }},
+	{"AUTH_LDAP_EMAIL_ATTRIBUTE", false, false, func(c *Config) interface{} { return c.LDAP.EmailAttribute }},
+	{"AUTH_LDAP_NAME_ATTRIBUTE", false, false, func(c *Config) interface{} { return c.LDAP.NameAttribute }},
+	{"AUTH_LDAP_GROUP_ATTRIBUTE", false, false, func(c *Config) interface{} { return c.LDAP.GroupAttribute }},
+	{"AUTH_LDAP_ADMIN_GROUP_DN", false, false, func(c *Config) interface{} { return c.LDAP.AdminGroupDN }},
+	{"AUTH_LDAP_TIMEOUT", false, false, func(c *Config) interface{} { return c.LDAP.Timeout }},
+
+	{"VAULT_ENABLED", false, false, func(c *Config) interface{} { return c.Vault.Enabled }},
+	{"VAULT_ADDR", false, false, func(c *Config) interface{} { return c.Vault.Address }},
+	{"VAULT_TOKEN", true, false, func(c *Config) interface{} { return c.Vault.Token }},
+	{"VAULT_NAMESPACE", false, false, func(c *Config) interface{} { return c.Vault.Namespace }},
+	{"METADATA_ENCRYPTION_KEYS", true, false, func(c *Config) interface{} { return c.Crypto.Keys }},
+	{"METADATA_ENCRYPTION_KEY_VERSION", false, false, func(c *Config) interface{} { return c.Crypto.KeyVersion }},
+
+	{"SLACK_ENABLED", false, true, func(c *Config) interface{} { return c.Slack.Enabled }},
+	{"SLACK_BOT_TOKEN", true, true, func(c *Config) interface{} { return c.Slack.BotToken }},
+	{"SLACK_WEBHOOK_URL", true, true, func(c *Config) interface{} { return c.Slack.WebhookURL }},
+	{"SLACK_SIGNING_SECRET", true, true, func(c *Config) interface{} { return c.Slack.SigningSecret }},
+	{"SLACK_STORE_KEY", false, false, func(c *Config) interface{} { return c.Slack.StoreKey }},
+	{"SLACK_CLIENT_ID", false, true, func(c *Config) interface{} { return c.Slack.ClientID }},
+	{"SLACK_CLIENT_SECRET", true, true, func(c *Config) interface{} { return c.Slack.ClientSecret }},
+	{"SLACK_REDIRECT_URL", false, true, func(c *Config) interface{} { return c.Slack.RedirectURL }},
+	{"SLACK_SCOPES", false, true, func(c *Config) interface{} { return c.Slack.Scopes }},
+	{"SLACK_ALLOWED_TEAMS", false, true, func(c *Config) interface{} { return c.Slack.AllowedTeams }},
+
+	{"EMAIL_ENABLED", false, true, func(c *Config) interface{} { return c.Email.Enabled }},
+	{"SMTP_HOST", false, true, func(c *Config) interface{} { return c.Email.SMTPHost }},
+	{"SMTP_PORT", false, true, func(c *Config) interface{} { return c.Email.SMTPPort }},
+	{"SMTP_USER", false, true, func(c *Config) interface{} { return c.Email.SMTPUser }},
+	{"SMTP_PASSWORD", true, true, func(c *Config) interface{} { return c.Email.SMTPPassword }},
+	{"EMAIL_FROM_ADDRESS", false, true, func(c *Config) interface{} { return c.Email.FromAddress }},
+	{"EMAIL_FROM_NAME", false, true, func(c *Config) interface{} { return c.Email.FromName }},
+
+	{"NOTIFICATION_DEDUPE_WINDOW", false, false, func(c *Config) interface{} { return c.Notify.DedupeWindow }},
+
+	{"STATS_LEADERBOARDS_ENABLED", false, false, func(c *Config) interface{} { return c.Stats.LeaderboardsEnabled }},
+
+	{"ABUSE_DENIED_THRESHOLD", false, false, func(c *Config) interface{} { return c.Abuse.Threshold }},
+	{"ABUSE_WINDOW", false, false, func(c *Config) interface{} { return c.Abuse.Window }},
+	{"AUTO_REVOKE_ON_ABUSE", false, false, func(c *Config) interface{} { return c.Abuse.AutoRevoke }},
+	{"ABUSE_WEBHOOK_URL", true, false, func(c *Config) interface{} { return c.Abuse.WebhookURL }},
+
+	{"ALERT_ON_PANIC", false, false, func(c *Config) interface{} { return c.Alert.OnPanic }},
+	{"ALERT_WEBHOOK_URL", true, false, func(c *Config) interface{} { return c.Alert.WebhookURL }},
+
+	{"DIGEST_SCHEDULE", false, false, func(c *Config) interface{} { return c.Digest.Schedule }},
+	{"DIGEST_SLACK_CHANNEL", false, false, func(c *Config) interface{} { return c.Digest.SlackChannel }},
+
+	{"BACKUP_PASSPHRASE", true, false, func(c *Config) interface{} { return c.Backup.Passphrase }},
+
+	{"OUTBOUND_HTTP_TIMEOUT", false, true, func(c *Config) interface{} { return c.Outbound.Timeout }},
+	{"OUTBOUND_HTTP_PROXY", true, true, func(c *Config) interface{} { return c.Outbound.Proxy }},
+	{"OUTBOUND_HTTP_MAX_IDLE_CONNS_PER_HOST", false, true, func(c *Config) interface{} { return c.Outbound.MaxIdleConnsPerHost }},
+	{"OUTBOUND_ALLOWED_NETWORKS", false, false, func(c *Config) interface{} { return c.Outbound.AllowedNetworks }},
+
+	{"OTEL_ENABLED", false, false, func(c *Config) interface{} { return c.Tracing.Enabled }},
+	{"OTEL_EXPORTER_OTLP_ENDPOINT", false, false, func(c *Config) interface{} { return c.Tracing.Endpoint }},
+	{"OTEL_SERVICE_NAME", false, false, func(c *Config) interface{} { return c.Tracing.ServiceName }},
+
+	{"GRPC_ENABLED", false, false, func(c *Config) interface{} { return c.GRPC.Enabled }},
+	{"GRPC_PORT", false, false, func(c *Config) interface{} { return c.GRPC.Port }},
+}
+
+// redisRegionPasswords lists the password of each region, which the
+// description of REDIS_REGIONS leaves out
+func redisRegionPasswords(regions []RedisRegion) []string {
+	passwords := make([]string, len(regions))
+	for i, region := range regions {
+		passwords[i] = region.Password
+	}
+	return passwords
+}
+
+// Diff lists the settings that differ between old and next, in the order
+// Load reads them. Secret values are left out of the result
+func Diff(old, next *Config) []Change {
+	var changes []Change
+	for _, s := range settings {
+		before, after := fmt.Sprint(s.value(old)), fmt.Sprint(s.value(next))
+		if before == after {
+			continue
+		}
+		change := Change{Key: s.key, Secret: s.secret, Reloadable: s.reloadable}
+		if !s.secret {
+			change.Old, change.New = before, after
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// ApplyReloadable returns a copy of c with every reloadable setting taken
+// from next; the rest stay as they are until a restart
+func (c *Config) ApplyReloadable(next *Config) *Config {
+	applied := *c
+	applied.Okta = next.Okta
+	applied.Email = next.Email
+	applied.Outbound = next.Outbound
+
+	storeKey := applied.Slack.StoreKey
+	applied.Slack = next.Slack
+	applied.Slack.StoreKey = storeKey
+	return &applied
+}
@@ -5,18 +5,32 @@ import (
 	"crypto/rand"
 	"database/sql"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
 	"github.com/milkiss/vanish/backend/internal/models"
-	"github.com/milkiss/vanish/backend/internal/repository"
+	"github.com/milkiss/vanish/backend/internal/persistence"
 )
 
 const (
-	defaultAdminEmail = "admin@vanish.local"
+	// DefaultAdminEmail is the email of the admin account created on first run
+	DefaultAdminEmail = "admin@vanish.local"
 	defaultAdminName  = "Admin"
 	passwordLength    = 16 // Characters in generated password
+
+	// DefaultAdminStaleAfter is how long the default admin may stay active
+	// without signing in before startup warns about it
+	DefaultAdminStaleAfter = 30 * 24 * time.Hour
+)
+
+var (
+	// ErrNoDefaultAdmin is returned when the default admin account does not exist
+	ErrNoDefaultAdmin = errors.New("default admin account does not exist")
+	// ErrOnlyAdmin is returned when disabling the default admin would leave
+	// no active admin
+	ErrOnlyAdmin = errors.New("default admin is the only active admin")
 )
 
 // generateRandomPassword creates a cryptographically secure random password
@@ -38,12 +52,12 @@ func generateRandomPassword(length int) (string, error) {
 
 // CreateDefaultAdmin creates a default admin account on first run
 // Returns true if admin was created, false if already exists
-func CreateDefaultAdmin(db *sql.DB, userRepo *repository.UserRepository) (bool, error) {
+func CreateDefaultAdmin(db *sql.DB, userRepo persistence.UserStore) (bool, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	// Check if admin already exists
-	existingAdmin, err := userRepo.FindByEmail(ctx, defaultAdminEmail)
+	existingAdmin, err := userRepo.FindByEmail(ctx, DefaultAdminEmail)
 	if err != nil && err != models.ErrInvalidCredentials {
 		return false, fmt.Errorf("failed to check for existing admin: %w", err)
 	}
@@ -67,7 +81,7 @@ func CreateDefaultAdmin(db *sql.DB, userRepo *repository.UserRepository) (bool,
 
 	// Create admin user
 	admin := &models.User{
-		Email:    defaultAdminEmail,
+		Email:    DefaultAdminEmail,
 		Name:     defaultAdminName,
 		Password: hashedPassword,
 		IsAdmin:  true, // Mark as admin
@@ -77,17 +91,102 @@ func CreateDefaultAdmin(db *sql.DB, userRepo *repository.UserRepository) (bool,
 		return false, fmt.Errorf("failed to create admin user: %w", err)
 	}
 
-	// Print credentials to console (only time password is shown)
+	LogCredentials("DEFAULT ADMIN ACCOUNT CREATED", password)
+	return true, nil
+}
+
+// LogCredentials prints the default admin's email and a newly generated
+// password under heading; this is the only time the password is shown
+func LogCredentials(heading, password string) {
 	log.Println("═══════════════════════════════════════════════════════════")
-	log.Println("🔐 DEFAULT ADMIN ACCOUNT CREATED")
+	log.Printf("🔐 %s", heading)
 	log.Println("═══════════════════════════════════════════════════════════")
-	log.Printf("Email:    %s", defaultAdminEmail)
+	log.Printf("Email:    %s", DefaultAdminEmail)
 	log.Printf("Password: %s", password)
 	log.Println("═══════════════════════════════════════════════════════════")
 	log.Println("⚠️  IMPORTANT: Save these credentials immediately!")
 	log.Println("⚠️  The password will NOT be displayed again.")
 	log.Println("⚠️  Change the password after first login.")
 	log.Println("═══════════════════════════════════════════════════════════")
+}
+
+// ResetDefaultAdminPassword gives the default admin a new random password
+// and returns it. Whether the account is active is left as it is
+func ResetDefaultAdminPassword(ctx context.Context, userRepo persistence.UserStore) (string, error) {
+	admin, err := userRepo.FindByEmail(ctx, DefaultAdminEmail)
+	if err == models.ErrInvalidCredentials {
+		return "", ErrNoDefaultAdmin
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to find default admin: %w", err)
+	}
+
+	password, err := generateRandomPassword(passwordLength)
+	if err != nil {
+		return "", err
+	}
+	hashedPassword, err := models.HashPassword(password)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash admin password: %w", err)
+	}
+	if err := userRepo.UpdatePassword(ctx, admin.ID, hashedPassword); err != nil {
+		return "", fmt.Errorf("failed to update admin password: %w", err)
+	}
+	return password, nil
+}
+
+// DisableDefaultAdmin deactivates the default admin, provided another
+// active admin exists (ErrOnlyAdmin otherwise). It returns false when the
+// account is missing or already inactive
+func DisableDefaultAdmin(ctx context.Context, userRepo persistence.UserStore) (bool, error) {
+	admin, err := userRepo.FindByEmail(ctx, DefaultAdminEmail)
+	if err == models.ErrInvalidCredentials {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to find default admin: %w", err)
+	}
+	if !admin.IsActive {
+		return false, nil
+	}
+
+	accounts, err := userRepo.ListAccounts(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to list admins: %w", err)
+	}
+	otherAdmin := false
+	for _, account := range accounts {
+		otherAdmin = otherAdmin || account.ID != admin.ID && account.IsAdmin && account.IsActive
+	}
+	if !otherAdmin {
+		return false, ErrOnlyAdmin
+	}
 
+	admin.IsActive = false
+	if err := userRepo.Update(ctx, admin); err != nil {
+		return false, fmt.Errorf("failed to deactivate default admin: %w", err)
+	}
 	return true, nil
 }
+
+// DefaultAdminStale reports whether the default admin is still active but
+// has not signed in for DefaultAdminStaleAfter before now. An account that
+// never signed in counts from its creation
+func DefaultAdminStale(ctx context.Context, userRepo persistence.UserStore, now time.Time) (bool, error) {
+	admin, err := userRepo.FindByEmail(ctx, DefaultAdminEmail)
+	if err == models.ErrInvalidCredentials {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to find default admin: %w", err)
+	}
+	if !admin.IsActive {
+		return false, nil
+	}
+
+	lastUsed := admin.CreatedAt
+	if admin.LastLogin != nil {
+		lastUsed = *admin.LastLogin
+	}
+	return now.Sub(lastUsed) > DefaultAdminStaleAfter, nil
+}
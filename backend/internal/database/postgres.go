@@ -4,7 +4,10 @@ import (
 	"database/sql"
 	"fmt"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/lib/pq"
+	"github.com/milkiss/vanish/backend/internal/tracing"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
 // Config holds database configuration
@@ -24,7 +27,7 @@ func NewPostgresDB(cfg Config) (*sql.DB, error) {
 		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DBName, cfg.SSLMode,
 	)
 
-	db, err := sql.Open("postgres", dsn)
+	db, err := openDB(dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -41,6 +44,27 @@ func NewPostgresDB(cfg Config) (*sql.DB, error) {
 	return db, nil
 }
 
+// openDB opens the connection pool, wrapping the driver so every query gets
+// a span when OTEL_ENABLED is set. Statements use $n placeholders and
+// arguments are never recorded, so spans hold no message IDs or keys
+func openDB(dsn string) (*sql.DB, error) {
+	if !tracing.Enabled() {
+		return sql.Open("postgres", dsn)
+	}
+	return otelsql.Open("postgres", dsn,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}),
+	)
+}
+
+// SchemaVersion identifies the tables InitSchema creates. Backups record it
+// and restore only into a server of the same version; bump it whenever a
+// change here adds, removes or alters a column of a backed-up table
+const SchemaVersion = 1
+
 // InitSchema initializes the database schema
 func InitSchema(db *sql.DB) error {
 	schema := `
@@ -75,6 +99,24 @@ func InitSchema(db *sql.DB) error {
 	CREATE INDEX IF NOT EXISTS idx_metadata_recipient_id ON message_metadata(recipient_id);
 	CREATE INDEX IF NOT EXISTS idx_metadata_status ON message_metadata(status);
 
+	-- Per-recipient pending count for MAX_PENDING_PER_RECIPIENT
+	CREATE INDEX IF NOT EXISTS idx_metadata_recipient_status ON message_metadata(recipient_id, status);
+
+	-- Inbox: a recipient's pending messages, soonest to expire first, paged
+	-- by (expires_at, id) cursors
+	DROP INDEX IF EXISTS idx_metadata_inbox;
+	CREATE INDEX IF NOT EXISTS idx_metadata_inbox_keyset ON message_metadata(recipient_id, expires_at, id) WHERE status = 'pending';
+
+	-- History: a user's sent and received messages, newest first, paged by
+	-- (created_at, id) cursors
+	CREATE INDEX IF NOT EXISTS idx_metadata_sender_created ON message_metadata(sender_id, created_at, id);
+	CREATE INDEX IF NOT EXISTS idx_metadata_recipient_created ON message_metadata(recipient_id, created_at, id);
+
+	-- Time-series statistics filter on these ranges
+	CREATE INDEX IF NOT EXISTS idx_metadata_created_at ON message_metadata(created_at);
+	CREATE INDEX IF NOT EXISTS idx_metadata_read_at ON message_metadata(read_at);
+	CREATE INDEX IF NOT EXISTS idx_metadata_expires_at ON message_metadata(expires_at);
+
 	-- Add encryption_key column if it doesn't exist (for recipient link generation)
 	DO $$
 	BEGIN
@@ -93,6 +135,301 @@ func InitSchema(db *sql.DB) error {
 		END IF;
 	END $$;
 
+	-- Add is_active column if it doesn't exist (false for anonymized accounts)
+	DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+					   WHERE table_name='users' AND column_name='is_active') THEN
+			ALTER TABLE users ADD COLUMN is_active BOOLEAN NOT NULL DEFAULT true;
+		END IF;
+	END $$;
+
+	-- Add public_key column if it doesn't exist (X25519 key recipients seal link keys to)
+	DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+					   WHERE table_name='users' AND column_name='public_key') THEN
+			ALTER TABLE users ADD COLUMN public_key TEXT;
+		END IF;
+	END $$;
+
+	-- Add sealed_key column if it doesn't exist (link key sealed to the
+	-- recipient's public key, stored instead of encryption_key)
+	DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+					   WHERE table_name='message_metadata' AND column_name='sealed_key') THEN
+			ALTER TABLE message_metadata ADD COLUMN sealed_key TEXT;
+		END IF;
+	END $$;
+
+	-- Access audit log: every attempt to read or inspect a message,
+	-- including refused ones. No foreign key to message_metadata, so probes
+	-- of unknown IDs are kept too. Pruned after ACCESS_LOG_RETENTION
+	CREATE TABLE IF NOT EXISTS access_log (
+		id BIGSERIAL PRIMARY KEY,
+		message_id VARCHAR(255) NOT NULL,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		action VARCHAR(20) NOT NULL,
+		outcome VARCHAR(20) NOT NULL,
+		ip VARCHAR(64) NOT NULL DEFAULT '',
+		user_agent VARCHAR(512) NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_access_log_message_id ON access_log(message_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_access_log_created_at ON access_log(created_at);
+
+	-- Add is_service column if it doesn't exist (service accounts of
+	-- integrations, which authenticate with API keys only)
+	DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+					   WHERE table_name='users' AND column_name='is_service') THEN
+			ALTER TABLE users ADD COLUMN is_service BOOLEAN NOT NULL DEFAULT false;
+		END IF;
+	END $$;
+
+	-- Add auth_source column if it doesn't exist (where the account's
+	-- password lives: 'local' or 'ldap')
+	DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+					   WHERE table_name='users' AND column_name='auth_source') THEN
+			ALTER TABLE users ADD COLUMN auth_source VARCHAR(20) NOT NULL DEFAULT 'local';
+		END IF;
+	END $$;
+
+	-- Add region column if it doesn't exist (the data residency region
+	-- whose Redis cluster keeps the user's messages; '' for the default)
+	DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+					   WHERE table_name='users' AND column_name='region') THEN
+			ALTER TABLE users ADD COLUMN region VARCHAR(16) NOT NULL DEFAULT '';
+		END IF;
+	END $$;
+
+	-- Add last_login column if it doesn't exist (last successful sign-in;
+	-- NULL for accounts that never signed in)
+	DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+					   WHERE table_name='users' AND column_name='last_login') THEN
+			ALTER TABLE users ADD COLUMN last_login TIMESTAMP;
+		END IF;
+	END $$;
+
+	-- Add sender_type and integration_name columns if they don't exist
+	-- (which integration, if any, created a message)
+	DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+					   WHERE table_name='message_metadata' AND column_name='sender_type') THEN
+			ALTER TABLE message_metadata ADD COLUMN sender_type VARCHAR(20) NOT NULL DEFAULT 'user';
+			ALTER TABLE message_metadata ADD COLUMN integration_name VARCHAR(100) NOT NULL DEFAULT '';
+		END IF;
+	END $$;
+
+	-- API keys of service accounts; only a SHA-256 hash of each key is kept
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name VARCHAR(100) NOT NULL,
+		prefix VARCHAR(16) NOT NULL,
+		key_hash CHAR(64) UNIQUE NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		last_used_at TIMESTAMP,
+		revoked_at TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+
+	-- Add available_at column if it doesn't exist (release time of a
+	-- scheduled message; NULL for messages readable at once)
+	DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+					   WHERE table_name='message_metadata' AND column_name='available_at') THEN
+			ALTER TABLE message_metadata ADD COLUMN available_at TIMESTAMP;
+		END IF;
+	END $$;
+
+	-- Add created_via column if it doesn't exist (which client created a
+	-- message, from X-Vanish-Client). Earlier Slack messages are known;
+	-- the rest count as API calls
+	DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+					   WHERE table_name='message_metadata' AND column_name='created_via') THEN
+			ALTER TABLE message_metadata ADD COLUMN created_via VARCHAR(20) NOT NULL DEFAULT 'api';
+			UPDATE message_metadata SET created_via = 'slack' WHERE integration_name = 'slack';
+		END IF;
+	END $$;
+
+	-- Notifications held back until their scheduled message is released.
+	-- The link is rebuilt when sending, so no key is stored here
+	CREATE TABLE IF NOT EXISTS scheduled_notifications (
+		id BIGSERIAL PRIMARY KEY,
+		message_id VARCHAR(255) NOT NULL REFERENCES message_metadata(message_id) ON DELETE CASCADE,
+		channel VARCHAR(20) NOT NULL,
+		sender_label VARCHAR(255) NOT NULL DEFAULT '',
+		send_at TIMESTAMP NOT NULL,
+		UNIQUE (message_id, channel)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_scheduled_notifications_send_at ON scheduled_notifications(send_at);
+
+	-- Notable events counted by the admin digest, and the digest periods
+	-- already posted. Events hold no user or message reference
+	CREATE TABLE IF NOT EXISTS digest_events (
+		id BIGSERIAL PRIMARY KEY,
+		kind VARCHAR(32) NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_digest_events_created_at ON digest_events(created_at);
+
+	CREATE TABLE IF NOT EXISTS digest_runs (
+		period VARCHAR(64) PRIMARY KEY,
+		sent_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+
+	-- Default and maximum TTL of messages per recipient email domain,
+	-- evaluated by position; the first matching rule applies
+	CREATE TABLE IF NOT EXISTS ttl_policy_rules (
+		id BIGSERIAL PRIMARY KEY,
+		position INTEGER NOT NULL,
+		recipient_domain_glob VARCHAR(255) NOT NULL,
+		default_ttl BIGINT NOT NULL,
+		max_ttl BIGINT NOT NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+
+	-- Default and maximum TTL and notification wording of messages per
+	-- category. Credentials and documents get policies when the table is
+	-- first created; admins may change or remove them afterwards
+	DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name='category_policies') THEN
+			CREATE TABLE category_policies (
+				category VARCHAR(32) PRIMARY KEY,
+				default_ttl BIGINT NOT NULL,
+				max_ttl BIGINT NOT NULL,
+				notification_style VARCHAR(20) NOT NULL DEFAULT 'standard',
+				created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+				updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+			);
+			INSERT INTO category_policies (category, default_ttl, max_ttl, notification_style) VALUES
+				('credentials', 3600, 86400, 'urgent'),
+				('documents', 86400, 604800, 'digest');
+		END IF;
+	END $$;
+
+	-- Email domains, with their subdomains, that may not receive messages
+	-- or register accounts
+	CREATE TABLE IF NOT EXISTS banned_domains (
+		domain VARCHAR(255) PRIMARY KEY,
+		reason VARCHAR(255) NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+
+	-- Patterns clients match secrets against before encrypting them, to
+	-- warn senders; the server never sees the plaintext
+	CREATE TABLE IF NOT EXISTS dlp_patterns (
+		name VARCHAR(32) PRIMARY KEY,
+		pattern TEXT NOT NULL,
+		description VARCHAR(255) NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+
+	-- Add category column if it doesn't exist (the category a sender filed
+	-- a message under; empty for none)
+	DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+					   WHERE table_name='message_metadata' AND column_name='category') THEN
+			ALTER TABLE message_metadata ADD COLUMN category VARCHAR(32) NOT NULL DEFAULT '';
+		END IF;
+	END $$;
+
+	-- Add external_recipient_email column if it doesn't exist (the address
+	-- of a recipient without an account, who reads with a signed link).
+	-- Such messages have no recipient_id; every message has one or the other
+	DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+					   WHERE table_name='message_metadata' AND column_name='external_recipient_email') THEN
+			ALTER TABLE message_metadata ADD COLUMN external_recipient_email VARCHAR(255) NOT NULL DEFAULT '';
+			ALTER TABLE message_metadata ALTER COLUMN recipient_id DROP NOT NULL;
+			ALTER TABLE message_metadata ADD CONSTRAINT message_metadata_recipient_check
+				CHECK (recipient_id IS NOT NULL OR external_recipient_email <> '');
+		END IF;
+	END $$;
+
+	-- Workspaces the Slack app was installed into through the OAuth flow,
+	-- with their bot tokens (sealed by METADATA_ENCRYPTION_KEYS when set)
+	CREATE TABLE IF NOT EXISTS slack_installations (
+		team_id VARCHAR(32) PRIMARY KEY,
+		team_name VARCHAR(255) NOT NULL DEFAULT '',
+		bot_user_id VARCHAR(32) NOT NULL DEFAULT '',
+		bot_token TEXT NOT NULL,
+		scope TEXT NOT NULL DEFAULT '',
+		installed_by VARCHAR(32) NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+		updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+
+	-- Admin changes to accounts, such as merges, with the acting admin.
+	-- No foreign keys to users, so entries outlive purged accounts
+	CREATE TABLE IF NOT EXISTS admin_audit_log (
+		id BIGSERIAL PRIMARY KEY,
+		actor_id INTEGER NOT NULL,
+		action VARCHAR(40) NOT NULL,
+		user_id INTEGER NOT NULL,
+		related_user_id INTEGER NOT NULL DEFAULT 0,
+		created_at TIMESTAMP NOT NULL DEFAULT NOW()
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_admin_audit_log_created_at ON admin_audit_log(created_at);
+
+	-- Emails are unique ignoring case. Accounts created before emails were
+	-- normalized may differ only in case; until they are merged (see
+	-- GET /api/admin/users/duplicates) the index is left out and every
+	-- startup tries again
+	DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM pg_indexes WHERE indexname = 'idx_users_email_lower') THEN
+			IF EXISTS (SELECT 1 FROM users GROUP BY LOWER(email) HAVING COUNT(*) > 1) THEN
+				RAISE WARNING 'users differ only in email case; merge them to enable idx_users_email_lower';
+			ELSE
+				CREATE UNIQUE INDEX idx_users_email_lower ON users (LOWER(email));
+			END IF;
+		END IF;
+	END $$;
+
+	-- Trigram indexes for the ILIKE '%...%' search of GET /api/history
+	-- (counterpart name and email, category). Creating pg_trgm takes a
+	-- privileged role on some hosts; without it the search still works,
+	-- scanning the caller's rows
+	DO $$
+	BEGIN
+		CREATE EXTENSION IF NOT EXISTS pg_trgm;
+	EXCEPTION WHEN insufficient_privilege THEN
+		RAISE WARNING 'cannot create extension pg_trgm; history search runs without trigram indexes';
+	END $$;
+	DO $$
+	BEGIN
+		IF EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'pg_trgm') THEN
+			CREATE INDEX IF NOT EXISTS idx_users_name_trgm ON users USING gin (name gin_trgm_ops);
+			CREATE INDEX IF NOT EXISTS idx_users_email_trgm ON users USING gin (email gin_trgm_ops);
+			CREATE INDEX IF NOT EXISTS idx_metadata_category_trgm ON message_metadata USING gin (category gin_trgm_ops);
+			CREATE INDEX IF NOT EXISTS idx_metadata_external_email_trgm ON message_metadata USING gin (external_recipient_email gin_trgm_ops);
+		END IF;
+	END $$;
+
 	-- Make default admin account an admin
 	UPDATE users SET is_admin = true WHERE email = 'admin@vanish.local' AND is_admin = false;
 	`
@@ -0,0 +1,65 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/milkiss/vanish/backend/internal/messages"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorDomain is the ErrorInfo domain of Vanish error codes
+const errorDomain = "vanish"
+
+// failure builds the status for a failed call. code is one of the
+// models.ErrorCode* values, carried as the reason of an ErrorInfo detail
+// together with the request ID, as the HTTP API returns them in its body
+func failure(ctx context.Context, code, message string) error {
+	st := status.New(grpcCode(code), message)
+	info := &errdetails.ErrorInfo{Reason: code, Domain: errorDomain}
+	if id := requestid.FromContext(ctx); id != "" {
+		info.Metadata = map[string]string{"request_id": id}
+	}
+	if detailed, err := st.WithDetails(info); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// serviceFailure builds the status for a message service error
+func serviceFailure(ctx context.Context, err error) error {
+	var e *messages.Error
+	if errors.As(err, &e) {
+		return failure(ctx, e.Code, e.Message)
+	}
+	return failure(ctx, models.ErrorCodeInternal, "Internal server error")
+}
+
+// grpcCode maps an error code to the gRPC status code closest to its HTTP
+// status
+func grpcCode(code string) codes.Code {
+	switch code {
+	case models.ErrorCodeValidationFailed, models.ErrorCodeInvalidRequest, models.ErrorCodeInvalidMessageID,
+		models.ErrorCodeTTLOutOfRange, models.ErrorCodeInvalidSchedule:
+		return codes.InvalidArgument
+	case models.ErrorCodeUnauthorized, models.ErrorCodeAccountInactive:
+		return codes.Unauthenticated
+	case models.ErrorCodeForbidden, models.ErrorCodeNotRecipient, models.ErrorCodeInvalidClaimToken:
+		return codes.PermissionDenied
+	case models.ErrorCodeMessageNotFound, models.ErrorCodeClaimNotFound, models.ErrorCodeUserNotFound:
+		return codes.NotFound
+	case models.ErrorCodeMessageAlreadyRead, models.ErrorCodeMessageExpired, models.ErrorCodeMessageRevoked,
+		models.ErrorCodeMessageClaimed, models.ErrorCodeNotYetAvailable:
+		return codes.FailedPrecondition
+	case models.ErrorCodeRecipientInboxFull, models.ErrorCodeQuotaExceeded:
+		return codes.ResourceExhausted
+	case models.ErrorCodeUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
@@ -0,0 +1,223 @@
+package grpcapi
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/auth"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+	"github.com/milkiss/vanish/backend/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDKey is the metadata key carrying the request ID, as the
+// X-Request-ID header does over HTTP
+var requestIDKey = strings.ToLower(requestid.Header)
+
+// recoveryInterceptor turns a panicking call into an Internal error instead
+// of taking the server down
+func recoveryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			requestid.Logger(ctx).Error("panic in rpc", "method", info.FullMethod, "panic", r)
+			err = status.Error(codes.Internal, "Internal server error")
+		}
+	}()
+	return handler(ctx, req)
+}
+
+// requestIDInterceptor assigns every call a correlation ID like
+// RequestIDMiddleware: a valid incoming x-request-id is reused, otherwise a
+// UUID is generated. The ID is returned in the response header metadata
+func requestIDInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	id := firstValue(ctx, requestIDKey)
+	if !requestid.Valid(id) {
+		id = requestid.New()
+	}
+	ctx = requestid.NewContext(ctx, id)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, id))
+	return handler(ctx, req)
+}
+
+// tracingInterceptor starts a server span per call like TracingMiddleware,
+// continuing a trace propagated in the metadata. A message ID in the
+// request is recorded only hashed (NFR-02)
+func tracingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+
+	service, method := splitMethod(info.FullMethod)
+	attrs := []attribute.KeyValue{
+		semconv.RPCSystemGRPC,
+		semconv.RPCService(service),
+		semconv.RPCMethod(method),
+		tracing.RequestIDKey.String(requestid.FromContext(ctx)),
+	}
+	if r, ok := req.(interface{ GetId() string }); ok && r.GetId() != "" {
+		attrs = append(attrs, tracing.MessageID(r.GetId()))
+	}
+
+	ctx, span := tracing.Start(ctx, strings.TrimPrefix(info.FullMethod, "/"),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attrs...),
+	)
+	defer span.End()
+
+	resp, err := handler(ctx, req)
+
+	code := status.Code(err)
+	span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(code)))
+	if serverFault(code) {
+		span.SetStatus(otelcodes.Error, code.String())
+	}
+	return resp, err
+}
+
+// logInterceptor writes one structured log line per call like
+// RequestLogMiddleware. Only the method is logged, never the request
+func logInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	clientIP := ""
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		clientIP = p.Addr.String()
+		if host, _, splitErr := net.SplitHostPort(clientIP); splitErr == nil {
+			clientIP = host
+		}
+	}
+	requestid.Logger(ctx).Info("rpc",
+		"method", info.FullMethod,
+		"code", status.Code(err).String(),
+		"client_ip", clientIP,
+		"duration_ms", time.Since(start).Milliseconds(),
+	)
+	return resp, err
+}
+
+// caller is the authenticated account making a call
+type caller struct {
+	userID      int64
+	integration string // service account name when authenticated by API key; empty for users
+}
+
+type callerKey struct{}
+
+// callerFrom returns the caller stored by authInterceptor
+func callerFrom(ctx context.Context) caller {
+	c, _ := ctx.Value(callerKey{}).(caller)
+	return c
+}
+
+// authenticator checks the credentials of a call
+type authenticator struct {
+	jwtManager *auth.JWTManager
+	users      persistence.UserStore
+}
+
+// authInterceptor rejects calls without valid credentials and stores the
+// caller for the service methods
+func authInterceptor(a *authenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		c, err := a.authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(context.WithValue(ctx, callerKey{}, c), req)
+	}
+}
+
+// authenticate checks the "authorization: Bearer <token>" metadata like
+// SessionAuthMiddleware and ActiveUserMiddleware together: a service
+// account API key, or a JWT of an account that is still active
+func (a *authenticator) authenticate(ctx context.Context) (caller, error) {
+	header := firstValue(ctx, "authorization")
+	if header == "" {
+		return caller{}, failure(ctx, models.ErrorCodeUnauthorized, "Authorization metadata required")
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || scheme != "Bearer" {
+		return caller{}, failure(ctx, models.ErrorCodeUnauthorized, "Invalid authorization metadata format")
+	}
+
+	if models.IsAPIKey(token) {
+		user, err := a.users.AuthenticateAPIKey(ctx, models.HashAPIKey(token))
+		if err != nil || !user.IsService || !user.IsActive {
+			if err != nil && err != models.ErrAPIKeyNotFound {
+				requestid.Logger(ctx).Error("api key lookup failed", "error", err)
+			}
+			return caller{}, failure(ctx, models.ErrorCodeUnauthorized, "Invalid or revoked API key")
+		}
+		return caller{userID: user.ID, integration: user.Name}, nil
+	}
+
+	claims, err := a.jwtManager.Verify(token)
+	if err != nil {
+		return caller{}, failure(ctx, models.ErrorCodeUnauthorized, "Invalid or expired token")
+	}
+	user, err := a.users.FindByID(ctx, claims.UserID)
+	if err != nil || !user.IsActive {
+		return caller{}, failure(ctx, models.ErrorCodeAccountInactive, "Account is no longer active")
+	}
+	return caller{userID: claims.UserID}, nil
+}
+
+// firstValue returns the first incoming metadata value for key, or ""
+func firstValue(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// splitMethod splits "/vanish.v1.VanishService/CreateMessage" into service
+// and method
+func splitMethod(fullMethod string) (string, string) {
+	service, method, _ := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+	return service, method
+}
+
+// serverFault reports whether code is the server's fault rather than the
+// caller's, like a 5xx status
+func serverFault(code codes.Code) bool {
+	switch code {
+	case codes.Unknown, codes.DeadlineExceeded, codes.Unimplemented, codes.Internal, codes.Unavailable, codes.DataLoss:
+		return true
+	default:
+		return false
+	}
+}
+
+// metadataCarrier adapts incoming metadata for trace-context propagation
+type metadataCarrier metadata.MD
+
+func (m metadataCarrier) Get(key string) string {
+	if values := metadata.MD(m).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (m metadataCarrier) Set(key, value string) { metadata.MD(m).Set(key, value) }
+
+func (m metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
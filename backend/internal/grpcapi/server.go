@@ -0,0 +1,173 @@
+// Package grpcapi serves the gRPC API defined in proto/vanish/v1, for
+// automation that creates many messages over one connection. It shares the
+// message service with the HTTP API, and its interceptors authenticate, log
+// and trace every call as the HTTP middleware does
+package grpcapi
+
+//go:generate protoc -I ../../proto --go_out=../.. --go_opt=module=github.com/milkiss/vanish/backend --go-grpc_out=../.. --go-grpc_opt=module=github.com/milkiss/vanish/backend vanish/v1/vanish.proto
+
+import (
+	"context"
+	"crypto/tls"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/auth"
+	"github.com/milkiss/vanish/backend/internal/grpcapi/vanishv1"
+	"github.com/milkiss/vanish/backend/internal/messages"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/tracing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Dependencies holds what the gRPC server needs
+type Dependencies struct {
+	Messages   *messages.Service
+	UserStore  persistence.UserStore
+	JWTManager *auth.JWTManager
+	TLS        *tls.Config // nil serves plaintext, e.g. behind a TLS-terminating proxy
+}
+
+// NewServer creates the gRPC server with the Vanish service and server
+// reflection, so tools like grpcurl can list and call it. Reflection only
+// describes the API and needs no credentials
+func NewServer(deps Dependencies) *grpc.Server {
+	interceptors := []grpc.UnaryServerInterceptor{recoveryInterceptor, requestIDInterceptor}
+	if tracing.Enabled() {
+		interceptors = append(interceptors, tracingInterceptor)
+	}
+	interceptors = append(interceptors,
+		logInterceptor,
+		authInterceptor(&authenticator{jwtManager: deps.JWTManager, users: deps.UserStore}),
+	)
+
+	opts := []grpc.ServerOption{grpc.ChainUnaryInterceptor(interceptors...)}
+	if deps.TLS != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(deps.TLS)))
+	}
+
+	server := grpc.NewServer(opts...)
+	vanishv1.RegisterVanishServiceServer(server, &service{messages: deps.Messages, users: deps.UserStore})
+	reflection.Register(server)
+	return server
+}
+
+// service implements vanishv1.VanishServiceServer
+type service struct {
+	vanishv1.UnimplementedVanishServiceServer
+
+	messages *messages.Service
+	users    persistence.UserStore
+}
+
+// CreateMessage stores a message, validated like POST /api/v1/messages
+func (s *service) CreateMessage(ctx context.Context, req *vanishv1.CreateMessageRequest) (*vanishv1.CreateMessageResponse, error) {
+	c := callerFrom(ctx)
+
+	create := models.CreateMessageRequest{
+		Ciphertext:    req.GetCiphertext(),
+		IV:            req.GetIv(),
+		TTL:           req.TtlSeconds,
+		RecipientID:   req.GetRecipientId(),
+		EncryptionKey: req.GetEncryptionKey(),
+		SealedKey:     req.GetSealedKey(),
+	}
+	if req.AvailableAt != nil {
+		if err := req.AvailableAt.CheckValid(); err != nil {
+			return nil, failure(ctx, models.ErrorCodeValidationFailed, "Invalid request: available_at is invalid")
+		}
+		availableAt := req.AvailableAt.AsTime()
+		create.AvailableAt = &availableAt
+	}
+	if err := binding.Validator.ValidateStruct(&create); err != nil {
+		return nil, failure(ctx, models.ErrorCodeValidationFailed, "Invalid request: "+api.ValidationSummary(err))
+	}
+
+	metadata, err := s.messages.CreateEncrypted(ctx, c.userID, create.RecipientID,
+		messages.Payload{Ciphertext: create.Ciphertext, IV: create.IV}, create.TTL,
+		messages.CreateOptions{
+			EncryptionKey: create.EncryptionKey,
+			SealedKey:     create.SealedKey,
+			AvailableAt:   create.AvailableAt,
+			Integration:   c.integration,
+		})
+	if err != nil {
+		return nil, serviceFailure(ctx, err)
+	}
+
+	return &vanishv1.CreateMessageResponse{
+		Id:          metadata.MessageID,
+		ExpiresAt:   timestamppb.New(metadata.ExpiresAt),
+		AvailableAt: optionalTimestamp(metadata.AvailableAt),
+	}, nil
+}
+
+// GetMessageStatus reports a message's state to its sender or recipient
+func (s *service) GetMessageStatus(ctx context.Context, req *vanishv1.GetMessageStatusRequest) (*vanishv1.MessageStatus, error) {
+	metadata, err := s.messages.Status(ctx, callerFrom(ctx).userID, req.GetId())
+	if err != nil {
+		return nil, serviceFailure(ctx, err)
+	}
+
+	return &vanishv1.MessageStatus{
+		Id:          metadata.MessageID,
+		Status:      statusValue(metadata.Status),
+		SenderId:    metadata.SenderID,
+		RecipientId: metadata.RecipientID,
+		CreatedAt:   timestamppb.New(metadata.CreatedAt),
+		ExpiresAt:   timestamppb.New(metadata.ExpiresAt),
+		ReadAt:      optionalTimestamp(metadata.ReadAt),
+		AvailableAt: optionalTimestamp(metadata.AvailableAt),
+	}, nil
+}
+
+// ListUsers lists possible recipients, like GET /api/v1/users
+func (s *service) ListUsers(ctx context.Context, req *vanishv1.ListUsersRequest) (*vanishv1.ListUsersResponse, error) {
+	users, err := s.users.ListAll(ctx)
+	if err != nil {
+		return nil, failure(ctx, models.ErrorCodeInternal, "Failed to list users")
+	}
+
+	resp := &vanishv1.ListUsersResponse{Users: make([]*vanishv1.User, len(users))}
+	for i, u := range users {
+		resp.Users[i] = &vanishv1.User{Id: u.ID, Email: u.Email, Name: u.Name, PublicKey: u.PublicKey}
+	}
+	return resp, nil
+}
+
+// Revoke burns a message of the caller that has not been read
+func (s *service) Revoke(ctx context.Context, req *vanishv1.RevokeRequest) (*vanishv1.RevokeResponse, error) {
+	if err := s.messages.Revoke(ctx, callerFrom(ctx).userID, req.GetId()); err != nil {
+		return nil, serviceFailure(ctx, err)
+	}
+	return &vanishv1.RevokeResponse{}, nil
+}
+
+// statusValue converts a stored message status
+func statusValue(status models.MessageStatus) vanishv1.Status {
+	switch status {
+	case models.StatusPending:
+		return vanishv1.Status_STATUS_PENDING
+	case models.StatusClaimed:
+		return vanishv1.Status_STATUS_CLAIMED
+	case models.StatusRead:
+		return vanishv1.Status_STATUS_READ
+	case models.StatusExpired:
+		return vanishv1.Status_STATUS_EXPIRED
+	default:
+		return vanishv1.Status_STATUS_UNSPECIFIED
+	}
+}
+
+// optionalTimestamp converts t, leaving the field unset when t is nil
+func optionalTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
@@ -0,0 +1,228 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrForbiddenDestination is returned for a destination that is, or
+// resolves to, an internal address
+var ErrForbiddenDestination = errors.New("destination is not a public address")
+
+// internalPrefixes are the ranges besides loopback, private, link-local and
+// multicast addresses that must not be reached from user-supplied URLs
+var internalPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),   // reserved, including broadcast
+	netip.MustParsePrefix("::/96"),         // unspecified, loopback and IPv4-compatible
+	netip.MustParsePrefix("fec0::/10"),     // site-local
+	netip.MustParsePrefix("100::/64"),      // discard-only
+	netip.MustParsePrefix("2001:db8::/32"), // documentation
+	netip.MustParsePrefix("2001::/23"),     // IETF protocol assignments, including Teredo
+}
+
+// Ranges that embed an IPv4 address, which is checked in its place
+var (
+	nat64Prefix     = netip.MustParsePrefix("64:ff9b::/96")
+	sixToFourPrefix = netip.MustParsePrefix("2002::/16")
+)
+
+// EgressPolicy restricts where user-supplied URLs, such as webhooks, may
+// point, so they cannot be used to reach internal services or cloud
+// metadata endpoints (SSRF). The zero value allows public http and https
+// destinations only
+type EgressPolicy struct {
+	Allowed      []netip.Prefix // internal ranges permitted anyway
+	RequireHTTPS bool
+	Resolver     *net.Resolver // nil uses net.DefaultResolver
+}
+
+// ParseAllowedNetworks parses CIDRs, or single addresses, for
+// EgressPolicy.Allowed
+func ParseAllowedNetworks(networks []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(networks))
+	for _, network := range networks {
+		network = strings.TrimSpace(network)
+		if network == "" {
+			continue
+		}
+		if !strings.Contains(network, "/") {
+			addr, err := netip.ParseAddr(network)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %q: %w", network, err)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", network, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// ValidateURL checks that raw is an absolute URL with a permitted scheme
+// whose host resolves only to permitted addresses
+func (p *EgressPolicy) ValidateURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+	switch {
+	case u.Scheme == "https":
+	case u.Scheme == "http" && !p.RequireHTTPS:
+	case u.Scheme == "http":
+		return fmt.Errorf("URL must use https")
+	default:
+		return fmt.Errorf("URL must be an absolute http(s) URL")
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("URL must be an absolute http(s) URL")
+	}
+	if u.User != nil {
+		return fmt.Errorf("URL must not contain credentials")
+	}
+	_, err = p.resolve(ctx, u.Hostname())
+	return err
+}
+
+// Permitted reports whether addr may be connected to
+func (p *EgressPolicy) Permitted(addr netip.Addr) bool {
+	addr = addr.WithZone("").Unmap()
+	for _, prefix := range p.Allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return !internal(addr)
+}
+
+// internal reports whether addr is not a public unicast address
+func internal(addr netip.Addr) bool {
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsMulticast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, prefix := range internalPrefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	b := addr.As16()
+	switch {
+	case nat64Prefix.Contains(addr):
+		return internal(netip.AddrFrom4([4]byte{b[12], b[13], b[14], b[15]}))
+	case sixToFourPrefix.Contains(addr):
+		return internal(netip.AddrFrom4([4]byte{b[2], b[3], b[4], b[5]}))
+	}
+	return false
+}
+
+// resolve returns the addresses of host, failing if any of them is not
+// permitted, so a name cannot mix public and internal records
+func (p *EgressPolicy) resolve(ctx context.Context, host string) ([]netip.Addr, error) {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !p.Permitted(addr) {
+			return nil, fmt.Errorf("%s: %w", host, ErrForbiddenDestination)
+		}
+		return []netip.Addr{addr.Unmap()}, nil
+	}
+
+	resolver := p.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	for i, addr := range addrs {
+		if !p.Permitted(addr) {
+			return nil, fmt.Errorf("%s resolves to %s: %w", host, addr, ErrForbiddenDestination)
+		}
+		addrs[i] = addr.Unmap()
+	}
+	return addrs, nil
+}
+
+// guard applies the policy to a transport. Connections go to the addresses
+// that were checked rather than to a name resolved again, so DNS rebinding
+// cannot swap in an internal address between check and use. Requests sent
+// through a proxy have their destination checked before the proxy is
+// dialed; the proxy itself is configuration and always reachable
+func (p *EgressPolicy) guard(transport *http.Transport, dialer *net.Dialer) {
+	var proxies sync.Map // host:port of every proxy the transport used
+	proxy := transport.Proxy
+	transport.Proxy = func(req *http.Request) (*url.URL, error) {
+		if proxy == nil {
+			return nil, nil
+		}
+		proxyURL, err := proxy(req)
+		if err != nil || proxyURL == nil {
+			return proxyURL, err
+		}
+		if _, err := p.resolve(req.Context(), req.URL.Hostname()); err != nil {
+			return nil, err
+		}
+		proxies.Store(canonicalAddr(proxyURL), true)
+		return proxyURL, nil
+	}
+
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		if _, ok := proxies.Load(address); ok {
+			return dialer.DialContext(ctx, network, address)
+		}
+		host, portText, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		port, err := strconv.ParseUint(portText, 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port in %s", address)
+		}
+		addrs, err := p.resolve(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		var firstErr error
+		for _, addr := range addrs {
+			conn, err := dialer.DialContext(ctx, network, netip.AddrPortFrom(addr, uint16(port)).String())
+			if err == nil {
+				return conn, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		return nil, firstErr
+	}
+}
+
+// canonicalAddr returns the host:port the transport dials for a proxy URL
+func canonicalAddr(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443", "socks5": "1080"}[u.Scheme]
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// noRedirects makes a client return redirects instead of following them,
+// since a permitted destination could otherwise send it somewhere internal
+func noRedirects(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}
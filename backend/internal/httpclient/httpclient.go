@@ -0,0 +1,136 @@
+// Package httpclient builds the HTTP client used for every outbound call to
+// an integration (Slack, Okta), so timeouts, connection pooling and proxy
+// settings are consistent and each call is measured, correlated and traced
+package httpclient
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/requestid"
+	"github.com/milkiss/vanish/backend/internal/tracing"
+)
+
+// Defaults used for zero Options fields
+const (
+	DefaultTimeout             = 15 * time.Second
+	DefaultMaxIdleConnsPerHost = 10
+	DefaultIdleConnTimeout     = 90 * time.Second
+)
+
+// Options configures a client; the zero value uses the defaults above and
+// HTTP_PROXY/HTTPS_PROXY/NO_PROXY from the environment
+type Options struct {
+	Timeout             time.Duration // bounds a whole request, including reading the body
+	MaxIdleConnsPerHost int           // idle keep-alive connections kept per destination
+	Proxy               string        // explicit proxy URL, must pass ValidateProxy
+	Metrics             *Metrics      // where calls are recorded; DefaultMetrics if nil
+
+	// Egress, when set, limits the client to destinations the policy
+	// permits and stops it following redirects. Use it for every URL a user
+	// or admin supplies, such as webhooks
+	Egress *EgressPolicy
+}
+
+// ValidateProxy checks that proxy is empty or an absolute http(s) URL
+func ValidateProxy(proxy string) error {
+	if proxy == "" {
+		return nil
+	}
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return fmt.Errorf("invalid proxy URL %q: %w", proxy, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("proxy URL %q must be an absolute http or https URL", proxy)
+	}
+	return nil
+}
+
+// New builds a client for opts
+func New(opts Options) (*http.Client, error) {
+	if err := ValidateProxy(opts.Proxy); err != nil {
+		return nil, err
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	idlePerHost := opts.MaxIdleConnsPerHost
+	if idlePerHost <= 0 {
+		idlePerHost = DefaultMaxIdleConnsPerHost
+	}
+	metrics := opts.Metrics
+	if metrics == nil {
+		metrics = DefaultMetrics
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   idlePerHost,
+		IdleConnTimeout:       DefaultIdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	if opts.Proxy != "" {
+		proxyURL, _ := url.Parse(opts.Proxy) // checked by ValidateProxy
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+	if opts.Egress != nil {
+		opts.Egress.guard(transport, dialer)
+	}
+
+	// Spans are added only when OTEL_ENABLED is set
+	var next http.RoundTripper = transport
+	if tracing.Enabled() {
+		next = tracing.Transport(transport)
+	}
+
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: &instrumented{next: next, metrics: metrics},
+	}
+	if opts.Egress != nil {
+		client.CheckRedirect = noRedirects
+	}
+	return client, nil
+}
+
+// Default returns a client with the default options
+func Default() *http.Client {
+	client, _ := New(Options{}) // zero Options never fail
+	return client
+}
+
+// instrumented records every call in metrics and forwards the request ID
+// of the incoming request, so a Slack or Okta failure can be traced back
+// to the API call that caused it
+type instrumented struct {
+	next    http.RoundTripper
+	metrics *Metrics
+}
+
+func (t *instrumented) RoundTrip(req *http.Request) (*http.Response, error) {
+	if id := requestid.FromContext(req.Context()); id != "" && req.Header.Get(requestid.Header) == "" {
+		// RoundTrippers must not modify the caller's request
+		req = req.Clone(req.Context())
+		req.Header.Set(requestid.Header, id)
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	failed := err != nil || resp.StatusCode >= http.StatusInternalServerError
+	t.metrics.observe(req.URL.Host, time.Since(start), failed)
+	return resp, err
+}
@@ -0,0 +1,69 @@
+package httpclient
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultMetrics records calls made by clients built without Options.Metrics
+var DefaultMetrics = NewMetrics()
+
+// DestinationStats counts calls to one host
+// Latency covers the time to response headers; a client timeout while the
+// body is read is counted by the caller's error, not here
+type DestinationStats struct {
+	Requests     int64         `json:"requests"`
+	Errors       int64         `json:"errors"` // transport errors and 5xx responses
+	TotalLatency time.Duration `json:"total_latency_ns"`
+	MaxLatency   time.Duration `json:"max_latency_ns"`
+}
+
+// MeanLatency returns the average latency, or 0 before the first request
+func (s DestinationStats) MeanLatency() time.Duration {
+	if s.Requests == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Requests)
+}
+
+// Metrics holds per-destination counters for outbound calls
+type Metrics struct {
+	mu           sync.Mutex
+	destinations map[string]*DestinationStats
+}
+
+// NewMetrics creates an empty registry
+func NewMetrics() *Metrics {
+	return &Metrics{destinations: make(map[string]*DestinationStats)}
+}
+
+func (m *Metrics) observe(host string, latency time.Duration, failed bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.destinations[host]
+	if !ok {
+		s = &DestinationStats{}
+		m.destinations[host] = s
+	}
+	s.Requests++
+	if failed {
+		s.Errors++
+	}
+	s.TotalLatency += latency
+	if latency > s.MaxLatency {
+		s.MaxLatency = latency
+	}
+}
+
+// Snapshot returns a copy of the counters keyed by host (with port, if any)
+func (m *Metrics) Snapshot() map[string]DestinationStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := make(map[string]DestinationStats, len(m.destinations))
+	for host, s := range m.destinations {
+		out[host] = *s
+	}
+	return out
+}
@@ -2,9 +2,16 @@ package email
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"html/template"
 	"net/smtp"
+
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/tracing"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Config holds SMTP configuration
@@ -27,21 +34,50 @@ func NewClient(config *Config) *Client {
 	return &Client{config: config}
 }
 
-// SendSecretNotification sends an email notification about a new secret
-func (c *Client) SendSecretNotification(recipientEmail, recipientName, senderName, secretURL string) error {
-	subject := fmt.Sprintf("🔒 Secure Message from %s", senderName)
+// SendSecretNotification sends an email notification about a new secret,
+// worded in style
+func (c *Client) SendSecretNotification(ctx context.Context, recipientEmail, recipientName, senderName, secretURL string, style models.NotificationStyle) error {
+	subject, lead := secretNotificationWording(senderName, style)
 
-	htmlBody, err := c.renderSecretNotificationHTML(recipientName, senderName, secretURL)
+	htmlBody, err := c.renderSecretNotificationHTML(recipientName, senderName, lead, secretURL)
 	if err != nil {
 		return fmt.Errorf("failed to render email template: %w", err)
 	}
 
-	plainBody := c.renderSecretNotificationPlain(recipientName, senderName, secretURL)
+	plainBody := c.renderSecretNotificationPlain(recipientName, senderName, lead, secretURL)
+
+	return c.sendEmail(ctx, recipientEmail, subject, htmlBody, plainBody)
+}
 
-	return c.sendEmail(recipientEmail, subject, htmlBody, plainBody)
+// secretNotificationWording returns the subject of a notification in style
+// and the sentence following the sender's name
+func secretNotificationWording(senderName string, style models.NotificationStyle) (string, string) {
+	switch style {
+	case models.NotificationUrgent:
+		return fmt.Sprintf("🚨 Urgent: Secure Message from %s", senderName),
+			"has sent you a secure, ephemeral message that needs your attention. Please open it as soon as possible: it expires soon."
+	case models.NotificationDigest:
+		return fmt.Sprintf("New message from %s on Vanish", senderName),
+			"has shared a message with you via Vanish. It stays available until it expires."
+	}
+	return fmt.Sprintf("🔒 Secure Message from %s", senderName),
+		"has sent you a secure, ephemeral message via Vanish."
 }
 
-func (c *Client) sendEmail(to, subject, htmlBody, plainBody string) error {
+// SendAlert sends a plain-text security alert; body is shown verbatim
+func (c *Client) SendAlert(ctx context.Context, recipientEmail, subject, body string) error {
+	htmlBody := "<pre style=\"font-family: Arial, sans-serif; white-space: pre-wrap;\">" + template.HTMLEscapeString(body) + "</pre>"
+	return c.sendEmail(ctx, recipientEmail, subject, htmlBody, body)
+}
+
+func (c *Client) sendEmail(ctx context.Context, to, subject, htmlBody, plainBody string) error {
+	// The span records the SMTP server only, never the recipient
+	_, span := tracing.Start(ctx, "smtp send",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.ServerAddress(c.config.SMTPHost)),
+	)
+	defer span.End()
+
 	from := fmt.Sprintf("%s <%s>", c.config.FromName, c.config.FromAddress)
 
 	// Build email message
@@ -74,13 +110,14 @@ func (c *Client) sendEmail(to, subject, htmlBody, plainBody string) error {
 	addr := fmt.Sprintf("%s:%d", c.config.SMTPHost, c.config.SMTPPort)
 	err := smtp.SendMail(addr, auth, c.config.FromAddress, []string{to}, msg.Bytes())
 	if err != nil {
+		span.SetStatus(codes.Error, "send failed")
 		return fmt.Errorf("failed to send email: %w", err)
 	}
 
 	return nil
 }
 
-func (c *Client) renderSecretNotificationHTML(recipientName, senderName, secretURL string) (string, error) {
+func (c *Client) renderSecretNotificationHTML(recipientName, senderName, lead, secretURL string) (string, error) {
 	tmpl := `
 <!DOCTYPE html>
 <html>
@@ -102,7 +139,7 @@ func (c *Client) renderSecretNotificationHTML(recipientName, senderName, secretU
         </div>
         <div class="content">
             <p>Hi {{.RecipientName}},</p>
-            <p><strong>{{.SenderName}}</strong> has sent you a secure, ephemeral message via Vanish.</p>
+            <p><strong>{{.SenderName}}</strong> {{.Lead}}</p>
 
             <div style="text-align: center;">
                 <a href="{{.SecretURL}}" class="button">View Secret Message</a>
@@ -138,10 +175,12 @@ func (c *Client) renderSecretNotificationHTML(recipientName, senderName, secretU
 	data := struct {
 		RecipientName string
 		SenderName    string
+		Lead          string
 		SecretURL     string
 	}{
 		RecipientName: recipientName,
 		SenderName:    senderName,
+		Lead:          lead,
 		SecretURL:     secretURL,
 	}
 
@@ -153,11 +192,11 @@ func (c *Client) renderSecretNotificationHTML(recipientName, senderName, secretU
 	return buf.String(), nil
 }
 
-func (c *Client) renderSecretNotificationPlain(recipientName, senderName, secretURL string) string {
+func (c *Client) renderSecretNotificationPlain(recipientName, senderName, lead, secretURL string) string {
 	return fmt.Sprintf(`
 Hi %s,
 
-%s has sent you a secure, ephemeral message via Vanish.
+%s %s
 
 Click here to view: %s
 
@@ -171,5 +210,5 @@ IMPORTANT:
 This is an automated message from Vanish - Secure Ephemeral Messaging Platform
 
 If you did not expect this message, please contact your security team.
-`, recipientName, senderName, secretURL)
+`, recipientName, senderName, lead, secretURL)
 }
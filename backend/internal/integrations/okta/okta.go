@@ -3,30 +3,58 @@ package okta
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/milkiss/vanish/backend/internal/httpclient"
 	"golang.org/x/oauth2"
 )
 
+// DefaultTimeout bounds every request to Okta when Config.Timeout is unset
+const DefaultTimeout = 10 * time.Second
+
+// retryDelay is the pause before retrying a request that failed with a 5xx
+const retryDelay = 200 * time.Millisecond
+
 // Config holds Okta configuration
 type Config struct {
 	Domain       string
 	ClientID     string
 	ClientSecret string
 	RedirectURL  string
+	RegionClaim  string        // Optional claim naming the user's data residency region
+	Timeout      time.Duration // per-request timeout (DefaultTimeout if zero)
+	BaseURL      string        // Optional override of https://<Domain> (used in tests)
+	HTTPClient   *http.Client  // Optional, and its own timeout applies; built from Timeout if nil
 }
 
 // Client represents an Okta OIDC client
 type Client struct {
-	config   *Config
-	provider *oidc.Provider
-	verifier *oidc.IDTokenVerifier
+	config       *Config
+	httpClient   *http.Client
+	provider     *oidc.Provider
+	verifier     *oidc.IDTokenVerifier
 	oauth2Config oauth2.Config
 }
 
+// StatusError reports a non-2xx response from an Okta endpoint
+type StatusError struct {
+	Endpoint   string
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("okta %s returned status %d", e.Endpoint, e.StatusCode)
+}
+
+// ErrTokenInactive is returned when introspection reports the token inactive
+var ErrTokenInactive = errors.New("token is not active")
+
 // UserInfo represents user information from Okta
 type UserInfo struct {
 	Sub           string `json:"sub"`
@@ -35,13 +63,30 @@ type UserInfo struct {
 	Name          string `json:"name"`
 	GivenName     string `json:"given_name"`
 	FamilyName    string `json:"family_name"`
+
+	// Region is the lowercased value of Config.RegionClaim, empty when it
+	// is not configured or the claim is missing or not a string
+	Region string `json:"-"`
 }
 
 // NewClient creates a new Okta OIDC client
 func NewClient(ctx context.Context, config *Config) (*Client, error) {
-	issuerURL := fmt.Sprintf("https://%s", config.Domain)
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		var err error
+		if httpClient, err = httpclient.New(httpclient.Options{Timeout: timeout}); err != nil {
+			return nil, err
+		}
+	}
+
+	// Discovery, JWKS fetches and code exchange all use the bounded client
+	ctx = oidc.ClientContext(ctx, httpClient)
 
-	provider, err := oidc.NewProvider(ctx, issuerURL)
+	provider, err := oidc.NewProvider(ctx, baseURL(config))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create OIDC provider: %w", err)
 	}
@@ -58,6 +103,7 @@ func NewClient(ctx context.Context, config *Config) (*Client, error) {
 
 	return &Client{
 		config:       config,
+		httpClient:   httpClient,
 		provider:     provider,
 		verifier:     verifier,
 		oauth2Config: oauth2Config,
@@ -71,7 +117,7 @@ func (c *Client) GetAuthURL(state string) string {
 
 // ExchangeCode exchanges an authorization code for tokens
 func (c *Client) ExchangeCode(ctx context.Context, code string) (*oauth2.Token, error) {
-	token, err := c.oauth2Config.Exchange(ctx, code)
+	token, err := c.oauth2Config.Exchange(oidc.ClientContext(ctx, c.httpClient), code)
 	if err != nil {
 		return nil, fmt.Errorf("failed to exchange code: %w", err)
 	}
@@ -80,7 +126,7 @@ func (c *Client) ExchangeCode(ctx context.Context, code string) (*oauth2.Token,
 
 // VerifyIDToken verifies and extracts claims from an ID token
 func (c *Client) VerifyIDToken(ctx context.Context, rawIDToken string) (*oidc.IDToken, error) {
-	idToken, err := c.verifier.Verify(ctx, rawIDToken)
+	idToken, err := c.verifier.Verify(oidc.ClientContext(ctx, c.httpClient), rawIDToken)
 	if err != nil {
 		return nil, fmt.Errorf("failed to verify ID token: %w", err)
 	}
@@ -99,62 +145,118 @@ func (c *Client) GetUserInfo(ctx context.Context, token *oauth2.Token) (*UserInf
 		return nil, err
 	}
 
-	var userInfo UserInfo
-	if err := idToken.Claims(&userInfo); err != nil {
+	var claims json.RawMessage
+	if err := idToken.Claims(&claims); err != nil {
 		return nil, fmt.Errorf("failed to parse claims: %w", err)
 	}
+	return c.parseUserInfo(claims)
+}
 
+// parseUserInfo reads the user from the claims of an ID token or a
+// userinfo response, and the region from Config.RegionClaim when set
+func (c *Client) parseUserInfo(claims json.RawMessage) (*UserInfo, error) {
+	var userInfo UserInfo
+	if err := json.Unmarshal(claims, &userInfo); err != nil {
+		return nil, fmt.Errorf("failed to parse claims: %w", err)
+	}
+	if c.config.RegionClaim != "" {
+		var all map[string]interface{}
+		if err := json.Unmarshal(claims, &all); err != nil {
+			return nil, fmt.Errorf("failed to parse claims: %w", err)
+		}
+		if region, ok := all[c.config.RegionClaim].(string); ok {
+			userInfo.Region = strings.ToLower(strings.TrimSpace(region))
+		}
+	}
 	return &userInfo, nil
 }
 
 // ValidateAccessToken validates an Okta access token
 func (c *Client) ValidateAccessToken(ctx context.Context, accessToken string) (*UserInfo, error) {
 	// Call Okta's introspection endpoint
-	req, err := http.NewRequestWithContext(ctx, "POST",
-		fmt.Sprintf("https://%s/oauth2/default/v1/introspect", c.config.Domain),
-		strings.NewReader(fmt.Sprintf("token=%s&token_type_hint=access_token", accessToken)))
-
-	if err != nil {
-		return nil, err
-	}
-
-	req.SetBasicAuth(c.config.ClientID, c.config.ClientSecret)
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
+	form := url.Values{"token": {accessToken}, "token_type_hint": {"access_token"}}
 	var result struct {
 		Active bool   `json:"active"`
 		Sub    string `json:"sub"`
 	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+	err := c.doJSON(ctx, "introspect", &result, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", c.endpoint("introspect"), strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err
+		}
+		req.SetBasicAuth(c.config.ClientID, c.config.ClientSecret)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	if !result.Active {
-		return nil, fmt.Errorf("token is not active")
+		return nil, ErrTokenInactive
 	}
 
 	// Fetch full user info
-	userInfoReq, _ := http.NewRequestWithContext(ctx, "GET",
-		fmt.Sprintf("https://%s/oauth2/default/v1/userinfo", c.config.Domain), nil)
-	userInfoReq.Header.Set("Authorization", "Bearer "+accessToken)
-
-	userInfoResp, err := http.DefaultClient.Do(userInfoReq)
+	var claims json.RawMessage
+	err = c.doJSON(ctx, "userinfo", &claims, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", c.endpoint("userinfo"), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		return req, nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	defer userInfoResp.Body.Close()
 
-	var userInfo UserInfo
-	if err := json.NewDecoder(userInfoResp.Body).Decode(&userInfo); err != nil {
-		return nil, err
+	return c.parseUserInfo(claims)
+}
+
+// doJSON sends the request built by newRequest and decodes a 2xx JSON body
+// into out. A 5xx response is retried once; every error names the endpoint.
+func (c *Client) doJSON(ctx context.Context, endpoint string, out interface{}, newRequest func() (*http.Request, error)) error {
+	for attempt := 1; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return fmt.Errorf("okta %s: failed to build request: %w", endpoint, err)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("okta %s: request failed: %w", endpoint, err)
+		}
+
+		if resp.StatusCode >= 500 && attempt == 1 {
+			resp.Body.Close()
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("okta %s: %w", endpoint, ctx.Err())
+			case <-time.After(retryDelay):
+			}
+			continue
+		}
+
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return &StatusError{Endpoint: endpoint, StatusCode: resp.StatusCode}
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("okta %s: failed to decode response: %w", endpoint, err)
+		}
+		return nil
 	}
+}
 
-	return &userInfo, nil
+// endpoint returns the URL of an authorization server method
+func (c *Client) endpoint(method string) string {
+	return baseURL(c.config) + "/oauth2/default/v1/" + method
+}
+
+// baseURL returns the Okta org URL
+func baseURL(config *Config) string {
+	if config.BaseURL != "" {
+		return strings.TrimSuffix(config.BaseURL, "/")
+	}
+	return "https://" + config.Domain
 }
@@ -0,0 +1,138 @@
+package slack
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	neturl "net/url"
+	"strings"
+)
+
+// DefaultAuthorizeURL is the page where a workspace approves installing the app
+const DefaultAuthorizeURL = "https://slack.com/oauth/v2/authorize"
+
+// DefaultScopes are the bot scopes Vanish uses: the slash command, DMs and
+// looking users up by email
+var DefaultScopes = []string{"commands", "chat:write", "im:write", "users:read", "users:read.email"}
+
+// Installation is the app installed into a workspace by ExchangeCode
+type Installation struct {
+	TeamID      string
+	TeamName    string
+	BotUserID   string
+	BotToken    string
+	Scope       string
+	InstalledBy string // Slack user ID of whoever approved the install
+}
+
+// CanInstall reports whether the OAuth credentials needed to install the
+// app into workspaces are configured
+func (c *Client) CanInstall() bool {
+	return c.config.ClientID != "" && c.config.ClientSecret != "" && c.config.RedirectURL != ""
+}
+
+// AllowsTeam reports whether the app may be installed into a workspace
+func (c *Client) AllowsTeam(teamID string) bool {
+	if len(c.config.AllowedTeams) == 0 {
+		return true
+	}
+	for _, allowed := range c.config.AllowedTeams {
+		if allowed == teamID {
+			return true
+		}
+	}
+	return false
+}
+
+// HasBotToken reports whether the client has a bot token of its own, the
+// default installation that serves workspaces without one
+func (c *Client) HasBotToken() bool {
+	return c.config.BotToken != ""
+}
+
+// WithBotToken returns a client that calls Slack with the bot token of
+// another workspace and shares everything else with c
+func (c *Client) WithBotToken(token string) *Client {
+	config := *c.config
+	config.BotToken = token
+	return &Client{config: &config, client: c.client}
+}
+
+// InstallURL returns the page that asks a workspace to install the app and
+// then redirects to the configured redirect URL with a code and state
+func (c *Client) InstallURL(state string) string {
+	base := c.config.AuthorizeURL
+	if base == "" {
+		base = DefaultAuthorizeURL
+	}
+	scopes := c.config.Scopes
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+	query := neturl.Values{
+		"client_id":    {c.config.ClientID},
+		"scope":        {strings.Join(scopes, ",")},
+		"redirect_uri": {c.config.RedirectURL},
+		"state":        {state},
+	}
+	return base + "?" + query.Encode()
+}
+
+// ExchangeCode trades the code of an approved install for the workspace's
+// bot token
+func (c *Client) ExchangeCode(ctx context.Context, code string) (*Installation, error) {
+	form := neturl.Values{
+		"code":         {code},
+		"redirect_uri": {c.config.RedirectURL},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.apiURL("oauth.v2.access"), strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+
+	req.SetBasicAuth(c.config.ClientID, c.config.ClientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool   `json:"ok"`
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		Scope       string `json:"scope"`
+		BotUserID   string `json:"bot_user_id"`
+		Team        struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"team"`
+		AuthedUser struct {
+			ID string `json:"id"`
+		} `json:"authed_user"`
+		Error string `json:"error"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	if !result.OK {
+		return nil, fmt.Errorf("slack API error: %s", result.Error)
+	}
+	if result.TokenType != "bot" || result.AccessToken == "" || result.Team.ID == "" {
+		return nil, fmt.Errorf("slack returned no bot token for the workspace")
+	}
+
+	return &Installation{
+		TeamID:      result.Team.ID,
+		TeamName:    result.Team.Name,
+		BotUserID:   result.BotUserID,
+		BotToken:    result.AccessToken,
+		Scope:       result.Scope,
+		InstalledBy: result.AuthedUser.ID,
+	}, nil
+}
@@ -0,0 +1,52 @@
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// MaxRequestAge is how far a request timestamp may drift from now before
+// the request is rejected as a possible replay
+const MaxRequestAge = 5 * time.Minute
+
+// Signature verification errors
+var (
+	ErrMissingSignature = errors.New("missing Slack signature headers")
+	ErrStaleTimestamp   = errors.New("Slack request timestamp outside allowed window")
+	ErrInvalidSignature = errors.New("invalid Slack signature")
+)
+
+// Sign computes the v0 signature of a request body
+// The base string is "v0:<timestamp>:<body>" with the body bytes used verbatim
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	return "v0=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks the X-Slack-Signature and X-Slack-Request-Timestamp
+// headers against the raw request body as received, before any form parsing
+func VerifySignature(secret, timestamp, signature string, body []byte, now time.Time) error {
+	if timestamp == "" || signature == "" {
+		return ErrMissingSignature
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrStaleTimestamp
+	}
+	age := now.Sub(time.Unix(ts, 0))
+	if age > MaxRequestAge || age < -MaxRequestAge {
+		return ErrStaleTimestamp
+	}
+
+	if !hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
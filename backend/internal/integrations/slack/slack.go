@@ -6,13 +6,32 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	neturl "net/url"
+	"strings"
+
+	"github.com/milkiss/vanish/backend/internal/httpclient"
+	"github.com/milkiss/vanish/backend/internal/models"
 )
 
+// DefaultAPIURL is the base URL of the Slack Web API
+const DefaultAPIURL = "https://slack.com/api"
+
 // Config holds Slack configuration
 type Config struct {
 	BotToken      string
 	WebhookURL    string
 	SigningSecret string
+	APIURL        string       // Optional override of the Slack Web API base URL (used in tests)
+	HTTPClient    *http.Client // Optional; httpclient.Default() if nil
+
+	// OAuth credentials of the app, for installing it into workspaces;
+	// installation is unavailable without them
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string   // where Slack sends the browser back after an install
+	Scopes       []string // bot scopes requested; DefaultScopes if empty
+	AuthorizeURL string   // Optional override of DefaultAuthorizeURL (used in tests)
+	AllowedTeams []string // workspace IDs the app may be installed into; empty allows any
 }
 
 // Client represents a Slack API client
@@ -23,45 +42,118 @@ type Client struct {
 
 // NewClient creates a new Slack client
 func NewClient(config *Config) *Client {
+	httpClient := config.HTTPClient
+	if httpClient == nil {
+		httpClient = httpclient.Default()
+	}
 	return &Client{
 		config: config,
-		client: &http.Client{},
+		client: httpClient,
 	}
 }
 
+// SigningSecret returns the secret Slack signs requests to the app with
+func (c *Client) SigningSecret() string {
+	return c.config.SigningSecret
+}
+
+// apiURL returns the full URL for a Slack Web API method
+func (c *Client) apiURL(method string) string {
+	base := c.config.APIURL
+	if base == "" {
+		base = DefaultAPIURL
+	}
+	return strings.TrimSuffix(base, "/") + "/" + method
+}
+
 // SendDirectMessage sends a DM to a user by email
 func (c *Client) SendDirectMessage(ctx context.Context, userEmail, message string) error {
+	_, _, err := c.postDirectMessage(ctx, userEmail, message)
+	return err
+}
+
+// postDirectMessage sends a DM to a user by email and returns its channel
+// and timestamp, which identify it to chat.update
+func (c *Client) postDirectMessage(ctx context.Context, userEmail, message string) (string, string, error) {
 	// First, look up user by email
 	userID, err := c.getUserIDByEmail(ctx, userEmail)
 	if err != nil {
-		return fmt.Errorf("failed to find user: %w", err)
+		return "", "", fmt.Errorf("failed to find user: %w", err)
 	}
 
 	// Open a DM channel
 	channelID, err := c.openDMChannel(ctx, userID)
 	if err != nil {
-		return fmt.Errorf("failed to open DM channel: %w", err)
+		return "", "", fmt.Errorf("failed to open DM channel: %w", err)
 	}
 
 	// Send message
-	return c.postMessage(ctx, channelID, message)
+	ts, err := c.postMessage(ctx, channelID, message)
+	return channelID, ts, err
+}
+
+// SendSecretNotification sends a notification that a secret has been
+// shared, worded in style
+func (c *Client) SendSecretNotification(ctx context.Context, recipientEmail, senderName, secretURL string, style models.NotificationStyle) error {
+	return c.SendDirectMessage(ctx, recipientEmail, secretNotificationText(senderName, secretURL, 1, style))
+}
+
+// PostSecretNotification sends a notification like SendSecretNotification,
+// saying it was sent count times, and returns a reference to the DM for
+// UpdateSecretNotification, or "" when Slack did not identify it
+func (c *Client) PostSecretNotification(ctx context.Context, recipientEmail, senderName, secretURL string, count int, style models.NotificationStyle) (string, error) {
+	channelID, ts, err := c.postDirectMessage(ctx, recipientEmail, secretNotificationText(senderName, secretURL, count, style))
+	if err != nil || ts == "" {
+		return "", err
+	}
+	return channelID + " " + ts, nil
 }
 
-// SendSecretNotification sends a notification that a secret has been shared
-func (c *Client) SendSecretNotification(ctx context.Context, recipientEmail, senderName, secretURL string) error {
-	message := fmt.Sprintf(
-		"🔒 *New Secure Message from %s*\n\n"+
+// UpdateSecretNotification rewrites a notification posted by
+// PostSecretNotification to link to secretURL and say it was sent count
+// times, worded in style
+func (c *Client) UpdateSecretNotification(ctx context.Context, ref, senderName, secretURL string, count int, style models.NotificationStyle) error {
+	channelID, ts, ok := strings.Cut(ref, " ")
+	if !ok {
+		return fmt.Errorf("invalid message reference %q", ref)
+	}
+	return c.updateMessage(ctx, channelID, ts, secretNotificationText(senderName, secretURL, count, style))
+}
+
+// secretNotificationText renders a notification in style; repeats of it
+// collapsed into one message are counted in the title. Digest notifications
+// are a single line, urgent ones ask the recipient to open the message soon
+func secretNotificationText(senderName, secretURL string, count int, style models.NotificationStyle) string {
+	repeats := ""
+	if count > 1 {
+		repeats = fmt.Sprintf(" (x%d)", count)
+	}
+
+	switch style {
+	case models.NotificationDigest:
+		return fmt.Sprintf("🔒 %s shared a one-time message with you%s: %s", senderName, repeats, secretURL)
+	case models.NotificationUrgent:
+		return fmt.Sprintf(
+			"🚨 *Urgent: Secure Message from %s*%s\n\n"+
+				"You have received a secure, ephemeral message that needs your attention. "+
+				"Please open it as soon as possible: it expires soon.\n\n"+
+				"Click here to view (one-time access only):\n%s\n\n"+
+				"⚠️ This message will be permanently destroyed after you read it.",
+			senderName, repeats, secretURL,
+		)
+	}
+
+	return fmt.Sprintf(
+		"🔒 *New Secure Message from %s*%s\n\n"+
 			"You have received a secure, ephemeral message.\n\n"+
 			"Click here to view (one-time access only):\n%s\n\n"+
 			"⚠️ This message will be permanently destroyed after you read it.",
-		senderName, secretURL,
+		senderName, repeats, secretURL,
 	)
-
-	return c.SendDirectMessage(ctx, recipientEmail, message)
 }
 
 func (c *Client) getUserIDByEmail(ctx context.Context, email string) (string, error) {
-	url := "https://slack.com/api/users.lookupByEmail?email=" + email
+	url := c.apiURL("users.lookupByEmail?email=" + neturl.QueryEscape(email))
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
@@ -77,8 +169,8 @@ func (c *Client) getUserIDByEmail(ctx context.Context, email string) (string, er
 	defer resp.Body.Close()
 
 	var result struct {
-		OK    bool   `json:"ok"`
-		User  struct {
+		OK   bool `json:"ok"`
+		User struct {
 			ID string `json:"id"`
 		} `json:"user"`
 		Error string `json:"error"`
@@ -96,7 +188,7 @@ func (c *Client) getUserIDByEmail(ctx context.Context, email string) (string, er
 }
 
 func (c *Client) openDMChannel(ctx context.Context, userID string) (string, error) {
-	url := "https://slack.com/api/conversations.open"
+	url := c.apiURL("conversations.open")
 
 	payload := map[string]interface{}{
 		"users": userID,
@@ -118,7 +210,7 @@ func (c *Client) openDMChannel(ctx context.Context, userID string) (string, erro
 	defer resp.Body.Close()
 
 	var result struct {
-		OK      bool   `json:"ok"`
+		OK      bool `json:"ok"`
 		Channel struct {
 			ID string `json:"id"`
 		} `json:"channel"`
@@ -136,11 +228,66 @@ func (c *Client) openDMChannel(ctx context.Context, userID string) (string, erro
 	return result.Channel.ID, nil
 }
 
-func (c *Client) postMessage(ctx context.Context, channelID, message string) error {
-	url := "https://slack.com/api/chat.postMessage"
+// PostToChannel posts a Block Kit message to a channel the bot is a member
+// of and returns its timestamp. text is the fallback shown in
+// notifications and by clients that cannot render blocks
+func (c *Client) PostToChannel(ctx context.Context, channel, text string, blocks []map[string]interface{}) (string, error) {
+	return c.post(ctx, map[string]interface{}{
+		"channel": channel,
+		"text":    text,
+		"blocks":  blocks,
+	})
+}
+
+func (c *Client) postMessage(ctx context.Context, channelID, message string) (string, error) {
+	return c.post(ctx, map[string]interface{}{
+		"channel": channelID,
+		"text":    message,
+	})
+}
+
+// post calls chat.postMessage and returns the message timestamp
+func (c *Client) post(ctx context.Context, payload map[string]interface{}) (string, error) {
+	url := c.apiURL("chat.postMessage")
+
+	body, _ := json.Marshal(payload)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.config.BotToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK    bool   `json:"ok"`
+		TS    string `json:"ts"`
+		Error string `json:"error"`
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	if !result.OK {
+		return "", fmt.Errorf("slack API error: %s", result.Error)
+	}
+
+	return result.TS, nil
+}
+
+func (c *Client) updateMessage(ctx context.Context, channelID, ts, message string) error {
+	url := c.apiURL("chat.update")
 
 	payload := map[string]interface{}{
 		"channel": channelID,
+		"ts":      ts,
 		"text":    message,
 	}
 
@@ -177,12 +324,29 @@ func (c *Client) postMessage(ctx context.Context, channelID, message string) err
 
 // OpenModal opens a modal dialog in Slack
 func (c *Client) OpenModal(ctx context.Context, triggerID string, view map[string]interface{}) error {
-	url := "https://slack.com/api/views.open"
-
-	payload := map[string]interface{}{
+	return c.callViews(ctx, "views.open", map[string]interface{}{
 		"trigger_id": triggerID,
 		"view":       view,
+	})
+}
+
+// UpdateView replaces an open modal with view. hash, from the interaction
+// payload, makes Slack refuse the update when the modal changed meanwhile;
+// it may be empty
+func (c *Client) UpdateView(ctx context.Context, viewID, hash string, view map[string]interface{}) error {
+	payload := map[string]interface{}{
+		"view_id": viewID,
+		"view":    view,
 	}
+	if hash != "" {
+		payload["hash"] = hash
+	}
+	return c.callViews(ctx, "views.update", payload)
+}
+
+// callViews posts payload to a views.* method
+func (c *Client) callViews(ctx context.Context, method string, payload map[string]interface{}) error {
+	url := c.apiURL(method)
 
 	body, _ := json.Marshal(payload)
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(body))
@@ -224,7 +388,7 @@ type UserInfo struct {
 
 // GetUserInfo gets information about a Slack user by ID
 func (c *Client) GetUserInfo(ctx context.Context, userID string) (*UserInfo, error) {
-	url := "https://slack.com/api/users.info?user=" + userID
+	url := c.apiURL("users.info?user=" + neturl.QueryEscape(userID))
 
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
@@ -240,8 +404,8 @@ func (c *Client) GetUserInfo(ctx context.Context, userID string) (*UserInfo, err
 	defer resp.Body.Close()
 
 	var result struct {
-		OK    bool   `json:"ok"`
-		User  struct {
+		OK   bool `json:"ok"`
+		User struct {
 			ID      string `json:"id"`
 			Name    string `json:"name"`
 			Profile struct {
@@ -275,7 +439,7 @@ func (c *Client) SendEphemeralMessage(ctx context.Context, userID, message strin
 		return fmt.Errorf("failed to open DM channel: %w", err)
 	}
 
-	url := "https://slack.com/api/chat.postEphemeral"
+	url := c.apiURL("chat.postEphemeral")
 
 	payload := map[string]interface{}{
 		"channel": channelID,
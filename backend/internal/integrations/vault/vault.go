@@ -127,6 +127,12 @@ func (c *Client) GetJWTSecret(ctx context.Context) (string, error) {
 	return c.GetSecretField(ctx, "vanish/jwt", "secret")
 }
 
+// GetMetadataEncryptionKeys retrieves the master keys for encrypting stored
+// message keys, in the same version:base64-key list format as the environment
+func (c *Client) GetMetadataEncryptionKeys(ctx context.Context) (string, error) {
+	return c.GetSecretField(ctx, "vanish/metadata-encryption", "keys")
+}
+
 // GetSlackToken retrieves Slack bot token from Vault
 func (c *Client) GetSlackToken(ctx context.Context) (string, error) {
 	return c.GetSecretField(ctx, "vanish/slack", "bot_token")
@@ -0,0 +1,57 @@
+package lifecycle
+
+import (
+	"context"
+	"log/slog"
+	"net"
+
+	"google.golang.org/grpc"
+)
+
+// grpcServer adapts a *grpc.Server to the Component interface
+type grpcServer struct {
+	name   string
+	addr   string
+	server *grpc.Server
+}
+
+// GRPCServer wraps server, listening on addr, as a component
+func GRPCServer(name, addr string, server *grpc.Server) Component {
+	return &grpcServer{name: name, addr: addr, server: server}
+}
+
+func (s *grpcServer) Name() string { return s.name }
+
+// Start binds the listener synchronously so address errors are reported
+// to the caller, then serves in the background
+func (s *grpcServer) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil {
+			slog.Error("server stopped unexpectedly", "component", s.name, "error", err)
+		}
+	}()
+	return nil
+}
+
+// Stop stops accepting calls and waits for in-flight ones; calls still
+// running when ctx is done are cancelled
+func (s *grpcServer) Stop(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.server.Stop()
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,51 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+)
+
+// httpServer adapts an *http.Server to the Component interface
+type httpServer struct {
+	name   string
+	server *http.Server
+	tls    bool
+}
+
+// HTTPServer wraps server as a component
+// With useTLS the server must carry a TLSConfig that supplies certificates
+func HTTPServer(name string, server *http.Server, useTLS bool) Component {
+	return &httpServer{name: name, server: server, tls: useTLS}
+}
+
+func (s *httpServer) Name() string { return s.name }
+
+// Start binds the listener synchronously so address errors are reported
+// to the caller, then serves in the background
+func (s *httpServer) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		var err error
+		if s.tls {
+			err = s.server.ServeTLS(listener, "", "")
+		} else {
+			err = s.server.Serve(listener)
+		}
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("server stopped unexpectedly", "component", s.name, "error", err)
+		}
+	}()
+	return nil
+}
+
+// Stop stops accepting connections and waits for in-flight requests
+func (s *httpServer) Stop(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
@@ -0,0 +1,140 @@
+// Package lifecycle starts and stops long-running server components
+// (HTTP listeners, background workers) in a well-defined order
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Component is a long-running part of the server
+// Start must not block; Stop must return once the component has drained
+// or ctx is done, whichever comes first
+type Component interface {
+	Name() string
+	Start(ctx context.Context) error
+	Stop(ctx context.Context) error
+}
+
+// Manager owns a set of components
+// Components start in registration order and stop in reverse order, so
+// listeners registered last stop accepting work before the workers they feed
+type Manager struct {
+	mu         sync.Mutex
+	components []Component
+	started    []Component
+}
+
+// NewManager creates an empty manager
+func NewManager() *Manager {
+	return &Manager{}
+}
+
+// Register adds a component; it must be called before Start
+func (m *Manager) Register(c Component) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.components = append(m.components, c)
+}
+
+// Start starts every registered component in order
+// If one fails, the components already started are stopped again
+func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	components := append([]Component(nil), m.components...)
+	m.mu.Unlock()
+
+	for _, c := range components {
+		if err := c.Start(ctx); err != nil {
+			startErr := fmt.Errorf("failed to start %s: %w", c.Name(), err)
+			if stopErr := m.Stop(ctx); stopErr != nil {
+				return errors.Join(startErr, stopErr)
+			}
+			return startErr
+		}
+		m.mu.Lock()
+		m.started = append(m.started, c)
+		m.mu.Unlock()
+		slog.Info("component started", "component", c.Name())
+	}
+	return nil
+}
+
+// Stop stops every started component in reverse order, sharing ctx's
+// deadline. Failures are logged per component and returned joined.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	started := m.started
+	m.started = nil
+	m.mu.Unlock()
+
+	var errs []error
+	for i := len(started) - 1; i >= 0; i-- {
+		c := started[i]
+		begin := time.Now()
+		if err := c.Stop(ctx); err != nil {
+			slog.Error("component failed to stop", "component", c.Name(), "error", err)
+			errs = append(errs, fmt.Errorf("%s: %w", c.Name(), err))
+			continue
+		}
+		slog.Info("component stopped", "component", c.Name(), "duration_ms", time.Since(begin).Milliseconds())
+	}
+	return errors.Join(errs...)
+}
+
+// worker runs a function in a goroutine until its context is cancelled
+type worker struct {
+	name   string
+	run    func(ctx context.Context)
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Worker wraps a blocking function as a component
+// run must return promptly once ctx is cancelled
+func Worker(name string, run func(ctx context.Context)) Component {
+	return &worker{name: name, run: run}
+}
+
+func (w *worker) Name() string { return w.name }
+
+func (w *worker) Start(ctx context.Context) error {
+	ctx, w.cancel = context.WithCancel(ctx)
+	w.done = make(chan struct{})
+	go func() {
+		defer close(w.done)
+		w.run(ctx)
+	}()
+	return nil
+}
+
+func (w *worker) Stop(ctx context.Context) error {
+	w.cancel()
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("did not exit: %w", ctx.Err())
+	}
+}
+
+// Every returns a worker body that calls fn on each tick until cancelled
+func Every(interval time.Duration, fn func(ctx context.Context)) func(ctx context.Context) {
+	return func(ctx context.Context) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				fn(ctx)
+			}
+		}
+	}
+}
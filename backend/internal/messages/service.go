@@ -0,0 +1,743 @@
+// Package messages holds the message lifecycle shared by every way in to
+// Vanish (the HTTP API, Slack and future transports): storing the
+// ciphertext with its metadata, the recipient quota, notification and
+// rollback on creation, and the recipient checks and burn-on-read on access.
+// Transports only translate requests and results
+package messages
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+	"github.com/milkiss/vanish/backend/internal/storage"
+	"github.com/milkiss/vanish/backend/internal/tracing"
+)
+
+// Error is a failure to report to the user. Code is a models.ErrorCode*
+// value, from which transports pick their status
+type Error struct {
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// ErrNotifyFailed is returned, wrapped, when a message was created but
+// CreateOptions.Notify failed. The message is kept: the sender can still
+// share the link another way
+var ErrNotifyFailed = errors.New("message created but the recipient could not be notified")
+
+// Errors shared by the access paths
+var (
+	errInvalidID       = &Error{Code: models.ErrorCodeInvalidMessageID, Message: "Invalid message ID"}
+	errNotFound        = &Error{Code: models.ErrorCodeMessageNotFound, Message: "Message not found or already burned"}
+	errNotRecipient    = &Error{Code: models.ErrorCodeNotRecipient, Message: "You are not the intended recipient of this message"}
+	errAlreadyRead     = &Error{Code: models.ErrorCodeMessageAlreadyRead, Message: "Message has already been read and burned"}
+	errExpired         = &Error{Code: models.ErrorCodeMessageExpired, Message: "Message expired before it was read"}
+	errRevoked         = &Error{Code: models.ErrorCodeMessageRevoked, Message: "Message was revoked before it was read"}
+	errNotYetAvailable = &Error{Code: models.ErrorCodeNotYetAvailable, Message: "Message is scheduled and not available yet"}
+)
+
+// internal reports a server fault described by message
+func internal(message string) *Error {
+	return &Error{Code: models.ErrorCodeInternal, Message: message}
+}
+
+// Service creates and opens messages
+type Service struct {
+	storage      storage.Storage
+	metadataRepo persistence.MetadataStore
+	maxPending   int // per recipient; 0 disables the cap
+
+	users    persistence.UserStore      // looks up recipient domains for policies and regions for storage
+	policies persistence.TTLPolicyStore // nil applies no TTL or category policy
+	regional bool                       // storage routes messages by the recipient's region
+}
+
+// NewService creates a message service. maxPendingPerRecipient caps a
+// recipient's unread messages (0 for no cap). TTL policy rules from policies
+// apply by the domain of the recipient's email in users; either may be nil
+// to apply none. Category policies from policies apply by the category the
+// sender picks. When storage is a storage.RegionRouter, messages are
+// stored in the region of the recipient in users
+func NewService(store storage.Storage, metadataRepo persistence.MetadataStore, maxPendingPerRecipient int, users persistence.UserStore, policies persistence.TTLPolicyStore) *Service {
+	_, regional := store.(storage.RegionRouter)
+	return &Service{storage: store, metadataRepo: metadataRepo, maxPending: maxPendingPerRecipient, users: users, policies: policies, regional: regional}
+}
+
+// Payload is the encrypted content of a message
+type Payload struct {
+	Ciphertext      string
+	IV              string
+	ContentEncoding string // models.ContentEncodingGzip when compressed before encryption
+}
+
+// CreateOptions holds the optional parts of a new message
+type CreateOptions struct {
+	EncryptionKey string        // stored so the recipient can reopen the link; empty to keep no key
+	SealedKey     string        // the key sealed to the recipient, stored instead of EncryptionKey
+	AvailableAt   *time.Time    // schedules the message; see models.ValidateSchedule
+	Integration   string        // integration creating the message; empty for a user
+	CreatedVia    models.Client // client creating the message; empty for models.ClientAPI
+	Category      string        // message category, see models.CategoryPolicy; empty for none
+
+	// ExternalRecipientEmail addresses the message to someone without an
+	// account, who reads it with ReadExternal; recipientID is then 0. The
+	// TTL policy of the address's domain applies and no quota does
+	ExternalRecipientEmail string
+
+	// DryRun runs every check, the recipient quota included, and returns the
+	// metadata with a synthetic ID, but stores nothing and never notifies
+	DryRun bool
+
+	// Notify, when set, tells the recipient once the message is stored
+	Notify func(ctx context.Context, metadata *models.MessageMetadata) error
+}
+
+// CheckBatchQuota refuses a batch that would take any recipient past the
+// cap on unread messages, before any of it is stored. batch counts the
+// messages of the batch by recipient ID. Like the check in CreateEncrypted,
+// it is not atomic with the inserts
+func (s *Service) CheckBatchQuota(ctx context.Context, batch map[int64]int) error {
+	if s.maxPending <= 0 {
+		return nil
+	}
+	recipients := make([]int64, 0, len(batch))
+	for recipientID := range batch {
+		recipients = append(recipients, recipientID)
+	}
+	slices.Sort(recipients)
+
+	for _, recipientID := range recipients {
+		pending, err := s.metadataRepo.CountPendingForRecipient(ctx, recipientID)
+		if err != nil {
+			return internal("Failed to check recipient inbox")
+		}
+		if pending+batch[recipientID] > s.maxPending {
+			return &Error{
+				Code: models.ErrorCodeRecipientInboxFull,
+				Message: fmt.Sprintf("Recipient %d has %d unread messages and the batch adds %d, more than the limit of %d; nothing was sent",
+					recipientID, pending, batch[recipientID], s.maxPending),
+			}
+		}
+	}
+	return nil
+}
+
+// CreateEncrypted stores an encrypted message from senderID to recipientID
+// and returns its metadata. ttl is in seconds, nil for the default; the
+// policy of the message category and the TTL policy of the recipient's
+// domain may change the default and shorten the TTL. The TTL of a scheduled
+// message counts from its release. If the metadata cannot be recorded the
+// stored payload is discarded again
+func (s *Service) CreateEncrypted(ctx context.Context, senderID, recipientID int64, payload Payload, ttl *int64, opts CreateOptions) (*models.MessageMetadata, error) {
+	recipient, err := s.recipient(ctx, recipientID)
+	if err != nil {
+		return nil, err
+	}
+	if opts.ExternalRecipientEmail != "" {
+		if err := s.checkDomain(ctx, opts.ExternalRecipientEmail, "Messages cannot be sent to this email domain"); err != nil {
+			return nil, err
+		}
+		recipient = &models.User{Email: opts.ExternalRecipientEmail}
+	}
+	category, err := s.CategoryPolicy(ctx, opts.Category)
+	if err != nil {
+		return nil, err
+	}
+	ttlSeconds, limited, err := s.resolveTTL(ctx, recipient, category, ttl)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if err := models.ValidateSchedule(opts.AvailableAt, ttlSeconds, now); err != nil {
+		return nil, &Error{Code: models.ErrorCodeInvalidSchedule, Message: err.Error()}
+	}
+
+	// Refuse to pile more unread messages on one recipient. The count and the
+	// insert are not atomic, so concurrent senders can overshoot slightly
+	if s.maxPending > 0 && opts.ExternalRecipientEmail == "" {
+		pending, err := s.metadataRepo.CountPendingForRecipient(ctx, recipientID)
+		if err != nil {
+			return nil, internal("Failed to check recipient inbox")
+		}
+		if pending >= s.maxPending {
+			return nil, &Error{
+				Code:    models.ErrorCodeRecipientInboxFull,
+				Message: fmt.Sprintf("Recipient already has %d unread messages; wait until they read or expire some", pending),
+			}
+		}
+	}
+
+	var availableAt *time.Time
+	start := now
+	if opts.AvailableAt != nil {
+		release := opts.AvailableAt.UTC()
+		availableAt = &release
+		start = release
+	}
+	expiresAt := start.Add(time.Duration(ttlSeconds) * time.Second)
+
+	if opts.DryRun {
+		id, err := storage.NewID()
+		if err != nil {
+			return nil, internal("Failed to generate message ID")
+		}
+		return &models.MessageMetadata{
+			MessageID:   id,
+			SenderID:    senderID,
+			RecipientID: recipientID,
+			Status:      models.StatusPending,
+			CreatedAt:   now,
+			ExpiresAt:   expiresAt,
+			AvailableAt: availableAt,
+			Category:    opts.Category,
+
+			ExternalRecipientEmail: opts.ExternalRecipientEmail,
+			TTLLimitedByPolicy:     limited,
+			CategoryPolicy:         applied(category),
+		}, nil
+	}
+
+	// The ciphertext goes to Redis, which expires it; everything else to
+	// the metadata
+	msg := &models.Message{Ciphertext: payload.Ciphertext, IV: payload.IV, ContentEncoding: payload.ContentEncoding, CreatedAt: now}
+	if recipient != nil {
+		msg.Region = recipient.Region
+	}
+	metadata := &models.MessageMetadata{
+		SenderID:      senderID,
+		RecipientID:   recipientID,
+		EncryptionKey: opts.EncryptionKey,
+		SealedKey:     opts.SealedKey,
+		Status:        models.StatusPending,
+		CreatedAt:     now,
+		ExpiresAt:     expiresAt,
+		SenderType:    models.SenderTypeUser,
+		CreatedVia:    opts.CreatedVia,
+		AvailableAt:   availableAt,
+		Category:      opts.Category,
+
+		ExternalRecipientEmail: opts.ExternalRecipientEmail,
+		TTLLimitedByPolicy:     limited,
+		CategoryPolicy:         applied(category),
+	}
+	if metadata.CreatedVia == "" {
+		metadata.CreatedVia = models.ClientAPI
+	}
+	if opts.Integration != "" {
+		metadata.SenderType = models.SenderTypeIntegration
+		metadata.IntegrationName = opts.Integration
+	}
+	if err := s.store(ctx, msg, expiresAt.Sub(now), metadata); err != nil {
+		return nil, err
+	}
+
+	if opts.Notify != nil {
+		if err := opts.Notify(ctx, metadata); err != nil {
+			return metadata, fmt.Errorf("%w: %v", ErrNotifyFailed, err)
+		}
+	}
+	return metadata, nil
+}
+
+// store saves msg in storage under a fresh ID and records metadata for it
+// in PostgreSQL (sender, recipient, but NOT content). An ID taken in
+// storage, or by the metadata of an older message (metadata outlives the
+// payload), is retried with another. If the metadata cannot be recorded
+// the stored payload is discarded again
+func (s *Service) store(ctx context.Context, msg *models.Message, ttl time.Duration, metadata *models.MessageMetadata) error {
+	for attempt := 1; attempt <= storage.MaxIDAttempts; attempt++ {
+		id, err := storage.NewID()
+		if err != nil {
+			return internal("Failed to generate message ID")
+		}
+
+		// Store the ciphertext in Redis, which expires it
+		id, err = s.storage.StoreWithID(ctx, id, msg, ttl)
+		if errors.Is(err, storage.ErrIDCollision) {
+			requestid.Logger(ctx).Warn("message ID collision in storage; retrying", "attempt", attempt)
+			continue
+		}
+		if errors.Is(err, storage.ErrUnknownRegion) {
+			requestid.Logger(ctx).Error("no message storage for recipient region", "region", msg.Region)
+			return &Error{Code: models.ErrorCodeUnavailable, Message: "Message storage for the recipient's region is unavailable"}
+		}
+		if err != nil {
+			return internal("Failed to store message")
+		}
+
+		metadata.MessageID = id
+		err = s.metadataRepo.Create(ctx, metadata)
+		if err == nil {
+			tracing.SetMessageID(ctx, id)
+			return nil
+		}
+
+		// Without metadata nobody may read the payload; do not leave it behind
+		if _, discardErr := s.storage.GetAndDelete(ctx, id); discardErr != nil {
+			requestid.Logger(ctx).Warn("failed to discard message without metadata", "error", discardErr)
+		}
+		if !errors.Is(err, models.ErrDuplicateMessageID) {
+			return internal("Failed to store message metadata")
+		}
+		requestid.Logger(ctx).Warn("message ID collision in metadata; retrying", "attempt", attempt)
+	}
+
+	requestid.Logger(ctx).Error("no unique message ID found", "attempts", storage.MaxIDAttempts)
+	return internal("Failed to store message")
+}
+
+// recipient looks up the recipient when a TTL policy or the storage region
+// depends on it, and returns nil otherwise. It fails closed: without the
+// recipient neither can be applied
+func (s *Service) recipient(ctx context.Context, recipientID int64) (*models.User, error) {
+	if recipientID == 0 || s.users == nil || (s.policies == nil && !s.regional) {
+		return nil, nil
+	}
+	recipient, err := s.users.FindByID(ctx, recipientID)
+	if err != nil {
+		return nil, internal("Failed to look up recipient")
+	}
+	return recipient, nil
+}
+
+// CategoryPolicy returns the policy of category, or nil when category is
+// empty, has no policy or no policy store is configured
+func (s *Service) CategoryPolicy(ctx context.Context, category string) (*models.CategoryPolicy, error) {
+	if category == "" || s.policies == nil {
+		return nil, nil
+	}
+	policy, err := s.policies.GetCategoryPolicy(ctx, category)
+	if errors.Is(err, models.ErrCategoryPolicyNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, internal("Failed to load category policy")
+	}
+	return policy, nil
+}
+
+// CategoryPolicies lists the category policies senders can pick from, none
+// when no policy store is configured
+func (s *Service) CategoryPolicies(ctx context.Context) ([]*models.CategoryPolicy, error) {
+	if s.policies == nil {
+		return nil, nil
+	}
+	policies, err := s.policies.ListCategoryPolicies(ctx)
+	if err != nil {
+		return nil, internal("Failed to load category policies")
+	}
+	return policies, nil
+}
+
+// CheckRegistration refuses to register an account with email when its
+// domain is banned
+func (s *Service) CheckRegistration(ctx context.Context, email string) error {
+	return s.checkDomain(ctx, email, "Accounts cannot be registered with this email domain")
+}
+
+// checkDomain fails with message when the domain of email, or a parent
+// domain, is banned. Without a policy store no domain is
+func (s *Service) checkDomain(ctx context.Context, email, message string) error {
+	if s.policies == nil {
+		return nil
+	}
+	banned, err := s.policies.ListBannedDomains(ctx)
+	if err != nil {
+		return internal("Failed to load banned domains")
+	}
+	if models.MatchBannedDomain(banned, email) != nil {
+		return &Error{Code: models.ErrorCodeDomainBanned, Message: message}
+	}
+	return nil
+}
+
+// SenderPolicy returns what clients check before sending: the banned
+// domains and the DLP patterns to warn senders about. Both are empty when
+// no policy store is configured
+func (s *Service) SenderPolicy(ctx context.Context) (*models.SenderPolicy, error) {
+	policy := &models.SenderPolicy{BannedDomains: []string{}, DLPPatterns: []*models.DLPPattern{}}
+	if s.policies == nil {
+		return policy, nil
+	}
+	banned, err := s.policies.ListBannedDomains(ctx)
+	if err != nil {
+		return nil, internal("Failed to load banned domains")
+	}
+	for _, domain := range banned {
+		policy.BannedDomains = append(policy.BannedDomains, domain.Domain)
+	}
+	if policy.DLPPatterns, err = s.policies.ListDLPPatterns(ctx); err != nil {
+		return nil, internal("Failed to load DLP patterns")
+	}
+	return policy, nil
+}
+
+// resolveTTL validates ttl against the global limits, then applies the
+// category policy and the first TTL policy rule matching the recipient's
+// domain. When ttl is nil the category default wins over the domain
+// default; the shorter maximum of the two cuts the TTL, and a TTL the
+// sender asked for being cut is reported. A nil recipient or category
+// applies no policy of that kind
+func (s *Service) resolveTTL(ctx context.Context, recipient *models.User, category *models.CategoryPolicy, ttl *int64) (int64, bool, error) {
+	ttlSeconds, err := models.ValidateTTL(ttl)
+	if err != nil {
+		return 0, false, &Error{Code: models.ErrorCodeTTLOutOfRange, Message: err.Error()}
+	}
+
+	maxTTL := int64(models.MaxTTL)
+	if category != nil {
+		if ttl == nil {
+			ttlSeconds = category.DefaultTTL
+		}
+		maxTTL = category.MaxTTL
+	}
+	if recipient != nil && s.policies != nil {
+		rules, err := s.policies.ListTTLPolicies(ctx)
+		if err != nil {
+			return 0, false, internal("Failed to load TTL policies")
+		}
+		if rule := models.MatchTTLPolicy(rules, recipient.Email); rule != nil {
+			if ttl == nil && category == nil {
+				ttlSeconds = rule.DefaultTTL
+			}
+			maxTTL = min(maxTTL, rule.MaxTTL)
+		}
+	}
+
+	if ttlSeconds > maxTTL {
+		return maxTTL, ttl != nil, nil
+	}
+	return ttlSeconds, false, nil
+}
+
+// applied reports policy as applied to a new message, nil for no policy
+func applied(policy *models.CategoryPolicy) *models.AppliedCategoryPolicy {
+	if policy == nil {
+		return nil
+	}
+	return policy.Applied()
+}
+
+// find loads the metadata of message id
+func (s *Service) find(ctx context.Context, id string) (*models.MessageMetadata, error) {
+	if !storage.ValidID(id) {
+		return nil, errInvalidID
+	}
+
+	metadata, err := s.metadataRepo.FindByMessageID(ctx, id)
+	if errors.Is(err, models.ErrMessageNotFound) {
+		return nil, errNotFound
+	}
+	if err != nil {
+		return nil, internal("Failed to retrieve message metadata")
+	}
+	return metadata, nil
+}
+
+// open loads the metadata of message id and checks that userID may open it
+// now. The metadata is returned whenever it was found, also with an error
+func (s *Service) open(ctx context.Context, userID int64, id string) (*models.MessageMetadata, error) {
+	metadata, err := s.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// CRITICAL SECURITY CHECK: only the intended recipient gets any further
+	if metadata.RecipientID != userID {
+		return metadata, errNotRecipient
+	}
+	return metadata, openable(metadata)
+}
+
+// openable reports why a message its recipient asked for cannot be opened
+// now, or nil when it can. Read, expired and revoked messages each get
+// their own error, so recipients learn whether they missed the message or
+// someone withdrew it
+func openable(metadata *models.MessageMetadata) error {
+	now := time.Now()
+	switch {
+	case metadata.Status == models.StatusRead:
+		return errAlreadyRead
+	// Dismissed or revoked: expired before its time. A claimed payload may
+	// still linger
+	case metadata.Status == models.StatusExpired && now.Before(metadata.ExpiresAt):
+		return errRevoked
+	// Expired, or past its expiry before the janitor marked it so. A
+	// claimed message expires when its claim lapses unfetched
+	case metadata.Status == models.StatusExpired, pastExpiry(metadata, now):
+		return errExpired
+	}
+	// Scheduled messages stay closed until their release time
+	if metadata.Scheduled(now) {
+		return errNotYetAvailable
+	}
+	return nil
+}
+
+// pastExpiry reports whether a pending or claimed message has outlived its
+// expiry, which for a claimed one is when the claim lapses
+func pastExpiry(metadata *models.MessageMetadata, now time.Time) bool {
+	return (metadata.Status == models.StatusPending || metadata.Status == models.StatusClaimed) &&
+		!now.Before(metadata.ExpiresAt)
+}
+
+// Read returns message id to its recipient userID and burns it. A message
+// with a pending claim can only be read with ReadClaimed. The metadata is
+// returned whenever it was found, also with an error
+func (s *Service) Read(ctx context.Context, userID int64, id string) (*models.Message, *models.MessageMetadata, error) {
+	metadata, err := s.open(ctx, userID, id)
+	if err != nil {
+		return nil, metadata, err
+	}
+	return s.burn(ctx, id, metadata)
+}
+
+// ReadExternal returns message id to its external recipient and burns it.
+// The transport admits the recipient by the signed access token of their
+// link; this only checks that the message was sent to an external
+// recipient, so a signed-in user cannot take that path. The metadata is
+// returned whenever it was found, also with an error
+func (s *Service) ReadExternal(ctx context.Context, id string) (*models.Message, *models.MessageMetadata, error) {
+	metadata, err := s.find(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if metadata.ExternalRecipientEmail == "" {
+		return nil, metadata, errNotRecipient
+	}
+	if err := openable(metadata); err != nil {
+		return nil, metadata, err
+	}
+	return s.burn(ctx, id, metadata)
+}
+
+// IssueReadIntent starts opening message id from its share link. Anyone
+// holding the link may call it, so it never burns the message and only
+// tells whether it can be opened now. Every message that cannot is not
+// found, so the link reveals nothing else: an invalid ID, a read, expired
+// or revoked message, a scheduled one before its release and one to an
+// external recipient, who opens it with a signed link. It returns a token
+// that lets ReadWithIntent burn the message once, and when the token
+// lapses; previews within that window, such as a link unfurled by several
+// bots, share one token
+func (s *Service) IssueReadIntent(ctx context.Context, id string) (string, time.Time, error) {
+	metadata, err := s.find(ctx, id)
+	if errors.Is(err, errInvalidID) {
+		return "", time.Time{}, errNotFound
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if metadata.ExternalRecipientEmail != "" || openable(metadata) != nil {
+		return "", time.Time{}, errNotFound
+	}
+
+	exists, err := s.storage.Exists(ctx, id)
+	if err != nil {
+		return "", time.Time{}, internal("Failed to check message")
+	}
+	if !exists {
+		return "", time.Time{}, errNotFound
+	}
+
+	token, expiresAt, err := s.storage.IssueReadIntent(ctx, id, models.ReadIntentWindow)
+	if err != nil {
+		return "", time.Time{}, internal("Failed to issue read intent")
+	}
+	return token, expiresAt.UTC(), nil
+}
+
+// ReadWithIntent is Read for share links: the message is only burned with
+// a token from IssueReadIntent, and each token is taken once, so a link
+// fetched without a human behind it burns nothing. The metadata is returned
+// whenever it was found, also with an error
+func (s *Service) ReadWithIntent(ctx context.Context, userID int64, id, token string) (*models.Message, *models.MessageMetadata, error) {
+	metadata, err := s.open(ctx, userID, id)
+	if err != nil {
+		return nil, metadata, err
+	}
+
+	taken, err := s.storage.TakeReadIntent(ctx, id, token)
+	if err != nil {
+		return nil, metadata, internal("Failed to check read intent")
+	}
+	if !taken {
+		return nil, metadata, &Error{Code: models.ErrorCodeInvalidReadIntent, Message: "Read intent is invalid, expired or already used; open the link again"}
+	}
+	return s.burn(ctx, id, metadata)
+}
+
+// burn takes message id, whose recipient opened it, out of Redis and
+// records it as read. A message with a pending claim is left alone
+func (s *Service) burn(ctx context.Context, id string, metadata *models.MessageMetadata) (*models.Message, *models.MessageMetadata, error) {
+	if metadata.Status == models.StatusClaimed {
+		return nil, metadata, &Error{Code: models.ErrorCodeMessageClaimed, Message: "Message has been claimed; fetch it with its claim token"}
+	}
+
+	// Atomically get and delete the message from Redis (burn-on-read)
+	msg, err := s.storage.GetAndDelete(ctx, id)
+	if errors.Is(err, models.ErrMessageNotFound) {
+		// Metadata without a payload: expired, or burned by a concurrent read
+		return nil, metadata, errNotFound
+	}
+	if err != nil {
+		return nil, metadata, internal("Failed to retrieve message")
+	}
+
+	s.markRead(ctx, id)
+	return msg, metadata, nil
+}
+
+// ReadClaimed returns message id, claimed earlier by userID with token.
+// The first fetch marks the message read, but the claim lives on until its
+// window ends, so a fetch whose response was lost in transit can be
+// repeated with the same token. The metadata is returned whenever it was
+// found
+func (s *Service) ReadClaimed(ctx context.Context, userID int64, id, token string) (*models.Message, *models.MessageMetadata, error) {
+	metadata, err := s.open(ctx, userID, id)
+	fetched := errors.Is(err, errAlreadyRead)
+	if err != nil && !fetched {
+		return nil, metadata, err
+	}
+
+	msg, err := s.storage.FetchClaim(ctx, id, userID, token)
+	switch {
+	case errors.Is(err, models.ErrInvalidClaim):
+		return nil, metadata, &Error{Code: models.ErrorCodeInvalidClaimToken, Message: "Invalid claim token"}
+	case errors.Is(err, models.ErrClaimNotFound) && fetched:
+		return nil, metadata, errAlreadyRead
+	case errors.Is(err, models.ErrClaimNotFound):
+		return nil, metadata, &Error{Code: models.ErrorCodeClaimNotFound, Message: "Claim not found or expired"}
+	case err != nil:
+		return nil, metadata, internal("Failed to retrieve message")
+	}
+
+	if !fetched {
+		s.markRead(ctx, id)
+	}
+	return msg, metadata, nil
+}
+
+// markRead records a burned message as read. The payload is already gone,
+// so a failure only delays the status until the janitor expires it
+func (s *Service) markRead(ctx context.Context, id string) {
+	if err := s.metadataRepo.MarkAsRead(ctx, id); err != nil {
+		requestid.Logger(ctx).Warn("failed to mark message as read", "error", err)
+	}
+}
+
+// Claim moves message id into a short claim window bound to its recipient
+// userID and returns the claim token and when the claim lapses. Claiming
+// again returns the same claim. The metadata is returned whenever it was
+// found, also with an error
+func (s *Service) Claim(ctx context.Context, userID int64, id string) (string, time.Time, *models.MessageMetadata, error) {
+	metadata, err := s.open(ctx, userID, id)
+	if err != nil {
+		return "", time.Time{}, metadata, err
+	}
+
+	token, expiresAt, err := s.storage.Claim(ctx, id, userID, models.ClaimWindow)
+	switch {
+	case errors.Is(err, models.ErrMessageClaimed):
+		return "", time.Time{}, metadata, &Error{Code: models.ErrorCodeMessageClaimed, Message: "Message has already been claimed"}
+	case errors.Is(err, models.ErrMessageNotFound):
+		return "", time.Time{}, metadata, errNotFound
+	case err != nil:
+		return "", time.Time{}, metadata, internal("Failed to claim message")
+	}
+
+	if err := s.metadataRepo.MarkAsClaimed(ctx, id, expiresAt); err != nil {
+		// The claim itself succeeded; status only feeds history and cleanup
+		requestid.Logger(ctx).Warn("failed to mark message as claimed", "error", err)
+	}
+	return token, expiresAt.UTC(), metadata, nil
+}
+
+// Preview describes message id to its recipient userID without burning it.
+// The metadata is returned whenever it was found, also with an error
+func (s *Service) Preview(ctx context.Context, userID int64, id string) (*models.MessagePreviewResponse, *models.MessageMetadata, error) {
+	metadata, err := s.open(ctx, userID, id)
+	if err != nil {
+		return nil, metadata, err
+	}
+
+	// Metadata outlives the Redis payload, so confirm it can still be read
+	// and take the remaining time from Redis, which is what actually expires it
+	ttl, err := s.storage.GetTTL(ctx, id)
+	if errors.Is(err, models.ErrMessageNotFound) {
+		return nil, metadata, errNotFound
+	}
+	if err != nil {
+		return nil, metadata, internal("Failed to check message")
+	}
+
+	preview := &models.MessagePreviewResponse{
+		SenderName:       metadata.SenderName,
+		CreatedAt:        metadata.CreatedAt,
+		ExpiresAt:        metadata.ExpiresAt,
+		ExpiresInSeconds: int64(time.Until(metadata.ExpiresAt).Seconds()),
+		OneTime:          true,
+	}
+	if ttl != storage.NoExpiry {
+		preview.ExpiresAt = time.Now().Add(ttl).UTC()
+		preview.ExpiresInSeconds = int64(ttl.Seconds())
+	}
+	return preview, metadata, nil
+}
+
+// Status returns the metadata of message id to its sender or recipient
+// userID, without touching the message. A pending message past its expiry,
+// or a claimed one whose claim lapsed, is reported expired
+func (s *Service) Status(ctx context.Context, userID int64, id string) (*models.MessageMetadata, error) {
+	metadata, err := s.find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if metadata.SenderID != userID && metadata.RecipientID != userID {
+		return metadata, &Error{Code: models.ErrorCodeForbidden, Message: "Only the sender or recipient can see this message"}
+	}
+	if pastExpiry(metadata, time.Now()) {
+		metadata.Status = models.StatusExpired
+	}
+	return metadata, nil
+}
+
+// Revoke burns message id for its sender userID before it is read. The
+// message is expired and its stored key dropped, so neither the recipient
+// nor a resent notification can open it
+func (s *Service) Revoke(ctx context.Context, userID int64, id string) error {
+	metadata, err := s.find(ctx, id)
+	if err != nil {
+		return err
+	}
+	if metadata.SenderID != userID {
+		return &Error{Code: models.ErrorCodeForbidden, Message: "Only the sender can revoke this message"}
+	}
+	if metadata.Status == models.StatusRead {
+		return errAlreadyRead
+	}
+
+	err = s.metadataRepo.RevokeMessage(ctx, userID, id)
+	if errors.Is(err, models.ErrMessageNotFound) {
+		// Already expired, or read meanwhile
+		return errNotFound
+	}
+	if err != nil {
+		return internal("Failed to revoke message")
+	}
+
+	// Delete takes a claimed payload too; should it fail, the expired
+	// status still keeps the payload from being read until it lapses
+	if _, err := s.storage.Delete(ctx, []string{id}); err != nil {
+		requestid.Logger(ctx).Warn("failed to burn revoked message", "error", err)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package models
+
+import "time"
+
+// AccessAction is the message endpoint an access attempt went through
+type AccessAction string
+
+const (
+	AccessActionRead    AccessAction = "read"    // GET /api/messages/:id and POST /api/messages/:id/read
+	AccessActionPreview AccessAction = "preview" // GET /api/messages/:id/preview
+	AccessActionClaim   AccessAction = "claim"   // POST /api/messages/:id/claim
+	AccessActionStatus  AccessAction = "status"  // HEAD /api/messages/:id and GET /api/messages/:id/status
+)
+
+// AccessOutcome is how an access attempt ended
+type AccessOutcome string
+
+const (
+	AccessRead    AccessOutcome = "read"    // the payload was returned and burned
+	AccessAllowed AccessOutcome = "allowed" // preview, claim or status check succeeded
+	AccessDenied  AccessOutcome = "denied"  // not the recipient, or blocked by a claim
+	AccessGone    AccessOutcome = "gone"    // already read, or no such message
+	AccessExpired AccessOutcome = "expired" // the message expired before this attempt
+	AccessEarly   AccessOutcome = "early"   // the message is scheduled and not released yet
+)
+
+// AccessLogEntry records one attempt to read or inspect a message,
+// including attempts that were refused
+type AccessLogEntry struct {
+	ID        int64         `json:"id"`
+	MessageID string        `json:"message_id"`
+	UserID    int64         `json:"user_id"`
+	UserName  string        `json:"user_name,omitempty"` // populated when listing
+	Action    AccessAction  `json:"action"`
+	Outcome   AccessOutcome `json:"outcome"`
+	IP        string        `json:"ip"`
+	UserAgent string        `json:"user_agent"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// MessageAccessResponse is returned by GET /api/messages/:id/access
+type MessageAccessResponse struct {
+	MessageID string           `json:"message_id"`
+	Entries   []AccessLogEntry `json:"entries"`
+}
+
+// MaxAccessLogEntries caps the entries returned for one message
+const MaxAccessLogEntries = 200
+
+// AbuseAlertEvent names the alert in webhook payloads
+const AbuseAlertEvent = "message.access_abuse"
+
+// AbuseAlert reports a message that received too many denied access
+// attempts. It goes to the sender and the abuse webhook, so it never
+// carries the message link or key
+type AbuseAlert struct {
+	Event         string    `json:"event"`
+	MessageID     string    `json:"message_id"`
+	SenderID      int64     `json:"sender_id"`
+	RecipientID   int64     `json:"recipient_id"`
+	Attempts      int       `json:"attempts"`
+	WindowSeconds int64     `json:"window_seconds"`
+	SourceIPs     []string  `json:"source_ips"`
+	Revoked       bool      `json:"revoked"`
+	DetectedAt    time.Time `json:"detected_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// AdminAction is an admin change to accounts kept in the admin audit log
+type AdminAction string
+
+const (
+	AdminActionMergeUsers AdminAction = "merge_users" // POST /api/admin/users/:id/merge/:duplicateId
+)
+
+// AdminAuditEntry records one admin change to accounts. Unlike the request
+// log line of every admin call, it names the accounts the change touched
+type AdminAuditEntry struct {
+	ID            int64       `json:"id"`
+	ActorID       int64       `json:"actor_id"` // the admin who made the change
+	Action        AdminAction `json:"action"`
+	UserID        int64       `json:"user_id"`         // the account changed; the kept one of a merge
+	RelatedUserID int64       `json:"related_user_id"` // the merged duplicate of a merge
+	CreatedAt     time.Time   `json:"created_at"`
+}
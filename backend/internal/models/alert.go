@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// PanicAlert reports a request handler that panicked. It goes to the alert
+// webhook, so it names the route template rather than the path (which holds
+// message IDs) and never carries the request body or the stack
+type PanicAlert struct {
+	Event      string    `json:"event"` // always "server.panic"
+	Text       string    `json:"text"`  // one-line summary, shown by Slack incoming webhooks
+	RequestID  string    `json:"request_id"`
+	Method     string    `json:"method"`
+	Route      string    `json:"route"`
+	Panic      string    `json:"panic"`      // the recovered value, truncated
+	Suppressed int       `json:"suppressed"` // earlier panics on the route not alerted to stay within the rate limit
+	At         time.Time `json:"at"`
+}
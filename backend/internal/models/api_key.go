@@ -0,0 +1,71 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// APIKeyPrefix starts every API key, so a bearer token can be told apart
+// from a session JWT without parsing it
+const APIKeyPrefix = "vk_"
+
+var (
+	// ErrAPIKeyNotFound is returned for an unknown or revoked API key
+	ErrAPIKeyNotFound = errors.New("api key not found")
+	// ErrNotServiceAccount is returned when API keys are managed for a regular user
+	ErrNotServiceAccount = errors.New("user is not a service account")
+)
+
+// APIKey is a credential of a service account. Only a hash of the key is
+// stored; the plaintext is returned once, when the key is created
+type APIKey struct {
+	ID         int64      `json:"id" db:"id"`
+	UserID     int64      `json:"user_id" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	Prefix     string     `json:"prefix" db:"prefix"` // First characters of the key, to recognise it in listings
+	Hash       string     `json:"-" db:"key_hash"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+}
+
+// CreateAPIKeyResponse carries a new key; Key is never shown again
+type CreateAPIKeyResponse struct {
+	Key    string  `json:"key"`
+	APIKey *APIKey `json:"api_key"`
+}
+
+// GenerateAPIKey returns a new random API key and its hash
+func GenerateAPIKey() (key string, hash string, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	key = APIKeyPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	return key, HashAPIKey(key), nil
+}
+
+// HashAPIKey returns the stored form of an API key. Keys carry 256 bits of
+// entropy, so a plain SHA-256 is enough and allows lookup by hash
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIKey reports whether a bearer token looks like an API key
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// APIKeyDisplayPrefix returns the part of key kept for listings
+func APIKeyDisplayPrefix(key string) string {
+	if len(key) <= len(APIKeyPrefix)+6 {
+		return key
+	}
+	return key[:len(APIKeyPrefix)+6]
+}
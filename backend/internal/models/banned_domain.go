@@ -0,0 +1,98 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ErrBannedDomainNotFound is returned for a domain that is not banned
+var ErrBannedDomainNotFound = errors.New("banned domain not found")
+
+// BannedDomain is an email domain, such as a personal mail provider, that
+// may not receive messages or register accounts. Its subdomains are banned
+// with it
+type BannedDomain struct {
+	Domain    string    `json:"domain"`
+	Reason    string    `json:"reason"` // shown to admins only
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BannedDomainRequest bans a domain; the domain itself is taken from the path
+type BannedDomainRequest struct {
+	Reason string `json:"reason" binding:"max=255"`
+}
+
+// NormalizeDomain returns domain as stored for a ban: lowercase Unicode with
+// no trailing dot. It fails for anything that is not a hostname
+func NormalizeDomain(domain string) (string, error) {
+	domain = strings.TrimSuffix(strings.TrimSpace(domain), ".")
+	ascii, err := idna.Lookup.ToASCII(domain)
+	if err != nil || !strings.Contains(ascii, ".") || len(ascii) > 253 {
+		return "", errors.New("must be a domain such as example.com")
+	}
+	unicode, err := idna.Lookup.ToUnicode(ascii)
+	if err != nil {
+		return "", errors.New("must be a domain such as example.com")
+	}
+	return unicode, nil
+}
+
+// confusables maps characters that render like an ASCII letter or digit
+// to it, after NFKC and lowercasing, so a homograph of a banned domain
+// (Cyrillic "а" for "a", "rn" for "m") is banned too. Like Unicode's
+// confusable skeletons both sides are mapped, so "0" and "o" are the same
+var confusables = map[rune]string{
+	// Cyrillic
+	'а': "a", 'в': "b", 'е': "e", 'һ': "h", 'і': "i", 'ј': "j", 'к': "k", 'ӏ': "l",
+	'м': "rn", 'о': "o", 'р': "p", 'ԛ': "q", 'ѕ': "s", 'т': "t", 'у': "y", 'ԝ': "w",
+	'х': "x", 'ԁ': "d",
+	// Greek
+	'α': "a", 'β': "b", 'ε': "e", 'ι': "i", 'κ': "k", 'ν': "v", 'ο': "o", 'ρ': "p",
+	'τ': "t", 'υ': "u", 'χ': "x",
+	// Latin lookalikes and digits
+	'ɡ': "g", 'ı': "i", 'ł': "l", 'ø': "o", '0': "o", '1': "l", 'm': "rn",
+	// Full stops IDNA treats as dots
+	'。': ".", '｡': ".", '．': ".",
+}
+
+// domainSkeleton reduces domain to the form two lookalike domains share:
+// punycode decoded, NFKC normalized, lowercased and confusables mapped
+func domainSkeleton(domain string) string {
+	domain = strings.TrimSuffix(strings.TrimSpace(domain), ".")
+	if unicode, err := idna.Punycode.ToUnicode(domain); err == nil {
+		domain = unicode
+	}
+	domain = strings.ToLower(norm.NFKC.String(domain))
+
+	var b strings.Builder
+	for _, r := range domain {
+		if mapped, ok := confusables[r]; ok {
+			b.WriteString(mapped)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return strings.TrimSuffix(b.String(), ".")
+}
+
+// MatchBannedDomain returns the entry of banned covering the domain of
+// email, itself or a parent domain, or nil. Domains are compared by
+// skeleton, so punycode, fullwidth and lookalike spellings match
+func MatchBannedDomain(banned []*BannedDomain, email string) *BannedDomain {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return nil
+	}
+	domain := domainSkeleton(email[at+1:])
+	for _, entry := range banned {
+		skeleton := domainSkeleton(entry.Domain)
+		if skeleton != "" && (domain == skeleton || strings.HasSuffix(domain, "."+skeleton)) {
+			return entry
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// ErrCategoryPolicyNotFound is returned for a category without a policy
+var ErrCategoryPolicyNotFound = errors.New("category policy not found")
+
+// MaxCategoryLength bounds message category names
+const MaxCategoryLength = 32
+
+var categoryPattern = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// ValidCategory reports whether name can be a message category: lowercase
+// letters, digits and dashes starting with a letter, at most
+// MaxCategoryLength long
+func ValidCategory(name string) bool {
+	return len(name) <= MaxCategoryLength && categoryPattern.MatchString(name)
+}
+
+// NotificationStyle selects the wording of the notification telling a
+// recipient about a message
+type NotificationStyle string
+
+const (
+	// NotificationStandard is the wording of messages without a policy
+	NotificationStandard NotificationStyle = "standard"
+	// NotificationUrgent asks the recipient to open the message soon
+	NotificationUrgent NotificationStyle = "urgent"
+	// NotificationDigest is a short, low-key summary line
+	NotificationDigest NotificationStyle = "digest"
+)
+
+// NotificationStyles lists the accepted NotificationStyle values
+var NotificationStyles = []NotificationStyle{NotificationStandard, NotificationUrgent, NotificationDigest}
+
+// Valid reports whether s is an accepted NotificationStyle
+func (s NotificationStyle) Valid() bool {
+	for _, known := range NotificationStyles {
+		if s == known {
+			return true
+		}
+	}
+	return false
+}
+
+// CategoryPolicy sets the default and maximum TTL of messages in Category
+// and the wording of their notifications. It applies on top of the TTL
+// policy of the recipient's domain: the shorter maximum wins
+type CategoryPolicy struct {
+	Category string `json:"category"`
+
+	DefaultTTL int64 `json:"default_ttl"` // seconds, used when the sender gives no TTL
+	MaxTTL     int64 `json:"max_ttl"`     // seconds; longer TTLs are cut down to it
+
+	NotificationStyle NotificationStyle `json:"notification_style"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Applied returns the part of the policy reported with a new message
+func (p *CategoryPolicy) Applied() *AppliedCategoryPolicy {
+	return &AppliedCategoryPolicy{
+		Category:          p.Category,
+		DefaultTTL:        p.DefaultTTL,
+		MaxTTL:            p.MaxTTL,
+		NotificationStyle: p.NotificationStyle,
+	}
+}
+
+// AppliedCategoryPolicy is the category policy a new message was created
+// under, as reported by POST /api/messages
+type AppliedCategoryPolicy struct {
+	Category          string            `json:"category"`
+	DefaultTTL        int64             `json:"default_ttl"`
+	MaxTTL            int64             `json:"max_ttl"`
+	NotificationStyle NotificationStyle `json:"notification_style"`
+}
+
+// CategoryPolicyRequest creates or replaces the policy of a category; the
+// category itself is taken from the path
+type CategoryPolicyRequest struct {
+	DefaultTTL        int64             `json:"default_ttl" binding:"required"`
+	MaxTTL            int64             `json:"max_ttl" binding:"required"`
+	NotificationStyle NotificationStyle `json:"notification_style" binding:"required"`
+}
+
+// Validate checks that MinTTL <= DefaultTTL <= MaxTTL <= the global MaxTTL
+// and the notification style, and returns the problem of each invalid field
+func (r *CategoryPolicyRequest) Validate() map[string]string {
+	problems := map[string]string{}
+	if r.MaxTTL < MinTTL || r.MaxTTL > MaxTTL {
+		problems["max_ttl"] = fmt.Sprintf("must be between %d and %d seconds", MinTTL, MaxTTL)
+	}
+	if r.DefaultTTL < MinTTL || r.DefaultTTL > r.MaxTTL {
+		problems["default_ttl"] = fmt.Sprintf("must be between %d seconds and max_ttl", MinTTL)
+	}
+	if !r.NotificationStyle.Valid() {
+		problems["notification_style"] = "must be one of standard, urgent, digest"
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return problems
+}
+
+// AllowsTTL reports whether a message under policy p, which may be nil, can
+// live for ttl seconds
+func (p *CategoryPolicy) AllowsTTL(ttl int64) bool {
+	return p == nil || ttl <= p.MaxTTL
+}
+
+// Style returns the notification style of policy p, standard when p is nil
+func (p *CategoryPolicy) Style() NotificationStyle {
+	if p == nil || p.NotificationStyle == "" {
+		return NotificationStandard
+	}
+	return p.NotificationStyle
+}
+
+// Style returns the notification style of applied policy p, standard when
+// p is nil
+func (p *AppliedCategoryPolicy) Style() NotificationStyle {
+	if p == nil || p.NotificationStyle == "" {
+		return NotificationStandard
+	}
+	return p.NotificationStyle
+}
@@ -0,0 +1,72 @@
+package models
+
+import "time"
+
+// MessageDiagnostics is the admin troubleshooting report for one message
+// It describes where the message is in its lifecycle without exposing the
+// ciphertext or the encryption key
+type MessageDiagnostics struct {
+	MessageID     string        `json:"message_id"`
+	Status        MessageStatus `json:"status"`
+	SenderID      int64         `json:"sender_id"`
+	SenderName    string        `json:"sender_name"`
+	RecipientID   int64         `json:"recipient_id"`
+	RecipientName string        `json:"recipient_name"`
+	CreatedVia    Client        `json:"created_via"`
+	CreatedAt     time.Time     `json:"created_at"`
+	ReadAt        *time.Time    `json:"read_at,omitempty"`
+	ExpiresAt     time.Time     `json:"expires_at"`
+
+	// StoredPayload reports whether the encrypted payload is still in Redis
+	StoredPayload bool `json:"stored_payload"`
+	// StorageTTLSeconds is the TTL Redis reports, omitted when the payload
+	// is gone or never expires
+	StorageTTLSeconds *int64 `json:"storage_ttl_seconds,omitempty"`
+	// MetadataTTLSeconds is the time left until ExpiresAt (negative once past)
+	MetadataTTLSeconds int64 `json:"metadata_ttl_seconds"`
+	// Consistent is false when Redis and the metadata disagree about whether
+	// or until when the message can be read
+	Consistent bool `json:"consistent"`
+
+	// Findings explains the report in plain words for support staff
+	Findings []string `json:"findings"`
+
+	// Access lists the latest attempts to read or inspect the message,
+	// newest first, including refused ones
+	Access []AccessLogEntry `json:"access"`
+}
+
+// OrphanScanReport is the result of scanning Redis for messages without
+// metadata, which nobody can open but which use memory until their TTL
+// Counts are approximate: SCAN may list a message twice, and messages
+// created or read during the scan may or may not be counted
+type OrphanScanReport struct {
+	// Scanned is how many messages Redis holds, claimed ones aside
+	Scanned int64 `json:"scanned"`
+	// Orphans have no metadata and are older than the grace period
+	Orphans int64 `json:"orphans"`
+	// Recent have no metadata yet but are within the grace period, so
+	// they may still be being created
+	Recent int64 `json:"recent"`
+	// Deleted is how many orphans were deleted; 0 unless deleting was asked
+	Deleted int64 `json:"deleted"`
+
+	GracePeriodSeconds int64 `json:"grace_period_seconds"`
+	DurationMs         int64 `json:"duration_ms"`
+}
+
+// CleanupReport is the result of marking expired messages as expired and
+// deleting what Redis still holds of them. Running it again right away
+// reports zeros
+type CleanupReport struct {
+	// ExpiredMetadata is how many messages were marked as expired
+	ExpiredMetadata int64 `json:"expired_metadata"`
+	// RedisDeleted were still in Redis, e.g. because their TTL outlived
+	// the expiry in the metadata
+	RedisDeleted int64 `json:"redis_deleted"`
+	// RedisMissing had already left Redis
+	RedisMissing int64 `json:"redis_missing"`
+	// Errors is how many could not be deleted from Redis; they leave it
+	// when their TTL runs out
+	Errors int64 `json:"errors"`
+}
@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// DigestEvent is a notable event counted for the admin digest
+type DigestEvent string
+
+const (
+	// EventNotificationFailed is a Slack or email notification that could
+	// not be delivered
+	EventNotificationFailed DigestEvent = "notification_failed"
+	// EventAbuseAlert is a message locked out by the abuse detector after
+	// repeated denied access attempts
+	EventAbuseAlert DigestEvent = "abuse_alert"
+)
+
+// Digest summarizes one period for admins. It holds aggregate numbers
+// only: no names, email addresses or message IDs
+type Digest struct {
+	Period string    `json:"period"` // identifies the period: its end in RFC 3339
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+
+	// Statistics is the state at the time the digest was compiled
+	Statistics SystemStatistics `json:"statistics"`
+	// Created and Read count the messages created and read within the period
+	Created int `json:"created"`
+	Read    int `json:"read"`
+
+	NotificationFailures int `json:"notification_failures"`
+	AbuseAlerts          int `json:"abuse_alerts"`
+	// RecipientsNearInboxCap counts users whose unread messages reach
+	// DigestNearCapPercent of MAX_PENDING_PER_RECIPIENT; nil without a cap
+	RecipientsNearInboxCap *int `json:"recipients_near_inbox_cap,omitempty"`
+}
+
+// DigestNearCapPercent is the share of the inbox cap at which a recipient
+// counts as near it
+const DigestNearCapPercent = 80
+
+// DigestSendResponse is returned by POST /api/admin/digest/send
+type DigestSendResponse struct {
+	// Sent is false when the digest of this period was already posted
+	Sent   bool    `json:"sent"`
+	Digest *Digest `json:"digest"`
+}
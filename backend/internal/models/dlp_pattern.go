@@ -0,0 +1,55 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"time"
+)
+
+// ErrDLPPatternNotFound is returned for a DLP pattern that does not exist
+var ErrDLPPatternNotFound = errors.New("DLP pattern not found")
+
+// MaxDLPPatternLength bounds the regular expression of a DLP pattern
+const MaxDLPPatternLength = 1024
+
+// DLPPattern is a regular expression clients match a secret against before
+// encrypting it, warning the sender when it matches, e.g. a string that
+// looks like a credit card number. The server never sees the plaintext, so
+// matching, and whether to send anyway, is left to the client
+type DLPPattern struct {
+	Name        string `json:"name"` // same rules as a category name
+	Pattern     string `json:"pattern"`
+	Description string `json:"description"` // shown to the sender with the warning
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// DLPPatternRequest creates or replaces a DLP pattern; the name is taken
+// from the path
+type DLPPatternRequest struct {
+	Pattern     string `json:"pattern" binding:"required"`
+	Description string `json:"description" binding:"max=255"`
+}
+
+// Validate checks that the pattern compiles and is not too long, and
+// returns the problem of each invalid field. Clients run the pattern with
+// their own engines (RE2 in the CLI, JavaScript in the browser), so it
+// should stick to the syntax the two share
+func (r *DLPPatternRequest) Validate() map[string]string {
+	if len(r.Pattern) > MaxDLPPatternLength {
+		return map[string]string{"pattern": "must be at most 1024 characters"}
+	}
+	if _, err := regexp.Compile(r.Pattern); err != nil {
+		return map[string]string{"pattern": "must be a valid regular expression"}
+	}
+	return nil
+}
+
+// SenderPolicy is what GET /api/policy tells clients to check before
+// sending: recipient domains the server refuses and DLP patterns to warn
+// about
+type SenderPolicy struct {
+	BannedDomains []string      `json:"banned_domains"`
+	DLPPatterns   []*DLPPattern `json:"dlp_patterns"`
+}
@@ -0,0 +1,68 @@
+package models
+
+// Error codes sent in ErrorResponse.Code and BulkMessageResult.Code
+// Clients branch on these rather than on the human-readable message, so a
+// code is never renamed or reused for a different reason once released.
+// The catalogue is mirrored in the ErrorCode enum of the OpenAPI spec
+const (
+	// Request problems (400)
+	ErrorCodeInvalidRequest   = "invalid_request"   // body is not JSON, or a parameter is malformed
+	ErrorCodeValidationFailed = "validation_failed" // fields failed validation; see Details
+	ErrorCodeInvalidMessageID = "invalid_message_id"
+	ErrorCodeTTLOutOfRange    = "ttl_out_of_range"
+	ErrorCodeInvalidSchedule  = "invalid_schedule" // available_at is past, or too far ahead for the TTL
+	ErrorCodeBatchSize        = "batch_size_out_of_range"
+	ErrorCodeInvalidPublicKey = "invalid_public_key"
+	ErrorCodeInvalidCSV       = "invalid_csv"
+	ErrorCodeCannotDeleteSelf = "cannot_delete_self"
+
+	// Authentication and authorization (401, 403)
+	ErrorCodeUnauthorized       = "unauthorized"        // missing, malformed or expired credentials
+	ErrorCodeInvalidCredentials = "invalid_credentials" // wrong email or password at login
+	ErrorCodeIncorrectPassword  = "incorrect_password"  // wrong password confirming an account change
+	ErrorCodeAccountInactive    = "account_inactive"
+	ErrorCodeForbidden          = "forbidden" // signed in but not allowed, e.g. not an admin
+	ErrorCodeCSRFFailed         = "csrf_failed"
+	ErrorCodeDomainBanned       = "domain_banned"               // 403: the email domain is on the admins' deny list
+	ErrorCodePasswordManaged    = "password_managed_externally" // 409: the password lives in the LDAP directory
+
+	// Messages
+	ErrorCodeMessageNotFound    = "message_not_found"    // 404: never existed, expired or already burned
+	ErrorCodeMessageAlreadyRead = "message_already_read" // 410: read and burned
+	ErrorCodeMessageExpired     = "message_expired"      // 410: expired unread
+	ErrorCodeMessageRevoked     = "message_revoked"      // 410: revoked, dismissed or withdrawn before it was read
+	ErrorCodeMessageClaimed     = "message_claimed"      // 409: claimed, fetch with the claim token
+	ErrorCodeNotRecipient       = "not_recipient"        // 403: caller is not the intended recipient
+	ErrorCodeInvalidClaimToken  = "invalid_claim_token"
+	ErrorCodeClaimNotFound      = "claim_not_found"
+	ErrorCodeInvalidReadIntent  = "invalid_read_intent"       // 403: intent token unknown, expired or used; open the link again
+	ErrorCodeInvalidAccessToken = "invalid_access_token"      // 403: an external recipient's link is tampered with or expired
+	ErrorCodeCannotResend       = "cannot_resend"             // 409: no key is stored to rebuild the link from
+	ErrorCodeNotYetAvailable    = "message_not_yet_available" // 425: scheduled; retry at available_at
+
+	// ErrorCodeRecipientInboxFull is returned with 429 when the recipient
+	// already has MAX_PENDING_PER_RECIPIENT unread messages waiting
+	ErrorCodeRecipientInboxFull = "recipient_inbox_full"
+
+	// Users
+	ErrorCodeUserExists   = "user_exists"
+	ErrorCodeUserNotFound = "user_not_found"
+
+	// Service accounts
+	ErrorCodeAPIKeyNotFound = "api_key_not_found" // 404: unknown or already revoked
+
+	// TTL, category and sender policies
+	ErrorCodeTTLPolicyNotFound      = "ttl_policy_not_found"      // 404
+	ErrorCodeCategoryPolicyNotFound = "category_policy_not_found" // 404
+	ErrorCodeBannedDomainNotFound   = "banned_domain_not_found"   // 404
+	ErrorCodeDLPPatternNotFound     = "dlp_pattern_not_found"     // 404
+
+	// Limits, integrations and server faults
+	ErrorCodeQuotaExceeded       = "quota_exceeded"       // 429: try again after Retry-After
+	ErrorCodeRequestTooLarge     = "request_too_large"    // 413: body over the route's limit
+	ErrorCodeIntegrationDisabled = "integration_disabled" // 503: Slack, email or Okta is not enabled
+	ErrorCodeUpstreamFailed      = "upstream_failed"      // Slack, email, Okta or the LDAP directory rejected or failed the call
+	ErrorCodeUnavailable         = "service_unavailable"  // 503: message storage unreachable
+	ErrorCodeReloadFailed        = "reload_failed"        // 500: new configuration invalid; the old one stays in effect
+	ErrorCodeInternal            = "internal_error"
+)
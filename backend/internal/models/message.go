@@ -10,48 +10,216 @@ var (
 	ErrMessageNotFound = errors.New("message not found or already burned")
 	// ErrInvalidTTL is returned when TTL is out of acceptable range
 	ErrInvalidTTL = errors.New("TTL must be between 1 hour and 7 days")
+	// ErrAvailableAtPast is returned when a scheduled message's release time has already passed
+	ErrAvailableAtPast = errors.New("available_at must be in the future")
+	// ErrScheduleTooFar is returned when a scheduled message would outlive MaxTTL from now
+	ErrScheduleTooFar = errors.New("available_at plus TTL must be within 7 days from now")
 	// ErrInvalidInput is returned for validation failures
 	ErrInvalidInput = errors.New("invalid input data")
+	// ErrMessageClaimed is returned when another user holds the claim on a message
+	ErrMessageClaimed = errors.New("message already claimed")
+	// ErrClaimNotFound is returned when a claim does not exist or its window has passed
+	ErrClaimNotFound = errors.New("claim not found or expired")
+	// ErrInvalidClaim is returned when a claim token or user does not match the claim
+	ErrInvalidClaim = errors.New("invalid claim token")
+	// ErrDuplicateMessageID is returned when metadata already exists for a message ID
+	ErrDuplicateMessageID = errors.New("message ID already in use")
 )
 
+// ContentEncodingGzip marks a message whose plaintext was gzipped before
+// it was encrypted; readers decompress after decrypting
+const ContentEncodingGzip = "gzip"
+
 // Message represents the encrypted message stored in Redis
 type Message struct {
-	Ciphertext string    `json:"ciphertext"`
-	IV         string    `json:"iv"`
-	CreatedAt  time.Time `json:"created_at"`
+	Ciphertext      string `json:"ciphertext"`
+	IV              string `json:"iv"`
+	ContentEncoding string `json:"content_encoding,omitempty"` // empty or ContentEncodingGzip
+
+	// Region is the recipient's data residency region, choosing the Redis
+	// cluster the message is stored in; it is not part of the stored value
+	Region string `json:"-"`
+
+	// CreatedAt stays last: storage reads it from the end of the stored value
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // CreateMessageRequest represents the request body for creating a message
 type CreateMessageRequest struct {
 	Ciphertext    string `json:"ciphertext" binding:"required,base64"`
 	IV            string `json:"iv" binding:"required,base64"`
-	TTL           *int64 `json:"ttl,omitempty"`                       // in seconds, optional
-	RecipientID   int64  `json:"recipient_id" binding:"required"`     // Who can read this message
-	EncryptionKey string `json:"encryption_key" binding:"required"`   // Client-side encryption key for recipient access
+	TTL           *int64 `json:"ttl,omitempty"`                                                                                       // in seconds, optional
+	RecipientID   int64  `json:"recipient_id" binding:"required_without=ExternalRecipientEmail,excluded_with=ExternalRecipientEmail"` // Who can read this message
+	EncryptionKey string `json:"encryption_key,omitempty" binding:"required_without=SealedKey,excluded_with=SealedKey"`               // Client-side encryption key for recipient access
+	SealedKey     string `json:"sealed_key,omitempty" binding:"omitempty,excluded_with=ExternalRecipientEmail,base64url"`             // The key sealed to the recipient's public key, stored instead of EncryptionKey
+
+	// ContentEncoding is "gzip" when the client compressed the plaintext
+	// before encrypting it; the server only records it
+	ContentEncoding string `json:"content_encoding,omitempty" binding:"omitempty,oneof=gzip"`
+
+	// AvailableAt schedules the message: it cannot be read before this time
+	// and its TTL counts from it. See ValidateSchedule
+	AvailableAt *time.Time `json:"available_at,omitempty"`
+
+	// Category files the message under a category whose policy, if any,
+	// sets its default and maximum TTL and its notification wording
+	Category string `json:"category,omitempty" binding:"category"`
+
+	// ExternalRecipientEmail addresses the message to someone without an
+	// account instead of RecipientID. They read it with a signed link, see
+	// CreateMessageResponse.AccessToken
+	ExternalRecipientEmail string `json:"external_recipient_email,omitempty" binding:"omitempty,email,max=255"`
 }
 
 // CreateMessageResponse represents the response after creating a message
 type CreateMessageResponse struct {
-	ID        string    `json:"id"`
-	ExpiresAt time.Time `json:"expires_at"`
+	ID          string     `json:"id"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	AvailableAt *time.Time `json:"available_at,omitempty"` // Set for scheduled messages
+	DryRun      bool       `json:"dry_run,omitempty"`      // Set when nothing was stored; ID is synthetic
+
+	// TTLLimitedByPolicy is set when the TTL policy of the recipient's
+	// domain shortened the requested TTL; ExpiresAt reflects the shorter one
+	TTLLimitedByPolicy bool `json:"ttl_limited_by_policy,omitempty"`
+
+	// Category echoes the requested category; CategoryPolicy is the policy
+	// applied to it, omitted when the category has none
+	Category       string                 `json:"category,omitempty"`
+	CategoryPolicy *AppliedCategoryPolicy `json:"category_policy,omitempty"`
+
+	// AccessToken is set for a message to an external recipient. It goes in
+	// the path of their link, {base}/m/{id}/{token}#{key}, and lets GET
+	// /api/messages/:id burn the message without signing in
+	AccessToken string `json:"access_token,omitempty"`
+}
+
+// MaxBulkMessages is the largest batch accepted by POST /api/messages/bulk
+const MaxBulkMessages = 50
+
+// BulkCreateMessageRequest creates several messages in one call
+type BulkCreateMessageRequest struct {
+	Messages []CreateMessageRequest `json:"messages" binding:"required"`
+}
+
+// BulkMessageResult is the outcome of one item in a bulk create
+// Status is the HTTP status the item would have received on its own
+type BulkMessageResult struct {
+	Index              int               `json:"index"`
+	Status             int               `json:"status"`
+	ID                 string            `json:"id,omitempty"`
+	ExpiresAt          *time.Time        `json:"expires_at,omitempty"`
+	TTLLimitedByPolicy bool              `json:"ttl_limited_by_policy,omitempty"`
+	Error              string            `json:"error,omitempty"`
+	Code               string            `json:"code,omitempty"`
+	Details            map[string]string `json:"details,omitempty"`
+}
+
+// BulkCreateMessageResponse is the 207 Multi-Status envelope for a bulk create
+// Items succeed or fail independently; successes are never rolled back
+type BulkCreateMessageResponse struct {
+	Results   []BulkMessageResult `json:"results"`
+	Succeeded int                 `json:"succeeded"`
+	Failed    int                 `json:"failed"`
+	DryRun    bool                `json:"dry_run,omitempty"` // Nothing was stored; successes carry status 200 and synthetic IDs
 }
 
 // MessageResponse represents the response when retrieving a message
 type MessageResponse struct {
-	Ciphertext string `json:"ciphertext"`
-	IV         string `json:"iv"`
+	Ciphertext      string `json:"ciphertext"`
+	IV              string `json:"iv"`
+	ContentEncoding string `json:"content_encoding,omitempty"` // Decompress the plaintext after decrypting when "gzip"
+}
+
+// MessagePreviewResponse describes a message without revealing or burning it
+// It never carries ciphertext, IV or key
+type MessagePreviewResponse struct {
+	SenderName         string    `json:"sender_name"`
+	CreatedAt          time.Time `json:"created_at"`
+	ExpiresAt          time.Time `json:"expires_at"`
+	ExpiresInSeconds   int64     `json:"expires_in_seconds"`  // Remaining TTL in Redis, independent of clock skew
+	OneTime            bool      `json:"one_time"`            // Reading burns the message
+	PassphraseRequired bool      `json:"passphrase_required"` // Whether a passphrase is needed besides the link key
+}
+
+// MessageStatusResponse is the status of a message as seen by its sender or
+// recipient, returned by GET /api/messages/:id/status. Reading it never
+// touches the message
+type MessageStatusResponse struct {
+	ID          string        `json:"id"`
+	Status      MessageStatus `json:"status"` // Expired when past its expiry, revoked when discarded before it
+	SenderID    int64         `json:"sender_id"`
+	RecipientID int64         `json:"recipient_id"`
+	CreatedAt   time.Time     `json:"created_at"`
+	ExpiresAt   time.Time     `json:"expires_at"`
+	ReadAt      *time.Time    `json:"read_at,omitempty"`      // Set once read
+	AvailableAt *time.Time    `json:"available_at,omitempty"` // Set for scheduled messages
+
+	// ExternalRecipientEmail is set, and RecipientID 0, for a message to a
+	// recipient without an account
+	ExternalRecipientEmail string `json:"external_recipient_email,omitempty"`
+}
+
+// ClaimMessageResponse is returned by POST /api/messages/:id/claim
+// The token fetches the ciphertext via GET /api/messages/:id?claim=<token>
+type ClaimMessageResponse struct {
+	ClaimToken string    `json:"claim_token"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// LinkPreviewResponse is returned by GET /m-preview/:id, the public
+// interstitial a share link opens first. It never burns the message; the
+// intent token lets the recipient burn it with POST /api/messages/:id/read
+// until IntentExpiresAt, once
+type LinkPreviewResponse struct {
+	ID              string    `json:"id"`
+	IntentToken     string    `json:"intent_token"`
+	IntentExpiresAt time.Time `json:"intent_expires_at"`
+}
+
+// ReadMessageRequest burns a message with an intent token from its link
+// preview
+type ReadMessageRequest struct {
+	IntentToken string `json:"intent_token" binding:"required"`
+}
+
+// NotYetAvailableResponse is the 425 Too Early body for a scheduled message
+// opened before its release time
+type NotYetAvailableResponse struct {
+	ErrorResponse
+	AvailableAt time.Time `json:"available_at"`
+}
+
+// MessageGoneResponse is the 410 Gone body for a message its recipient can
+// no longer read: read carries read_at, expired expires_at, and revoked
+// neither
+type MessageGoneResponse struct {
+	ErrorResponse
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
 }
 
 // ErrorResponse represents an error response
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error     string `json:"error"`
+	Code      string `json:"code"`                 // Stable machine-readable reason, one of the ErrorCode* values
+	RequestID string `json:"request_id,omitempty"` // Correlation ID to quote when reporting problems
+
+	// Details maps each invalid request field to a readable message
+	Details map[string]string `json:"details,omitempty"`
 }
 
+// ClaimWindow is how long a claimed message waits to be fetched
+const ClaimWindow = 60 * time.Second
+
+// ReadIntentWindow is how long the intent token of a link preview can burn
+// the message
+const ReadIntentWindow = 2 * time.Minute
+
 // Constants for TTL limits
 const (
-	MinTTL     = 3600       // 1 hour in seconds
-	MaxTTL     = 604800     // 7 days in seconds
-	DefaultTTL = 86400      // 24 hours in seconds
+	MinTTL     = 3600   // 1 hour in seconds
+	MaxTTL     = 604800 // 7 days in seconds
+	DefaultTTL = 86400  // 24 hours in seconds
 )
 
 // ValidateTTL validates and returns the TTL to use
@@ -66,3 +234,19 @@ func ValidateTTL(ttl *int64) (int64, error) {
 
 	return *ttl, nil
 }
+
+// ValidateSchedule checks the release time of a scheduled message: it must
+// lie in the future, and the message must expire within MaxTTL of now.
+// A nil availableAt sends the message immediately
+func ValidateSchedule(availableAt *time.Time, ttlSeconds int64, now time.Time) error {
+	if availableAt == nil {
+		return nil
+	}
+	if !availableAt.After(now) {
+		return ErrAvailableAtPast
+	}
+	if availableAt.Add(time.Duration(ttlSeconds)*time.Second).Sub(now) > MaxTTL*time.Second {
+		return ErrScheduleTooFar
+	}
+	return nil
+}
@@ -7,10 +7,69 @@ type MessageStatus string
 
 const (
 	StatusPending MessageStatus = "pending" // Created but not yet read
+	StatusClaimed MessageStatus = "claimed" // Claimed by the recipient, awaiting fetch
 	StatusRead    MessageStatus = "read"    // Message has been read and burned
 	StatusExpired MessageStatus = "expired" // Message expired before being read
 )
 
+// StatusRevoked is reported, never stored, for an expired message that was
+// discarded before its expiry: revoked by the sender, dismissed by the
+// recipient or withdrawn with a deactivated account
+const StatusRevoked MessageStatus = "revoked"
+
+// SenderType tells whether a person or an integration created a message
+type SenderType string
+
+const (
+	SenderTypeUser        SenderType = "user"        // Sent by a person through the UI, CLI or API
+	SenderTypeIntegration SenderType = "integration" // Created by an integration or a service account
+)
+
+// IntegrationSlack names messages created through the Slack app
+const IntegrationSlack = "slack"
+
+// Client is the kind of client that created a message, as declared by the
+// X-Vanish-Client header. Clients can claim any kind; only the values
+// below are accepted, so the audit trail never holds arbitrary text
+type Client string
+
+const (
+	ClientAPI   Client = "api"   // No header: scripts and direct API calls
+	ClientCLI   Client = "cli"   // The vanish command-line tool
+	ClientWeb   Client = "web"   // The web UI
+	ClientSlack Client = "slack" // The Slack app, set by the server
+	ClientMCP   Client = "mcp"   // The MCP server, on behalf of an agent
+)
+
+// Clients lists the accepted Client values
+var Clients = []Client{ClientAPI, ClientCLI, ClientWeb, ClientSlack, ClientMCP}
+
+// Valid reports whether c is an accepted Client
+func (c Client) Valid() bool {
+	for _, known := range Clients {
+		if c == known {
+			return true
+		}
+	}
+	return false
+}
+
+// SenderLabel describes who sent a message for history and notifications,
+// e.g. "Alice via Slack integration"
+func SenderLabel(senderName string, senderType SenderType, integrationName string) string {
+	if senderType != SenderTypeIntegration || integrationName == "" {
+		return senderName
+	}
+	label := integrationName
+	if integrationName == IntegrationSlack {
+		label = "Slack"
+	}
+	if senderName == "" || senderName == integrationName {
+		return label + " integration"
+	}
+	return senderName + " via " + label + " integration"
+}
+
 // MessageMetadata stores audit information about messages
 // CRITICAL: This stores WHO sent to WHOM, but NEVER the actual content
 // Content remains ephemeral and zero-knowledge in Redis
@@ -21,16 +80,50 @@ type MessageMetadata struct {
 	SenderID      int64         `json:"sender_id" db:"sender_id"`         // Who sent it
 	RecipientID   int64         `json:"recipient_id" db:"recipient_id"`   // Who should receive it
 	EncryptionKey string        `json:"-" db:"encryption_key"`            // Client-side encryption key (not exposed in API)
+	SealedKey     string        `json:"-" db:"sealed_key"`                // Key sealed to the recipient's public key, stored instead of EncryptionKey
 	Status        MessageStatus `json:"status" db:"status"`               // Current status
 	CreatedAt     time.Time     `json:"created_at" db:"created_at"`       // When created
 	ReadAt        *time.Time    `json:"read_at,omitempty" db:"read_at"`   // When read (if applicable)
 	ExpiresAt     time.Time     `json:"expires_at" db:"expires_at"`       // When it expires
 	SenderName    string        `json:"sender_name,omitempty" db:"-"`     // Populated via join
 	RecipientName string        `json:"recipient_name,omitempty" db:"-"`  // Populated via join
+
+	// SenderType is SenderTypeIntegration when an integration created the
+	// message, either on behalf of SenderID (Slack) or as a service account
+	SenderType      SenderType `json:"sender_type" db:"sender_type"`
+	IntegrationName string     `json:"integration_name,omitempty" db:"integration_name"` // e.g. "slack"; empty for users
+	CreatedVia      Client     `json:"created_via" db:"created_via"`                     // Client that created the message
+
+	// AvailableAt is when a scheduled message is released to the recipient;
+	// nil for messages readable at once
+	AvailableAt *time.Time `json:"available_at,omitempty" db:"available_at"`
+
+	// Category is the category the sender filed the message under; empty
+	// for none
+	Category string `json:"category,omitempty" db:"category"`
+
+	// ExternalRecipientEmail is the address of a recipient without an
+	// account, who reads the message with a signed link; RecipientID is 0
+	// for such messages. It is kept for the audit trail
+	ExternalRecipientEmail string `json:"external_recipient_email,omitempty" db:"external_recipient_email"`
+
+	// TTLLimitedByPolicy is set on creation when a TTL policy rule or the
+	// category policy cut the requested TTL down to its maximum; it is not
+	// stored
+	TTLLimitedByPolicy bool `json:"-" db:"-"`
+	// CategoryPolicy is set on creation to the category policy applied to
+	// the message; it is not stored
+	CategoryPolicy *AppliedCategoryPolicy `json:"-" db:"-"`
+}
+
+// Scheduled reports whether the message is still held back at now
+func (m *MessageMetadata) Scheduled(now time.Time) bool {
+	return m.AvailableAt != nil && now.Before(*m.AvailableAt)
 }
 
 // MessageHistoryResponse represents a message in the user's history
 type MessageHistoryResponse struct {
+	ID            int64         `json:"-"` // Row ID, for the history cursor
 	MessageID     string        `json:"message_id"`
 	SenderName    string        `json:"sender_name"`
 	RecipientName string        `json:"recipient_name"`
@@ -41,4 +134,96 @@ type MessageHistoryResponse struct {
 	IsSender      bool          `json:"is_sender"`        // True if current user is sender
 	IsRecipient   bool          `json:"is_recipient"`     // True if current user is recipient
 	EncryptionKey string        `json:"encryption_key,omitempty"` // Only included for recipients with pending messages
+	SealedKey     string        `json:"sealed_key,omitempty"`     // Key sealed to the recipient's public key; only their client can open it
+	KeyRetained   bool          `json:"key_retained"`             // False when the key was discarded (e.g. Slack with SLACK_STORE_KEY=false)
+
+	// IsCounterpartDeleted is true when the other party's account was
+	// deleted; their name reads DeletedUserName and no key is returned
+	IsCounterpartDeleted bool `json:"is_counterpart_deleted"`
+
+	SenderType      SenderType `json:"sender_type"`
+	IntegrationName string     `json:"integration_name,omitempty"`
+	SenderLabel     string     `json:"sender_label"`           // SenderName, plus "via … integration" for integration messages
+	CreatedVia      Client     `json:"created_via"`            // Client that created the message
+	AvailableAt     *time.Time `json:"available_at,omitempty"` // Release time of a scheduled message
+	Category        string     `json:"category,omitempty"`     // Category the sender filed the message under
+}
+
+// MarkDeletedParties records which of the sender and recipient accounts
+// was deleted, whether anonymized or purged: their name becomes
+// DeletedUserName, and when one of them is the viewer's counterpart the
+// key is withheld, since nobody can answer for the message any more
+func (h *MessageHistoryResponse) MarkDeletedParties(senderDeleted, recipientDeleted bool) {
+	if senderDeleted {
+		h.SenderName = DeletedUserName
+	}
+	if recipientDeleted {
+		h.RecipientName = DeletedUserName
+	}
+
+	switch {
+	case h.IsSender && !h.IsRecipient:
+		h.IsCounterpartDeleted = recipientDeleted
+	case h.IsRecipient && !h.IsSender:
+		h.IsCounterpartDeleted = senderDeleted
+	}
+	if h.IsCounterpartDeleted {
+		h.EncryptionKey = ""
+		h.SealedKey = ""
+	}
+}
+
+// InboxMessage is a pending message in the recipient's inbox
+type InboxMessage struct {
+	MessageID        string     `json:"message_id"`
+	SenderName       string     `json:"sender_name"`
+	SenderLabel      string     `json:"sender_label"` // SenderName, plus "via … integration" for integration messages
+	SenderType       SenderType `json:"sender_type"`
+	IntegrationName  string     `json:"integration_name,omitempty"`
+	CreatedVia       Client     `json:"created_via"` // Client that created the message
+	CreatedAt        time.Time  `json:"created_at"`
+	ExpiresAt        time.Time  `json:"expires_at"`
+	ExpiresInSeconds int64      `json:"expires_in_seconds"`
+	URL              string     `json:"url,omitempty"`        // Full link including the key; only when the server stores the key
+	SealedKey        string     `json:"sealed_key,omitempty"` // Key sealed to the recipient's public key; only their client can open it
+}
+
+// ExpirePendingRequest lists pending messages the recipient wants to discard
+// (at most 500 per request)
+type ExpirePendingRequest struct {
+	MessageIDs []string `json:"message_ids" binding:"required,min=1,max=500,dive,required"`
+}
+
+// ExpirePendingResponse reports which of the requested messages were expired
+// IDs the caller did not receive, or that were no longer pending, are skipped
+type ExpirePendingResponse struct {
+	Expired []string `json:"expired"`
+	Count   int      `json:"count"`
+}
+
+// Channels a notification can be sent over
+const (
+	NotificationChannelSlack = "slack"
+	NotificationChannelEmail = "email"
+)
+
+// ScheduledNotification is a notification deferred until its message is
+// released. The link is rebuilt when it is sent, so no key is kept here
+type ScheduledNotification struct {
+	ID          int64     `json:"id"`
+	MessageID   string    `json:"message_id"`
+	Channel     string    `json:"channel"`      // NotificationChannelSlack or NotificationChannelEmail
+	SenderLabel string    `json:"sender_label"` // as shown to the recipient, captured when scheduled
+	SendAt      time.Time `json:"send_at"`
+}
+
+// ScheduledNotificationResponse is returned with 202 when a notification
+// waits for its message's release
+type ScheduledNotificationResponse struct {
+	ScheduledFor time.Time `json:"scheduled_for"`
+}
+
+// ResendNotificationResponse reports how the recipient was notified again
+type ResendNotificationResponse struct {
+	Channel string `json:"channel"` // NotificationChannelSlack or NotificationChannelEmail
 }
@@ -0,0 +1,69 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned for a pagination cursor this server did not issue
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is a position in a listing ordered by a timestamp and then by row
+// ID: the history by created_at, the inbox by expires_at. A page after a
+// cursor starts right behind that row, so rows inserted between requests
+// can neither repeat nor shift later pages
+type Cursor struct {
+	Time time.Time
+	ID   int64
+}
+
+// Encode returns the opaque form handed to clients as next_cursor
+func (c Cursor) Encode() string {
+	raw := c.Time.UTC().Format(time.RFC3339Nano) + "," + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a cursor made by Encode
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	at, id, ok := strings.Cut(string(raw), ",")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, at)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || n <= 0 {
+		return nil, ErrInvalidCursor
+	}
+	return &Cursor{Time: t, ID: n}, nil
+}
+
+// Page selects part of a listing: Limit rows after the After cursor, or,
+// without a cursor, after skipping Offset rows. Offsets are kept for short
+// listings; they get slow and repeat rows as the listing grows
+type Page struct {
+	Limit  int
+	Offset int
+	After  *Cursor
+}
+
+// HistoryPage is GET /api/history when paged by cursor
+type HistoryPage struct {
+	Messages   []*MessageHistoryResponse `json:"messages"`
+	NextCursor string                    `json:"next_cursor,omitempty"` // Empty on the last page
+}
+
+// InboxPage is GET /api/inbox when paged by cursor
+type InboxPage struct {
+	Messages   []InboxMessage `json:"messages"`
+	NextCursor string         `json:"next_cursor,omitempty"` // Empty on the last page
+}
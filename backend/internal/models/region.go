@@ -0,0 +1,21 @@
+package models
+
+import "regexp"
+
+// DefaultRegion names, in statistics, the messages kept in the default
+// Redis cluster: those to recipients without a region. It cannot be the
+// name of a region itself
+const DefaultRegion = "default"
+
+// MaxRegionLength bounds region names, which prefix the IDs of the
+// messages stored in the region
+const MaxRegionLength = 16
+
+var regionPattern = regexp.MustCompile(`^[a-z][a-z0-9]*$`)
+
+// ValidRegion reports whether name can be a data residency region: lowercase
+// letters and digits starting with a letter, at most MaxRegionLength long,
+// and not DefaultRegion
+func ValidRegion(name string) bool {
+	return len(name) <= MaxRegionLength && regionPattern.MatchString(name) && name != DefaultRegion
+}
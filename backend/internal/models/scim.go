@@ -0,0 +1,83 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// SCIM 2.0 schema URNs (RFC 7643, RFC 7644)
+const (
+	SCIMUserSchema         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIMListResponseSchema = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIMPatchOpSchema      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SCIMErrorSchema        = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// SCIMContentType is the media type of SCIM requests and responses
+const SCIMContentType = "application/scim+json"
+
+// SCIMUser is the SCIM User resource. userName is the account email and
+// name.formatted its name; other attributes an identity provider sends,
+// such as externalId or a password, are accepted and ignored
+type SCIMUser struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	UserName    string      `json:"userName"`
+	Name        *SCIMName   `json:"name,omitempty"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Emails      []SCIMEmail `json:"emails,omitempty"`
+	Active      *bool       `json:"active,omitempty"` // omitted in a request means active
+	Meta        *SCIMMeta   `json:"meta,omitempty"`
+}
+
+// SCIMName is the name attribute of a SCIM user
+type SCIMName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+// SCIMEmail is one entry of a SCIM user's emails
+type SCIMEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// SCIMMeta holds the resource metadata of a SCIM user
+type SCIMMeta struct {
+	ResourceType string    `json:"resourceType"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// SCIMListResponse is a page of SCIM users
+type SCIMListResponse struct {
+	Schemas      []string   `json:"schemas"`
+	TotalResults int        `json:"totalResults"`
+	StartIndex   int        `json:"startIndex"`
+	ItemsPerPage int        `json:"itemsPerPage"`
+	Resources    []SCIMUser `json:"Resources"`
+}
+
+// SCIMPatchRequest is a SCIM PatchOp request
+type SCIMPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []SCIMPatchOperation `json:"Operations" binding:"required,min=1"`
+}
+
+// SCIMPatchOperation is one operation of a PatchOp. Without a path, value
+// is an object of attributes to set
+type SCIMPatchOperation struct {
+	Op    string          `json:"op" binding:"required"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// SCIMError is the body of a failed SCIM request
+type SCIMError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrSlackNotInstalled is returned for a workspace the Slack app was not
+// installed into
+var ErrSlackNotInstalled = errors.New("slack app not installed in workspace")
+
+// SlackInstallation is the Slack app installed into one workspace through
+// the OAuth flow. BotToken is stored encrypted when column encryption is
+// configured
+type SlackInstallation struct {
+	TeamID      string    `json:"team_id" db:"team_id"`
+	TeamName    string    `json:"team_name" db:"team_name"`
+	BotUserID   string    `json:"bot_user_id" db:"bot_user_id"`
+	BotToken    string    `json:"-" db:"bot_token"`
+	Scope       string    `json:"scope" db:"scope"`
+	InstalledBy string    `json:"installed_by" db:"installed_by"` // Slack user ID of whoever approved the install
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// SlackInstallResponse reports a completed installation
+type SlackInstallResponse struct {
+	TeamID   string `json:"team_id"`
+	TeamName string `json:"team_name"`
+}
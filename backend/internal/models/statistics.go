@@ -0,0 +1,110 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrInvalidStatisticsQuery is returned for an unknown metric or interval
+var ErrInvalidStatisticsQuery = errors.New("invalid statistics query")
+
+// StatisticsMetric selects which message event a time series counts
+type StatisticsMetric string
+
+const (
+	MetricCreated StatisticsMetric = "created" // bucketed by created_at
+	MetricRead    StatisticsMetric = "read"    // bucketed by read_at
+	MetricExpired StatisticsMetric = "expired" // bucketed by expires_at, expired messages only
+)
+
+// Valid reports whether m is a known metric
+func (m StatisticsMetric) Valid() bool {
+	return m == MetricCreated || m == MetricRead || m == MetricExpired
+}
+
+// StatisticsInterval is the bucket width of a time series
+// Buckets are always aligned in UTC; weeks start on Monday like
+// PostgreSQL's date_trunc('week', ...)
+type StatisticsInterval string
+
+const (
+	IntervalDay  StatisticsInterval = "day"
+	IntervalWeek StatisticsInterval = "week"
+)
+
+// Valid reports whether i is a known interval
+func (i StatisticsInterval) Valid() bool {
+	return i == IntervalDay || i == IntervalWeek
+}
+
+// Truncate returns the start of the UTC bucket containing t
+func (i StatisticsInterval) Truncate(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if i == IntervalWeek {
+		// Monday is day 0 of the week
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	}
+	return day
+}
+
+// Next returns the start of the bucket after the one starting at t
+func (i StatisticsInterval) Next(t time.Time) time.Time {
+	if i == IntervalWeek {
+		return t.AddDate(0, 0, 7)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+// TimeSeriesPoint is the number of events in one bucket
+type TimeSeriesPoint struct {
+	Bucket time.Time `json:"bucket"`
+	Count  int64     `json:"count"`
+}
+
+// LeaderboardEntry is a user's message count within a time range
+type LeaderboardEntry struct {
+	UserID int64  `json:"user_id"`
+	Name   string `json:"name"`
+	Count  int64  `json:"count"`
+}
+
+// TimeSeriesResponse is returned by the admin time-series statistics endpoint
+// Points holds every bucket in [From, To), including empty ones, so it can
+// be charted directly. Leaderboards are omitted when disabled by configuration
+type TimeSeriesResponse struct {
+	Metric              StatisticsMetric   `json:"metric"`
+	Interval            StatisticsInterval `json:"interval"`
+	From                time.Time          `json:"from"`
+	To                  time.Time          `json:"to"`
+	Points              []TimeSeriesPoint  `json:"points"`
+	LeaderboardsEnabled bool               `json:"leaderboards_enabled"`
+	TopSenders          []LeaderboardEntry `json:"top_senders,omitempty"`
+	TopRecipients       []LeaderboardEntry `json:"top_recipients,omitempty"`
+}
+
+// SystemStatistics is returned by the admin statistics endpoint
+type SystemStatistics struct {
+	Users    UserStatistics    `json:"users"`
+	Messages MessageStatistics `json:"messages"`
+}
+
+// UserStatistics counts the active accounts
+type UserStatistics struct {
+	Total   int `json:"total"`
+	Admins  int `json:"admins"`
+	Regular int `json:"regular"`
+}
+
+// MessageStatistics counts messages by status, by the client that
+// created them and by the data residency region they are stored in.
+// ByClient lists every known client and ByRegion DefaultRegion and every
+// configured region, with 0 when unused
+type MessageStatistics struct {
+	Total    int            `json:"total"`
+	Pending  int            `json:"pending"`
+	Read     int            `json:"read"`
+	Expired  int            `json:"expired"`
+	ByClient map[Client]int `json:"by_client"`
+	ByRegion map[string]int `json:"by_region"`
+}
@@ -0,0 +1,120 @@
+package models
+
+import "time"
+
+// HealthSample is one round of internal health checks taken by the status
+// sampler. Samples are kept in Redis so every instance reports the same
+// history; only their coarse summary, ServiceStatus, is ever published
+type HealthSample struct {
+	At       time.Time `json:"at"`
+	Redis    bool      `json:"redis"`
+	Postgres bool      `json:"postgres"`
+	// QueueDepth is how many scheduled notifications are due but not yet
+	// sent, -1 when Postgres could not be asked
+	QueueDepth int `json:"queue_depth"`
+}
+
+// ComponentStatus is the coarse state of one part of the service
+type ComponentStatus string
+
+const (
+	ComponentOK       ComponentStatus = "ok"
+	ComponentDegraded ComponentStatus = "degraded"
+	// ComponentUnknown means no check covered the component recently
+	ComponentUnknown ComponentStatus = "unknown"
+)
+
+// QueueLevel buckets the notification queue depth so the public status
+// never reveals how many messages are being sent
+type QueueLevel string
+
+const (
+	QueueEmpty      QueueLevel = "empty"
+	QueueNormal     QueueLevel = "normal"
+	QueueElevated   QueueLevel = "elevated"
+	QueueBacklogged QueueLevel = "backlogged"
+	QueueUnknown    QueueLevel = "unknown"
+)
+
+// Queue depth bounds of each QueueLevel
+const (
+	queueNormalMax   = 50
+	queueElevatedMax = 500
+)
+
+// QueueLevelOf buckets a notification queue depth; a negative depth is
+// unknown
+func QueueLevelOf(depth int) QueueLevel {
+	switch {
+	case depth < 0:
+		return QueueUnknown
+	case depth == 0:
+		return QueueEmpty
+	case depth < queueNormalMax:
+		return QueueNormal
+	case depth < queueElevatedMax:
+		return QueueElevated
+	default:
+		return QueueBacklogged
+	}
+}
+
+// Overall service states reported by ServiceStatus
+const (
+	ServiceOperational = "operational"
+	ServiceDegraded    = "degraded"
+	ServiceUnknown     = "unknown"
+)
+
+// ServiceStatus is the public, coarse availability of the service over the
+// last WindowMinutes, answered by GET /api/status without authentication
+type ServiceStatus struct {
+	// Status is operational, degraded or unknown
+	Status        string `json:"status"`
+	WindowMinutes int    `json:"window_minutes"`
+	// CheckedAt is when the latest check ran, omitted when none did
+	CheckedAt *time.Time `json:"checked_at,omitempty"`
+
+	Redis             ComponentStatus `json:"redis"`
+	Postgres          ComponentStatus `json:"postgres"`
+	NotificationQueue QueueLevel      `json:"notification_queue"`
+}
+
+// SummarizeHealth reduces samples to the public status: a component is
+// degraded when any check of it failed within the window and the queue
+// level is that of the latest sample. With no samples everything is unknown
+func SummarizeHealth(samples []HealthSample, window time.Duration) ServiceStatus {
+	status := ServiceStatus{
+		Status:            ServiceUnknown,
+		WindowMinutes:     int(window / time.Minute),
+		Redis:             ComponentUnknown,
+		Postgres:          ComponentUnknown,
+		NotificationQueue: QueueUnknown,
+	}
+	if len(samples) == 0 {
+		return status
+	}
+
+	latest := samples[0]
+	status.Redis, status.Postgres = ComponentOK, ComponentOK
+	for _, sample := range samples {
+		if !sample.Redis {
+			status.Redis = ComponentDegraded
+		}
+		if !sample.Postgres {
+			status.Postgres = ComponentDegraded
+		}
+		if sample.At.After(latest.At) {
+			latest = sample
+		}
+	}
+	at := latest.At.UTC()
+	status.CheckedAt = &at
+	status.NotificationQueue = QueueLevelOf(latest.QueueDepth)
+
+	status.Status = ServiceOperational
+	if status.Redis != ComponentOK || status.Postgres != ComponentOK || status.NotificationQueue == QueueBacklogged {
+		status.Status = ServiceDegraded
+	}
+	return status
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// ErrTTLPolicyNotFound is returned for a TTL policy rule that does not exist
+var ErrTTLPolicyNotFound = errors.New("TTL policy rule not found")
+
+// TTLPolicyRule sets the default and maximum TTL of messages to recipients
+// whose email domain matches RecipientDomainGlob. Rules are evaluated by
+// Position, lowest first, and the first match applies
+type TTLPolicyRule struct {
+	ID       int64 `json:"id"`
+	Position int   `json:"position"` // ties are broken by ID
+
+	// RecipientDomainGlob matches the domain of the recipient's email, case
+	// insensitively, with * and ? wildcards. "*.example.com" does not match
+	// example.com itself
+	RecipientDomainGlob string `json:"recipient_domain_glob"`
+
+	DefaultTTL int64 `json:"default_ttl"` // seconds, used when the sender gives no TTL
+	MaxTTL     int64 `json:"max_ttl"`     // seconds; longer TTLs are cut down to it
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TTLPolicyRuleRequest creates or replaces a TTL policy rule
+// Position is optional on create, appending the rule after the others
+type TTLPolicyRuleRequest struct {
+	Position            *int   `json:"position" binding:"omitempty,min=0"`
+	RecipientDomainGlob string `json:"recipient_domain_glob" binding:"required,max=255"`
+	DefaultTTL          int64  `json:"default_ttl" binding:"required"`
+	MaxTTL              int64  `json:"max_ttl" binding:"required"`
+}
+
+// Validate checks the glob and that MinTTL <= DefaultTTL <= MaxTTL <= the
+// global MaxTTL, and returns the problem of each invalid field
+func (r *TTLPolicyRuleRequest) Validate() map[string]string {
+	problems := map[string]string{}
+	if _, err := path.Match(r.RecipientDomainGlob, ""); err != nil || strings.ContainsAny(r.RecipientDomainGlob, "@/") {
+		problems["recipient_domain_glob"] = "must be a domain glob such as example.com or *.example.com"
+	}
+	if r.MaxTTL < MinTTL || r.MaxTTL > MaxTTL {
+		problems["max_ttl"] = fmt.Sprintf("must be between %d and %d seconds", MinTTL, MaxTTL)
+	}
+	if r.DefaultTTL < MinTTL || r.DefaultTTL > r.MaxTTL {
+		problems["default_ttl"] = fmt.Sprintf("must be between %d seconds and max_ttl", MinTTL)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return problems
+}
+
+// MatchTTLPolicy returns the first of rules, already in evaluation order,
+// matching the domain of email, or nil
+func MatchTTLPolicy(rules []*TTLPolicyRule, email string) *TTLPolicyRule {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return nil
+	}
+	domain := strings.ToLower(email[at+1:])
+	for _, rule := range rules {
+		if ok, _ := path.Match(strings.ToLower(rule.RecipientDomainGlob), domain); ok {
+			return rule
+		}
+	}
+	return nil
+}
@@ -1,7 +1,15 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -10,23 +18,55 @@ import (
 var (
 	// ErrInvalidCredentials is returned when login credentials are incorrect
 	ErrInvalidCredentials = errors.New("invalid email or password")
+	// ErrUserNotFound is returned when no account has the given ID
+	ErrUserNotFound = errors.New("user not found")
 	// ErrUserExists is returned when attempting to register with existing email
 	ErrUserExists = errors.New("user with this email already exists")
 	// ErrUnauthorized is returned when user is not authenticated
 	ErrUnauthorized = errors.New("unauthorized")
 	// ErrForbidden is returned when user doesn't have permission
 	ErrForbidden = errors.New("forbidden: you are not the intended recipient")
+	// ErrInvalidPublicKey is returned for a public key that is not 32 base64url bytes
+	ErrInvalidPublicKey = errors.New("public key must be 32 bytes, base64url-encoded")
+	// ErrServiceAccount is returned when a service account tries to log in interactively
+	ErrServiceAccount = errors.New("service accounts must authenticate with an API key")
 )
 
+// DeletedUserName replaces the name of an anonymized account
+const DeletedUserName = "Deleted user"
+
 // User represents a user account
 type User struct {
-	ID        int64     `json:"id" db:"id"`
-	Email     string    `json:"email" db:"email"`
-	Name      string    `json:"name" db:"name"`
-	Password  string    `json:"-" db:"password_hash"` // Never expose password in JSON
-	IsAdmin   bool      `json:"is_admin" db:"is_admin"`
-	CreatedAt time.Time `json:"created_at" db:"created_at"`
-	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ID         int64      `json:"id" db:"id"`
+	Email      string     `json:"email" db:"email"`
+	Name       string     `json:"name" db:"name"`
+	Password   string     `json:"-" db:"password_hash"` // Never expose password in JSON
+	IsAdmin    bool       `json:"is_admin" db:"is_admin"`
+	IsActive   bool       `json:"-" db:"is_active"`             // False once the account has been deleted or deactivated
+	IsService  bool       `json:"is_service" db:"is_service"`   // Service account: authenticates only with API keys
+	AuthSource string     `json:"-" db:"auth_source"`           // AuthSourceLocal or AuthSourceLDAP; empty means local
+	Region     string     `json:"region,omitempty" db:"region"` // Data residency region of the user's messages; empty for the default cluster
+	LastLogin  *time.Time `json:"-" db:"last_login"`            // Last successful password sign-in; nil if never
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at" db:"updated_at"`
+}
+
+// Where an account's password is checked
+const (
+	AuthSourceLocal = "local" // Against the stored bcrypt hash
+	AuthSourceLDAP  = "ldap"  // By binding to the LDAP directory; nothing is stored
+)
+
+// IsDirectoryAccount reports whether the account signs in through LDAP, so
+// its password cannot be changed or reset here
+func (u *User) IsDirectoryAccount() bool {
+	return u.AuthSource == AuthSourceLDAP
+}
+
+// NormalizeEmail returns the form emails are stored and looked up in,
+// trimmed and lowercased, so Bob@Corp.com and bob@corp.com are one account
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
 
 // RegisterRequest represents a registration request
@@ -36,12 +76,32 @@ type RegisterRequest struct {
 	Password string `json:"password" binding:"required,min=8"`
 }
 
+// UnmarshalJSON normalizes the email as it is decoded, before validation
+func (r *RegisterRequest) UnmarshalJSON(data []byte) error {
+	type plain RegisterRequest
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+	r.Email = NormalizeEmail(r.Email)
+	return nil
+}
+
 // LoginRequest represents a login request
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
 }
 
+// UnmarshalJSON normalizes the email as it is decoded, before validation
+func (r *LoginRequest) UnmarshalJSON(data []byte) error {
+	type plain LoginRequest
+	if err := json.Unmarshal(data, (*plain)(r)); err != nil {
+		return err
+	}
+	r.Email = NormalizeEmail(r.Email)
+	return nil
+}
+
 // AuthResponse represents the response after successful authentication
 type AuthResponse struct {
 	Token string    `json:"token"`
@@ -50,30 +110,240 @@ type AuthResponse struct {
 
 // UserInfo represents public user information (no sensitive data)
 type UserInfo struct {
-	ID      int64  `json:"id"`
-	Email   string `json:"email"`
-	Name    string `json:"name"`
-	IsAdmin bool   `json:"is_admin"`
+	ID        int64  `json:"id"`
+	Email     string `json:"email"`
+	Name      string `json:"name"`
+	IsAdmin   bool   `json:"is_admin"`
+	IsService bool   `json:"is_service,omitempty"`
+	PublicKey string `json:"public_key,omitempty"` // X25519 key senders seal link keys to; only set in user listings
+	Region    string `json:"region,omitempty"`     // Data residency region; not set in user listings
+}
+
+// ProvisionUserRequest is the desired state of an account for
+// PUT /api/admin/users/by-email/:email. Omitted fields mean a regular, active
+// user, so repeating a request always converges on the same account
+type ProvisionUserRequest struct {
+	Name     string `json:"name" binding:"required,min=2,max=100"`
+	Password string `json:"password" binding:"omitempty,min=8"` // Only used to create; without one the account signs in through SSO
+	IsAdmin  bool   `json:"is_admin"`
+	Active   *bool  `json:"active"`
+}
+
+// ProvisionedUser is an account as the provisioning API reports it
+type ProvisionedUser struct {
+	ID        int64     `json:"id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	IsAdmin   bool      `json:"is_admin"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ProvisionUserResponse reports what an upsert did to the account
+type ProvisionUserResponse struct {
+	Result string          `json:"result"` // ProvisionCreated, ProvisionUpdated or ProvisionUnchanged
+	User   ProvisionedUser `json:"user"`
+}
+
+// Results of a provisioning upsert
+const (
+	ProvisionCreated   = "created"
+	ProvisionUpdated   = "updated"
+	ProvisionUnchanged = "unchanged"
+)
+
+// ToProvisionedUser converts a User for the provisioning API
+func (u *User) ToProvisionedUser() ProvisionedUser {
+	return ProvisionedUser{
+		ID:        u.ID,
+		Email:     u.Email,
+		Name:      u.Name,
+		IsAdmin:   u.IsAdmin,
+		Active:    u.IsActive,
+		CreatedAt: u.CreatedAt,
+		UpdatedAt: u.UpdatedAt,
+	}
+}
+
+// AdminUser is an account as the admin user listings report it. The last
+// sign-in is left out of ProvisionedUser, whose ETag must not change when
+// the user signs in
+type AdminUser struct {
+	ProvisionedUser
+	LastLogin *time.Time `json:"last_login_at"` // null if the account never signed in
+}
+
+// ToAdminUser converts a User for the admin user listings
+func (u *User) ToAdminUser() AdminUser {
+	return AdminUser{ProvisionedUser: u.ToProvisionedUser(), LastLogin: u.LastLogin}
+}
+
+// DuplicateAccounts is a set of accounts whose emails differ only in case,
+// created before emails were normalized, as GET
+// /api/admin/users/duplicates reports it
+type DuplicateAccounts struct {
+	Email    string            `json:"email"`    // the normalized email they share
+	Accounts []ProvisionedUser `json:"accounts"` // oldest first, the one logins reach
+}
+
+// Bounds of the inactive_days threshold of the admin user listings
+const (
+	DefaultInactiveDays = 90
+	MaxInactiveDays     = 3650
+)
+
+// InactiveCutoff returns the time before which an account's last sign-in
+// makes it inactive, days whole days before now
+func InactiveCutoff(days int, now time.Time) time.Time {
+	return now.Add(-time.Duration(days) * 24 * time.Hour)
 }
 
-// HashPassword hashes a password using bcrypt
+// InactiveSince reports whether the account has not signed in since cutoff
+// An account that never signed in is inactive; one that signed in exactly
+// at cutoff is not
+func (u *User) InactiveSince(cutoff time.Time) bool {
+	return u.LastLogin == nil || u.LastLogin.Before(cutoff)
+}
+
+// DeactivateInactiveRequest deactivates accounts GET
+// /api/admin/users/inactive listed. Each is checked again against
+// InactiveDays, so an account that signed in since is kept
+type DeactivateInactiveRequest struct {
+	UserIDs      []int64 `json:"user_ids" binding:"required,min=1,max=1000"`
+	InactiveDays int     `json:"inactive_days" binding:"required,min=1,max=3650"`
+}
+
+// DeactivateInactiveResponse lists the accounts a bulk deactivation
+// deactivated and those it kept: active since, already deactivated,
+// unknown or the caller's own
+type DeactivateInactiveResponse struct {
+	Deactivated []int64 `json:"deactivated"`
+	Skipped     []int64 `json:"skipped"`
+}
+
+// MergeCounts reports how many rows a merge moved to the kept account
+type MergeCounts struct {
+	Messages  int64 `json:"messages"` // sent or received
+	APIKeys   int64 `json:"api_keys"`
+	AccessLog int64 `json:"access_log"`
+}
+
+// MergeUserResponse reports a merge of duplicate accounts
+type MergeUserResponse struct {
+	Moved MergeCounts     `json:"moved"`
+	User  ProvisionedUser `json:"user"` // the kept account
+}
+
+// UpdatePublicKeyRequest sets or, with an empty key, removes the caller's
+// X25519 public key (32 bytes, base64url like the link key)
+type UpdatePublicKeyRequest struct {
+	PublicKey string `json:"public_key"`
+}
+
+// PublicKeySize is the length of a decoded X25519 public key
+const PublicKeySize = 32
+
+// ValidatePublicKey checks that key is a base64url-encoded X25519 public key
+func ValidatePublicKey(key string) error {
+	raw, err := base64.URLEncoding.DecodeString(key)
+	if err != nil || len(raw) != PublicKeySize {
+		return ErrInvalidPublicKey
+	}
+	return nil
+}
+
+// passwordCost is the bcrypt cost of new hashes; 0 selects bcrypt.DefaultCost
+var passwordCost atomic.Int32
+
+// SetPasswordCost sets the bcrypt cost (BCRYPT_COST) of every password hashed
+// from now on, by registration, admin user creation, CSV import and password
+// changes alike. Existing hashes keep the cost they were made with
+func SetPasswordCost(cost int) error {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	passwordCost.Store(int32(cost))
+	return nil
+}
+
+// PasswordCost returns the bcrypt cost used by HashPassword
+func PasswordCost() int {
+	if cost := passwordCost.Load(); cost != 0 {
+		return int(cost)
+	}
+	return bcrypt.DefaultCost
+}
+
+// HashPassword hashes a password using bcrypt at PasswordCost
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost())
 	return string(bytes), err
 }
 
-// CheckPassword compares a hashed password with a plaintext password
+// CheckPassword compares a hashed password with a plaintext password.
+// Accounts without a password, such as LDAP-backed ones, never match
 func (u *User) CheckPassword(password string) bool {
+	if u.Password == "" {
+		return RejectPassword(password)
+	}
 	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 	return err == nil
 }
 
+// dummyHashes caches, per bcrypt cost, the hash RejectPassword compares
+// against
+var dummyHashes sync.Map // int -> []byte
+
+// RejectPassword checks password against a fixed dummy hash at PasswordCost
+// and returns false whatever the outcome. Logins with no hash to check, for
+// an unknown email or an account without a password, call it so they take
+// as long as a wrong password and response times do not reveal which
+// accounts exist
+func RejectPassword(password string) bool {
+	cost := PasswordCost()
+	hash, ok := dummyHashes.Load(cost)
+	if !ok {
+		generated, err := bcrypt.GenerateFromPassword([]byte("vanish-dummy-password"), cost)
+		if err != nil {
+			return false
+		}
+		hash, _ = dummyHashes.LoadOrStore(cost, generated)
+	}
+	_ = bcrypt.CompareHashAndPassword(hash.([]byte), []byte(password))
+	return false
+}
+
 // ToUserInfo converts a User to UserInfo (safe for public exposure)
 func (u *User) ToUserInfo() *UserInfo {
 	return &UserInfo{
-		ID:      u.ID,
-		Email:   u.Email,
-		Name:    u.Name,
-		IsAdmin: u.IsAdmin,
+		ID:        u.ID,
+		Email:     u.Email,
+		Name:      u.Name,
+		IsAdmin:   u.IsAdmin,
+		IsService: u.IsService,
+		Region:    u.Region,
 	}
 }
+
+// tombstoneDomain is the reserved domain of anonymized accounts' emails
+const tombstoneDomain = "deleted.invalid"
+
+// TombstoneEmail returns the unique placeholder email of an anonymized account
+// The original address is only kept as a truncated hash so it cannot be read back
+func TombstoneEmail(id int64, email string) string {
+	sum := sha256.Sum256([]byte(email))
+	return fmt.Sprintf("deleted-%d-%s@%s", id, hex.EncodeToString(sum[:8]), tombstoneDomain)
+}
+
+// IsAnonymized reports whether the account was deleted and only its
+// tombstone remains
+func (u *User) IsAnonymized() bool {
+	return IsTombstoneEmail(u.Email)
+}
+
+// IsTombstoneEmail reports whether email is the placeholder of an
+// anonymized account, as made by TombstoneEmail
+func IsTombstoneEmail(email string) bool {
+	return strings.HasSuffix(email, "@"+tombstoneDomain)
+}
@@ -0,0 +1,49 @@
+// Package openapi embeds the hand-maintained OpenAPI 3 description of the
+// Vanish HTTP API and validates responses against it
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed openapi.yaml
+var specYAML []byte
+
+var (
+	loadOnce sync.Once
+	document map[string]interface{}
+	specJSON []byte
+	loadErr  error
+)
+
+// load parses the embedded YAML once and caches the JSON rendering
+func load() {
+	loadOnce.Do(func() {
+		if err := yaml.Unmarshal(specYAML, &document); err != nil {
+			loadErr = fmt.Errorf("failed to parse openapi.yaml: %w", err)
+			return
+		}
+		specJSON, loadErr = json.Marshal(document)
+		if loadErr != nil {
+			loadErr = fmt.Errorf("failed to render openapi.yaml as JSON: %w", loadErr)
+		}
+	})
+}
+
+// JSON returns the specification rendered as JSON
+func JSON() ([]byte, error) {
+	load()
+	return specJSON, loadErr
+}
+
+// Document returns the parsed specification
+// Callers must treat the returned map as read-only
+func Document() (map[string]interface{}, error) {
+	load()
+	return document, loadErr
+}
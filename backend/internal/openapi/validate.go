@@ -0,0 +1,294 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Unversioned requests are validated as their /api/v1 equivalent
+	legacyPrefix  = "/api"
+	currentPrefix = "/api/v1"
+)
+
+// Validator checks HTTP responses against the specification
+type Validator struct {
+	doc   map[string]interface{}
+	paths []pathTemplate
+}
+
+// pathTemplate is a documented path split into segments for matching
+type pathTemplate struct {
+	template string
+	segments []string
+}
+
+// NewValidator creates a validator for the embedded specification
+func NewValidator() (*Validator, error) {
+	doc, err := Document()
+	if err != nil {
+		return nil, err
+	}
+
+	paths, _ := doc["paths"].(map[string]interface{})
+	v := &Validator{doc: doc}
+	for template := range paths {
+		v.paths = append(v.paths, pathTemplate{
+			template: template,
+			segments: strings.Split(strings.Trim(template, "/"), "/"),
+		})
+	}
+
+	// Literal segments win over parameters (e.g. /users/import vs /users/{id})
+	sort.Slice(v.paths, func(i, j int) bool {
+		return strings.Count(v.paths[i].template, "{") < strings.Count(v.paths[j].template, "{")
+	})
+
+	return v, nil
+}
+
+// HasOperation reports whether method and path are documented
+func (v *Validator) HasOperation(method, path string) bool {
+	_, ok := v.operation(method, path)
+	return ok
+}
+
+// ValidateResponse checks a response against the documented operation
+// Undocumented routes are reported unless the server answered 404
+func (v *Validator) ValidateResponse(method, path string, status int, contentType string, body []byte) error {
+	op, ok := v.operation(method, path)
+	if !ok {
+		if status == http.StatusNotFound {
+			return nil
+		}
+		return fmt.Errorf("%s %s: operation not documented", method, path)
+	}
+
+	responses, _ := op["responses"].(map[string]interface{})
+	response, ok := responses[strconv.Itoa(status)]
+	if !ok {
+		response, ok = responses["default"]
+	}
+	if !ok {
+		return fmt.Errorf("%s %s: status %d not documented", method, path, status)
+	}
+	responseMap := v.resolve(response)
+
+	content, _ := responseMap["content"].(map[string]interface{})
+	if len(content) == 0 || method == http.MethodHead || len(body) == 0 {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	media, ok := content[mediaType].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s %s: content type %q not documented for status %d", method, path, contentType, status)
+	}
+	schema, ok := media["schema"]
+	if !ok || mediaType != "application/json" {
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("%s %s: response is not valid JSON: %w", method, path, err)
+	}
+
+	if err := v.validate(schema, value, "$"); err != nil {
+		return fmt.Errorf("%s %s (%d): %w", method, path, status, err)
+	}
+	return nil
+}
+
+// operation finds the documented operation for a request
+func (v *Validator) operation(method, path string) (map[string]interface{}, bool) {
+	candidates := []string{path}
+	if strings.HasPrefix(path, legacyPrefix+"/") && !strings.HasPrefix(path, currentPrefix+"/") {
+		candidates = append(candidates, currentPrefix+strings.TrimPrefix(path, legacyPrefix))
+	}
+
+	paths, _ := v.doc["paths"].(map[string]interface{})
+	for _, candidate := range candidates {
+		segments := strings.Split(strings.Trim(candidate, "/"), "/")
+		for _, p := range v.paths {
+			if !matchSegments(p.segments, segments) {
+				continue
+			}
+			item, _ := paths[p.template].(map[string]interface{})
+			if op, ok := item[strings.ToLower(method)].(map[string]interface{}); ok {
+				return op, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// matchSegments compares a path against a template with {param} segments
+func matchSegments(template, path []string) bool {
+	if len(template) != len(path) {
+		return false
+	}
+	for i, segment := range template {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			if path[i] == "" {
+				return false
+			}
+			continue
+		}
+		if segment != path[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// resolve follows a local $ref ("#/components/...") if present
+func (v *Validator) resolve(node interface{}) map[string]interface{} {
+	m, _ := node.(map[string]interface{})
+	for {
+		ref, ok := m["$ref"].(string)
+		if !ok {
+			return m
+		}
+		var current interface{} = v.doc
+		for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+			next, _ := current.(map[string]interface{})
+			current = next[part]
+		}
+		m, _ = current.(map[string]interface{})
+	}
+}
+
+// validate checks value against the supported JSON Schema subset:
+// type, nullable, enum, format date-time, properties, required,
+// additionalProperties: false, items and oneOf
+func (v *Validator) validate(node interface{}, value interface{}, at string) error {
+	schema := v.resolve(node)
+	if schema == nil {
+		return nil
+	}
+
+	if options, ok := schema["oneOf"].([]interface{}); ok {
+		matched := 0
+		var first error
+		for _, option := range options {
+			err := v.validate(option, value, at)
+			if err == nil {
+				matched++
+			} else if first == nil {
+				first = err
+			}
+		}
+		switch matched {
+		case 0:
+			return first
+		case 1:
+			return nil
+		default:
+			return fmt.Errorf("%s: matches %d of the oneOf schemas", at, matched)
+		}
+	}
+
+	if value == nil {
+		if nullable, _ := schema["nullable"].(bool); nullable {
+			return nil
+		}
+		if _, typed := schema["type"]; typed {
+			return fmt.Errorf("%s: null is not allowed", at)
+		}
+		return nil
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, allowed := range enum {
+			if fmt.Sprint(allowed) == fmt.Sprint(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: %v is not one of %v", at, value, enum)
+		}
+	}
+
+	switch schema["type"] {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %T", at, value)
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, present := obj[name.(string)]; !present {
+					return fmt.Errorf("%s: missing required property %q", at, name)
+				}
+			}
+		}
+		for name, field := range obj {
+			propSchema, documented := properties[name]
+			if !documented {
+				if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+					return fmt.Errorf("%s: undocumented property %q", at, name)
+				}
+				continue
+			}
+			if err := v.validate(propSchema, field, at+"."+name); err != nil {
+				return err
+			}
+		}
+
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected array, got %T", at, value)
+		}
+		for i, item := range arr {
+			if err := v.validate(schema["items"], item, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected string, got %T", at, value)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				return fmt.Errorf("%s: %q is not an RFC 3339 date-time", at, s)
+			}
+		}
+
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: expected integer, got %T", at, value)
+		}
+		if _, err := n.Int64(); err != nil {
+			return fmt.Errorf("%s: %s is not an integer", at, n)
+		}
+
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return fmt.Errorf("%s: expected number, got %T", at, value)
+		}
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean, got %T", at, value)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,297 @@
+package persistence
+
+import (
+	"context"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/backup"
+	"github.com/milkiss/vanish/backend/internal/models"
+)
+
+// UserStore defines the interface for user account persistence
+// The PostgreSQL implementation lives in the repository package
+type UserStore interface {
+	// Create creates a new user and populates its ID and timestamps
+	Create(ctx context.Context, user *models.User) error
+
+	// FindByEmail finds a user by email, ignoring case (returns
+	// models.ErrInvalidCredentials if missing)
+	FindByEmail(ctx context.Context, email string) (*models.User, error)
+
+	// FindByID finds a user by ID
+	FindByID(ctx context.Context, id int64) (*models.User, error)
+
+	// ListAll returns all active users (for recipient selection)
+	ListAll(ctx context.Context) ([]*models.UserInfo, error)
+
+	// ListAccounts returns every regular account, deactivated ones included,
+	// ordered by ID. Service accounts and anonymized tombstones are left out
+	ListAccounts(ctx context.Context) ([]*models.User, error)
+
+	// ListInactive returns the regular accounts, deactivated ones included,
+	// that never signed in or last did before cutoff, ordered by ID
+	ListInactive(ctx context.Context, cutoff time.Time) ([]*models.User, error)
+
+	// ListEmailDuplicates returns the accounts whose emails differ only in
+	// case, grouped by lowercased email and ordered by ID within each group
+	ListEmailDuplicates(ctx context.Context) ([]*models.User, error)
+
+	// Update updates a user's information, including whether it is active
+	// (returns models.ErrUserExists if the email is taken)
+	Update(ctx context.Context, user *models.User) error
+
+	// MergeUsers moves the messages (sent and received), API keys and access
+	// log entries of duplicateID to keepID, then deactivates duplicateID and
+	// turns it into a tombstone, and records the merge by actorID in the
+	// admin audit log, all in one transaction. The kept account's name and
+	// role stay as they are; its email is normalized when no other account
+	// shares it
+	MergeUsers(ctx context.Context, actorID, keepID, duplicateID int64) (*models.MergeCounts, error)
+
+	// Delete deletes a user by ID, cascading to their message metadata
+	Delete(ctx context.Context, id int64) error
+
+	// Anonymize turns a user into a tombstone: email hashed, name replaced,
+	// credentials and admin role removed and the account deactivated.
+	// Their API keys are revoked in the same transaction. The row is kept
+	// so other users' message history still resolves
+	Anonymize(ctx context.Context, id int64) error
+
+	// UpdatePassword updates only the password for a user
+	UpdatePassword(ctx context.Context, userID int64, hashedPassword string) error
+
+	// RecordLogin sets a user's last sign-in to now
+	RecordLogin(ctx context.Context, userID int64) error
+
+	// UpdatePublicKey sets the X25519 key senders seal link keys to for
+	// this user; an empty key removes it
+	UpdatePublicKey(ctx context.Context, userID int64, publicKey string) error
+
+	// CreateAPIKey stores a new API key and populates its ID and CreatedAt
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+
+	// ListAPIKeys returns a user's API keys, revoked ones included, newest first
+	ListAPIKeys(ctx context.Context, userID int64) ([]*models.APIKey, error)
+
+	// RevokeAPIKey revokes one of a user's keys (returns
+	// models.ErrAPIKeyNotFound if missing or already revoked)
+	RevokeAPIKey(ctx context.Context, userID, keyID int64) error
+
+	// AuthenticateAPIKey returns the owner of the unrevoked key with the given
+	// hash and records its use (returns models.ErrAPIKeyNotFound if none)
+	AuthenticateAPIKey(ctx context.Context, hash string) (*models.User, error)
+}
+
+// MetadataStore defines the interface for message metadata persistence
+// The PostgreSQL implementation lives in the repository package
+type MetadataStore interface {
+	// Create creates a new message metadata record
+	Create(ctx context.Context, metadata *models.MessageMetadata) error
+
+	// FindByMessageID finds metadata by message ID, with SenderName populated
+	// (returns models.ErrMessageNotFound if missing)
+	FindByMessageID(ctx context.Context, messageID string) (*models.MessageMetadata, error)
+
+	// GetEncryptionKey returns the decrypted link key stored for a message,
+	// or "" when none is kept: zero-knowledge Slack messages, keys sealed to
+	// the recipient and messages already read
+	// (returns models.ErrMessageNotFound if missing)
+	GetEncryptionKey(ctx context.Context, messageID string) (string, error)
+
+	// MarkAsClaimed moves a pending message to claimed and records when its
+	// claim lapses as its expiry, since the payload is gone after that
+	MarkAsClaimed(ctx context.Context, messageID string, lapsesAt time.Time) error
+
+	// MarkAsRead marks a message as read
+	MarkAsRead(ctx context.Context, messageID string) error
+
+	// GetUserHistory returns message history for a user (sent or received),
+	// newest first by created_at and then ID, with ID populated. A non-empty
+	// search keeps the messages whose counterpart's name or email, or whose
+	// category, contains it ignoring case; it only ever narrows the user's
+	// own messages
+	GetUserHistory(ctx context.Context, userID int64, search string, page models.Page) ([]*models.MessageHistoryResponse, error)
+
+	// ListUserMessages returns up to limit messages the user sent or received
+	// with ID greater than afterID, oldest first, with SenderName and
+	// RecipientName populated and the encryption key left empty
+	ListUserMessages(ctx context.Context, userID, afterID int64, limit int) ([]*models.MessageMetadata, error)
+
+	// ListInbox returns a page of the unexpired, released pending messages
+	// sent to the user, soonest to expire first by expires_at and then ID,
+	// with SenderName, the decrypted EncryptionKey and SealedKey populated
+	ListInbox(ctx context.Context, recipientID int64, page models.Page) ([]*models.MessageMetadata, error)
+
+	// CountPendingForRecipient counts unexpired pending messages waiting for a user
+	CountPendingForRecipient(ctx context.Context, recipientID int64) (int, error)
+
+	// CountRecipientsWithPending counts the users with at least atLeast
+	// unexpired pending messages waiting for them
+	CountRecipientsWithPending(ctx context.Context, atLeast int) (int, error)
+
+	// ExpirePendingForRecipient expires those of messageIDs that are pending
+	// for recipientID, drops their stored keys and returns the expired IDs
+	ExpirePendingForRecipient(ctx context.Context, recipientID int64, messageIDs []string) ([]string, error)
+
+	// ExpireUserMessages marks every pending or claimed message the user sent
+	// or received as expired, drops their stored keys and returns their IDs
+	ExpireUserMessages(ctx context.Context, userID int64) ([]string, error)
+
+	// RevokeMessage expires a pending or claimed message sent by senderID
+	// and drops its stored keys (returns models.ErrMessageNotFound if there
+	// is no such message)
+	RevokeMessage(ctx context.Context, senderID int64, messageID string) error
+
+	// CountByBucket counts messages per UTC bucket of the given interval for
+	// the metric's timestamp in [from, to). Empty buckets are omitted
+	CountByBucket(ctx context.Context, metric models.StatisticsMetric, interval models.StatisticsInterval, from, to time.Time) ([]models.TimeSeriesPoint, error)
+
+	// TopSenders returns the users who created the most messages in [from, to)
+	TopSenders(ctx context.Context, from, to time.Time, limit int) ([]models.LeaderboardEntry, error)
+
+	// TopRecipients returns the users who received the most messages in [from, to)
+	TopRecipients(ctx context.Context, from, to time.Time, limit int) ([]models.LeaderboardEntry, error)
+
+	// CleanupExpired marks expired pending or claimed messages as expired
+	// and returns their message IDs
+	CleanupExpired(ctx context.Context) ([]string, error)
+
+	// ListPending returns up to limit pending messages with ID greater than
+	// afterID, oldest first, without their encryption keys
+	ListPending(ctx context.Context, afterID int64, limit int) ([]*models.MessageMetadata, error)
+
+	// UpdateExpiresAt corrects the expiry recorded for a message
+	UpdateExpiresAt(ctx context.Context, messageID string, expiresAt time.Time) error
+
+	// ScheduleNotification stores a notification to send at n.SendAt; a
+	// second one for the same message and channel is ignored
+	ScheduleNotification(ctx context.Context, n *models.ScheduledNotification) error
+
+	// TakeDueNotifications removes and returns up to limit scheduled
+	// notifications with SendAt at or before now, each to exactly one caller
+	TakeDueNotifications(ctx context.Context, now time.Time, limit int) ([]*models.ScheduledNotification, error)
+
+	// CountDueNotifications returns how many scheduled notifications are
+	// due at now but not yet taken
+	CountDueNotifications(ctx context.Context, now time.Time) (int, error)
+}
+
+// AccessLogStore defines the interface for the message access audit log
+// The PostgreSQL implementation lives in the repository package
+type AccessLogStore interface {
+	// RecordAccess stores a batch of access attempts in one statement
+	RecordAccess(ctx context.Context, entries []*models.AccessLogEntry) error
+
+	// ListAccess returns up to limit attempts on a message, newest first,
+	// with UserName populated
+	ListAccess(ctx context.Context, messageID string, limit int) ([]*models.AccessLogEntry, error)
+
+	// PurgeAccessBefore deletes attempts recorded before cutoff and returns
+	// how many were removed
+	PurgeAccessBefore(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// SlackInstallationStore defines the interface for the workspaces the Slack
+// app was installed into
+// The PostgreSQL implementation lives in the repository package
+type SlackInstallationStore interface {
+	// SaveSlackInstallation stores an installation, replacing an earlier
+	// one of the same workspace, and populates its timestamps
+	SaveSlackInstallation(ctx context.Context, installation *models.SlackInstallation) error
+
+	// FindSlackInstallation returns the installation of a workspace
+	// (returns models.ErrSlackNotInstalled if missing)
+	FindSlackInstallation(ctx context.Context, teamID string) (*models.SlackInstallation, error)
+}
+
+// DigestStore defines the interface for the admin digest: the notable
+// events it reports and the periods already posted
+// The PostgreSQL implementation lives in the repository package
+type DigestStore interface {
+	// RecordEvent counts one event at the current time
+	RecordEvent(ctx context.Context, kind models.DigestEvent) error
+
+	// CountEvents counts the events of each kind recorded in [from, to);
+	// kinds without events are omitted
+	CountEvents(ctx context.Context, from, to time.Time) (map[models.DigestEvent]int, error)
+
+	// PurgeEventsBefore deletes events recorded before cutoff and returns
+	// how many were removed
+	PurgeEventsBefore(ctx context.Context, cutoff time.Time) (int64, error)
+
+	// ClaimDigest records that the digest of period is being sent and
+	// reports whether this call claimed it; false means it already was
+	ClaimDigest(ctx context.Context, period string) (bool, error)
+
+	// ReleaseDigest forgets the claim of a digest that could not be posted,
+	// so a later run sends it again
+	ReleaseDigest(ctx context.Context, period string) error
+}
+
+// TTLPolicyStore defines the interface for the TTL policy rules admins keep
+// per recipient domain, the policies they keep per message category and
+// the sender policy of banned domains and DLP patterns
+// The PostgreSQL implementation lives in the repository package
+type TTLPolicyStore interface {
+	// ListTTLPolicies returns every rule in evaluation order
+	ListTTLPolicies(ctx context.Context) ([]*models.TTLPolicyRule, error)
+
+	// CreateTTLPolicy adds a rule, filling in its ID and timestamps. A rule
+	// without a position is placed after the others
+	CreateTTLPolicy(ctx context.Context, rule *models.TTLPolicyRule, position *int) error
+
+	// UpdateTTLPolicy replaces the rule with rule.ID, keeping its position
+	// unless position is set. Returns models.ErrTTLPolicyNotFound when
+	// there is no such rule
+	UpdateTTLPolicy(ctx context.Context, rule *models.TTLPolicyRule, position *int) error
+
+	// DeleteTTLPolicy removes a rule, returning models.ErrTTLPolicyNotFound
+	// when there is no such rule
+	DeleteTTLPolicy(ctx context.Context, id int64) error
+
+	// ListCategoryPolicies returns every category policy ordered by category
+	ListCategoryPolicies(ctx context.Context) ([]*models.CategoryPolicy, error)
+
+	// GetCategoryPolicy returns the policy of category, or
+	// models.ErrCategoryPolicyNotFound when it has none
+	GetCategoryPolicy(ctx context.Context, category string) (*models.CategoryPolicy, error)
+
+	// PutCategoryPolicy creates or replaces the policy of policy.Category,
+	// filling in its timestamps, and reports whether it was created
+	PutCategoryPolicy(ctx context.Context, policy *models.CategoryPolicy) (bool, error)
+
+	// DeleteCategoryPolicy removes the policy of category, returning
+	// models.ErrCategoryPolicyNotFound when it has none
+	DeleteCategoryPolicy(ctx context.Context, category string) error
+
+	// ListBannedDomains returns every banned domain ordered by domain
+	ListBannedDomains(ctx context.Context) ([]*models.BannedDomain, error)
+
+	// PutBannedDomain bans domain.Domain or replaces the reason of its ban,
+	// filling in its timestamp, and reports whether it was created
+	PutBannedDomain(ctx context.Context, domain *models.BannedDomain) (bool, error)
+
+	// DeleteBannedDomain lifts the ban of domain, returning
+	// models.ErrBannedDomainNotFound when it is not banned
+	DeleteBannedDomain(ctx context.Context, domain string) error
+
+	// ListDLPPatterns returns every DLP pattern ordered by name
+	ListDLPPatterns(ctx context.Context) ([]*models.DLPPattern, error)
+
+	// PutDLPPattern creates or replaces the pattern named pattern.Name,
+	// filling in its timestamps, and reports whether it was created
+	PutDLPPattern(ctx context.Context, pattern *models.DLPPattern) (bool, error)
+
+	// DeleteDLPPattern removes the pattern named name, returning
+	// models.ErrDLPPatternNotFound when there is none
+	DeleteDLPPattern(ctx context.Context, name string) error
+}
+
+// BackupStore defines the interface for disaster-recovery backups of the
+// accounts, message history and settings
+// The PostgreSQL implementation lives in the repository package
+type BackupStore interface {
+	// Export writes every backed-up table to dst from one consistent
+	// snapshot; the caller closes dst
+	Export(ctx context.Context, dst *backup.Writer) error
+}
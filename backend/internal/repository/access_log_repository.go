@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+)
+
+// AccessLogRepository handles the message access audit log
+type AccessLogRepository struct {
+	db *sql.DB
+}
+
+// NewAccessLogRepository creates a new access log repository
+func NewAccessLogRepository(db *sql.DB) *AccessLogRepository {
+	return &AccessLogRepository{db: db}
+}
+
+// RecordAccess inserts a batch of access attempts with a single statement
+func (r *AccessLogRepository) RecordAccess(ctx context.Context, entries []*models.AccessLogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	const columns = 7
+	placeholders := make([]string, len(entries))
+	args := make([]interface{}, 0, len(entries)*columns)
+	for i, e := range entries {
+		n := i * columns
+		placeholders[i] = fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7)
+		args = append(args, e.MessageID, e.UserID, e.Action, e.Outcome, e.IP, e.UserAgent, e.CreatedAt.UTC())
+	}
+
+	query := `
+		INSERT INTO access_log (message_id, user_id, action, outcome, ip, user_agent, created_at)
+		VALUES ` + strings.Join(placeholders, ", ")
+
+	if _, err := r.db.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to record access: %w", err)
+	}
+	return nil
+}
+
+// ListAccess returns the latest attempts on a message, newest first
+func (r *AccessLogRepository) ListAccess(ctx context.Context, messageID string, limit int) ([]*models.AccessLogEntry, error) {
+	query := `
+		SELECT a.id, a.message_id, a.user_id, u.name, a.action, a.outcome, a.ip, a.user_agent, a.created_at
+		FROM access_log a
+		JOIN users u ON u.id = a.user_id
+		WHERE a.message_id = $1
+		ORDER BY a.created_at DESC, a.id DESC
+		LIMIT $2
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, messageID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list access: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []*models.AccessLogEntry{}
+	for rows.Next() {
+		e := &models.AccessLogEntry{}
+		if err := rows.Scan(&e.ID, &e.MessageID, &e.UserID, &e.UserName, &e.Action, &e.Outcome, &e.IP, &e.UserAgent, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan access: %w", err)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
+// PurgeAccessBefore deletes attempts older than cutoff (called by the janitor)
+func (r *AccessLogRepository) PurgeAccessBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM access_log WHERE created_at < $1`, cutoff.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge access log: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// Ensure AccessLogRepository satisfies the persistence interface
+var _ persistence.AccessLogStore = (*AccessLogRepository)(nil)
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/milkiss/vanish/backend/internal/backup"
+	"github.com/milkiss/vanish/backend/internal/database"
+)
+
+// backupTable is a table disaster-recovery backups hold
+type backupTable struct {
+	name    string
+	orderBy string // primary key, so backups of the same data are identical
+	serial  bool   // has a SERIAL id whose sequence a restore moves past the rows
+}
+
+// backupTables lists the backed-up tables in restore order: referenced
+// tables come first. Left out are the access log, the admin audit log and
+// the digest counters, which are only history, and notifications still
+// scheduled, whose messages a restore cannot bring back. This tree has no
+// group tables
+var backupTables = []backupTable{
+	{"users", "id", true},
+	{"api_keys", "id", true},
+	{"message_metadata", "id", true},
+	{"ttl_policy_rules", "id", true},
+	{"category_policies", "category", false},
+	{"banned_domains", "domain", false},
+	{"dlp_patterns", "name", false},
+	{"slack_installations", "team_id", false},
+}
+
+// seededTable is filled by InitSchema, so a fresh database is not empty
+// there; a restore replaces its rows
+const seededTable = "category_policies"
+
+// BackupRepository reads and restores the tables of disaster-recovery
+// backups
+type BackupRepository struct {
+	db *sql.DB
+}
+
+// NewBackupRepository creates a new backup repository
+func NewBackupRepository(db *sql.DB) *BackupRepository {
+	return &BackupRepository{db: db}
+}
+
+// Export writes every backed-up table to dst from one consistent snapshot.
+// Nothing is written to dst before the row counts are known, so a failure
+// to reach the database leaves it empty. The caller closes dst
+func (r *BackupRepository) Export(ctx context.Context, dst *backup.Writer) error {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return fmt.Errorf("failed to start backup: %w", err)
+	}
+	defer tx.Rollback()
+
+	counts := make([]backup.TableCount, 0, len(backupTables))
+	for _, table := range backupTables {
+		var rows int64
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM `+table.name).Scan(&rows); err != nil {
+			return fmt.Errorf("failed to count %s: %w", table.name, err)
+		}
+		counts = append(counts, backup.TableCount{Name: table.name, Rows: rows})
+	}
+	if err := dst.Begin(database.SchemaVersion, counts); err != nil {
+		return err
+	}
+
+	for _, table := range backupTables {
+		if err := exportTable(ctx, tx, table, dst); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// exportTable writes every row of table to dst as JSON
+func exportTable(ctx context.Context, tx *sql.Tx, table backupTable, dst *backup.Writer) error {
+	rows, err := tx.QueryContext(ctx, `SELECT row_to_json(t)::text FROM `+table.name+` t ORDER BY `+table.orderBy)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", table.name, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row []byte
+		if err := rows.Scan(&row); err != nil {
+			return fmt.Errorf("failed to read %s: %w", table.name, err)
+		}
+		if err := dst.WriteRow(table.name, row); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", table.name, err)
+	}
+	return nil
+}
+
+// Restore loads the backup read by src into this database in one
+// transaction: either every row is restored or none. The backup must come
+// from the same schema version and the database must be empty apart from
+// what InitSchema seeds. Stored message keys and Slack bot tokens are
+// restored as sealed, so METADATA_ENCRYPTION_KEYS must hold the keys they
+// were sealed with
+func (r *BackupRepository) Restore(ctx context.Context, src *backup.Reader) error {
+	manifest := src.Manifest()
+	if manifest.SchemaVersion != database.SchemaVersion {
+		return fmt.Errorf("%w: the backup has schema version %d, this server %d",
+			backup.ErrSchemaVersion, manifest.SchemaVersion, database.SchemaVersion)
+	}
+	if len(manifest.Tables) != len(backupTables) {
+		return fmt.Errorf("%w: the backup lists %d tables, expected %d", backup.ErrSchemaVersion, len(manifest.Tables), len(backupTables))
+	}
+	order := make(map[string]int, len(backupTables))
+	for i, table := range backupTables {
+		if manifest.Tables[i].Name != table.name {
+			return fmt.Errorf("%w: the backup lists table %q where %q was expected", backup.ErrSchemaVersion, manifest.Tables[i].Name, table.name)
+		}
+		order[table.name] = i
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start restore: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, table := range backupTables {
+		if table.name == seededTable {
+			if _, err := tx.ExecContext(ctx, `DELETE FROM `+table.name); err != nil {
+				return fmt.Errorf("failed to clear %s: %w", table.name, err)
+			}
+			continue
+		}
+		var exists bool
+		if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM `+table.name+`)`).Scan(&exists); err != nil {
+			return fmt.Errorf("failed to check %s: %w", table.name, err)
+		}
+		if exists {
+			return fmt.Errorf("%w: %s has rows", backup.ErrNotEmpty, table.name)
+		}
+	}
+
+	// Each row is inserted as the table's own record type, so every column
+	// keeps its value, IDs included
+	inserts := make(map[string]*sql.Stmt, len(backupTables))
+	for _, table := range backupTables {
+		stmt, err := tx.PrepareContext(ctx,
+			`INSERT INTO `+table.name+` SELECT * FROM json_populate_record(NULL::`+table.name+`, $1::json)`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare %s: %w", table.name, err)
+		}
+		defer stmt.Close()
+		inserts[table.name] = stmt
+	}
+
+	restored := make([]int64, len(backupTables))
+	current := 0
+	for {
+		name, row, err := src.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		i, ok := order[name]
+		if !ok || i < current {
+			return fmt.Errorf("%w: rows of %s out of order", backup.ErrCorrupt, name)
+		}
+		current = i
+		if _, err := inserts[name].ExecContext(ctx, string(row)); err != nil {
+			return fmt.Errorf("failed to restore row %d of %s: %w", restored[i]+1, name, err)
+		}
+		restored[i]++
+	}
+
+	for i, table := range backupTables {
+		if restored[i] != manifest.Tables[i].Rows {
+			return fmt.Errorf("%w: restored %d rows of %s, the manifest lists %d",
+				backup.ErrCorrupt, restored[i], table.name, manifest.Tables[i].Rows)
+		}
+		if !table.serial {
+			continue
+		}
+		// New rows get IDs after the restored ones
+		_, err := tx.ExecContext(ctx,
+			`SELECT setval(pg_get_serial_sequence($1, 'id'), COALESCE(MAX(id), 0) + 1, false) FROM `+table.name, table.name)
+		if err != nil {
+			return fmt.Errorf("failed to reset the id sequence of %s: %w", table.name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit restore: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+)
+
+// DigestRepository handles the events and sent periods of the admin digest
+type DigestRepository struct {
+	db *sql.DB
+}
+
+// NewDigestRepository creates a new digest repository
+func NewDigestRepository(db *sql.DB) *DigestRepository {
+	return &DigestRepository{db: db}
+}
+
+// RecordEvent stores one event stamped with the current UTC time
+func (r *DigestRepository) RecordEvent(ctx context.Context, kind models.DigestEvent) error {
+	query := `INSERT INTO digest_events (kind, created_at) VALUES ($1, $2)`
+
+	if _, err := r.db.ExecContext(ctx, query, kind, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to record digest event: %w", err)
+	}
+	return nil
+}
+
+// CountEvents counts the events of each kind recorded in [from, to)
+func (r *DigestRepository) CountEvents(ctx context.Context, from, to time.Time) (map[models.DigestEvent]int, error) {
+	query := `
+		SELECT kind, COUNT(*)
+		FROM digest_events
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY kind
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to count digest events: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[models.DigestEvent]int)
+	for rows.Next() {
+		var kind models.DigestEvent
+		var count int
+		if err := rows.Scan(&kind, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan digest event count: %w", err)
+		}
+		counts[kind] = count
+	}
+	return counts, rows.Err()
+}
+
+// PurgeEventsBefore deletes events recorded before cutoff
+func (r *DigestRepository) PurgeEventsBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM digest_events WHERE created_at < $1`, cutoff.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge digest events: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// ClaimDigest inserts the period; the primary key lets exactly one
+// instance claim it
+func (r *DigestRepository) ClaimDigest(ctx context.Context, period string) (bool, error) {
+	query := `
+		INSERT INTO digest_runs (period, sent_at)
+		VALUES ($1, $2)
+		ON CONFLICT (period) DO NOTHING
+	`
+
+	result, err := r.db.ExecContext(ctx, query, period, time.Now().UTC())
+	if err != nil {
+		return false, fmt.Errorf("failed to claim digest: %w", err)
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim digest: %w", err)
+	}
+	return claimed == 1, nil
+}
+
+// ReleaseDigest deletes the claim of a period
+func (r *DigestRepository) ReleaseDigest(ctx context.Context, period string) error {
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM digest_runs WHERE period = $1`, period); err != nil {
+		return fmt.Errorf("failed to release digest: %w", err)
+	}
+	return nil
+}
+
+// Ensure DigestRepository satisfies the persistence interface
+var _ persistence.DigestStore = (*DigestRepository)(nil)
@@ -3,53 +3,95 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/lib/pq"
+	"github.com/milkiss/vanish/backend/internal/columncrypt"
 	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
 )
 
+// likeEscaper escapes the LIKE wildcards of a search term, so "50%" and
+// "a_b" match literally (backslash is the default LIKE escape)
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
 // MetadataRepository handles message metadata operations
 type MetadataRepository struct {
-	db *sql.DB
+	db   *sql.DB
+	keys *columncrypt.Keyring // encrypts encryption_key at rest; nil stores it in plaintext
 }
 
 // NewMetadataRepository creates a new metadata repository
-func NewMetadataRepository(db *sql.DB) *MetadataRepository {
-	return &MetadataRepository{db: db}
+// keys may be nil to store encryption keys without column encryption
+func NewMetadataRepository(db *sql.DB, keys *columncrypt.Keyring) *MetadataRepository {
+	return &MetadataRepository{db: db, keys: keys}
 }
 
 // Create creates a new message metadata record
 func (r *MetadataRepository) Create(ctx context.Context, metadata *models.MessageMetadata) error {
+	encryptionKey, err := r.keys.Encrypt(metadata.EncryptionKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt key: %w", err)
+	}
+	if metadata.SenderType == "" {
+		metadata.SenderType = models.SenderTypeUser
+	}
+	if metadata.CreatedVia == "" {
+		metadata.CreatedVia = models.ClientAPI
+	}
+
 	query := `
-		INSERT INTO message_metadata (message_id, sender_id, recipient_id, encryption_key, status, created_at, expires_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO message_metadata (message_id, sender_id, recipient_id, encryption_key, sealed_key, status, created_at, expires_at, sender_type, integration_name, available_at, created_via, category, external_recipient_email)
+		VALUES ($1, $2, NULLIF($3::integer, 0), $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
 		RETURNING id
 	`
 
-	err := r.db.QueryRowContext(ctx, query,
+	err = r.db.QueryRowContext(ctx, query,
 		metadata.MessageID,
 		metadata.SenderID,
 		metadata.RecipientID,
-		metadata.EncryptionKey,
+		sql.NullString{String: encryptionKey, Valid: encryptionKey != ""},
+		sql.NullString{String: metadata.SealedKey, Valid: metadata.SealedKey != ""},
 		metadata.Status,
 		metadata.CreatedAt,
 		metadata.ExpiresAt,
+		metadata.SenderType,
+		metadata.IntegrationName,
+		metadata.AvailableAt,
+		metadata.CreatedVia,
+		metadata.Category,
+		metadata.ExternalRecipientEmail,
 	).Scan(&metadata.ID)
 
 	if err != nil {
+		if duplicateMessageID(err) {
+			return models.ErrDuplicateMessageID
+		}
 		return fmt.Errorf("failed to create metadata: %w", err)
 	}
 
 	return nil
 }
 
+// duplicateMessageID reports whether err is a violation of the unique
+// message_id column. Metadata outlives the payload, so a fresh ID that was
+// free in Redis can still belong to an old message's history
+func duplicateMessageID(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "message_metadata_message_id_key"
+}
+
 // FindByMessageID finds metadata by message ID
 func (r *MetadataRepository) FindByMessageID(ctx context.Context, messageID string) (*models.MessageMetadata, error) {
 	query := `
-		SELECT id, message_id, sender_id, recipient_id, status, created_at, read_at, expires_at
-		FROM message_metadata
-		WHERE message_id = $1
+		SELECT m.id, m.message_id, m.sender_id, COALESCE(m.recipient_id, 0), m.status, m.created_at, m.read_at, m.expires_at,
+			m.sender_type, m.integration_name, m.created_via, m.available_at, m.category, m.external_recipient_email, COALESCE(sender.name, '')
+		FROM message_metadata m
+		LEFT JOIN users sender ON m.sender_id = sender.id
+		WHERE m.message_id = $1
 	`
 
 	metadata := &models.MessageMetadata{}
@@ -62,6 +104,13 @@ func (r *MetadataRepository) FindByMessageID(ctx context.Context, messageID stri
 		&metadata.CreatedAt,
 		&metadata.ReadAt,
 		&metadata.ExpiresAt,
+		&metadata.SenderType,
+		&metadata.IntegrationName,
+		&metadata.CreatedVia,
+		&metadata.AvailableAt,
+		&metadata.Category,
+		&metadata.ExternalRecipientEmail,
+		&metadata.SenderName,
 	)
 
 	if err == sql.ErrNoRows {
@@ -74,6 +123,29 @@ func (r *MetadataRepository) FindByMessageID(ctx context.Context, messageID stri
 	return metadata, nil
 }
 
+// GetEncryptionKey returns the decrypted link key stored for a message
+func (r *MetadataRepository) GetEncryptionKey(ctx context.Context, messageID string) (string, error) {
+	query := `SELECT encryption_key FROM message_metadata WHERE message_id = $1`
+
+	var encryptionKey sql.NullString
+	err := r.db.QueryRowContext(ctx, query, messageID).Scan(&encryptionKey)
+	if err == sql.ErrNoRows {
+		return "", models.ErrMessageNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to find encryption key: %w", err)
+	}
+	if !encryptionKey.Valid || encryptionKey.String == "" {
+		return "", nil
+	}
+
+	key, err := r.keys.Decrypt(encryptionKey.String)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt key of %s: %w", messageID, err)
+	}
+	return key, nil
+}
+
 // MarkAsRead marks a message as read
 func (r *MetadataRepository) MarkAsRead(ctx context.Context, messageID string) error {
 	query := `
@@ -98,44 +170,102 @@ func (r *MetadataRepository) MarkAsRead(ctx context.Context, messageID string) e
 	return nil
 }
 
-// GetUserHistory returns message history for a user (sent or received)
-func (r *MetadataRepository) GetUserHistory(ctx context.Context, userID int64, limit int) ([]*models.MessageHistoryResponse, error) {
+// MarkAsClaimed moves a pending message to claimed and sets its expiry to
+// when the claim lapses. Already-claimed rows match too, so repeat claims
+// stay idempotent
+func (r *MetadataRepository) MarkAsClaimed(ctx context.Context, messageID string, lapsesAt time.Time) error {
 	query := `
+		UPDATE message_metadata
+		SET status = $1, expires_at = $4
+		WHERE message_id = $2 AND status IN ($3, $1)
+	`
+
+	result, err := r.db.ExecContext(ctx, query, models.StatusClaimed, messageID, models.StatusPending, lapsesAt)
+	if err != nil {
+		return fmt.Errorf("failed to mark as claimed: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrMessageNotFound
+	}
+
+	return nil
+}
+
+// GetUserHistory returns message history for a user (sent or received)
+// A cursor page seeks on the (sender_id, created_at, id) and
+// (recipient_id, created_at, id) indexes instead of counting off rows.
+// The search is ANDed after the sender/recipient condition and only looks
+// at the other party of each row, so it cannot reach anyone else's
+// messages; the trigram indexes serve its ILIKEs
+func (r *MetadataRepository) GetUserHistory(ctx context.Context, userID int64, search string, page models.Page) ([]*models.MessageHistoryResponse, error) {
+	args := []interface{}{userID}
+	filter := ""
+	if page.After != nil {
+		args = append(args, page.After.Time.UTC(), page.After.ID)
+		filter = "AND (m.created_at, m.id) < ($2, $3)"
+	}
+	if search != "" {
+		args = append(args, "%"+likeEscaper.Replace(search)+"%")
+		n := len(args)
+		filter += fmt.Sprintf(`
+			AND (m.category ILIKE $%[1]d
+				OR (m.sender_id = $1 AND (recipient.name ILIKE $%[1]d OR recipient.email ILIKE $%[1]d OR m.external_recipient_email ILIKE $%[1]d))
+				OR (m.recipient_id = $1 AND (sender.name ILIKE $%[1]d OR sender.email ILIKE $%[1]d)))`, n)
+	}
+	args = append(args, page.Limit, page.Offset)
+	query := fmt.Sprintf(`
 		SELECT
+			m.id,
 			m.message_id,
-			sender.name as sender_name,
-			recipient.name as recipient_name,
+			COALESCE(sender.name, ''),
+			COALESCE(recipient.name, NULLIF(m.external_recipient_email, ''), ''),
+			sender.email,
+			COALESCE(recipient.email, NULLIF(m.external_recipient_email, '')),
 			m.status,
 			m.created_at,
 			m.read_at,
 			m.expires_at,
 			m.sender_id,
-			m.recipient_id,
-			m.encryption_key
+			COALESCE(m.recipient_id, 0),
+			m.encryption_key,
+			m.sealed_key,
+			m.sender_type,
+			m.integration_name,
+			m.created_via,
+			m.available_at,
+			m.category
 		FROM message_metadata m
-		JOIN users sender ON m.sender_id = sender.id
-		JOIN users recipient ON m.recipient_id = recipient.id
-		WHERE m.sender_id = $1 OR m.recipient_id = $1
-		ORDER BY m.created_at DESC
-		LIMIT $2
-	`
+		LEFT JOIN users sender ON m.sender_id = sender.id
+		LEFT JOIN users recipient ON m.recipient_id = recipient.id
+		WHERE (m.sender_id = $1 OR m.recipient_id = $1) %s
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT $%d OFFSET $%d
+	`, filter, len(args)-1, len(args))
 
-	rows, err := r.db.QueryContext(ctx, query, userID, limit)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get history: %w", err)
 	}
 	defer rows.Close()
 
-	var history []*models.MessageHistoryResponse
+	history := []*models.MessageHistoryResponse{}
 	for rows.Next() {
 		h := &models.MessageHistoryResponse{}
 		var senderID, recipientID int64
-		var encryptionKey sql.NullString
+		var senderEmail, recipientEmail, encryptionKey, sealedKey sql.NullString
 
 		err := rows.Scan(
+			&h.ID,
 			&h.MessageID,
 			&h.SenderName,
 			&h.RecipientName,
+			&senderEmail,
+			&recipientEmail,
 			&h.Status,
 			&h.CreatedAt,
 			&h.ReadAt,
@@ -143,6 +273,12 @@ func (r *MetadataRepository) GetUserHistory(ctx context.Context, userID int64, l
 			&senderID,
 			&recipientID,
 			&encryptionKey,
+			&sealedKey,
+			&h.SenderType,
+			&h.IntegrationName,
+			&h.CreatedVia,
+			&h.AvailableAt,
+			&h.Category,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan history: %w", err)
@@ -150,35 +286,568 @@ func (r *MetadataRepository) GetUserHistory(ctx context.Context, userID int64, l
 
 		h.IsSender = senderID == userID
 		h.IsRecipient = recipientID == userID
+		h.KeyRetained = (encryptionKey.Valid && encryptionKey.String != "") || (sealedKey.Valid && sealedKey.String != "")
 
-		// Only include encryption key for recipients with pending messages
-		if h.IsRecipient && h.Status == models.StatusPending && encryptionKey.Valid {
-			h.EncryptionKey = encryptionKey.String
+		// Only include the key for recipients with pending messages
+		if h.IsRecipient && h.Status == models.StatusPending {
+			h.SealedKey = sealedKey.String
+			if encryptionKey.Valid && encryptionKey.String != "" {
+				h.EncryptionKey, err = r.keys.Decrypt(encryptionKey.String)
+				if err != nil {
+					return nil, fmt.Errorf("failed to decrypt key of %s: %w", h.MessageID, err)
+				}
+			}
 		}
 
+		// A missing user row or a tombstone both mean the account was deleted
+		h.MarkDeletedParties(
+			!senderEmail.Valid || models.IsTombstoneEmail(senderEmail.String),
+			!recipientEmail.Valid || models.IsTombstoneEmail(recipientEmail.String))
+		h.SenderLabel = models.SenderLabel(h.SenderName, h.SenderType, h.IntegrationName)
+
 		history = append(history, h)
 	}
 
 	return history, nil
 }
 
+// ListUserMessages returns a page of a user's sent and received messages
+// It pages by ID so rows created mid-export neither repeat nor shift pages,
+// and never selects the encryption key
+func (r *MetadataRepository) ListUserMessages(ctx context.Context, userID, afterID int64, limit int) ([]*models.MessageMetadata, error) {
+	query := `
+		SELECT m.id, m.message_id, m.sender_id, COALESCE(m.recipient_id, 0), m.status, m.created_at, m.read_at, m.expires_at,
+			m.sender_type, m.integration_name, m.created_via, m.external_recipient_email, COALESCE(sender.name, ''), COALESCE(recipient.name, '')
+		FROM message_metadata m
+		LEFT JOIN users sender ON m.sender_id = sender.id
+		LEFT JOIN users recipient ON m.recipient_id = recipient.id
+		WHERE (m.sender_id = $1 OR m.recipient_id = $1) AND m.id > $2
+		ORDER BY m.id
+		LIMIT $3
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []*models.MessageMetadata{}
+	for rows.Next() {
+		m := &models.MessageMetadata{}
+		err := rows.Scan(
+			&m.ID,
+			&m.MessageID,
+			&m.SenderID,
+			&m.RecipientID,
+			&m.Status,
+			&m.CreatedAt,
+			&m.ReadAt,
+			&m.ExpiresAt,
+			&m.SenderType,
+			&m.IntegrationName,
+			&m.CreatedVia,
+			&m.ExternalRecipientEmail,
+			&m.SenderName,
+			&m.RecipientName,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+// ListInbox returns the messages waiting for a recipient, leaving out
+// scheduled messages until they are released
+// Served by the partial (recipient_id, expires_at, id) index on pending rows
+func (r *MetadataRepository) ListInbox(ctx context.Context, recipientID int64, page models.Page) ([]*models.MessageMetadata, error) {
+	args := []interface{}{recipientID, models.StatusPending}
+	after := ""
+	if page.After != nil {
+		args = append(args, page.After.Time.UTC(), page.After.ID)
+		after = "AND (m.expires_at, m.id) > ($3, $4)"
+	}
+	args = append(args, page.Limit, page.Offset)
+	query := fmt.Sprintf(`
+		SELECT m.id, m.message_id, m.sender_id, m.recipient_id, m.status, m.created_at, m.expires_at,
+			m.encryption_key, m.sealed_key, m.sender_type, m.integration_name, m.created_via, COALESCE(sender.name, '')
+		FROM message_metadata m
+		LEFT JOIN users sender ON m.sender_id = sender.id
+		WHERE m.recipient_id = $1 AND m.status = $2 AND m.expires_at > NOW()
+			AND (m.available_at IS NULL OR m.available_at <= NOW()) %s
+		ORDER BY m.expires_at, m.id
+		LIMIT $%d OFFSET $%d
+	`, after, len(args)-1, len(args))
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list inbox: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []*models.MessageMetadata{}
+	for rows.Next() {
+		m := &models.MessageMetadata{}
+		var encryptionKey, sealedKey sql.NullString
+		err := rows.Scan(
+			&m.ID,
+			&m.MessageID,
+			&m.SenderID,
+			&m.RecipientID,
+			&m.Status,
+			&m.CreatedAt,
+			&m.ExpiresAt,
+			&encryptionKey,
+			&sealedKey,
+			&m.SenderType,
+			&m.IntegrationName,
+			&m.CreatedVia,
+			&m.SenderName,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan inbox message: %w", err)
+		}
+
+		m.SealedKey = sealedKey.String
+		if encryptionKey.Valid && encryptionKey.String != "" {
+			m.EncryptionKey, err = r.keys.Decrypt(encryptionKey.String)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decrypt key of %s: %w", m.MessageID, err)
+			}
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+// CountPendingForRecipient counts unexpired pending messages for a recipient
+// Served by the (recipient_id, status) index
+func (r *MetadataRepository) CountPendingForRecipient(ctx context.Context, recipientID int64) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM message_metadata
+		WHERE recipient_id = $1 AND status = $2 AND expires_at > NOW()
+	`
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, recipientID, models.StatusPending).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count pending messages: %w", err)
+	}
+
+	return count, nil
+}
+
+// CountRecipientsWithPending counts the recipients with at least atLeast
+// unexpired pending messages
+func (r *MetadataRepository) CountRecipientsWithPending(ctx context.Context, atLeast int) (int, error) {
+	query := `
+		SELECT COUNT(*) FROM (
+			SELECT recipient_id
+			FROM message_metadata
+			WHERE status = $1 AND expires_at > NOW() AND recipient_id IS NOT NULL
+			GROUP BY recipient_id
+			HAVING COUNT(*) >= $2
+		) AS busy
+	`
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, models.StatusPending, atLeast).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count recipients with pending messages: %w", err)
+	}
+
+	return count, nil
+}
+
+// ExpirePendingForRecipient expires the given messages the user still has pending
+// Rows that belong to someone else or are no longer pending are left alone
+func (r *MetadataRepository) ExpirePendingForRecipient(ctx context.Context, recipientID int64, messageIDs []string) ([]string, error) {
+	query := `
+		UPDATE message_metadata
+		SET status = $1, encryption_key = NULL, sealed_key = NULL
+		WHERE recipient_id = $2 AND status = $3 AND message_id = ANY($4)
+		RETURNING message_id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, models.StatusExpired, recipientID, models.StatusPending, pq.Array(messageIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire messages: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan message ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// RevokeMessage expires an open message at its sender's request
+// Stored keys are cleared so the link cannot be rebuilt from history
+func (r *MetadataRepository) RevokeMessage(ctx context.Context, senderID int64, messageID string) error {
+	query := `
+		UPDATE message_metadata
+		SET status = $1, encryption_key = NULL, sealed_key = NULL
+		WHERE message_id = $2 AND sender_id = $3 AND status IN ($4, $5)
+	`
+
+	result, err := r.db.ExecContext(ctx, query, models.StatusExpired, messageID, senderID, models.StatusPending, models.StatusClaimed)
+	if err != nil {
+		return fmt.Errorf("failed to revoke message: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrMessageNotFound
+	}
+
+	return nil
+}
+
+// ExpireUserMessages expires a user's open messages in both directions
+// Stored keys are cleared so the links cannot be rebuilt from history
+func (r *MetadataRepository) ExpireUserMessages(ctx context.Context, userID int64) ([]string, error) {
+	query := `
+		UPDATE message_metadata
+		SET status = $1, encryption_key = NULL, sealed_key = NULL
+		WHERE (sender_id = $2 OR recipient_id = $2) AND status IN ($3, $4)
+		RETURNING message_id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, models.StatusExpired, userID, models.StatusPending, models.StatusClaimed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire messages: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan message ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// statisticsColumns maps each metric to the timestamp it is bucketed by and
+// any extra filter. Only these constants are ever interpolated into SQL
+var statisticsColumns = map[models.StatisticsMetric]struct{ column, filter string }{
+	models.MetricCreated: {"created_at", ""},
+	models.MetricRead:    {"read_at", ""},
+	models.MetricExpired: {"expires_at", "AND status = 'expired'"},
+}
+
+// CountByBucket counts messages per UTC day or week
+// Timestamps are stored as UTC without a zone, so date_trunc needs no
+// conversion, and the range filter can use the column's index
+func (r *MetadataRepository) CountByBucket(ctx context.Context, metric models.StatisticsMetric, interval models.StatisticsInterval, from, to time.Time) ([]models.TimeSeriesPoint, error) {
+	col, ok := statisticsColumns[metric]
+	if !ok || !interval.Valid() {
+		return nil, models.ErrInvalidStatisticsQuery
+	}
+
+	query := fmt.Sprintf(`
+		SELECT date_trunc($1, %[1]s) AS bucket, COUNT(*)
+		FROM message_metadata
+		WHERE %[1]s >= $2 AND %[1]s < $3 %[2]s
+		GROUP BY bucket
+		ORDER BY bucket
+	`, col.column, col.filter)
+
+	rows, err := r.db.QueryContext(ctx, query, string(interval), from.UTC(), to.UTC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to count messages: %w", err)
+	}
+	defer rows.Close()
+
+	points := []models.TimeSeriesPoint{}
+	for rows.Next() {
+		var p models.TimeSeriesPoint
+		if err := rows.Scan(&p.Bucket, &p.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan bucket: %w", err)
+		}
+		// Zoneless timestamps are scanned with a zero-offset zone; they are UTC
+		p.Bucket = p.Bucket.UTC()
+		points = append(points, p)
+	}
+
+	return points, rows.Err()
+}
+
+// TopSenders returns the users who created the most messages in a range
+func (r *MetadataRepository) TopSenders(ctx context.Context, from, to time.Time, limit int) ([]models.LeaderboardEntry, error) {
+	return r.topUsers(ctx, "sender_id", from, to, limit)
+}
+
+// TopRecipients returns the users who received the most messages in a range
+func (r *MetadataRepository) TopRecipients(ctx context.Context, from, to time.Time, limit int) ([]models.LeaderboardEntry, error) {
+	return r.topUsers(ctx, "recipient_id", from, to, limit)
+}
+
+// topUsers ranks users by messages created in [from, to), grouped by column
+func (r *MetadataRepository) topUsers(ctx context.Context, column string, from, to time.Time, limit int) ([]models.LeaderboardEntry, error) {
+	query := fmt.Sprintf(`
+		SELECT u.id, u.name, COUNT(*) AS messages
+		FROM message_metadata m
+		JOIN users u ON u.id = m.%s
+		WHERE m.created_at >= $1 AND m.created_at < $2
+		GROUP BY u.id, u.name
+		ORDER BY messages DESC, u.id
+		LIMIT $3
+	`, column)
+
+	rows, err := r.db.QueryContext(ctx, query, from.UTC(), to.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rank users: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.LeaderboardEntry{}
+	for rows.Next() {
+		var e models.LeaderboardEntry
+		if err := rows.Scan(&e.UserID, &e.Name, &e.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan leaderboard: %w", err)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
+}
+
 // CleanupExpired marks expired messages as expired (called by cron job)
-func (r *MetadataRepository) CleanupExpired(ctx context.Context) (int64, error) {
+// and returns their message IDs
+func (r *MetadataRepository) CleanupExpired(ctx context.Context) ([]string, error) {
 	query := `
 		UPDATE message_metadata
 		SET status = $1
-		WHERE status = $2 AND expires_at < NOW()
+		WHERE status IN ($2, $3) AND expires_at < NOW()
+		RETURNING message_id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, models.StatusExpired, models.StatusPending, models.StatusClaimed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cleanup expired: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan expired message: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// ListPending returns pending messages after afterID, oldest first
+func (r *MetadataRepository) ListPending(ctx context.Context, afterID int64, limit int) ([]*models.MessageMetadata, error) {
+	query := `
+		SELECT id, message_id, sender_id, COALESCE(recipient_id, 0), status, created_at, read_at, expires_at
+		FROM message_metadata
+		WHERE status = $1 AND id > $2
+		ORDER BY id
+		LIMIT $3
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, models.StatusPending, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending messages: %w", err)
+	}
+	defer rows.Close()
+
+	messages := []*models.MessageMetadata{}
+	for rows.Next() {
+		m := &models.MessageMetadata{}
+		err := rows.Scan(
+			&m.ID,
+			&m.MessageID,
+			&m.SenderID,
+			&m.RecipientID,
+			&m.Status,
+			&m.CreatedAt,
+			&m.ReadAt,
+			&m.ExpiresAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan message: %w", err)
+		}
+		messages = append(messages, m)
+	}
+
+	return messages, rows.Err()
+}
+
+// UpdateExpiresAt corrects the expiry recorded for a message
+func (r *MetadataRepository) UpdateExpiresAt(ctx context.Context, messageID string, expiresAt time.Time) error {
+	query := `
+		UPDATE message_metadata
+		SET expires_at = $1
+		WHERE message_id = $2
 	`
 
-	result, err := r.db.ExecContext(ctx, query, models.StatusExpired, models.StatusPending)
+	result, err := r.db.ExecContext(ctx, query, expiresAt, messageID)
 	if err != nil {
-		return 0, fmt.Errorf("failed to cleanup expired: %w", err)
+		return fmt.Errorf("failed to update expiry: %w", err)
 	}
 
 	rows, err := result.RowsAffected()
 	if err != nil {
-		return 0, err
+		return err
+	}
+	if rows == 0 {
+		return models.ErrMessageNotFound
 	}
 
-	return rows, nil
+	return nil
+}
+
+// ScheduleNotification stores a notification to send when its message is
+// released; a second request for the same message and channel is ignored
+func (r *MetadataRepository) ScheduleNotification(ctx context.Context, n *models.ScheduledNotification) error {
+	query := `
+		INSERT INTO scheduled_notifications (message_id, channel, sender_label, send_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (message_id, channel) DO NOTHING
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, n.MessageID, n.Channel, n.SenderLabel, n.SendAt); err != nil {
+		return fmt.Errorf("failed to schedule notification: %w", err)
+	}
+	return nil
 }
+
+// TakeDueNotifications removes and returns up to limit notifications due at
+// now. SKIP LOCKED lets several instances dispatch without sending twice
+func (r *MetadataRepository) TakeDueNotifications(ctx context.Context, now time.Time, limit int) ([]*models.ScheduledNotification, error) {
+	query := `
+		DELETE FROM scheduled_notifications
+		WHERE id IN (
+			SELECT id FROM scheduled_notifications
+			WHERE send_at <= $1
+			ORDER BY send_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, message_id, channel, sender_label, send_at
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to take due notifications: %w", err)
+	}
+	defer rows.Close()
+
+	due := []*models.ScheduledNotification{}
+	for rows.Next() {
+		n := &models.ScheduledNotification{}
+		if err := rows.Scan(&n.ID, &n.MessageID, &n.Channel, &n.SenderLabel, &n.SendAt); err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		due = append(due, n)
+	}
+
+	return due, rows.Err()
+}
+
+// CountDueNotifications counts the scheduled notifications due at now
+func (r *MetadataRepository) CountDueNotifications(ctx context.Context, now time.Time) (int, error) {
+	var count int
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COUNT(*) FROM scheduled_notifications WHERE send_at <= $1`, now).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count due notifications: %w", err)
+	}
+	return count, nil
+}
+
+// reencryptBatchSize is how many rows ReencryptKeys reads per query
+const reencryptBatchSize = 500
+
+// ReencryptKeys seals every stored encryption key under the current master
+// key, covering plaintext rows written before column encryption and rows
+// sealed under an older key. It returns how many rows changed and is safe
+// to run while the server is serving: a row updated concurrently is skipped
+func (r *MetadataRepository) ReencryptKeys(ctx context.Context) (int64, error) {
+	if r.keys == nil {
+		return 0, fmt.Errorf("column encryption is not configured")
+	}
+
+	var updated int64
+	var afterID int64
+	for {
+		rows, err := r.db.QueryContext(ctx, `
+			SELECT id, encryption_key
+			FROM message_metadata
+			WHERE encryption_key IS NOT NULL AND id > $1
+			ORDER BY id
+			LIMIT $2
+		`, afterID, reencryptBatchSize)
+		if err != nil {
+			return updated, fmt.Errorf("failed to list keys: %w", err)
+		}
+
+		type storedKey struct {
+			id    int64
+			value string
+		}
+		var batch []storedKey
+		for rows.Next() {
+			var k storedKey
+			if err := rows.Scan(&k.id, &k.value); err != nil {
+				rows.Close()
+				return updated, fmt.Errorf("failed to scan key: %w", err)
+			}
+			batch = append(batch, k)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return updated, err
+		}
+
+		for _, k := range batch {
+			rotated, changed, err := r.keys.Rotate(k.value)
+			if err != nil {
+				return updated, fmt.Errorf("row %d: %w", k.id, err)
+			}
+			if !changed {
+				continue
+			}
+			result, err := r.db.ExecContext(ctx,
+				`UPDATE message_metadata SET encryption_key = $1 WHERE id = $2 AND encryption_key = $3`,
+				rotated, k.id, k.value)
+			if err != nil {
+				return updated, fmt.Errorf("failed to update key: %w", err)
+			}
+			n, err := result.RowsAffected()
+			if err != nil {
+				return updated, err
+			}
+			updated += n
+		}
+
+		if len(batch) < reencryptBatchSize {
+			return updated, nil
+		}
+		afterID = batch[len(batch)-1].id
+	}
+}
+
+// Ensure MetadataRepository satisfies the persistence interface
+var _ persistence.MetadataStore = (*MetadataRepository)(nil)
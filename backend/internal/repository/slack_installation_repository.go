@@ -0,0 +1,143 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/milkiss/vanish/backend/internal/columncrypt"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+)
+
+// SlackInstallationRepository handles the workspaces the Slack app was
+// installed into
+type SlackInstallationRepository struct {
+	db   *sql.DB
+	keys *columncrypt.Keyring // encrypts bot_token at rest; nil stores it in plaintext
+}
+
+// NewSlackInstallationRepository creates a new Slack installation repository
+// keys may be nil to store bot tokens without column encryption
+func NewSlackInstallationRepository(db *sql.DB, keys *columncrypt.Keyring) *SlackInstallationRepository {
+	return &SlackInstallationRepository{db: db, keys: keys}
+}
+
+// SaveSlackInstallation inserts an installation or, when the app is
+// reinstalled into a workspace, replaces its token and details
+func (r *SlackInstallationRepository) SaveSlackInstallation(ctx context.Context, installation *models.SlackInstallation) error {
+	token, err := r.keys.Encrypt(installation.BotToken)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt bot token: %w", err)
+	}
+
+	query := `
+		INSERT INTO slack_installations (team_id, team_name, bot_user_id, bot_token, scope, installed_by, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
+		ON CONFLICT (team_id) DO UPDATE
+		SET team_name = EXCLUDED.team_name, bot_user_id = EXCLUDED.bot_user_id, bot_token = EXCLUDED.bot_token,
+			scope = EXCLUDED.scope, installed_by = EXCLUDED.installed_by, updated_at = NOW()
+		RETURNING created_at, updated_at
+	`
+
+	err = r.db.QueryRowContext(ctx, query,
+		installation.TeamID,
+		installation.TeamName,
+		installation.BotUserID,
+		token,
+		installation.Scope,
+		installation.InstalledBy,
+	).Scan(&installation.CreatedAt, &installation.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save Slack installation: %w", err)
+	}
+
+	return nil
+}
+
+// FindSlackInstallation returns the installation of a workspace with its
+// bot token decrypted
+func (r *SlackInstallationRepository) FindSlackInstallation(ctx context.Context, teamID string) (*models.SlackInstallation, error) {
+	query := `
+		SELECT team_id, team_name, bot_user_id, bot_token, scope, installed_by, created_at, updated_at
+		FROM slack_installations
+		WHERE team_id = $1
+	`
+
+	installation := &models.SlackInstallation{}
+	err := r.db.QueryRowContext(ctx, query, teamID).Scan(
+		&installation.TeamID,
+		&installation.TeamName,
+		&installation.BotUserID,
+		&installation.BotToken,
+		&installation.Scope,
+		&installation.InstalledBy,
+		&installation.CreatedAt,
+		&installation.UpdatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrSlackNotInstalled
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find Slack installation: %w", err)
+	}
+
+	if installation.BotToken, err = r.keys.Decrypt(installation.BotToken); err != nil {
+		return nil, fmt.Errorf("failed to decrypt bot token: %w", err)
+	}
+	return installation, nil
+}
+
+// ReencryptTokens seals every stored bot token under the current master
+// key, like MetadataRepository.ReencryptKeys. It returns how many rows
+// changed
+func (r *SlackInstallationRepository) ReencryptTokens(ctx context.Context) (int64, error) {
+	if r.keys == nil {
+		return 0, fmt.Errorf("column encryption is not configured")
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT team_id, bot_token FROM slack_installations`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list bot tokens: %w", err)
+	}
+	tokens := make(map[string]string)
+	for rows.Next() {
+		var teamID, token string
+		if err := rows.Scan(&teamID, &token); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan bot token: %w", err)
+		}
+		tokens[teamID] = token
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var updated int64
+	for teamID, token := range tokens {
+		rotated, changed, err := r.keys.Rotate(token)
+		if err != nil {
+			return updated, fmt.Errorf("team %s: %w", teamID, err)
+		}
+		if !changed {
+			continue
+		}
+		// A token replaced by a reinstall meanwhile is skipped
+		result, err := r.db.ExecContext(ctx,
+			`UPDATE slack_installations SET bot_token = $1 WHERE team_id = $2 AND bot_token = $3`,
+			rotated, teamID, token)
+		if err != nil {
+			return updated, fmt.Errorf("failed to update bot token: %w", err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return updated, err
+		}
+		updated += n
+	}
+	return updated, nil
+}
+
+// Ensure SlackInstallationRepository satisfies the persistence interface
+var _ persistence.SlackInstallationStore = (*SlackInstallationRepository)(nil)
@@ -0,0 +1,304 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+)
+
+// TTLPolicyRepository handles the TTL policy rules per recipient domain
+type TTLPolicyRepository struct {
+	db *sql.DB
+}
+
+// NewTTLPolicyRepository creates a new TTL policy repository
+func NewTTLPolicyRepository(db *sql.DB) *TTLPolicyRepository {
+	return &TTLPolicyRepository{db: db}
+}
+
+// ListTTLPolicies returns every rule ordered by position, then ID
+func (r *TTLPolicyRepository) ListTTLPolicies(ctx context.Context) ([]*models.TTLPolicyRule, error) {
+	query := `
+		SELECT id, position, recipient_domain_glob, default_ttl, max_ttl, created_at, updated_at
+		FROM ttl_policy_rules
+		ORDER BY position, id
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list TTL policies: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []*models.TTLPolicyRule{}
+	for rows.Next() {
+		rule := &models.TTLPolicyRule{}
+		if err := rows.Scan(&rule.ID, &rule.Position, &rule.RecipientDomainGlob, &rule.DefaultTTL, &rule.MaxTTL,
+			&rule.CreatedAt, &rule.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan TTL policy: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+// CreateTTLPolicy inserts a rule; without a position it goes after the
+// highest one
+func (r *TTLPolicyRepository) CreateTTLPolicy(ctx context.Context, rule *models.TTLPolicyRule, position *int) error {
+	query := `
+		INSERT INTO ttl_policy_rules (position, recipient_domain_glob, default_ttl, max_ttl, created_at, updated_at)
+		VALUES (COALESCE($1, (SELECT COALESCE(MAX(position) + 1, 0) FROM ttl_policy_rules)), $2, $3, $4, NOW(), NOW())
+		RETURNING id, position, created_at, updated_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query, position, rule.RecipientDomainGlob, rule.DefaultTTL, rule.MaxTTL).
+		Scan(&rule.ID, &rule.Position, &rule.CreatedAt, &rule.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create TTL policy: %w", err)
+	}
+	return nil
+}
+
+// UpdateTTLPolicy replaces the glob and TTLs of rule.ID, and its position
+// when one is given
+func (r *TTLPolicyRepository) UpdateTTLPolicy(ctx context.Context, rule *models.TTLPolicyRule, position *int) error {
+	query := `
+		UPDATE ttl_policy_rules
+		SET position = COALESCE($2, position), recipient_domain_glob = $3, default_ttl = $4, max_ttl = $5, updated_at = NOW()
+		WHERE id = $1
+		RETURNING position, created_at, updated_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query, rule.ID, position, rule.RecipientDomainGlob, rule.DefaultTTL, rule.MaxTTL).
+		Scan(&rule.Position, &rule.CreatedAt, &rule.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return models.ErrTTLPolicyNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update TTL policy: %w", err)
+	}
+	return nil
+}
+
+// DeleteTTLPolicy removes a rule
+func (r *TTLPolicyRepository) DeleteTTLPolicy(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM ttl_policy_rules WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete TTL policy: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrTTLPolicyNotFound
+	}
+	return nil
+}
+
+// ListCategoryPolicies returns every category policy ordered by category
+func (r *TTLPolicyRepository) ListCategoryPolicies(ctx context.Context) ([]*models.CategoryPolicy, error) {
+	query := `
+		SELECT category, default_ttl, max_ttl, notification_style, created_at, updated_at
+		FROM category_policies
+		ORDER BY category
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list category policies: %w", err)
+	}
+	defer rows.Close()
+
+	policies := []*models.CategoryPolicy{}
+	for rows.Next() {
+		policy := &models.CategoryPolicy{}
+		if err := rows.Scan(&policy.Category, &policy.DefaultTTL, &policy.MaxTTL, &policy.NotificationStyle,
+			&policy.CreatedAt, &policy.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan category policy: %w", err)
+		}
+		policies = append(policies, policy)
+	}
+
+	return policies, rows.Err()
+}
+
+// GetCategoryPolicy returns the policy of category
+func (r *TTLPolicyRepository) GetCategoryPolicy(ctx context.Context, category string) (*models.CategoryPolicy, error) {
+	query := `
+		SELECT category, default_ttl, max_ttl, notification_style, created_at, updated_at
+		FROM category_policies
+		WHERE category = $1
+	`
+
+	policy := &models.CategoryPolicy{}
+	err := r.db.QueryRowContext(ctx, query, category).Scan(&policy.Category, &policy.DefaultTTL, &policy.MaxTTL,
+		&policy.NotificationStyle, &policy.CreatedAt, &policy.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrCategoryPolicyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get category policy: %w", err)
+	}
+	return policy, nil
+}
+
+// PutCategoryPolicy upserts the policy of policy.Category. Only a freshly
+// inserted row has no xmax, which tells a create from a replace
+func (r *TTLPolicyRepository) PutCategoryPolicy(ctx context.Context, policy *models.CategoryPolicy) (bool, error) {
+	query := `
+		INSERT INTO category_policies (category, default_ttl, max_ttl, notification_style, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, NOW(), NOW())
+		ON CONFLICT (category) DO UPDATE
+		SET default_ttl = EXCLUDED.default_ttl, max_ttl = EXCLUDED.max_ttl,
+			notification_style = EXCLUDED.notification_style, updated_at = NOW()
+		RETURNING created_at, updated_at, (xmax = 0)
+	`
+
+	var created bool
+	err := r.db.QueryRowContext(ctx, query, policy.Category, policy.DefaultTTL, policy.MaxTTL, policy.NotificationStyle).
+		Scan(&policy.CreatedAt, &policy.UpdatedAt, &created)
+	if err != nil {
+		return false, fmt.Errorf("failed to save category policy: %w", err)
+	}
+	return created, nil
+}
+
+// DeleteCategoryPolicy removes the policy of category
+func (r *TTLPolicyRepository) DeleteCategoryPolicy(ctx context.Context, category string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM category_policies WHERE category = $1`, category)
+	if err != nil {
+		return fmt.Errorf("failed to delete category policy: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrCategoryPolicyNotFound
+	}
+	return nil
+}
+
+// ListBannedDomains returns every banned domain ordered by domain
+func (r *TTLPolicyRepository) ListBannedDomains(ctx context.Context) ([]*models.BannedDomain, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT domain, reason, created_at FROM banned_domains ORDER BY domain`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list banned domains: %w", err)
+	}
+	defer rows.Close()
+
+	domains := []*models.BannedDomain{}
+	for rows.Next() {
+		domain := &models.BannedDomain{}
+		if err := rows.Scan(&domain.Domain, &domain.Reason, &domain.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan banned domain: %w", err)
+		}
+		domains = append(domains, domain)
+	}
+
+	return domains, rows.Err()
+}
+
+// PutBannedDomain upserts the ban of domain.Domain. Only a freshly inserted
+// row has no xmax, which tells a create from a replace
+func (r *TTLPolicyRepository) PutBannedDomain(ctx context.Context, domain *models.BannedDomain) (bool, error) {
+	query := `
+		INSERT INTO banned_domains (domain, reason, created_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (domain) DO UPDATE SET reason = EXCLUDED.reason
+		RETURNING created_at, (xmax = 0)
+	`
+
+	var created bool
+	if err := r.db.QueryRowContext(ctx, query, domain.Domain, domain.Reason).Scan(&domain.CreatedAt, &created); err != nil {
+		return false, fmt.Errorf("failed to save banned domain: %w", err)
+	}
+	return created, nil
+}
+
+// DeleteBannedDomain lifts the ban of domain
+func (r *TTLPolicyRepository) DeleteBannedDomain(ctx context.Context, domain string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM banned_domains WHERE domain = $1`, domain)
+	if err != nil {
+		return fmt.Errorf("failed to delete banned domain: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrBannedDomainNotFound
+	}
+	return nil
+}
+
+// ListDLPPatterns returns every DLP pattern ordered by name
+func (r *TTLPolicyRepository) ListDLPPatterns(ctx context.Context) ([]*models.DLPPattern, error) {
+	query := `
+		SELECT name, pattern, description, created_at, updated_at
+		FROM dlp_patterns
+		ORDER BY name
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list DLP patterns: %w", err)
+	}
+	defer rows.Close()
+
+	patterns := []*models.DLPPattern{}
+	for rows.Next() {
+		pattern := &models.DLPPattern{}
+		if err := rows.Scan(&pattern.Name, &pattern.Pattern, &pattern.Description,
+			&pattern.CreatedAt, &pattern.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan DLP pattern: %w", err)
+		}
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, rows.Err()
+}
+
+// PutDLPPattern upserts the pattern named pattern.Name, telling a create
+// from a replace like PutCategoryPolicy
+func (r *TTLPolicyRepository) PutDLPPattern(ctx context.Context, pattern *models.DLPPattern) (bool, error) {
+	query := `
+		INSERT INTO dlp_patterns (name, pattern, description, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		ON CONFLICT (name) DO UPDATE
+		SET pattern = EXCLUDED.pattern, description = EXCLUDED.description, updated_at = NOW()
+		RETURNING created_at, updated_at, (xmax = 0)
+	`
+
+	var created bool
+	err := r.db.QueryRowContext(ctx, query, pattern.Name, pattern.Pattern, pattern.Description).
+		Scan(&pattern.CreatedAt, &pattern.UpdatedAt, &created)
+	if err != nil {
+		return false, fmt.Errorf("failed to save DLP pattern: %w", err)
+	}
+	return created, nil
+}
+
+// DeleteDLPPattern removes the pattern named name
+func (r *TTLPolicyRepository) DeleteDLPPattern(ctx context.Context, name string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM dlp_patterns WHERE name = $1`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete DLP pattern: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrDLPPatternNotFound
+	}
+	return nil
+}
+
+// Ensure TTLPolicyRepository satisfies the persistence interface
+var _ persistence.TTLPolicyStore = (*TTLPolicyRepository)(nil)
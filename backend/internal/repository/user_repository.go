@@ -3,9 +3,13 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/lib/pq"
 	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
 )
 
 // UserRepository handles user database operations
@@ -21,17 +25,16 @@ func NewUserRepository(db *sql.DB) *UserRepository {
 // Create creates a new user
 func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 	query := `
-		INSERT INTO users (email, name, password_hash, is_admin, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, NOW(), NOW())
-		RETURNING id, created_at, updated_at
+		INSERT INTO users (email, name, password_hash, is_admin, is_service, auth_source, region, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW())
+		RETURNING id, is_active, auth_source, created_at, updated_at
 	`
 
-	err := r.db.QueryRowContext(ctx, query, user.Email, user.Name, user.Password, user.IsAdmin).
-		Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
+	err := r.db.QueryRowContext(ctx, query, user.Email, user.Name, user.Password, user.IsAdmin, user.IsService, authSource(user), user.Region).
+		Scan(&user.ID, &user.IsActive, &user.AuthSource, &user.CreatedAt, &user.UpdatedAt)
 
 	if err != nil {
-		// Check for unique constraint violation
-		if err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"` {
+		if duplicateEmail(err) {
 			return models.ErrUserExists
 		}
 		return fmt.Errorf("failed to create user: %w", err)
@@ -40,18 +43,31 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 	return nil
 }
 
-// FindByEmail finds a user by email
+// duplicateEmail reports whether err is a violation of the unique email
+// column or of the unique index on its lowercased form
+func duplicateEmail(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) || pqErr.Code != "23505" {
+		return false
+	}
+	return pqErr.Constraint == "users_email_key" || pqErr.Constraint == "idx_users_email_lower"
+}
+
+// FindByEmail finds a user by email, ignoring case. Should accounts from
+// before emails were normalized differ only in case, the oldest is returned
 func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-		SELECT id, email, name, password_hash, is_admin, created_at, updated_at
+		SELECT id, email, name, password_hash, is_admin, is_active, is_service, auth_source, region, last_login, created_at, updated_at
 		FROM users
-		WHERE email = $1
+		WHERE LOWER(email) = LOWER($1)
+		ORDER BY id ASC
+		LIMIT 1
 	`
 
 	user := &models.User{}
 	err := r.db.QueryRowContext(ctx, query, email).Scan(
-		&user.ID, &user.Email, &user.Name, &user.Password, &user.IsAdmin,
-		&user.CreatedAt, &user.UpdatedAt,
+		&user.ID, &user.Email, &user.Name, &user.Password, &user.IsAdmin, &user.IsActive, &user.IsService, &user.AuthSource, &user.Region,
+		&user.LastLogin, &user.CreatedAt, &user.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -67,19 +83,19 @@ func (r *UserRepository) FindByEmail(ctx context.Context, email string) (*models
 // FindByID finds a user by ID
 func (r *UserRepository) FindByID(ctx context.Context, id int64) (*models.User, error) {
 	query := `
-		SELECT id, email, name, password_hash, is_admin, created_at, updated_at
+		SELECT id, email, name, password_hash, is_admin, is_active, is_service, auth_source, region, last_login, created_at, updated_at
 		FROM users
 		WHERE id = $1
 	`
 
 	user := &models.User{}
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&user.ID, &user.Email, &user.Name, &user.Password, &user.IsAdmin,
-		&user.CreatedAt, &user.UpdatedAt,
+		&user.ID, &user.Email, &user.Name, &user.Password, &user.IsAdmin, &user.IsActive, &user.IsService, &user.AuthSource, &user.Region,
+		&user.LastLogin, &user.CreatedAt, &user.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("user not found")
+		return nil, models.ErrUserNotFound
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to find user: %w", err)
@@ -89,10 +105,12 @@ func (r *UserRepository) FindByID(ctx context.Context, id int64) (*models.User,
 }
 
 // ListAll returns all users (for recipient selection)
+// Service accounts cannot read messages, so they are left out
 func (r *UserRepository) ListAll(ctx context.Context) ([]*models.UserInfo, error) {
 	query := `
-		SELECT id, email, name, is_admin
+		SELECT id, email, name, is_admin, COALESCE(public_key, '')
 		FROM users
+		WHERE is_active AND NOT is_service
 		ORDER BY name ASC
 	`
 
@@ -102,10 +120,104 @@ func (r *UserRepository) ListAll(ctx context.Context) ([]*models.UserInfo, error
 	}
 	defer rows.Close()
 
-	var users []*models.UserInfo
+	users := []*models.UserInfo{}
 	for rows.Next() {
 		user := &models.UserInfo{}
-		if err := rows.Scan(&user.ID, &user.Email, &user.Name, &user.IsAdmin); err != nil {
+		if err := rows.Scan(&user.ID, &user.Email, &user.Name, &user.IsAdmin, &user.PublicKey); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// ListAccounts returns every regular account, deactivated ones included,
+// for provisioning. Tombstones are recognized by their reserved email domain
+func (r *UserRepository) ListAccounts(ctx context.Context) ([]*models.User, error) {
+	query := `
+		SELECT id, email, name, password_hash, is_admin, is_active, is_service, auth_source, region, last_login, created_at, updated_at
+		FROM users
+		WHERE NOT is_service AND email NOT LIKE '%@deleted.invalid'
+		ORDER BY id ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list accounts: %w", err)
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		user := &models.User{}
+		if err := rows.Scan(
+			&user.ID, &user.Email, &user.Name, &user.Password, &user.IsAdmin, &user.IsActive, &user.IsService, &user.AuthSource, &user.Region,
+			&user.LastLogin, &user.CreatedAt, &user.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// ListInactive returns the regular accounts that never signed in or last
+// did before cutoff, deactivated ones included
+func (r *UserRepository) ListInactive(ctx context.Context, cutoff time.Time) ([]*models.User, error) {
+	query := `
+		SELECT id, email, name, password_hash, is_admin, is_active, is_service, auth_source, region, last_login, created_at, updated_at
+		FROM users
+		WHERE NOT is_service AND email NOT LIKE '%@deleted.invalid'
+		  AND (last_login IS NULL OR last_login < $1)
+		ORDER BY id ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list inactive accounts: %w", err)
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		user := &models.User{}
+		if err := rows.Scan(
+			&user.ID, &user.Email, &user.Name, &user.Password, &user.IsAdmin, &user.IsActive, &user.IsService, &user.AuthSource, &user.Region,
+			&user.LastLogin, &user.CreatedAt, &user.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// ListEmailDuplicates returns the accounts whose emails differ only in
+// case, grouped by lowercased email and ordered by ID within each group
+func (r *UserRepository) ListEmailDuplicates(ctx context.Context) ([]*models.User, error) {
+	query := `
+		SELECT id, email, name, password_hash, is_admin, is_active, is_service, auth_source, region, last_login, created_at, updated_at
+		FROM users
+		WHERE LOWER(email) IN (SELECT LOWER(email) FROM users GROUP BY LOWER(email) HAVING COUNT(*) > 1)
+		ORDER BY LOWER(email) ASC, id ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list duplicate accounts: %w", err)
+	}
+	defer rows.Close()
+
+	users := []*models.User{}
+	for rows.Next() {
+		user := &models.User{}
+		if err := rows.Scan(
+			&user.ID, &user.Email, &user.Name, &user.Password, &user.IsAdmin, &user.IsActive, &user.IsService, &user.AuthSource, &user.Region,
+			&user.LastLogin, &user.CreatedAt, &user.UpdatedAt,
+		); err != nil {
 			return nil, fmt.Errorf("failed to scan user: %w", err)
 		}
 		users = append(users, user)
@@ -118,17 +230,20 @@ func (r *UserRepository) ListAll(ctx context.Context) ([]*models.UserInfo, error
 func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 	query := `
 		UPDATE users
-		SET email = $1, name = $2, password_hash = $3, is_admin = $4, updated_at = NOW()
-		WHERE id = $5
+		SET email = $1, name = $2, password_hash = $3, is_admin = $4, is_active = $5, auth_source = $6, region = $7, updated_at = NOW()
+		WHERE id = $8
 		RETURNING updated_at
 	`
 
 	err := r.db.QueryRowContext(ctx, query,
-		user.Email, user.Name, user.Password, user.IsAdmin, user.ID,
+		user.Email, user.Name, user.Password, user.IsAdmin, user.IsActive, authSource(user), user.Region, user.ID,
 	).Scan(&user.UpdatedAt)
 
 	if err == sql.ErrNoRows {
-		return fmt.Errorf("user not found")
+		return models.ErrUserNotFound
+	}
+	if duplicateEmail(err) {
+		return models.ErrUserExists
 	}
 	if err != nil {
 		return fmt.Errorf("failed to update user: %w", err)
@@ -151,12 +266,148 @@ func (r *UserRepository) Delete(ctx context.Context, id int64) error {
 		return err
 	}
 	if rows == 0 {
-		return fmt.Errorf("user not found")
+		return models.ErrUserNotFound
 	}
 
 	return nil
 }
 
+// Anonymize replaces a user's personal data with a tombstone and revokes
+// their API keys in one transaction
+func (r *UserRepository) Anonymize(ctx context.Context, id int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin anonymize: %w", err)
+	}
+	defer tx.Rollback()
+
+	var email string
+	err = tx.QueryRowContext(ctx, `SELECT email FROM users WHERE id = $1 FOR UPDATE`, id).Scan(&email)
+	if err == sql.ErrNoRows {
+		return models.ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock user: %w", err)
+	}
+
+	if err := tombstoneUser(ctx, tx, id, email); err != nil {
+		return fmt.Errorf("failed to anonymize user: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit anonymize: %w", err)
+	}
+	return nil
+}
+
+// tombstoneUser turns a locked user row into a tombstone, deactivated and
+// without personal data or credentials, and revokes the API keys it still
+// holds. email is the row's current email, from which the tombstone's is
+// derived
+func tombstoneUser(ctx context.Context, tx *sql.Tx, id int64, email string) error {
+	query := `
+		UPDATE users
+		SET email = $1, name = $2, password_hash = '', is_admin = false, is_active = false, public_key = NULL, updated_at = NOW()
+		WHERE id = $3
+	`
+	if _, err := tx.ExecContext(ctx, query, models.TombstoneEmail(id, email), models.DeletedUserName, id); err != nil {
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, `UPDATE api_keys SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`, id)
+	return err
+}
+
+// MergeUsers moves everything of a duplicate account to the kept one,
+// tombstones the duplicate and records the merge in the admin audit log in
+// a single transaction, so a failure at any step leaves both accounts as
+// they were and nothing recorded
+func (r *UserRepository) MergeUsers(ctx context.Context, actorID, keepID, duplicateID int64) (*models.MergeCounts, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin merge: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock both accounts against concurrent updates and merges
+	var duplicateEmail string
+	rows, err := tx.QueryContext(ctx, `SELECT id, email FROM users WHERE id IN ($1, $2) ORDER BY id FOR UPDATE`, keepID, duplicateID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock users: %w", err)
+	}
+	found := 0
+	for rows.Next() {
+		var id int64
+		var email string
+		if err := rows.Scan(&id, &email); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		if id == duplicateID {
+			duplicateEmail = email
+		}
+		found++
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to lock users: %w", err)
+	}
+	if found != 2 {
+		return nil, models.ErrUserNotFound
+	}
+
+	counts := &models.MergeCounts{}
+	steps := []struct {
+		count *int64
+		query string
+	}{
+		{&counts.Messages, `
+			UPDATE message_metadata
+			SET sender_id = CASE WHEN sender_id = $1 THEN $2 ELSE sender_id END,
+				recipient_id = CASE WHEN recipient_id = $1 THEN $2 ELSE recipient_id END
+			WHERE sender_id = $1 OR recipient_id = $1`},
+		{&counts.APIKeys, `UPDATE api_keys SET user_id = $2 WHERE user_id = $1`},
+		{&counts.AccessLog, `UPDATE access_log SET user_id = $2 WHERE user_id = $1`},
+	}
+	for _, step := range steps {
+		result, err := tx.ExecContext(ctx, step.query, duplicateID, keepID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to move rows to merged account: %w", err)
+		}
+		if *step.count, err = result.RowsAffected(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tombstoneUser(ctx, tx, duplicateID, duplicateEmail); err != nil {
+		return nil, fmt.Errorf("failed to tombstone merged account: %w", err)
+	}
+
+	// A third account sharing the email keeps the kept one as it is
+	normalize := `
+		UPDATE users
+		SET email = LOWER(email), updated_at = NOW()
+		WHERE id = $1 AND email <> LOWER(email)
+			AND NOT EXISTS (SELECT 1 FROM users other WHERE other.id <> $1 AND LOWER(other.email) = LOWER(users.email))
+	`
+	if _, err := tx.ExecContext(ctx, normalize, keepID); err != nil {
+		return nil, fmt.Errorf("failed to normalize email: %w", err)
+	}
+
+	audit := `
+		INSERT INTO admin_audit_log (actor_id, action, user_id, related_user_id)
+		VALUES ($1, $2, $3, $4)
+	`
+	if _, err := tx.ExecContext(ctx, audit, actorID, models.AdminActionMergeUsers, keepID, duplicateID); err != nil {
+		return nil, fmt.Errorf("failed to record merge: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit merge: %w", err)
+	}
+	return counts, nil
+}
+
 // UpdatePassword updates only the password for a user
 func (r *UserRepository) UpdatePassword(ctx context.Context, userID int64, hashedPassword string) error {
 	query := `
@@ -175,8 +426,140 @@ func (r *UserRepository) UpdatePassword(ctx context.Context, userID int64, hashe
 		return err
 	}
 	if rows == 0 {
-		return fmt.Errorf("user not found")
+		return models.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// RecordLogin sets a user's last sign-in to now, leaving updated_at alone
+func (r *UserRepository) RecordLogin(ctx context.Context, userID int64) error {
+	if _, err := r.db.ExecContext(ctx, `UPDATE users SET last_login = NOW() WHERE id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to record login: %w", err)
+	}
+	return nil
+}
+
+// UpdatePublicKey sets a user's public key; an empty key removes it
+func (r *UserRepository) UpdatePublicKey(ctx context.Context, userID int64, publicKey string) error {
+	query := `
+		UPDATE users
+		SET public_key = $1, updated_at = NOW()
+		WHERE id = $2
+	`
+
+	result, err := r.db.ExecContext(ctx, query, sql.NullString{String: publicKey, Valid: publicKey != ""}, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update public key: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrUserNotFound
+	}
+
+	return nil
+}
+
+// CreateAPIKey stores a new API key for a service account
+func (r *UserRepository) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	query := `
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		RETURNING id, created_at
+	`
+
+	if err := r.db.QueryRowContext(ctx, query, key.UserID, key.Name, key.Prefix, key.Hash).Scan(&key.ID, &key.CreatedAt); err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	return nil
+}
+
+// ListAPIKeys returns a user's API keys, revoked ones included, newest first
+func (r *UserRepository) ListAPIKeys(ctx context.Context, userID int64) ([]*models.APIKey, error) {
+	query := `
+		SELECT id, user_id, name, prefix, created_at, last_used_at, revoked_at
+		FROM api_keys
+		WHERE user_id = $1
+		ORDER BY id DESC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+	defer rows.Close()
+
+	keys := []*models.APIKey{}
+	for rows.Next() {
+		key := &models.APIKey{}
+		if err := rows.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, &key.CreatedAt, &key.LastUsedAt, &key.RevokedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan api key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revokes one of a user's keys
+func (r *UserRepository) RevokeAPIKey(ctx context.Context, userID, keyID int64) error {
+	query := `
+		UPDATE api_keys
+		SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL
+	`
+
+	result, err := r.db.ExecContext(ctx, query, keyID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api key: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return models.ErrAPIKeyNotFound
 	}
 
 	return nil
 }
+
+// AuthenticateAPIKey finds the owner of an unrevoked key by its hash and
+// records when the key was last used
+func (r *UserRepository) AuthenticateAPIKey(ctx context.Context, hash string) (*models.User, error) {
+	query := `
+		UPDATE api_keys
+		SET last_used_at = NOW()
+		WHERE key_hash = $1 AND revoked_at IS NULL
+		RETURNING user_id
+	`
+
+	var userID int64
+	err := r.db.QueryRowContext(ctx, query, hash).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return nil, models.ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to authenticate api key: %w", err)
+	}
+
+	return r.FindByID(ctx, userID)
+}
+
+// Ensure UserRepository satisfies the persistence interface
+var _ persistence.UserStore = (*UserRepository)(nil)
+
+// authSource returns the account's auth source, accounts that don't name
+// one being local
+func authSource(user *models.User) string {
+	if user.AuthSource == "" {
+		return models.AuthSourceLocal
+	}
+	return user.AuthSource
+}
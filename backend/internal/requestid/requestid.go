@@ -0,0 +1,67 @@
+// Package requestid carries per-request correlation IDs through
+// context.Context so they can be attached to logs and error responses
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+)
+
+// Header is the HTTP header carrying the request ID
+const Header = "X-Request-ID"
+
+// maxLength bounds accepted incoming IDs
+const maxLength = 128
+
+type contextKey struct{}
+
+// New generates a random (version 4) UUID
+func New() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		// crypto/rand never fails on supported platforms
+		panic(fmt.Sprintf("requestid: failed to read random bytes: %v", err))
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// Valid reports whether an incoming ID is a reasonable token:
+// 1-128 characters of letters, digits, '-', '_', '.' or ':'
+func Valid(id string) bool {
+	if len(id) == 0 || len(id) > maxLength {
+		return false
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-', r == '_', r == '.', r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// NewContext returns a copy of ctx carrying the request ID
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID stored in ctx, or ""
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// Logger returns the default structured logger annotated with the
+// request ID from ctx, if any
+func Logger(ctx context.Context) *slog.Logger {
+	if id := FromContext(ctx); id != "" {
+		return slog.Default().With("request_id", id)
+	}
+	return slog.Default()
+}
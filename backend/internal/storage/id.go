@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+)
+
+// IDLength is the length of newly generated message IDs
+const IDLength = 26
+
+// maxIDLength bounds IDs accepted on read; longer values are never ours
+const maxIDLength = 64
+
+// MaxIDAttempts is how many fresh IDs Store tries before giving up, and
+// how many the message service tries when an ID is taken in metadata
+const MaxIDAttempts = 3
+
+// ErrIDCollision is returned when every generated ID was already taken
+var ErrIDCollision = errors.New("could not allocate a unique message ID")
+
+// idEncoding is unpadded lowercase base32, which survives chat linkifiers,
+// case-folding and copy-paste without any escaping
+var idEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// generateID generates a cryptographically secure random ID
+// Uses 16 bytes (128 bits) of entropy, encoded as 26 lowercase base32 characters
+func generateID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return idEncoding.EncodeToString(b), nil
+}
+
+// NewID returns a fresh message ID without storing anything under it. The
+// message service draws the IDs of its StoreWithID retry loop from it, and
+// the synthetic ID of a dry run
+func NewID() (string, error) {
+	return generateID()
+}
+
+// newClaimToken generates an unguessable token for a message claim
+func newClaimToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// ValidID reports whether id is plausibly a message ID
+// New IDs are lowercase base32; legacy IDs are padded base64url, so the
+// URL-safe base64 alphabet is accepted with '=' allowed only as trailing padding
+func ValidID(id string) bool {
+	if id == "" || len(id) > maxIDLength {
+		return false
+	}
+
+	padding := false
+	for _, ch := range id {
+		switch {
+		case ch == '=':
+			padding = true
+		case padding:
+			return false
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9', ch == '-', ch == '_':
+		default:
+			return false
+		}
+	}
+	return id[0] != '='
+}
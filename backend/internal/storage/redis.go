@@ -2,14 +2,18 @@ package storage
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/tracing"
 	"github.com/redis/go-redis/v9"
+	"golang.org/x/sync/singleflight"
 )
 
 // Lua script for atomic GET and DELETE operation
@@ -25,12 +29,135 @@ else
 end
 `
 
+// claimScript moves a message into a claim hash bound to one user
+// KEYS: message key, claim key; ARGV: user ID, new token, window in ms
+// Returns {status, token, remaining ms} where status is "ok", "claimed" or
+// "missing"; a repeat claim by the same user returns the existing claim
+var claimScript = redis.NewScript(`
+local owner = redis.call('HGET', KEYS[2], 'user')
+if owner then
+    if owner == ARGV[1] then
+        return {'ok', redis.call('HGET', KEYS[2], 'token'), tostring(redis.call('PTTL', KEYS[2]))}
+    end
+    return {'claimed', '', '0'}
+end
+local value = redis.call('GET', KEYS[1])
+if not value then
+    return {'missing', '', '0'}
+end
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[2], 'user', ARGV[1], 'token', ARGV[2], 'payload', value)
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+return {'ok', ARGV[2], ARGV[3]}
+`)
+
+// fetchClaimScript returns a claimed payload. The claim is left to lapse
+// with its window, so a fetch whose response was lost can be repeated
+// KEYS: claim key; ARGV: user ID, token
+// Returns {status, payload} where status is "ok", "invalid" or "missing"
+var fetchClaimScript = redis.NewScript(`
+local claim = redis.call('HMGET', KEYS[1], 'user', 'token', 'payload')
+if not claim[1] then
+    return {'missing', ''}
+end
+if claim[1] ~= ARGV[1] or claim[2] ~= ARGV[2] then
+    return {'invalid', ''}
+end
+return {'ok', claim[3]}
+`)
+
+// readIntentScript returns the read intent of a message, storing a new one
+// when there is none
+// KEYS: read intent key; ARGV: new token, window in ms
+// Returns {token, remaining ms}; an unexpired intent is returned as is
+var readIntentScript = redis.NewScript(`
+local token = redis.call('GET', KEYS[1])
+if token then
+    return {token, tostring(redis.call('PTTL', KEYS[1]))}
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+return {ARGV[1], ARGV[2]}
+`)
+
+// takeReadIntentScript deletes a read intent holding the given token
+// KEYS: read intent key; ARGV: token
+// Returns 1 when it was deleted
+var takeReadIntentScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+    return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// recordDeniedScript adds one attempt to a sorted set scored by time, drops
+// attempts older than the window and returns what is left
+// KEYS: denied key; ARGV: now ms, window ms, member
+// Returns {count, members of the latest attempts...}
+var recordDeniedScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+redis.call('ZADD', KEYS[1], now, ARGV[3])
+redis.call('PEXPIRE', KEYS[1], window)
+local recent = redis.call('ZRANGE', KEYS[1], -` + strconv.Itoa(maxDeniedSources) + `, -1)
+table.insert(recent, 1, tostring(redis.call('ZCARD', KEYS[1])))
+return recent
+`)
+
+// recordNotificationScript counts a notification and starts its window on
+// the first one
+// KEYS: notification key; ARGV: window ms
+// Returns {count, ref}
+var recordNotificationScript = redis.NewScript(`
+local count = redis.call('HINCRBY', KEYS[1], 'count', 1)
+if count == 1 then
+    redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return {tostring(count), redis.call('HGET', KEYS[1], 'ref') or ''}
+`)
+
+// setNotificationRefScript stores the reference of a window still open,
+// so a late write cannot recreate the key without an expiry
+// KEYS: notification key; ARGV: ref
+var setNotificationRefScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 then
+    redis.call('HSET', KEYS[1], 'ref', ARGV[1])
+end
+return 0
+`)
+
+// recordHealthSampleScript adds a health sample to a sorted set scored by
+// when it was taken and drops samples older than keep
+// KEYS: health samples key; ARGV: taken at ms, keep ms, member
+var recordHealthSampleScript = redis.NewScript(`
+local at = tonumber(ARGV[1])
+local keep = tonumber(ARGV[2])
+redis.call('ZADD', KEYS[1], at, ARGV[3])
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', '(' .. (at - keep))
+redis.call('PEXPIRE', KEYS[1], keep)
+return 0
+`)
+
+// maxDeniedSources bounds how many recent attempts RecordDenied reads
+// source IPs from, so a flood cannot make the reply grow
+const maxDeniedSources = 20
+
 // RedisStorage implements the Storage interface using Redis
 type RedisStorage struct {
-	client            *redis.Client
-	getAndDeleteSHA   string
+	client *redis.Client
+
+	// scriptMu guards getAndDeleteSHA, which changes when Redis loses its
+	// script cache (e.g. after a restart)
+	scriptMu        sync.Mutex
+	getAndDeleteSHA string
+	scriptReload    singleflight.Group // one SCRIPT LOAD for every caller that hit NOSCRIPT
 }
 
+// scriptReloadTimeout bounds a SCRIPT LOAD after NOSCRIPT. The load is
+// shared by every waiting caller, so it does not end with the context of
+// the request that started it
+const scriptReloadTimeout = 5 * time.Second
+
 // NewRedisStorage creates a new Redis storage instance
 func NewRedisStorage(address, password string, db int) (*RedisStorage, error) {
 	client := redis.NewClient(&redis.Options{
@@ -58,63 +185,77 @@ func NewRedisStorage(address, password string, db int) (*RedisStorage, error) {
 	}
 	storage.getAndDeleteSHA = sha
 
+	// Trace commands only when OTEL_ENABLED is set; the hook is not
+	// installed otherwise
+	if tracing.Enabled() {
+		client.AddHook(tracing.RedisHook())
+	}
+
 	return storage, nil
 }
 
 // Store saves an encrypted message with a TTL and returns a unique ID
+// IDs are claimed with SET NX so a collision retries with a fresh ID
+// instead of overwriting another message
 func (r *RedisStorage) Store(ctx context.Context, msg *models.Message, ttl time.Duration) (string, error) {
-	// Generate a cryptographically secure random ID
-	id, err := generateID()
-	if err != nil {
-		return "", fmt.Errorf("failed to generate ID: %w", err)
+	for attempt := 0; attempt < MaxIDAttempts; attempt++ {
+		// Generate a cryptographically secure random ID
+		id, err := generateID()
+		if err != nil {
+			return "", fmt.Errorf("failed to generate ID: %w", err)
+		}
+
+		id, err = r.StoreWithID(ctx, id, msg, ttl)
+		if !errors.Is(err, ErrIDCollision) {
+			return id, err
+		}
 	}
 
+	return "", ErrIDCollision
+}
+
+// StoreWithID saves an encrypted message under id with a TTL, only if the
+// ID is unused
+func (r *RedisStorage) StoreWithID(ctx context.Context, id string, msg *models.Message, ttl time.Duration) (string, error) {
 	// Serialize message to JSON
 	data, err := json.Marshal(msg)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal message: %w", err)
 	}
 
-	// Store in Redis with TTL
-	key := messageKey(id)
-	err = r.client.Set(ctx, key, data, ttl).Err()
+	stored, err := r.client.SetNX(ctx, messageKey(id), data, ttl).Result()
 	if err != nil {
 		return "", fmt.Errorf("failed to store message: %w", err)
 	}
-
+	if !stored {
+		return "", ErrIDCollision
+	}
 	return id, nil
 }
 
 // GetAndDelete atomically retrieves and deletes a message (burn-on-read)
 // This uses a Lua script to ensure atomicity and prevent race conditions
 func (r *RedisStorage) GetAndDelete(ctx context.Context, id string) (*models.Message, error) {
-	key := messageKey(id)
+	keys := []string{messageKey(id)}
 
 	// Execute the Lua script using its cached SHA
-	result, err := r.client.EvalSha(ctx, r.getAndDeleteSHA, []string{key}).Result()
-	if err != nil {
-		// If script not found (Redis restarted), reload it
-		if err.Error() == "NOSCRIPT No matching script. Please use EVAL." {
-			sha, loadErr := r.client.ScriptLoad(ctx, getAndDeleteScript).Result()
-			if loadErr != nil {
-				return nil, fmt.Errorf("failed to reload Lua script: %w", loadErr)
-			}
-			r.getAndDeleteSHA = sha
-
-			// Retry the operation
-			result, err = r.client.EvalSha(ctx, r.getAndDeleteSHA, []string{key}).Result()
-			if err != nil {
-				return nil, fmt.Errorf("failed to execute script after reload: %w", err)
-			}
-		} else {
-			return nil, fmt.Errorf("failed to execute script: %w", err)
+	result, err := r.client.EvalSha(ctx, r.scriptSHA(), keys).Result()
+	if redis.HasErrorPrefix(err, "NOSCRIPT") {
+		// Redis restarted or flushed its scripts; reload and retry once
+		sha, loadErr := r.reloadScript(ctx)
+		if loadErr != nil {
+			return nil, fmt.Errorf("failed to reload Lua script: %w", loadErr)
 		}
+		result, err = r.client.EvalSha(ctx, sha, keys).Result()
 	}
 
-	// If result is nil, message doesn't exist
-	if result == nil {
+	// A nil reply means the message doesn't exist
+	if err == redis.Nil {
 		return nil, models.ErrMessageNotFound
 	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute script: %w", err)
+	}
 
 	// Unmarshal the message
 	var msg models.Message
@@ -126,6 +267,147 @@ func (r *RedisStorage) GetAndDelete(ctx context.Context, id string) (*models.Mes
 	return &msg, nil
 }
 
+// scriptSHA returns the cached SHA of the get-and-delete script
+func (r *RedisStorage) scriptSHA() string {
+	r.scriptMu.Lock()
+	defer r.scriptMu.Unlock()
+	return r.getAndDeleteSHA
+}
+
+// reloadScript loads the get-and-delete script into Redis again
+// Concurrent callers wait for a single SCRIPT LOAD instead of each issuing
+// their own; a caller whose context ends stops waiting, but the load goes on
+// for the others
+func (r *RedisStorage) reloadScript(ctx context.Context) (string, error) {
+	reload := r.scriptReload.DoChan("getAndDelete", func() (interface{}, error) {
+		loadCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), scriptReloadTimeout)
+		defer cancel()
+
+		sha, err := r.client.ScriptLoad(loadCtx, getAndDeleteScript).Result()
+		if err != nil {
+			return "", err
+		}
+		r.scriptMu.Lock()
+		r.getAndDeleteSHA = sha
+		r.scriptMu.Unlock()
+		return sha, nil
+	})
+
+	select {
+	case result := <-reload:
+		if result.Err != nil {
+			return "", result.Err
+		}
+		return result.Val.(string), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// Claim moves a message into a short-lived claim bound to userID
+// The move is atomic, so concurrent claims by different users cannot both win
+func (r *RedisStorage) Claim(ctx context.Context, id string, userID int64, window time.Duration) (string, time.Time, error) {
+	token, err := newClaimToken()
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate claim token: %w", err)
+	}
+
+	reply, err := runStatusScript(ctx, r.client, claimScript,
+		[]string{messageKey(id), claimKey(id)}, userID, token, window.Milliseconds())
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to claim message: %w", err)
+	}
+
+	switch reply[0] {
+	case "ok":
+		remaining, err := strconv.ParseInt(reply[2], 10, 64)
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("unexpected claim TTL %q", reply[2])
+		}
+		return reply[1], time.Now().Add(time.Duration(remaining) * time.Millisecond), nil
+	case "claimed":
+		return "", time.Time{}, models.ErrMessageClaimed
+	default:
+		return "", time.Time{}, models.ErrMessageNotFound
+	}
+}
+
+// FetchClaim returns the payload of a claim held by userID. The claim stays
+// until its window ends, so the same token fetches it again meanwhile
+func (r *RedisStorage) FetchClaim(ctx context.Context, id string, userID int64, token string) (*models.Message, error) {
+	reply, err := runStatusScript(ctx, r.client, fetchClaimScript, []string{claimKey(id)}, userID, token)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch claim: %w", err)
+	}
+
+	switch reply[0] {
+	case "ok":
+	case "invalid":
+		return nil, models.ErrInvalidClaim
+	default:
+		return nil, models.ErrClaimNotFound
+	}
+
+	var msg models.Message
+	if err := json.Unmarshal([]byte(reply[1]), &msg); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal message: %w", err)
+	}
+	return &msg, nil
+}
+
+// IssueReadIntent returns the read intent token of message id and when it
+// lapses. A message has at most one: while it is live every caller gets it,
+// then a new one valid for window is generated like a claim token
+func (r *RedisStorage) IssueReadIntent(ctx context.Context, id string, window time.Duration) (string, time.Time, error) {
+	token, err := newClaimToken()
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to generate read intent: %w", err)
+	}
+	reply, err := runStatusScript(ctx, r.client, readIntentScript, []string{readIntentKey(id)}, token, window.Milliseconds())
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to store read intent: %w", err)
+	}
+	remaining, err := strconv.ParseInt(reply[1], 10, 64)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("unexpected read intent TTL %q", reply[1])
+	}
+	return reply[0], time.Now().Add(time.Duration(remaining) * time.Millisecond), nil
+}
+
+// TakeReadIntent deletes the read intent of message id if it holds token;
+// of concurrent reads with the same token only one deletes it
+func (r *RedisStorage) TakeReadIntent(ctx context.Context, id, token string) (bool, error) {
+	n, err := takeReadIntentScript.Run(ctx, r.client, []string{readIntentKey(id)}, token).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to check read intent: %w", err)
+	}
+	return n == 1, nil
+}
+
+// Delete removes each message and its claim in one pipeline; a message
+// counts as stored when either key was there
+func (r *RedisStorage) Delete(ctx context.Context, ids []string) (int, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	pipe := r.client.Pipeline()
+	dels := make([]*redis.IntCmd, len(ids))
+	for i, id := range ids {
+		dels[i] = pipe.Del(ctx, messageKey(id), claimKey(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to delete messages: %w", err)
+	}
+
+	deleted := 0
+	for _, del := range dels {
+		if del.Val() > 0 {
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
 // Exists checks if a message exists without burning it
 func (r *RedisStorage) Exists(ctx context.Context, id string) (bool, error) {
 	key := messageKey(id)
@@ -136,6 +418,150 @@ func (r *RedisStorage) Exists(ctx context.Context, id string) (bool, error) {
 	return count > 0, nil
 }
 
+// GetTTL returns the remaining TTL of a message
+// Redis replies -2 for a missing key and -1 for a key without an expiry
+func (r *RedisStorage) GetTTL(ctx context.Context, id string) (time.Duration, error) {
+	ttl, err := r.client.PTTL(ctx, messageKey(id)).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get TTL: %w", err)
+	}
+	switch ttl {
+	case -2:
+		return 0, models.ErrMessageNotFound
+	case -1:
+		return NoExpiry, nil
+	}
+	return ttl, nil
+}
+
+// RecordDenied counts refused access attempts on a message over a sliding
+// window. Each attempt is a sorted set member scored by its time, so old
+// attempts fall out of the count as the window moves; the key expires once
+// the message stops being probed
+func (r *RedisStorage) RecordDenied(ctx context.Context, id, ip string, window time.Duration) (int, []string, error) {
+	// The random suffix keeps concurrent attempts from one IP distinct
+	nonce, err := generateID()
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to generate attempt ID: %w", err)
+	}
+
+	reply, err := recordDeniedScript.Run(ctx, r.client, []string{deniedKey(id)},
+		time.Now().UnixMilli(), window.Milliseconds(), ip+"|"+nonce).StringSlice()
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to record denied attempt: %w", err)
+	}
+	if len(reply) == 0 {
+		return 0, nil, fmt.Errorf("unexpected script reply %q", reply)
+	}
+	count, err := strconv.Atoi(reply[0])
+	if err != nil {
+		return 0, nil, fmt.Errorf("unexpected attempt count %q", reply[0])
+	}
+
+	var sources []string
+	seen := make(map[string]bool)
+	for _, member := range reply[1:] {
+		source := member[:strings.LastIndexByte(member, '|')]
+		if !seen[source] {
+			seen[source] = true
+			sources = append(sources, source)
+		}
+	}
+	return count, sources, nil
+}
+
+// RecordNotification counts a notification within the window that began
+// with the first one; the key expires with the window, whatever the count
+func (r *RedisStorage) RecordNotification(ctx context.Context, key string, window time.Duration) (int, string, error) {
+	reply, err := recordNotificationScript.Run(ctx, r.client, []string{notificationKey(key)}, window.Milliseconds()).StringSlice()
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to record notification: %w", err)
+	}
+	if len(reply) != 2 {
+		return 0, "", fmt.Errorf("unexpected script reply %q", reply)
+	}
+	count, err := strconv.Atoi(reply[0])
+	if err != nil {
+		return 0, "", fmt.Errorf("unexpected notification count %q", reply[0])
+	}
+	return count, reply[1], nil
+}
+
+// SetNotificationRef stores the reference of the first notification of a
+// window
+func (r *RedisStorage) SetNotificationRef(ctx context.Context, key, ref string) error {
+	if err := setNotificationRefScript.Run(ctx, r.client, []string{notificationKey(key)}, ref).Err(); err != nil {
+		return fmt.Errorf("failed to store notification reference: %w", err)
+	}
+	return nil
+}
+
+// ForgetNotification deletes the window of a notification
+func (r *RedisStorage) ForgetNotification(ctx context.Context, key string) error {
+	if err := r.client.Del(ctx, notificationKey(key)).Err(); err != nil {
+		return fmt.Errorf("failed to forget notification: %w", err)
+	}
+	return nil
+}
+
+// SaveOAuthState stores an OAuth state that expires after ttl
+func (r *RedisStorage) SaveOAuthState(ctx context.Context, state string, ttl time.Duration) error {
+	if err := r.client.Set(ctx, oauthStateKey(state), "1", ttl).Err(); err != nil {
+		return fmt.Errorf("failed to store OAuth state: %w", err)
+	}
+	return nil
+}
+
+// TakeOAuthState deletes an OAuth state; of concurrent callbacks with the
+// same state only one deletes it
+func (r *RedisStorage) TakeOAuthState(ctx context.Context, state string) (bool, error) {
+	n, err := r.client.Del(ctx, oauthStateKey(state)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check OAuth state: %w", err)
+	}
+	return n == 1, nil
+}
+
+// healthSamplesKey is the sorted set of health samples, scored by when
+// each was taken in Unix milliseconds
+const healthSamplesKey = "vanish:health_samples"
+
+// RecordHealthSample adds a sample to the health history and trims it in
+// one script; the key expires with the newest sample
+func (r *RedisStorage) RecordHealthSample(ctx context.Context, sample models.HealthSample, keep time.Duration) error {
+	member, err := json.Marshal(sample)
+	if err != nil {
+		return fmt.Errorf("failed to encode health sample: %w", err)
+	}
+	err = recordHealthSampleScript.Run(ctx, r.client, []string{healthSamplesKey},
+		sample.At.UnixMilli(), keep.Milliseconds(), member).Err()
+	if err != nil {
+		return fmt.Errorf("failed to record health sample: %w", err)
+	}
+	return nil
+}
+
+// HealthSamples reads the health samples taken since the given time
+func (r *RedisStorage) HealthSamples(ctx context.Context, since time.Time) ([]models.HealthSample, error) {
+	members, err := r.client.ZRangeByScore(ctx, healthSamplesKey, &redis.ZRangeBy{
+		Min: strconv.FormatInt(since.UnixMilli(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read health samples: %w", err)
+	}
+
+	samples := make([]models.HealthSample, 0, len(members))
+	for _, member := range members {
+		var sample models.HealthSample
+		if err := json.Unmarshal([]byte(member), &sample); err != nil {
+			return nil, fmt.Errorf("failed to decode health sample: %w", err)
+		}
+		samples = append(samples, sample)
+	}
+	return samples, nil
+}
+
 // Ping checks if Redis is reachable
 func (r *RedisStorage) Ping(ctx context.Context) error {
 	return r.client.Ping(ctx).Err()
@@ -146,18 +572,100 @@ func (r *RedisStorage) Close() error {
 	return r.client.Close()
 }
 
-// messageKey generates the Redis key for a message ID
-func messageKey(id string) string {
-	return fmt.Sprintf("vanish:message:%s", id)
+// createdAtTail is how much of the end of a stored message Scan reads: the
+// JSON encoding ends with created_at, so the rest is never transferred
+const createdAtTail = 64
+
+// Scan lists stored messages with SCAN, which never blocks Redis for more
+// than one batch, and reads each one's creation time from the end of its
+// value in a single pipeline
+func (r *RedisStorage) Scan(ctx context.Context, cursor uint64, count int64) ([]ScannedMessage, uint64, error) {
+	keys, next, err := r.client.Scan(ctx, cursor, messageKey("*"), count).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to scan messages: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, next, nil
+	}
+
+	pipe := r.client.Pipeline()
+	tails := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		tails[i] = pipe.GetRange(ctx, key, -createdAtTail, -1)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, 0, fmt.Errorf("failed to read scanned messages: %w", err)
+	}
+
+	messages := make([]ScannedMessage, 0, len(keys))
+	for i, key := range keys {
+		tail := tails[i].Val()
+		if tail == "" {
+			continue // burned or expired since the SCAN
+		}
+		messages = append(messages, ScannedMessage{
+			ID:        strings.TrimPrefix(key, messageKey("")),
+			CreatedAt: createdAtFrom(tail),
+		})
+	}
+	return messages, next, nil
 }
 
-// generateID generates a cryptographically secure random ID
-// Uses 16 bytes (128 bits) of entropy, base64 URL-encoded
-func generateID() (string, error) {
-	b := make([]byte, 16)
-	_, err := rand.Read(b)
+// createdAtFrom finds created_at in the end of a stored message, returning
+// the zero time when it is missing, as in messages stored before it was
+func createdAtFrom(tail string) time.Time {
+	_, value, ok := strings.Cut(tail, `"created_at":"`)
+	if !ok {
+		return time.Time{}
+	}
+	value, _, _ = strings.Cut(value, `"`)
+	createdAt, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return createdAt
+}
+
+// runStatusScript runs a script that replies with a status followed by at
+// least one value
+func runStatusScript(ctx context.Context, client *redis.Client, script *redis.Script, keys []string, args ...interface{}) ([]string, error) {
+	reply, err := script.Run(ctx, client, keys, args...).StringSlice()
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if len(reply) < 2 {
+		return nil, fmt.Errorf("unexpected script reply %q", reply)
 	}
-	return base64.URLEncoding.EncodeToString(b), nil
+	return reply, nil
+}
+
+// readIntentKey generates the Redis key holding the read intent token of a
+// message
+func readIntentKey(id string) string {
+	return fmt.Sprintf("vanish:read_intent:%s", id)
+}
+
+// claimKey generates the Redis key holding a claimed message
+func claimKey(id string) string {
+	return fmt.Sprintf("vanish:claim:%s", id)
+}
+
+// deniedKey generates the Redis key counting refused attempts on a message
+func deniedKey(id string) string {
+	return fmt.Sprintf("vanish:denied:%s", id)
+}
+
+// notificationKey generates the Redis key counting repeats of a notification
+func notificationKey(key string) string {
+	return fmt.Sprintf("vanish:notification:%s", key)
+}
+
+// oauthStateKey generates the Redis key holding a pending OAuth state
+func oauthStateKey(state string) string {
+	return fmt.Sprintf("vanish:oauth_state:%s", state)
+}
+
+// messageKey generates the Redis key for a message ID
+func messageKey(id string) string {
+	return fmt.Sprintf("vanish:message:%s", id)
 }
@@ -0,0 +1,288 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/models"
+)
+
+// ErrUnknownRegion is returned by RegionalStorage.Store for a message to a
+// region that has no cluster. The message is refused rather than kept
+// elsewhere, which would break its residency
+var ErrUnknownRegion = errors.New("no message storage is configured for the region")
+
+// regionSeparator joins a region to the ID a cluster gave a message
+const regionSeparator = "_"
+
+// scanClusterShift is where RegionalStorage.Scan keeps the index of the
+// cluster being scanned in its cursor; Redis cursors stay far below it
+const scanClusterShift = 56
+
+// RegionRouter is implemented by storage that keeps each message in the
+// cluster of its recipient's region (see models.Message.Region)
+type RegionRouter interface {
+	// Regions returns the names of the configured regions, sorted
+	Regions() []string
+}
+
+// RegionOf returns the region prefixed to a message ID, or "" for a message
+// in the default cluster. Only new-style IDs carry a region, so legacy
+// base64url IDs, which may contain '_', are never mistaken for one
+func RegionOf(id string) string {
+	region, rest, ok := strings.Cut(id, regionSeparator)
+	if !ok || !models.ValidRegion(region) || len(rest) != IDLength {
+		return ""
+	}
+	for _, ch := range rest {
+		if !(ch >= 'a' && ch <= 'z' || ch >= '2' && ch <= '7') {
+			return ""
+		}
+	}
+	return region
+}
+
+// RegionalStorage keeps each message in the Redis cluster of its
+// recipient's region and embeds the region in the message ID (eu_<id>), so
+// reading, claiming and deleting route by ID without a lookup. Messages
+// without a region, and state not tied to one message (notification
+// windows, OAuth states, health samples), stay in the default cluster
+type RegionalStorage struct {
+	defaultStore Storage
+	regions      map[string]Storage
+	names        []string // sorted
+}
+
+// NewRegionalStorage routes messages across defaultStore and the clusters
+// of regions, keyed by region name. With no regions every call goes to
+// defaultStore, but messages to a region are still refused
+func NewRegionalStorage(defaultStore Storage, regions map[string]Storage) *RegionalStorage {
+	names := make([]string, 0, len(regions))
+	for name := range regions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return &RegionalStorage{defaultStore: defaultStore, regions: regions, names: names}
+}
+
+// Regions returns the names of the configured regions, sorted
+func (r *RegionalStorage) Regions() []string {
+	return append([]string(nil), r.names...)
+}
+
+// route returns the cluster holding message id and the ID it has there
+func (r *RegionalStorage) route(id string) (Storage, string) {
+	region := RegionOf(id)
+	if store, ok := r.regions[region]; ok {
+		return store, strings.TrimPrefix(id, region+regionSeparator)
+	}
+	return r.defaultStore, id
+}
+
+// Store saves the message in the cluster of msg.Region and prefixes the
+// returned ID with the region
+func (r *RegionalStorage) Store(ctx context.Context, msg *models.Message, ttl time.Duration) (string, error) {
+	if msg.Region == "" {
+		return r.defaultStore.Store(ctx, msg, ttl)
+	}
+	store, ok := r.regions[msg.Region]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownRegion, msg.Region)
+	}
+	id, err := store.Store(ctx, msg, ttl)
+	if err != nil {
+		return "", err
+	}
+	return msg.Region + regionSeparator + id, nil
+}
+
+// StoreWithID saves the message under id in the cluster of msg.Region and
+// prefixes the returned ID with the region
+func (r *RegionalStorage) StoreWithID(ctx context.Context, id string, msg *models.Message, ttl time.Duration) (string, error) {
+	if msg.Region == "" {
+		return r.defaultStore.StoreWithID(ctx, id, msg, ttl)
+	}
+	store, ok := r.regions[msg.Region]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownRegion, msg.Region)
+	}
+	id, err := store.StoreWithID(ctx, id, msg, ttl)
+	if err != nil {
+		return "", err
+	}
+	return msg.Region + regionSeparator + id, nil
+}
+
+// GetAndDelete burns a message in its cluster
+func (r *RegionalStorage) GetAndDelete(ctx context.Context, id string) (*models.Message, error) {
+	store, id := r.route(id)
+	return store.GetAndDelete(ctx, id)
+}
+
+// Claim claims a message in its cluster, where the claim is kept too
+func (r *RegionalStorage) Claim(ctx context.Context, id string, userID int64, window time.Duration) (string, time.Time, error) {
+	store, id := r.route(id)
+	return store.Claim(ctx, id, userID, window)
+}
+
+// FetchClaim fetches a claim from the cluster of its message
+func (r *RegionalStorage) FetchClaim(ctx context.Context, id string, userID int64, token string) (*models.Message, error) {
+	store, id := r.route(id)
+	return store.FetchClaim(ctx, id, userID, token)
+}
+
+// IssueReadIntent returns the read intent from the cluster of its message
+func (r *RegionalStorage) IssueReadIntent(ctx context.Context, id string, window time.Duration) (string, time.Time, error) {
+	store, id := r.route(id)
+	return store.IssueReadIntent(ctx, id, window)
+}
+
+// TakeReadIntent takes a read intent from the cluster of its message
+func (r *RegionalStorage) TakeReadIntent(ctx context.Context, id, token string) (bool, error) {
+	store, id := r.route(id)
+	return store.TakeReadIntent(ctx, id, token)
+}
+
+// Delete deletes each message from its cluster, one call per cluster
+func (r *RegionalStorage) Delete(ctx context.Context, ids []string) (int, error) {
+	byStore := make(map[Storage][]string)
+	var order []Storage
+	for _, id := range ids {
+		store, routed := r.route(id)
+		if _, seen := byStore[store]; !seen {
+			order = append(order, store)
+		}
+		byStore[store] = append(byStore[store], routed)
+	}
+
+	deleted := 0
+	for _, store := range order {
+		n, err := store.Delete(ctx, byStore[store])
+		deleted += n
+		if err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+// Exists checks for a message in its cluster
+func (r *RegionalStorage) Exists(ctx context.Context, id string) (bool, error) {
+	store, id := r.route(id)
+	return store.Exists(ctx, id)
+}
+
+// GetTTL returns the remaining TTL of a message from its cluster
+func (r *RegionalStorage) GetTTL(ctx context.Context, id string) (time.Duration, error) {
+	store, id := r.route(id)
+	return store.GetTTL(ctx, id)
+}
+
+// RecordDenied counts refused attempts in the message's cluster, keeping
+// the source IPs of attempts on a message in its region too
+func (r *RegionalStorage) RecordDenied(ctx context.Context, id, ip string, window time.Duration) (int, []string, error) {
+	store, id := r.route(id)
+	return store.RecordDenied(ctx, id, ip, window)
+}
+
+// RecordNotification counts a notification in the default cluster
+func (r *RegionalStorage) RecordNotification(ctx context.Context, key string, window time.Duration) (int, string, error) {
+	return r.defaultStore.RecordNotification(ctx, key, window)
+}
+
+// SetNotificationRef stores a notification reference in the default cluster
+func (r *RegionalStorage) SetNotificationRef(ctx context.Context, key, ref string) error {
+	return r.defaultStore.SetNotificationRef(ctx, key, ref)
+}
+
+// ForgetNotification ends a notification window in the default cluster
+func (r *RegionalStorage) ForgetNotification(ctx context.Context, key string) error {
+	return r.defaultStore.ForgetNotification(ctx, key)
+}
+
+// SaveOAuthState stores an OAuth state in the default cluster
+func (r *RegionalStorage) SaveOAuthState(ctx context.Context, state string, ttl time.Duration) error {
+	return r.defaultStore.SaveOAuthState(ctx, state, ttl)
+}
+
+// TakeOAuthState takes an OAuth state from the default cluster
+func (r *RegionalStorage) TakeOAuthState(ctx context.Context, state string) (bool, error) {
+	return r.defaultStore.TakeOAuthState(ctx, state)
+}
+
+// RecordHealthSample records a health sample in the default cluster
+func (r *RegionalStorage) RecordHealthSample(ctx context.Context, sample models.HealthSample, keep time.Duration) error {
+	return r.defaultStore.RecordHealthSample(ctx, sample, keep)
+}
+
+// HealthSamples reads health samples from the default cluster
+func (r *RegionalStorage) HealthSamples(ctx context.Context, since time.Time) ([]models.HealthSample, error) {
+	return r.defaultStore.HealthSamples(ctx, since)
+}
+
+// Scan scans the default cluster, then each region in name order. The top
+// bits of the cursor hold the index of the cluster being scanned and the
+// rest its own cursor; listed IDs carry their region
+func (r *RegionalStorage) Scan(ctx context.Context, cursor uint64, count int64) ([]ScannedMessage, uint64, error) {
+	index := int(cursor >> scanClusterShift)
+	if index > len(r.names) {
+		return nil, 0, fmt.Errorf("invalid scan cursor %d", cursor)
+	}
+	store, prefix := r.defaultStore, ""
+	if index > 0 {
+		region := r.names[index-1]
+		store, prefix = r.regions[region], region+regionSeparator
+	}
+
+	messages, next, err := store.Scan(ctx, cursor&(1<<scanClusterShift-1), count)
+	if err != nil {
+		return nil, 0, err
+	}
+	if next >= 1<<scanClusterShift {
+		return nil, 0, fmt.Errorf("scan cursor %d of cluster %d out of range", next, index)
+	}
+	for i := range messages {
+		messages[i].ID = prefix + messages[i].ID
+	}
+
+	if next == 0 {
+		index++
+		if index > len(r.names) {
+			return messages, 0, nil
+		}
+	}
+	return messages, uint64(index)<<scanClusterShift | next, nil
+}
+
+// Ping checks every cluster; the error names each one that failed
+func (r *RegionalStorage) Ping(ctx context.Context) error {
+	var errs []error
+	if err := r.defaultStore.Ping(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("default cluster: %w", err))
+	}
+	for _, name := range r.names {
+		if err := r.regions[name].Ping(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("region %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close closes every cluster
+func (r *RegionalStorage) Close() error {
+	errs := []error{r.defaultStore.Close()}
+	for _, name := range r.names {
+		errs = append(errs, r.regions[name].Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Ensure RegionalStorage satisfies the Storage interface
+var (
+	_ Storage      = (*RegionalStorage)(nil)
+	_ RegionRouter = (*RegionalStorage)(nil)
+)
@@ -7,17 +7,103 @@ import (
 	"github.com/milkiss/vanish/backend/internal/models"
 )
 
+// NoExpiry is returned by GetTTL for a message without an expiry
+const NoExpiry time.Duration = -1
+
+// ScannedMessage is a stored message listed by Scan
+type ScannedMessage struct {
+	ID        string
+	CreatedAt time.Time // zero when the stored message does not record it
+}
+
 // Storage defines the interface for message storage operations
 type Storage interface {
 	// Store saves an encrypted message with a TTL and returns a unique ID
 	Store(ctx context.Context, msg *models.Message, ttl time.Duration) (string, error)
 
+	// StoreWithID saves an encrypted message under id, from NewID, with a
+	// TTL and returns the ID to link to. It fails with ErrIDCollision
+	// instead of overwriting a message already stored under id
+	StoreWithID(ctx context.Context, id string, msg *models.Message, ttl time.Duration) (string, error)
+
 	// GetAndDelete atomically retrieves and deletes a message (burn-on-read)
 	GetAndDelete(ctx context.Context, id string) (*models.Message, error)
 
+	// Claim atomically moves a message into a claim bound to userID that
+	// lives for window, returning the claim token and when the claim lapses
+	// Claiming again as the same user returns the same claim; other users
+	// get models.ErrMessageClaimed
+	Claim(ctx context.Context, id string, userID int64, window time.Duration) (string, time.Time, error)
+
+	// FetchClaim returns a claimed message. The claim is kept until it
+	// lapses, so a fetch whose response was lost can be repeated with the
+	// same token; a lapsed claim gets models.ErrClaimNotFound
+	FetchClaim(ctx context.Context, id string, userID int64, token string) (*models.Message, error)
+
+	// IssueReadIntent returns a one-time token that allows message id to be
+	// burned, and when it lapses. While a token is live it is returned
+	// again; otherwise a new one valid for window is stored
+	IssueReadIntent(ctx context.Context, id string, window time.Duration) (string, time.Time, error)
+
+	// TakeReadIntent deletes a token stored by IssueReadIntent for message
+	// id and reports whether it was live; of concurrent callers with the
+	// same token only one gets true
+	TakeReadIntent(ctx context.Context, id, token string) (bool, error)
+
+	// Delete removes messages and their claims without reading them and
+	// returns how many of ids were still stored
+	Delete(ctx context.Context, ids []string) (int, error)
+
 	// Exists checks if a message exists without burning it
 	Exists(ctx context.Context, id string) (bool, error)
 
+	// GetTTL returns how long a message has left before it expires
+	// (returns models.ErrMessageNotFound if missing and NoExpiry if the
+	// message never expires)
+	GetTTL(ctx context.Context, id string) (time.Duration, error)
+
+	// RecordDenied adds a refused access attempt from ip to the message's
+	// sliding window and returns how many attempts fall within window,
+	// with the source IPs of the most recent ones (deduplicated)
+	RecordDenied(ctx context.Context, id, ip string, window time.Duration) (int, []string, error)
+
+	// RecordNotification counts a notification identified by key in a
+	// window starting at the first one, returning how many were recorded
+	// within it and the reference SetNotificationRef stored for the first
+	// ("" until then)
+	RecordNotification(ctx context.Context, key string, window time.Duration) (int, string, error)
+
+	// SetNotificationRef stores where the first notification of a window
+	// was delivered, so repeats can update it. It does nothing once the
+	// window has passed
+	SetNotificationRef(ctx context.Context, key, ref string) error
+
+	// ForgetNotification ends the window of a notification that could not
+	// be delivered, so the next one is sent
+	ForgetNotification(ctx context.Context, key string) error
+
+	// SaveOAuthState stores the state parameter of an OAuth flow for ttl,
+	// so the callback can check it was started here
+	SaveOAuthState(ctx context.Context, state string, ttl time.Duration) error
+
+	// TakeOAuthState deletes a state stored by SaveOAuthState and reports
+	// whether it was there; each state is accepted once
+	TakeOAuthState(ctx context.Context, state string) (bool, error)
+
+	// RecordHealthSample adds a round of health checks to the history
+	// shared by every instance and drops samples older than keep
+	RecordHealthSample(ctx context.Context, sample models.HealthSample, keep time.Duration) error
+
+	// HealthSamples returns the samples taken since the given time, oldest
+	// first
+	HealthSamples(ctx context.Context, since time.Time) ([]models.HealthSample, error)
+
+	// Scan lists up to about count stored messages starting at cursor and
+	// returns the cursor to continue from, 0 once every message was listed.
+	// Messages stored or deleted meanwhile may or may not be listed, and one
+	// may be listed twice. Used by the orphan scan only
+	Scan(ctx context.Context, cursor uint64, count int64) ([]ScannedMessage, uint64, error)
+
 	// Close closes the storage connection
 	Close() error
 
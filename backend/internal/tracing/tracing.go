@@ -0,0 +1,125 @@
+// Package tracing exports OpenTelemetry spans for API requests, Redis and
+// Postgres operations and outbound calls to integrations. It is off unless
+// OTEL_ENABLED is set; while off nothing is wrapped and no spans are made.
+//
+// Spans never carry message IDs, Redis keys, query arguments or URL paths:
+// message IDs are recorded only through HashID
+package tracing
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sync/atomic"
+
+	"github.com/milkiss/vanish/backend/internal/buildinfo"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Name identifies Vanish's instrumentation in exported spans
+const Name = "github.com/milkiss/vanish/backend"
+
+// Attribute keys specific to Vanish
+const (
+	RequestIDKey     = attribute.Key("vanish.request_id")
+	MessageIDHashKey = attribute.Key("vanish.message_id_hash")
+)
+
+// enabled is set by Setup; instrumentation is installed only while it is true
+var enabled atomic.Bool
+
+// Options configures Setup
+type Options struct {
+	ServiceName string // service.name of exported spans
+	Endpoint    string // OTLP/HTTP collector base URL, e.g. http://otel-collector:4318
+
+	// Exporter replaces the OTLP exporter and exports every span as it
+	// ends, so tests can inspect spans with an in-memory exporter
+	Exporter sdktrace.SpanExporter
+}
+
+// Setup installs the global tracer provider and W3C trace-context
+// propagation. The returned function flushes pending spans and turns
+// tracing off again; call it on shutdown
+func Setup(ctx context.Context, opts Options) (shutdown func(context.Context) error, err error) {
+	var export sdktrace.TracerProviderOption
+	if opts.Exporter != nil {
+		export = sdktrace.WithSyncer(opts.Exporter)
+	} else {
+		// Like OTEL_EXPORTER_OTLP_ENDPOINT, the endpoint is the collector's
+		// base URL; traces go to its standard path
+		tracesURL, err := url.JoinPath(opts.Endpoint, "v1/traces")
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTLP endpoint: %w", err)
+		}
+		exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(tracesURL))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+		export = sdktrace.WithBatcher(exporter)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		export,
+		sdktrace.WithResource(resource.NewSchemaless(
+			semconv.ServiceName(opts.ServiceName),
+			semconv.ServiceVersion(buildinfo.Version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	enabled.Store(true)
+
+	return func(ctx context.Context) error {
+		enabled.Store(false)
+		otel.SetTracerProvider(noop.NewTracerProvider())
+		return provider.Shutdown(ctx)
+	}, nil
+}
+
+// Enabled reports whether Setup has installed a tracer provider
+// Constructors check it to skip instrumentation entirely when tracing is off
+func Enabled() bool {
+	return enabled.Load()
+}
+
+// Start starts a span as a child of any span in ctx. When tracing is off
+// it returns ctx unchanged and a span that does nothing
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	if !enabled.Load() {
+		return ctx, noop.Span{}
+	}
+	return otel.Tracer(Name).Start(ctx, name, opts...)
+}
+
+// HashID returns the form of a message ID that may be recorded in spans:
+// the first 16 hex digits of its SHA-256. Message IDs are random, so the
+// hash correlates spans of one message without revealing the ID
+func HashID(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:8])
+}
+
+// MessageID returns the span attribute for a message ID, hashed
+func MessageID(id string) attribute.KeyValue {
+	return MessageIDHashKey.String(HashID(id))
+}
+
+// SetMessageID records the hashed ID of a message on the span in ctx, for
+// handlers that learn the ID only after the request span started
+func SetMessageID(ctx context.Context, id string) {
+	if !enabled.Load() {
+		return
+	}
+	trace.SpanFromContext(ctx).SetAttributes(MessageID(id))
+}
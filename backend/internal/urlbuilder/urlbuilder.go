@@ -0,0 +1,81 @@
+// Package urlbuilder constructs links into the frontend from the single
+// configured FRONTEND_BASE_URL, so moving the frontend is a one-variable change
+package urlbuilder
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Builder builds absolute frontend URLs
+type Builder struct {
+	base *url.URL
+}
+
+// Validate checks that baseURL is an absolute http(s) URL without a
+// trailing slash, query or fragment
+func Validate(baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return fmt.Errorf("invalid frontend base URL %q: %w", baseURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("frontend base URL %q must use http or https", baseURL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("frontend base URL %q must be absolute", baseURL)
+	}
+	if strings.HasSuffix(baseURL, "/") {
+		return fmt.Errorf("frontend base URL %q must not end with a slash", baseURL)
+	}
+	if u.RawQuery != "" || u.Fragment != "" || strings.ContainsAny(baseURL, "?#") {
+		return fmt.Errorf("frontend base URL %q must not contain a query or fragment", baseURL)
+	}
+	return nil
+}
+
+// New creates a builder for baseURL, which must pass Validate
+func New(baseURL string) (*Builder, error) {
+	if err := Validate(baseURL); err != nil {
+		return nil, err
+	}
+	u, _ := url.Parse(baseURL)
+	return &Builder{base: u}, nil
+}
+
+// Base returns the frontend base URL
+func (b *Builder) Base() string {
+	return b.base.String()
+}
+
+// MessageURL returns the shareable link for a message
+// The key goes in the fragment so browsers never send it to any server;
+// base64 characters such as '+', '/' and '=' padding are valid there and
+// are kept verbatim because the frontend reads the fragment undecoded
+func (b *Builder) MessageURL(id, key string) string {
+	return b.build("/m/"+url.PathEscape(id), key)
+}
+
+// ExternalMessageURL returns the link of a message to an external
+// recipient, which carries the signed access token in its path since they
+// have no session to read it with
+func (b *Builder) ExternalMessageURL(id, accessToken, key string) string {
+	return b.build("/m/"+url.PathEscape(id)+"/"+url.PathEscape(accessToken), key)
+}
+
+// AuthCallbackURL returns the frontend login callback carrying a session
+// token, again in the fragment to keep it out of server and proxy logs
+func (b *Builder) AuthCallbackURL(token string) string {
+	return b.build("/auth/callback", "token="+token)
+}
+
+// build joins an already-escaped path onto the base and sets the fragment
+func (b *Builder) build(escapedPath, fragment string) string {
+	u := *b.base
+	u.RawPath = b.base.EscapedPath() + escapedPath
+	u.Path, _ = url.PathUnescape(u.RawPath)
+	u.Fragment = fragment
+	u.RawFragment = ""
+	return u.String()
+}
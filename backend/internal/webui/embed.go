@@ -0,0 +1,16 @@
+//go:build embedfrontend
+
+package webui
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:dist
+var dist embed.FS
+
+// Embedded returns the frontend built into the binary
+func Embedded() (fs.FS, error) {
+	return fs.Sub(dist, "dist")
+}
@@ -0,0 +1,10 @@
+//go:build !embedfrontend
+
+package webui
+
+import "io/fs"
+
+// Embedded returns the frontend built into the binary; this build has none
+func Embedded() (fs.FS, error) {
+	return nil, ErrNotEmbedded
+}
@@ -0,0 +1,86 @@
+// Package webui serves the built web frontend from the server itself, so a
+// small install runs as a single process. The files are embedded when the
+// server is built with -tags embedfrontend after copying the Vite build:
+//
+//	cd frontend && npm run build
+//	cp -r frontend/dist backend/internal/webui/dist
+//	cd backend && CGO_ENABLED=0 go build -tags embedfrontend ./cmd/server
+package webui
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrNotEmbedded is returned by Embedded when the binary was built without
+// the frontend
+var ErrNotEmbedded = errors.New("frontend is not embedded in this build; rebuild with -tags embedfrontend")
+
+// Cache-Control values. Vite puts a content hash in every file name under
+// assets/, so those never change; index.html names the current hashes and
+// must always be fetched again
+const (
+	cacheImmutable  = "public, max-age=31536000, immutable"
+	cacheRevalidate = "no-cache"
+	cacheNever      = "no-store"
+)
+
+// Handler serves the frontend in files, the contents of the Vite dist
+// directory. GET and HEAD requests for a path without a file extension that
+// matches no file get index.html, so client-side routes such as /m/:id load
+// the app; anything else unknown is left unanswered for a 404
+func Handler(files fs.FS) (gin.HandlerFunc, error) {
+	index, err := fs.ReadFile(files, "index.html")
+	if err != nil {
+		return nil, fmt.Errorf("frontend has no index.html: %w", err)
+	}
+
+	serveIndex := func(c *gin.Context) {
+		c.Header("Cache-Control", cacheNever)
+		c.Data(http.StatusOK, "text/html; charset=utf-8", index)
+	}
+
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			return
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+c.Request.URL.Path), "/")
+		if name == "" || name == "index.html" {
+			serveIndex(c)
+			return
+		}
+
+		f, err := files.Open(name)
+		if err != nil {
+			if path.Ext(name) == "" {
+				serveIndex(c)
+			}
+			return
+		}
+		defer f.Close()
+
+		info, err := f.Stat()
+		content, seekable := f.(io.ReadSeeker)
+		if err != nil || info.IsDir() || !seekable {
+			if path.Ext(name) == "" {
+				serveIndex(c)
+			}
+			return
+		}
+
+		if strings.HasPrefix(name, "assets/") {
+			c.Header("Cache-Control", cacheImmutable)
+		} else {
+			c.Header("Cache-Control", cacheRevalidate)
+		}
+		http.ServeContent(c.Writer, c.Request, name, info.ModTime(), content)
+	}, nil
+}
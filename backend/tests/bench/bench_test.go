@@ -0,0 +1,173 @@
+// Package bench measures API throughput against the in-memory storage
+// backend (tests/fakes), so hot-path regressions show up without Redis or
+// PostgreSQL. Results use the standard Go benchmark format plus a req/s
+// metric; see docs/TESTING.md for how to record and compare runs
+package bench
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/auth"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+)
+
+const (
+	benchPassword = "bench-password-123"
+	createBody    = `{"ciphertext":"Yw==","iv":"aXY=","recipient_id":2,"encryption_key":"k"}`
+)
+
+// TestMain silences request logs, which would otherwise dominate the
+// output, and applies BCRYPT_COST so login can be measured at any cost
+func TestMain(m *testing.M) {
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	log.SetOutput(io.Discard)
+
+	if value := os.Getenv("BCRYPT_COST"); value != "" {
+		cost, err := strconv.Atoi(value)
+		if err == nil {
+			err = models.SetPasswordCost(cost)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid BCRYPT_COST: %v\n", err)
+			os.Exit(2)
+		}
+	}
+
+	os.Exit(m.Run())
+}
+
+// server is the full API over in-memory stores, with a sender (user 1) and
+// a recipient (user 2) who both use benchPassword
+type server struct {
+	router         *gin.Engine
+	storage        *fakes.Storage
+	senderToken    string
+	recipientToken string
+}
+
+func newServer(b *testing.B) *server {
+	b.Helper()
+	ctx := context.Background()
+
+	users := fakes.NewUserStore()
+	hashed, err := models.HashPassword(benchPassword)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, email := range []string{"sender@example.com", "recipient@example.com"} {
+		if err := users.Create(ctx, &models.User{Email: email, Name: "Bench User", Password: hashed}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	store := fakes.NewStorage()
+	jwtManager := auth.NewJWTManager("bench-secret-key", time.Hour)
+	router, err := api.SetupRouter(api.Dependencies{
+		Config: &config.Config{
+			Server: config.ServerConfig{
+				AllowedOrigins:  []string{"http://localhost:5173"},
+				FrontendBaseURL: "http://localhost:5173",
+			},
+		},
+		Storage:        store,
+		UserStore:      users,
+		MetadataStore:  fakes.NewMetadataStore(users),
+		AccessLogStore: fakes.NewAccessLogStore(users),
+		JWTManager:     jwtManager,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	senderToken, _ := jwtManager.Generate(1, "sender@example.com")
+	recipientToken, _ := jwtManager.Generate(2, "recipient@example.com")
+	return &server{router: router, storage: store, senderToken: senderToken, recipientToken: recipientToken}
+}
+
+// do serves one request and fails the benchmark on an unexpected status
+func (s *server) do(b *testing.B, method, path, token, body string, want int) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	if w.Code != want {
+		b.Errorf("%s %s: status %d, want %d: %s", method, path, w.Code, want, w.Body.String())
+	}
+	return w
+}
+
+// reportThroughput adds a req/s metric, the figure tracked across runs
+func reportThroughput(b *testing.B) {
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "req/s")
+}
+
+// BenchmarkLogin is dominated by bcrypt; set BCRYPT_COST to compare costs
+func BenchmarkLogin(b *testing.B) {
+	s := newServer(b)
+	body := `{"email":"sender@example.com","password":"` + benchPassword + `"}`
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.do(b, "POST", "/api/v1/auth/login", "", body, http.StatusOK)
+		}
+	})
+	reportThroughput(b)
+}
+
+func BenchmarkCreateMessage(b *testing.B) {
+	s := newServer(b)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			s.do(b, "POST", "/api/v1/messages", s.senderToken, createBody, http.StatusCreated)
+		}
+	})
+	reportThroughput(b)
+}
+
+// BenchmarkReadMessage burns one message per request; the messages are
+// created through the API before the timer starts
+func BenchmarkReadMessage(b *testing.B) {
+	s := newServer(b)
+	ids := make([]string, b.N)
+	for i := range ids {
+		w := s.do(b, "POST", "/api/v1/messages", s.senderToken, createBody, http.StatusCreated)
+		var created models.CreateMessageResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+			b.Fatal(err)
+		}
+		ids[i] = created.ID
+	}
+	var next atomic.Int64
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			id := ids[next.Add(1)-1]
+			s.do(b, "GET", "/api/v1/messages/"+id, s.recipientToken, "", http.StatusOK)
+		}
+	})
+	reportThroughput(b)
+}
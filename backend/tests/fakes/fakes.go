@@ -0,0 +1,1488 @@
+// Package fakes provides in-memory implementations of the persistence
+// interfaces for use in unit and integration tests
+package fakes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+)
+
+// UserStore is an in-memory persistence.UserStore
+type UserStore struct {
+	mu         sync.Mutex
+	nextID     int64
+	users      map[int64]*models.User
+	publicKeys map[int64]string
+	apiKeys    []*models.APIKey
+	adminAudit []models.AdminAuditEntry
+
+	// The stores sharing these users, whose rows MergeUsers moves
+	metadata  *MetadataStore
+	accessLog *AccessLogStore
+}
+
+// NewUserStore creates an empty in-memory user store
+func NewUserStore() *UserStore {
+	return &UserStore{users: make(map[int64]*models.User), publicKeys: make(map[int64]string)}
+}
+
+// Create creates a new user
+func (s *UserStore) Create(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range s.users {
+		if strings.EqualFold(u.Email, user.Email) {
+			return models.ErrUserExists
+		}
+	}
+
+	s.nextID++
+	now := time.Now().UTC()
+	user.ID = s.nextID
+	user.IsActive = true
+	if user.AuthSource == "" {
+		user.AuthSource = models.AuthSourceLocal
+	}
+	user.CreatedAt = now
+	user.UpdatedAt = now
+
+	stored := *user
+	s.users[user.ID] = &stored
+	return nil
+}
+
+// FindByEmail finds a user by email, ignoring case; of accounts differing
+// only in case the oldest is returned
+func (s *UserStore) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var found *models.User
+	for _, u := range s.users {
+		if strings.EqualFold(u.Email, email) && (found == nil || u.ID < found.ID) {
+			found = u
+		}
+	}
+	if found == nil {
+		return nil, models.ErrInvalidCredentials
+	}
+	user := *found
+	return &user, nil
+}
+
+// Seed stores user as given, skipping the duplicate check of Create, to
+// set up accounts created before emails were normalized
+func (s *UserStore) Seed(user *models.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.nextID++
+	user.ID = s.nextID
+	user.IsActive = true
+	if user.AuthSource == "" {
+		user.AuthSource = models.AuthSourceLocal
+	}
+	user.CreatedAt = time.Now().UTC()
+	user.UpdatedAt = user.CreatedAt
+	stored := *user
+	s.users[user.ID] = &stored
+}
+
+// FindByID finds a user by ID
+func (s *UserStore) FindByID(ctx context.Context, id int64) (*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return nil, models.ErrUserNotFound
+	}
+	found := *u
+	return &found, nil
+}
+
+// ListAll returns all active users ordered by name
+func (s *UserStore) ListAll(ctx context.Context) ([]*models.UserInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := make([]*models.UserInfo, 0, len(s.users))
+	for _, u := range s.users {
+		if u.IsActive && !u.IsService {
+			info := u.ToUserInfo()
+			info.PublicKey = s.publicKeys[u.ID]
+			users = append(users, info)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return strings.Compare(users[i].Name, users[j].Name) < 0
+	})
+	return users, nil
+}
+
+// ListAccounts returns the regular accounts that were not anonymized, by ID
+func (s *UserStore) ListAccounts(ctx context.Context) ([]*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := []*models.User{}
+	for _, u := range s.users {
+		if !u.IsService && !u.IsAnonymized() {
+			found := *u
+			users = append(users, &found)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+// ListInactive returns the regular accounts that never signed in or last
+// did before cutoff, ordered by ID
+func (s *UserStore) ListInactive(ctx context.Context, cutoff time.Time) ([]*models.User, error) {
+	accounts, err := s.ListAccounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	users := []*models.User{}
+	for _, u := range accounts {
+		if u.InactiveSince(cutoff) {
+			users = append(users, u)
+		}
+	}
+	return users, nil
+}
+
+// ListEmailDuplicates returns the accounts whose emails differ only in
+// case, grouped by lowercased email and ordered by ID within each group
+func (s *UserStore) ListEmailDuplicates(ctx context.Context) ([]*models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := map[string]int{}
+	for _, u := range s.users {
+		counts[strings.ToLower(u.Email)]++
+	}
+	users := []*models.User{}
+	for _, u := range s.users {
+		if counts[strings.ToLower(u.Email)] > 1 {
+			found := *u
+			users = append(users, &found)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool {
+		a, b := strings.ToLower(users[i].Email), strings.ToLower(users[j].Email)
+		if a != b {
+			return a < b
+		}
+		return users[i].ID < users[j].ID
+	})
+	return users, nil
+}
+
+// Update updates a user's information
+func (s *UserStore) Update(ctx context.Context, user *models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user.ID]; !ok {
+		return models.ErrUserNotFound
+	}
+	for _, u := range s.users {
+		if u.ID != user.ID && strings.EqualFold(u.Email, user.Email) {
+			return models.ErrUserExists
+		}
+	}
+	user.UpdatedAt = time.Now().UTC()
+	stored := *user
+	s.users[user.ID] = &stored
+	return nil
+}
+
+// Delete deletes a user by ID
+func (s *UserStore) Delete(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[id]; !ok {
+		return models.ErrUserNotFound
+	}
+	delete(s.users, id)
+	return nil
+}
+
+// Anonymize replaces a user's personal data with a tombstone and revokes
+// their API keys
+func (s *UserStore) Anonymize(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[id]
+	if !ok {
+		return models.ErrUserNotFound
+	}
+	s.tombstone(u)
+	return nil
+}
+
+// tombstone clears a user's personal data and credentials, deactivates
+// them and revokes the API keys they still hold. s.mu must be held
+func (s *UserStore) tombstone(u *models.User) {
+	u.Email = models.TombstoneEmail(u.ID, u.Email)
+	u.Name = models.DeletedUserName
+	u.Password = ""
+	u.IsAdmin = false
+	u.IsActive = false
+	u.UpdatedAt = time.Now().UTC()
+	delete(s.publicKeys, u.ID)
+	for _, k := range s.apiKeys {
+		if k.UserID == u.ID && k.RevokedAt == nil {
+			revokedAt := u.UpdatedAt
+			k.RevokedAt = &revokedAt
+		}
+	}
+}
+
+// MergeUsers moves the rows of a duplicate account, in this store and the
+// metadata and access log stores created with it, to the kept account,
+// tombstones the duplicate and records the merge
+func (s *UserStore) MergeUsers(ctx context.Context, actorID, keepID, duplicateID int64) (*models.MergeCounts, error) {
+	s.mu.Lock()
+	_, keepOK := s.users[keepID]
+	_, duplicateOK := s.users[duplicateID]
+	s.mu.Unlock()
+	if !keepOK || !duplicateOK {
+		return nil, models.ErrUserNotFound
+	}
+
+	// The other stores consult this one under their own locks, so this
+	// one is not held while they are
+	counts := &models.MergeCounts{}
+	if m := s.metadata; m != nil {
+		m.mu.Lock()
+		for _, row := range m.rows {
+			if row.SenderID != duplicateID && row.RecipientID != duplicateID {
+				continue
+			}
+			if row.SenderID == duplicateID {
+				row.SenderID = keepID
+			}
+			if row.RecipientID == duplicateID {
+				row.RecipientID = keepID
+			}
+			counts.Messages++
+		}
+		m.mu.Unlock()
+	}
+	if l := s.accessLog; l != nil {
+		l.mu.Lock()
+		for i := range l.entries {
+			if l.entries[i].UserID == duplicateID {
+				l.entries[i].UserID = keepID
+				counts.AccessLog++
+			}
+		}
+		l.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range s.apiKeys {
+		if k.UserID == duplicateID {
+			k.UserID = keepID
+			counts.APIKeys++
+		}
+	}
+
+	s.tombstone(s.users[duplicateID])
+	s.adminAudit = append(s.adminAudit, models.AdminAuditEntry{
+		ID:            int64(len(s.adminAudit) + 1),
+		ActorID:       actorID,
+		Action:        models.AdminActionMergeUsers,
+		UserID:        keepID,
+		RelatedUserID: duplicateID,
+		CreatedAt:     time.Now().UTC(),
+	})
+
+	keep := s.users[keepID]
+	email := models.NormalizeEmail(keep.Email)
+	if email == keep.Email {
+		return counts, nil
+	}
+	for id, other := range s.users {
+		if id != keepID && models.NormalizeEmail(other.Email) == email {
+			return counts, nil
+		}
+	}
+	keep.Email = email
+	keep.UpdatedAt = time.Now().UTC()
+	return counts, nil
+}
+
+// AdminAudit returns the recorded admin changes to accounts, oldest first
+func (s *UserStore) AdminAudit() []models.AdminAuditEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]models.AdminAuditEntry(nil), s.adminAudit...)
+}
+
+// UpdatePassword updates only the password for a user
+func (s *UserStore) UpdatePassword(ctx context.Context, userID int64, hashedPassword string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return models.ErrUserNotFound
+	}
+	u.Password = hashedPassword
+	u.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+// RecordLogin sets a user's last sign-in to now
+func (s *UserStore) RecordLogin(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[userID]
+	if !ok {
+		return models.ErrUserNotFound
+	}
+	now := time.Now().UTC()
+	u.LastLogin = &now
+	return nil
+}
+
+// UpdatePublicKey sets a user's public key; an empty key removes it
+func (s *UserStore) UpdatePublicKey(ctx context.Context, userID int64, publicKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return models.ErrUserNotFound
+	}
+	if publicKey == "" {
+		delete(s.publicKeys, userID)
+	} else {
+		s.publicKeys[userID] = publicKey
+	}
+	return nil
+}
+
+// CreateAPIKey stores a new API key
+func (s *UserStore) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key.ID = int64(len(s.apiKeys) + 1)
+	key.CreatedAt = time.Now().UTC()
+	stored := *key
+	s.apiKeys = append(s.apiKeys, &stored)
+	return nil
+}
+
+// ListAPIKeys returns a user's API keys, newest first
+func (s *UserStore) ListAPIKeys(ctx context.Context, userID int64) ([]*models.APIKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := []*models.APIKey{}
+	for i := len(s.apiKeys) - 1; i >= 0; i-- {
+		if k := s.apiKeys[i]; k.UserID == userID {
+			found := *k
+			found.Hash = ""
+			keys = append(keys, &found)
+		}
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes one of a user's keys
+func (s *UserStore) RevokeAPIKey(ctx context.Context, userID, keyID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.apiKeys {
+		if k.ID == keyID && k.UserID == userID && k.RevokedAt == nil {
+			now := time.Now().UTC()
+			k.RevokedAt = &now
+			return nil
+		}
+	}
+	return models.ErrAPIKeyNotFound
+}
+
+// AuthenticateAPIKey returns the owner of an unrevoked key by its hash
+func (s *UserStore) AuthenticateAPIKey(ctx context.Context, hash string) (*models.User, error) {
+	s.mu.Lock()
+	var userID int64
+	for _, k := range s.apiKeys {
+		if k.Hash == hash && k.RevokedAt == nil {
+			now := time.Now().UTC()
+			k.LastUsedAt = &now
+			userID = k.UserID
+		}
+	}
+	s.mu.Unlock()
+
+	if userID == 0 {
+		return nil, models.ErrAPIKeyNotFound
+	}
+	return s.FindByID(ctx, userID)
+}
+
+// MetadataStore is an in-memory persistence.MetadataStore
+// Users is consulted to resolve sender/recipient names in history
+type MetadataStore struct {
+	mu     sync.Mutex
+	nextID int64
+	rows   map[string]*models.MessageMetadata
+	Users  *UserStore
+
+	scheduled []*models.ScheduledNotification
+
+	// CreateErr, when set, is returned by Create instead of storing the row
+	CreateErr error
+	// Collisions is how many times Create still fails with
+	// models.ErrDuplicateMessageID, as if an older message had the ID
+	Collisions int
+}
+
+// NewMetadataStore creates an empty in-memory metadata store
+func NewMetadataStore(users *UserStore) *MetadataStore {
+	s := &MetadataStore{
+		rows:  make(map[string]*models.MessageMetadata),
+		Users: users,
+	}
+	if users != nil {
+		users.metadata = s
+	}
+	return s
+}
+
+// Create creates a new message metadata record
+func (s *MetadataStore) Create(ctx context.Context, metadata *models.MessageMetadata) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.CreateErr != nil {
+		return s.CreateErr
+	}
+	if s.Collisions > 0 {
+		s.Collisions--
+		return models.ErrDuplicateMessageID
+	}
+	if _, exists := s.rows[metadata.MessageID]; exists {
+		return models.ErrDuplicateMessageID
+	}
+
+	s.nextID++
+	metadata.ID = s.nextID
+	if metadata.SenderType == "" {
+		metadata.SenderType = models.SenderTypeUser
+	}
+	if metadata.CreatedVia == "" {
+		metadata.CreatedVia = models.ClientAPI
+	}
+	stored := *metadata
+	s.rows[metadata.MessageID] = &stored
+	return nil
+}
+
+// FindByMessageID finds metadata by message ID
+func (s *MetadataStore) FindByMessageID(ctx context.Context, messageID string) (*models.MessageMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.rows[messageID]
+	if !ok {
+		return nil, models.ErrMessageNotFound
+	}
+	found := *m
+	if s.Users != nil {
+		if u, err := s.Users.FindByID(ctx, m.SenderID); err == nil {
+			found.SenderName = u.Name
+		}
+	}
+	return &found, nil
+}
+
+// GetEncryptionKey returns the link key stored for a message
+func (s *MetadataStore) GetEncryptionKey(ctx context.Context, messageID string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.rows[messageID]
+	if !ok {
+		return "", models.ErrMessageNotFound
+	}
+	return m.EncryptionKey, nil
+}
+
+// MarkAsClaimed moves a pending message to claimed, expiring when the
+// claim lapses
+func (s *MetadataStore) MarkAsClaimed(ctx context.Context, messageID string, lapsesAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.rows[messageID]
+	if !ok || (m.Status != models.StatusPending && m.Status != models.StatusClaimed) {
+		return models.ErrMessageNotFound
+	}
+	m.Status = models.StatusClaimed
+	m.ExpiresAt = lapsesAt
+	return nil
+}
+
+// MarkAsRead marks a message as read
+func (s *MetadataStore) MarkAsRead(ctx context.Context, messageID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.rows[messageID]
+	if !ok {
+		return models.ErrMessageNotFound
+	}
+	now := time.Now().UTC()
+	m.Status = models.StatusRead
+	m.ReadAt = &now
+	return nil
+}
+
+// GetUserHistory returns message history for a user (sent or received)
+func (s *MetadataStore) GetUserHistory(ctx context.Context, userID int64, search string, page models.Page) ([]*models.MessageHistoryResponse, error) {
+	s.mu.Lock()
+	rows := make([]*models.MessageMetadata, 0, len(s.rows))
+	for _, m := range s.rows {
+		if userID != 0 && m.SenderID != userID && m.RecipientID != userID {
+			continue
+		}
+		if c := page.After; c != nil && !(m.CreatedAt.Before(c.Time) || m.CreatedAt.Equal(c.Time) && m.ID < c.ID) {
+			continue
+		}
+		if search != "" && !s.historyMatches(ctx, m, userID, search) {
+			continue
+		}
+		copied := *m
+		rows = append(rows, &copied)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].CreatedAt.Equal(rows[j].CreatedAt) {
+			return rows[i].CreatedAt.After(rows[j].CreatedAt)
+		}
+		return rows[i].ID > rows[j].ID
+	})
+	rows = pageRows(rows, page)
+
+	history := make([]*models.MessageHistoryResponse, 0, len(rows))
+	for _, m := range rows {
+		h := &models.MessageHistoryResponse{
+			ID:          m.ID,
+			MessageID:   m.MessageID,
+			Status:      m.Status,
+			CreatedAt:   m.CreatedAt,
+			ReadAt:      m.ReadAt,
+			ExpiresAt:   m.ExpiresAt,
+			IsSender:    m.SenderID == userID,
+			IsRecipient: m.RecipientID == userID,
+			KeyRetained: m.EncryptionKey != "" || m.SealedKey != "",
+
+			SenderType:      m.SenderType,
+			IntegrationName: m.IntegrationName,
+			CreatedVia:      m.CreatedVia,
+			AvailableAt:     m.AvailableAt,
+			Category:        m.Category,
+		}
+		if h.IsRecipient && h.Status == models.StatusPending {
+			h.EncryptionKey = m.EncryptionKey
+			h.SealedKey = m.SealedKey
+		}
+		if s.Users != nil {
+			sender, senderErr := s.Users.FindByID(ctx, m.SenderID)
+			if senderErr == nil {
+				h.SenderName = sender.Name
+			}
+			recipientDeleted := false
+			if m.ExternalRecipientEmail != "" {
+				h.RecipientName = m.ExternalRecipientEmail
+			} else {
+				recipient, recipientErr := s.Users.FindByID(ctx, m.RecipientID)
+				if recipientErr == nil {
+					h.RecipientName = recipient.Name
+				}
+				recipientDeleted = recipientErr != nil || recipient.IsAnonymized()
+			}
+			h.MarkDeletedParties(senderErr != nil || sender.IsAnonymized(), recipientDeleted)
+		}
+		h.SenderLabel = models.SenderLabel(h.SenderName, h.SenderType, h.IntegrationName)
+		history = append(history, h)
+	}
+
+	return history, nil
+}
+
+// historyMatches reports whether search is in the category of m or the
+// name or email of the party other than userID, ignoring case, like the
+// ILIKE of the repository
+func (s *MetadataStore) historyMatches(ctx context.Context, m *models.MessageMetadata, userID int64, search string) bool {
+	contains := func(text string) bool {
+		return strings.Contains(strings.ToLower(text), strings.ToLower(search))
+	}
+	if contains(m.Category) {
+		return true
+	}
+	counterpart := m.SenderID
+	if m.SenderID == userID {
+		if contains(m.ExternalRecipientEmail) {
+			return true
+		}
+		counterpart = m.RecipientID
+	}
+	if s.Users == nil || counterpart == 0 {
+		return false
+	}
+	user, err := s.Users.FindByID(ctx, counterpart)
+	return err == nil && (contains(user.Name) || contains(user.Email))
+}
+
+// ListUserMessages returns a page of a user's messages ordered by ID
+func (s *MetadataStore) ListUserMessages(ctx context.Context, userID, afterID int64, limit int) ([]*models.MessageMetadata, error) {
+	s.mu.Lock()
+	rows := make([]*models.MessageMetadata, 0, len(s.rows))
+	for _, m := range s.rows {
+		if (m.SenderID == userID || m.RecipientID == userID) && m.ID > afterID {
+			copied := *m
+			copied.EncryptionKey = ""
+			copied.SealedKey = ""
+			rows = append(rows, &copied)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+	if limit > 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+
+	if s.Users != nil {
+		for _, m := range rows {
+			if u, err := s.Users.FindByID(ctx, m.SenderID); err == nil {
+				m.SenderName = u.Name
+			}
+			if u, err := s.Users.FindByID(ctx, m.RecipientID); err == nil {
+				m.RecipientName = u.Name
+			}
+		}
+	}
+	return rows, nil
+}
+
+// pageRows applies the offset and limit of page to sorted rows
+func pageRows(rows []*models.MessageMetadata, page models.Page) []*models.MessageMetadata {
+	if page.Offset >= len(rows) {
+		return nil
+	}
+	rows = rows[page.Offset:]
+	if page.Limit > 0 && len(rows) > page.Limit {
+		rows = rows[:page.Limit]
+	}
+	return rows
+}
+
+// ListInbox returns a recipient's unexpired pending messages, soonest to
+// expire first
+func (s *MetadataStore) ListInbox(ctx context.Context, recipientID int64, page models.Page) ([]*models.MessageMetadata, error) {
+	s.mu.Lock()
+	rows := make([]*models.MessageMetadata, 0)
+	now := time.Now()
+	for _, m := range s.rows {
+		if m.RecipientID != recipientID || m.Status != models.StatusPending || !m.ExpiresAt.After(now) || m.Scheduled(now) {
+			continue
+		}
+		if c := page.After; c != nil && !(m.ExpiresAt.After(c.Time) || m.ExpiresAt.Equal(c.Time) && m.ID > c.ID) {
+			continue
+		}
+		copied := *m
+		rows = append(rows, &copied)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].ExpiresAt.Equal(rows[j].ExpiresAt) {
+			return rows[i].ExpiresAt.Before(rows[j].ExpiresAt)
+		}
+		return rows[i].ID < rows[j].ID
+	})
+	rows = pageRows(rows, page)
+
+	if s.Users != nil {
+		for _, m := range rows {
+			if u, err := s.Users.FindByID(ctx, m.SenderID); err == nil {
+				m.SenderName = u.Name
+			}
+		}
+	}
+	return rows, nil
+}
+
+// CountPendingForRecipient counts unexpired pending messages for a recipient
+func (s *MetadataStore) CountPendingForRecipient(ctx context.Context, recipientID int64) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	now := time.Now()
+	for _, m := range s.rows {
+		if m.RecipientID == recipientID && m.Status == models.StatusPending && m.ExpiresAt.After(now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// CountRecipientsWithPending counts recipients with at least atLeast
+// unexpired pending messages
+func (s *MetadataStore) CountRecipientsWithPending(ctx context.Context, atLeast int) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := make(map[int64]int)
+	now := time.Now()
+	for _, m := range s.rows {
+		if m.Status == models.StatusPending && m.ExpiresAt.After(now) && m.RecipientID != 0 {
+			pending[m.RecipientID]++
+		}
+	}
+	count := 0
+	for _, n := range pending {
+		if n >= atLeast {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ExpirePendingForRecipient expires the given messages the user still has pending
+func (s *MetadataStore) ExpirePendingForRecipient(ctx context.Context, recipientID int64, messageIDs []string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := []string{}
+	for _, id := range messageIDs {
+		m, ok := s.rows[id]
+		if ok && m.RecipientID == recipientID && m.Status == models.StatusPending {
+			m.Status = models.StatusExpired
+			m.EncryptionKey = ""
+			m.SealedKey = ""
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// RevokeMessage expires an open message at its sender's request
+func (s *MetadataStore) RevokeMessage(ctx context.Context, senderID int64, messageID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.rows[messageID]
+	if !ok || m.SenderID != senderID || (m.Status != models.StatusPending && m.Status != models.StatusClaimed) {
+		return models.ErrMessageNotFound
+	}
+	m.Status = models.StatusExpired
+	m.EncryptionKey = ""
+	m.SealedKey = ""
+	return nil
+}
+
+// ExpireUserMessages expires a user's open messages in both directions
+func (s *MetadataStore) ExpireUserMessages(ctx context.Context, userID int64) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := []string{}
+	for _, m := range s.rows {
+		if m.SenderID != userID && m.RecipientID != userID {
+			continue
+		}
+		if m.Status == models.StatusPending || m.Status == models.StatusClaimed {
+			m.Status = models.StatusExpired
+			m.EncryptionKey = ""
+			m.SealedKey = ""
+			ids = append(ids, m.MessageID)
+		}
+	}
+	return ids, nil
+}
+
+// CountByBucket counts messages per UTC bucket
+func (s *MetadataStore) CountByBucket(ctx context.Context, metric models.StatisticsMetric, interval models.StatisticsInterval, from, to time.Time) ([]models.TimeSeriesPoint, error) {
+	if !metric.Valid() || !interval.Valid() {
+		return nil, models.ErrInvalidStatisticsQuery
+	}
+
+	s.mu.Lock()
+	counts := make(map[time.Time]int64)
+	for _, m := range s.rows {
+		var at time.Time
+		switch metric {
+		case models.MetricCreated:
+			at = m.CreatedAt
+		case models.MetricRead:
+			if m.ReadAt == nil {
+				continue
+			}
+			at = *m.ReadAt
+		case models.MetricExpired:
+			if m.Status != models.StatusExpired {
+				continue
+			}
+			at = m.ExpiresAt
+		}
+		if !at.Before(from) && at.Before(to) {
+			counts[interval.Truncate(at)]++
+		}
+	}
+	s.mu.Unlock()
+
+	points := make([]models.TimeSeriesPoint, 0, len(counts))
+	for bucket, count := range counts {
+		points = append(points, models.TimeSeriesPoint{Bucket: bucket, Count: count})
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Bucket.Before(points[j].Bucket) })
+	return points, nil
+}
+
+// TopSenders returns the users who created the most messages in a range
+func (s *MetadataStore) TopSenders(ctx context.Context, from, to time.Time, limit int) ([]models.LeaderboardEntry, error) {
+	return s.topUsers(ctx, func(m *models.MessageMetadata) int64 { return m.SenderID }, from, to, limit)
+}
+
+// TopRecipients returns the users who received the most messages in a range
+func (s *MetadataStore) TopRecipients(ctx context.Context, from, to time.Time, limit int) ([]models.LeaderboardEntry, error) {
+	return s.topUsers(ctx, func(m *models.MessageMetadata) int64 { return m.RecipientID }, from, to, limit)
+}
+
+func (s *MetadataStore) topUsers(ctx context.Context, user func(*models.MessageMetadata) int64, from, to time.Time, limit int) ([]models.LeaderboardEntry, error) {
+	s.mu.Lock()
+	counts := make(map[int64]int64)
+	for _, m := range s.rows {
+		if !m.CreatedAt.Before(from) && m.CreatedAt.Before(to) {
+			counts[user(m)]++
+		}
+	}
+	s.mu.Unlock()
+
+	entries := make([]models.LeaderboardEntry, 0, len(counts))
+	for id, count := range counts {
+		e := models.LeaderboardEntry{UserID: id, Count: count}
+		if s.Users != nil {
+			if u, err := s.Users.FindByID(ctx, id); err == nil {
+				e.Name = u.Name
+			}
+		}
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Count != entries[j].Count {
+			return entries[i].Count > entries[j].Count
+		}
+		return entries[i].UserID < entries[j].UserID
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// CleanupExpired marks expired pending or claimed messages as expired
+// and returns their message IDs
+func (s *MetadataStore) CleanupExpired(ctx context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := []string{}
+	now := time.Now()
+	for _, m := range s.rows {
+		if (m.Status == models.StatusPending || m.Status == models.StatusClaimed) && m.ExpiresAt.Before(now) {
+			m.Status = models.StatusExpired
+			ids = append(ids, m.MessageID)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// ListPending returns pending messages after afterID, oldest first
+func (s *MetadataStore) ListPending(ctx context.Context, afterID int64, limit int) ([]*models.MessageMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows := make([]*models.MessageMetadata, 0, len(s.rows))
+	for _, m := range s.rows {
+		if m.Status == models.StatusPending && m.ID > afterID {
+			copied := *m
+			copied.EncryptionKey = ""
+			copied.SealedKey = ""
+			rows = append(rows, &copied)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].ID < rows[j].ID })
+	if limit > 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+	return rows, nil
+}
+
+// ScheduleNotification stores a notification to send at n.SendAt
+func (s *MetadataStore) ScheduleNotification(ctx context.Context, n *models.ScheduledNotification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rows[n.MessageID]; !ok {
+		return fmt.Errorf("failed to schedule notification: unknown message")
+	}
+	for _, existing := range s.scheduled {
+		if existing.MessageID == n.MessageID && existing.Channel == n.Channel {
+			return nil
+		}
+	}
+	s.nextID++
+	stored := *n
+	stored.ID = s.nextID
+	s.scheduled = append(s.scheduled, &stored)
+	return nil
+}
+
+// TakeDueNotifications removes and returns notifications due at now
+func (s *MetadataStore) TakeDueNotifications(ctx context.Context, now time.Time, limit int) ([]*models.ScheduledNotification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sort.Slice(s.scheduled, func(i, j int) bool { return s.scheduled[i].SendAt.Before(s.scheduled[j].SendAt) })
+	due := []*models.ScheduledNotification{}
+	kept := s.scheduled[:0]
+	for _, n := range s.scheduled {
+		if !n.SendAt.After(now) && (limit <= 0 || len(due) < limit) {
+			due = append(due, n)
+			continue
+		}
+		kept = append(kept, n)
+	}
+	s.scheduled = kept
+	return due, nil
+}
+
+// CountDueNotifications counts the notifications due at now
+func (s *MetadataStore) CountDueNotifications(ctx context.Context, now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	count := 0
+	for _, n := range s.scheduled {
+		if !n.SendAt.After(now) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Scheduled returns the notifications waiting to be sent
+func (s *MetadataStore) Scheduled() []models.ScheduledNotification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scheduled := make([]models.ScheduledNotification, len(s.scheduled))
+	for i, n := range s.scheduled {
+		scheduled[i] = *n
+	}
+	return scheduled
+}
+
+// UpdateExpiresAt corrects the expiry recorded for a message
+func (s *MetadataStore) UpdateExpiresAt(ctx context.Context, messageID string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m, ok := s.rows[messageID]
+	if !ok {
+		return models.ErrMessageNotFound
+	}
+	m.ExpiresAt = expiresAt
+	return nil
+}
+
+// AccessLogStore is an in-memory persistence.AccessLogStore
+// Users is consulted to resolve user names when listing
+type AccessLogStore struct {
+	mu      sync.Mutex
+	nextID  int64
+	entries []models.AccessLogEntry
+	Users   *UserStore
+
+	// RecordErr, when set, is returned by RecordAccess instead of storing
+	RecordErr error
+}
+
+// NewAccessLogStore creates an empty in-memory access log
+func NewAccessLogStore(users *UserStore) *AccessLogStore {
+	s := &AccessLogStore{Users: users}
+	if users != nil {
+		users.accessLog = s
+	}
+	return s
+}
+
+// RecordAccess stores a batch of access attempts
+func (s *AccessLogStore) RecordAccess(ctx context.Context, entries []*models.AccessLogEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.RecordErr != nil {
+		return s.RecordErr
+	}
+	for _, e := range entries {
+		s.nextID++
+		stored := *e
+		stored.ID = s.nextID
+		s.entries = append(s.entries, stored)
+	}
+	return nil
+}
+
+// ListAccess returns the latest attempts on a message, newest first
+func (s *AccessLogStore) ListAccess(ctx context.Context, messageID string, limit int) ([]*models.AccessLogEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := []*models.AccessLogEntry{}
+	for i := len(s.entries) - 1; i >= 0 && len(entries) < limit; i-- {
+		if s.entries[i].MessageID != messageID {
+			continue
+		}
+		e := s.entries[i]
+		if s.Users != nil {
+			if u, err := s.Users.FindByID(ctx, e.UserID); err == nil {
+				e.UserName = u.Name
+			}
+		}
+		entries = append(entries, &e)
+	}
+	return entries, nil
+}
+
+// PurgeAccessBefore deletes attempts recorded before cutoff
+func (s *AccessLogStore) PurgeAccessBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.entries[:0]
+	for _, e := range s.entries {
+		if !e.CreatedAt.Before(cutoff) {
+			kept = append(kept, e)
+		}
+	}
+	purged := int64(len(s.entries) - len(kept))
+	s.entries = kept
+	return purged, nil
+}
+
+// SlackInstallationStore is an in-memory persistence.SlackInstallationStore
+type SlackInstallationStore struct {
+	mu            sync.Mutex
+	installations map[string]models.SlackInstallation
+}
+
+// NewSlackInstallationStore creates an empty in-memory installation store
+func NewSlackInstallationStore() *SlackInstallationStore {
+	return &SlackInstallationStore{installations: make(map[string]models.SlackInstallation)}
+}
+
+// SaveSlackInstallation stores an installation, replacing an earlier one
+// of the same workspace
+func (s *SlackInstallationStore) SaveSlackInstallation(ctx context.Context, installation *models.SlackInstallation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	installation.CreatedAt = now
+	if earlier, ok := s.installations[installation.TeamID]; ok {
+		installation.CreatedAt = earlier.CreatedAt
+	}
+	installation.UpdatedAt = now
+	s.installations[installation.TeamID] = *installation
+	return nil
+}
+
+// FindSlackInstallation returns the installation of a workspace
+func (s *SlackInstallationStore) FindSlackInstallation(ctx context.Context, teamID string) (*models.SlackInstallation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	installation, ok := s.installations[teamID]
+	if !ok {
+		return nil, models.ErrSlackNotInstalled
+	}
+	return &installation, nil
+}
+
+// digestEvent is one event recorded by DigestStore
+type digestEvent struct {
+	kind models.DigestEvent
+	at   time.Time
+}
+
+// DigestStore is an in-memory persistence.DigestStore
+type DigestStore struct {
+	mu      sync.Mutex
+	events  []digestEvent
+	periods map[string]bool
+}
+
+// NewDigestStore creates an empty in-memory digest store
+func NewDigestStore() *DigestStore {
+	return &DigestStore{periods: make(map[string]bool)}
+}
+
+// RecordEvent counts one event at the current time
+func (s *DigestStore) RecordEvent(ctx context.Context, kind models.DigestEvent) error {
+	return s.RecordEventAt(kind, time.Now())
+}
+
+// RecordEventAt counts one event at the given time, for tests
+func (s *DigestStore) RecordEventAt(kind models.DigestEvent, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, digestEvent{kind: kind, at: at})
+	return nil
+}
+
+// CountEvents counts the events of each kind recorded in [from, to)
+func (s *DigestStore) CountEvents(ctx context.Context, from, to time.Time) (map[models.DigestEvent]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[models.DigestEvent]int)
+	for _, e := range s.events {
+		if !e.at.Before(from) && e.at.Before(to) {
+			counts[e.kind]++
+		}
+	}
+	return counts, nil
+}
+
+// PurgeEventsBefore deletes events recorded before cutoff
+func (s *DigestStore) PurgeEventsBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.events[:0]
+	for _, e := range s.events {
+		if !e.at.Before(cutoff) {
+			kept = append(kept, e)
+		}
+	}
+	purged := int64(len(s.events) - len(kept))
+	s.events = kept
+	return purged, nil
+}
+
+// ClaimDigest claims a period unless it already was
+func (s *DigestStore) ClaimDigest(ctx context.Context, period string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.periods[period] {
+		return false, nil
+	}
+	s.periods[period] = true
+	return true, nil
+}
+
+// ReleaseDigest forgets the claim of a period
+func (s *DigestStore) ReleaseDigest(ctx context.Context, period string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.periods, period)
+	return nil
+}
+
+// Claimed reports whether the digest of period was claimed
+func (s *DigestStore) Claimed(period string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.periods[period]
+}
+
+// TTLPolicyStore is an in-memory persistence.TTLPolicyStore. Unlike the
+// database it starts without category policies
+type TTLPolicyStore struct {
+	mu         sync.Mutex
+	rules      map[int64]*models.TTLPolicyRule
+	nextID     int64
+	categories map[string]*models.CategoryPolicy
+	banned     map[string]*models.BannedDomain
+	dlp        map[string]*models.DLPPattern
+
+	// ListErr, when set, is returned by ListTTLPolicies,
+	// ListCategoryPolicies, ListBannedDomains and ListDLPPatterns
+	ListErr error
+}
+
+// NewTTLPolicyStore creates an empty in-memory TTL policy store
+func NewTTLPolicyStore() *TTLPolicyStore {
+	return &TTLPolicyStore{
+		rules:      make(map[int64]*models.TTLPolicyRule),
+		categories: make(map[string]*models.CategoryPolicy),
+		banned:     make(map[string]*models.BannedDomain),
+		dlp:        make(map[string]*models.DLPPattern),
+	}
+}
+
+// ListTTLPolicies returns copies of the rules ordered by position, then ID
+func (s *TTLPolicyStore) ListTTLPolicies(ctx context.Context) ([]*models.TTLPolicyRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ListErr != nil {
+		return nil, s.ListErr
+	}
+	rules := make([]*models.TTLPolicyRule, 0, len(s.rules))
+	for _, rule := range s.rules {
+		copied := *rule
+		rules = append(rules, &copied)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Position != rules[j].Position {
+			return rules[i].Position < rules[j].Position
+		}
+		return rules[i].ID < rules[j].ID
+	})
+	return rules, nil
+}
+
+// CreateTTLPolicy adds a rule, after the others without a position
+func (s *TTLPolicyStore) CreateTTLPolicy(ctx context.Context, rule *models.TTLPolicyRule, position *int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if position != nil {
+		rule.Position = *position
+	} else {
+		rule.Position = 0
+		for _, existing := range s.rules {
+			if existing.Position >= rule.Position {
+				rule.Position = existing.Position + 1
+			}
+		}
+	}
+	s.nextID++
+	rule.ID = s.nextID
+	rule.CreatedAt = time.Now().UTC()
+	rule.UpdatedAt = rule.CreatedAt
+	stored := *rule
+	s.rules[rule.ID] = &stored
+	return nil
+}
+
+// UpdateTTLPolicy replaces a rule, keeping its position unless one is given
+func (s *TTLPolicyStore) UpdateTTLPolicy(ctx context.Context, rule *models.TTLPolicyRule, position *int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.rules[rule.ID]
+	if !ok {
+		return models.ErrTTLPolicyNotFound
+	}
+	rule.Position = existing.Position
+	if position != nil {
+		rule.Position = *position
+	}
+	rule.CreatedAt = existing.CreatedAt
+	rule.UpdatedAt = time.Now().UTC()
+	stored := *rule
+	s.rules[rule.ID] = &stored
+	return nil
+}
+
+// DeleteTTLPolicy removes a rule
+func (s *TTLPolicyStore) DeleteTTLPolicy(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.rules[id]; !ok {
+		return models.ErrTTLPolicyNotFound
+	}
+	delete(s.rules, id)
+	return nil
+}
+
+// ListCategoryPolicies returns copies of the category policies by category
+func (s *TTLPolicyStore) ListCategoryPolicies(ctx context.Context) ([]*models.CategoryPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ListErr != nil {
+		return nil, s.ListErr
+	}
+	policies := make([]*models.CategoryPolicy, 0, len(s.categories))
+	for _, policy := range s.categories {
+		copied := *policy
+		policies = append(policies, &copied)
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Category < policies[j].Category })
+	return policies, nil
+}
+
+// GetCategoryPolicy returns a copy of the policy of category
+func (s *TTLPolicyStore) GetCategoryPolicy(ctx context.Context, category string) (*models.CategoryPolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	policy, ok := s.categories[category]
+	if !ok {
+		return nil, models.ErrCategoryPolicyNotFound
+	}
+	copied := *policy
+	return &copied, nil
+}
+
+// PutCategoryPolicy creates or replaces the policy of policy.Category
+func (s *TTLPolicyStore) PutCategoryPolicy(ctx context.Context, policy *models.CategoryPolicy) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	existing, replaced := s.categories[policy.Category]
+	policy.CreatedAt = now
+	if replaced {
+		policy.CreatedAt = existing.CreatedAt
+	}
+	policy.UpdatedAt = now
+	stored := *policy
+	s.categories[policy.Category] = &stored
+	return !replaced, nil
+}
+
+// DeleteCategoryPolicy removes the policy of category
+func (s *TTLPolicyStore) DeleteCategoryPolicy(ctx context.Context, category string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.categories[category]; !ok {
+		return models.ErrCategoryPolicyNotFound
+	}
+	delete(s.categories, category)
+	return nil
+}
+
+// ListBannedDomains returns copies of the banned domains by domain
+func (s *TTLPolicyStore) ListBannedDomains(ctx context.Context) ([]*models.BannedDomain, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ListErr != nil {
+		return nil, s.ListErr
+	}
+	domains := make([]*models.BannedDomain, 0, len(s.banned))
+	for _, domain := range s.banned {
+		copied := *domain
+		domains = append(domains, &copied)
+	}
+	sort.Slice(domains, func(i, j int) bool { return domains[i].Domain < domains[j].Domain })
+	return domains, nil
+}
+
+// PutBannedDomain bans domain.Domain or replaces the reason of its ban
+func (s *TTLPolicyStore) PutBannedDomain(ctx context.Context, domain *models.BannedDomain) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, replaced := s.banned[domain.Domain]
+	domain.CreatedAt = time.Now().UTC()
+	if replaced {
+		domain.CreatedAt = existing.CreatedAt
+	}
+	stored := *domain
+	s.banned[domain.Domain] = &stored
+	return !replaced, nil
+}
+
+// DeleteBannedDomain lifts the ban of domain
+func (s *TTLPolicyStore) DeleteBannedDomain(ctx context.Context, domain string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.banned[domain]; !ok {
+		return models.ErrBannedDomainNotFound
+	}
+	delete(s.banned, domain)
+	return nil
+}
+
+// ListDLPPatterns returns copies of the DLP patterns by name
+func (s *TTLPolicyStore) ListDLPPatterns(ctx context.Context) ([]*models.DLPPattern, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ListErr != nil {
+		return nil, s.ListErr
+	}
+	patterns := make([]*models.DLPPattern, 0, len(s.dlp))
+	for _, pattern := range s.dlp {
+		copied := *pattern
+		patterns = append(patterns, &copied)
+	}
+	sort.Slice(patterns, func(i, j int) bool { return patterns[i].Name < patterns[j].Name })
+	return patterns, nil
+}
+
+// PutDLPPattern creates or replaces the pattern named pattern.Name
+func (s *TTLPolicyStore) PutDLPPattern(ctx context.Context, pattern *models.DLPPattern) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().UTC()
+	existing, replaced := s.dlp[pattern.Name]
+	pattern.CreatedAt = now
+	if replaced {
+		pattern.CreatedAt = existing.CreatedAt
+	}
+	pattern.UpdatedAt = now
+	stored := *pattern
+	s.dlp[pattern.Name] = &stored
+	return !replaced, nil
+}
+
+// DeleteDLPPattern removes the pattern named name
+func (s *TTLPolicyStore) DeleteDLPPattern(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.dlp[name]; !ok {
+		return models.ErrDLPPatternNotFound
+	}
+	delete(s.dlp, name)
+	return nil
+}
+
+// Ensure the fakes satisfy the persistence interfaces
+var (
+	_ persistence.UserStore              = (*UserStore)(nil)
+	_ persistence.MetadataStore          = (*MetadataStore)(nil)
+	_ persistence.AccessLogStore         = (*AccessLogStore)(nil)
+	_ persistence.SlackInstallationStore = (*SlackInstallationStore)(nil)
+	_ persistence.DigestStore            = (*DigestStore)(nil)
+	_ persistence.TTLPolicyStore         = (*TTLPolicyStore)(nil)
+)
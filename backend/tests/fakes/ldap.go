@@ -0,0 +1,294 @@
+package fakes
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+)
+
+// LDAP protocol operations and result codes the directory understands
+const (
+	ldapBindRequest       = 0
+	ldapBindResponse      = 1
+	ldapUnbindRequest     = 2
+	ldapSearchRequest     = 3
+	ldapSearchResultEntry = 4
+	ldapSearchResultDone  = 5
+
+	ldapSuccess                 = 0
+	ldapNoSuchObject            = 32
+	ldapInvalidCredentials      = 49
+	ldapInsufficientAccessRight = 50
+)
+
+// LDAPEntry is one entry of an LDAPDirectory
+type LDAPEntry struct {
+	DN         string
+	Password   string // simple bind password; empty entries cannot bind
+	Attributes map[string][]string
+}
+
+// LDAPDirectory is an in-process LDAP server speaking just enough of the
+// protocol for simple binds and searches with equality, presence, and, or
+// and not filters. Anonymous binds may not search
+type LDAPDirectory struct {
+	URL string
+
+	listener net.Listener
+	mu       sync.Mutex
+	entries  []LDAPEntry
+	binds    []string
+}
+
+// NewLDAPDirectory starts a directory serving entries on a local port
+func NewLDAPDirectory(entries ...LDAPEntry) (*LDAPDirectory, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	d := &LDAPDirectory{
+		URL:      "ldap://" + listener.Addr().String(),
+		listener: listener,
+		entries:  entries,
+	}
+	go d.serve()
+	return d, nil
+}
+
+// Close stops the directory
+func (d *LDAPDirectory) Close() error {
+	return d.listener.Close()
+}
+
+// Binds returns the DNs of every bind attempted, in order
+func (d *LDAPDirectory) Binds() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.binds...)
+}
+
+func (d *LDAPDirectory) serve() {
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			return
+		}
+		go d.handle(conn)
+	}
+}
+
+// handle answers the requests of one connection until it is unbound or closed
+func (d *LDAPDirectory) handle(conn net.Conn) {
+	defer conn.Close()
+
+	bound := false
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldapBindRequest:
+			code := d.bind(op)
+			bound = code == ldapSuccess && ldapString(op.Children[1]) != ""
+			writeLDAPResult(conn, id, ldapBindResponse, code)
+		case ldapSearchRequest:
+			if !bound {
+				writeLDAPResult(conn, id, ldapSearchResultDone, ldapInsufficientAccessRight)
+				continue
+			}
+			entries, code := d.search(op)
+			for _, entry := range entries {
+				writeLDAPEntry(conn, id, entry, op.Children[7])
+			}
+			writeLDAPResult(conn, id, ldapSearchResultDone, code)
+		default:
+			// Unbind, or an operation this directory does not implement
+			return
+		}
+	}
+}
+
+// bind checks a simple bind; an empty DN and password is anonymous
+func (d *LDAPDirectory) bind(op *ber.Packet) int64 {
+	dn := ldapString(op.Children[1])
+	password := op.Children[2].Data.String()
+
+	d.mu.Lock()
+	d.binds = append(d.binds, dn)
+	d.mu.Unlock()
+
+	if dn == "" && password == "" {
+		return ldapSuccess
+	}
+	entry := d.find(dn)
+	if entry == nil || entry.Password == "" || entry.Password != password {
+		return ldapInvalidCredentials
+	}
+	return ldapSuccess
+}
+
+// search returns the entries below the base that match the filter
+func (d *LDAPDirectory) search(op *ber.Packet) ([]LDAPEntry, int64) {
+	base := ldapString(op.Children[0])
+	scope, _ := op.Children[1].Value.(int64)
+	filter := op.Children[6]
+
+	if d.find(base) == nil && !d.hasDescendants(base) {
+		return nil, ldapNoSuchObject
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var matches []LDAPEntry
+	for _, entry := range d.entries {
+		inScope := false
+		switch scope {
+		case 0:
+			inScope = strings.EqualFold(entry.DN, base)
+		case 1:
+			parent := entry.DN[strings.Index(entry.DN, ",")+1:]
+			inScope = strings.EqualFold(parent, base)
+		default:
+			inScope = strings.EqualFold(entry.DN, base) || hasDNSuffix(entry.DN, base)
+		}
+		if inScope && ldapMatch(entry, filter) {
+			matches = append(matches, entry)
+		}
+	}
+	return matches, ldapSuccess
+}
+
+func (d *LDAPDirectory) find(dn string) *LDAPEntry {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range d.entries {
+		if strings.EqualFold(d.entries[i].DN, dn) {
+			return &d.entries[i]
+		}
+	}
+	return nil
+}
+
+func (d *LDAPDirectory) hasDescendants(base string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, entry := range d.entries {
+		if hasDNSuffix(entry.DN, base) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasDNSuffix(dn, base string) bool {
+	return strings.HasSuffix(strings.ToLower(dn), ","+strings.ToLower(base))
+}
+
+// ldapMatch evaluates a search filter against an entry. Unsupported filter
+// types match nothing
+func ldapMatch(entry LDAPEntry, filter *ber.Packet) bool {
+	switch filter.Tag {
+	case 0: // and
+		for _, child := range filter.Children {
+			if !ldapMatch(entry, child) {
+				return false
+			}
+		}
+		return true
+	case 1: // or
+		for _, child := range filter.Children {
+			if ldapMatch(entry, child) {
+				return true
+			}
+		}
+		return false
+	case 2: // not
+		return len(filter.Children) == 1 && !ldapMatch(entry, filter.Children[0])
+	case 3: // equality
+		want := ldapString(filter.Children[1])
+		for _, value := range ldapAttribute(entry, ldapString(filter.Children[0])) {
+			if strings.EqualFold(value, want) {
+				return true
+			}
+		}
+		return false
+	case 7: // present
+		name := filter.Data.String()
+		return strings.EqualFold(name, "objectClass") || len(ldapAttribute(entry, name)) > 0
+	}
+	return false
+}
+
+// ldapAttribute returns an entry's values for an attribute, ignoring case
+func ldapAttribute(entry LDAPEntry, name string) []string {
+	for key, values := range entry.Attributes {
+		if strings.EqualFold(key, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+func ldapString(p *ber.Packet) string {
+	if s, ok := p.Value.(string); ok {
+		return s
+	}
+	return p.Data.String()
+}
+
+func ldapEnvelope(id int64) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+	return packet
+}
+
+func writeLDAPResult(conn net.Conn, id int64, op ber.Tag, code int64) {
+	packet := ldapEnvelope(id)
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, op, nil, "Result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	packet.AppendChild(result)
+	_, _ = conn.Write(packet.Bytes())
+}
+
+// writeLDAPEntry sends an entry with the requested attributes, or all of
+// them when none were requested
+func writeLDAPEntry(conn net.Conn, id int64, entry LDAPEntry, requested *ber.Packet) {
+	packet := ldapEnvelope(id)
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldapSearchResultEntry, nil, "Search Result Entry")
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "Object Name"))
+
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range entry.Attributes {
+		if len(requested.Children) > 0 && !ldapRequested(requested, name) {
+			continue
+		}
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(set)
+		attributes.AppendChild(attribute)
+	}
+	result.AppendChild(attributes)
+	packet.AppendChild(result)
+	_, _ = conn.Write(packet.Bytes())
+}
+
+func ldapRequested(requested *ber.Packet, name string) bool {
+	for _, child := range requested.Children {
+		if strings.EqualFold(ldapString(child), name) {
+			return true
+		}
+	}
+	return false
+}
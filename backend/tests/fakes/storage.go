@@ -0,0 +1,422 @@
+package fakes
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/storage"
+)
+
+// storedMessage is a message held in memory with its expiry
+type storedMessage struct {
+	msg       models.Message
+	expiresAt time.Time
+}
+
+// claim is a message moved out of the main keyspace for one user
+type claim struct {
+	storedMessage
+	userID int64
+	token  string
+}
+
+// readIntent is the read intent token of a message
+type readIntent struct {
+	token     string
+	expiresAt time.Time
+}
+
+// deniedAttempt is one refused access attempt counted by RecordDenied
+type deniedAttempt struct {
+	at time.Time
+	ip string
+}
+
+// notificationWindow is one notification counted by RecordNotification
+type notificationWindow struct {
+	count     int
+	ref       string
+	expiresAt time.Time
+}
+
+// Storage is an in-memory storage.Storage with TTL support
+type Storage struct {
+	mu            sync.Mutex
+	messages      map[string]storedMessage
+	claims        map[string]claim
+	denied        map[string][]deniedAttempt
+	notifications map[string]notificationWindow
+	oauthStates   map[string]time.Time  // expiry by state
+	readIntents   map[string]readIntent // by message ID
+	health        []models.HealthSample
+
+	scanCursors map[uint64]string // last ID listed by each open Scan cursor
+	nextCursor  uint64
+
+	// IDCollisions is how many times StoreWithID still fails with
+	// storage.ErrIDCollision, as if the ID were taken
+	IDCollisions int
+	// DeleteErr, when set, is returned by Delete
+	DeleteErr error
+	// PingErr, when set, is returned by Ping
+	PingErr error
+	// HealthErr, when set, is returned by RecordHealthSample and
+	// HealthSamples
+	HealthErr error
+}
+
+// NewStorage creates an empty in-memory message storage
+func NewStorage() *Storage {
+	return &Storage{
+		messages: make(map[string]storedMessage),
+		claims:   make(map[string]claim),
+		denied:   make(map[string][]deniedAttempt),
+
+		notifications: make(map[string]notificationWindow),
+		oauthStates:   make(map[string]time.Time),
+		readIntents:   make(map[string]readIntent),
+		scanCursors:   make(map[uint64]string),
+	}
+}
+
+// Store saves a message with a TTL and returns a random ID
+func (s *Storage) Store(ctx context.Context, msg *models.Message, ttl time.Duration) (string, error) {
+	id, err := storage.NewID()
+	if err != nil {
+		return "", err
+	}
+	return s.StoreWithID(ctx, id, msg, ttl)
+}
+
+// StoreWithID saves a message under id with a TTL unless a live message
+// has it
+func (s *Storage) StoreWithID(ctx context.Context, id string, msg *models.Message, ttl time.Duration) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.IDCollisions > 0 {
+		s.IDCollisions--
+		return "", storage.ErrIDCollision
+	}
+	if _, taken := s.lookup(id); taken {
+		return "", storage.ErrIDCollision
+	}
+	s.messages[id] = storedMessage{msg: *msg, expiresAt: time.Now().Add(ttl)}
+	return id, nil
+}
+
+// Len returns how many messages are stored, expired ones included
+func (s *Storage) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.messages)
+}
+
+// GetAndDelete atomically retrieves and deletes a message
+func (s *Storage) GetAndDelete(ctx context.Context, id string) (*models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.lookup(id)
+	if !ok {
+		return nil, models.ErrMessageNotFound
+	}
+	delete(s.messages, id)
+	msg := stored.msg
+	return &msg, nil
+}
+
+// Claim moves a message into a claim bound to userID
+func (s *Storage) Claim(ctx context.Context, id string, userID int64, window time.Duration) (string, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.claims[id]; ok && time.Now().Before(c.expiresAt) {
+		if c.userID != userID {
+			return "", time.Time{}, models.ErrMessageClaimed
+		}
+		return c.token, c.expiresAt, nil
+	}
+
+	stored, ok := s.lookup(id)
+	if !ok {
+		return "", time.Time{}, models.ErrMessageNotFound
+	}
+	delete(s.messages, id)
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	stored.expiresAt = time.Now().Add(window)
+	s.claims[id] = claim{storedMessage: stored, userID: userID, token: token}
+	return token, stored.expiresAt, nil
+}
+
+// FetchClaim returns a claimed message, keeping the claim until it lapses
+func (s *Storage) FetchClaim(ctx context.Context, id string, userID int64, token string) (*models.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.claims[id]
+	if !ok || time.Now().After(c.expiresAt) {
+		delete(s.claims, id)
+		return nil, models.ErrClaimNotFound
+	}
+	if c.userID != userID || c.token != token {
+		return nil, models.ErrInvalidClaim
+	}
+	msg := c.msg
+	return &msg, nil
+}
+
+// IssueReadIntent returns the live read intent of a message, or stores a
+// new token that expires after window
+func (s *Storage) IssueReadIntent(ctx context.Context, id string, window time.Duration) (string, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if intent, ok := s.readIntents[id]; ok && time.Now().Before(intent.expiresAt) {
+		return intent.token, intent.expiresAt, nil
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", time.Time{}, err
+	}
+	intent := readIntent{token: base64.RawURLEncoding.EncodeToString(b), expiresAt: time.Now().Add(window)}
+	s.readIntents[id] = intent
+	return intent.token, intent.expiresAt, nil
+}
+
+// TakeReadIntent deletes the read intent of a message if it holds token,
+// reporting whether it was live
+func (s *Storage) TakeReadIntent(ctx context.Context, id, token string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	intent, ok := s.readIntents[id]
+	if !ok || intent.token != token {
+		return false, nil
+	}
+	delete(s.readIntents, id)
+	return time.Now().Before(intent.expiresAt), nil
+}
+
+// Delete removes messages and their claims, counting those still stored
+func (s *Storage) Delete(ctx context.Context, ids []string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.DeleteErr != nil {
+		return 0, s.DeleteErr
+	}
+	deleted := 0
+	for _, id := range ids {
+		_, stored := s.lookup(id)
+		c, claimed := s.claims[id]
+		if stored || (claimed && time.Now().Before(c.expiresAt)) {
+			deleted++
+		}
+		delete(s.messages, id)
+		delete(s.claims, id)
+	}
+	return deleted, nil
+}
+
+// Exists checks if a message exists without burning it
+func (s *Storage) Exists(ctx context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.lookup(id)
+	return ok, nil
+}
+
+// GetTTL returns the remaining TTL of a message
+func (s *Storage) GetTTL(ctx context.Context, id string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.lookup(id)
+	if !ok {
+		return 0, models.ErrMessageNotFound
+	}
+	return time.Until(stored.expiresAt), nil
+}
+
+// RecordDenied counts refused attempts on a message over a sliding window
+func (s *Storage) RecordDenied(ctx context.Context, id, ip string, window time.Duration) (int, []string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var kept []deniedAttempt
+	for _, a := range s.denied[id] {
+		if now.Sub(a.at) < window {
+			kept = append(kept, a)
+		}
+	}
+	kept = append(kept, deniedAttempt{at: now, ip: ip})
+	s.denied[id] = kept
+
+	var sources []string
+	seen := make(map[string]bool)
+	for _, a := range kept {
+		if !seen[a.ip] {
+			seen[a.ip] = true
+			sources = append(sources, a.ip)
+		}
+	}
+	return len(kept), sources, nil
+}
+
+// RecordNotification counts a notification in a window starting at the
+// first one
+func (s *Storage) RecordNotification(ctx context.Context, key string, window time.Duration) (int, string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	w, ok := s.notifications[key]
+	if !ok || now.After(w.expiresAt) {
+		w = notificationWindow{expiresAt: now.Add(window)}
+	}
+	w.count++
+	s.notifications[key] = w
+	return w.count, w.ref, nil
+}
+
+// SetNotificationRef stores the reference of a window still open
+func (s *Storage) SetNotificationRef(ctx context.Context, key, ref string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if w, ok := s.notifications[key]; ok && time.Now().Before(w.expiresAt) {
+		w.ref = ref
+		s.notifications[key] = w
+	}
+	return nil
+}
+
+// ForgetNotification deletes the window of a notification
+func (s *Storage) ForgetNotification(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.notifications, key)
+	return nil
+}
+
+// SaveOAuthState stores an OAuth state that expires after ttl
+func (s *Storage) SaveOAuthState(ctx context.Context, state string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.oauthStates[state] = time.Now().Add(ttl)
+	return nil
+}
+
+// TakeOAuthState deletes an OAuth state, reporting whether it was live
+func (s *Storage) TakeOAuthState(ctx context.Context, state string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiresAt, ok := s.oauthStates[state]
+	delete(s.oauthStates, state)
+	return ok && time.Now().Before(expiresAt), nil
+}
+
+// RecordHealthSample appends a health sample and drops those older than
+// keep
+func (s *Storage) RecordHealthSample(ctx context.Context, sample models.HealthSample, keep time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.HealthErr != nil {
+		return s.HealthErr
+	}
+
+	kept := s.health[:0]
+	for _, old := range s.health {
+		if !old.At.Before(sample.At.Add(-keep)) {
+			kept = append(kept, old)
+		}
+	}
+	s.health = append(kept, sample)
+	sort.Slice(s.health, func(i, j int) bool { return s.health[i].At.Before(s.health[j].At) })
+	return nil
+}
+
+// HealthSamples returns the health samples taken since the given time
+func (s *Storage) HealthSamples(ctx context.Context, since time.Time) ([]models.HealthSample, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.HealthErr != nil {
+		return nil, s.HealthErr
+	}
+
+	samples := []models.HealthSample{}
+	for _, sample := range s.health {
+		if !sample.At.Before(since) {
+			samples = append(samples, sample)
+		}
+	}
+	return samples, nil
+}
+
+// Scan lists live messages in ID order. Like SCAN it lists every message
+// stored throughout the scan even while others are deleted: each cursor
+// resumes after the last ID listed
+func (s *Storage) Scan(ctx context.Context, cursor uint64, count int64) ([]storage.ScannedMessage, uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	after := s.scanCursors[cursor]
+	delete(s.scanCursors, cursor)
+
+	ids := make([]string, 0, len(s.messages))
+	for id := range s.messages {
+		if _, ok := s.lookup(id); ok && id > after {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	var batch []storage.ScannedMessage
+	for _, id := range ids[:min(int(count), len(ids))] {
+		batch = append(batch, storage.ScannedMessage{ID: id, CreatedAt: s.messages[id].msg.CreatedAt})
+	}
+	if len(batch) == len(ids) {
+		return batch, 0, nil
+	}
+	s.nextCursor++
+	s.scanCursors[s.nextCursor] = batch[len(batch)-1].ID
+	return batch, s.nextCursor, nil
+}
+
+// Close is a no-op
+func (s *Storage) Close() error {
+	return nil
+}
+
+// Ping returns PingErr
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.PingErr
+}
+
+// lookup returns a live message, evicting it if expired (caller holds the lock)
+func (s *Storage) lookup(id string) (storedMessage, bool) {
+	stored, ok := s.messages[id]
+	if !ok {
+		return storedMessage{}, false
+	}
+	if time.Now().After(stored.expiresAt) {
+		delete(s.messages, id)
+		return storedMessage{}, false
+	}
+	return stored, true
+}
+
+// Ensure Storage satisfies the storage interface
+var _ storage.Storage = (*Storage)(nil)
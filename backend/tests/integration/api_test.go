@@ -6,20 +6,37 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/auth"
 	"github.com/milkiss/vanish/backend/internal/config"
 	"github.com/milkiss/vanish/backend/internal/models"
 	"github.com/milkiss/vanish/backend/internal/storage"
+	"github.com/milkiss/vanish/backend/tests/fakes"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func setupTestRouter(t *testing.T) (*httptest.Server, func()) {
+// wrapHandler, when set, wraps the router of every test server
+// (see openapi_validation_test.go, built with -tags apivalidation)
+var wrapHandler func(t *testing.T, h http.Handler) http.Handler
+
+// testEnv holds a running test server and tokens for two registered users
+type testEnv struct {
+	server         *httptest.Server
+	senderToken    string
+	recipientToken string
+	recipientID    int64
+}
+
+func setupTestRouter(t *testing.T) (*testEnv, func()) {
 	// Load test config
 	cfg := &config.Config{
 		Server: config.ServerConfig{
-			AllowedOrigins: []string{"*"},
+			AllowedOrigins:  []string{"*"},
+			SecurityHeaders: config.DefaultSecurityHeaders(),
+			TrustedProxies:  []string{"127.0.0.1"}, // the test client stands in for a proxy
 		},
 		JWT: config.JWTConfig{
 			SecretKey: "test-secret-key-for-integration-tests",
@@ -30,43 +47,106 @@ func setupTestRouter(t *testing.T) (*httptest.Server, func()) {
 	store, err := storage.NewRedisStorage("localhost:6379", "", 1)
 	require.NoError(t, err)
 
-	// Create mock repositories (nil for integration tests as we're testing public endpoints)
-	router := api.SetupRouter(cfg, store, nil, nil, nil, nil, nil, nil)
-	server := httptest.NewServer(router)
+	// In-memory repositories stand in for PostgreSQL
+	userStore := fakes.NewUserStore()
+	metadataStore := fakes.NewMetadataStore(userStore)
+	jwtManager := auth.NewJWTManager(cfg.JWT.SecretKey, time.Hour)
+
+	router, err := api.SetupRouter(api.Dependencies{
+		Config:         cfg,
+		Storage:        store,
+		UserStore:      userStore,
+		MetadataStore:  metadataStore,
+		AccessLogStore: fakes.NewAccessLogStore(userStore),
+		JWTManager:     jwtManager,
+	})
+	require.NoError(t, err)
+
+	var handler http.Handler = router
+	if wrapHandler != nil {
+		handler = wrapHandler(t, router)
+	}
+	server := httptest.NewServer(handler)
+
+	env := &testEnv{server: server}
+	env.senderToken, _ = registerUser(t, server.URL, "sender@example.com", "Sender")
+	env.recipientToken, env.recipientID = registerUser(t, server.URL, "recipient@example.com", "Recipient")
 
 	cleanup := func() {
 		server.Close()
 		store.Close()
 	}
 
-	return server, cleanup
+	return env, cleanup
+}
+
+// registerUser registers a user and returns their token and ID
+func registerUser(t *testing.T, baseURL, email, name string) (string, int64) {
+	t.Helper()
+
+	body, _ := json.Marshal(models.RegisterRequest{
+		Email:    email,
+		Name:     name,
+		Password: "password123",
+	})
+	resp, err := http.Post(baseURL+"/api/auth/register", "application/json", bytes.NewBuffer(body))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var authResp models.AuthResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&authResp))
+	return authResp.Token, authResp.User.ID
+}
+
+// doRequest performs an authenticated JSON request
+func doRequest(t *testing.T, method, url, token string, payload interface{}) *http.Response {
+	t.Helper()
+
+	var body *bytes.Buffer
+	if payload != nil {
+		data, _ := json.Marshal(payload)
+		body = bytes.NewBuffer(data)
+	} else {
+		body = &bytes.Buffer{}
+	}
+
+	req, err := http.NewRequest(method, url, body)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
 }
 
 func TestCreateAndRetrieveFlow(t *testing.T) {
-	server, cleanup := setupTestRouter(t)
+	env, cleanup := setupTestRouter(t)
 	defer cleanup()
 
 	// Create a message
 	createReq := models.CreateMessageRequest{
-		Ciphertext: "dGVzdC1jaXBoZXJ0ZXh0", // base64 encoded
-		IV:         "dGVzdC1pdg==",         // base64 encoded
+		Ciphertext:    "dGVzdC1jaXBoZXJ0ZXh0", // base64 encoded
+		IV:            "dGVzdC1pdg==",         // base64 encoded
+		RecipientID:   env.recipientID,
+		EncryptionKey: "test-key",
 	}
 
-	body, _ := json.Marshal(createReq)
-	resp, err := http.Post(server.URL+"/api/messages", "application/json", bytes.NewBuffer(body))
-	require.NoError(t, err)
+	resp := doRequest(t, "POST", env.server.URL+"/api/messages", env.senderToken, createReq)
 	defer resp.Body.Close()
 
 	assert.Equal(t, http.StatusCreated, resp.StatusCode)
 
 	var createResp models.CreateMessageResponse
-	err = json.NewDecoder(resp.Body).Decode(&createResp)
+	err := json.NewDecoder(resp.Body).Decode(&createResp)
 	require.NoError(t, err)
 	assert.NotEmpty(t, createResp.ID)
 
 	// Retrieve the message (burn)
-	getResp, err := http.Get(server.URL + "/api/messages/" + createResp.ID)
-	require.NoError(t, err)
+	getResp := doRequest(t, "GET", env.server.URL+"/api/messages/"+createResp.ID, env.recipientToken, nil)
 	defer getResp.Body.Close()
 
 	assert.Equal(t, http.StatusOK, getResp.StatusCode)
@@ -77,50 +157,55 @@ func TestCreateAndRetrieveFlow(t *testing.T) {
 	assert.Equal(t, createReq.Ciphertext, msgResp.Ciphertext)
 	assert.Equal(t, createReq.IV, msgResp.IV)
 
-	// Try to retrieve again (should be burned)
-	getResp2, err := http.Get(server.URL + "/api/messages/" + createResp.ID)
+	// The burn is described in headers
+	assert.Equal(t, createResp.ID, getResp.Header.Get(api.MessageIDHeader))
+	readAt, err := time.Parse(time.RFC3339, getResp.Header.Get(api.ReadAtHeader))
 	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), readAt, time.Minute)
+	assert.Empty(t, getResp.Header.Get(api.MessageStatusHeader))
+
+	// Try to retrieve again (should be burned)
+	getResp2 := doRequest(t, "GET", env.server.URL+"/api/messages/"+createResp.ID, env.recipientToken, nil)
 	defer getResp2.Body.Close()
 
-	assert.Equal(t, http.StatusNotFound, getResp2.StatusCode)
+	assert.Equal(t, http.StatusGone, getResp2.StatusCode)
+	assert.Equal(t, string(models.StatusRead), getResp2.Header.Get(api.MessageStatusHeader))
+	assert.Empty(t, getResp2.Header.Get(api.MessageIDHeader))
 }
 
 func TestHeadEndpoint(t *testing.T) {
-	server, cleanup := setupTestRouter(t)
+	env, cleanup := setupTestRouter(t)
 	defer cleanup()
 
 	// Create a message
 	createReq := models.CreateMessageRequest{
-		Ciphertext: "dGVzdC1jaXBoZXJ0ZXh0",
-		IV:         "dGVzdC1pdg==",
+		Ciphertext:    "dGVzdC1jaXBoZXJ0ZXh0",
+		IV:            "dGVzdC1pdg==",
+		RecipientID:   env.recipientID,
+		EncryptionKey: "test-key",
 	}
 
-	body, _ := json.Marshal(createReq)
-	resp, err := http.Post(server.URL+"/api/messages", "application/json", bytes.NewBuffer(body))
-	require.NoError(t, err)
+	resp := doRequest(t, "POST", env.server.URL+"/api/messages", env.senderToken, createReq)
 	defer resp.Body.Close()
 
 	var createResp models.CreateMessageResponse
 	json.NewDecoder(resp.Body).Decode(&createResp)
 
 	// Check existence with HEAD (should not burn)
-	req, _ := http.NewRequest("HEAD", server.URL+"/api/messages/"+createResp.ID, nil)
-	headResp, err := http.DefaultClient.Do(req)
-	require.NoError(t, err)
+	headResp := doRequest(t, "HEAD", env.server.URL+"/api/messages/"+createResp.ID, env.recipientToken, nil)
 	defer headResp.Body.Close()
 
 	assert.Equal(t, http.StatusOK, headResp.StatusCode)
 
 	// Message should still be retrievable with GET
-	getResp, err := http.Get(server.URL + "/api/messages/" + createResp.ID)
-	require.NoError(t, err)
+	getResp := doRequest(t, "GET", env.server.URL+"/api/messages/"+createResp.ID, env.recipientToken, nil)
 	defer getResp.Body.Close()
 
 	assert.Equal(t, http.StatusOK, getResp.StatusCode)
 }
 
 func TestInvalidInput(t *testing.T) {
-	server, cleanup := setupTestRouter(t)
+	env, cleanup := setupTestRouter(t)
 	defer cleanup()
 
 	tests := []struct {
@@ -146,18 +231,22 @@ func TestInvalidInput(t *testing.T) {
 		{
 			name: "invalid TTL (too short)",
 			payload: map[string]interface{}{
-				"ciphertext": "dGVzdC1jaXBoZXJ0ZXh0",
-				"iv":         "dGVzdC1pdg==",
-				"ttl":        100, // Less than MinTTL
+				"ciphertext":     "dGVzdC1jaXBoZXJ0ZXh0",
+				"iv":             "dGVzdC1pdg==",
+				"ttl":            100, // Less than MinTTL
+				"recipient_id":   env.recipientID,
+				"encryption_key": "test-key",
 			},
 			expected: http.StatusBadRequest,
 		},
 		{
 			name: "invalid TTL (too long)",
 			payload: map[string]interface{}{
-				"ciphertext": "dGVzdC1jaXBoZXJ0ZXh0",
-				"iv":         "dGVzdC1pdg==",
-				"ttl":        999999999, // More than MaxTTL
+				"ciphertext":     "dGVzdC1jaXBoZXJ0ZXh0",
+				"iv":             "dGVzdC1pdg==",
+				"ttl":            999999999, // More than MaxTTL
+				"recipient_id":   env.recipientID,
+				"encryption_key": "test-key",
 			},
 			expected: http.StatusBadRequest,
 		},
@@ -165,9 +254,7 @@ func TestInvalidInput(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			body, _ := json.Marshal(tt.payload)
-			resp, err := http.Post(server.URL+"/api/messages", "application/json", bytes.NewBuffer(body))
-			require.NoError(t, err)
+			resp := doRequest(t, "POST", env.server.URL+"/api/messages", env.senderToken, tt.payload)
 			defer resp.Body.Close()
 
 			assert.Equal(t, tt.expected, resp.StatusCode)
@@ -176,10 +263,10 @@ func TestInvalidInput(t *testing.T) {
 }
 
 func TestHealthEndpoint(t *testing.T) {
-	server, cleanup := setupTestRouter(t)
+	env, cleanup := setupTestRouter(t)
 	defer cleanup()
 
-	resp, err := http.Get(server.URL + "/health")
+	resp, err := http.Get(env.server.URL + "/health")
 	require.NoError(t, err)
 	defer resp.Body.Close()
 
@@ -192,10 +279,10 @@ func TestHealthEndpoint(t *testing.T) {
 }
 
 func TestCORS(t *testing.T) {
-	server, cleanup := setupTestRouter(t)
+	env, cleanup := setupTestRouter(t)
 	defer cleanup()
 
-	req, _ := http.NewRequest("OPTIONS", server.URL+"/api/messages", nil)
+	req, _ := http.NewRequest("OPTIONS", env.server.URL+"/api/messages", nil)
 	req.Header.Set("Origin", "http://localhost:5173")
 	req.Header.Set("Access-Control-Request-Method", "POST")
 
@@ -209,10 +296,10 @@ func TestCORS(t *testing.T) {
 }
 
 func TestSecurityHeaders(t *testing.T) {
-	server, cleanup := setupTestRouter(t)
+	env, cleanup := setupTestRouter(t)
 	defer cleanup()
 
-	resp, err := http.Get(server.URL + "/health")
+	resp, err := http.Get(env.server.URL + "/health")
 	require.NoError(t, err)
 	defer resp.Body.Close()
 
@@ -220,5 +307,16 @@ func TestSecurityHeaders(t *testing.T) {
 	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
 	assert.Equal(t, "DENY", resp.Header.Get("X-Frame-Options"))
 	assert.Equal(t, "1; mode=block", resp.Header.Get("X-XSS-Protection"))
+	assert.NotEmpty(t, resp.Header.Get("Permissions-Policy"))
+
+	// Plain HTTP: HSTS is meaningless and must not be sent
+	assert.Empty(t, resp.Header.Get("Strict-Transport-Security"))
+
+	// Behind a TLS-terminating proxy
+	req, _ := http.NewRequest("GET", env.server.URL+"/health", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
 	assert.NotEmpty(t, resp.Header.Get("Strict-Transport-Security"))
 }
@@ -0,0 +1,199 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/backup"
+	"github.com/milkiss/vanish/backend/internal/database"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const restorePassphrase = "correct horse battery staple"
+
+// backedUpTables are the tables a backup holds, in restore order
+var backedUpTables = []string{
+	"users", "api_keys", "message_metadata", "ttl_policy_rules",
+	"category_policies", "banned_domains", "dlp_patterns", "slack_installations",
+}
+
+// freshDB creates an empty database with the schema, dropped after the
+// test, and skips the test when the DB_USER may not create databases
+func freshDB(t *testing.T) *sql.DB {
+	t.Helper()
+	server := postgresDB(t)
+	name := "vanish_restore_" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	if _, err := server.Exec(`CREATE DATABASE ` + name); err != nil {
+		t.Skipf("cannot create a database: %v", err)
+	}
+
+	cfg := postgresConfig(t)
+	cfg.DBName = name
+	db, err := database.NewPostgresDB(cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		db.Close()
+		_, _ = server.Exec(`DROP DATABASE ` + name)
+	})
+	require.NoError(t, database.InitSchema(db))
+	return db
+}
+
+// seedBackupSource fills db with accounts, messages and settings and
+// returns the admin and a sender
+func seedBackupSource(t *testing.T, db *sql.DB) (admin, sender *models.User) {
+	t.Helper()
+	ctx := context.Background()
+	users := repository.NewUserRepository(db)
+
+	admin = &models.User{Email: "admin@example.com", Name: "Admin", Password: "$2a$10$hash", IsAdmin: true, IsActive: true}
+	sender = &models.User{Email: "alice@example.com", Name: "Alice", Region: "eu", IsActive: true}
+	recipient := &models.User{Email: "bob@example.com", Name: "Bob", IsActive: true}
+	service := &models.User{Email: "ci@service.local", Name: "CI", IsService: true, IsActive: true}
+	for _, u := range []*models.User{admin, sender, recipient, service} {
+		require.NoError(t, users.Create(ctx, u))
+	}
+	hash := sha256.Sum256([]byte("vk_restore"))
+	require.NoError(t, users.CreateAPIKey(ctx, &models.APIKey{UserID: service.ID, Name: "ci", Prefix: "vk_rest", Hash: hex.EncodeToString(hash[:])}))
+
+	for i, status := range []string{"pending", "read", "expired"} {
+		_, err := db.ExecContext(ctx,
+			`INSERT INTO message_metadata (message_id, sender_id, recipient_id, status, expires_at, category)
+			 VALUES ($1, $2, $3, $4, NOW() + INTERVAL '1 hour', 'credentials')`,
+			"restore-"+strconv.Itoa(i), sender.ID, recipient.ID, status)
+		require.NoError(t, err)
+	}
+	_, err := db.ExecContext(ctx,
+		`INSERT INTO message_metadata (message_id, sender_id, external_recipient_email, expires_at)
+		 VALUES ('restore-external', $1, 'guest@partner.example', NOW() + INTERVAL '1 hour')`, sender.ID)
+	require.NoError(t, err)
+
+	policies := repository.NewTTLPolicyRepository(db)
+	require.NoError(t, policies.CreateTTLPolicy(ctx, &models.TTLPolicyRule{RecipientDomainGlob: "*.partner.example", DefaultTTL: 600, MaxTTL: 3600}, nil))
+	_, err = policies.PutCategoryPolicy(ctx, &models.CategoryPolicy{Category: "credentials", DefaultTTL: 900, MaxTTL: 1800, NotificationStyle: models.NotificationStandard})
+	require.NoError(t, err)
+	_, err = policies.PutBannedDomain(ctx, &models.BannedDomain{Domain: "mailinator.com", Reason: "disposable"})
+	require.NoError(t, err)
+	_, err = policies.PutDLPPattern(ctx, &models.DLPPattern{Name: "aws", Pattern: `AKIA[0-9A-Z]{16}`, Description: "AWS access key"})
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `INSERT INTO slack_installations (team_id, team_name, bot_token) VALUES ('T123', 'Acme', 'sealed-token')`)
+	require.NoError(t, err)
+
+	// Neither is backed up
+	_, err = db.ExecContext(ctx, `INSERT INTO access_log (message_id, user_id, action, outcome) VALUES ('restore-1', $1, 'read', 'read')`, recipient.ID)
+	require.NoError(t, err)
+	_, err = db.ExecContext(ctx, `INSERT INTO digest_events (kind) VALUES ('abuse_alert')`)
+	require.NoError(t, err)
+	return admin, sender
+}
+
+func tableCounts(t *testing.T, db *sql.DB) map[string]int64 {
+	t.Helper()
+	counts := make(map[string]int64, len(backedUpTables))
+	for _, table := range backedUpTables {
+		var n int64
+		require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM `+table).Scan(&n))
+		counts[table] = n
+	}
+	return counts
+}
+
+// takeBackup backs up db
+func takeBackup(t *testing.T, db *sql.DB) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	dst, err := backup.NewWriter(&buf, restorePassphrase)
+	require.NoError(t, err)
+	require.NoError(t, repository.NewBackupRepository(db).Export(context.Background(), dst))
+	require.NoError(t, dst.Close())
+	return buf.Bytes()
+}
+
+func restoreBackup(db *sql.DB, data []byte) error {
+	src, err := backup.NewReader(bytes.NewReader(data), restorePassphrase)
+	if err != nil {
+		return err
+	}
+	return repository.NewBackupRepository(db).Restore(context.Background(), src)
+}
+
+func TestBackupRepository_RoundTrip(t *testing.T) {
+	source := freshDB(t)
+	admin, sender := seedBackupSource(t, source)
+	data := takeBackup(t, source)
+
+	target := freshDB(t)
+	require.NoError(t, restoreBackup(target, data))
+
+	ctx := context.Background()
+	want := tableCounts(t, source)
+	assert.Equal(t, int64(4), want["users"])
+	assert.Equal(t, want, tableCounts(t, target))
+
+	// Rows keep their IDs and every column
+	sourceUsers, targetUsers := repository.NewUserRepository(source), repository.NewUserRepository(target)
+	for _, u := range []*models.User{admin, sender} {
+		before, err := sourceUsers.FindByID(ctx, u.ID)
+		require.NoError(t, err)
+		after, err := targetUsers.FindByID(ctx, u.ID)
+		require.NoError(t, err)
+		assert.Equal(t, before, after)
+	}
+
+	metadata := repository.NewMetadataRepository(target, nil)
+	for _, id := range []string{"restore-0", "restore-external"} {
+		before, err := repository.NewMetadataRepository(source, nil).FindByMessageID(ctx, id)
+		require.NoError(t, err)
+		after, err := metadata.FindByMessageID(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, before, after)
+	}
+
+	// The restored settings replace the seeded ones
+	policy, err := repository.NewTTLPolicyRepository(target).GetCategoryPolicy(ctx, "credentials")
+	require.NoError(t, err)
+	assert.Equal(t, int64(900), policy.DefaultTTL)
+	assert.Equal(t, models.NotificationStandard, policy.NotificationStyle)
+
+	// History is not backed up
+	var accessLog, digestEvents int
+	require.NoError(t, target.QueryRow(`SELECT COUNT(*) FROM access_log`).Scan(&accessLog))
+	require.NoError(t, target.QueryRow(`SELECT COUNT(*) FROM digest_events`).Scan(&digestEvents))
+	assert.Zero(t, accessLog+digestEvents)
+
+	// New rows get IDs after the restored ones
+	newcomer := &models.User{Email: "carol@example.com", Name: "Carol", IsActive: true}
+	require.NoError(t, targetUsers.Create(ctx, newcomer))
+	var maxID int64
+	require.NoError(t, source.QueryRow(`SELECT MAX(id) FROM users`).Scan(&maxID))
+	assert.Greater(t, newcomer.ID, maxID)
+}
+
+func TestBackupRepository_RestoreRefusals(t *testing.T) {
+	source := freshDB(t)
+	seedBackupSource(t, source)
+	data := takeBackup(t, source)
+
+	// Into a database with data, nothing is changed
+	before := tableCounts(t, source)
+	assert.ErrorIs(t, restoreBackup(source, data), backup.ErrNotEmpty)
+	assert.Equal(t, before, tableCounts(t, source))
+
+	target := freshDB(t)
+	_, err := backup.NewReader(bytes.NewReader(data), "not the passphrase at all")
+	assert.ErrorIs(t, err, backup.ErrDecrypt)
+
+	// A truncated backup restores nothing
+	assert.ErrorIs(t, restoreBackup(target, data[:len(data)-100]), backup.ErrTruncated)
+	assert.Equal(t, int64(0), tableCounts(t, target)["users"])
+	assert.Equal(t, int64(2), tableCounts(t, target)["category_policies"], "seeded policies are kept")
+}
@@ -0,0 +1,203 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/auth"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type externalEnv struct {
+	url         string
+	jwtManager  *auth.JWTManager
+	metadata    *fakes.MetadataStore
+	senderToken string
+	userToken   string // a signed-in user who is not the recipient
+}
+
+func setupExternal(t *testing.T, enabled bool) *externalEnv {
+	users := fakes.NewUserStore()
+	metadata := fakes.NewMetadataStore(users)
+	jwtManager := auth.NewJWTManager("test-secret", time.Hour)
+
+	router, err := api.SetupRouter(api.Dependencies{
+		Config: &config.Config{
+			Server:  config.ServerConfig{AllowedOrigins: []string{"*"}},
+			Message: config.MessageConfig{ExternalRecipients: enabled},
+		},
+		Storage:        fakes.NewStorage(),
+		UserStore:      users,
+		MetadataStore:  metadata,
+		AccessLogStore: fakes.NewAccessLogStore(users),
+		JWTManager:     jwtManager,
+	})
+	require.NoError(t, err)
+	var handler http.Handler = router
+	if wrapHandler != nil {
+		handler = wrapHandler(t, router)
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	env := &externalEnv{url: server.URL, jwtManager: jwtManager, metadata: metadata}
+	env.senderToken, _ = registerUser(t, server.URL, "sender@example.com", "Sender")
+	env.userToken, _ = registerUser(t, server.URL, "colleague@example.com", "Colleague")
+	return env
+}
+
+// sendExternal creates a message for contractor@partner.example
+func (e *externalEnv) sendExternal(t *testing.T) models.CreateMessageResponse {
+	t.Helper()
+	resp := doRequest(t, "POST", e.url+"/api/v1/messages", e.senderToken, models.CreateMessageRequest{
+		Ciphertext:             "dGVzdC1jaXBoZXJ0ZXh0",
+		IV:                     "dGVzdC1pdg==",
+		EncryptionKey:          "test-key",
+		ExternalRecipientEmail: "Contractor@Partner.example",
+	})
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+
+	var created models.CreateMessageResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	require.NotEmpty(t, created.AccessToken)
+	return created
+}
+
+// readWithToken reads message id as an external recipient, without a session
+func (e *externalEnv) readWithToken(t *testing.T, id, token string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest("GET", e.url+"/api/v1/messages/"+id, nil)
+	require.NoError(t, err)
+	req.Header.Set(api.MessageAccessHeader, token)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func errorCode(t *testing.T, resp *http.Response) string {
+	t.Helper()
+	var body models.ErrorResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return body.Code
+}
+
+func TestExternalRecipient_ReadsWithSignedLink(t *testing.T) {
+	env := setupExternal(t, true)
+	created := env.sendExternal(t)
+
+	metadata, err := env.metadata.FindByMessageID(context.Background(), created.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "contractor@partner.example", metadata.ExternalRecipientEmail, "recorded for the audit trail")
+	assert.Zero(t, metadata.RecipientID)
+
+	// Signing in does not make anyone the recipient
+	resp := doRequest(t, "GET", env.url+"/api/v1/messages/"+created.ID, env.userToken, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+	resp = doRequest(t, "GET", env.url+"/api/v1/messages/"+created.ID, "", nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp = env.readWithToken(t, created.ID, created.AccessToken)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var msg models.MessageResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&msg))
+	assert.Equal(t, "dGVzdC1jaXBoZXJ0ZXh0", msg.Ciphertext)
+
+	// The token is not stored; burning the message is what uses it up
+	resp = env.readWithToken(t, created.ID, created.AccessToken)
+	assert.Equal(t, http.StatusGone, resp.StatusCode)
+
+	statusResp := doRequest(t, "GET", env.url+"/api/v1/messages/"+created.ID+"/status", env.senderToken, nil)
+	defer statusResp.Body.Close()
+	var status models.MessageStatusResponse
+	require.NoError(t, json.NewDecoder(statusResp.Body).Decode(&status))
+	assert.Equal(t, models.StatusRead, status.Status)
+	assert.Equal(t, "contractor@partner.example", status.ExternalRecipientEmail)
+}
+
+func TestExternalRecipient_RejectsBadTokens(t *testing.T) {
+	env := setupExternal(t, true)
+	created := env.sendExternal(t)
+	other := env.sendExternal(t)
+
+	for name, token := range map[string]string{
+		"tampered":          created.AccessToken[:len(created.AccessToken)-2] + "xx",
+		"expired":           env.jwtManager.SignMessageAccess(created.ID, time.Now().Add(-time.Minute)),
+		"for another":       other.AccessToken,
+		"from another key":  auth.NewJWTManager("other-secret", time.Hour).SignMessageAccess(created.ID, time.Now().Add(time.Hour)),
+		"a session instead": env.userToken,
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp := env.readWithToken(t, created.ID, token)
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+			assert.Equal(t, models.ErrorCodeInvalidAccessToken, errorCode(t, resp))
+		})
+	}
+
+	// None of them burned the message
+	resp := env.readWithToken(t, created.ID, created.AccessToken)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestExternalRecipient_RegisteredMessagesNeedASession(t *testing.T) {
+	env := setupExternal(t, true)
+	_, recipientID := registerUser(t, env.url, "recipient@example.com", "Recipient")
+
+	resp := doRequest(t, "POST", env.url+"/api/v1/messages", env.senderToken, models.CreateMessageRequest{
+		Ciphertext: "dGVzdC1jaXBoZXJ0ZXh0", IV: "dGVzdC1pdg==", EncryptionKey: "test-key", RecipientID: recipientID,
+	})
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	var created models.CreateMessageResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&created))
+	assert.Empty(t, created.AccessToken)
+
+	// A validly signed token does not open a message with an account holder
+	// as recipient
+	read := env.readWithToken(t, created.ID, env.jwtManager.SignMessageAccess(created.ID, created.ExpiresAt))
+	assert.Equal(t, http.StatusForbidden, read.StatusCode)
+	assert.Equal(t, models.ErrorCodeNotRecipient, errorCode(t, read))
+}
+
+func TestExternalRecipient_Validation(t *testing.T) {
+	env := setupExternal(t, true)
+
+	for name, req := range map[string]models.CreateMessageRequest{
+		"both recipients": {Ciphertext: "dGVzdA==", IV: "aXY=", EncryptionKey: "k", RecipientID: 2, ExternalRecipientEmail: "a@b.example"},
+		"neither":         {Ciphertext: "dGVzdA==", IV: "aXY=", EncryptionKey: "k"},
+		"not an address":  {Ciphertext: "dGVzdA==", IV: "aXY=", EncryptionKey: "k", ExternalRecipientEmail: "contractor"},
+		"sealed key":      {Ciphertext: "dGVzdA==", IV: "aXY=", SealedKey: "c2VhbGVk", ExternalRecipientEmail: "a@b.example"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp := doRequest(t, "POST", env.url+"/api/v1/messages", env.senderToken, req)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		})
+	}
+}
+
+func TestExternalRecipient_Disabled(t *testing.T) {
+	env := setupExternal(t, false)
+
+	resp := doRequest(t, "POST", env.url+"/api/v1/messages", env.senderToken, models.CreateMessageRequest{
+		Ciphertext: "dGVzdA==", IV: "aXY=", EncryptionKey: "k", ExternalRecipientEmail: "contractor@partner.example",
+	})
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// The header is ignored: without a session there is no way in
+	read := env.readWithToken(t, "aaaaaaaaaaaaaaaaaaaaaaaaaa", env.jwtManager.SignMessageAccess("aaaaaaaaaaaaaaaaaaaaaaaaaa", time.Now().Add(time.Hour)))
+	assert.Equal(t, http.StatusUnauthorized, read.StatusCode)
+}
@@ -0,0 +1,105 @@
+package integration
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/auth"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testIndexHTML = `<!doctype html><div id="root"></div><script type="module" src="/assets/index-3f2a1b.js"></script>`
+
+// setupFrontendRouter starts a Vanish server that also serves a stand-in
+// for the built frontend
+func setupFrontendRouter(t *testing.T) *httptest.Server {
+	cfg := &config.Config{
+		Server: config.ServerConfig{
+			AllowedOrigins:  []string{"*"},
+			FrontendBaseURL: "http://localhost:5173",
+			ServeFrontend:   true,
+			SecurityHeaders: config.SecurityHeadersConfig{
+				ContentSecurityPolicy: config.DefaultFrontendContentSecurityPolicy,
+			},
+		},
+	}
+
+	users := fakes.NewUserStore()
+	router, err := api.SetupRouter(api.Dependencies{
+		Config:         cfg,
+		Storage:        fakes.NewStorage(),
+		UserStore:      users,
+		MetadataStore:  fakes.NewMetadataStore(users),
+		AccessLogStore: fakes.NewAccessLogStore(users),
+		JWTManager:     auth.NewJWTManager("test-secret", time.Hour),
+		Frontend: fstest.MapFS{
+			"index.html":             {Data: []byte(testIndexHTML)},
+			"vite.svg":               {Data: []byte("<svg/>")},
+			"assets/index-3f2a1b.js": {Data: []byte("console.log('vanish')")},
+		},
+	})
+	require.NoError(t, err)
+
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFrontend_ServesApp(t *testing.T) {
+	server := setupFrontendRouter(t)
+
+	get := func(path string) (*http.Response, string) {
+		resp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(body)
+	}
+
+	tests := []struct {
+		name         string
+		path         string
+		expected     int
+		body         string
+		cacheControl string
+	}{
+		{"root", "/", http.StatusOK, testIndexHTML, "no-store"},
+		{"client route", "/m/whatever", http.StatusOK, testIndexHTML, "no-store"},
+		{"nested client route", "/admin/users", http.StatusOK, testIndexHTML, "no-store"},
+		{"hashed asset", "/assets/index-3f2a1b.js", http.StatusOK, "console.log('vanish')", "public, max-age=31536000, immutable"},
+		{"unhashed file", "/vite.svg", http.StatusOK, "<svg/>", "no-cache"},
+		{"missing asset", "/assets/index-000000.js", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := get(tt.path)
+			assert.Equal(t, tt.expected, resp.StatusCode)
+			assert.Equal(t, tt.cacheControl, resp.Header.Get("Cache-Control"))
+			if tt.body != "" {
+				assert.Equal(t, tt.body, body)
+			}
+			assert.Equal(t, config.DefaultFrontendContentSecurityPolicy, resp.Header.Get("Content-Security-Policy"))
+		})
+	}
+
+	// The API and health check keep their own routes
+	resp, body := get("/health")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, body, "healthy")
+
+	resp, _ = get("/api/v1/versions-that-do-not-exist")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, _ = get("/api/v1/auth/me")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
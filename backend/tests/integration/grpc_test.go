@@ -0,0 +1,289 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/auth"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/grpcapi"
+	"github.com/milkiss/vanish/backend/internal/grpcapi/vanishv1"
+	"github.com/milkiss/vanish/backend/internal/messages"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+)
+
+// grpcEnv is a gRPC server and an HTTP server sharing the same stores
+type grpcEnv struct {
+	client     vanishv1.VanishServiceClient
+	conn       *grpc.ClientConn
+	http       *httptest.Server
+	jwtManager *auth.JWTManager
+	users      *fakes.UserStore
+}
+
+// setupGRPC starts both servers over fakes with a sender (1), a recipient
+// (2) and a service account (3) whose API key is returned
+func setupGRPC(t *testing.T) (*grpcEnv, string) {
+	ctx := context.Background()
+	users := fakes.NewUserStore()
+	for _, u := range []*models.User{
+		{Email: "sender@example.com", Name: "Sender"},
+		{Email: "recipient@example.com", Name: "Recipient"},
+		{Email: "deploy@service.local", Name: "deploy-bot", IsService: true},
+	} {
+		require.NoError(t, users.Create(ctx, u))
+	}
+	key, hash, err := models.GenerateAPIKey()
+	require.NoError(t, err)
+	require.NoError(t, users.CreateAPIKey(ctx, &models.APIKey{UserID: 3, Name: "ci", Prefix: models.APIKeyDisplayPrefix(key), Hash: hash}))
+
+	store := fakes.NewStorage()
+	metadataRepo := fakes.NewMetadataStore(users)
+	jwtManager := auth.NewJWTManager("test-secret", time.Hour)
+
+	router, err := api.SetupRouter(api.Dependencies{
+		Config:         &config.Config{Server: config.ServerConfig{AllowedOrigins: []string{"*"}}},
+		Storage:        store,
+		UserStore:      users,
+		MetadataStore:  metadataRepo,
+		AccessLogStore: fakes.NewAccessLogStore(users),
+		JWTManager:     jwtManager,
+	})
+	require.NoError(t, err)
+	httpServer := httptest.NewServer(router)
+	t.Cleanup(httpServer.Close)
+
+	server := grpcapi.NewServer(grpcapi.Dependencies{
+		Messages:   messages.NewService(store, metadataRepo, 0, nil, nil),
+		UserStore:  users,
+		JWTManager: jwtManager,
+	})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return &grpcEnv{
+		client:     vanishv1.NewVanishServiceClient(conn),
+		conn:       conn,
+		http:       httpServer,
+		jwtManager: jwtManager,
+		users:      users,
+	}, key
+}
+
+// as returns a context whose calls carry token
+func as(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+// token returns a JWT for user id
+func (e *grpcEnv) token(t *testing.T, id int64) string {
+	user, err := e.users.FindByID(context.Background(), id)
+	require.NoError(t, err)
+	token, err := e.jwtManager.Generate(user.ID, user.Email)
+	require.NoError(t, err)
+	return token
+}
+
+// readOverHTTP burns message id as the recipient through the HTTP API
+func (e *grpcEnv) readOverHTTP(t *testing.T, id string) (int, models.MessageResponse) {
+	req, _ := http.NewRequest("GET", e.http.URL+"/api/v1/messages/"+id, nil)
+	req.Header.Set("Authorization", "Bearer "+e.token(t, 2))
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	var msg models.MessageResponse
+	if resp.StatusCode == http.StatusOK {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&msg))
+	}
+	return resp.StatusCode, msg
+}
+
+// assertRPCError checks the status code and Vanish error code of err
+func assertRPCError(t *testing.T, err error, code codes.Code, reason string) {
+	t.Helper()
+	st, ok := status.FromError(err)
+	require.True(t, ok, "expected a gRPC status, got %v", err)
+	assert.Equal(t, code, st.Code())
+
+	for _, d := range st.Details() {
+		if info, ok := d.(*errdetails.ErrorInfo); ok {
+			assert.Equal(t, reason, info.Reason)
+			assert.NotEmpty(t, info.Metadata["request_id"])
+			return
+		}
+	}
+	t.Errorf("no ErrorInfo detail in %v", err)
+}
+
+func TestGRPC_CreateAndRead(t *testing.T) {
+	env, _ := setupGRPC(t)
+	ctx := as(env.token(t, 1))
+
+	ttl := int64(3600)
+	var header metadata.MD
+	created, err := env.client.CreateMessage(ctx, &vanishv1.CreateMessageRequest{
+		RecipientId:   2,
+		Ciphertext:    "Y2lwaGVydGV4dA==",
+		Iv:            "aXY=",
+		EncryptionKey: "link-key",
+		TtlSeconds:    &ttl,
+	}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.NotEmpty(t, created.Id)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), created.ExpiresAt.AsTime(), 5*time.Second)
+	assert.Nil(t, created.AvailableAt)
+	assert.NotEmpty(t, header.Get("x-request-id"), "calls get a request ID like HTTP requests")
+
+	messageStatus, err := env.client.GetMessageStatus(ctx, &vanishv1.GetMessageStatusRequest{Id: created.Id})
+	require.NoError(t, err)
+	assert.Equal(t, vanishv1.Status_STATUS_PENDING, messageStatus.Status)
+	assert.Equal(t, int64(1), messageStatus.SenderId)
+	assert.Equal(t, int64(2), messageStatus.RecipientId)
+	assert.Nil(t, messageStatus.ReadAt)
+
+	// The recipient reads it through the HTTP API as usual
+	code, msg := env.readOverHTTP(t, created.Id)
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "Y2lwaGVydGV4dA==", msg.Ciphertext)
+	assert.Equal(t, "aXY=", msg.IV)
+
+	messageStatus, err = env.client.GetMessageStatus(ctx, &vanishv1.GetMessageStatusRequest{Id: created.Id})
+	require.NoError(t, err)
+	assert.Equal(t, vanishv1.Status_STATUS_READ, messageStatus.Status)
+	assert.NotNil(t, messageStatus.ReadAt)
+
+	// Nobody else may look at it
+	_, err = env.client.GetMessageStatus(as(env.token(t, 3)), &vanishv1.GetMessageStatusRequest{Id: created.Id})
+	assertRPCError(t, err, codes.PermissionDenied, models.ErrorCodeForbidden)
+}
+
+func TestGRPC_Authentication(t *testing.T) {
+	env, apiKey := setupGRPC(t)
+	req := &vanishv1.ListUsersRequest{}
+
+	_, err := env.client.ListUsers(context.Background(), req)
+	assertRPCError(t, err, codes.Unauthenticated, models.ErrorCodeUnauthorized)
+
+	_, err = env.client.ListUsers(metadata.AppendToOutgoingContext(context.Background(), "authorization", "Basic abc"), req)
+	assertRPCError(t, err, codes.Unauthenticated, models.ErrorCodeUnauthorized)
+
+	_, err = env.client.ListUsers(as("not-a-jwt"), req)
+	assertRPCError(t, err, codes.Unauthenticated, models.ErrorCodeUnauthorized)
+
+	_, err = env.client.ListUsers(as(models.APIKeyPrefix+"unknown"), req)
+	assertRPCError(t, err, codes.Unauthenticated, models.ErrorCodeUnauthorized)
+
+	// Service accounts authenticate with their API key
+	resp, err := env.client.ListUsers(as(apiKey), req)
+	require.NoError(t, err)
+	names := []string{}
+	for _, u := range resp.Users {
+		names = append(names, u.Name)
+	}
+	assert.Equal(t, []string{"Recipient", "Sender"}, names, "service accounts are not recipients")
+
+	created, err := env.client.CreateMessage(as(apiKey), &vanishv1.CreateMessageRequest{
+		RecipientId: 2, Ciphertext: "Y2lwaGVydGV4dA==", Iv: "aXY=", EncryptionKey: "link-key",
+	})
+	require.NoError(t, err)
+	messageStatus, err := env.client.GetMessageStatus(as(apiKey), &vanishv1.GetMessageStatusRequest{Id: created.Id})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), messageStatus.SenderId)
+
+	// Tokens of deactivated accounts are refused
+	token := env.token(t, 1)
+	sender, err := env.users.FindByID(context.Background(), 1)
+	require.NoError(t, err)
+	sender.IsActive = false
+	require.NoError(t, env.users.Update(context.Background(), sender))
+	_, err = env.client.ListUsers(as(token), req)
+	assertRPCError(t, err, codes.Unauthenticated, models.ErrorCodeAccountInactive)
+}
+
+func TestGRPC_CreateValidation(t *testing.T) {
+	env, _ := setupGRPC(t)
+	ctx := as(env.token(t, 1))
+
+	_, err := env.client.CreateMessage(ctx, &vanishv1.CreateMessageRequest{RecipientId: 2, Iv: "aXY=", EncryptionKey: "k"})
+	assertRPCError(t, err, codes.InvalidArgument, models.ErrorCodeValidationFailed)
+	assert.Contains(t, status.Convert(err).Message(), "ciphertext is required")
+
+	tooLong := int64(models.MaxTTL + 1)
+	_, err = env.client.CreateMessage(ctx, &vanishv1.CreateMessageRequest{
+		RecipientId: 2, Ciphertext: "Y2lwaGVydGV4dA==", Iv: "aXY=", EncryptionKey: "k", TtlSeconds: &tooLong,
+	})
+	assertRPCError(t, err, codes.InvalidArgument, models.ErrorCodeTTLOutOfRange)
+}
+
+func TestGRPC_Revoke(t *testing.T) {
+	env, _ := setupGRPC(t)
+	ctx := as(env.token(t, 1))
+
+	created, err := env.client.CreateMessage(ctx, &vanishv1.CreateMessageRequest{
+		RecipientId: 2, Ciphertext: "Y2lwaGVydGV4dA==", Iv: "aXY=", EncryptionKey: "link-key",
+	})
+	require.NoError(t, err)
+
+	// Only the sender can revoke
+	_, err = env.client.Revoke(as(env.token(t, 2)), &vanishv1.RevokeRequest{Id: created.Id})
+	assertRPCError(t, err, codes.PermissionDenied, models.ErrorCodeForbidden)
+
+	_, err = env.client.Revoke(ctx, &vanishv1.RevokeRequest{Id: created.Id})
+	require.NoError(t, err)
+
+	messageStatus, err := env.client.GetMessageStatus(ctx, &vanishv1.GetMessageStatusRequest{Id: created.Id})
+	require.NoError(t, err)
+	assert.Equal(t, vanishv1.Status_STATUS_EXPIRED, messageStatus.Status)
+
+	code, _ := env.readOverHTTP(t, created.Id)
+	assert.Equal(t, http.StatusGone, code)
+
+	_, err = env.client.Revoke(ctx, &vanishv1.RevokeRequest{Id: created.Id})
+	assertRPCError(t, err, codes.NotFound, models.ErrorCodeMessageNotFound)
+
+	_, err = env.client.Revoke(ctx, &vanishv1.RevokeRequest{Id: "not an id"})
+	assertRPCError(t, err, codes.InvalidArgument, models.ErrorCodeInvalidMessageID)
+}
+
+func TestGRPC_Reflection(t *testing.T) {
+	env, _ := setupGRPC(t)
+
+	// What grpcurl list does; reflection needs no credentials
+	stream, err := reflectionpb.NewServerReflectionClient(env.conn).ServerReflectionInfo(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_ListServices{},
+	}))
+	resp, err := stream.Recv()
+	require.NoError(t, err)
+	require.NoError(t, stream.CloseSend())
+
+	services := []string{}
+	for _, s := range resp.GetListServicesResponse().GetService() {
+		services = append(services, s.Name)
+	}
+	assert.Contains(t, services, "vanish.v1.VanishService")
+}
@@ -0,0 +1,48 @@
+//go:build apivalidation
+
+package integration
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/milkiss/vanish/backend/internal/openapi"
+)
+
+// Validate every response served during the integration run against
+// the OpenAPI specification:
+//
+//	go test -tags apivalidation ./tests/integration/...
+func init() {
+	wrapHandler = validateResponses
+}
+
+// validateResponses records each response, replays it to the client and
+// fails the test if it does not match the documented contract
+func validateResponses(t *testing.T, h http.Handler) http.Handler {
+	validator, err := openapi.NewValidator()
+	if err != nil {
+		t.Fatalf("failed to load OpenAPI spec: %v", err)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+
+		for key, values := range rec.Header() {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(rec.Code)
+		w.Write(rec.Body.Bytes())
+
+		// CORS preflights are answered by middleware, not documented operations
+		if r.Method == http.MethodOptions {
+			return
+		}
+
+		if err := validator.ValidateResponse(r.Method, r.URL.Path, rec.Code, rec.Header().Get("Content-Type"), rec.Body.Bytes()); err != nil {
+			t.Errorf("response does not match OpenAPI spec: %v", err)
+		}
+	})
+}
@@ -0,0 +1,445 @@
+package integration
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/columncrypt"
+	"github.com/milkiss/vanish/backend/internal/database"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// postgresConfig reads the DB_* variables, with the same defaults as the
+// server
+func postgresConfig(t *testing.T) database.Config {
+	t.Helper()
+	env := func(key, fallback string) string {
+		if value := os.Getenv(key); value != "" {
+			return value
+		}
+		return fallback
+	}
+	port, err := strconv.Atoi(env("DB_PORT", "5432"))
+	require.NoError(t, err)
+
+	return database.Config{
+		Host:     env("DB_HOST", "localhost"),
+		Port:     port,
+		User:     env("DB_USER", "vanish"),
+		Password: env("DB_PASSWORD", "vanish"),
+		DBName:   env("DB_NAME", "vanish"),
+		SSLMode:  env("DB_SSLMODE", "disable"),
+	}
+}
+
+// postgresDB connects to the database named by the DB_* variables and
+// skips the test when none is reachable
+func postgresDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := database.NewPostgresDB(postgresConfig(t))
+	if err != nil {
+		t.Skipf("PostgreSQL is not available: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	require.NoError(t, database.InitSchema(db))
+	return db
+}
+
+// mergeFixture holds two accounts of one person, a third user they both
+// exchanged messages with, and the rows a merge moves
+type mergeFixture struct {
+	keep, duplicate, other *models.User
+}
+
+// rowCounts is how many messages, API keys and access log rows a user has
+type rowCounts struct {
+	messages, apiKeys, accessLog int64
+}
+
+func newMergeFixture(t *testing.T, db *sql.DB, users *repository.UserRepository) *mergeFixture {
+	t.Helper()
+	ctx := context.Background()
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+
+	f := &mergeFixture{
+		keep:      &models.User{Email: "keep-" + suffix + "@example.com", Name: "Kept", IsAdmin: true},
+		duplicate: &models.User{Email: "sso-" + suffix + "@example.com", Name: "Duplicate"},
+		other:     &models.User{Email: "other-" + suffix + "@example.com", Name: "Other"},
+	}
+	for _, u := range []*models.User{f.keep, f.duplicate, f.other} {
+		require.NoError(t, users.Create(ctx, u))
+	}
+	t.Cleanup(func() {
+		for _, u := range []*models.User{f.keep, f.duplicate, f.other} {
+			_ = users.Delete(ctx, u.ID)
+		}
+	})
+
+	messages := [][2]int64{
+		{f.duplicate.ID, f.other.ID},
+		{f.other.ID, f.duplicate.ID},
+		{f.duplicate.ID, f.keep.ID},
+		{f.keep.ID, f.other.ID},
+	}
+	for i, m := range messages {
+		_, err := db.ExecContext(ctx,
+			`INSERT INTO message_metadata (message_id, sender_id, recipient_id, expires_at) VALUES ($1, $2, $3, NOW() + INTERVAL '1 hour')`,
+			fmt.Sprintf("merge-%s-%d", suffix, i), m[0], m[1])
+		require.NoError(t, err)
+	}
+
+	for i, owner := range []int64{f.duplicate.ID, f.duplicate.ID, f.keep.ID} {
+		hash := sha256.Sum256([]byte(fmt.Sprintf("%s-%d", suffix, i)))
+		require.NoError(t, users.CreateAPIKey(ctx, &models.APIKey{
+			UserID: owner, Name: "key", Prefix: "vk_test", Hash: hex.EncodeToString(hash[:]),
+		}))
+	}
+
+	for _, userID := range []int64{f.duplicate.ID, f.duplicate.ID, f.duplicate.ID, f.keep.ID} {
+		_, err := db.ExecContext(ctx,
+			`INSERT INTO access_log (message_id, user_id, action, outcome) VALUES ($1, $2, 'read', 'read')`,
+			"merge-"+suffix+"-0", userID)
+		require.NoError(t, err)
+	}
+	return f
+}
+
+func countRows(t *testing.T, db *sql.DB, userID int64) rowCounts {
+	t.Helper()
+	var c rowCounts
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM message_metadata WHERE sender_id = $1 OR recipient_id = $1`, userID).Scan(&c.messages))
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM api_keys WHERE user_id = $1`, userID).Scan(&c.apiKeys))
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM access_log WHERE user_id = $1`, userID).Scan(&c.accessLog))
+	return c
+}
+
+func TestUserRepository_MergeUsers(t *testing.T) {
+	db := postgresDB(t)
+	users := repository.NewUserRepository(db)
+	f := newMergeFixture(t, db, users)
+	ctx := context.Background()
+
+	assert.Equal(t, rowCounts{messages: 3, apiKeys: 2, accessLog: 3}, countRows(t, db, f.duplicate.ID))
+	assert.Equal(t, rowCounts{messages: 2, apiKeys: 1, accessLog: 1}, countRows(t, db, f.keep.ID))
+
+	moved, err := users.MergeUsers(ctx, f.other.ID, f.keep.ID, f.duplicate.ID)
+	require.NoError(t, err)
+	assert.Equal(t, models.MergeCounts{Messages: 3, APIKeys: 2, AccessLog: 3}, *moved)
+
+	assert.Equal(t, rowCounts{}, countRows(t, db, f.duplicate.ID))
+	// The message between the two accounts is now to and from the kept one
+	assert.Equal(t, rowCounts{messages: 4, apiKeys: 3, accessLog: 4}, countRows(t, db, f.keep.ID))
+
+	kept, err := users.FindByID(ctx, f.keep.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Kept", kept.Name)
+	assert.True(t, kept.IsAdmin)
+	assert.True(t, kept.IsActive)
+
+	tombstone, err := users.FindByID(ctx, f.duplicate.ID)
+	require.NoError(t, err)
+	assert.True(t, tombstone.IsAnonymized())
+	assert.False(t, tombstone.IsActive)
+	assert.Equal(t, models.TombstoneEmail(f.duplicate.ID, f.duplicate.Email), tombstone.Email)
+	assert.Equal(t, 1, countMergeAudits(t, db, f))
+}
+
+// countMergeAudits returns how many admin audit entries record the merge of
+// the fixture's duplicate into its kept account by the other user
+func countMergeAudits(t *testing.T, db *sql.DB, f *mergeFixture) int {
+	t.Helper()
+	var n int
+	require.NoError(t, db.QueryRow(
+		`SELECT COUNT(*) FROM admin_audit_log WHERE actor_id = $1 AND action = $2 AND user_id = $3 AND related_user_id = $4`,
+		f.other.ID, models.AdminActionMergeUsers, f.keep.ID, f.duplicate.ID).Scan(&n))
+	return n
+}
+
+func TestUserRepository_MergeUsersRollsBack(t *testing.T) {
+	db := postgresDB(t)
+	users := repository.NewUserRepository(db)
+	f := newMergeFixture(t, db, users)
+	ctx := context.Background()
+
+	// Fail the last step, tombstoning the duplicate, after every row moved
+	trigger := fmt.Sprintf("fail_merge_%d", f.duplicate.ID)
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE FUNCTION %[1]s() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'merge interrupted';
+		END;
+		$$ LANGUAGE plpgsql;
+		CREATE TRIGGER %[1]s BEFORE UPDATE ON users
+			FOR EACH ROW WHEN (OLD.id = %[2]d AND NOT NEW.is_active)
+			EXECUTE FUNCTION %[1]s();
+	`, trigger, f.duplicate.ID))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = db.Exec(fmt.Sprintf(`DROP TRIGGER IF EXISTS %[1]s ON users; DROP FUNCTION IF EXISTS %[1]s();`, trigger))
+	})
+
+	before := [2]rowCounts{countRows(t, db, f.keep.ID), countRows(t, db, f.duplicate.ID)}
+
+	_, err = users.MergeUsers(ctx, f.other.ID, f.keep.ID, f.duplicate.ID)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "merge interrupted")
+
+	assert.Equal(t, before, [2]rowCounts{countRows(t, db, f.keep.ID), countRows(t, db, f.duplicate.ID)})
+	duplicate, err := users.FindByID(ctx, f.duplicate.ID)
+	require.NoError(t, err)
+	assert.Equal(t, f.duplicate.Email, duplicate.Email)
+	assert.True(t, duplicate.IsActive)
+	assert.Equal(t, 0, countMergeAudits(t, db, f))
+}
+
+func TestUserRepository_AnonymizeRevokesAPIKeys(t *testing.T) {
+	db := postgresDB(t)
+	users := repository.NewUserRepository(db)
+	f := newMergeFixture(t, db, users)
+	ctx := context.Background()
+
+	require.NoError(t, users.Anonymize(ctx, f.duplicate.ID))
+
+	tombstone, err := users.FindByID(ctx, f.duplicate.ID)
+	require.NoError(t, err)
+	assert.True(t, tombstone.IsAnonymized())
+	keys, err := users.ListAPIKeys(ctx, f.duplicate.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	for _, k := range keys {
+		assert.NotNil(t, k.RevokedAt)
+	}
+
+	// Other accounts keep theirs
+	keys, err = users.ListAPIKeys(ctx, f.keep.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Nil(t, keys[0].RevokedAt)
+}
+
+func TestSlackInstallationRepository_EncryptsTokens(t *testing.T) {
+	db := postgresDB(t)
+	keys, err := columncrypt.New(map[string][]byte{"v1": []byte(strings.Repeat("k", columncrypt.KeySize))}, "v1")
+	require.NoError(t, err)
+	installations := repository.NewSlackInstallationRepository(db, keys)
+	ctx := context.Background()
+
+	teamID := "T" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	t.Cleanup(func() { _, _ = db.Exec(`DELETE FROM slack_installations WHERE team_id = $1`, teamID) })
+
+	_, err = installations.FindSlackInstallation(ctx, teamID)
+	assert.ErrorIs(t, err, models.ErrSlackNotInstalled)
+
+	require.NoError(t, installations.SaveSlackInstallation(ctx,
+		&models.SlackInstallation{TeamID: teamID, TeamName: "Acme", BotToken: "xoxb-first"}))
+	var stored string
+	require.NoError(t, db.QueryRow(`SELECT bot_token FROM slack_installations WHERE team_id = $1`, teamID).Scan(&stored))
+	assert.NotContains(t, stored, "xoxb-", "the token is encrypted at rest")
+
+	// Reinstalling replaces the token and keeps the first install time
+	reinstall := &models.SlackInstallation{TeamID: teamID, TeamName: "Acme Corp", BotToken: "xoxb-second"}
+	require.NoError(t, installations.SaveSlackInstallation(ctx, reinstall))
+	found, err := installations.FindSlackInstallation(ctx, teamID)
+	require.NoError(t, err)
+	assert.Equal(t, "xoxb-second", found.BotToken)
+	assert.Equal(t, "Acme Corp", found.TeamName)
+	assert.False(t, found.UpdatedAt.Before(found.CreatedAt))
+}
+
+func TestMetadataRepository_HistoryKeepsDeletedCounterparts(t *testing.T) {
+	db := postgresDB(t)
+	keys, err := columncrypt.New(map[string][]byte{"v1": []byte(strings.Repeat("k", columncrypt.KeySize))}, "v1")
+	require.NoError(t, err)
+	users := repository.NewUserRepository(db)
+	metadata := repository.NewMetadataRepository(db, keys)
+	ctx := context.Background()
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	alice := &models.User{Email: "alice-" + suffix + "@example.com", Name: "Alice"}
+	bob := &models.User{Email: "bob-" + suffix + "@example.com", Name: "Bob"}
+	for _, u := range []*models.User{alice, bob} {
+		require.NoError(t, users.Create(ctx, u))
+	}
+	t.Cleanup(func() {
+		_ = users.Delete(ctx, alice.ID)
+		_ = users.Delete(ctx, bob.ID)
+	})
+
+	exchange := map[string][2]int64{
+		"from-bob-" + suffix: {bob.ID, alice.ID},
+		"to-bob-" + suffix:   {alice.ID, bob.ID},
+	}
+	for id, parties := range exchange {
+		require.NoError(t, metadata.Create(ctx, &models.MessageMetadata{
+			MessageID: id, SenderID: parties[0], RecipientID: parties[1], EncryptionKey: "link-key",
+			Status: models.StatusPending, CreatedAt: time.Now().UTC(), ExpiresAt: time.Now().UTC().Add(time.Hour),
+			SenderType: models.SenderTypeUser,
+		}))
+	}
+
+	history, err := metadata.GetUserHistory(ctx, alice.ID, "", models.Page{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	for _, h := range history {
+		assert.False(t, h.IsCounterpartDeleted)
+		if h.IsRecipient {
+			assert.Equal(t, "link-key", h.EncryptionKey)
+		}
+	}
+
+	require.NoError(t, users.Anonymize(ctx, bob.ID))
+
+	history, err = metadata.GetUserHistory(ctx, alice.ID, "", models.Page{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, history, 2, "the exchange with a deleted user stays listed")
+	for _, h := range history {
+		assert.True(t, h.IsCounterpartDeleted, h.MessageID)
+		assert.Empty(t, h.EncryptionKey, "no key for a message from a deleted user")
+		assert.True(t, h.KeyRetained)
+		if h.IsRecipient {
+			assert.Equal(t, models.DeletedUserName, h.SenderName)
+			assert.Equal(t, "Alice", h.RecipientName)
+		} else {
+			assert.Equal(t, "Alice", h.SenderName)
+			assert.Equal(t, models.DeletedUserName, h.RecipientName)
+		}
+	}
+}
+
+func TestMetadataRepository_KeysetPaging(t *testing.T) {
+	db := postgresDB(t)
+	keys, err := columncrypt.New(map[string][]byte{"v1": []byte(strings.Repeat("k", columncrypt.KeySize))}, "v1")
+	require.NoError(t, err)
+	users := repository.NewUserRepository(db)
+	metadata := repository.NewMetadataRepository(db, keys)
+	ctx := context.Background()
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	alice := &models.User{Email: "alice-" + suffix + "@example.com", Name: "Alice"}
+	bob := &models.User{Email: "bob-" + suffix + "@example.com", Name: "Bob"}
+	for _, u := range []*models.User{alice, bob} {
+		require.NoError(t, users.Create(ctx, u))
+	}
+	t.Cleanup(func() {
+		_ = users.Delete(ctx, alice.ID)
+		_ = users.Delete(ctx, bob.ID)
+	})
+
+	// Three messages share each timestamp, so pages split ties
+	at := time.Now().UTC().Truncate(time.Microsecond)
+	var want []string
+	create := func(id string, createdAt time.Time) {
+		require.NoError(t, metadata.Create(ctx, &models.MessageMetadata{
+			MessageID: id, SenderID: bob.ID, RecipientID: alice.ID, Status: models.StatusPending,
+			CreatedAt: createdAt, ExpiresAt: createdAt.Add(time.Hour), SenderType: models.SenderTypeUser,
+		}))
+	}
+	for i := 0; i < 12; i++ {
+		id := fmt.Sprintf("keyset-%s-%02d", suffix, i)
+		create(id, at.Add(-time.Duration(i/3)*time.Second))
+		want = append(want, id)
+	}
+
+	var history []string
+	arrived := 0
+	page := models.Page{Limit: 5}
+	for {
+		rows, err := metadata.GetUserHistory(ctx, alice.ID, "", page)
+		require.NoError(t, err)
+		for _, h := range rows {
+			history = append(history, h.MessageID)
+		}
+		if len(rows) < page.Limit {
+			break
+		}
+		last := rows[len(rows)-1]
+		page.After = &models.Cursor{Time: last.CreatedAt, ID: last.ID}
+		// Newer than every cursor, so never on a later page
+		create(fmt.Sprintf("keyset-%s-new-%d", suffix, arrived), time.Now().UTC())
+		arrived++
+	}
+	assert.ElementsMatch(t, want, history)
+
+	var inbox []string
+	page = models.Page{Limit: 5}
+	for {
+		rows, err := metadata.ListInbox(ctx, alice.ID, page)
+		require.NoError(t, err)
+		for _, m := range rows {
+			inbox = append(inbox, m.MessageID)
+		}
+		if len(rows) < page.Limit {
+			break
+		}
+		last := rows[len(rows)-1]
+		page.After = &models.Cursor{Time: last.ExpiresAt, ID: last.ID}
+	}
+	assert.Len(t, inbox, len(want)+arrived, "the inbox holds every message, including the new ones")
+}
+
+func TestMetadataRepository_HistorySearchIsScoped(t *testing.T) {
+	db := postgresDB(t)
+	users := repository.NewUserRepository(db)
+	metadata := repository.NewMetadataRepository(db, nil)
+	ctx := context.Background()
+
+	suffix := strconv.FormatInt(time.Now().UnixNano(), 36)
+	alice := &models.User{Email: "alice-" + suffix + "@example.com", Name: "Alice"}
+	dana := &models.User{Email: "dana-" + suffix + "@example.com", Name: "Dana " + suffix}
+	eve := &models.User{Email: "eve-" + suffix + "@example.com", Name: "Eve"}
+	for _, u := range []*models.User{alice, dana, eve} {
+		require.NoError(t, users.Create(ctx, u))
+	}
+	t.Cleanup(func() {
+		for _, u := range []*models.User{alice, dana, eve} {
+			_ = users.Delete(ctx, u.ID)
+		}
+	})
+
+	create := func(id string, sender, recipient int64, category, external string) {
+		require.NoError(t, metadata.Create(ctx, &models.MessageMetadata{
+			MessageID: id + "-" + suffix, SenderID: sender, RecipientID: recipient, Status: models.StatusPending,
+			CreatedAt: time.Now().UTC(), ExpiresAt: time.Now().UTC().Add(time.Hour),
+			Category: category, ExternalRecipientEmail: external,
+		}))
+	}
+	create("alice-to-dana", alice.ID, dana.ID, "vpn", "")
+	create("dana-to-alice", dana.ID, alice.ID, "", "")
+	create("alice-to-eve", alice.ID, eve.ID, "", "")
+	create("alice-to-contractor", alice.ID, 0, "", "contractor-"+suffix+"@partner.example")
+	// Dana and Eve's messages share the category and Dana's name, but are
+	// not Alice's to find
+	create("dana-to-eve", dana.ID, eve.ID, "vpn", "")
+	create("eve-to-dana", eve.ID, dana.ID, "vpn-"+suffix, "")
+
+	search := func(userID int64, q string) []string {
+		rows, err := metadata.GetUserHistory(ctx, userID, q, models.Page{Limit: 50})
+		require.NoError(t, err)
+		ids := []string{}
+		for _, h := range rows {
+			ids = append(ids, strings.TrimSuffix(h.MessageID, "-"+suffix))
+		}
+		return ids
+	}
+
+	assert.ElementsMatch(t, []string{"alice-to-dana", "dana-to-alice"}, search(alice.ID, "DANA "+suffix))
+	assert.ElementsMatch(t, []string{"alice-to-dana", "dana-to-alice"}, search(alice.ID, "dana-"+suffix+"@"))
+	assert.ElementsMatch(t, []string{"alice-to-contractor"}, search(alice.ID, "contractor-"+suffix))
+	assert.Empty(t, search(alice.ID, "vpn-"+suffix), "another user's category is not searchable")
+	assert.Empty(t, search(alice.ID, "eve-"+suffix+"@example"+"%"), "wildcards match literally")
+	assert.ElementsMatch(t, []string{"alice-to-eve"}, search(alice.ID, "eve-"+suffix))
+	assert.Empty(t, search(alice.ID, "alice"), "the caller is not their own counterpart")
+
+	assert.ElementsMatch(t, []string{"dana-to-eve", "eve-to-dana"}, search(eve.ID, "vpn"))
+}
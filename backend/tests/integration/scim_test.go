@@ -0,0 +1,301 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/auth"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSCIMToken = "test-scim-token-0123456789abcdefghij"
+
+// Requests as Okta's SCIM 2.0 client sends them
+const (
+	oktaCreateUser = `{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "userName": "test.user@okta.local",
+  "name": {"givenName": "Test", "familyName": "User"},
+  "emails": [{"primary": true, "value": "test.user@okta.local", "type": "work"}],
+  "displayName": "Test User",
+  "locale": "en-US",
+  "externalId": "00ujl29u0le5T6Aj10h7",
+  "groups": [],
+  "password": "1mz050nq",
+  "active": true
+}`
+	oktaReplaceUser = `{
+  "schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+  "id": "%ID%",
+  "userName": "test.user@okta.local",
+  "name": {"givenName": "Another", "middleName": "", "familyName": "User"},
+  "emails": [{"primary": true, "value": "test.user@okta.local", "type": "work"}],
+  "displayName": "Another User",
+  "locale": "en-US",
+  "externalId": "00ujl29u0le5T6Aj10h7",
+  "groups": [],
+  "active": true,
+  "meta": {"resourceType": "User", "created": "2024-05-01T10:00:00Z", "lastModified": "2024-05-01T10:00:00Z"}
+}`
+	oktaDeactivateUser = `{
+  "schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+  "Operations": [{"op": "replace", "value": {"active": false}}]
+}`
+	oktaReactivateUser = `{
+  "schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+  "Operations": [{"op": "replace", "value": {"active": true}}]
+}`
+	oktaFilter = `userName eq "test.user@okta.local"`
+)
+
+// scimEnv is a Vanish server with SCIM enabled
+type scimEnv struct {
+	server     *httptest.Server
+	users      *fakes.UserStore
+	jwtManager *auth.JWTManager
+}
+
+func setupSCIM(t *testing.T) *scimEnv {
+	users := fakes.NewUserStore()
+	jwtManager := auth.NewJWTManager("test-secret", time.Hour)
+	router, err := api.SetupRouter(api.Dependencies{
+		Config: &config.Config{
+			Server: config.ServerConfig{AllowedOrigins: []string{"*"}},
+			SCIM:   config.SCIMConfig{Enabled: true, Token: testSCIMToken},
+		},
+		Storage:        fakes.NewStorage(),
+		UserStore:      users,
+		MetadataStore:  fakes.NewMetadataStore(users),
+		AccessLogStore: fakes.NewAccessLogStore(users),
+		JWTManager:     jwtManager,
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+	return &scimEnv{server: server, users: users, jwtManager: jwtManager}
+}
+
+// do sends a SCIM request with token and decodes the JSON response into out
+func (e *scimEnv) do(t *testing.T, method, path, token, body string, out interface{}) int {
+	t.Helper()
+	req, err := http.NewRequest(method, e.server.URL+path, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", models.SCIMContentType)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	if len(raw) > 0 {
+		assert.True(t, strings.HasPrefix(resp.Header.Get("Content-Type"), models.SCIMContentType), resp.Header.Get("Content-Type"))
+		if out != nil {
+			require.NoError(t, json.Unmarshal(raw, out), string(raw))
+		}
+	}
+	return resp.StatusCode
+}
+
+// list runs a filtered user query
+func (e *scimEnv) list(t *testing.T, filter string) models.SCIMListResponse {
+	t.Helper()
+	var resp models.SCIMListResponse
+	require.Equal(t, http.StatusOK, e.do(t, "GET", "/scim/v2/Users?startIndex=1&count=100&filter="+url.QueryEscape(filter), testSCIMToken, "", &resp))
+	assert.Equal(t, []string{models.SCIMListResponseSchema}, resp.Schemas)
+	return resp
+}
+
+// apiStatus calls GET /api/v1/auth/me as the user with id
+func (e *scimEnv) apiStatus(t *testing.T, id int64, email string) int {
+	t.Helper()
+	token, err := e.jwtManager.Generate(id, email)
+	require.NoError(t, err)
+	req, _ := http.NewRequest("GET", e.server.URL+"/api/v1/auth/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestSCIM_OktaLifecycle(t *testing.T) {
+	env := setupSCIM(t)
+
+	// Okta looks the user up before creating it
+	assert.Equal(t, 0, env.list(t, oktaFilter).TotalResults)
+
+	var created models.SCIMUser
+	require.Equal(t, http.StatusCreated, env.do(t, "POST", "/scim/v2/Users", testSCIMToken, oktaCreateUser, &created))
+	require.NotEmpty(t, created.ID)
+	assert.Equal(t, []string{models.SCIMUserSchema}, created.Schemas)
+	assert.Equal(t, "test.user@okta.local", created.UserName)
+	assert.Equal(t, "Test User", created.Name.Formatted)
+	require.NotNil(t, created.Active)
+	assert.True(t, *created.Active)
+	assert.Equal(t, "User", created.Meta.ResourceType)
+
+	// The account signs in through SSO; the password Okta sent is not set
+	user, err := env.users.FindByEmail(context.Background(), "test.user@okta.local")
+	require.NoError(t, err)
+	assert.Empty(t, user.Password)
+	assert.False(t, user.CheckPassword("1mz050nq"))
+	assert.Equal(t, http.StatusOK, env.apiStatus(t, user.ID, user.Email))
+
+	found := env.list(t, oktaFilter)
+	require.Equal(t, 1, found.TotalResults)
+	assert.Equal(t, created.ID, found.Resources[0].ID)
+
+	var fetched models.SCIMUser
+	require.Equal(t, http.StatusOK, env.do(t, "GET", "/scim/v2/Users/"+created.ID, testSCIMToken, "", &fetched))
+	assert.Equal(t, created.UserName, fetched.UserName)
+
+	// Profile push
+	var replaced models.SCIMUser
+	require.Equal(t, http.StatusOK, env.do(t, "PUT", "/scim/v2/Users/"+created.ID, testSCIMToken,
+		strings.ReplaceAll(oktaReplaceUser, "%ID%", created.ID), &replaced))
+	assert.Equal(t, "Another User", replaced.Name.Formatted)
+
+	// Deprovisioning locks the account out until it is reactivated
+	var deactivated models.SCIMUser
+	require.Equal(t, http.StatusOK, env.do(t, "PATCH", "/scim/v2/Users/"+created.ID, testSCIMToken, oktaDeactivateUser, &deactivated))
+	assert.False(t, *deactivated.Active)
+	assert.Equal(t, http.StatusUnauthorized, env.apiStatus(t, user.ID, user.Email))
+	assert.False(t, *env.list(t, oktaFilter).Resources[0].Active, "deactivated users are still found")
+
+	var reactivated models.SCIMUser
+	require.Equal(t, http.StatusOK, env.do(t, "PATCH", "/scim/v2/Users/"+created.ID, testSCIMToken, oktaReactivateUser, &reactivated))
+	assert.True(t, *reactivated.Active)
+	assert.Equal(t, http.StatusOK, env.apiStatus(t, user.ID, user.Email))
+
+	// Deleting anonymizes the account
+	require.Equal(t, http.StatusNoContent, env.do(t, "DELETE", "/scim/v2/Users/"+created.ID, testSCIMToken, "", nil))
+	var scimErr models.SCIMError
+	assert.Equal(t, http.StatusNotFound, env.do(t, "GET", "/scim/v2/Users/"+created.ID, testSCIMToken, "", &scimErr))
+	assert.Equal(t, "404", scimErr.Status)
+	assert.Equal(t, 0, env.list(t, oktaFilter).TotalResults)
+	assert.Equal(t, http.StatusUnauthorized, env.apiStatus(t, user.ID, user.Email))
+}
+
+func TestSCIM_Authentication(t *testing.T) {
+	env := setupSCIM(t)
+
+	for _, token := range []string{"", "wrong-token", testSCIMToken + "x"} {
+		var scimErr models.SCIMError
+		assert.Equal(t, http.StatusUnauthorized, env.do(t, "GET", "/scim/v2/Users", token, "", &scimErr))
+		assert.Equal(t, []string{models.SCIMErrorSchema}, scimErr.Schemas)
+		assert.Equal(t, "401", scimErr.Status)
+	}
+
+	// A user's JWT does not grant SCIM access either
+	require.NoError(t, env.users.Create(context.Background(), &models.User{Email: "admin@example.com", Name: "Admin", IsAdmin: true}))
+	jwt, err := env.jwtManager.Generate(1, "admin@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, env.do(t, "GET", "/scim/v2/Users", jwt, "", nil))
+}
+
+func TestSCIM_Errors(t *testing.T) {
+	env := setupSCIM(t)
+	require.Equal(t, http.StatusCreated, env.do(t, "POST", "/scim/v2/Users", testSCIMToken, oktaCreateUser, nil))
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		status   int
+		scimType string
+	}{
+		{"duplicate userName", "POST", "/scim/v2/Users", oktaCreateUser, http.StatusConflict, "uniqueness"},
+		{"userName not an email", "POST", "/scim/v2/Users", `{"userName":"test.user"}`, http.StatusBadRequest, "invalidValue"},
+		{"malformed body", "POST", "/scim/v2/Users", `{"userName":`, http.StatusBadRequest, "invalidSyntax"},
+		{"unsupported filter", "GET", "/scim/v2/Users?filter=" + url.QueryEscape(`emails.value co "okta"`), "", http.StatusBadRequest, "invalidFilter"},
+		{"remove operation", "PATCH", "/scim/v2/Users/1", `{"Operations":[{"op":"remove","path":"active"}]}`, http.StatusBadRequest, "invalidValue"},
+		{"non-boolean active", "PATCH", "/scim/v2/Users/1", `{"Operations":[{"op":"replace","path":"active","value":"maybe"}]}`, http.StatusBadRequest, "invalidValue"},
+		{"unknown user", "GET", "/scim/v2/Users/999", "", http.StatusNotFound, ""},
+		{"non-numeric id", "PATCH", "/scim/v2/Users/abc", oktaDeactivateUser, http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var scimErr models.SCIMError
+			assert.Equal(t, tt.status, env.do(t, tt.method, tt.path, testSCIMToken, tt.body, &scimErr))
+			assert.Equal(t, tt.scimType, scimErr.ScimType)
+			assert.NotEmpty(t, scimErr.Detail)
+		})
+	}
+}
+
+func TestSCIM_PatchWithPathsAndStrings(t *testing.T) {
+	env := setupSCIM(t)
+	var created models.SCIMUser
+	require.Equal(t, http.StatusCreated, env.do(t, "POST", "/scim/v2/Users", testSCIMToken, oktaCreateUser, &created))
+
+	// Other providers patch by path and send booleans as strings
+	var patched models.SCIMUser
+	require.Equal(t, http.StatusOK, env.do(t, "PATCH", "/scim/v2/Users/"+created.ID, testSCIMToken, `{
+  "schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+  "Operations": [
+    {"op": "Replace", "path": "active", "value": "False"},
+    {"op": "Replace", "path": "displayName", "value": "Display Name"},
+    {"op": "Add", "path": "userName", "value": "renamed@okta.local"}
+  ]
+}`, &patched))
+	assert.False(t, *patched.Active)
+	assert.Equal(t, "Display Name", patched.Name.Formatted)
+	assert.Equal(t, "renamed@okta.local", patched.UserName)
+
+	// name.formatted wins over displayName
+	require.Equal(t, http.StatusOK, env.do(t, "PATCH", "/scim/v2/Users/"+created.ID, testSCIMToken,
+		`{"Operations":[{"op":"replace","value":{"displayName":"Ignored","name.formatted":"Formatted Name"}}]}`, &patched))
+	assert.Equal(t, "Formatted Name", patched.Name.Formatted)
+
+	// The email of another account cannot be taken
+	require.NoError(t, env.users.Create(context.Background(), &models.User{Email: "taken@okta.local", Name: "Taken"}))
+	var scimErr models.SCIMError
+	assert.Equal(t, http.StatusConflict, env.do(t, "PATCH", "/scim/v2/Users/"+created.ID, testSCIMToken,
+		`{"Operations":[{"op":"replace","path":"userName","value":"taken@okta.local"}]}`, &scimErr))
+	assert.Equal(t, "uniqueness", scimErr.ScimType)
+}
+
+func TestSCIM_ListPagesAndHidesServiceAccounts(t *testing.T) {
+	env := setupSCIM(t)
+	ctx := context.Background()
+	for _, u := range []*models.User{
+		{Email: "a@example.com", Name: "Alice"},
+		{Email: "ci@service.local", Name: "CI Bot", IsService: true},
+		{Email: "b@example.com", Name: "Bob"},
+		{Email: "c@example.com", Name: "Carol"},
+	} {
+		require.NoError(t, env.users.Create(ctx, u))
+	}
+	require.NoError(t, env.users.Anonymize(ctx, 4))
+
+	var page models.SCIMListResponse
+	require.Equal(t, http.StatusOK, env.do(t, "GET", "/scim/v2/Users?startIndex=2&count=1", testSCIMToken, "", &page))
+	assert.Equal(t, 2, page.TotalResults, "service accounts and tombstones are left out")
+	assert.Equal(t, 2, page.StartIndex)
+	assert.Equal(t, 1, page.ItemsPerPage)
+	require.Len(t, page.Resources, 1)
+	assert.Equal(t, "b@example.com", page.Resources[0].UserName)
+
+	assert.Equal(t, 0, env.list(t, `userName eq "ci@service.local"`).TotalResults)
+	var scimErr models.SCIMError
+	assert.Equal(t, http.StatusNotFound, env.do(t, "GET", "/scim/v2/Users/2", testSCIMToken, "", &scimErr))
+	assert.Equal(t, http.StatusConflict, env.do(t, "POST", "/scim/v2/Users", testSCIMToken,
+		`{"userName":"ci@service.local","displayName":"CI Bot"}`, &scimErr), "service account emails are taken")
+}
@@ -0,0 +1,173 @@
+package integration
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/auth"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zafrem/vanish/shared/crypto"
+	"github.com/zafrem/vanish/shared/vanish"
+)
+
+type sdkEnv struct {
+	url        string
+	jwtManager *auth.JWTManager
+	users      *fakes.UserStore
+}
+
+func setupSDK(t *testing.T) *sdkEnv {
+	ctx := context.Background()
+	users := fakes.NewUserStore()
+	for _, u := range []*models.User{
+		{Email: "sender@example.com", Name: "Sender"},
+		{Email: "recipient@example.com", Name: "Recipient"},
+	} {
+		require.NoError(t, users.Create(ctx, u))
+	}
+	jwtManager := auth.NewJWTManager("test-secret", time.Hour)
+
+	router, err := api.SetupRouter(api.Dependencies{
+		Config:         &config.Config{Server: config.ServerConfig{AllowedOrigins: []string{"*"}}},
+		Storage:        fakes.NewStorage(),
+		UserStore:      users,
+		MetadataStore:  fakes.NewMetadataStore(users),
+		AccessLogStore: fakes.NewAccessLogStore(users),
+		JWTManager:     jwtManager,
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	return &sdkEnv{url: server.URL, jwtManager: jwtManager, users: users}
+}
+
+func (e *sdkEnv) client(t *testing.T, userID int64, email string, opts ...vanish.Option) *vanish.Client {
+	token, err := e.jwtManager.Generate(userID, email)
+	require.NoError(t, err)
+	c, err := vanish.New(e.url, vanish.Credentials{Token: token}, opts...)
+	require.NoError(t, err)
+	return c
+}
+
+func TestSDK_SendStatusReceive(t *testing.T) {
+	env := setupSDK(t)
+	ctx := context.Background()
+	sender := env.client(t, 1, "sender@example.com")
+	recipient := env.client(t, 2, "recipient@example.com")
+
+	users, err := sender.ListUsers(ctx)
+	require.NoError(t, err)
+	assert.NotEmpty(t, users)
+
+	sent, err := sender.Send(ctx, "recipient@example.com", "db password", vanish.WithTTL(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sent.URL, env.url+"/m/"+sent.ID+"#"))
+	assert.False(t, sent.Sealed)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), sent.ExpiresAt, time.Minute)
+
+	info, err := sender.Status(ctx, sent.ID)
+	require.NoError(t, err)
+	assert.Equal(t, vanish.StatusPending, info.Status)
+	assert.Equal(t, int64(2), info.RecipientID)
+
+	_, err = sender.Receive(ctx, sent.URL)
+	assert.Equal(t, vanish.ErrorCodeNotRecipient, vanish.ErrorCode(err))
+
+	secret, err := recipient.Receive(ctx, sent.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "db password", secret)
+
+	info, err = recipient.Status(ctx, sent.ID)
+	require.NoError(t, err)
+	assert.Equal(t, vanish.StatusRead, info.Status)
+	assert.NotNil(t, info.ReadAt)
+
+	_, err = recipient.Receive(ctx, sent.URL)
+	assert.Equal(t, vanish.ErrorCodeMessageAlreadyRead, vanish.ErrorCode(err))
+}
+
+func TestSDK_LargeSecretIsCompressed(t *testing.T) {
+	env := setupSDK(t)
+	ctx := context.Background()
+	sender := env.client(t, 1, "sender@example.com")
+	recipient := env.client(t, 2, "recipient@example.com")
+
+	large := strings.Repeat("line of a config file\n", crypto.CompressThreshold)
+	sent, err := sender.Send(ctx, "recipient@example.com", large)
+	require.NoError(t, err)
+
+	secret, err := recipient.Receive(ctx, sent.URL)
+	require.NoError(t, err)
+	assert.Equal(t, large, secret)
+}
+
+func TestSDK_ReceiveSealedKey(t *testing.T) {
+	env := setupSDK(t)
+	ctx := context.Background()
+	publicKey, privateKey, err := crypto.GenerateKeyPair()
+	require.NoError(t, err)
+	require.NoError(t, env.users.UpdatePublicKey(ctx, 2, publicKey))
+
+	sender := env.client(t, 1, "sender@example.com")
+	sent, err := sender.Send(ctx, "recipient@example.com", "sealed secret")
+	require.NoError(t, err)
+	assert.True(t, sent.Sealed)
+	bare, _, _ := strings.Cut(sent.URL, "#")
+
+	_, err = env.client(t, 2, "recipient@example.com").Receive(ctx, bare)
+	assert.ErrorIs(t, err, vanish.ErrNoKey)
+
+	secret, err := env.client(t, 2, "recipient@example.com", vanish.WithPrivateKey(privateKey)).Receive(ctx, bare)
+	require.NoError(t, err)
+	assert.Equal(t, "sealed secret", secret)
+}
+
+func TestSDK_Revoke(t *testing.T) {
+	env := setupSDK(t)
+	ctx := context.Background()
+	sender := env.client(t, 1, "sender@example.com")
+	recipient := env.client(t, 2, "recipient@example.com")
+
+	sent, err := sender.Send(ctx, "recipient@example.com", "wrong secret")
+	require.NoError(t, err)
+
+	err = recipient.Revoke(ctx, sent.ID)
+	assert.Equal(t, vanish.ErrorCodeForbidden, vanish.ErrorCode(err))
+
+	require.NoError(t, sender.Revoke(ctx, sent.ID))
+	info, err := sender.Status(ctx, sent.ID)
+	require.NoError(t, err)
+	assert.Equal(t, vanish.StatusRevoked, info.Status)
+
+	_, err = recipient.Receive(ctx, sent.URL)
+	assert.Error(t, err)
+}
+
+func TestSDK_Errors(t *testing.T) {
+	env := setupSDK(t)
+	ctx := context.Background()
+	sender := env.client(t, 1, "sender@example.com")
+
+	_, err := sender.Send(ctx, "nobody@example.com", "secret")
+	assert.Equal(t, vanish.ErrorCodeUserNotFound, vanish.ErrorCode(err))
+
+	_, err = sender.Send(ctx, "recipient@example.com", "")
+	assert.ErrorIs(t, err, vanish.ErrEmptySecret)
+
+	_, err = sender.Status(ctx, "does-not-exist")
+	assert.Equal(t, vanish.ErrorCodeMessageNotFound, vanish.ErrorCode(err))
+
+	_, err = vanish.New("vanish.example.com", vanish.Credentials{Token: "t"})
+	assert.Error(t, err)
+	_, err = vanish.New(env.url, vanish.Credentials{})
+	assert.Error(t, err)
+}
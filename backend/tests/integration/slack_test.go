@@ -0,0 +1,137 @@
+package integration
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/auth"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/integrations/slack"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSigningSecret = "test-slack-signing-secret"
+
+// setupSlackRouter starts a Vanish server with Slack enabled, backed by a fake Slack API
+func setupSlackRouter(t *testing.T) (*httptest.Server, func()) {
+	slackAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+
+	cfg := &config.Config{
+		Server: config.ServerConfig{
+			AllowedOrigins:  []string{"*"},
+			FrontendBaseURL: "http://localhost:5173",
+		},
+		Slack: config.SlackConfig{
+			Enabled:       true,
+			BotToken:      "xoxb-test",
+			SigningSecret: testSigningSecret,
+		},
+	}
+
+	users := fakes.NewUserStore()
+	router, err := api.SetupRouter(api.Dependencies{
+		Config:         cfg,
+		Storage:        fakes.NewStorage(),
+		UserStore:      users,
+		MetadataStore:  fakes.NewMetadataStore(users),
+		AccessLogStore: fakes.NewAccessLogStore(users),
+		JWTManager:     auth.NewJWTManager("test-secret", time.Hour),
+		SlackClient: slack.NewClient(&slack.Config{
+			BotToken:      cfg.Slack.BotToken,
+			SigningSecret: cfg.Slack.SigningSecret,
+			APIURL:        slackAPI.URL,
+		}),
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(router)
+
+	return server, func() {
+		server.Close()
+		slackAPI.Close()
+	}
+}
+
+// postSlackForm posts a form payload, signing it when secret is non-empty
+func postSlackForm(t *testing.T, endpoint string, form url.Values, secret string) *http.Response {
+	t.Helper()
+
+	body := form.Encode()
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if secret != "" {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte("v0:" + timestamp + ":" + body))
+		req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+		req.Header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	return resp
+}
+
+func TestSlackRoutes_Signature(t *testing.T) {
+	server, cleanup := setupSlackRouter(t)
+	defer cleanup()
+
+	commandForm := url.Values{
+		"command":    {"/vanishPW"},
+		"user_id":    {"U123"},
+		"trigger_id": {"trigger-1"},
+	}
+	interactionForm := url.Values{
+		"payload": {`{"type":"block_actions","user":{"id":"U123"}}`},
+	}
+
+	tests := []struct {
+		name     string
+		path     string
+		form     url.Values
+		secret   string
+		expected int
+	}{
+		{"signed slash command", "/api/slack/commands", commandForm, testSigningSecret, http.StatusOK},
+		{"unsigned slash command", "/api/slack/commands", commandForm, "", http.StatusUnauthorized},
+		{"wrongly signed slash command", "/api/slack/commands", commandForm, "other-secret", http.StatusUnauthorized},
+		{"signed interaction", "/api/slack/interactions", interactionForm, testSigningSecret, http.StatusOK},
+		{"unsigned interaction", "/api/slack/interactions", interactionForm, "", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := postSlackForm(t, server.URL+tt.path, tt.form, tt.secret)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.expected, resp.StatusCode)
+		})
+	}
+}
+
+// The routes stay mounted so a config reload can enable Slack
+func TestSlackRoutes_UnavailableWhenDisabled(t *testing.T) {
+	env, cleanup := setupTestRouter(t)
+	defer cleanup()
+
+	resp := postSlackForm(t, env.server.URL+"/api/slack/commands", url.Values{}, testSigningSecret)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
@@ -0,0 +1,355 @@
+//go:build invariants
+
+// Package invariants checks the burn-on-read guarantee under failures: many
+// concurrent readers, Redis restarting mid-read and metadata updates that
+// fail. Run it with
+//
+//	go test -tags invariants ./tests/invariants -v
+//
+// and replay a failed run with the seed it prints: -seed <n>
+package invariants
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/auth"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/internal/storage"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	seedFlag   = flag.Int64("seed", 0, "seed of the failure schedule; 0 picks one from the clock")
+	roundsFlag = flag.Int("rounds", 25, "rounds of create, read under failures and settle")
+)
+
+const (
+	senderID    = 1
+	recipientID = 2
+)
+
+// errInjected is returned by MarkAsRead calls chosen to fail
+var errInjected = errors.New("injected metadata failure")
+
+// flakyMetadata fails MarkAsRead for the messages in failing
+type flakyMetadata struct {
+	persistence.MetadataStore
+
+	mu      sync.Mutex
+	failing map[string]bool
+}
+
+func (m *flakyMetadata) failMarkAsRead(messageID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.failing[messageID] = true
+}
+
+func (m *flakyMetadata) MarkAsRead(ctx context.Context, messageID string) error {
+	m.mu.Lock()
+	fail := m.failing[messageID]
+	m.mu.Unlock()
+	if fail {
+		return errInjected
+	}
+	return m.MetadataStore.MarkAsRead(ctx, messageID)
+}
+
+// plan is the failure schedule of one round, drawn from its seed
+type plan struct {
+	messages    int
+	readers     []int  // concurrent readers of each message
+	failMark    []bool // whether MarkAsRead fails for each message
+	restarts    []time.Duration
+	downtimes   []time.Duration
+	flushScript []bool // whether a restart also loses the script cache
+}
+
+func newPlan(rng *rand.Rand) plan {
+	p := plan{messages: 8 + rng.Intn(17)}
+	for i := 0; i < p.messages; i++ {
+		p.readers = append(p.readers, 2+rng.Intn(7))
+		p.failMark = append(p.failMark, rng.Float64() < 0.3)
+	}
+	for i := rng.Intn(4); i > 0; i-- {
+		p.restarts = append(p.restarts, time.Duration(rng.Intn(3000))*time.Microsecond)
+		p.downtimes = append(p.downtimes, time.Duration(rng.Intn(2000))*time.Microsecond)
+		p.flushScript = append(p.flushScript, rng.Intn(2) == 0)
+	}
+	return p
+}
+
+// env is one server over miniredis and the in-memory metadata store
+type env struct {
+	redis     *miniredis.Miniredis
+	store     *storage.RedisStorage
+	metadata  *flakyMetadata
+	server    *httptest.Server
+	sender    string
+	recipient string
+}
+
+func setup(t *testing.T) *env {
+	ctx := context.Background()
+	mr := miniredis.RunT(t)
+	store, err := storage.NewRedisStorage(mr.Addr(), "", 0)
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	users := fakes.NewUserStore()
+	for _, u := range []*models.User{
+		{Email: "sender@example.com", Name: "Sender"},
+		{Email: "recipient@example.com", Name: "Recipient"},
+	} {
+		require.NoError(t, users.Create(ctx, u))
+	}
+	metadata := &flakyMetadata{MetadataStore: fakes.NewMetadataStore(users), failing: map[string]bool{}}
+	jwtManager := auth.NewJWTManager("test-secret", time.Hour)
+
+	router, err := api.SetupRouter(api.Dependencies{
+		Config:         &config.Config{Server: config.ServerConfig{AllowedOrigins: []string{"*"}}},
+		Storage:        store,
+		UserStore:      users,
+		MetadataStore:  metadata,
+		AccessLogStore: fakes.NewAccessLogStore(users),
+		JWTManager:     jwtManager,
+	})
+	require.NoError(t, err)
+	server := httptest.NewServer(router)
+	t.Cleanup(server.Close)
+
+	sender, err := jwtManager.Generate(senderID, "sender@example.com")
+	require.NoError(t, err)
+	recipient, err := jwtManager.Generate(recipientID, "recipient@example.com")
+	require.NoError(t, err)
+
+	return &env{redis: mr, store: store, metadata: metadata, server: server, sender: sender, recipient: recipient}
+}
+
+func (e *env) request(method, path, token string, body any) (int, []byte, error) {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return 0, nil, err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, e.server.URL+path, reader)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.server.Client().Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(resp.Body)
+	return resp.StatusCode, buf.Bytes(), err
+}
+
+// read fetches message id as its recipient and returns the response
+// status, with the ciphertext when the server handed it out
+func (e *env) read(id string) (int, string, error) {
+	status, body, err := e.request(http.MethodGet, "/api/v1/messages/"+id, e.recipient, nil)
+	if err != nil || status != http.StatusOK {
+		return status, string(body), err
+	}
+	var msg models.MessageResponse
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return status, "", err
+	}
+	return status, msg.Ciphertext, nil
+}
+
+// restart takes Redis down for downtime; a real restart also forgets the
+// loaded scripts, which flush reproduces
+func (e *env) restart(downtime time.Duration, flush bool) error {
+	e.redis.Close()
+	time.Sleep(downtime)
+	if err := e.redis.Restart(); err != nil {
+		return err
+	}
+	if !flush {
+		return nil
+	}
+	client := redis.NewClient(&redis.Options{Addr: e.redis.Addr()})
+	defer client.Close()
+	return client.ScriptFlush(context.Background()).Err()
+}
+
+// payload is the ciphertext of the i-th message of a round, distinct so a
+// message handed out with another's payload shows
+func payload(i int) string {
+	return base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("secret %d", i)))
+}
+
+func TestBurnOnRead_UnderFailures(t *testing.T) {
+	seed := *seedFlag
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	t.Logf("seed %d", seed)
+	t.Cleanup(func() {
+		if t.Failed() {
+			t.Logf("reproduce with: go test -tags invariants ./tests/invariants -run %s -seed %d", t.Name(), seed)
+		}
+	})
+
+	rng := rand.New(rand.NewSource(seed))
+	for round := 0; round < *roundsFlag; round++ {
+		p := newPlan(rng)
+		if !t.Run(fmt.Sprintf("round %d", round), func(t *testing.T) { runRound(t, p) }) {
+			return
+		}
+	}
+}
+
+func runRound(t *testing.T, p plan) {
+	e := setup(t)
+	ctx := context.Background()
+
+	// Create every message while Redis is up
+	ids := make([]string, p.messages)
+	for i := range ids {
+		status, body, err := e.request(http.MethodPost, "/api/v1/messages", e.sender, map[string]any{
+			"ciphertext": payload(i), "iv": "aXY=", "encryption_key": "key", "recipient_id": recipientID, "ttl": models.MinTTL,
+		})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusCreated, status, string(body))
+		var created models.CreateMessageResponse
+		require.NoError(t, json.Unmarshal(body, &created))
+		ids[i] = created.ID
+		if p.failMark[i] {
+			e.metadata.failMarkAsRead(created.ID)
+		}
+	}
+
+	// Read every message from several readers at once while Redis restarts
+	var (
+		mu        sync.Mutex
+		delivered = make(map[string][]string) // message ID -> ciphertexts handed out
+		wg        sync.WaitGroup
+		start     = make(chan struct{})
+	)
+	for i, id := range ids {
+		for r := 0; r < p.readers[i]; r++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				<-start
+				// Transport errors are expected while Redis is down; only a
+				// handed-out payload counts
+				if status, ciphertext, _ := e.read(id); status == http.StatusOK {
+					mu.Lock()
+					delivered[id] = append(delivered[id], ciphertext)
+					mu.Unlock()
+				}
+			}()
+		}
+	}
+	chaos := make(chan error, 1)
+	go func() {
+		<-start
+		for i, at := range p.restarts {
+			time.Sleep(at)
+			if err := e.restart(p.downtimes[i], p.flushScript[i]); err != nil {
+				chaos <- err
+				return
+			}
+		}
+		chaos <- nil
+	}()
+	close(start)
+	wg.Wait()
+	require.NoError(t, <-chaos)
+
+	// After a burst of failed dials the Redis client refuses to dial again
+	// for up to a second, so wait until it reaches Redis again
+	require.Eventually(t, func() bool { return e.store.Ping(ctx) == nil }, 5*time.Second, 10*time.Millisecond, "Redis unreachable after the restarts")
+
+	settled := make(map[string]string) // message ID -> reply to the settling read
+	// Settle: with Redis up again, one more read per message must deliver
+	// exactly the messages nobody got yet
+	for i, id := range ids {
+		status, ciphertext, err := e.read(id)
+		require.NoError(t, err)
+		if status == http.StatusOK {
+			delivered[id] = append(delivered[id], ciphertext)
+		}
+		settled[id] = fmt.Sprintf("%d %s", status, ciphertext)
+
+		require.LessOrEqual(t, len(delivered[id]), 1, "message %s handed to %d readers", id, len(delivered[id]))
+		if len(delivered[id]) == 1 {
+			require.Equal(t, payload(i), delivered[id][0], "message %s handed out with another payload", id)
+		}
+	}
+
+	// A handed-out message is gone from Redis; metadata says read unless
+	// MarkAsRead failed, which leaves it pending for the janitor
+	for i, id := range ids {
+		stored, err := e.store.Exists(ctx, id)
+		require.NoError(t, err)
+		metadata, err := e.metadata.FindByMessageID(ctx, id)
+		require.NoError(t, err)
+
+		switch {
+		case len(delivered[id]) == 1 && !p.failMark[i]:
+			require.False(t, stored, "message %s read but still stored", id)
+			require.Equal(t, models.StatusRead, metadata.Status, "message %s read", id)
+		case len(delivered[id]) == 1:
+			require.False(t, stored, "message %s read but still stored", id)
+			require.Equal(t, models.StatusPending, metadata.Status, "message %s read with MarkAsRead failing", id)
+		default:
+			// Burned by a read whose reply was lost in a restart: never
+			// delivered, and never deliverable again
+			require.False(t, stored, "message %s undelivered but still stored; settling read got %s", id, settled[id])
+			require.Equal(t, models.StatusPending, metadata.Status, "message %s burned without delivery", id)
+		}
+	}
+
+	// Let the messages run out: the janitor must bring every one still
+	// pending to expired and leave the read ones alone
+	e.redis.FastForward(time.Duration(models.MinTTL) * time.Second)
+	for _, id := range ids {
+		require.NoError(t, e.metadata.UpdateExpiresAt(ctx, id, time.Now().Add(-time.Second)))
+	}
+	api.NewMessageJanitor(e.metadata, e.store, nil, 0).Sweep(ctx)
+
+	for i, id := range ids {
+		metadata, err := e.metadata.FindByMessageID(ctx, id)
+		require.NoError(t, err)
+		if len(delivered[id]) == 1 && !p.failMark[i] {
+			require.Equal(t, models.StatusRead, metadata.Status, "message %s after the janitor", id)
+		} else {
+			require.Equal(t, models.StatusExpired, metadata.Status, "message %s after the janitor", id)
+		}
+
+		status, _, err := e.read(id)
+		require.NoError(t, err)
+		require.NotEqual(t, http.StatusOK, status, "message %s delivered after settling", id)
+	}
+}
@@ -0,0 +1,208 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/integrations/slack"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/storage"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// abuseRouter serves GET /messages/:id with an abuse detector for a message
+// sent from user 1 to user 2; user 3 is a bystander
+func abuseRouter(t *testing.T, store storage.Storage, cfg config.AbuseConfig, slackClient *slack.Client) (*gin.Engine, *fakes.MetadataStore, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	users := seedUsers(t)
+	require.NoError(t, users.Create(ctx, &models.User{Email: "bystander@example.com", Name: "Bystander"}))
+
+	id, err := store.Store(ctx, &models.Message{Ciphertext: "c", IV: "iv"}, time.Hour)
+	require.NoError(t, err)
+	metadataStore := fakes.NewMetadataStore(users)
+	seedMessage(t, metadataStore, id, 1, 2)
+
+	detector := api.NewAbuseDetector(cfg, store, metadataStore, users, api.NewIntegrations(api.IntegrationClients{Slack: slackClient}), nil, nil)
+	handler := api.NewMessageHandler(store, metadataStore, 0, nil, detector, nil, nil)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		userID, _ := strconv.ParseInt(c.GetHeader("X-Test-User"), 10, 64)
+		c.Set("user_id", userID)
+		c.Next()
+	})
+	router.GET("/messages/:id", handler.GetMessage)
+	return router, metadataStore, id
+}
+
+// readFrom reads a message as userID from the given client address
+func readFrom(router *gin.Engine, id string, userID int64, addr string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/messages/"+id, nil)
+	req.Header.Set("X-Test-User", strconv.FormatInt(userID, 10))
+	req.RemoteAddr = addr
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// webhookServer records the alerts posted to it
+func webhookServer(t *testing.T) (string, <-chan models.AbuseAlert) {
+	t.Helper()
+	alerts := make(chan models.AbuseAlert, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert models.AbuseAlert
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&alert))
+		alerts <- alert
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, alerts
+}
+
+func TestAbuseDetector_AlertsWhenThresholdCrossed(t *testing.T) {
+	webhookURL, alerts := webhookServer(t)
+
+	// Slack receives the sender's DM
+	dms := make(chan string, 10)
+	slackAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chat.postMessage" {
+			body, _ := io.ReadAll(r.Body)
+			dms <- string(body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ok":true,"user":{"id":"U1"},"channel":{"id":"D1"}}`)
+	}))
+	t.Cleanup(slackAPI.Close)
+	slackClient := slack.NewClient(&slack.Config{BotToken: "xoxb-test", APIURL: slackAPI.URL})
+
+	store := fakes.NewStorage()
+	cfg := config.AbuseConfig{Threshold: 3, Window: time.Hour, WebhookURL: webhookURL}
+	router, _, id := abuseRouter(t, store, cfg, slackClient)
+
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusForbidden, readFrom(router, id, 3, fmt.Sprintf("203.0.113.%d:4000", i%2+1)).Code)
+	}
+	select {
+	case <-alerts:
+		t.Fatal("alerted before the threshold was crossed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The fourth attempt crosses the threshold; later ones do not alert again
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusForbidden, readFrom(router, id, 3, "198.51.100.9:4000").Code)
+	}
+
+	var alert models.AbuseAlert
+	select {
+	case alert = <-alerts:
+	case <-time.After(2 * time.Second):
+		t.Fatal("no webhook alert")
+	}
+	assert.Equal(t, models.AbuseAlertEvent, alert.Event)
+	assert.Equal(t, id, alert.MessageID)
+	assert.Equal(t, int64(1), alert.SenderID)
+	assert.Equal(t, 4, alert.Attempts)
+	assert.Equal(t, int64(3600), alert.WindowSeconds)
+	assert.ElementsMatch(t, []string{"203.0.113.1", "203.0.113.2", "198.51.100.9"}, alert.SourceIPs)
+	assert.False(t, alert.Revoked)
+
+	var dm string
+	select {
+	case dm = <-dms:
+	case <-time.After(2 * time.Second):
+		t.Fatal("sender was not notified")
+	}
+	assert.Contains(t, dm, "Denied attempts: 4")
+	assert.Contains(t, dm, "198.51.100.9")
+	assert.NotContains(t, dm, "test-key")
+	assert.NotContains(t, dm, "/m/")
+
+	select {
+	case extra := <-alerts:
+		t.Fatalf("alerted twice: %+v", extra)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The message is still readable by its recipient
+	assert.Equal(t, http.StatusOK, readFrom(router, id, 2, "192.0.2.1:4000").Code)
+}
+
+func TestAbuseDetector_AutoRevokeBurnsRedisKey(t *testing.T) {
+	store := setupTestStorage(t)
+	defer store.Close()
+	webhookURL, alerts := webhookServer(t)
+
+	cfg := config.AbuseConfig{Threshold: 2, Window: time.Hour, AutoRevoke: true, WebhookURL: webhookURL}
+	router, metadataStore, id := abuseRouter(t, store, cfg, nil)
+
+	for i := 0; i < 3; i++ {
+		require.Equal(t, http.StatusForbidden, readFrom(router, id, 3, "203.0.113.1:4000").Code)
+	}
+
+	// Revocation happens before the crossing request completes
+	exists, err := store.Exists(context.Background(), id)
+	require.NoError(t, err)
+	assert.False(t, exists, "payload should be burned")
+
+	m, err := metadataStore.FindByMessageID(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusExpired, m.Status)
+	assert.Empty(t, m.EncryptionKey)
+
+	select {
+	case alert := <-alerts:
+		assert.True(t, alert.Revoked)
+		assert.Equal(t, 3, alert.Attempts)
+	case <-time.After(2 * time.Second):
+		t.Fatal("no webhook alert")
+	}
+
+	assert.Equal(t, http.StatusGone, readFrom(router, id, 2, "192.0.2.1:4000").Code)
+}
+
+func TestAbuseDetector_DisabledWithoutThreshold(t *testing.T) {
+	assert.Nil(t, api.NewAbuseDetector(config.AbuseConfig{}, fakes.NewStorage(), nil, nil, nil, nil, nil))
+
+	// A nil detector ignores attempts
+	var detector *api.AbuseDetector
+	detector.Observe(context.Background(), &models.MessageMetadata{MessageID: "m"}, "203.0.113.1")
+}
+
+func TestRecordDenied_SlidingWindow(t *testing.T) {
+	store := setupTestStorage(t)
+	defer store.Close()
+	ctx := context.Background()
+	id := storeClaimable(t, store)
+
+	count, sources, err := store.RecordDenied(ctx, id, "203.0.113.1", 200*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, []string{"203.0.113.1"}, sources)
+
+	count, sources, err = store.RecordDenied(ctx, id, "203.0.113.1", 200*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, []string{"203.0.113.1"}, sources)
+
+	// Older attempts leave the window
+	time.Sleep(250 * time.Millisecond)
+	count, sources, err = store.RecordDenied(ctx, id, "2001:db8::1", 200*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.Equal(t, []string{"2001:db8::1"}, sources)
+}
@@ -0,0 +1,162 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/accesslog"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// accessRouter serves the message endpoints with an access log for a message
+// sent from user 1 to user 2; user 3 is a bystander
+func accessRouter(t *testing.T) (*gin.Engine, *fakes.AccessLogStore, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	users := seedUsers(t)
+	require.NoError(t, users.Create(ctx, &models.User{Email: "bystander@example.com", Name: "Bystander"}))
+
+	store := fakes.NewStorage()
+	id, err := store.Store(ctx, &models.Message{Ciphertext: "c", IV: "iv"}, time.Hour)
+	require.NoError(t, err)
+	metadataStore := fakes.NewMetadataStore(users)
+	seedMessage(t, metadataStore, id, 1, 2)
+
+	accessStore := fakes.NewAccessLogStore(users)
+	handler := api.NewMessageHandler(store, metadataStore, 0, accesslog.NewRecorder(accessStore, 0), nil, nil, nil)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		userID, _ := strconv.ParseInt(c.GetHeader("X-Test-User"), 10, 64)
+		c.Set("user_id", userID)
+		c.Next()
+	})
+	router.GET("/messages/:id", handler.GetMessage)
+	router.GET("/messages/:id/preview", handler.PreviewMessage)
+	router.GET("/messages/:id/access", handler.ListAccess)
+	return router, accessStore, id
+}
+
+func listAccess(t *testing.T, router *gin.Engine, id string) []models.AccessLogEntry {
+	t.Helper()
+	w := requestAs(router, "GET", "/messages/"+id+"/access", 1)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp models.MessageAccessResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, id, resp.MessageID)
+	return resp.Entries
+}
+
+func TestAccessLog_RecordsDeniedAndGoneAttempts(t *testing.T) {
+	router, _, id := accessRouter(t)
+
+	require.Equal(t, http.StatusForbidden, requestAs(router, "GET", "/messages/"+id, 3).Code)
+	require.Equal(t, http.StatusOK, requestAs(router, "GET", "/messages/"+id+"/preview", 2).Code)
+	require.Equal(t, http.StatusOK, requestAs(router, "GET", "/messages/"+id, 2).Code)
+	require.Equal(t, http.StatusGone, requestAs(router, "GET", "/messages/"+id, 2).Code)
+
+	entries := listAccess(t, router, id)
+	require.Len(t, entries, 4)
+
+	// Newest first
+	assert.Equal(t, models.AccessActionRead, entries[0].Action)
+	assert.Equal(t, models.AccessGone, entries[0].Outcome)
+	assert.Equal(t, models.AccessRead, entries[1].Outcome)
+	assert.Equal(t, "Recipient", entries[1].UserName)
+	assert.Equal(t, models.AccessActionPreview, entries[2].Action)
+	assert.Equal(t, models.AccessAllowed, entries[2].Outcome)
+
+	denied := entries[3]
+	assert.Equal(t, int64(3), denied.UserID)
+	assert.Equal(t, "Bystander", denied.UserName)
+	assert.Equal(t, models.AccessActionRead, denied.Action)
+	assert.Equal(t, models.AccessDenied, denied.Outcome)
+	assert.False(t, denied.CreatedAt.IsZero())
+}
+
+func TestAccessLog_MalformedRequestsNotRecorded(t *testing.T) {
+	router, accessStore, id := accessRouter(t)
+
+	require.Equal(t, http.StatusBadRequest, requestAs(router, "GET", "/messages/not*an*id", 3).Code)
+
+	entries, err := accessStore.ListAccess(context.Background(), "not*an*id", 10)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+	assert.Empty(t, listAccess(t, router, id))
+}
+
+func TestListAccess_SenderOnly(t *testing.T) {
+	router, _, id := accessRouter(t)
+
+	for _, userID := range []int64{2, 3} {
+		w := requestAs(router, "GET", "/messages/"+id+"/access", userID)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+		assert.Contains(t, w.Body.String(), models.ErrorCodeForbidden)
+	}
+
+	w := requestAs(router, "GET", "/messages/AAAAAAAAAAAAAAAAAAAAAA/access", 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestRecorder_DropsWhenFull(t *testing.T) {
+	accessStore := fakes.NewAccessLogStore(nil)
+	recorder := accesslog.NewRecorder(accessStore, 2)
+
+	for i := 0; i < 5; i++ {
+		recorder.Record(&models.AccessLogEntry{MessageID: "m", UserID: 1, Action: models.AccessActionRead, Outcome: models.AccessDenied})
+	}
+	assert.Equal(t, int64(3), recorder.Dropped())
+
+	entries, err := recorder.List(context.Background(), "m", 10)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestRecorder_StoreFailureIsNotFatal(t *testing.T) {
+	accessStore := fakes.NewAccessLogStore(nil)
+	accessStore.RecordErr = errors.New("database down")
+	recorder := accesslog.NewRecorder(accessStore, 0)
+
+	recorder.Record(&models.AccessLogEntry{MessageID: "m", UserID: 1, Action: models.AccessActionRead, Outcome: models.AccessRead})
+	recorder.Flush(context.Background())
+
+	// The failed batch is discarded rather than retried
+	accessStore.RecordErr = nil
+	entries, err := recorder.List(context.Background(), "m", 10)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// A nil recorder is a no-op
+	var disabled *accesslog.Recorder
+	disabled.Record(&models.AccessLogEntry{MessageID: "m"})
+	disabled.Flush(context.Background())
+}
+
+func TestMessageJanitor_PrunesAccessLog(t *testing.T) {
+	ctx := context.Background()
+	accessStore := fakes.NewAccessLogStore(nil)
+	require.NoError(t, accessStore.RecordAccess(ctx, []*models.AccessLogEntry{
+		{MessageID: "m", UserID: 1, Action: models.AccessActionRead, Outcome: models.AccessRead, CreatedAt: time.Now().Add(-48 * time.Hour)},
+		{MessageID: "m", UserID: 2, Action: models.AccessActionRead, Outcome: models.AccessDenied, CreatedAt: time.Now()},
+	}))
+
+	api.NewMessageJanitor(fakes.NewMetadataStore(nil), fakes.NewStorage(), accessStore, 24*time.Hour).Sweep(ctx)
+
+	entries, err := accessStore.ListAccess(ctx, "m", 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, int64(2), entries[0].UserID)
+}
@@ -0,0 +1,246 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// csvRouter serves user import and export over an empty user store
+func csvRouter(t *testing.T) (*gin.Engine, *fakes.UserStore) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	users := fakes.NewUserStore()
+	handler := api.NewAdminHandler(users, fakes.NewMetadataStore(users), fakes.NewStorage(), nil, testDependencies().Config, nil, nil)
+	router := gin.New()
+	router.POST("/admin/users/import", handler.ImportUsersCSV)
+	router.GET("/admin/users/export", handler.ExportUsersCSV)
+	return router, users
+}
+
+type importResult struct {
+	Created int      `json:"created"`
+	Failed  int      `json:"failed"`
+	Errors  []string `json:"errors"`
+}
+
+// importCSV uploads data as the import file; the result is only decoded
+// for 200 responses
+func importCSV(t *testing.T, router *gin.Engine, data []byte) (*httptest.ResponseRecorder, importResult) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "users.csv")
+	require.NoError(t, err)
+	_, _ = part.Write(data)
+	require.NoError(t, form.Close())
+
+	req, _ := http.NewRequest("POST", "/admin/users/import", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var result importResult
+	if w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	}
+	return w, result
+}
+
+func fixture(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/csv/" + name)
+	require.NoError(t, err)
+	return data
+}
+
+func TestImportUsersCSV_WindowsFiles(t *testing.T) {
+	tests := []struct {
+		file   string
+		emails []string
+	}{
+		{"bom_crlf.csv", []string{"win1@corp.com", "win2@corp.com"}},
+		{"cr_only.csv", []string{"mac1@corp.com", "mac2@corp.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			router, users := csvRouter(t)
+			w, result := importCSV(t, router, fixture(t, tt.file))
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			assert.Equal(t, len(tt.emails), result.Created)
+			assert.Empty(t, result.Errors)
+
+			for _, email := range tt.emails {
+				user, err := users.FindByEmail(context.Background(), email)
+				require.NoError(t, err)
+				assert.NotContains(t, user.Name, "\r")
+			}
+		})
+	}
+
+	// The last column is read without its CR
+	router, users := csvRouter(t)
+	_, _ = importCSV(t, router, fixture(t, "bom_crlf.csv"))
+	admin, err := users.FindByEmail(context.Background(), "win2@corp.com")
+	require.NoError(t, err)
+	assert.True(t, admin.IsAdmin)
+}
+
+func TestImportUsersCSV_RejectsHeaders(t *testing.T) {
+	router, _ := csvRouter(t)
+
+	w, _ := importCSV(t, router, fixture(t, "unknown_columns.csv"))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	var resp models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, models.ErrorCodeInvalidCSV, resp.Code)
+	assert.Contains(t, resp.Error, `"role", "team"`)
+	assert.Contains(t, resp.Error, "email,name,password[,is_admin]")
+
+	w, _ = importCSV(t, router, fixture(t, "wrong_order.csv"))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "email,name,password[,is_admin]")
+
+	w, _ = importCSV(t, router, []byte("\xef\xbb\xbf"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "empty")
+}
+
+func TestImportUsersCSV_Limits(t *testing.T) {
+	router, users := csvRouter(t)
+
+	w, result := importCSV(t, router, fixture(t, "long_field.csv"))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, 1, result.Created)
+	assert.Equal(t, 2, result.Failed)
+	assert.Equal(t, []string{
+		"Row 3: name is longer than 256 characters",
+		"Row 4: insufficient columns",
+	}, result.Errors)
+	_, err := users.FindByEmail(context.Background(), "long@corp.com")
+	assert.Error(t, err)
+
+	var many strings.Builder
+	many.WriteString("email,name,password\n")
+	for i := 0; i <= 10000; i++ {
+		fmt.Fprintf(&many, "user%d@corp.com,User %d,password123\n", i, i)
+	}
+	w, _ = importCSV(t, router, []byte(many.String()))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "more than 10000 rows")
+	_, err = users.FindByEmail(context.Background(), "user0@corp.com")
+	assert.Error(t, err, "an oversized file creates nobody")
+}
+
+// heapSampler is a user store that records the live heap each time a user
+// is created, which happens while an import is being read
+type heapSampler struct {
+	*fakes.UserStore
+	peak uint64
+}
+
+func (s *heapSampler) Create(ctx context.Context, user *models.User) error {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	if stats.HeapAlloc > s.peak {
+		s.peak = stats.HeapAlloc
+	}
+	return s.UserStore.Create(ctx, user)
+}
+
+func TestImportUsersCSV_StreamsLargeFiles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	users := &heapSampler{UserStore: fakes.NewUserStore()}
+	handler := api.NewAdminHandler(users, fakes.NewMetadataStore(users.UserStore), fakes.NewStorage(), nil, testDependencies().Config, nil, nil)
+	router := gin.New()
+	router.POST("/admin/users/import", handler.ImportUsersCSV)
+
+	// Rows with a name over the length limit fail without hashing a
+	// password; the last row is created once the rest has been read
+	var data strings.Builder
+	data.WriteString("email,name,password\n")
+	longName := strings.Repeat("n", 700)
+	for i := 0; i < 9999; i++ {
+		fmt.Fprintf(&data, "user%d@corp.com,%s,password123\n", i, longName)
+	}
+	data.WriteString("last@corp.com,Last,password123\n")
+	size := uint64(data.Len())
+	require.Greater(t, size, uint64(6<<20))
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "users.csv")
+	require.NoError(t, err)
+	_, _ = io.WriteString(part, data.String())
+	require.NoError(t, form.Close())
+	req, _ := http.NewRequest("POST", "/admin/users/import", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+
+	runtime.GC()
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result importResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+
+	assert.Equal(t, 1, result.Created)
+	assert.Equal(t, 9999, result.Failed)
+	require.Len(t, result.Errors, 101, "row errors are capped")
+	assert.Equal(t, "Row 2: name is longer than 256 characters", result.Errors[0])
+	assert.Equal(t, "9899 more rows failed", result.Errors[100])
+
+	// Only a small part of the file is in memory at any time
+	require.NotZero(t, users.peak)
+	assert.Less(t, users.peak, before.HeapAlloc+size/4,
+		"import held %d bytes of a %d byte file", int64(users.peak)-int64(before.HeapAlloc), size)
+}
+
+func TestExportUsersCSV_NeutralizesFormulas(t *testing.T) {
+	router, users := csvRouter(t)
+	w, result := importCSV(t, router, fixture(t, "formulas.csv"))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Equal(t, 5, result.Created)
+	// The import trims names; other paths may not
+	users.Seed(&models.User{Email: "tab@corp.com", Name: "\tTabbed"})
+
+	req, _ := http.NewRequest("GET", "/admin/users/export", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"id", "email", "name", "is_admin", "is_service"}, records[0])
+	names := map[string]string{}
+	for _, r := range records[1:] {
+		names[r[1]] = r[2]
+	}
+	assert.Equal(t, `'=HYPERLINK("http://evil.example","Click")`, names["eq@corp.com"])
+	assert.Equal(t, "'+1+2", names["plus@corp.com"])
+	assert.Equal(t, "'-2+3", names["minus@corp.com"])
+	assert.Equal(t, "'@SUM(A1:A9)", names["at@corp.com"])
+	assert.Equal(t, "'\tTabbed", names["tab@corp.com"])
+	assert.Equal(t, "Plain Name", names["plain@corp.com"])
+}
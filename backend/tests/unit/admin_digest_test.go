@@ -0,0 +1,208 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/integrations/slack"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// digestChannel records the messages posted to Slack; failPosts makes the
+// next posts fail
+type digestChannel struct {
+	mu        sync.Mutex
+	posts     []map[string]interface{}
+	failPosts int
+}
+
+func (d *digestChannel) Posts() []map[string]interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]map[string]interface{}(nil), d.posts...)
+}
+
+func newDigestChannel(t *testing.T) (*digestChannel, *slack.Client) {
+	d := &digestChannel{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		if d.failPosts > 0 {
+			d.failPosts--
+			fmt.Fprint(w, `{"ok":false,"error":"channel_not_found"}`)
+			return
+		}
+		var payload map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&payload))
+		d.posts = append(d.posts, payload)
+		fmt.Fprint(w, `{"ok":true,"ts":"1.0"}`)
+	}))
+	t.Cleanup(server.Close)
+	return d, slack.NewClient(&slack.Config{BotToken: "xoxb-test", APIURL: server.URL})
+}
+
+// digestFixture is a reporter on a weekly Monday 09:00 schedule, with one
+// message and one failed notification inside the last period and one of
+// each before it
+type digestFixture struct {
+	reporter *api.DigestReporter
+	store    *fakes.DigestStore
+	channel  *digestChannel
+	now      time.Time // Wednesday after the period ended
+}
+
+func newDigestFixture(t *testing.T, maxPending int) *digestFixture {
+	t.Helper()
+	channel, slackClient := newDigestChannel(t)
+	users := seedUsers(t)
+	metadataStore := fakes.NewMetadataStore(users)
+	store := fakes.NewDigestStore()
+
+	periodEnd := time.Date(2026, 3, 9, 9, 0, 0, 0, time.Local) // a Monday
+	for i, created := range []time.Time{periodEnd.Add(-24 * time.Hour), periodEnd.AddDate(0, 0, -10)} {
+		require.NoError(t, metadataStore.Create(context.Background(), &models.MessageMetadata{
+			MessageID:   fmt.Sprintf("digest-%d", i),
+			SenderID:    1,
+			RecipientID: 2,
+			Status:      models.StatusPending,
+			CreatedAt:   created,
+			ExpiresAt:   time.Now().Add(time.Hour),
+		}))
+		require.NoError(t, store.RecordEventAt(models.EventNotificationFailed, created))
+	}
+	require.NoError(t, store.RecordEventAt(models.EventAbuseAlert, periodEnd.Add(-time.Hour)))
+
+	reporter, err := api.NewDigestReporter(
+		config.DigestConfig{Schedule: "0 9 * * 1", SlackChannel: "#vanish-admins"},
+		maxPending, store, users, metadataStore,
+		api.NewIntegrations(api.IntegrationClients{Slack: slackClient}),
+	)
+	require.NoError(t, err)
+	return &digestFixture{reporter: reporter, store: store, channel: channel, now: periodEnd.AddDate(0, 0, 2)}
+}
+
+func TestDigest_PostsOncePerPeriod(t *testing.T) {
+	f := newDigestFixture(t, 2)
+
+	result, err := f.reporter.Send(context.Background(), f.now)
+	require.NoError(t, err)
+	assert.True(t, result.Sent)
+
+	d := result.Digest
+	assert.Equal(t, time.Date(2026, 3, 9, 9, 0, 0, 0, time.Local), d.To)
+	assert.Equal(t, time.Date(2026, 3, 2, 9, 0, 0, 0, time.Local), d.From)
+	assert.Equal(t, 1, d.Created, "only the message of the period")
+	assert.Equal(t, 1, d.NotificationFailures, "only the failure of the period")
+	assert.Equal(t, 1, d.AbuseAlerts)
+	assert.Equal(t, 2, d.Statistics.Messages.Total)
+	require.NotNil(t, d.RecipientsNearInboxCap)
+	assert.Equal(t, 1, *d.RecipientsNearInboxCap, "2 of 2 unread reaches 80% of the cap")
+
+	posts := f.channel.Posts()
+	require.Len(t, posts, 1)
+	assert.Equal(t, "#vanish-admins", posts[0]["channel"])
+	assert.NotEmpty(t, posts[0]["blocks"])
+	body, _ := json.Marshal(posts[0])
+	for _, private := range []string{"sender@example.com", "recipient@example.com", "digest-0", "digest-1"} {
+		assert.NotContains(t, string(body), private, "the digest must hold aggregate numbers only")
+	}
+
+	// The same period again, e.g. from another instance or the endpoint
+	result, err = f.reporter.Send(context.Background(), f.now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, result.Sent)
+	assert.Len(t, f.channel.Posts(), 1)
+}
+
+func TestDigest_RetriesAfterFailedPost(t *testing.T) {
+	f := newDigestFixture(t, 0)
+	f.channel.failPosts = 1
+
+	_, err := f.reporter.Send(context.Background(), f.now)
+	require.Error(t, err)
+	assert.False(t, f.store.Claimed(time.Date(2026, 3, 9, 9, 0, 0, 0, time.Local).UTC().Format(time.RFC3339)),
+		"a digest that was not posted must not count as sent")
+
+	result, err := f.reporter.Send(context.Background(), f.now)
+	require.NoError(t, err)
+	assert.True(t, result.Sent)
+	assert.Nil(t, result.Digest.RecipientsNearInboxCap, "no cap, no near-cap count")
+	assert.Len(t, f.channel.Posts(), 1)
+}
+
+func TestSendDigest_Endpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	users := seedUsers(t)
+	metadataStore := fakes.NewMetadataStore(users)
+	_, slackClient := newDigestChannel(t)
+
+	send := func(cfg config.DigestConfig, store *fakes.DigestStore, slackClient *slack.Client) *httptest.ResponseRecorder {
+		reporter, err := api.NewDigestReporter(cfg, 0, store, users, metadataStore,
+			api.NewIntegrations(api.IntegrationClients{Slack: slackClient}))
+		require.NoError(t, err)
+		router := gin.New()
+		router.POST("/admin/digest/send", reporter.SendDigest)
+		req, _ := http.NewRequest("POST", "/admin/digest/send", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	cfg := config.DigestConfig{Schedule: "@daily", SlackChannel: "#vanish-admins"}
+
+	w := send(config.DigestConfig{}, fakes.NewDigestStore(), slackClient)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code, "no schedule")
+
+	w = send(cfg, fakes.NewDigestStore(), nil)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code, "Slack disabled")
+
+	store := fakes.NewDigestStore()
+	w = send(cfg, store, slackClient)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp models.DigestSendResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.Sent)
+	assert.True(t, strings.HasSuffix(resp.Digest.Period, "Z"))
+
+	w = send(cfg, store, slackClient)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.False(t, resp.Sent)
+}
+
+func TestNotificationFailure_CountedForDigest(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	channel, slackClient := newDigestChannel(t)
+	channel.failPosts = 10
+	users := seedUsers(t)
+	store := fakes.NewDigestStore()
+	handler := api.NewNotificationHandler(users, fakes.NewMetadataStore(users),
+		api.NewIntegrations(api.IntegrationClients{Slack: slackClient}), nil, nil, api.NewEventLog(store), nil)
+
+	router := gin.New()
+	router.Use(authAs(1))
+	router.POST("/notifications/send-slack", handler.SendSlackNotification)
+
+	w := postNotification(router, "/notifications/send-slack", api.SendNotificationRequest{
+		RecipientID: 2,
+		MessageURL:  "http://localhost:5173/m/abc#key",
+	})
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+
+	counts, err := store.CountEvents(context.Background(), time.Now().Add(-time.Minute), time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 1, counts[models.EventNotificationFailed])
+}
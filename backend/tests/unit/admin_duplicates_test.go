@@ -0,0 +1,269 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// emailRouter serves the full API with one admin, admin@example.com, and
+// returns a caller, the in-memory stores and the admin's token
+func emailRouter(t *testing.T) (call apiCall, deps api.Dependencies, adminToken string) {
+	t.Helper()
+	deps = testDependencies()
+	hashed, err := models.HashPassword("password123")
+	require.NoError(t, err)
+	admin := &models.User{Email: "admin@example.com", Name: "Admin", Password: hashed, IsAdmin: true}
+	require.NoError(t, deps.UserStore.Create(context.Background(), admin))
+	adminToken, err = deps.JWTManager.Generate(admin.ID, admin.Email)
+	require.NoError(t, err)
+
+	return apiRouter(t, deps), deps, adminToken
+}
+
+func TestAdminUsers_NormalizeEmails(t *testing.T) {
+	call, deps, adminToken := emailRouter(t)
+	ctx := context.Background()
+
+	w := call("POST", "/api/v1/admin/users", adminToken,
+		`{"email":"Carol@Corp.com","name":"Carol","password":"password123"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	carol, err := deps.UserStore.FindByEmail(ctx, "carol@corp.com")
+	require.NoError(t, err)
+	assert.Equal(t, "carol@corp.com", carol.Email)
+
+	w = call("POST", "/api/v1/admin/users", adminToken,
+		`{"email":"CAROL@corp.com","name":"Carol Again","password":"password123"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// Lookups by email ignore case
+	w = call("GET", provisionPath+"CAROL@CORP.COM", adminToken, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var found models.ProvisionedUser
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &found))
+	assert.Equal(t, carol.ID, found.ID)
+
+	// Renaming an account onto another's email, whatever its case, conflicts
+	w = call("POST", "/api/v1/admin/users", adminToken,
+		`{"email":"dave@corp.com","name":"Dave","password":"password123"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	var dave models.UserInfo
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &dave))
+	w = call("PUT", "/api/v1/admin/users/"+jsonID(dave.ID), adminToken, `{"email":"Carol@Corp.com"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestImportUsersCSV_NormalizesEmails(t *testing.T) {
+	users := fakes.NewUserStore()
+	handler := api.NewAdminHandler(users, fakes.NewMetadataStore(users), fakes.NewStorage(), nil, testDependencies().Config, nil, nil)
+	router := gin.New()
+	router.POST("/admin/users/import", handler.ImportUsersCSV)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "users.csv")
+	require.NoError(t, err)
+	_, _ = part.Write([]byte("email,name,password\n Erin@Corp.com ,Erin,password123\nerin@corp.com,Erin Again,password123\n"))
+	require.NoError(t, form.Close())
+
+	req, _ := http.NewRequest("POST", "/admin/users/import", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"created":1`)
+	assert.Contains(t, w.Body.String(), `"failed":1`)
+
+	erin, err := users.FindByEmail(context.Background(), "erin@corp.com")
+	require.NoError(t, err)
+	assert.Equal(t, "erin@corp.com", erin.Email)
+}
+
+func TestDuplicateAccounts_ReportAndMerge(t *testing.T) {
+	call, deps, adminToken := emailRouter(t)
+	ctx := context.Background()
+	users := deps.UserStore.(*fakes.UserStore)
+	metadata := deps.MetadataStore.(*fakes.MetadataStore)
+
+	// Accounts from before emails were normalized
+	older := &models.User{Email: "Bob@Corp.com", Name: "Bob"}
+	newer := &models.User{Email: "bob@corp.com", Name: "Bob"}
+	other := &models.User{Email: "frank@corp.com", Name: "Frank"}
+	users.Seed(older)
+	users.Seed(newer)
+	users.Seed(other)
+	seedMessage(t, metadata, "to-newer", other.ID, newer.ID)
+	seedMessage(t, metadata, "from-newer", newer.ID, other.ID)
+	seedMessage(t, metadata, "to-older", other.ID, older.ID)
+
+	found, err := users.FindByEmail(ctx, "BOB@corp.com")
+	require.NoError(t, err)
+	assert.Equal(t, older.ID, found.ID, "logins reach the oldest account")
+
+	w := call("GET", "/api/v1/admin/users/duplicates", adminToken, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var report struct {
+		Duplicates []models.DuplicateAccounts `json:"duplicates"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	require.Len(t, report.Duplicates, 1)
+	assert.Equal(t, "bob@corp.com", report.Duplicates[0].Email)
+	require.Len(t, report.Duplicates[0].Accounts, 2)
+	assert.Equal(t, older.ID, report.Duplicates[0].Accounts[0].ID)
+	assert.Equal(t, newer.ID, report.Duplicates[0].Accounts[1].ID)
+
+	w = call("POST", "/api/v1/admin/users/"+jsonID(older.ID)+"/merge/"+jsonID(newer.ID), adminToken, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var merged models.MergeUserResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &merged))
+	assert.Equal(t, models.MergeCounts{Messages: 2}, merged.Moved)
+	assert.Equal(t, older.ID, merged.User.ID)
+	assert.Equal(t, "bob@corp.com", merged.User.Email, "the remaining email is normalized")
+
+	for id, want := range map[string][2]int64{
+		"to-newer":   {other.ID, older.ID},
+		"from-newer": {older.ID, other.ID},
+		"to-older":   {other.ID, older.ID},
+	} {
+		m, err := metadata.FindByMessageID(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, want, [2]int64{m.SenderID, m.RecipientID}, id)
+		assert.Equal(t, models.StatusPending, m.Status, "moved messages stay readable")
+	}
+
+	tombstone, err := users.FindByID(ctx, newer.ID)
+	require.NoError(t, err)
+	assert.True(t, tombstone.IsAnonymized())
+	assert.False(t, tombstone.IsActive)
+
+	w = call("GET", "/api/v1/admin/users/duplicates", adminToken, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"duplicates":[]}`, w.Body.String())
+}
+
+func TestMergeUser_MovesKeysAndAccessLog(t *testing.T) {
+	call, deps, adminToken := emailRouter(t)
+	ctx := context.Background()
+	users := deps.UserStore.(*fakes.UserStore)
+	metadata := deps.MetadataStore.(*fakes.MetadataStore)
+
+	// A local account and the one created at the same person's first SSO login
+	local := &models.User{Email: "heidi@corp.com", Name: "Heidi Local", IsAdmin: true, IsActive: true}
+	sso := &models.User{Email: "heidi.h@corp.com", Name: "Heidi SSO", IsActive: true}
+	users.Seed(local)
+	users.Seed(sso)
+	seedMessage(t, metadata, "from-sso", sso.ID, local.ID)
+	require.NoError(t, users.CreateAPIKey(ctx, &models.APIKey{UserID: sso.ID, Name: "ci", Hash: "sso-key"}))
+	require.NoError(t, users.CreateAPIKey(ctx, &models.APIKey{UserID: local.ID, Name: "laptop", Hash: "local-key"}))
+	require.NoError(t, deps.AccessLogStore.RecordAccess(ctx, []*models.AccessLogEntry{
+		{MessageID: "from-sso", UserID: sso.ID, Action: models.AccessActionRead},
+		{MessageID: "from-sso", UserID: local.ID, Action: models.AccessActionRead},
+		{MessageID: "from-sso", UserID: sso.ID, Action: models.AccessActionPreview},
+	}))
+
+	w := call("POST", "/api/v1/admin/users/"+jsonID(local.ID)+"/merge/"+jsonID(sso.ID), adminToken, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var merged models.MergeUserResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &merged))
+	assert.Equal(t, models.MergeCounts{Messages: 1, APIKeys: 1, AccessLog: 2}, merged.Moved)
+
+	// The kept account's fields win
+	assert.Equal(t, "Heidi Local", merged.User.Name)
+	assert.Equal(t, "heidi@corp.com", merged.User.Email)
+	assert.True(t, merged.User.IsAdmin)
+
+	m, err := metadata.FindByMessageID(ctx, "from-sso")
+	require.NoError(t, err)
+	assert.Equal(t, [2]int64{local.ID, local.ID}, [2]int64{m.SenderID, m.RecipientID})
+
+	keys, err := users.ListAPIKeys(ctx, local.ID)
+	require.NoError(t, err)
+	assert.Len(t, keys, 2)
+	keys, err = users.ListAPIKeys(ctx, sso.ID)
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+	owner, err := users.AuthenticateAPIKey(ctx, "sso-key")
+	require.NoError(t, err)
+	assert.Equal(t, local.ID, owner.ID, "the duplicate's keys keep working for the kept account")
+
+	entries, err := deps.AccessLogStore.ListAccess(ctx, "from-sso", 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	for _, e := range entries {
+		assert.Equal(t, local.ID, e.UserID)
+	}
+
+	tombstone, err := users.FindByID(ctx, sso.ID)
+	require.NoError(t, err)
+	assert.True(t, tombstone.IsAnonymized())
+	assert.False(t, tombstone.IsActive)
+	assert.False(t, tombstone.IsAdmin)
+
+	// The merge is in the admin audit log, not just the request log
+	audit := users.AdminAudit()
+	require.Len(t, audit, 1)
+	assert.Equal(t, int64(1), audit[0].ActorID, "the acting admin")
+	assert.Equal(t, models.AdminActionMergeUsers, audit[0].Action)
+	assert.Equal(t, local.ID, audit[0].UserID)
+	assert.Equal(t, sso.ID, audit[0].RelatedUserID)
+}
+
+func TestMergeUser_Refusals(t *testing.T) {
+	call, deps, adminToken := emailRouter(t)
+	users := deps.UserStore.(*fakes.UserStore)
+	user := &models.User{Email: "grace@corp.com", Name: "Grace"}
+	other := &models.User{Email: "grace.g@corp.com", Name: "Grace"}
+	service := &models.User{Email: "bot@corp.com", Name: "Bot", IsService: true}
+	deleted := &models.User{Email: "ivan@corp.com", Name: "Ivan"}
+	users.Seed(user)
+	users.Seed(other)
+	users.Seed(service)
+	users.Seed(deleted)
+	require.NoError(t, users.Anonymize(context.Background(), deleted.ID))
+
+	mergePath := func(keep, duplicate string) string {
+		return "/api/v1/admin/users/" + keep + "/merge/" + duplicate
+	}
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"into itself", mergePath(jsonID(user.ID), jsonID(user.ID)), http.StatusBadRequest},
+		{"invalid duplicate", mergePath(jsonID(user.ID), "grace"), http.StatusBadRequest},
+		{"unknown kept account", mergePath("999", jsonID(user.ID)), http.StatusNotFound},
+		{"unknown duplicate", mergePath(jsonID(user.ID), "999"), http.StatusNotFound},
+		{"service account", mergePath(jsonID(user.ID), jsonID(service.ID)), http.StatusBadRequest},
+		{"deleted account", mergePath(jsonID(user.ID), jsonID(deleted.ID)), http.StatusBadRequest},
+		{"own account", mergePath(jsonID(user.ID), "1"), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := call("POST", tt.path, adminToken, "")
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+		})
+	}
+
+	// Refusals left both accounts as they were and recorded nothing
+	assert.Empty(t, users.AdminAudit())
+	w := call("POST", mergePath(jsonID(user.ID), jsonID(other.ID)), adminToken, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Len(t, users.AdminAudit(), 1)
+}
+
+// jsonID formats a user ID for a path or a JSON body
+func jsonID(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
@@ -0,0 +1,207 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// timeSeriesRouter serves the time-series endpoint over the given metadata
+func timeSeriesRouter(t *testing.T, metadataStore *fakes.MetadataStore, leaderboards bool) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := &config.Config{Stats: config.StatsConfig{LeaderboardsEnabled: leaderboards}}
+	handler := api.NewAdminHandler(metadataStore.Users, metadataStore, fakes.NewStorage(), nil, cfg, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(1))
+	router.GET("/admin/statistics/timeseries", handler.GetTimeSeries)
+	return router
+}
+
+func createdAt(t *testing.T, store *fakes.MetadataStore, sender, recipient int64, at time.Time) {
+	t.Helper()
+	require.NoError(t, store.Create(context.Background(), &models.MessageMetadata{
+		MessageID:   fmt.Sprintf("msg-%d", at.UnixNano()),
+		SenderID:    sender,
+		RecipientID: recipient,
+		Status:      models.StatusPending,
+		CreatedAt:   at,
+		ExpiresAt:   at.Add(time.Hour),
+	}))
+}
+
+func getTimeSeries(t *testing.T, router *gin.Engine, query string) models.TimeSeriesResponse {
+	t.Helper()
+	w := requestAs(router, "GET", "/admin/statistics/timeseries?"+query, 1)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var resp models.TimeSeriesResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestGetTimeSeries_DailyBucketsInUTC(t *testing.T) {
+	store := fakes.NewMetadataStore(seedUsers(t))
+	newYork := time.FixedZone("UTC-5", -5*60*60)
+
+	// 23:30 in New York on the 1st is 04:30 UTC on the 2nd
+	createdAt(t, store, 1, 2, time.Date(2025, 3, 1, 23, 30, 0, 0, newYork))
+	createdAt(t, store, 1, 2, time.Date(2025, 3, 2, 10, 0, 0, 0, time.UTC))
+	createdAt(t, store, 2, 1, time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC))
+	createdAt(t, store, 1, 2, time.Date(2025, 3, 9, 0, 0, 0, 0, time.UTC)) // outside the range
+
+	resp := getTimeSeries(t, timeSeriesRouter(t, store, true), "metric=created&interval=day&from=2025-03-01&to=2025-03-05")
+
+	assert.Equal(t, time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), resp.From)
+	assert.Equal(t, time.Date(2025, 3, 6, 0, 0, 0, 0, time.UTC), resp.To, "a date 'to' includes that day")
+
+	counts := make([]int64, len(resp.Points))
+	for i, p := range resp.Points {
+		assert.Equal(t, resp.From.AddDate(0, 0, i), p.Bucket)
+		counts[i] = p.Count
+	}
+	assert.Equal(t, []int64{0, 2, 0, 1, 0}, counts)
+
+	require.True(t, resp.LeaderboardsEnabled)
+	require.NotEmpty(t, resp.TopSenders)
+	assert.Equal(t, "Sender", resp.TopSenders[0].Name)
+	assert.Equal(t, int64(2), resp.TopSenders[0].Count)
+	assert.Equal(t, "Recipient", resp.TopRecipients[0].Name)
+}
+
+func TestGetTimeSeries_WeeksStartOnMonday(t *testing.T) {
+	store := fakes.NewMetadataStore(seedUsers(t))
+	createdAt(t, store, 1, 2, time.Date(2025, 3, 9, 23, 0, 0, 0, time.UTC)) // Sunday
+	createdAt(t, store, 1, 2, time.Date(2025, 3, 10, 1, 0, 0, 0, time.UTC)) // Monday
+
+	resp := getTimeSeries(t, timeSeriesRouter(t, store, true), "interval=week&from=2025-03-05T12:00:00Z&to=2025-03-12T00:00:00Z")
+
+	require.Len(t, resp.Points, 2)
+	assert.Equal(t, time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC), resp.Points[0].Bucket)
+	assert.Equal(t, int64(1), resp.Points[0].Count)
+	assert.Equal(t, time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC), resp.Points[1].Bucket)
+	assert.Equal(t, int64(1), resp.Points[1].Count)
+}
+
+func TestGetTimeSeries_EmptyRange(t *testing.T) {
+	store := fakes.NewMetadataStore(seedUsers(t))
+
+	resp := getTimeSeries(t, timeSeriesRouter(t, store, true), "metric=read&from=2025-01-01&to=2025-01-07")
+
+	require.Len(t, resp.Points, 7)
+	for _, p := range resp.Points {
+		assert.Zero(t, p.Count)
+	}
+	assert.Empty(t, resp.TopSenders)
+}
+
+func TestGetTimeSeries_LeaderboardsDisabled(t *testing.T) {
+	store := fakes.NewMetadataStore(seedUsers(t))
+	createdAt(t, store, 1, 2, time.Date(2025, 3, 2, 10, 0, 0, 0, time.UTC))
+
+	router := timeSeriesRouter(t, store, false)
+	resp := getTimeSeries(t, router, "from=2025-03-01&to=2025-03-05")
+
+	assert.False(t, resp.LeaderboardsEnabled)
+	assert.Nil(t, resp.TopSenders)
+	assert.Nil(t, resp.TopRecipients)
+
+	w := requestAs(router, "GET", "/admin/statistics/timeseries?from=2025-03-01&to=2025-03-05", 1)
+	assert.NotContains(t, w.Body.String(), "Sender")
+}
+
+func TestGetTimeSeries_InvalidQuery(t *testing.T) {
+	router := timeSeriesRouter(t, fakes.NewMetadataStore(nil), true)
+
+	for _, query := range []string{
+		"metric=deleted",
+		"interval=month",
+		"from=yesterday",
+		"from=2025-03-05&to=2025-03-01",
+		"from=2020-01-01&to=2025-01-01",
+	} {
+		w := requestAs(router, "GET", "/admin/statistics/timeseries?"+query, 1)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestDiagnoseMessage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	store := fakes.NewStorage()
+	metadataStore := fakes.NewMetadataStore(seedUsers(t))
+	handler := api.NewAdminHandler(metadataStore.Users, metadataStore, store, nil, &config.Config{}, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(1))
+	router.GET("/admin/messages/:id/diagnose", handler.DiagnoseMessage)
+
+	diagnose := func(id string) models.MessageDiagnostics {
+		t.Helper()
+		w := requestAs(router, "GET", "/admin/messages/"+id+"/diagnose", 1)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		assert.NotContains(t, w.Body.String(), "test-key")
+		assert.NotContains(t, w.Body.String(), "secret-ciphertext")
+
+		var report models.MessageDiagnostics
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+		return report
+	}
+
+	// A healthy pending message
+	liveID, err := store.Store(ctx, &models.Message{Ciphertext: "secret-ciphertext", IV: "iv"}, time.Hour)
+	require.NoError(t, err)
+	seedMessage(t, metadataStore, liveID, 1, 2)
+
+	report := diagnose(liveID)
+	assert.Equal(t, models.StatusPending, report.Status)
+	assert.Equal(t, "Sender", report.SenderName)
+	assert.Equal(t, "Recipient", report.RecipientName)
+	assert.True(t, report.StoredPayload)
+	require.NotNil(t, report.StorageTTLSeconds)
+	assert.InDelta(t, 3600, *report.StorageTTLSeconds, 5)
+	assert.True(t, report.Consistent)
+
+	// Pending in the metadata but gone from Redis
+	seedMessage(t, metadataStore, "lost", 1, 2)
+	report = diagnose("lost")
+	assert.False(t, report.StoredPayload)
+	assert.Nil(t, report.StorageTTLSeconds)
+	assert.False(t, report.Consistent)
+	assert.NotEmpty(t, report.Findings)
+
+	// Read and burned
+	readID, err := store.Store(ctx, &models.Message{Ciphertext: "secret-ciphertext", IV: "iv"}, time.Hour)
+	require.NoError(t, err)
+	seedMessage(t, metadataStore, readID, 1, 2)
+	_, err = store.GetAndDelete(ctx, readID)
+	require.NoError(t, err)
+	require.NoError(t, metadataStore.MarkAsRead(ctx, readID))
+	report = diagnose(readID)
+	assert.Equal(t, models.StatusRead, report.Status)
+	assert.NotNil(t, report.ReadAt)
+	assert.True(t, report.Consistent)
+
+	// Redis and the metadata disagree on the expiry
+	driftID, err := store.Store(ctx, &models.Message{Ciphertext: "secret-ciphertext", IV: "iv"}, 10*time.Minute)
+	require.NoError(t, err)
+	seedMessage(t, metadataStore, driftID, 1, 2)
+	report = diagnose(driftID)
+	assert.True(t, report.StoredPayload)
+	assert.False(t, report.Consistent)
+
+	assert.Equal(t, http.StatusNotFound, requestAs(router, "GET", "/admin/messages/missing/diagnose", 1).Code)
+}
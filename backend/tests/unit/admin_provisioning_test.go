@@ -0,0 +1,177 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const provisionPath = "/api/v1/admin/users/by-email/"
+
+// provision upserts email as the admin and decodes the response
+func provision(t *testing.T, call apiCall, adminToken, email, body string, wantStatus int) (models.ProvisionUserResponse, string) {
+	t.Helper()
+	w := call("PUT", provisionPath+email, adminToken, body)
+	require.Equal(t, wantStatus, w.Code, w.Body.String())
+
+	var resp models.ProvisionUserResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	return resp, etag
+}
+
+func TestUpsertUserByEmail_Create(t *testing.T) {
+	call, adminToken, _ := serviceAccountRouter(t)
+
+	resp, etag := provision(t, call, adminToken, "carol@example.com",
+		`{"name":"Carol","password":"carol-password","is_admin":true}`, http.StatusCreated)
+	assert.Equal(t, models.ProvisionCreated, resp.Result)
+	assert.NotZero(t, resp.User.ID)
+	assert.Equal(t, "carol@example.com", resp.User.Email)
+	assert.Equal(t, "Carol", resp.User.Name)
+	assert.True(t, resp.User.IsAdmin)
+	assert.True(t, resp.User.Active, "accounts are active unless stated otherwise")
+
+	// The account reads back with the same ETag
+	w := call("GET", provisionPath+"carol@example.com", adminToken, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+	var read models.ProvisionedUser
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &read))
+	assert.Equal(t, resp.User.ID, read.ID)
+
+	w = call("POST", "/api/v1/auth/login", "", `{"email":"carol@example.com","password":"carol-password"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestUpsertUserByEmail_CreateWithoutPasswordIsSSOOnly(t *testing.T) {
+	call, adminToken, _ := serviceAccountRouter(t)
+
+	resp, _ := provision(t, call, adminToken, "sso@example.com", `{"name":"SSO User"}`, http.StatusCreated)
+	assert.False(t, resp.User.IsAdmin)
+
+	w := call("POST", "/api/v1/auth/login", "", `{"email":"sso@example.com","password":""}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = call("POST", "/api/v1/auth/login", "", `{"email":"sso@example.com","password":"anything"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestUpsertUserByEmail_NoOp(t *testing.T) {
+	call, adminToken, _ := serviceAccountRouter(t)
+	body := `{"name":"Carol","password":"carol-password"}`
+
+	created, etag := provision(t, call, adminToken, "carol@example.com", body, http.StatusCreated)
+
+	again, againETag := provision(t, call, adminToken, "carol@example.com", body, http.StatusOK)
+	assert.Equal(t, models.ProvisionUnchanged, again.Result)
+	assert.Equal(t, created.User, again.User, "nothing changed, not even updated_at")
+	assert.Equal(t, etag, againETag)
+}
+
+func TestGetUserByEmail_IfNoneMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	users := seedUsers(t)
+	handler := api.NewAdminHandler(users, fakes.NewMetadataStore(users), fakes.NewStorage(), nil, &config.Config{}, nil, nil)
+	router := gin.New()
+	router.GET("/users/by-email/:email", handler.GetUserByEmail)
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/users/by-email/recipient@example.com", nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	etag := w.Header().Get("ETag")
+
+	w = get(etag)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, etag, w.Header().Get("ETag"))
+
+	assert.Equal(t, http.StatusOK, get(`"stale"`).Code)
+}
+
+func TestUpsertUserByEmail_Update(t *testing.T) {
+	call, adminToken, userToken := serviceAccountRouter(t)
+
+	// user@example.com exists with password123
+	resp, etag := provision(t, call, adminToken, "user@example.com",
+		`{"name":"Renamed User","password":"ignored-password","is_admin":true}`, http.StatusOK)
+	assert.Equal(t, models.ProvisionUpdated, resp.Result)
+	assert.Equal(t, int64(2), resp.User.ID, "the resource ID is stable")
+	assert.Equal(t, "Renamed User", resp.User.Name)
+	assert.True(t, resp.User.IsAdmin)
+
+	// The password is left alone
+	w := call("POST", "/api/v1/auth/login", "", `{"email":"user@example.com","password":"password123"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// Deactivating changes the ETag and locks the account out
+	resp, deactivatedETag := provision(t, call, adminToken, "user@example.com",
+		`{"name":"Renamed User","is_admin":true,"active":false}`, http.StatusOK)
+	assert.Equal(t, models.ProvisionUpdated, resp.Result)
+	assert.False(t, resp.User.Active)
+	assert.NotEqual(t, etag, deactivatedETag)
+
+	w = call("POST", "/api/v1/auth/login", "", `{"email":"user@example.com","password":"password123"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), models.ErrorCodeAccountInactive)
+	w = call("GET", "/api/v1/auth/me", userToken, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// And reactivating lets it back in
+	resp, _ = provision(t, call, adminToken, "user@example.com", `{"name":"Renamed User","is_admin":true}`, http.StatusOK)
+	assert.True(t, resp.User.Active)
+	w = call("POST", "/api/v1/auth/login", "", `{"email":"user@example.com","password":"password123"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestUpsertUserByEmail_Refusals(t *testing.T) {
+	call, adminToken, userToken := serviceAccountRouter(t)
+	createServiceAccount(t, call, adminToken)
+
+	tests := []struct {
+		name   string
+		token  string
+		email  string
+		body   string
+		status int
+		code   string
+	}{
+		{"not an admin", userToken, "carol@example.com", `{"name":"Carol"}`, http.StatusForbidden, models.ErrorCodeForbidden},
+		{"invalid email", adminToken, "not-an-email", `{"name":"Carol"}`, http.StatusBadRequest, models.ErrorCodeInvalidRequest},
+		{"missing name", adminToken, "carol@example.com", `{}`, http.StatusBadRequest, models.ErrorCodeValidationFailed},
+		{"short password", adminToken, "carol@example.com", `{"name":"Carol","password":"short"}`, http.StatusBadRequest, models.ErrorCodeValidationFailed},
+		{"own account", adminToken, "admin@example.com", `{"name":"Admin","is_admin":true,"active":false}`, http.StatusBadRequest, models.ErrorCodeCannotDeleteSelf},
+		{"service account", adminToken, "ci@example.com", `{"name":"CI Bot"}`, http.StatusConflict, models.ErrorCodeUserExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := call("PUT", provisionPath+tt.email, tt.token, tt.body)
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			var resp models.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.code, resp.Code)
+		})
+	}
+
+	w := call("GET", provisionPath+"nobody@example.com", adminToken, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,116 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/auth"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loginRouter serves the login endpoint for one password account,
+// alice@example.com, and one service account, bot@example.com
+func loginRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	users := fakes.NewUserStore()
+	hashed, err := models.HashPassword("alice-password")
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, users.Create(ctx, &models.User{Email: "alice@example.com", Name: "Alice", Password: hashed}))
+	require.NoError(t, users.Create(ctx, &models.User{Email: "bot@example.com", Name: "Bot", IsService: true}))
+
+	handler := api.NewAuthHandler(users, auth.NewJWTManager("test-secret-key", time.Hour), nil, nil, nil)
+	router := gin.New()
+	router.POST("/login", handler.Login)
+	return router
+}
+
+// timedLogin signs in and returns the response and the fastest of a few
+// attempts, which is the least disturbed by whatever else the machine does
+func timedLogin(router *gin.Engine, email, password string) (*httptest.ResponseRecorder, time.Duration) {
+	var w *httptest.ResponseRecorder
+	fastest := time.Duration(1<<63 - 1)
+	for i := 0; i < 5; i++ {
+		req, _ := http.NewRequest("POST", "/login",
+			strings.NewReader(`{"email":"`+email+`","password":"`+password+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w = httptest.NewRecorder()
+		start := time.Now()
+		router.ServeHTTP(w, req)
+		if elapsed := time.Since(start); elapsed < fastest {
+			fastest = elapsed
+		}
+	}
+	return w, fastest
+}
+
+func TestLogin_UnknownEmailIndistinguishableFromWrongPassword(t *testing.T) {
+	router := loginRouter(t)
+	models.RejectPassword("") // hash the dummy password outside the timings
+
+	wrong, wrongTime := timedLogin(router, "alice@example.com", "wrong-password")
+	unknown, unknownTime := timedLogin(router, "nobody@example.com", "wrong-password")
+
+	assert.Equal(t, http.StatusUnauthorized, wrong.Code)
+	assert.Equal(t, wrong.Code, unknown.Code)
+	assert.Equal(t, wrong.Body.Bytes(), unknown.Body.Bytes())
+
+	// Loose bounds: both run one bcrypt comparison at the same cost
+	assert.Greater(t, unknownTime, wrongTime/3, "unknown %v, wrong password %v", unknownTime, wrongTime)
+	assert.Less(t, unknownTime, wrongTime*3, "unknown %v, wrong password %v", unknownTime, wrongTime)
+}
+
+func TestLogin_FailuresWithoutPasswordHashRunBcrypt(t *testing.T) {
+	router := loginRouter(t)
+	models.RejectPassword("")
+
+	// A bcrypt comparison takes milliseconds; a lookup in the fake store
+	// takes microseconds
+	start := time.Now()
+	models.RejectPassword("wrong-password")
+	compare := time.Since(start)
+
+	for _, email := range []string{"nobody@example.com", "bot@example.com"} {
+		w, elapsed := timedLogin(router, email, "wrong-password")
+		assert.Equal(t, http.StatusUnauthorized, w.Code, email)
+		assert.Greater(t, elapsed, compare/3, "%s answered in %v; a comparison takes %v", email, elapsed, compare)
+	}
+}
+
+func TestRegisterAndLogin_NormalizeEmail(t *testing.T) {
+	call, deps, _ := emailRouter(t)
+
+	w := call("POST", "/api/v1/auth/register", "", `{"email":"  Bob@Corp.com ","name":"Bob","password":"password123"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	bob, err := deps.UserStore.FindByEmail(context.Background(), "bob@corp.com")
+	require.NoError(t, err)
+	assert.Equal(t, "bob@corp.com", bob.Email)
+
+	for _, email := range []string{"bob@corp.com", "BOB@CORP.COM", " Bob@Corp.com"} {
+		w = call("POST", "/api/v1/auth/login", "", `{"email":"`+email+`","password":"password123"}`)
+		assert.Equal(t, http.StatusOK, w.Code, email)
+	}
+
+	w = call("POST", "/api/v1/auth/register", "", `{"email":"bob@CORP.com","name":"Bob Again","password":"password123"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestLogin_AccountStoredWithMixedCase(t *testing.T) {
+	call, deps, _ := emailRouter(t)
+	hashed, err := models.HashPassword("password123")
+	require.NoError(t, err)
+	deps.UserStore.(*fakes.UserStore).Seed(&models.User{Email: "Carol@Corp.com", Name: "Carol", Password: hashed})
+
+	w := call("POST", "/api/v1/auth/login", "", `{"email":"carol@corp.com","password":"password123"}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
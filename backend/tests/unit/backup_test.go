@@ -0,0 +1,176 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/backup"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const backupPassphrase = "correct horse battery staple"
+
+// backupRow is one row of a backup as read back
+type backupRow struct {
+	table string
+	row   string
+}
+
+// writeBackup writes rows to a backup and returns it
+func writeBackup(t *testing.T, rows []backupRow) []byte {
+	t.Helper()
+	counts := map[string]int64{}
+	var tables []backup.TableCount
+	for _, r := range rows {
+		if counts[r.table] == 0 {
+			tables = append(tables, backup.TableCount{Name: r.table})
+		}
+		counts[r.table]++
+	}
+	for i := range tables {
+		tables[i].Rows = counts[tables[i].Name]
+	}
+
+	var buf bytes.Buffer
+	w, err := backup.NewWriter(&buf, backupPassphrase)
+	require.NoError(t, err)
+	require.NoError(t, w.Begin(7, tables))
+	for _, r := range rows {
+		require.NoError(t, w.WriteRow(r.table, []byte(r.row)))
+	}
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
+
+// readBackup reads every row of data, stopping at the first error
+func readBackup(data []byte, passphrase string) (*backup.Manifest, []backupRow, error) {
+	r, err := backup.NewReader(bytes.NewReader(data), passphrase)
+	if err != nil {
+		return nil, nil, err
+	}
+	var rows []backupRow
+	for {
+		table, row, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return r.Manifest(), rows, nil
+		}
+		if err != nil {
+			return r.Manifest(), rows, err
+		}
+		rows = append(rows, backupRow{table, string(row)})
+	}
+}
+
+// manyBackupRows spans several archive entries and encryption chunks
+func manyBackupRows() []backupRow {
+	rows := []backupRow{{"users", `{"id":1,"email":"admin@vanish.local"}`}}
+	padding := strings.Repeat("x", 200)
+	for i := 1; i <= 8000; i++ {
+		rows = append(rows, backupRow{"message_metadata", fmt.Sprintf(`{"id":%d,"note":"%s"}`, i, padding)})
+	}
+	return append(rows, backupRow{"dlp_patterns", `{"name":"aws"}`})
+}
+
+func TestBackup_RoundTrip(t *testing.T) {
+	rows := manyBackupRows()
+	data := writeBackup(t, rows)
+	assert.NotContains(t, string(data), "admin@vanish.local", "rows must be encrypted")
+
+	manifest, got, err := readBackup(data, backupPassphrase)
+	require.NoError(t, err)
+	assert.Equal(t, rows, got)
+	assert.Equal(t, 7, manifest.SchemaVersion)
+	assert.Equal(t, []backup.TableCount{{Name: "users", Rows: 1}, {Name: "message_metadata", Rows: 8000}, {Name: "dlp_patterns", Rows: 1}}, manifest.Tables)
+	assert.Equal(t, backup.PendingMessagesNote, manifest.Note)
+	assert.False(t, manifest.CreatedAt.IsZero())
+}
+
+func TestBackup_RejectsDamage(t *testing.T) {
+	data := writeBackup(t, manyBackupRows())
+
+	_, _, err := readBackup(data, "wrong passphrase, same length")
+	assert.ErrorIs(t, err, backup.ErrDecrypt)
+
+	_, _, err = readBackup([]byte("PGDMP not a backup at all"), backupPassphrase)
+	assert.ErrorIs(t, err, backup.ErrNotBackup)
+
+	// Cut at a chunk boundary and inside a chunk: neither reads to the end
+	for _, size := range []int{len(data) / 2, len(data) - 40} {
+		_, _, err = readBackup(data[:size], backupPassphrase)
+		assert.ErrorIs(t, err, backup.ErrTruncated, "cut at %d of %d bytes", size, len(data))
+	}
+
+	tampered := append([]byte(nil), data...)
+	tampered[len(tampered)/2] ^= 1
+	_, _, err = readBackup(tampered, backupPassphrase)
+	assert.ErrorIs(t, err, backup.ErrCorrupt)
+
+	_, _, err = readBackup(append(append([]byte(nil), data...), 0), backupPassphrase)
+	assert.ErrorIs(t, err, backup.ErrCorrupt, "bytes after the last chunk")
+}
+
+// backupStore exports fixed rows, or fails before writing any
+type backupStore struct {
+	rows []backupRow
+	err  error
+}
+
+func (s *backupStore) Export(_ context.Context, dst *backup.Writer) error {
+	if s.err != nil {
+		return s.err
+	}
+	if err := dst.Begin(1, []backup.TableCount{{Name: "users", Rows: int64(len(s.rows))}}); err != nil {
+		return err
+	}
+	for _, r := range s.rows {
+		if err := dst.WriteRow(r.table, []byte(r.row)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func postBackup(handler *api.BackupHandler) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/admin/backup", nil)
+	c.Set("user_id", int64(1))
+	handler.CreateBackup(c)
+	return w
+}
+
+func TestCreateBackup(t *testing.T) {
+	rows := []backupRow{{"users", `{"id":1}`}, {"users", `{"id":2}`}}
+	w := postBackup(api.NewBackupHandler(&backupStore{rows: rows}, backupPassphrase))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/octet-stream", w.Header().Get("Content-Type"))
+	assert.Regexp(t, `^attachment; filename="vanish-backup-\d{8}-\d{6}\.vbk"$`, w.Header().Get("Content-Disposition"))
+	_, got, err := readBackup(w.Body.Bytes(), backupPassphrase)
+	require.NoError(t, err)
+	assert.Equal(t, rows, got)
+}
+
+func TestCreateBackup_Errors(t *testing.T) {
+	w := postBackup(api.NewBackupHandler(&backupStore{}, ""))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code, "without BACKUP_PASSPHRASE")
+
+	w = postBackup(api.NewBackupHandler(nil, backupPassphrase))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code, "without a database")
+
+	// Nothing was streamed yet, so the failure is still a JSON error
+	w = postBackup(api.NewBackupHandler(&backupStore{err: errors.New("connection refused")}, backupPassphrase))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	assert.Empty(t, w.Header().Get("Content-Disposition"))
+}
@@ -0,0 +1,242 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBodyLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var ran bool
+	router := gin.New()
+	router.POST("/echo", api.BodyLimitMiddleware(10), func(c *gin.Context) {
+		ran = true
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, "%s", body)
+	})
+
+	tests := []struct {
+		name    string
+		body    string
+		chunked bool
+		status  int
+	}{
+		{"under the limit", "0123456", false, http.StatusOK},
+		{"at the limit", "0123456789", false, http.StatusOK},
+		{"over the limit", "0123456789A", false, http.StatusRequestEntityTooLarge},
+		{"chunked under the limit", "0123456", true, http.StatusOK},
+		{"chunked over the limit", "0123456789A", true, http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ran = false
+			req, _ := http.NewRequest("POST", "/echo", strings.NewReader(tt.body))
+			if tt.chunked {
+				req.ContentLength = -1
+				req.TransferEncoding = []string{"chunked"}
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			require.Equal(t, tt.status, w.Code)
+			if tt.status == http.StatusOK {
+				assert.True(t, ran)
+				assert.Equal(t, tt.body, w.Body.String(), "the handler reads the whole body")
+				return
+			}
+			assert.False(t, ran, "the handler never runs")
+			var resp models.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, models.ErrorCodeRequestTooLarge, resp.Code)
+		})
+	}
+}
+
+// limitRouter serves the full API with MAX_MESSAGE_BYTES set to 1 KB and
+// returns a caller, the in-memory stores and a signed-in admin
+func limitRouter(t *testing.T) (call func(method, path, contentType string, body []byte) *httptest.ResponseRecorder, deps api.Dependencies, admin *models.User) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	deps = testDependencies()
+	deps.Config.Message.MaxMessageBytes = 1 << 10
+	admin = &models.User{Email: "admin@example.com", Name: "Admin", IsAdmin: true}
+	require.NoError(t, deps.UserStore.Create(context.Background(), admin))
+	token, err := deps.JWTManager.Generate(admin.ID, admin.Email)
+	require.NoError(t, err)
+
+	router, err := api.SetupRouter(deps)
+	require.NoError(t, err)
+	call = func(method, path, contentType string, body []byte) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	return call, deps, admin
+}
+
+// messageJSON is a create message request whose ciphertext is n bytes as sent
+func messageJSON(n int, recipientID int64) string {
+	ciphertext := base64.StdEncoding.EncodeToString(make([]byte, n/4*3))
+	return fmt.Sprintf(`{"ciphertext":%q,"iv":"AAAAAAAAAAAAAAAA","recipient_id":%d,"encryption_key":"key"}`, ciphertext, recipientID)
+}
+
+// bulkJSON is a bulk create request of count messages like messageJSON
+func bulkJSON(count, n int, recipientID int64) []byte {
+	items := make([]string, count)
+	for i := range items {
+		items[i] = messageJSON(n, recipientID)
+	}
+	return []byte(`{"messages":[` + strings.Join(items, ",") + `]}`)
+}
+
+// csvUpload is a user import with one row whose name is size bytes long
+func csvUpload(t *testing.T, size int) (string, []byte) {
+	t.Helper()
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "users.csv")
+	require.NoError(t, err)
+	_, _ = part.Write([]byte("email,name,password\nbig@corp.com," + strings.Repeat("a", size) + ",password123\n"))
+	require.NoError(t, form.Close())
+	return form.FormDataContentType(), body.Bytes()
+}
+
+func TestBodyLimits_PerRouteGroup(t *testing.T) {
+	call, deps, admin := limitRouter(t)
+	ctx := context.Background()
+	padding := strings.Repeat("a", api.AuthBodyLimit)
+	csvType, csvBody := csvUpload(t, api.CSVImportBodyLimit)
+	messageLimit := api.MessageBodyLimit(1 << 10)
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        []byte
+	}{
+		{"register", "/api/v1/auth/register", "application/json",
+			[]byte(`{"email":"big@corp.com","name":"` + padding + `","password":"password123"}`)},
+		{"login on the legacy prefix", "/api/auth/login", "application/json",
+			[]byte(`{"email":"admin@example.com","password":"` + padding + `"}`)},
+		{"message", "/api/v1/messages", "application/json",
+			[]byte(messageJSON(int(messageLimit), admin.ID))},
+		{"bulk", "/api/v1/messages/bulk", "application/json",
+			bulkJSON(models.MaxBulkMessages, int(messageLimit), admin.ID)},
+		{"user import", "/api/v1/admin/users/import", csvType, csvBody},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := call("POST", tt.path, tt.contentType, tt.body)
+			require.Equal(t, http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+			var resp models.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, models.ErrorCodeRequestTooLarge, resp.Code)
+		})
+	}
+
+	// None of the handlers ran: no account was created and no message stored
+	_, err := deps.UserStore.FindByEmail(ctx, "big@corp.com")
+	assert.Error(t, err)
+	sent, err := deps.MetadataStore.(*fakes.MetadataStore).ListUserMessages(ctx, admin.ID, 0, 100)
+	require.NoError(t, err)
+	assert.Empty(t, sent)
+}
+
+func TestBodyLimits_OutsideMessageAndAuthGroups(t *testing.T) {
+	call, _, _ := limitRouter(t)
+	body := []byte(`{"name":"` + strings.Repeat("a", api.DefaultBodyLimit) + `"}`)
+
+	for _, path := range []string{"/api/v1/profile", "/api/v1/admin/users/1", "/api/admin/category-policies/credentials"} {
+		w := call("PUT", path, "application/json", body)
+		require.Equal(t, http.StatusRequestEntityTooLarge, w.Code, "%s: %s", path, w.Body.String())
+		var resp models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, models.ErrorCodeRequestTooLarge, resp.Code)
+	}
+}
+
+// TestBodyLimits_EveryRoute sends a body larger than any limit to each route
+// that takes one; every route must reject it before its handler runs
+func TestBodyLimits_EveryRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	deps := testDependencies()
+	deps.Config.Message.MaxMessageBytes = 1 << 10 // keeps the bulk limit below the import limit
+	deps.Config.SCIM = config.SCIMConfig{Enabled: true, Token: "test-scim-token-0123456789abcdefghij"}
+	admin := &models.User{Email: "admin@example.com", Name: "Admin", IsAdmin: true}
+	require.NoError(t, deps.UserStore.Create(context.Background(), admin))
+	token, err := deps.JWTManager.Generate(admin.ID, admin.Email)
+	require.NoError(t, err)
+	router, err := api.SetupRouter(deps)
+	require.NoError(t, err)
+
+	body := make([]byte, api.CSVImportBodyLimit+1)
+	var checked int
+	for _, route := range router.Routes() {
+		if route.Method != "POST" && route.Method != "PUT" && route.Method != "PATCH" {
+			continue
+		}
+		path := route.Path
+		for _, param := range []string{":id", ":duplicateId", ":keyId", ":email", ":category", ":domain", ":name"} {
+			path = strings.ReplaceAll(path, param, "1")
+		}
+		req, _ := http.NewRequest(route.Method, path, bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if strings.HasPrefix(path, "/scim/") {
+			req.Header.Set("Authorization", "Bearer "+deps.Config.SCIM.Token)
+		} else {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code, "%s %s: %s", route.Method, route.Path, w.Body.String())
+		checked++
+	}
+	assert.Greater(t, checked, 50)
+}
+
+func TestBodyLimits_AllowLargestAcceptedBodies(t *testing.T) {
+	call, _, admin := limitRouter(t)
+
+	w := call("POST", "/api/v1/messages", "application/json", []byte(messageJSON(1<<10, admin.ID)))
+	assert.NotEqual(t, http.StatusRequestEntityTooLarge, w.Code, w.Body.String())
+
+	// A batch may be larger than one message
+	batch := bulkJSON(20, 1<<10, admin.ID)
+	require.Greater(t, int64(len(batch)), api.MessageBodyLimit(1<<10))
+	w = call("POST", "/api/v1/messages/bulk", "application/json", batch)
+	assert.Equal(t, http.StatusMultiStatus, w.Code, w.Body.String())
+
+	csvType, csvBody := csvUpload(t, 1<<20)
+	w = call("POST", "/api/v1/admin/users/import", csvType, csvBody)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestLoad_MaxMessageBytes(t *testing.T) {
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	assert.EqualValues(t, config.DefaultMaxMessageBytes, cfg.Message.MaxMessageBytes)
+
+	t.Setenv("MAX_MESSAGE_BYTES", "0")
+	_, err = config.Load()
+	assert.ErrorContains(t, err, "MAX_MESSAGE_BYTES")
+}
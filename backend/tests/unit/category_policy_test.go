@@ -0,0 +1,349 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/integrations/slack"
+	"github.com/milkiss/vanish/backend/internal/messages"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/urlbuilder"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// credentialsPolicy is the policy new databases give the credentials category
+var credentialsPolicy = models.CategoryPolicy{Category: "credentials", DefaultTTL: 3600, MaxTTL: 86400, NotificationStyle: models.NotificationUrgent}
+
+func TestValidCategory(t *testing.T) {
+	for _, name := range []string{"credentials", "hr-documents", "q3"} {
+		assert.True(t, models.ValidCategory(name), name)
+	}
+	for _, name := range []string{"", "Credentials", "3d", "-x", "a b", strings.Repeat("a", models.MaxCategoryLength+1)} {
+		assert.False(t, models.ValidCategory(name), name)
+	}
+}
+
+func TestCategoryPolicyRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     models.CategoryPolicyRequest
+		invalid []string
+	}{
+		{"valid", models.CategoryPolicyRequest{DefaultTTL: 3600, MaxTTL: 86400, NotificationStyle: models.NotificationUrgent}, nil},
+		{"max above global", models.CategoryPolicyRequest{DefaultTTL: 3600, MaxTTL: models.MaxTTL + 1, NotificationStyle: models.NotificationDigest}, []string{"max_ttl"}},
+		{"default above max", models.CategoryPolicyRequest{DefaultTTL: 7200, MaxTTL: 3600, NotificationStyle: models.NotificationStandard}, []string{"default_ttl"}},
+		{"unknown style", models.CategoryPolicyRequest{DefaultTTL: 3600, MaxTTL: 3600, NotificationStyle: "loud"}, []string{"notification_style"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := tt.req.Validate()
+			var fields []string
+			for field := range problems {
+				fields = append(fields, field)
+			}
+			assert.ElementsMatch(t, tt.invalid, fields)
+		})
+	}
+}
+
+// categoryService returns a message service to user 2 (recipient@example.com)
+// with the credentials policy and the given TTL policy rules
+func categoryService(t *testing.T, rules ...models.TTLPolicyRule) *messages.Service {
+	t.Helper()
+	users := seedUsers(t)
+	policies := fakes.NewTTLPolicyStore()
+	policy := credentialsPolicy
+	_, err := policies.PutCategoryPolicy(context.Background(), &policy)
+	require.NoError(t, err)
+	for i := range rules {
+		require.NoError(t, policies.CreateTTLPolicy(context.Background(), &rules[i], nil))
+	}
+	return messages.NewService(fakes.NewStorage(), fakes.NewMetadataStore(users), 0, users, policies)
+}
+
+func TestMessageService_CategoryPolicy(t *testing.T) {
+	ttl := func(seconds int64) *int64 { return &seconds }
+	strict := models.TTLPolicyRule{RecipientDomainGlob: "example.com", DefaultTTL: 3600, MaxTTL: 7200}
+	lenient := models.TTLPolicyRule{RecipientDomainGlob: "example.com", DefaultTTL: 86400, MaxTTL: 604800}
+	tests := []struct {
+		name        string
+		category    string
+		rules       []models.TTLPolicyRule
+		ttl         *int64
+		wantTTL     time.Duration
+		wantLimited bool
+		wantPolicy  bool
+	}{
+		{"default from category", "credentials", nil, nil, time.Hour, false, true},
+		{"category default beats domain default", "credentials", []models.TTLPolicyRule{lenient}, nil, time.Hour, false, true},
+		{"cut to category max", "credentials", []models.TTLPolicyRule{lenient}, ttl(604800), 24 * time.Hour, true, true},
+		{"shorter domain max wins", "credentials", []models.TTLPolicyRule{strict}, ttl(86400), 2 * time.Hour, true, true},
+		{"category without policy", "misc", nil, ttl(604800), 7 * 24 * time.Hour, false, false},
+		{"no category", "", nil, nil, time.Duration(models.DefaultTTL) * time.Second, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := categoryService(t, tt.rules...)
+
+			metadata, err := service.CreateEncrypted(context.Background(), 1, 2, servicePayload, tt.ttl, messages.CreateOptions{Category: tt.category})
+			require.NoError(t, err)
+			assert.WithinDuration(t, time.Now().Add(tt.wantTTL), metadata.ExpiresAt, 5*time.Second)
+			assert.Equal(t, tt.wantLimited, metadata.TTLLimitedByPolicy)
+			assert.Equal(t, tt.category, metadata.Category)
+			if !tt.wantPolicy {
+				assert.Nil(t, metadata.CategoryPolicy)
+				return
+			}
+			require.NotNil(t, metadata.CategoryPolicy)
+			assert.Equal(t, models.NotificationUrgent, metadata.CategoryPolicy.NotificationStyle)
+		})
+	}
+}
+
+func TestCategoryPolicies_CRUD(t *testing.T) {
+	do := ttlPolicyRouter(t)
+	urgent := models.CategoryPolicyRequest{DefaultTTL: 3600, MaxTTL: 86400, NotificationStyle: models.NotificationUrgent}
+
+	w := do("PUT", "/api/v1/admin/category-policies/credentials", urgent)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	urgent.MaxTTL = 7200
+	w = do("PUT", "/api/v1/admin/category-policies/credentials", urgent)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = do("GET", "/api/v1/admin/category-policies/credentials", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var policy models.CategoryPolicy
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &policy))
+	assert.Equal(t, int64(7200), policy.MaxTTL)
+	assert.Equal(t, models.NotificationUrgent, policy.NotificationStyle)
+
+	w = do("PUT", "/api/v1/admin/category-policies/documents", models.CategoryPolicyRequest{DefaultTTL: 86400, MaxTTL: 604800, NotificationStyle: models.NotificationDigest})
+	require.Equal(t, http.StatusCreated, w.Code)
+	w = do("GET", "/api/v1/admin/settings", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var settings api.AdminSettingsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &settings))
+	require.Len(t, settings.CategoryPolicies, 2)
+	assert.Equal(t, "credentials", settings.CategoryPolicies[0].Category)
+
+	// Invalid names and policies
+	w = do("PUT", "/api/v1/admin/category-policies/Credentials", urgent)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = do("PUT", "/api/v1/admin/category-policies/credentials", models.CategoryPolicyRequest{DefaultTTL: 3600, MaxTTL: 3600, NotificationStyle: "loud"})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "notification_style")
+
+	w = do("DELETE", "/api/v1/admin/category-policies/documents", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	for _, missing := range []*httptest.ResponseRecorder{
+		do("DELETE", "/api/v1/admin/category-policies/documents", nil),
+		do("GET", "/api/v1/admin/category-policies/documents", nil),
+	} {
+		require.Equal(t, http.StatusNotFound, missing.Code)
+		var errResp models.ErrorResponse
+		require.NoError(t, json.Unmarshal(missing.Body.Bytes(), &errResp))
+		assert.Equal(t, models.ErrorCodeCategoryPolicyNotFound, errResp.Code)
+	}
+}
+
+func TestCreateMessage_ReportsCategoryPolicy(t *testing.T) {
+	do := ttlPolicyRouter(t)
+	w := do("PUT", "/api/v1/admin/category-policies/credentials", models.CategoryPolicyRequest{DefaultTTL: 3600, MaxTTL: 86400, NotificationStyle: models.NotificationUrgent})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	ttl := int64(604800)
+	item := bulkItem(2)
+	item.TTL = &ttl
+	item.Category = "credentials"
+	w = do("POST", "/api/v1/messages", item)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var resp models.CreateMessageResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.TTLLimitedByPolicy)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), resp.ExpiresAt, 5*time.Second)
+	assert.Equal(t, "credentials", resp.Category)
+	assert.Equal(t, &models.AppliedCategoryPolicy{Category: "credentials", DefaultTTL: 3600, MaxTTL: 86400, NotificationStyle: models.NotificationUrgent}, resp.CategoryPolicy)
+
+	item.Category = "Not A Category"
+	w = do("POST", "/api/v1/messages", item)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"category"`)
+}
+
+func TestSendSlackNotification_WordedByCategory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	slackAPI, dms := recordingSlackAPI(t)
+	users := seedUsers(t)
+	metadataStore := fakes.NewMetadataStore(users)
+	policies := fakes.NewTTLPolicyStore()
+	policy := credentialsPolicy
+	_, err := policies.PutCategoryPolicy(context.Background(), &policy)
+	require.NoError(t, err)
+	for id, category := range map[string]string{"urgentmsg": "credentials", "plainmsg": ""} {
+		require.NoError(t, metadataStore.Create(context.Background(), &models.MessageMetadata{
+			MessageID: id, SenderID: 1, RecipientID: 2, Status: models.StatusPending, Category: category,
+			CreatedAt: time.Now().UTC(), ExpiresAt: time.Now().UTC().Add(time.Hour),
+		}))
+	}
+
+	slackClient := slack.NewClient(&slack.Config{BotToken: "xoxb-test", APIURL: slackAPI.URL})
+	handler := api.NewNotificationHandler(users, metadataStore, api.NewIntegrations(api.IntegrationClients{Slack: slackClient}), nil, nil, nil, policies)
+	router := gin.New()
+	router.Use(authAs(1))
+	router.POST("/notifications/send-slack", handler.SendSlackNotification)
+
+	w := postNotification(router, "/notifications/send-slack", api.SendNotificationRequest{RecipientID: 2, MessageURL: "http://localhost:5173/m/urgentmsg#key"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, <-dms, "Urgent")
+
+	w = postNotification(router, "/notifications/send-slack", api.SendNotificationRequest{RecipientID: 2, MessageURL: "http://localhost:5173/m/plainmsg#key"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotContains(t, <-dms, "Urgent")
+}
+
+// categoryModalRouter serves the Slack interaction endpoint over a service
+// with the credentials policy. Slack API calls are recorded by path
+func categoryModalRouter(t *testing.T) (*gin.Engine, *fakes.MetadataStore, chan string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	calls := make(chan string, 10)
+	slackAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		calls <- r.URL.Path + " " + string(body)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ok":true,"user":{"id":"U1","profile":{"email":"sender@example.com"}},"channel":{"id":"D1"}}`)
+	}))
+	t.Cleanup(slackAPI.Close)
+
+	users := seedUsers(t)
+	metadata := fakes.NewMetadataStore(users)
+	policies := fakes.NewTTLPolicyStore()
+	policy := credentialsPolicy
+	_, err := policies.PutCategoryPolicy(context.Background(), &policy)
+	require.NoError(t, err)
+	links, err := urlbuilder.New("http://localhost:5173")
+	require.NoError(t, err)
+
+	client := slack.NewClient(&slack.Config{BotToken: "xoxb-test", APIURL: slackAPI.URL})
+	service := messages.NewService(fakes.NewStorage(), metadata, 0, users, policies)
+	handler := api.NewSlackHandler(api.NewIntegrations(api.IntegrationClients{Slack: client}), nil, service, users, links, true, nil)
+
+	router := gin.New()
+	router.POST("/slack/interactions", handler.HandleInteraction)
+	return router, metadata, calls
+}
+
+func postInteraction(router *gin.Engine, payload api.InteractionPayload) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+	form := url.Values{"payload": {string(body)}}
+	req, _ := http.NewRequest("POST", "/slack/interactions", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSlackModal_CategoryNarrowsTTLOptions(t *testing.T) {
+	router, _, calls := categoryModalRouter(t)
+
+	w := postInteraction(router, api.InteractionPayload{
+		Type: "block_actions",
+		User: api.InteractionUser{ID: "U1"},
+		View: &api.InteractionView{ID: "V1", Hash: "h1"},
+		Actions: []api.InteractionAction{{
+			ActionID:       "category_input",
+			BlockID:        "category_block",
+			SelectedOption: &api.InteractionOption{Value: "credentials"},
+		}},
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	call := <-calls
+	path, body, _ := strings.Cut(call, " ")
+	assert.Equal(t, "/views.update", path)
+	var update struct {
+		ViewID string `json:"view_id"`
+		Hash   string `json:"hash"`
+		View   struct {
+			Blocks []struct {
+				BlockID string `json:"block_id"`
+				Element struct {
+					InitialOption struct {
+						Value string `json:"value"`
+					} `json:"initial_option"`
+					Options []struct {
+						Value string `json:"value"`
+					} `json:"options"`
+				} `json:"element"`
+			} `json:"blocks"`
+		} `json:"view"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &update))
+	assert.Equal(t, "V1", update.ViewID)
+	assert.Equal(t, "h1", update.Hash)
+
+	blocks := map[string][]string{}
+	initial := map[string]string{}
+	for _, block := range update.View.Blocks {
+		for _, option := range block.Element.Options {
+			blocks[block.BlockID] = append(blocks[block.BlockID], option.Value)
+		}
+		initial[block.BlockID] = block.Element.InitialOption.Value
+	}
+	assert.Equal(t, []string{"none", "credentials"}, blocks["category_block"])
+	assert.Equal(t, "credentials", initial["category_block"])
+	assert.Equal(t, []string{"3600", "86400"}, blocks["ttl_block_credentials"], "only TTLs up to the category maximum")
+	assert.Equal(t, "3600", initial["ttl_block_credentials"], "starts at the category default")
+}
+
+func TestSlackModal_SubmitsCategory(t *testing.T) {
+	router, metadata, calls := categoryModalRouter(t)
+	values := func(ttl string) map[string]map[string]api.InteractionValue {
+		v := modalValues("recipient@example.com", "hunter2")
+		v["category_block"] = map[string]api.InteractionValue{"category_input": {
+			Type: "static_select", SelectedOption: &api.InteractionOption{Value: "credentials"},
+		}}
+		v["ttl_block_credentials"] = map[string]api.InteractionValue{"ttl_input": {
+			Type: "static_select", SelectedOption: &api.InteractionOption{Value: ttl},
+		}}
+		return v
+	}
+
+	// A TTL the category does not allow is refused on its field
+	w := submitModal(router, values("604800"))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, fieldErrors(t, w)["ttl_block_credentials"], "at most 24 hours")
+	sent, err := metadata.ListUserMessages(context.Background(), 1, 0, 10)
+	require.NoError(t, err)
+	assert.Empty(t, sent)
+
+	w = submitModal(router, values("3600"))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String(), "successful submission closes the modal")
+	sent, err = metadata.ListUserMessages(context.Background(), 1, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, sent, 1)
+	assert.Equal(t, "credentials", sent[0].Category)
+
+	var dm string
+	for call := range calls {
+		if strings.HasPrefix(call, "/chat.postMessage") {
+			dm = call
+			break
+		}
+	}
+	assert.Contains(t, dm, "Urgent")
+}
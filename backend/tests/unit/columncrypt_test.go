@@ -0,0 +1,133 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/milkiss/vanish/backend/internal/columncrypt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func masterKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, columncrypt.KeySize)
+}
+
+func TestColumnCrypt_RotationBetweenMasterKeys(t *testing.T) {
+	v1, err := columncrypt.New(map[string][]byte{"v1": masterKey(1)}, "v1")
+	require.NoError(t, err)
+
+	sealed, err := v1.Encrypt("link-key")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sealed, "enc:v1:"))
+	assert.NotContains(t, sealed, "link-key")
+
+	// Rotating in v2 keeps v1 around so existing rows still decrypt
+	both, err := columncrypt.New(map[string][]byte{"v1": masterKey(1), "v2": masterKey(2)}, "v2")
+	require.NoError(t, err)
+
+	plain, err := both.Decrypt(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "link-key", plain)
+
+	rotated, changed, err := both.Rotate(sealed)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.True(t, strings.HasPrefix(rotated, "enc:v2:"))
+
+	_, changed, err = both.Rotate(rotated)
+	require.NoError(t, err)
+	assert.False(t, changed, "values under the current key are left alone")
+
+	// Once everything is re-encrypted v1 can be retired
+	v2, err := columncrypt.New(map[string][]byte{"v2": masterKey(2)}, "v2")
+	require.NoError(t, err)
+	plain, err = v2.Decrypt(rotated)
+	require.NoError(t, err)
+	assert.Equal(t, "link-key", plain)
+
+	_, err = v2.Decrypt(sealed)
+	assert.ErrorIs(t, err, columncrypt.ErrUnknownKeyVersion)
+}
+
+func TestColumnCrypt_PlaintextRowsStillRead(t *testing.T) {
+	keyring, err := columncrypt.New(map[string][]byte{"v1": masterKey(1)}, "v1")
+	require.NoError(t, err)
+
+	plain, err := keyring.Decrypt("legacy-plaintext-key")
+	require.NoError(t, err)
+	assert.Equal(t, "legacy-plaintext-key", plain)
+
+	sealed, changed, err := keyring.Rotate("legacy-plaintext-key")
+	require.NoError(t, err)
+	assert.True(t, changed)
+	plain, err = keyring.Decrypt(sealed)
+	require.NoError(t, err)
+	assert.Equal(t, "legacy-plaintext-key", plain)
+}
+
+func TestColumnCrypt_DisabledKeyring(t *testing.T) {
+	var keyring *columncrypt.Keyring
+
+	stored, err := keyring.Encrypt("link-key")
+	require.NoError(t, err)
+	assert.Equal(t, "link-key", stored)
+
+	// Encrypted rows cannot be read once the keys are removed
+	enabled, err := columncrypt.New(map[string][]byte{"v1": masterKey(1)}, "v1")
+	require.NoError(t, err)
+	sealed, err := enabled.Encrypt("link-key")
+	require.NoError(t, err)
+	_, err = keyring.Decrypt(sealed)
+	assert.ErrorIs(t, err, columncrypt.ErrUnknownKeyVersion)
+}
+
+func TestColumnCrypt_RejectsTamperingAndRelabelling(t *testing.T) {
+	keyring, err := columncrypt.New(map[string][]byte{"v1": masterKey(1), "v2": masterKey(1)}, "v1")
+	require.NoError(t, err)
+	sealed, err := keyring.Encrypt("link-key")
+	require.NoError(t, err)
+
+	// The version is authenticated, even when two versions share a key
+	_, err = keyring.Decrypt(strings.Replace(sealed, "enc:v1:", "enc:v2:", 1))
+	assert.Error(t, err)
+
+	tampered := sealed[:len(sealed)-2] + "AA"
+	if tampered == sealed {
+		tampered = sealed[:len(sealed)-2] + "BB"
+	}
+	_, err = keyring.Decrypt(tampered)
+	assert.Error(t, err)
+}
+
+func TestColumnCrypt_Parse(t *testing.T) {
+	k1 := base64.StdEncoding.EncodeToString(masterKey(1))
+	k2 := base64.RawURLEncoding.EncodeToString(masterKey(2))
+
+	keyring, err := columncrypt.Parse("v1:"+k1+", v2:"+k2, "")
+	require.NoError(t, err)
+	assert.Equal(t, "v2", keyring.CurrentVersion(), "defaults to the last key")
+
+	keyring, err = columncrypt.Parse("v1:"+k1+",v2:"+k2, "v1")
+	require.NoError(t, err)
+	assert.Equal(t, "v1", keyring.CurrentVersion())
+
+	keyring, err = columncrypt.Parse("", "")
+	require.NoError(t, err)
+	assert.Nil(t, keyring)
+
+	for _, bad := range []struct{ spec, current string }{
+		{"v1", ""},
+		{"v1:" + k1 + ",v1:" + k2, ""},
+		{"v1:" + base64.StdEncoding.EncodeToString([]byte("short")), ""},
+		{"v1:not base64!", ""},
+		{"v:1:" + k1, ""},
+		{"v1:" + k1, "v3"},
+		{"", "v1"},
+	} {
+		_, err := columncrypt.Parse(bad.spec, bad.current)
+		assert.Error(t, err, bad.spec)
+	}
+}
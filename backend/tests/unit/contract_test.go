@@ -0,0 +1,130 @@
+package unit
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sharedmodels "github.com/zafrem/vanish/shared/models"
+)
+
+// jsonFields maps the JSON name of each field of struct t to its shape:
+// the JSON type, "*" for pointers and ",omitempty" when empty values are
+// left out. Named types reduce to their kind, so models.NotificationStyle
+// and string agree
+func jsonFields(t reflect.Type) map[string]string {
+	fields := map[string]string{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" {
+			for name, shape := range jsonFields(f.Type) {
+				fields[name] = shape
+			}
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		shape := jsonShape(f.Type)
+		if strings.Contains(opts, "omitempty") {
+			shape += ",omitempty"
+		}
+		fields[name] = shape
+	}
+	return fields
+}
+
+func jsonShape(t reflect.Type) string {
+	switch {
+	case t == reflect.TypeOf(time.Time{}):
+		return "time"
+	case t.Kind() == reflect.Pointer:
+		return "*" + jsonShape(t.Elem())
+	case t.Kind() == reflect.Slice:
+		return "[]" + jsonShape(t.Elem())
+	case t.Kind() == reflect.Map:
+		return "map[" + jsonShape(t.Key()) + "]" + jsonShape(t.Elem())
+	case t.Kind() == reflect.Struct:
+		return "object"
+	default:
+		return t.Kind().String()
+	}
+}
+
+func TestSharedModels_MatchBackendContract(t *testing.T) {
+	pairs := []struct {
+		backend, shared any
+	}{
+		{models.CreateMessageRequest{}, sharedmodels.CreateMessageRequest{}},
+		{models.CreateMessageResponse{}, sharedmodels.CreateMessageResponse{}},
+		{models.AppliedCategoryPolicy{}, sharedmodels.AppliedCategoryPolicy{}},
+		{models.BulkCreateMessageRequest{}, sharedmodels.BulkCreateMessageRequest{}},
+		{models.BulkMessageResult{}, sharedmodels.BulkMessageResult{}},
+		{models.BulkCreateMessageResponse{}, sharedmodels.BulkCreateMessageResponse{}},
+		{models.MessageStatusResponse{}, sharedmodels.MessageStatusResponse{}},
+	}
+	for _, p := range pairs {
+		backend, shared := reflect.TypeOf(p.backend), reflect.TypeOf(p.shared)
+		t.Run(backend.Name(), func(t *testing.T) {
+			assert.Equal(t, jsonFields(backend), jsonFields(shared))
+		})
+	}
+}
+
+func TestSharedCreateMessageRequest_DecodesOnBackend(t *testing.T) {
+	availableAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	ttl := int64(3600)
+	tests := []struct {
+		name string
+		ttl  *int64
+	}{
+		{"ttl omitted", nil},
+		{"ttl set", &ttl},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sent := sharedmodels.CreateMessageRequest{
+				Ciphertext: "Y2lwaGVy", IV: "aXY=", TTL: tt.ttl, RecipientID: 2,
+				EncryptionKey: "key", ContentEncoding: "gzip", AvailableAt: &availableAt, Category: "credentials",
+			}
+			body, err := json.Marshal(sent)
+			require.NoError(t, err)
+
+			var received models.CreateMessageRequest
+			require.NoError(t, json.Unmarshal(body, &received))
+			// A nil TTL must arrive as nil, never as 0, or the server rejects it
+			// instead of applying its default
+			assert.Equal(t, tt.ttl, received.TTL)
+			assert.Equal(t, models.CreateMessageRequest{
+				Ciphertext: "Y2lwaGVy", IV: "aXY=", TTL: tt.ttl, RecipientID: 2,
+				EncryptionKey: "key", ContentEncoding: "gzip", AvailableAt: &availableAt, Category: "credentials",
+			}, received)
+		})
+	}
+}
+
+func TestBackendCreateMessageResponse_DecodesInShared(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	body, err := json.Marshal(models.CreateMessageResponse{
+		ID: "abc123", ExpiresAt: expiresAt, TTLLimitedByPolicy: true, Category: "credentials",
+		CategoryPolicy: &models.AppliedCategoryPolicy{Category: "credentials", DefaultTTL: 3600, MaxTTL: 86400, NotificationStyle: models.NotificationUrgent},
+	})
+	require.NoError(t, err)
+
+	var received sharedmodels.CreateMessageResponse
+	require.NoError(t, json.Unmarshal(body, &received))
+	assert.Equal(t, sharedmodels.CreateMessageResponse{
+		ID: "abc123", ExpiresAt: expiresAt, TTLLimitedByPolicy: true, Category: "credentials",
+		CategoryPolicy: &sharedmodels.AppliedCategoryPolicy{Category: "credentials", DefaultTTL: 3600, MaxTTL: 86400, NotificationStyle: "urgent"},
+	}, received)
+}
@@ -0,0 +1,60 @@
+package unit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/cron"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCronParse_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"@yearly",
+		"0 0 30 2 *", // February 30th never comes
+	} {
+		_, err := cron.Parse(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestCronSchedule_NextAndPrev(t *testing.T) {
+	// Wednesday 2026-03-11 10:30 local time
+	now := time.Date(2026, 3, 11, 10, 30, 0, 0, time.Local)
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2026, 3, day, hour, minute, 0, 0, time.Local)
+	}
+	tests := []struct {
+		expr       string
+		next, prev time.Time
+	}{
+		{"0 9 * * 1", at(16, 9, 0), at(9, 9, 0)},
+		{"*/15 8-18 * * 1-5", at(11, 10, 45), at(11, 10, 30)},
+		{"0 0 * * 0", at(15, 0, 0), at(8, 0, 0)},
+		{"0 0 * * 7", at(15, 0, 0), at(8, 0, 0)},
+		{"0 12 1,15 * 3", at(11, 12, 0), at(4, 12, 0)}, // 1st, 15th or any Wednesday
+		{"@daily", at(12, 0, 0), at(11, 0, 0)},
+		{"@hourly", at(11, 11, 0), at(11, 10, 0)},
+		{"@monthly", time.Date(2026, 4, 1, 0, 0, 0, 0, time.Local), at(1, 0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			s, err := cron.Parse(tt.expr)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expr, s.String())
+			assert.Equal(t, tt.next, s.Next(now), "next")
+			assert.Equal(t, tt.prev, s.Prev(now), "prev")
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/auth"
+	"github.com/milkiss/vanish/backend/internal/database"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// defaultAdmin creates the default admin in a fresh store
+func defaultAdmin(t *testing.T) (*fakes.UserStore, *models.User) {
+	t.Helper()
+	users := fakes.NewUserStore()
+	created, err := database.CreateDefaultAdmin(nil, users)
+	require.NoError(t, err)
+	require.True(t, created)
+	admin, err := users.FindByEmail(context.Background(), database.DefaultAdminEmail)
+	require.NoError(t, err)
+	return users, admin
+}
+
+func TestResetDefaultAdminPassword(t *testing.T) {
+	ctx := context.Background()
+	_, err := database.ResetDefaultAdminPassword(ctx, fakes.NewUserStore())
+	assert.ErrorIs(t, err, database.ErrNoDefaultAdmin)
+
+	users, admin := defaultAdmin(t)
+	password, err := database.ResetDefaultAdminPassword(ctx, users)
+	require.NoError(t, err)
+	assert.Len(t, password, 16)
+
+	reset, err := users.FindByID(ctx, admin.ID)
+	require.NoError(t, err)
+	assert.NotEqual(t, admin.Password, reset.Password)
+	assert.True(t, reset.CheckPassword(password))
+
+	again, err := database.ResetDefaultAdminPassword(ctx, users)
+	require.NoError(t, err)
+	assert.NotEqual(t, password, again)
+	reset, err = users.FindByID(ctx, admin.ID)
+	require.NoError(t, err)
+	assert.False(t, reset.CheckPassword(password), "the previous password stops working")
+}
+
+func TestDisableDefaultAdmin_RefusesOnlyAdmin(t *testing.T) {
+	ctx := context.Background()
+	users, admin := defaultAdmin(t)
+	// Neither a regular user nor a deactivated admin can take over
+	require.NoError(t, users.Create(ctx, &models.User{Email: "bob@corp.com", Name: "Bob"}))
+	former := &models.User{Email: "former@corp.com", Name: "Former", IsAdmin: true}
+	require.NoError(t, users.Create(ctx, former))
+	former.IsActive = false
+	require.NoError(t, users.Update(ctx, former))
+
+	disabled, err := database.DisableDefaultAdmin(ctx, users)
+	assert.ErrorIs(t, err, database.ErrOnlyAdmin)
+	assert.False(t, disabled)
+	stored, err := users.FindByID(ctx, admin.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.IsActive)
+
+	require.NoError(t, users.Create(ctx, &models.User{Email: "carol@corp.com", Name: "Carol", IsAdmin: true}))
+	disabled, err = database.DisableDefaultAdmin(ctx, users)
+	require.NoError(t, err)
+	assert.True(t, disabled)
+	stored, err = users.FindByID(ctx, admin.ID)
+	require.NoError(t, err)
+	assert.False(t, stored.IsActive)
+
+	// Later startups leave it as it is
+	disabled, err = database.DisableDefaultAdmin(ctx, users)
+	require.NoError(t, err)
+	assert.False(t, disabled)
+}
+
+func TestDefaultAdminStale(t *testing.T) {
+	ctx := context.Background()
+	users, admin := defaultAdmin(t)
+	now := time.Now()
+
+	stale, err := database.DefaultAdminStale(ctx, users, now)
+	require.NoError(t, err)
+	assert.False(t, stale, "a new account is not stale")
+	stale, err = database.DefaultAdminStale(ctx, users, now.Add(31*24*time.Hour))
+	require.NoError(t, err)
+	assert.True(t, stale, "never signed in since creation")
+
+	// Signing in counts from then
+	gin.SetMode(gin.TestMode)
+	password, err := database.ResetDefaultAdminPassword(ctx, users)
+	require.NoError(t, err)
+	handler := api.NewAuthHandler(users, auth.NewJWTManager("test-secret-key", time.Hour), nil, nil, nil)
+	router := gin.New()
+	router.POST("/login", handler.Login)
+	req, _ := http.NewRequest("POST", "/login",
+		strings.NewReader(`{"email":"`+database.DefaultAdminEmail+`","password":"`+password+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// The sign-in is recorded in the background
+	var stored *models.User
+	require.Eventually(t, func() bool {
+		stored, err = users.FindByID(ctx, admin.ID)
+		return err == nil && stored.LastLogin != nil
+	}, time.Second, 5*time.Millisecond)
+	later := stored.LastLogin.Add(29 * 24 * time.Hour)
+	stale, err = database.DefaultAdminStale(ctx, users, later)
+	require.NoError(t, err)
+	assert.False(t, stale)
+	stale, err = database.DefaultAdminStale(ctx, users, later.Add(2*24*time.Hour))
+	require.NoError(t, err)
+	assert.True(t, stale)
+
+	// A deactivated account is never stale
+	stored.IsActive = false
+	require.NoError(t, users.Update(ctx, stored))
+	stale, err = database.DefaultAdminStale(ctx, users, later.Add(365*24*time.Hour))
+	require.NoError(t, err)
+	assert.False(t, stale)
+}
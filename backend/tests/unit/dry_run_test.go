@@ -0,0 +1,184 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/storage"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dryRunRouter serves the create endpoints as user 1 (sender@example.com)
+// with user 2 (recipient@example.com) as the only recipient, capped at
+// maxPending unread messages
+func dryRunRouter(t *testing.T, maxPending int) (*gin.Engine, *fakes.Storage, *fakes.MetadataStore) {
+	gin.SetMode(gin.TestMode)
+	users := seedUsers(t)
+	store := fakes.NewStorage()
+	metadataStore := fakes.NewMetadataStore(users)
+	handler := api.NewMessageHandler(store, metadataStore, maxPending, nil, nil, users, nil)
+
+	router := gin.New()
+	router.Use(authAs(1))
+	router.POST("/messages", handler.CreateMessage)
+	router.POST("/messages/bulk", handler.BulkCreateMessages)
+	return router, store, metadataStore
+}
+
+func postMessage(router *gin.Engine, path string, item models.CreateMessageRequest, header http.Header) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(item)
+	req, _ := http.NewRequest("POST", path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// assertNothingStored checks that neither the payload nor metadata was written
+func assertNothingStored(t *testing.T, store *fakes.Storage, metadataStore *fakes.MetadataStore) {
+	t.Helper()
+	assert.Zero(t, store.Len(), "payload stored")
+	history, err := metadataStore.GetUserHistory(context.Background(), 1, "", models.Page{Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, history, "metadata stored")
+}
+
+func TestCreateMessage_DryRun(t *testing.T) {
+	for name, send := range map[string]func(*gin.Engine) *httptest.ResponseRecorder{
+		"query": func(r *gin.Engine) *httptest.ResponseRecorder {
+			return postMessage(r, "/messages?dry_run=true", bulkItem(2), nil)
+		},
+		"header": func(r *gin.Engine) *httptest.ResponseRecorder {
+			return postMessage(r, "/messages", bulkItem(2), http.Header{api.DryRunHeader: {"1"}})
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			router, store, metadataStore := dryRunRouter(t, 0)
+
+			w := send(router)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			var resp models.CreateMessageResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.True(t, resp.DryRun)
+			assert.True(t, storage.ValidID(resp.ID), "synthetic ID %q should look real", resp.ID)
+			assert.False(t, resp.ExpiresAt.IsZero())
+
+			assertNothingStored(t, store, metadataStore)
+		})
+	}
+}
+
+func TestCreateMessage_DryRunValidates(t *testing.T) {
+	ttl := int64(1)
+	tests := []struct {
+		name       string
+		item       models.CreateMessageRequest
+		maxPending int
+		wantStatus int
+		wantCode   string
+	}{
+		{"ttl out of range", models.CreateMessageRequest{Ciphertext: "Y2k=", IV: "aXY=", RecipientID: 2, EncryptionKey: "k", TTL: &ttl}, 0, http.StatusBadRequest, models.ErrorCodeTTLOutOfRange},
+		{"unknown recipient", bulkItem(99), 0, http.StatusNotFound, models.ErrorCodeUserNotFound},
+		{"recipient inbox full", bulkItem(2), 1, http.StatusTooManyRequests, models.ErrorCodeRecipientInboxFull},
+		{"invalid body", models.CreateMessageRequest{RecipientID: 2}, 0, http.StatusBadRequest, models.ErrorCodeValidationFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router, store, metadataStore := dryRunRouter(t, tt.maxPending)
+			if tt.maxPending > 0 {
+				seedMessage(t, metadataStore, "pending-1", 1, 2)
+			}
+
+			w := postMessage(router, "/messages?dry_run=true", tt.item, nil)
+			require.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+			var errResp models.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResp))
+			assert.Equal(t, tt.wantCode, errResp.Code)
+			assert.Zero(t, store.Len())
+		})
+	}
+}
+
+func TestCreateMessage_DryRunRejectsBadFlag(t *testing.T) {
+	router, store, metadataStore := dryRunRouter(t, 0)
+
+	w := postMessage(router, "/messages?dry_run=maybe", bulkItem(2), nil)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	var errResp models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResp))
+	assert.Equal(t, models.ErrorCodeInvalidRequest, errResp.Code)
+	assertNothingStored(t, store, metadataStore)
+}
+
+func TestBulkCreateMessages_DryRun(t *testing.T) {
+	router, store, metadataStore := dryRunRouter(t, 0)
+
+	body, _ := json.Marshal(models.BulkCreateMessageRequest{Messages: []models.CreateMessageRequest{bulkItem(2), bulkItem(99)}})
+	req, _ := http.NewRequest("POST", "/messages/bulk?dry_run=true", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusMultiStatus, w.Code)
+	var resp models.BulkCreateMessageResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.DryRun)
+	assert.Equal(t, 1, resp.Succeeded)
+	assert.Equal(t, http.StatusOK, resp.Results[0].Status)
+	assert.NotEmpty(t, resp.Results[0].ID)
+	assert.Equal(t, http.StatusNotFound, resp.Results[1].Status)
+	assert.Equal(t, models.ErrorCodeUserNotFound, resp.Results[1].Code)
+
+	assertNothingStored(t, store, metadataStore)
+}
+
+func TestCreateMessage_UnknownRecipient(t *testing.T) {
+	router, store, _ := dryRunRouter(t, 0)
+
+	w := postMessage(router, "/messages", bulkItem(99), nil)
+	require.Equal(t, http.StatusNotFound, w.Code)
+	assert.Zero(t, store.Len())
+
+	w = postMessage(router, "/messages", bulkItem(2), nil)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, 1, store.Len())
+}
+
+// unreachableUsers fails every lookup by ID, as when PostgreSQL is down
+type unreachableUsers struct {
+	*fakes.UserStore
+}
+
+func (u unreachableUsers) FindByID(context.Context, int64) (*models.User, error) {
+	return nil, errors.New("failed to find user: connection refused")
+}
+
+func TestCreateMessage_RecipientLookupFails(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	users := seedUsers(t)
+	store := fakes.NewStorage()
+	handler := api.NewMessageHandler(store, fakes.NewMetadataStore(users), 0, nil, nil, unreachableUsers{users}, nil)
+	router := gin.New()
+	router.Use(authAs(1))
+	router.POST("/messages", handler.CreateMessage)
+
+	w := postMessage(router, "/messages", bulkItem(2), nil)
+	require.Equal(t, http.StatusInternalServerError, w.Code, "an outage is not a missing recipient")
+	var errResp models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResp))
+	assert.Equal(t, models.ErrorCodeInternal, errResp.Code)
+	assert.Zero(t, store.Len())
+}
@@ -0,0 +1,107 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestErrorCodes checks the primary error code of each endpoint through the
+// full router, so a renamed or missing code breaks the build, not clients
+func TestErrorCodes(t *testing.T) {
+	deps := testDependencies()
+	store := fakes.NewStorage()
+	deps.Storage = store
+	ctx := context.Background()
+
+	// Sender (1), recipient (2) and a bystander (3)
+	for _, email := range []string{"sender@example.com", "recipient@example.com", "other@example.com"} {
+		require.NoError(t, deps.UserStore.Create(ctx, &models.User{Email: email, Name: "User"}))
+	}
+	newMessage := func() string {
+		id, err := store.Store(ctx, &models.Message{Ciphertext: "Yw==", IV: "aXY="}, time.Hour)
+		require.NoError(t, err)
+		seedMessage(t, deps.MetadataStore.(*fakes.MetadataStore), id, 1, 2)
+		return id
+	}
+	unread := newMessage()
+	burned := newMessage()
+	claimed := newMessage()
+
+	router, err := api.SetupRouter(deps)
+	require.NoError(t, err)
+
+	do := func(method, path string, userID int64, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if userID != 0 {
+			token, err := deps.JWTManager.Generate(userID, "user@example.com")
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	require.Equal(t, http.StatusOK, do("GET", "/api/messages/"+burned, 2, "").Code)
+	require.Equal(t, http.StatusOK, do("POST", "/api/messages/"+claimed+"/claim", 2, "").Code)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		userID     int64
+		body       string
+		wantStatus int
+		wantCode   string
+	}{
+		{"no token", "GET", "/api/auth/me", 0, "", http.StatusUnauthorized, models.ErrorCodeUnauthorized},
+		{"malformed JSON", "POST", "/api/messages", 1, `{"ciphertext":`, http.StatusBadRequest, models.ErrorCodeInvalidRequest},
+		{"missing fields", "POST", "/api/messages", 1, `{}`, http.StatusBadRequest, models.ErrorCodeValidationFailed},
+		{"TTL too long", "POST", "/api/messages", 1,
+			`{"ciphertext":"Yw==","iv":"aXY=","recipient_id":2,"encryption_key":"k","ttl":99999999}`,
+			http.StatusBadRequest, models.ErrorCodeTTLOutOfRange},
+		{"empty batch", "POST", "/api/messages/bulk", 1, `{"messages":[]}`, http.StatusBadRequest, models.ErrorCodeBatchSize},
+		{"malformed message ID", "GET", "/api/messages/not*an*id", 2, "", http.StatusBadRequest, models.ErrorCodeInvalidMessageID},
+		{"unknown message", "GET", "/api/messages/AAAAAAAAAAAAAAAAAAAAAA", 2, "", http.StatusNotFound, models.ErrorCodeMessageNotFound},
+		{"not the recipient", "GET", "/api/messages/" + unread, 3, "", http.StatusForbidden, models.ErrorCodeNotRecipient},
+		{"preview by bystander", "GET", "/api/messages/" + unread + "/preview", 3, "", http.StatusForbidden, models.ErrorCodeNotRecipient},
+		{"already read", "GET", "/api/messages/" + burned, 2, "", http.StatusGone, models.ErrorCodeMessageAlreadyRead},
+		{"claimed", "GET", "/api/messages/" + claimed, 2, "", http.StatusConflict, models.ErrorCodeMessageClaimed},
+		{"wrong claim token", "GET", "/api/messages/" + claimed + "?claim=wrong", 2, "", http.StatusForbidden, models.ErrorCodeInvalidClaimToken},
+		{"duplicate email", "POST", "/api/auth/register", 0,
+			`{"email":"sender@example.com","name":"Sender","password":"long-enough"}`,
+			http.StatusConflict, models.ErrorCodeUserExists},
+		{"wrong password", "POST", "/api/auth/login", 0,
+			`{"email":"nobody@example.com","password":"long-enough"}`,
+			http.StatusUnauthorized, models.ErrorCodeInvalidCredentials},
+		{"bad public key", "PUT", "/api/profile/publickey", 1, `{"public_key":"c2hvcnQ="}`,
+			http.StatusBadRequest, models.ErrorCodeInvalidPublicKey},
+		{"slack disabled", "POST", "/api/notifications/send-slack", 1,
+			`{"recipient_id":2,"message_url":"http://localhost:5173/m/x#k"}`,
+			http.StatusServiceUnavailable, models.ErrorCodeIntegrationDisabled},
+		{"not an admin", "GET", "/api/admin/statistics", 1, "", http.StatusForbidden, models.ErrorCodeForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := do(tt.method, tt.path, tt.userID, tt.body)
+			require.Equal(t, tt.wantStatus, w.Code, w.Body.String())
+
+			var resp models.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.NotEmpty(t, resp.Error)
+		})
+	}
+}
@@ -7,23 +7,32 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/milkiss/vanish/backend/internal/api"
 	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/storage"
+	"github.com/milkiss/vanish/backend/tests/fakes"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 // Mock storage implementation
 type mockStorage struct {
-	storeFunc      func(ctx context.Context, msg *models.Message, ttl time.Duration) (string, error)
-	getDeleteFunc  func(ctx context.Context, id string) (*models.Message, error)
-	existsFunc     func(ctx context.Context, id string) (bool, error)
-	pingFunc       func(ctx context.Context) error
-	closeFunc      func() error
+	storeFunc     func(ctx context.Context, msg *models.Message, ttl time.Duration) (string, error)
+	getDeleteFunc func(ctx context.Context, id string) (*models.Message, error)
+	existsFunc    func(ctx context.Context, id string) (bool, error)
+	ttlFunc       func(ctx context.Context, id string) (time.Duration, error)
+	claimFunc     func(ctx context.Context, id string, userID int64, window time.Duration) (string, time.Time, error)
+	fetchFunc     func(ctx context.Context, id string, userID int64, token string) (*models.Message, error)
+	deniedFunc    func(ctx context.Context, id, ip string, window time.Duration) (int, []string, error)
+	pingFunc      func(ctx context.Context) error
+	closeFunc     func() error
 }
 
 func (m *mockStorage) Store(ctx context.Context, msg *models.Message, ttl time.Duration) (string, error) {
@@ -33,6 +42,10 @@ func (m *mockStorage) Store(ctx context.Context, msg *models.Message, ttl time.D
 	return "test-id-123", nil
 }
 
+func (m *mockStorage) StoreWithID(ctx context.Context, id string, msg *models.Message, ttl time.Duration) (string, error) {
+	return m.Store(ctx, msg, ttl)
+}
+
 func (m *mockStorage) GetAndDelete(ctx context.Context, id string) (*models.Message, error) {
 	if m.getDeleteFunc != nil {
 		return m.getDeleteFunc(ctx, id)
@@ -43,6 +56,31 @@ func (m *mockStorage) GetAndDelete(ctx context.Context, id string) (*models.Mess
 	}, nil
 }
 
+func (m *mockStorage) Claim(ctx context.Context, id string, userID int64, window time.Duration) (string, time.Time, error) {
+	if m.claimFunc != nil {
+		return m.claimFunc(ctx, id, userID, window)
+	}
+	return "test-claim-token", time.Now().Add(window), nil
+}
+
+func (m *mockStorage) FetchClaim(ctx context.Context, id string, userID int64, token string) (*models.Message, error) {
+	if m.fetchFunc != nil {
+		return m.fetchFunc(ctx, id, userID, token)
+	}
+	return &models.Message{
+		Ciphertext: "test-ciphertext",
+		IV:         "test-iv",
+	}, nil
+}
+
+func (m *mockStorage) IssueReadIntent(ctx context.Context, id string, window time.Duration) (string, time.Time, error) {
+	return "intent", time.Now().Add(window), nil
+}
+
+func (m *mockStorage) TakeReadIntent(ctx context.Context, id, token string) (bool, error) {
+	return false, nil
+}
+
 func (m *mockStorage) Exists(ctx context.Context, id string) (bool, error) {
 	if m.existsFunc != nil {
 		return m.existsFunc(ctx, id)
@@ -50,6 +88,56 @@ func (m *mockStorage) Exists(ctx context.Context, id string) (bool, error) {
 	return true, nil
 }
 
+func (m *mockStorage) GetTTL(ctx context.Context, id string) (time.Duration, error) {
+	if m.ttlFunc != nil {
+		return m.ttlFunc(ctx, id)
+	}
+	return time.Hour, nil
+}
+
+func (m *mockStorage) RecordDenied(ctx context.Context, id, ip string, window time.Duration) (int, []string, error) {
+	if m.deniedFunc != nil {
+		return m.deniedFunc(ctx, id, ip, window)
+	}
+	return 1, []string{ip}, nil
+}
+
+func (m *mockStorage) RecordNotification(ctx context.Context, key string, window time.Duration) (int, string, error) {
+	return 1, "", nil
+}
+
+func (m *mockStorage) SetNotificationRef(ctx context.Context, key, ref string) error {
+	return nil
+}
+
+func (m *mockStorage) ForgetNotification(ctx context.Context, key string) error {
+	return nil
+}
+
+func (m *mockStorage) SaveOAuthState(ctx context.Context, state string, ttl time.Duration) error {
+	return nil
+}
+
+func (m *mockStorage) TakeOAuthState(ctx context.Context, state string) (bool, error) {
+	return false, nil
+}
+
+func (m *mockStorage) RecordHealthSample(ctx context.Context, sample models.HealthSample, keep time.Duration) error {
+	return nil
+}
+
+func (m *mockStorage) HealthSamples(ctx context.Context, since time.Time) ([]models.HealthSample, error) {
+	return nil, nil
+}
+
+func (m *mockStorage) Delete(ctx context.Context, ids []string) (int, error) {
+	return 0, nil
+}
+
+func (m *mockStorage) Scan(ctx context.Context, cursor uint64, count int64) ([]storage.ScannedMessage, uint64, error) {
+	return nil, 0, nil
+}
+
 func (m *mockStorage) Ping(ctx context.Context) error {
 	if m.pingFunc != nil {
 		return m.pingFunc(ctx)
@@ -67,7 +155,7 @@ func (m *mockStorage) Close() error {
 func TestHealth(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	mockStore := &mockStorage{}
-	handler := api.NewMessageHandler(mockStore, nil)
+	handler := api.NewMessageHandler(mockStore, nil, 0, nil, nil, nil, nil)
 
 	router := gin.New()
 	router.GET("/health", handler.Health)
@@ -91,7 +179,7 @@ func TestHealth_StorageError(t *testing.T) {
 			return errors.New("storage error")
 		},
 	}
-	handler := api.NewMessageHandler(mockStore, nil)
+	handler := api.NewMessageHandler(mockStore, nil, 0, nil, nil, nil, nil)
 
 	router := gin.New()
 	router.GET("/health", handler.Health)
@@ -110,7 +198,7 @@ func TestCheckMessage_Exists(t *testing.T) {
 			return true, nil
 		},
 	}
-	handler := api.NewMessageHandler(mockStore, nil)
+	handler := api.NewMessageHandler(mockStore, nil, 0, nil, nil, nil, nil)
 
 	router := gin.New()
 	router.HEAD("/messages/:id", handler.CheckMessage)
@@ -129,7 +217,7 @@ func TestCheckMessage_NotExists(t *testing.T) {
 			return false, nil
 		},
 	}
-	handler := api.NewMessageHandler(mockStore, nil)
+	handler := api.NewMessageHandler(mockStore, nil, 0, nil, nil, nil, nil)
 
 	router := gin.New()
 	router.HEAD("/messages/:id", handler.CheckMessage)
@@ -141,13 +229,273 @@ func TestCheckMessage_NotExists(t *testing.T) {
 	assert.Equal(t, http.StatusNotFound, w.Code)
 }
 
-// TestCreateMessage_Success would require a real or mocked MetadataRepository
-// Skipping this test to avoid complexity with concrete repository types
+// authAs returns a middleware that simulates an authenticated user
+func authAs(userID int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Next()
+	}
+}
+
+func TestCreateMessage_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockStore := &mockStorage{}
+	metadataStore := fakes.NewMetadataStore(nil)
+	handler := api.NewMessageHandler(mockStore, metadataStore, 0, nil, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(1))
+	router.POST("/messages", handler.CreateMessage)
+
+	reqBody := models.CreateMessageRequest{
+		Ciphertext:    "dGVzdC1jaXBoZXJ0ZXh0",
+		IV:            "dGVzdC1pdg==",
+		RecipientID:   2,
+		EncryptionKey: "test-key",
+	}
+	bodyBytes, _ := json.Marshal(reqBody)
+
+	req, _ := http.NewRequest("POST", "/messages", bytes.NewBuffer(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var response models.CreateMessageResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "test-id-123", response.ID)
+
+	// Metadata must record sender, recipient and key
+	metadata, err := metadataStore.FindByMessageID(context.Background(), "test-id-123")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), metadata.SenderID)
+	assert.Equal(t, int64(2), metadata.RecipientID)
+	assert.Equal(t, models.StatusPending, metadata.Status)
+}
+
+func TestCreateMessage_RecordsClient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		header string
+		want   models.Client
+	}{
+		{"no header counts as api", "", models.ClientAPI},
+		{"cli", "cli", models.ClientCLI},
+		{"mcp, any case", " MCP ", models.ClientMCP},
+		{"web", "web", models.ClientWeb},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metadataStore := fakes.NewMetadataStore(nil)
+			handler := api.NewMessageHandler(&mockStorage{}, metadataStore, 0, nil, nil, nil, nil)
+			router := gin.New()
+			router.Use(authAs(1))
+			router.POST("/messages", handler.CreateMessage)
+
+			bodyBytes, _ := json.Marshal(models.CreateMessageRequest{
+				Ciphertext: "dGVzdC1jaXBoZXJ0ZXh0", IV: "dGVzdC1pdg==", RecipientID: 2, EncryptionKey: "test-key",
+			})
+			req, _ := http.NewRequest("POST", "/messages", bytes.NewBuffer(bodyBytes))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.header != "" {
+				req.Header.Set(api.ClientHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+			metadata, err := metadataStore.FindByMessageID(context.Background(), "test-id-123")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, metadata.CreatedVia)
+
+			history, err := metadataStore.GetUserHistory(context.Background(), 1, "", models.Page{Limit: 10})
+			require.NoError(t, err)
+			require.Len(t, history, 1)
+			assert.Equal(t, tt.want, history[0].CreatedVia)
+		})
+	}
+}
+
+func TestCreateMessage_RejectsUnknownClient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	metadataStore := fakes.NewMetadataStore(nil)
+	handler := api.NewMessageHandler(&mockStorage{}, metadataStore, 0, nil, nil, nil, nil)
+	router := gin.New()
+	router.Use(authAs(1))
+	router.POST("/messages", handler.CreateMessage)
+	router.POST("/messages/bulk", handler.BulkCreateMessages)
+
+	message := models.CreateMessageRequest{
+		Ciphertext: "dGVzdC1jaXBoZXJ0ZXh0", IV: "dGVzdC1pdg==", RecipientID: 2, EncryptionKey: "test-key",
+	}
+	single, _ := json.Marshal(message)
+	bulk, _ := json.Marshal(models.BulkCreateMessageRequest{Messages: []models.CreateMessageRequest{message}})
+
+	for path, body := range map[string][]byte{"/messages": single, "/messages/bulk": bulk} {
+		req, _ := http.NewRequest("POST", path, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(api.ClientHeader, "curl/8.0")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusBadRequest, w.Code, path)
+		var resp models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, models.ErrorCodeInvalidRequest, resp.Code, path)
+		assert.Contains(t, resp.Error, "api, cli, web, slack, mcp", path)
+	}
+
+	_, err := metadataStore.FindByMessageID(context.Background(), "test-id-123")
+	assert.ErrorIs(t, err, models.ErrMessageNotFound, "nothing may be stored")
+}
+
+func TestCreateMessage_SealedKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	metadataStore := fakes.NewMetadataStore(seedUsers(t))
+	handler := api.NewMessageHandler(&mockStorage{}, metadataStore, 0, nil, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(1))
+	router.POST("/messages", handler.CreateMessage)
+
+	post := func(body string) int {
+		req, _ := http.NewRequest("POST", "/messages", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	const sealed = "c2VhbGVkLWtleS1ibG9i"
+	require.Equal(t, http.StatusCreated,
+		post(`{"ciphertext":"Yw==","iv":"aXY=","recipient_id":2,"sealed_key":"`+sealed+`"}`))
+
+	// Exactly one of the two keys
+	assert.Equal(t, http.StatusBadRequest,
+		post(`{"ciphertext":"Yw==","iv":"aXY=","recipient_id":2,"sealed_key":"`+sealed+`","encryption_key":"k"}`))
+	assert.Equal(t, http.StatusBadRequest, post(`{"ciphertext":"Yw==","iv":"aXY=","recipient_id":2}`))
+	assert.Equal(t, http.StatusBadRequest,
+		post(`{"ciphertext":"Yw==","iv":"aXY=","recipient_id":2,"sealed_key":"not base64!"}`))
+
+	// Only the recipient gets the sealed key back, and no plaintext key exists
+	history, err := metadataStore.GetUserHistory(context.Background(), 2, "", models.Page{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, sealed, history[0].SealedKey)
+	assert.Empty(t, history[0].EncryptionKey)
+	assert.True(t, history[0].KeyRetained)
+
+	history, err = metadataStore.GetUserHistory(context.Background(), 1, "", models.Page{Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, history[0].SealedKey)
+}
+
+func TestCreateMessage_ContentEncoding(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	metadataStore := fakes.NewMetadataStore(nil)
+	handler := api.NewMessageHandler(fakes.NewStorage(), metadataStore, 0, nil, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		userID, _ := strconv.ParseInt(c.GetHeader("X-Test-User"), 10, 64)
+		c.Set("user_id", userID)
+		c.Next()
+	})
+	router.POST("/messages", handler.CreateMessage)
+	router.GET("/messages/:id", handler.GetMessage)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/messages", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Test-User", "1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	// read sends a message with the given encoding field and reads it back
+	read := func(encoding string) map[string]interface{} {
+		w := post(`{"ciphertext":"Yw==","iv":"aXY=","recipient_id":2,"encryption_key":"k"` + encoding + `}`)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var created models.CreateMessageResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+
+		w = requestAs(router, "GET", "/messages/"+created.ID, 2)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var body map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return body
+	}
+
+	assert.Equal(t, "gzip", read(`,"content_encoding":"gzip"`)["content_encoding"])
+	assert.NotContains(t, read(""), "content_encoding", "uncompressed messages omit it")
+
+	w := post(`{"ciphertext":"Yw==","iv":"aXY=","recipient_id":2,"encryption_key":"k","content_encoding":"br"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "content_encoding")
+}
+
+func TestCreateMessage_StorageFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockStore := &mockStorage{
+		storeFunc: func(ctx context.Context, msg *models.Message, ttl time.Duration) (string, error) {
+			return "", errors.New("redis down")
+		},
+	}
+	handler := api.NewMessageHandler(mockStore, fakes.NewMetadataStore(nil), 0, nil, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(1))
+	router.POST("/messages", handler.CreateMessage)
+
+	reqBody := models.CreateMessageRequest{
+		Ciphertext:    "dGVzdC1jaXBoZXJ0ZXh0",
+		IV:            "dGVzdC1pdg==",
+		RecipientID:   2,
+		EncryptionKey: "test-key",
+	}
+	bodyBytes, _ := json.Marshal(reqBody)
+
+	req, _ := http.NewRequest("POST", "/messages", bytes.NewBuffer(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestCreateMessage_MetadataFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	metadataStore := fakes.NewMetadataStore(nil)
+	metadataStore.CreateErr = errors.New("db down")
+	handler := api.NewMessageHandler(&mockStorage{}, metadataStore, 0, nil, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(1))
+	router.POST("/messages", handler.CreateMessage)
+
+	reqBody := models.CreateMessageRequest{
+		Ciphertext:    "dGVzdC1jaXBoZXJ0ZXh0",
+		IV:            "dGVzdC1pdg==",
+		RecipientID:   2,
+		EncryptionKey: "test-key",
+	}
+	bodyBytes, _ := json.Marshal(reqBody)
+
+	req, _ := http.NewRequest("POST", "/messages", bytes.NewBuffer(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
 
 func TestCreateMessage_Unauthorized(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	mockStore := &mockStorage{}
-	handler := api.NewMessageHandler(mockStore, nil)
+	handler := api.NewMessageHandler(mockStore, nil, 0, nil, nil, nil, nil)
 
 	router := gin.New()
 	// No auth middleware - user_id not set
@@ -171,7 +519,7 @@ func TestCreateMessage_Unauthorized(t *testing.T) {
 func TestCreateMessage_InvalidTTL(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	mockStore := &mockStorage{}
-	handler := api.NewMessageHandler(mockStore, nil)
+	handler := api.NewMessageHandler(mockStore, nil, 0, nil, nil, nil, nil)
 
 	router := gin.New()
 	router.Use(func(c *gin.Context) {
@@ -197,5 +545,895 @@ func TestCreateMessage_InvalidTTL(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
-// TestGetMessage tests would require a real or mocked MetadataRepository
-// Skipping these tests to avoid complexity with concrete repository types
+func TestCreateMessage_ValidationDetails(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := api.NewMessageHandler(&mockStorage{}, nil, 0, nil, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(1))
+	router.POST("/messages", handler.CreateMessage)
+
+	post := func(body string) (int, models.ErrorResponse) {
+		req, _ := http.NewRequest("POST", "/messages", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		var resp models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.NotContains(t, w.Body.String(), "CreateMessageRequest", "struct names must not leak")
+		assert.NotContains(t, w.Body.String(), "Key: '", "validator output must not leak")
+		return w.Code, resp
+	}
+
+	code, resp := post(`{"iv":"aXY=","recipient_id":2,"encryption_key":"k","ciphertext":"not base64!"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, map[string]string{"ciphertext": "must be base64-encoded"}, resp.Details)
+	assert.Equal(t, "Invalid request: ciphertext must be base64-encoded", resp.Error)
+
+	code, resp = post(`{"ciphertext":"Yw==","iv":"aXY=","recipient_id":2}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "is required unless sealed_key is set", resp.Details["encryption_key"])
+
+	// Malformed JSON has no fields to report and must not echo the parser
+	code, resp = post(`{"ciphertext":`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Nil(t, resp.Details)
+	assert.NotContains(t, resp.Error, "unexpected EOF")
+}
+
+// seedMessage stores pending metadata for a message from sender to recipient
+func seedMessage(t *testing.T, store *fakes.MetadataStore, id string, senderID, recipientID int64) {
+	t.Helper()
+	err := store.Create(context.Background(), &models.MessageMetadata{
+		MessageID:     id,
+		SenderID:      senderID,
+		RecipientID:   recipientID,
+		EncryptionKey: "test-key",
+		Status:        models.StatusPending,
+		CreatedAt:     time.Now().UTC(),
+		ExpiresAt:     time.Now().UTC().Add(time.Hour),
+	})
+	require.NoError(t, err)
+}
+
+func TestGetMessage_Recipient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	metadataStore := fakes.NewMetadataStore(nil)
+	seedMessage(t, metadataStore, "msg-1", 1, 2)
+	handler := api.NewMessageHandler(&mockStorage{}, metadataStore, 0, nil, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(2))
+	router.GET("/messages/:id", handler.GetMessage)
+
+	req, _ := http.NewRequest("GET", "/messages/msg-1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.MessageResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "test-ciphertext", response.Ciphertext)
+
+	metadata, err := metadataStore.FindByMessageID(context.Background(), "msg-1")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusRead, metadata.Status)
+}
+
+func TestGetMessage_NotRecipient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	metadataStore := fakes.NewMetadataStore(nil)
+	seedMessage(t, metadataStore, "msg-1", 1, 2)
+
+	burned := false
+	mockStore := &mockStorage{
+		getDeleteFunc: func(ctx context.Context, id string) (*models.Message, error) {
+			burned = true
+			return &models.Message{}, nil
+		},
+	}
+	handler := api.NewMessageHandler(mockStore, metadataStore, 0, nil, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(3))
+	router.GET("/messages/:id", handler.GetMessage)
+
+	req, _ := http.NewRequest("GET", "/messages/msg-1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.False(t, burned, "message must not be burned for a non-recipient")
+}
+
+func TestGetMessage_AlreadyRead(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	metadataStore := fakes.NewMetadataStore(nil)
+	seedMessage(t, metadataStore, "msg-1", 1, 2)
+	require.NoError(t, metadataStore.MarkAsRead(context.Background(), "msg-1"))
+	handler := api.NewMessageHandler(&mockStorage{}, metadataStore, 0, nil, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(2))
+	router.GET("/messages/:id", handler.GetMessage)
+
+	req, _ := http.NewRequest("GET", "/messages/msg-1", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusGone, w.Code)
+}
+
+func TestGetMessage_GoneStatusHeader(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	metadataStore := fakes.NewMetadataStore(nil)
+	seedMessage(t, metadataStore, "read", 1, 2)
+	require.NoError(t, metadataStore.MarkAsRead(ctx, "read"))
+	seedMessage(t, metadataStore, "revoked", 1, 2)
+	require.NoError(t, metadataStore.RevokeMessage(ctx, 1, "revoked"))
+	require.NoError(t, metadataStore.Create(ctx, &models.MessageMetadata{
+		MessageID:   "expired",
+		SenderID:    1,
+		RecipientID: 2,
+		Status:      models.StatusPending,
+		CreatedAt:   time.Now().UTC().Add(-2 * time.Hour),
+		ExpiresAt:   time.Now().UTC().Add(-time.Hour),
+	}))
+	notFound := &mockStorage{getDeleteFunc: func(ctx context.Context, id string) (*models.Message, error) {
+		return nil, models.ErrMessageNotFound
+	}}
+	handler := api.NewMessageHandler(notFound, metadataStore, 0, nil, nil, nil, nil)
+
+	get := func(userID int64, id string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.Use(authAs(userID))
+		router.GET("/messages/:id", handler.GetMessage)
+		req, _ := http.NewRequest("GET", "/messages/"+id, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	gone := func(w *httptest.ResponseRecorder) models.MessageGoneResponse {
+		t.Helper()
+		require.Equal(t, http.StatusGone, w.Code, w.Body.String())
+		var resp models.MessageGoneResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp
+	}
+
+	w := get(2, "read")
+	resp := gone(w)
+	assert.Equal(t, models.ErrorCodeMessageAlreadyRead, resp.Code)
+	require.NotNil(t, resp.ReadAt)
+	assert.Nil(t, resp.ExpiresAt)
+	assert.Equal(t, "read", w.Header().Get(api.MessageStatusHeader))
+	assert.NotEmpty(t, w.Header().Get(api.ReadAtHeader))
+
+	w = get(2, "revoked")
+	resp = gone(w)
+	assert.Equal(t, models.ErrorCodeMessageRevoked, resp.Code)
+	assert.Nil(t, resp.ReadAt)
+	assert.Nil(t, resp.ExpiresAt, "a revoked message's expiry is beside the point")
+	assert.Equal(t, "revoked", w.Header().Get(api.MessageStatusHeader))
+
+	// Past its expiry, whether or not the janitor marked it so
+	w = get(2, "expired")
+	resp = gone(w)
+	assert.Equal(t, models.ErrorCodeMessageExpired, resp.Code)
+	require.NotNil(t, resp.ExpiresAt)
+	assert.True(t, resp.ExpiresAt.Before(time.Now()))
+	assert.Nil(t, resp.ReadAt)
+	assert.Equal(t, "expired", w.Header().Get(api.MessageStatusHeader))
+	expired, err := metadataStore.CleanupExpired(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"expired"}, expired)
+	assert.Equal(t, models.ErrorCodeMessageExpired, gone(get(2, "expired")).Code)
+
+	// Each says what happened in words, not just the code
+	assert.NotEqual(t, gone(get(2, "read")).Error, gone(get(2, "expired")).Error)
+	assert.NotEqual(t, gone(get(2, "revoked")).Error, gone(get(2, "expired")).Error)
+
+	// Others learn nothing about the message
+	w = get(3, "revoked")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get(api.MessageStatusHeader))
+	w = get(2, "missing")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get(api.MessageStatusHeader))
+}
+
+func TestGetMessage_UnknownID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := api.NewMessageHandler(&mockStorage{}, fakes.NewMetadataStore(nil), 0, nil, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(2))
+	router.GET("/messages/:id", handler.GetMessage)
+
+	req, _ := http.NewRequest("GET", "/messages/missing", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestGetMessage_MalformedID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockStore := &mockStorage{
+		getDeleteFunc: func(ctx context.Context, id string) (*models.Message, error) {
+			t.Fatal("storage must not be reached for a malformed ID")
+			return nil, nil
+		},
+		existsFunc: func(ctx context.Context, id string) (bool, error) {
+			t.Fatal("storage must not be reached for a malformed ID")
+			return false, nil
+		},
+	}
+	handler := api.NewMessageHandler(mockStore, fakes.NewMetadataStore(nil), 0, nil, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(2))
+	router.GET("/messages/:id", handler.GetMessage)
+	router.HEAD("/messages/:id", handler.CheckMessage)
+
+	for _, id := range []string{"bad%20id", "a=b", "%3D%3D", strings.Repeat("a", 65)} {
+		for _, method := range []string{"GET", "HEAD"} {
+			req, _ := http.NewRequest(method, "/messages/"+id, nil)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, "%s %s", method, id)
+		}
+	}
+}
+
+// previewRouter serves preview and read for a stored message sent from user 1 to user 2
+func previewRouter(t *testing.T, userID int64) (*gin.Engine, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	store := fakes.NewStorage()
+	id, err := store.Store(context.Background(), &models.Message{Ciphertext: "secret-ciphertext", IV: "secret-iv"}, time.Hour)
+	require.NoError(t, err)
+
+	metadataStore := fakes.NewMetadataStore(seedUsers(t))
+	seedMessage(t, metadataStore, id, 1, 2)
+	handler := api.NewMessageHandler(store, metadataStore, 0, nil, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(userID))
+	router.GET("/messages/:id", handler.GetMessage)
+	router.GET("/messages/:id/preview", handler.PreviewMessage)
+	return router, id
+}
+
+func TestPreviewMessage_DoesNotBurn(t *testing.T) {
+	router, id := previewRouter(t, 2)
+
+	req, _ := http.NewRequest("GET", "/messages/"+id+"/preview", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var preview models.MessagePreviewResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &preview))
+	assert.Equal(t, "Sender", preview.SenderName)
+	assert.True(t, preview.OneTime)
+	assert.False(t, preview.PassphraseRequired)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), preview.ExpiresAt, time.Minute)
+	assert.InDelta(t, 3600, preview.ExpiresInSeconds, 5)
+
+	for _, secret := range []string{"secret-ciphertext", "secret-iv", "test-key", "ciphertext", "encryption_key"} {
+		assert.NotContains(t, w.Body.String(), secret)
+	}
+
+	// The message is still there to be read exactly once
+	req, _ = http.NewRequest("GET", "/messages/"+id, nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "secret-ciphertext")
+}
+
+func TestPreviewMessage_UsesLiveTTL(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := fakes.NewStorage()
+	id, err := store.Store(context.Background(), &models.Message{Ciphertext: "c", IV: "iv"}, 10*time.Minute)
+	require.NoError(t, err)
+
+	// The metadata claims an hour, but Redis expires the message in ten minutes
+	metadataStore := fakes.NewMetadataStore(seedUsers(t))
+	seedMessage(t, metadataStore, id, 1, 2)
+	handler := api.NewMessageHandler(store, metadataStore, 0, nil, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(2))
+	router.GET("/messages/:id/preview", handler.PreviewMessage)
+
+	w := requestAs(router, "GET", "/messages/"+id+"/preview", 2)
+	require.Equal(t, http.StatusOK, w.Code)
+	var preview models.MessagePreviewResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &preview))
+	assert.InDelta(t, 600, preview.ExpiresInSeconds, 5)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), preview.ExpiresAt, 5*time.Second)
+}
+
+func TestPreviewMessage_NotRecipient(t *testing.T) {
+	router, id := previewRouter(t, 1)
+
+	req, _ := http.NewRequest("GET", "/messages/"+id+"/preview", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NotContains(t, w.Body.String(), "Sender")
+}
+
+func TestPreviewMessage_AfterRead(t *testing.T) {
+	router, id := previewRouter(t, 2)
+
+	req, _ := http.NewRequest("GET", "/messages/"+id, nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest("GET", "/messages/"+id+"/preview", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusGone, w.Code)
+}
+
+// claimRouter serves claim and read for a stored message sent from user 1 to user 2
+func claimRouter(t *testing.T) (*gin.Engine, *fakes.MetadataStore, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	store := fakes.NewStorage()
+	id, err := store.Store(context.Background(), &models.Message{Ciphertext: "claimed-ciphertext", IV: "claimed-iv"}, time.Hour)
+	require.NoError(t, err)
+
+	metadataStore := fakes.NewMetadataStore(nil)
+	seedMessage(t, metadataStore, id, 1, 2)
+	handler := api.NewMessageHandler(store, metadataStore, 0, nil, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		userID, _ := strconv.ParseInt(c.GetHeader("X-Test-User"), 10, 64)
+		c.Set("user_id", userID)
+		c.Next()
+	})
+	router.GET("/messages/:id", handler.GetMessage)
+	router.DELETE("/messages/:id", handler.RevokeMessage)
+	router.POST("/messages/:id/claim", handler.ClaimMessage)
+	router.POST("/messages/:id/read", handler.ReadMessage)
+	router.GET("/messages/:id/status", handler.GetMessageStatus)
+	router.GET("/m-preview/:id", handler.LinkPreview)
+	return router, metadataStore, id
+}
+
+func requestAs(router *gin.Engine, method, path string, userID int64) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	req.Header.Set("X-Test-User", strconv.FormatInt(userID, 10))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestClaimMessage_ClaimThenFetch(t *testing.T) {
+	router, metadataStore, id := claimRouter(t)
+
+	w := requestAs(router, "POST", "/messages/"+id+"/claim", 2)
+	require.Equal(t, http.StatusOK, w.Code)
+	var claim models.ClaimMessageResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &claim))
+	require.NotEmpty(t, claim.ClaimToken)
+	assert.WithinDuration(t, time.Now().Add(models.ClaimWindow), claim.ExpiresAt, 2*time.Second)
+
+	metadata, err := metadataStore.FindByMessageID(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusClaimed, metadata.Status)
+
+	// Lost the claim response: claiming again hands back the same token
+	w = requestAs(router, "POST", "/messages/"+id+"/claim", 2)
+	require.Equal(t, http.StatusOK, w.Code)
+	var again models.ClaimMessageResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &again))
+	assert.Equal(t, claim.ClaimToken, again.ClaimToken)
+
+	assert.Equal(t, http.StatusConflict, requestAs(router, "GET", "/messages/"+id, 2).Code)
+	assert.Equal(t, http.StatusForbidden, requestAs(router, "GET", "/messages/"+id+"?claim=wrong", 2).Code)
+
+	w = requestAs(router, "GET", "/messages/"+id+"?claim="+claim.ClaimToken, 2)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "claimed-ciphertext")
+
+	metadata, err = metadataStore.FindByMessageID(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusRead, metadata.Status)
+
+	// Lost the fetch response: the claim still holds the message until it lapses
+	w = requestAs(router, "GET", "/messages/"+id+"?claim="+claim.ClaimToken, 2)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "claimed-ciphertext")
+
+	assert.Equal(t, http.StatusGone, requestAs(router, "GET", "/messages/"+id, 2).Code)
+	assert.Equal(t, http.StatusGone, requestAs(router, "POST", "/messages/"+id+"/claim", 2).Code)
+}
+
+func TestClaimMessage_LapsedClaimExpires(t *testing.T) {
+	router, metadataStore, id := claimRouter(t)
+
+	w := requestAs(router, "POST", "/messages/"+id+"/claim", 2)
+	require.Equal(t, http.StatusOK, w.Code)
+	var claim models.ClaimMessageResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &claim))
+
+	// The claim window ends without a fetch
+	require.NoError(t, metadataStore.UpdateExpiresAt(context.Background(), id, time.Now().Add(-time.Second)))
+
+	w = requestAs(router, "GET", "/messages/"+id, 2)
+	assert.Equal(t, http.StatusGone, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), models.ErrorCodeMessageExpired)
+	w = requestAs(router, "GET", "/messages/"+id+"?claim="+claim.ClaimToken, 2)
+	assert.Contains(t, w.Body.String(), models.ErrorCodeMessageExpired)
+
+	w = requestAs(router, "GET", "/messages/"+id+"/status", 1)
+	require.Equal(t, http.StatusOK, w.Code)
+	var status models.MessageStatusResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, models.StatusExpired, status.Status)
+}
+
+func TestClaimMessage_NotRecipient(t *testing.T) {
+	router, metadataStore, id := claimRouter(t)
+
+	assert.Equal(t, http.StatusForbidden, requestAs(router, "POST", "/messages/"+id+"/claim", 3).Code)
+
+	metadata, err := metadataStore.FindByMessageID(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusPending, metadata.Status)
+}
+
+func TestClaimMessage_ConcurrentClaimsShareOneToken(t *testing.T) {
+	router, _, id := claimRouter(t)
+
+	var wg sync.WaitGroup
+	tokens := make([]string, 10)
+	for i := range tokens {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := requestAs(router, "POST", "/messages/"+id+"/claim", 2)
+			var claim models.ClaimMessageResponse
+			if assert.Equal(t, http.StatusOK, w.Code) && assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &claim)) {
+				tokens[i] = claim.ClaimToken
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, token := range tokens {
+		assert.Equal(t, tokens[0], token)
+	}
+}
+
+func postBulk(router *gin.Engine, items []models.CreateMessageRequest) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.BulkCreateMessageRequest{Messages: items})
+	req, _ := http.NewRequest("POST", "/messages/bulk", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func bulkItem(recipientID int64) models.CreateMessageRequest {
+	return models.CreateMessageRequest{
+		Ciphertext:    "dGVzdC1jaXBoZXJ0ZXh0",
+		IV:            "dGVzdC1pdg==",
+		RecipientID:   recipientID,
+		EncryptionKey: "test-key",
+	}
+}
+
+func TestBulkCreateMessages_PartialFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := fakes.NewStorage()
+	calls := 0
+	mockStore := &mockStorage{
+		storeFunc: func(ctx context.Context, msg *models.Message, ttl time.Duration) (string, error) {
+			calls++
+			if calls == 2 {
+				return "", errors.New("redis hiccup")
+			}
+			return store.Store(ctx, msg, ttl)
+		},
+	}
+	metadataStore := fakes.NewMetadataStore(nil)
+	handler := api.NewMessageHandler(mockStore, metadataStore, 0, nil, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(1))
+	router.POST("/messages/bulk", handler.BulkCreateMessages)
+
+	badTTL := bulkItem(3)
+	ttl := int64(60)
+	badTTL.TTL = &ttl
+	badCiphertext := bulkItem(4)
+	badCiphertext.Ciphertext = "not base64!"
+
+	w := postBulk(router, []models.CreateMessageRequest{
+		bulkItem(2),   // stored
+		bulkItem(5),   // storage fails
+		badTTL,        // rejected before storage
+		badCiphertext, // rejected before storage
+		bulkItem(6),   // stored despite earlier failures
+	})
+
+	require.Equal(t, http.StatusMultiStatus, w.Code)
+	var response models.BulkCreateMessageResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 2, response.Succeeded)
+	assert.Equal(t, 3, response.Failed)
+	require.Len(t, response.Results, 5)
+
+	expected := []int{http.StatusCreated, http.StatusInternalServerError, http.StatusBadRequest, http.StatusBadRequest, http.StatusCreated}
+	for i, result := range response.Results {
+		assert.Equal(t, i, result.Index)
+		assert.Equal(t, expected[i], result.Status, "item %d", i)
+		if result.Status == http.StatusCreated {
+			assert.NotEmpty(t, result.ID)
+			assert.NotNil(t, result.ExpiresAt)
+			assert.Empty(t, result.Error)
+
+			metadata, err := metadataStore.FindByMessageID(context.Background(), result.ID)
+			require.NoError(t, err)
+			assert.Equal(t, int64(1), metadata.SenderID)
+		} else {
+			assert.Empty(t, result.ID)
+			assert.NotEmpty(t, result.Error)
+		}
+	}
+	assert.Contains(t, response.Results[2].Error, "TTL")
+	assert.Equal(t, map[string]string{"ciphertext": "must be base64-encoded"}, response.Results[3].Details)
+	assert.Equal(t, 3, calls, "invalid items must not reach storage")
+}
+
+func TestBulkCreateMessages_RejectsBatchSize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stored := false
+	mockStore := &mockStorage{
+		storeFunc: func(ctx context.Context, msg *models.Message, ttl time.Duration) (string, error) {
+			stored = true
+			return "id", nil
+		},
+	}
+	handler := api.NewMessageHandler(mockStore, fakes.NewMetadataStore(nil), 0, nil, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(1))
+	router.POST("/messages/bulk", handler.BulkCreateMessages)
+
+	tooMany := make([]models.CreateMessageRequest, models.MaxBulkMessages+1)
+	for i := range tooMany {
+		tooMany[i] = bulkItem(2)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, postBulk(router, tooMany).Code)
+	assert.Equal(t, http.StatusBadRequest, postBulk(router, nil).Code)
+	assert.False(t, stored, "a rejected batch must store nothing")
+
+	assert.Equal(t, http.StatusMultiStatus, postBulk(router, tooMany[:models.MaxBulkMessages]).Code)
+}
+
+func TestBulkCreateMessages_BatchOverflowsInbox(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := fakes.NewStorage()
+	metadataStore := fakes.NewMetadataStore(nil)
+	seedMessage(t, metadataStore, "pending-1", 1, 2)
+	handler := api.NewMessageHandler(store, metadataStore, 3, nil, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(1))
+	router.POST("/messages/bulk", handler.BulkCreateMessages)
+
+	// Recipient 2 has room for two more; the batch brings three
+	w := postBulk(router, []models.CreateMessageRequest{bulkItem(2), bulkItem(3), bulkItem(2), bulkItem(2)})
+	require.Equal(t, http.StatusTooManyRequests, w.Code, w.Body.String())
+	var errResp models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResp))
+	assert.Equal(t, models.ErrorCodeRecipientInboxFull, errResp.Code)
+	assert.Zero(t, store.Len(), "no item of a refused batch is stored")
+	count, err := metadataStore.CountPendingForRecipient(context.Background(), 3)
+	require.NoError(t, err)
+	assert.Zero(t, count)
+
+	// A batch that fits exactly is stored whole
+	w = postBulk(router, []models.CreateMessageRequest{bulkItem(2), bulkItem(3), bulkItem(2)})
+	require.Equal(t, http.StatusMultiStatus, w.Code, w.Body.String())
+	var response models.BulkCreateMessageResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, 3, response.Succeeded)
+	count, err = metadataStore.CountPendingForRecipient(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+}
+
+func TestCreateMessage_RecipientInboxFull(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := fakes.NewStorage()
+	metadataStore := fakes.NewMetadataStore(nil)
+	seedMessage(t, metadataStore, "pending-1", 1, 2)
+	seedMessage(t, metadataStore, "pending-2", 3, 2)
+	handler := api.NewMessageHandler(store, metadataStore, 2, nil, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(1))
+	router.POST("/messages", handler.CreateMessage)
+	router.POST("/messages/bulk", handler.BulkCreateMessages)
+
+	body, _ := json.Marshal(bulkItem(2))
+	req, _ := http.NewRequest("POST", "/messages", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	var errResp models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResp))
+	assert.Equal(t, models.ErrorCodeRecipientInboxFull, errResp.Code)
+
+	// A batch for a full recipient is refused whole, other recipients included
+	w = postBulk(router, []models.CreateMessageRequest{bulkItem(3), bulkItem(2)})
+	require.Equal(t, http.StatusTooManyRequests, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResp))
+	assert.Equal(t, models.ErrorCodeRecipientInboxFull, errResp.Code)
+	assert.Zero(t, store.Len())
+
+	// Once the recipient reads a message there is room again
+	require.NoError(t, metadataStore.MarkAsRead(context.Background(), "pending-1"))
+	assert.Equal(t, http.StatusMultiStatus, postBulk(router, []models.CreateMessageRequest{bulkItem(2)}).Code)
+	count, err := metadataStore.CountPendingForRecipient(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+}
+
+func TestGetMessageStatus(t *testing.T) {
+	router, _, id := claimRouter(t)
+
+	for _, userID := range []int64{1, 2} {
+		w := requestAs(router, "GET", "/messages/"+id+"/status", userID)
+		require.Equal(t, http.StatusOK, w.Code)
+		var status models.MessageStatusResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+		assert.Equal(t, id, status.ID)
+		assert.Equal(t, models.StatusPending, status.Status)
+		assert.Equal(t, int64(1), status.SenderID)
+		assert.Nil(t, status.ReadAt)
+		assert.NotContains(t, w.Body.String(), "claimed-ciphertext")
+	}
+
+	w := requestAs(router, "GET", "/messages/"+id+"/status", 3)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Checking the status does not burn the message
+	w = requestAs(router, "GET", "/messages/"+id, 2)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = requestAs(router, "GET", "/messages/"+id+"/status", 1)
+	require.Equal(t, http.StatusOK, w.Code)
+	var status models.MessageStatusResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, models.StatusRead, status.Status)
+	assert.NotNil(t, status.ReadAt)
+
+	w = requestAs(router, "GET", "/messages/missing/status", 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+// previewLink fetches a share link preview the way an unfurling bot does:
+// without credentials
+func previewLink(t *testing.T, router *gin.Engine, id string) models.LinkPreviewResponse {
+	t.Helper()
+	w := requestAs(router, "GET", "/m-preview/"+id, 0)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	var preview models.LinkPreviewResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &preview))
+	require.NotEmpty(t, preview.IntentToken)
+	return preview
+}
+
+func readWithIntent(router *gin.Engine, id, token string, userID int64) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(models.ReadMessageRequest{IntentToken: token})
+	req, _ := http.NewRequest("POST", "/messages/"+id+"/read", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Test-User", strconv.FormatInt(userID, 10))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestLinkPreview_PrefetchersDoNotBurn(t *testing.T) {
+	router, metadataStore, id := claimRouter(t)
+
+	// Slack, Teams and mail scanners each fetch the link before the human does
+	var tokens []string
+	for range 5 {
+		tokens = append(tokens, previewLink(t, router, id).IntentToken)
+	}
+	metadata, err := metadataStore.FindByMessageID(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusPending, metadata.Status)
+
+	preview := previewLink(t, router, id)
+	assert.Equal(t, id, preview.ID)
+	assert.WithinDuration(t, time.Now().Add(models.ReadIntentWindow), preview.IntentExpiresAt, 2*time.Second)
+	w := readWithIntent(router, id, preview.IntentToken, 2)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "claimed-ciphertext")
+
+	metadata, err = metadataStore.FindByMessageID(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusRead, metadata.Status)
+
+	w = readWithIntent(router, id, tokens[0], 2)
+	assert.Equal(t, http.StatusGone, w.Code, "a prefetcher's token does not outlive the message")
+	w = requestAs(router, "GET", "/m-preview/"+id, 0)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestLinkPreview_RepeatedPreviewsShareIntent(t *testing.T) {
+	router, _, id := claimRouter(t)
+
+	first := previewLink(t, router, id)
+	for range 5 {
+		preview := previewLink(t, router, id)
+		assert.Equal(t, first.IntentToken, preview.IntentToken, "a live intent is handed out again")
+		assert.Equal(t, first.IntentExpiresAt, preview.IntentExpiresAt, "without extending it")
+	}
+
+	w := readWithIntent(router, id, "forged", 2)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	w = readWithIntent(router, id, first.IntentToken, 2)
+	require.Equal(t, http.StatusOK, w.Code, "a wrong token leaves the intent alone: %s", w.Body.String())
+}
+
+// linkPreviewRouter serves the share link preview of one stored message with
+// metadata
+func linkPreviewRouter(t *testing.T, metadata *models.MessageMetadata) (*gin.Engine, string) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	store := fakes.NewStorage()
+	id, err := store.Store(context.Background(), &models.Message{Ciphertext: "ciphertext", IV: "iv"}, time.Hour)
+	require.NoError(t, err)
+
+	metadataStore := fakes.NewMetadataStore(nil)
+	metadata.MessageID = id
+	require.NoError(t, metadataStore.Create(context.Background(), metadata))
+	router := gin.New()
+	router.GET("/m-preview/:id", api.NewMessageHandler(store, metadataStore, 0, nil, nil, nil, nil).LinkPreview)
+	return router, id
+}
+
+// assertPreviewNotFound checks that a link preview answered exactly like one
+// of an unknown message: 404 with the same code and message, and nothing
+// about the message itself
+func assertPreviewNotFound(t *testing.T, router *gin.Engine, id string) {
+	t.Helper()
+	unknownID, err := storage.NewID()
+	require.NoError(t, err)
+	unknown := requestAs(router, "GET", "/m-preview/"+unknownID, 0)
+	require.Equal(t, http.StatusNotFound, unknown.Code, unknown.Body.String())
+	var want models.ErrorResponse
+	require.NoError(t, json.Unmarshal(unknown.Body.Bytes(), &want))
+
+	w := requestAs(router, "GET", "/m-preview/"+id, 0)
+	require.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+	var got models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	assert.Equal(t, want.Code, got.Code)
+	assert.Equal(t, want.Error, got.Error)
+	for _, leak := range []string{"available_at", "intent_token", "expires_at", "read_at"} {
+		assert.NotContains(t, w.Body.String(), leak)
+	}
+	assert.Empty(t, w.Header().Get("Retry-After"))
+}
+
+func TestLinkPreview_NoIntentBeforeRelease(t *testing.T) {
+	availableAt := time.Now().UTC().Add(30 * time.Minute)
+	router, id := linkPreviewRouter(t, &models.MessageMetadata{
+		SenderID: 1, RecipientID: 2, EncryptionKey: "key", Status: models.StatusPending,
+		CreatedAt: time.Now().UTC(), ExpiresAt: availableAt.Add(time.Hour), AvailableAt: &availableAt,
+	})
+
+	// The release time is for the recipient, who asks the signed-in API
+	assertPreviewNotFound(t, router, id)
+}
+
+func TestLinkPreview_NoIntentForExternalRecipients(t *testing.T) {
+	router, id := linkPreviewRouter(t, &models.MessageMetadata{
+		SenderID: 1, ExternalRecipientEmail: "guest@partner.example", EncryptionKey: "key", Status: models.StatusPending,
+		CreatedAt: time.Now().UTC(), ExpiresAt: time.Now().UTC().Add(time.Hour),
+	})
+
+	assertPreviewNotFound(t, router, id)
+}
+
+func TestLinkPreview_RevokedIsNotFound(t *testing.T) {
+	router, _, id := claimRouter(t)
+	w := requestAs(router, "DELETE", "/messages/"+id, 1)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	// The preview tells nobody why
+	assertPreviewNotFound(t, router, id)
+}
+
+func TestLinkPreview_InvalidIDIsNotFound(t *testing.T) {
+	router, _, _ := claimRouter(t)
+	assertPreviewNotFound(t, router, "not-a-message-id")
+}
+
+func TestReadMessage_IntentIsOneTime(t *testing.T) {
+	router, _, id := claimRouter(t)
+	preview := previewLink(t, router, id)
+
+	w := readWithIntent(router, id, preview.IntentToken, 1)
+	assert.Equal(t, http.StatusForbidden, w.Code, "only the recipient reads")
+	assert.Contains(t, w.Body.String(), models.ErrorCodeNotRecipient)
+
+	w = readWithIntent(router, id, "forged", 2)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), models.ErrorCodeInvalidReadIntent)
+
+	w = readWithIntent(router, id, "", 2)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = requestAs(router, "GET", "/m-preview/does-not-exist", 0)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	var wg sync.WaitGroup
+	codes := make([]int, 10)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = readWithIntent(router, id, preview.IntentToken, 2).Code
+		}(i)
+	}
+	wg.Wait()
+
+	ok := 0
+	for _, code := range codes {
+		if code == http.StatusOK {
+			ok++
+		}
+	}
+	assert.Equal(t, 1, ok, "one token burns the message once: %v", codes)
+}
+
+func TestRevokeMessage(t *testing.T) {
+	router, metadataStore, id := claimRouter(t)
+
+	w := requestAs(router, "DELETE", "/messages/"+id, 2)
+	require.Equal(t, http.StatusForbidden, w.Code, "only the sender revokes")
+
+	w = requestAs(router, "DELETE", "/messages/"+id, 1)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	metadata, err := metadataStore.FindByMessageID(context.Background(), id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusExpired, metadata.Status)
+	w = requestAs(router, "GET", "/messages/"+id+"/status", 1)
+	require.Equal(t, http.StatusOK, w.Code)
+	var status models.MessageStatusResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, models.StatusRevoked, status.Status, "expired before its time")
+
+	w = requestAs(router, "GET", "/messages/"+id, 2)
+	assert.NotEqual(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "claimed-ciphertext")
+
+	w = requestAs(router, "DELETE", "/messages/"+id, 1)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
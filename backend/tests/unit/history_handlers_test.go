@@ -0,0 +1,396 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/urlbuilder"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpirePending_OnlyCallersPendingMessages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	store := fakes.NewStorage()
+	metadataStore := fakes.NewMetadataStore(seedUsers(t))
+
+	stored := func(sender, recipient int64) string {
+		id, err := store.Store(ctx, &models.Message{Ciphertext: "c", IV: "iv"}, time.Hour)
+		require.NoError(t, err)
+		seedMessage(t, metadataStore, id, sender, recipient)
+		return id
+	}
+	mine := stored(1, 2)
+	alsoMine := stored(1, 2)
+	theirs := stored(2, 1)
+	seedMessage(t, metadataStore, "already-read", 1, 2)
+	require.NoError(t, metadataStore.MarkAsRead(ctx, "already-read"))
+
+	handler := api.NewHistoryHandler(metadataStore, store, nil)
+	router := gin.New()
+	router.Use(authAs(2))
+	router.POST("/history/expire-pending", handler.ExpirePending)
+
+	body, _ := json.Marshal(models.ExpirePendingRequest{
+		MessageIDs: []string{mine, alsoMine, theirs, "already-read", "unknown"},
+	})
+	req, _ := http.NewRequest("POST", "/history/expire-pending", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp models.ExpirePendingResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.Count)
+	assert.ElementsMatch(t, []string{mine, alsoMine}, resp.Expired)
+
+	for id, burned := range map[string]bool{mine: true, alsoMine: true, theirs: false} {
+		exists, err := store.Exists(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, !burned, exists, id)
+	}
+
+	metadata, err := metadataStore.FindByMessageID(ctx, theirs)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusPending, metadata.Status)
+	metadata, err = metadataStore.FindByMessageID(ctx, "already-read")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusRead, metadata.Status)
+}
+
+func TestExpirePending_RequiresIDs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := api.NewHistoryHandler(fakes.NewMetadataStore(nil), fakes.NewStorage(), nil)
+	router := gin.New()
+	router.Use(authAs(2))
+	router.POST("/history/expire-pending", handler.ExpirePending)
+
+	req, _ := http.NewRequest("POST", "/history/expire-pending", bytes.NewBufferString(`{"message_ids":[]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGetInbox_PendingForCallerByExpiry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	metadataStore := fakes.NewMetadataStore(seedUsers(t))
+
+	seed := func(id string, sender, recipient int64, ttl time.Duration, change func(*models.MessageMetadata)) {
+		m := &models.MessageMetadata{
+			MessageID:     id,
+			SenderID:      sender,
+			RecipientID:   recipient,
+			EncryptionKey: "key-" + id,
+			Status:        models.StatusPending,
+			CreatedAt:     time.Now().UTC(),
+			ExpiresAt:     time.Now().UTC().Add(ttl),
+		}
+		if change != nil {
+			change(m)
+		}
+		require.NoError(t, metadataStore.Create(ctx, m))
+	}
+	seed("later", 1, 2, 2*time.Hour, nil)
+	seed("sooner", 1, 2, time.Hour, nil)
+	seed("sealed", 1, 2, 3*time.Hour, func(m *models.MessageMetadata) {
+		m.EncryptionKey = ""
+		m.SealedKey = "sealed-blob"
+	})
+	seed("sent-by-me", 2, 1, time.Hour, nil)
+	seed("lapsed", 1, 2, -time.Minute, nil)
+	seed("read", 1, 2, time.Hour, func(m *models.MessageMetadata) { m.Status = models.StatusRead })
+
+	links, err := urlbuilder.New("http://localhost:5173")
+	require.NoError(t, err)
+	router := gin.New()
+	router.Use(authAs(2))
+	router.GET("/inbox", api.NewHistoryHandler(metadataStore, fakes.NewStorage(), links).GetInbox)
+
+	req, _ := http.NewRequest("GET", "/inbox", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var inbox []models.InboxMessage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &inbox))
+	require.Len(t, inbox, 3)
+
+	assert.Equal(t, "sooner", inbox[0].MessageID)
+	assert.Equal(t, "Sender", inbox[0].SenderName)
+	assert.Equal(t, "http://localhost:5173/m/sooner#key-sooner", inbox[0].URL)
+	assert.InDelta(t, 3600, inbox[0].ExpiresInSeconds, 5)
+
+	assert.Equal(t, "later", inbox[1].MessageID)
+
+	// Without a stored key there is no link to hand out
+	assert.Equal(t, "sealed", inbox[2].MessageID)
+	assert.Empty(t, inbox[2].URL)
+	assert.Equal(t, "sealed-blob", inbox[2].SealedKey)
+}
+
+func TestGetInbox_Empty(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(authAs(2))
+	router.GET("/inbox", api.NewHistoryHandler(fakes.NewMetadataStore(nil), fakes.NewStorage(), nil).GetInbox)
+
+	req, _ := http.NewRequest("GET", "/inbox", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, "[]", w.Body.String())
+}
+
+func TestGetMyHistory_DeletedCounterparts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	users := seedUsers(t)
+	third := &models.User{Email: "third@example.com", Name: "Third"}
+	require.NoError(t, users.Create(ctx, third))
+	metadataStore := fakes.NewMetadataStore(users)
+	seedMessage(t, metadataStore, "from-sender", 1, 2)
+	seedMessage(t, metadataStore, "from-third", third.ID, 2)
+	seedMessage(t, metadataStore, "to-sender", 2, 1)
+
+	// One account anonymized, the other gone entirely
+	require.NoError(t, users.Anonymize(ctx, 1))
+	require.NoError(t, users.Delete(ctx, third.ID))
+
+	router := gin.New()
+	router.Use(authAs(2))
+	router.GET("/history", api.NewHistoryHandler(metadataStore, fakes.NewStorage(), nil).GetMyHistory)
+	req, _ := http.NewRequest("GET", "/history", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var history []models.MessageHistoryResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	require.Len(t, history, 3, "exchanges with deleted users stay listed")
+	byID := map[string]models.MessageHistoryResponse{}
+	for _, h := range history {
+		byID[h.MessageID] = h
+		assert.True(t, h.IsCounterpartDeleted, h.MessageID)
+		assert.Empty(t, h.EncryptionKey, "no key for %s", h.MessageID)
+	}
+	assert.Equal(t, models.DeletedUserName, byID["from-sender"].SenderName)
+	assert.Equal(t, models.DeletedUserName, byID["from-third"].SenderName)
+	assert.Equal(t, models.DeletedUserName, byID["from-third"].SenderLabel)
+	assert.Equal(t, "Recipient", byID["to-sender"].SenderName)
+	assert.Equal(t, models.DeletedUserName, byID["to-sender"].RecipientName)
+}
+
+func TestGetMyHistory_Search(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	users := seedUsers(t)
+	dana := &models.User{Email: "dana@example.com", Name: "Dana Scully"}
+	require.NoError(t, users.Create(ctx, dana))
+	metadataStore := fakes.NewMetadataStore(users)
+	create := func(id string, sender, recipient int64, category string) {
+		require.NoError(t, metadataStore.Create(ctx, &models.MessageMetadata{
+			MessageID: id, SenderID: sender, RecipientID: recipient, Status: models.StatusPending,
+			CreatedAt: time.Now().UTC(), ExpiresAt: time.Now().UTC().Add(time.Hour), Category: category,
+		}))
+	}
+	create("to-dana", 1, dana.ID, "")
+	create("from-dana", dana.ID, 1, "")
+	create("vpn-to-recipient", 1, 2, "vpn")
+	// Dana and the recipient talk about the VPN; the caller is not a party
+	create("dana-vpn", dana.ID, 2, "vpn")
+
+	router := gin.New()
+	router.Use(authAs(1))
+	router.GET("/history", api.NewHistoryHandler(metadataStore, fakes.NewStorage(), nil).GetMyHistory)
+	search := func(q string) []string {
+		req, _ := http.NewRequest("GET", "/history?q="+q, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var history []models.MessageHistoryResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+		ids := []string{}
+		for _, h := range history {
+			ids = append(ids, h.MessageID)
+		}
+		return ids
+	}
+
+	assert.ElementsMatch(t, []string{"to-dana", "from-dana"}, search("dana"))
+	assert.ElementsMatch(t, []string{"to-dana", "from-dana"}, search("SCULLY"))
+	assert.ElementsMatch(t, []string{"vpn-to-recipient"}, search("VPN"), "only the caller's own messages")
+	assert.ElementsMatch(t, []string{"vpn-to-recipient"}, search("recipient%40example"))
+	// The caller's own name is not the counterpart
+	assert.Empty(t, search("sender"))
+	assert.Len(t, search("+"), 3, "a blank search lists everything")
+
+	req, _ := http.NewRequest("GET", "/history?q="+strings.Repeat("x", 101), nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+// pageThrough follows next_cursor from an empty cursor to the last page and
+// returns the message IDs in the order served
+func pageThrough(t *testing.T, router *gin.Engine, path string) []string {
+	t.Helper()
+	var ids []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 100, "paging never ends")
+		req, _ := http.NewRequest("GET", path+"&cursor="+cursor, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var page struct {
+			Messages []struct {
+				MessageID string `json:"message_id"`
+			} `json:"messages"`
+			NextCursor string `json:"next_cursor"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		for _, m := range page.Messages {
+			ids = append(ids, m.MessageID)
+		}
+		if page.NextCursor == "" {
+			return ids
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// assertEachOnce checks that every ID of want was served exactly once
+func assertEachOnce(t *testing.T, want, served []string) {
+	t.Helper()
+	seen := map[string]int{}
+	for _, id := range served {
+		seen[id]++
+	}
+	for id, n := range seen {
+		assert.Equal(t, 1, n, "%s served %d times", id, n)
+	}
+	for _, id := range want {
+		assert.Contains(t, seen, id, "%s skipped", id)
+	}
+}
+
+func TestListings_CursorPagingWhileMessagesArrive(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	metadataStore := fakes.NewMetadataStore(seedUsers(t))
+
+	// Five messages share each timestamp, so pages split ties
+	base := time.Now().UTC().Truncate(time.Second)
+	var initial []string
+	for i := 0; i < 95; i++ {
+		id := fmt.Sprintf("initial-%02d", i)
+		at := base.Add(-time.Duration(i/5) * time.Minute)
+		require.NoError(t, metadataStore.Create(ctx, &models.MessageMetadata{
+			MessageID: id, SenderID: 1, RecipientID: 2, Status: models.StatusPending,
+			CreatedAt: at, ExpiresAt: at.Add(2 * time.Hour),
+		}))
+		initial = append(initial, id)
+	}
+
+	handler := api.NewHistoryHandler(metadataStore, fakes.NewStorage(), nil)
+	router := gin.New()
+	router.Use(authAs(2))
+	router.GET("/history", handler.GetMyHistory)
+	router.GET("/inbox", handler.GetInbox)
+
+	for k, path := range []string{"/history?limit=10", "/inbox?limit=10"} {
+		t.Run(path, func(t *testing.T) {
+			stop := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; ; i++ {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					now := time.Now().UTC()
+					_ = metadataStore.Create(ctx, &models.MessageMetadata{
+						MessageID: fmt.Sprintf("arriving-%d-%d", k, i), SenderID: 1, RecipientID: 2,
+						Status: models.StatusPending, CreatedAt: now, ExpiresAt: now.Add(3 * time.Hour),
+					})
+					time.Sleep(100 * time.Microsecond)
+				}
+			}()
+			served := pageThrough(t, router, path)
+			close(stop)
+			<-done
+
+			assertEachOnce(t, initial, served)
+		})
+	}
+}
+
+func TestListings_PageParameters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	metadataStore := fakes.NewMetadataStore(seedUsers(t))
+	for _, id := range []string{"a", "b", "c"} {
+		seedMessage(t, metadataStore, id, 1, 2)
+	}
+	handler := api.NewHistoryHandler(metadataStore, fakes.NewStorage(), nil)
+	router := gin.New()
+	router.Use(authAs(2))
+	router.GET("/history", handler.GetMyHistory)
+	router.GET("/inbox", handler.GetInbox)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Limit and offset still page the bare array
+	w := get("/history?limit=2&offset=2")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var history []models.MessageHistoryResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	assert.Len(t, history, 1)
+
+	w = get("/inbox?cursor=")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var inbox models.InboxPage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &inbox))
+	assert.Len(t, inbox.Messages, 3)
+	assert.Empty(t, inbox.NextCursor, "a short page is the last")
+
+	for _, path := range []string{
+		"/history?cursor=not-a-cursor",
+		"/inbox?cursor=" + base64.RawURLEncoding.EncodeToString([]byte("yesterday,1")),
+		"/history?limit=0",
+		"/inbox?limit=201",
+		"/history?offset=-1",
+		"/history?offset=5&cursor=" + models.Cursor{Time: time.Now(), ID: 1}.Encode(),
+	} {
+		w := get(path)
+		assert.Equal(t, http.StatusBadRequest, w.Code, path)
+		var resp models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Equal(t, models.ErrorCodeInvalidRequest, resp.Code, path)
+	}
+}
@@ -0,0 +1,91 @@
+package unit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/httpclient"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPClient_EnforcesTimeoutAndRecordsErrors(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	metrics := httpclient.NewMetrics()
+	client, err := httpclient.New(httpclient.Options{Timeout: 50 * time.Millisecond, Metrics: metrics})
+	require.NoError(t, err)
+
+	start := time.Now()
+	_, err = client.Get(slow.URL)
+	require.Error(t, err)
+	assert.Less(t, time.Since(start), time.Second, "the timeout cuts the request short")
+
+	host := mustHost(t, slow.URL)
+	stats := metrics.Snapshot()[host]
+	assert.Equal(t, int64(1), stats.Requests)
+	assert.Equal(t, int64(1), stats.Errors)
+	assert.GreaterOrEqual(t, stats.MaxLatency, 50*time.Millisecond)
+}
+
+func TestHTTPClient_RecordsLatencyAndForwardsRequestID(t *testing.T) {
+	var gotID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotID = r.Header.Get(requestid.Header)
+		time.Sleep(20 * time.Millisecond)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	metrics := httpclient.NewMetrics()
+	client, err := httpclient.New(httpclient.Options{Metrics: metrics})
+	require.NoError(t, err)
+
+	ctx := requestid.NewContext(context.Background(), "req-123")
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/ok", nil)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, "req-123", gotID)
+	assert.Empty(t, req.Header.Get(requestid.Header), "the caller's request is not modified")
+
+	resp, err = client.Get(server.URL + "/fail")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	stats := metrics.Snapshot()[mustHost(t, server.URL)]
+	assert.Equal(t, int64(2), stats.Requests)
+	assert.Equal(t, int64(1), stats.Errors, "5xx responses count as errors")
+	assert.GreaterOrEqual(t, stats.MeanLatency(), 20*time.Millisecond)
+}
+
+func TestHTTPClient_ValidatesProxy(t *testing.T) {
+	assert.NoError(t, httpclient.ValidateProxy(""))
+	assert.NoError(t, httpclient.ValidateProxy("http://proxy.corp:3128"))
+	assert.Error(t, httpclient.ValidateProxy("proxy.corp:3128"))
+
+	_, err := httpclient.New(httpclient.Options{Proxy: "://bad"})
+	assert.Error(t, err)
+}
+
+func mustHost(t *testing.T, rawURL string) string {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	return u.Host
+}
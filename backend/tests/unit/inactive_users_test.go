@@ -0,0 +1,137 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInactiveSince_Boundaries(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	cutoff := models.InactiveCutoff(90, now)
+	assert.Equal(t, time.Date(2025, 3, 3, 12, 0, 0, 0, time.UTC), cutoff)
+
+	at := func(t time.Time) *models.User { return &models.User{LastLogin: &t} }
+	assert.True(t, (&models.User{}).InactiveSince(cutoff), "never signed in")
+	assert.True(t, at(cutoff.Add(-time.Nanosecond)).InactiveSince(cutoff))
+	assert.False(t, at(cutoff).InactiveSince(cutoff), "exactly 90 days ago is not beyond the threshold")
+	assert.False(t, at(now).InactiveSince(cutoff))
+}
+
+type userListing struct {
+	InactiveDays int                `json:"inactive_days"`
+	Users        []models.AdminUser `json:"users"`
+}
+
+func listedIDs(t *testing.T, body []byte) []int64 {
+	t.Helper()
+	var listing userListing
+	require.NoError(t, json.Unmarshal(body, &listing))
+	ids := []int64{}
+	for _, u := range listing.Users {
+		ids = append(ids, u.ID)
+	}
+	return ids
+}
+
+func TestAdminInactiveUsers(t *testing.T) {
+	call, deps, adminToken := emailRouter(t)
+	ctx := context.Background()
+	users := deps.UserStore.(*fakes.UserStore)
+	admin, err := users.FindByEmail(ctx, "admin@example.com")
+	require.NoError(t, err)
+
+	seed := func(email string, lastLogin time.Duration) *models.User {
+		user := &models.User{Email: email, Name: email}
+		if lastLogin > 0 {
+			at := time.Now().Add(-lastLogin)
+			user.LastLogin = &at
+		}
+		users.Seed(user)
+		return user
+	}
+	day := 24 * time.Hour
+	recent := seed("recent@corp.com", 90*day-time.Hour) // inside the threshold
+	stale := seed("stale@corp.com", 90*day+time.Hour)   // just beyond it
+	never := seed("never@corp.com", 0)
+	gone := seed("gone@corp.com", 200*day)
+	gone.IsActive = false
+	require.NoError(t, users.Update(ctx, gone))
+
+	// The admin has a token but never signed in, so counts as inactive too
+	w := call("GET", "/api/v1/admin/users", adminToken, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []int64{admin.ID, recent.ID, stale.ID, never.ID, gone.ID}, listedIDs(t, w.Body.Bytes()))
+	assert.Contains(t, w.Body.String(), `"last_login_at":null`)
+
+	w = call("GET", "/api/v1/admin/users?inactive_days=90", adminToken, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []int64{admin.ID, stale.ID, never.ID, gone.ID}, listedIDs(t, w.Body.Bytes()))
+
+	w = call("GET", "/api/v1/admin/users?inactive_days=91", adminToken, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []int64{admin.ID, never.ID, gone.ID}, listedIDs(t, w.Body.Bytes()))
+
+	// Only active accounts are candidates, 90 days by default
+	w = call("GET", "/api/v1/admin/users/inactive", adminToken, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var listing userListing
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listing))
+	assert.Equal(t, 90, listing.InactiveDays)
+	assert.Equal(t, []int64{admin.ID, stale.ID, never.ID}, listedIDs(t, w.Body.Bytes()))
+
+	w = call("GET", "/api/v1/admin/users/inactive?inactive_days=89", adminToken, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, []int64{admin.ID, recent.ID, stale.ID, never.ID}, listedIDs(t, w.Body.Bytes()))
+
+	for _, days := range []string{"0", "-1", "3651", "ninety"} {
+		w = call("GET", "/api/v1/admin/users/inactive?inactive_days="+days, adminToken, "")
+		assert.Equal(t, http.StatusBadRequest, w.Code, days)
+	}
+}
+
+func TestAdminDeactivateInactiveUsers(t *testing.T) {
+	call, deps, adminToken := emailRouter(t)
+	ctx := context.Background()
+	users := deps.UserStore.(*fakes.UserStore)
+	admin, err := users.FindByEmail(ctx, "admin@example.com")
+	require.NoError(t, err)
+
+	recentAt := time.Now().Add(-10 * 24 * time.Hour)
+	recent := &models.User{Email: "recent@corp.com", Name: "Recent", LastLogin: &recentAt}
+	users.Seed(recent)
+	never := &models.User{Email: "never@corp.com", Name: "Never"}
+	users.Seed(never)
+
+	// The caller, an account that signed in since it was listed and an
+	// unknown ID are skipped
+	body := fmt.Sprintf(`{"inactive_days":30,"user_ids":[%d,%d,%d,%d,9999]}`, never.ID, never.ID, recent.ID, admin.ID)
+	w := call("POST", "/api/v1/admin/users/inactive/deactivate", adminToken, body)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp models.DeactivateInactiveResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []int64{never.ID}, resp.Deactivated)
+	assert.Equal(t, []int64{never.ID, recent.ID, admin.ID, 9999}, resp.Skipped)
+
+	stored, err := users.FindByID(ctx, never.ID)
+	require.NoError(t, err)
+	assert.False(t, stored.IsActive)
+	for _, id := range []int64{recent.ID, admin.ID} {
+		stored, err = users.FindByID(ctx, id)
+		require.NoError(t, err)
+		assert.True(t, stored.IsActive)
+	}
+
+	w = call("POST", "/api/v1/admin/users/inactive/deactivate", adminToken, `{"user_ids":[1]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = call("POST", "/api/v1/admin/users/inactive/deactivate", adminToken, `{"inactive_days":30,"user_ids":[]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,150 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageJanitor_ReconcilesDriftedExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := fakes.NewStorage()
+	metadataStore := fakes.NewMetadataStore(nil)
+
+	// Redis expires this one in ten minutes, the metadata says an hour
+	drifted, err := store.Store(ctx, &models.Message{Ciphertext: "c", IV: "iv"}, 10*time.Minute)
+	require.NoError(t, err)
+	seedMessage(t, metadataStore, drifted, 1, 2)
+
+	// Within the tolerance, so left alone
+	inSync, err := store.Store(ctx, &models.Message{Ciphertext: "c", IV: "iv"}, time.Hour+30*time.Second)
+	require.NoError(t, err)
+	seedMessage(t, metadataStore, inSync, 1, 2)
+	before, err := metadataStore.FindByMessageID(ctx, inSync)
+	require.NoError(t, err)
+
+	// Long past its expiry and gone from Redis
+	require.NoError(t, metadataStore.Create(ctx, &models.MessageMetadata{
+		MessageID:   "stale",
+		SenderID:    1,
+		RecipientID: 2,
+		Status:      models.StatusPending,
+		CreatedAt:   time.Now().Add(-2 * time.Hour),
+		ExpiresAt:   time.Now().Add(-time.Hour),
+	}))
+
+	api.NewMessageJanitor(metadataStore, store, nil, 0).Sweep(ctx)
+
+	m, err := metadataStore.FindByMessageID(ctx, drifted)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), m.ExpiresAt, 5*time.Second)
+
+	m, err = metadataStore.FindByMessageID(ctx, inSync)
+	require.NoError(t, err)
+	assert.Equal(t, before.ExpiresAt, m.ExpiresAt)
+
+	m, err = metadataStore.FindByMessageID(ctx, "stale")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusExpired, m.Status)
+}
+
+// seedOverdue adds pending metadata that expired an hour ago
+func seedOverdue(t *testing.T, metadataStore *fakes.MetadataStore, id string) {
+	t.Helper()
+	require.NoError(t, metadataStore.Create(context.Background(), &models.MessageMetadata{
+		MessageID:   id,
+		SenderID:    1,
+		RecipientID: 2,
+		Status:      models.StatusPending,
+		CreatedAt:   time.Now().Add(-2 * time.Hour),
+		ExpiresAt:   time.Now().Add(-time.Hour),
+	}))
+}
+
+func runCleanup(t *testing.T, router *gin.Engine) models.CleanupReport {
+	t.Helper()
+	req, _ := http.NewRequest("POST", "/admin/cleanup", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var report models.CleanupReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	return report
+}
+
+func cleanupRouter(metadataStore *fakes.MetadataStore, store *fakes.Storage) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	handler := api.NewAdminHandler(metadataStore.Users, metadataStore, store, nil, &config.Config{}, nil, nil)
+	router := gin.New()
+	router.POST("/admin/cleanup", handler.CleanupExpired)
+	return router
+}
+
+func TestCleanupExpired_DeletesLingeringPayloads(t *testing.T) {
+	ctx := context.Background()
+	store := fakes.NewStorage()
+	metadataStore := fakes.NewMetadataStore(nil)
+
+	// The metadata expired but the Redis TTL outlived it
+	lingering, err := store.Store(ctx, &models.Message{Ciphertext: "c", IV: "iv"}, time.Hour)
+	require.NoError(t, err)
+	seedOverdue(t, metadataStore, lingering)
+
+	// Expired and already gone from Redis, more than one delete batch
+	for i := 0; i < 120; i++ {
+		seedOverdue(t, metadataStore, fmt.Sprintf("gone-%d", i))
+	}
+
+	// Not expired, so neither marked nor deleted
+	live, err := store.Store(ctx, &models.Message{Ciphertext: "c", IV: "iv"}, time.Hour)
+	require.NoError(t, err)
+	seedMessage(t, metadataStore, live, 1, 2)
+
+	router := cleanupRouter(metadataStore, store)
+	report := runCleanup(t, router)
+	assert.Equal(t, models.CleanupReport{ExpiredMetadata: 121, RedisDeleted: 1, RedisMissing: 120}, report)
+
+	exists, err := store.Exists(ctx, lingering)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	exists, err = store.Exists(ctx, live)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	m, err := metadataStore.FindByMessageID(ctx, live)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusPending, m.Status)
+
+	// Nothing left to do
+	assert.Equal(t, models.CleanupReport{}, runCleanup(t, router))
+}
+
+func TestCleanupExpired_CountsRedisErrors(t *testing.T) {
+	ctx := context.Background()
+	store := fakes.NewStorage()
+	metadataStore := fakes.NewMetadataStore(nil)
+	id, err := store.Store(ctx, &models.Message{Ciphertext: "c", IV: "iv"}, time.Hour)
+	require.NoError(t, err)
+	seedOverdue(t, metadataStore, id)
+	seedOverdue(t, metadataStore, "gone")
+	store.DeleteErr = errors.New("connection refused")
+
+	report := runCleanup(t, cleanupRouter(metadataStore, store))
+	assert.Equal(t, models.CleanupReport{ExpiredMetadata: 2, Errors: 2}, report)
+
+	m, err := metadataStore.FindByMessageID(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusExpired, m.Status, "the metadata is expired even when Redis fails")
+}
@@ -1,6 +1,8 @@
 package unit
 
 import (
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -90,3 +92,50 @@ func TestJWTManager_Verify_PreservesUserData(t *testing.T) {
 		assert.Equal(t, tc.email, claims.Email)
 	}
 }
+
+func TestJWTManager_MessageAccess(t *testing.T) {
+	manager := auth.NewJWTManager("test-secret-key", 24*time.Hour)
+	token := manager.SignMessageAccess("msg-1", time.Now().Add(time.Hour))
+
+	assert.NoError(t, manager.VerifyMessageAccess("msg-1", token))
+	assert.ErrorIs(t, manager.VerifyMessageAccess("msg-2", token), auth.ErrInvalidToken, "bound to the message")
+	assert.ErrorIs(t, auth.NewJWTManager("other-secret", time.Hour).VerifyMessageAccess("msg-1", token), auth.ErrInvalidToken)
+
+	// A session JWT is no access token, nor the other way round
+	jwt, err := manager.Generate(1, "test@example.com")
+	require.NoError(t, err)
+	assert.ErrorIs(t, manager.VerifyMessageAccess("msg-1", jwt), auth.ErrInvalidToken)
+	_, err = manager.Verify(token)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+}
+
+func TestJWTManager_MessageAccess_Tampered(t *testing.T) {
+	manager := auth.NewJWTManager("test-secret-key", 24*time.Hour)
+	token := manager.SignMessageAccess("msg-1", time.Now().Add(time.Hour))
+	expiry, mac, _ := strings.Cut(token, ".")
+
+	later, err := strconv.ParseInt(expiry, 10, 64)
+	require.NoError(t, err)
+	flipped := []byte(mac)
+	flipped[0] ^= 1
+
+	for name, tampered := range map[string]string{
+		"extended expiry": strconv.FormatInt(later+86400, 10) + "." + mac,
+		"flipped mac":     expiry + "." + string(flipped),
+		"truncated mac":   expiry + "." + mac[:len(mac)-4],
+		"no mac":          expiry,
+		"not a number":    "soon." + mac,
+		"empty":           "",
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.ErrorIs(t, manager.VerifyMessageAccess("msg-1", tampered), auth.ErrInvalidToken)
+		})
+	}
+}
+
+func TestJWTManager_MessageAccess_Expired(t *testing.T) {
+	manager := auth.NewJWTManager("test-secret-key", 24*time.Hour)
+	token := manager.SignMessageAccess("msg-1", time.Now().Add(-time.Second))
+
+	assert.ErrorIs(t, manager.VerifyMessageAccess("msg-1", token), auth.ErrExpiredToken)
+}
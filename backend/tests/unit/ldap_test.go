@@ -0,0 +1,291 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/auth/ldap"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	ldapServiceDN  = "cn=vanish,ou=services,dc=example,dc=com"
+	ldapAdminGroup = "cn=vanish-admins,ou=groups,dc=example,dc=com"
+)
+
+// startDirectory serves a directory with a search account, Alice, who is in
+// the admin group, and Bob, who is not
+func startDirectory(t *testing.T) *fakes.LDAPDirectory {
+	t.Helper()
+	dir, err := fakes.NewLDAPDirectory(
+		fakes.LDAPEntry{DN: ldapServiceDN, Password: "service-secret"},
+		fakes.LDAPEntry{
+			DN:       "uid=alice,ou=people,dc=example,dc=com",
+			Password: "alice-secret",
+			Attributes: map[string][]string{
+				"mail":     {"Alice@Example.com"},
+				"cn":       {"Alice Example"},
+				"memberOf": {"CN=Vanish-Admins, OU=Groups, DC=example, DC=com", "cn=staff,ou=groups,dc=example,dc=com"},
+			},
+		},
+		fakes.LDAPEntry{
+			DN:       "uid=bob,ou=people,dc=example,dc=com",
+			Password: "bob-secret",
+			Attributes: map[string][]string{
+				"mail":     {"bob@example.com"},
+				"cn":       {"Bob Example"},
+				"memberOf": {"cn=staff,ou=groups,dc=example,dc=com"},
+			},
+		},
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { dir.Close() })
+	return dir
+}
+
+func searchConfig(dir *fakes.LDAPDirectory) ldap.Config {
+	return ldap.Config{
+		URL:          dir.URL,
+		BindDN:       ldapServiceDN,
+		BindPassword: "service-secret",
+		SearchBase:   "ou=people,dc=example,dc=com",
+		AdminGroupDN: ldapAdminGroup,
+	}
+}
+
+func TestLDAPAuthenticate_Search(t *testing.T) {
+	dir := startDirectory(t)
+	authenticator, err := ldap.New(searchConfig(dir))
+	require.NoError(t, err)
+
+	identity, err := authenticator.Authenticate("alice@example.com", "alice-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "uid=alice,ou=people,dc=example,dc=com", identity.DN)
+	assert.Equal(t, "alice@example.com", identity.Email, "emails are lowercased")
+	assert.Equal(t, "Alice Example", identity.Name)
+	assert.True(t, identity.IsAdmin, "group DNs compare like the directory does")
+	assert.Equal(t, []string{ldapServiceDN, identity.DN}, dir.Binds())
+
+	identity, err = authenticator.Authenticate("bob@example.com", "bob-secret")
+	require.NoError(t, err)
+	assert.False(t, identity.IsAdmin)
+}
+
+func TestLDAPAuthenticate_DirectBind(t *testing.T) {
+	dir := startDirectory(t)
+	authenticator, err := ldap.New(ldap.Config{
+		URL:            dir.URL,
+		UserDNTemplate: "uid=%s,ou=people,dc=example,dc=com",
+		AdminGroupDN:   ldapAdminGroup,
+	})
+	require.NoError(t, err)
+
+	identity, err := authenticator.Authenticate("alice", "alice-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", identity.Email)
+	assert.True(t, identity.IsAdmin)
+	assert.Equal(t, []string{"uid=alice,ou=people,dc=example,dc=com"}, dir.Binds(), "no search account is needed")
+
+	_, err = authenticator.Authenticate("alice", "wrong")
+	assert.ErrorIs(t, err, ldap.ErrInvalidCredentials)
+}
+
+func TestLDAPAuthenticate_Rejections(t *testing.T) {
+	dir := startDirectory(t)
+	authenticator, err := ldap.New(searchConfig(dir))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		login    string
+		password string
+	}{
+		{"wrong password", "alice@example.com", "wrong"},
+		{"empty password", "alice@example.com", ""},
+		{"unknown user", "carol@example.com", "alice-secret"},
+		{"filter injection", "*)(mail=*", "alice-secret"},
+		{"search account", "cn=vanish", "service-secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := authenticator.Authenticate(tt.login, tt.password)
+			assert.ErrorIs(t, err, ldap.ErrInvalidCredentials)
+		})
+	}
+
+	// A broken search account is a configuration fault, not bad credentials
+	cfg := searchConfig(dir)
+	cfg.BindPassword = "wrong"
+	authenticator, err = ldap.New(cfg)
+	require.NoError(t, err)
+	_, err = authenticator.Authenticate("alice@example.com", "alice-secret")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ldap.ErrInvalidCredentials)
+}
+
+func TestLDAPNew_Validation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  ldap.Config
+	}{
+		{"missing URL", ldap.Config{SearchBase: "dc=example,dc=com"}},
+		{"http URL", ldap.Config{URL: "http://ldap.example.com", SearchBase: "dc=example,dc=com"}},
+		{"no way to find users", ldap.Config{URL: "ldap://ldap.example.com"}},
+		{"template without placeholder", ldap.Config{URL: "ldap://ldap.example.com", UserDNTemplate: "uid=alice,dc=example,dc=com"}},
+		{"filter without placeholder", ldap.Config{URL: "ldap://ldap.example.com", SearchBase: "dc=example,dc=com", UserFilter: "(mail=alice)"}},
+		{"StartTLS over ldaps", ldap.Config{URL: "ldaps://ldap.example.com", StartTLS: true, SearchBase: "dc=example,dc=com"}},
+		{"missing CA file", ldap.Config{URL: "ldaps://ldap.example.com", SearchBase: "dc=example,dc=com", CACertFile: "/nonexistent/ca.pem"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ldap.New(tt.cfg)
+			assert.Error(t, err)
+		})
+	}
+}
+
+// ldapRouter returns a router with LDAP sign-in against dir, a local account
+// user@example.com and a local admin admin@example.com, both with
+// password123
+func ldapRouter(t *testing.T, dir *fakes.LDAPDirectory) (call apiCall, deps api.Dependencies) {
+	t.Helper()
+	deps = testDependencies()
+	if dir != nil {
+		deps.Config.LDAP = config.LDAPConfig{
+			Enabled:      true,
+			URL:          dir.URL,
+			BindDN:       ldapServiceDN,
+			BindPassword: "service-secret",
+			SearchBase:   "ou=people,dc=example,dc=com",
+			AdminGroupDN: ldapAdminGroup,
+		}
+	}
+	hashed, err := models.HashPassword("password123")
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, deps.UserStore.Create(ctx, &models.User{Email: "admin@example.com", Name: "Admin", Password: hashed, IsAdmin: true}))
+	require.NoError(t, deps.UserStore.Create(ctx, &models.User{Email: "user@example.com", Name: "User", Password: hashed}))
+
+	return apiRouter(t, deps), deps
+}
+
+func ldapLogin(t *testing.T, call apiCall, email, password string) models.AuthResponse {
+	t.Helper()
+	w := call("POST", "/api/v1/auth/login", "", `{"email":"`+email+`","password":"`+password+`"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp models.AuthResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	return resp
+}
+
+func TestLogin_LDAPCreatesAccount(t *testing.T) {
+	call, deps := ldapRouter(t, startDirectory(t))
+
+	resp := ldapLogin(t, call, "alice@example.com", "alice-secret")
+	assert.NotEmpty(t, resp.Token)
+	assert.Equal(t, "Alice Example", resp.User.Name)
+	assert.True(t, resp.User.IsAdmin, "member of the admin group")
+
+	user, err := deps.UserStore.FindByEmail(context.Background(), "alice@example.com")
+	require.NoError(t, err)
+	assert.Equal(t, models.AuthSourceLDAP, user.AuthSource)
+	assert.Empty(t, user.Password, "directory passwords are never stored")
+
+	// Later sign-ins use the same account
+	again := ldapLogin(t, call, "alice@example.com", "alice-secret")
+	assert.Equal(t, resp.User.ID, again.User.ID)
+
+	w := call("GET", "/api/v1/auth/me", resp.Token, "")
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestLogin_LDAPWrongPassword(t *testing.T) {
+	call, deps := ldapRouter(t, startDirectory(t))
+
+	w := call("POST", "/api/v1/auth/login", "", `{"email":"alice@example.com","password":"wrong"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), models.ErrorCodeInvalidCredentials)
+
+	_, err := deps.UserStore.FindByEmail(context.Background(), "alice@example.com")
+	assert.ErrorIs(t, err, models.ErrInvalidCredentials, "no account is created")
+}
+
+func TestLogin_LDAPGroupMapping(t *testing.T) {
+	call, deps := ldapRouter(t, startDirectory(t))
+	ctx := context.Background()
+
+	// Bob was an admin when he last signed in but has left the group
+	bob := &models.User{Email: "bob@example.com", Name: "Bob", IsAdmin: true, AuthSource: models.AuthSourceLDAP}
+	require.NoError(t, deps.UserStore.Create(ctx, bob))
+
+	resp := ldapLogin(t, call, "bob@example.com", "bob-secret")
+	assert.Equal(t, bob.ID, resp.User.ID)
+	assert.False(t, resp.User.IsAdmin)
+	assert.Equal(t, "Bob Example", resp.User.Name, "the name follows the directory")
+
+	stored, err := deps.UserStore.FindByID(ctx, bob.ID)
+	require.NoError(t, err)
+	assert.False(t, stored.IsAdmin)
+}
+
+func TestLogin_LDAPLeavesLocalAccountsAlone(t *testing.T) {
+	dir := startDirectory(t)
+	call, deps := ldapRouter(t, dir)
+
+	// Local accounts sign in with their own password without asking the directory
+	ldapLogin(t, call, "user@example.com", "password123")
+	assert.Empty(t, dir.Binds())
+
+	// A local account sharing an email with a directory user is not
+	// reachable with the directory password
+	hashed, err := models.HashPassword("local-password")
+	require.NoError(t, err)
+	require.NoError(t, deps.UserStore.Create(context.Background(), &models.User{Email: "bob@example.com", Name: "Local Bob", Password: hashed}))
+	w := call("POST", "/api/v1/auth/login", "", `{"email":"bob@example.com","password":"bob-secret"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	ldapLogin(t, call, "bob@example.com", "local-password")
+}
+
+func TestLogin_LDAPDirectoryUnavailable(t *testing.T) {
+	dir := startDirectory(t)
+	call, _ := ldapRouter(t, dir)
+	require.NoError(t, dir.Close())
+
+	w := call("POST", "/api/v1/auth/login", "", `{"email":"alice@example.com","password":"alice-secret"}`)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), models.ErrorCodeUpstreamFailed)
+}
+
+func TestLogin_LDAPAccountWithDirectoryDisabled(t *testing.T) {
+	call, deps := ldapRouter(t, nil)
+	require.NoError(t, deps.UserStore.Create(context.Background(),
+		&models.User{Email: "alice@example.com", Name: "Alice", AuthSource: models.AuthSourceLDAP}))
+
+	w := call("POST", "/api/v1/auth/login", "", `{"email":"alice@example.com","password":"alice-secret"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestLDAPAccount_PasswordChangeRefused(t *testing.T) {
+	call, _ := ldapRouter(t, startDirectory(t))
+	alice := ldapLogin(t, call, "alice@example.com", "alice-secret")
+	bob := ldapLogin(t, call, "bob@example.com", "bob-secret")
+
+	w := call("POST", "/api/v1/profile/password", bob.Token, `{"current_password":"bob-secret","new_password":"new-password"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), models.ErrorCodePasswordManaged)
+
+	// Nor can an admin reset it
+	w = call("PUT", "/api/v1/admin/users/"+strconv.FormatInt(bob.User.ID, 10), alice.Token, `{"password":"new-password"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), models.ErrorCodePasswordManaged)
+
+	ldapLogin(t, call, "bob@example.com", "bob-secret")
+}
@@ -0,0 +1,194 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/lifecycle"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recorder collects start/stop events from fake components in order
+type recorder struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (r *recorder) add(event string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recorder) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.events...)
+}
+
+// fakeComponent records its calls and can be told to fail or hang
+type fakeComponent struct {
+	name     string
+	rec      *recorder
+	startErr error
+	hangStop bool
+}
+
+func (f *fakeComponent) Name() string { return f.name }
+
+func (f *fakeComponent) Start(ctx context.Context) error {
+	if f.startErr != nil {
+		return f.startErr
+	}
+	f.rec.add("start " + f.name)
+	return nil
+}
+
+func (f *fakeComponent) Stop(ctx context.Context) error {
+	if f.hangStop {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	f.rec.add("stop " + f.name)
+	return nil
+}
+
+func TestLifecycle_StartsInOrderStopsInReverse(t *testing.T) {
+	rec := &recorder{}
+	m := lifecycle.NewManager()
+	for _, name := range []string{"queue", "janitor", "http"} {
+		m.Register(&fakeComponent{name: name, rec: rec})
+	}
+
+	require.NoError(t, m.Start(context.Background()))
+	require.NoError(t, m.Stop(context.Background()))
+
+	assert.Equal(t, []string{
+		"start queue", "start janitor", "start http",
+		"stop http", "stop janitor", "stop queue",
+	}, rec.list())
+}
+
+func TestLifecycle_FailedStartStopsStartedComponents(t *testing.T) {
+	rec := &recorder{}
+	m := lifecycle.NewManager()
+	m.Register(&fakeComponent{name: "queue", rec: rec})
+	m.Register(&fakeComponent{name: "http", rec: rec, startErr: errors.New("address in use")})
+
+	err := m.Start(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "http")
+
+	assert.Equal(t, []string{"start queue", "stop queue"}, rec.list())
+}
+
+func TestLifecycle_ReportsComponentsThatMissTheDeadline(t *testing.T) {
+	rec := &recorder{}
+	m := lifecycle.NewManager()
+	m.Register(&fakeComponent{name: "queue", rec: rec})
+	m.Register(&fakeComponent{name: "stuck", rec: rec, hangStop: true})
+
+	require.NoError(t, m.Start(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := m.Stop(ctx)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stuck")
+	assert.NotContains(t, err.Error(), "queue")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestLifecycle_WorkerStopsOnCancel(t *testing.T) {
+	ticks := make(chan struct{}, 100)
+	exited := make(chan struct{})
+	w := lifecycle.Worker("janitor", func(ctx context.Context) {
+		defer close(exited)
+		lifecycle.Every(5*time.Millisecond, func(context.Context) {
+			ticks <- struct{}{}
+		})(ctx)
+	})
+
+	m := lifecycle.NewManager()
+	m.Register(w)
+	require.NoError(t, m.Start(context.Background()))
+
+	select {
+	case <-ticks:
+	case <-time.After(time.Second):
+		t.Fatal("worker never ran")
+	}
+
+	require.NoError(t, m.Stop(context.Background()))
+	select {
+	case <-exited:
+	default:
+		t.Fatal("Stop returned before the worker exited")
+	}
+}
+
+func TestLifecycle_WorkerThatIgnoresCancelFailsToStop(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	m := lifecycle.NewManager()
+	m.Register(lifecycle.Worker("stubborn", func(context.Context) { <-release }))
+	require.NoError(t, m.Start(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := m.Stop(ctx)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stubborn")
+}
+
+func TestLifecycle_HTTPServerDrainsBeforeWorkersStop(t *testing.T) {
+	rec := &recorder{}
+	inFlight := make(chan struct{})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(inFlight)
+		time.Sleep(100 * time.Millisecond)
+		rec.add("request done")
+		w.WriteHeader(http.StatusOK)
+	})
+	addr := freeAddr(t)
+	server := &http.Server{Addr: addr, Handler: handler}
+
+	m := lifecycle.NewManager()
+	m.Register(&fakeComponent{name: "queue", rec: rec})
+	m.Register(lifecycle.HTTPServer("http", server, false))
+	require.NoError(t, m.Start(context.Background()))
+
+	go http.Get("http://" + addr + "/")
+	<-inFlight
+
+	require.NoError(t, m.Stop(context.Background()))
+	assert.Equal(t, []string{"start queue", "request done", "stop queue"}, rec.list())
+}
+
+// freeAddr returns a loopback address with a currently unused port
+func freeAddr(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestLifecycle_HTTPServerStartFailsOnBadAddress(t *testing.T) {
+	m := lifecycle.NewManager()
+	m.Register(lifecycle.HTTPServer("http", &http.Server{Addr: "256.0.0.1:0"}, false))
+
+	err := m.Start(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to start http")
+}
@@ -0,0 +1,445 @@
+package unit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/messages"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/storage"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var servicePayload = messages.Payload{Ciphertext: "ciphertext", IV: "iv"}
+
+// newMessageService returns a service over fakes; user 1 sends, user 2
+// receives
+func newMessageService(t *testing.T, maxPending int) (*messages.Service, *fakes.Storage, *fakes.MetadataStore) {
+	store := fakes.NewStorage()
+	metadata := fakes.NewMetadataStore(seedUsers(t))
+	return messages.NewService(store, metadata, maxPending, nil, nil), store, metadata
+}
+
+// assertServiceError checks that err is a messages.Error with code
+func assertServiceError(t *testing.T, err error, code string) {
+	t.Helper()
+	var failure *messages.Error
+	require.True(t, errors.As(err, &failure), "expected a messages.Error, got %v", err)
+	assert.Equal(t, code, failure.Code)
+}
+
+func TestMessageService_Create(t *testing.T) {
+	service, store, metadataRepo := newMessageService(t, 0)
+	ctx := context.Background()
+
+	ttl := int64(3600)
+	metadata, err := service.CreateEncrypted(ctx, 1, 2, servicePayload, &ttl, messages.CreateOptions{EncryptionKey: "key"})
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusPending, metadata.Status)
+	assert.Equal(t, models.SenderTypeUser, metadata.SenderType)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), metadata.ExpiresAt, 5*time.Second)
+
+	stored, err := metadataRepo.FindByMessageID(ctx, metadata.MessageID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stored.RecipientID)
+	key, err := metadataRepo.GetEncryptionKey(ctx, metadata.MessageID)
+	require.NoError(t, err)
+	assert.Equal(t, "key", key)
+
+	exists, err := store.Exists(ctx, metadata.MessageID)
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestMessageService_CreateByIntegration(t *testing.T) {
+	service, _, _ := newMessageService(t, 0)
+
+	metadata, err := service.CreateEncrypted(context.Background(), 1, 2, servicePayload, nil, messages.CreateOptions{Integration: models.IntegrationSlack})
+	require.NoError(t, err)
+	assert.Equal(t, models.SenderTypeIntegration, metadata.SenderType)
+	assert.Equal(t, models.IntegrationSlack, metadata.IntegrationName)
+	assert.WithinDuration(t, time.Now().Add(time.Duration(models.DefaultTTL)*time.Second), metadata.ExpiresAt, 5*time.Second)
+}
+
+func TestMessageService_CreateRejectsInvalidInput(t *testing.T) {
+	service, _, _ := newMessageService(t, 0)
+	ctx := context.Background()
+
+	tooLong := int64(models.MaxTTL + 1)
+	_, err := service.CreateEncrypted(ctx, 1, 2, servicePayload, &tooLong, messages.CreateOptions{})
+	assertServiceError(t, err, models.ErrorCodeTTLOutOfRange)
+
+	past := time.Now().Add(-time.Minute)
+	_, err = service.CreateEncrypted(ctx, 1, 2, servicePayload, nil, messages.CreateOptions{AvailableAt: &past})
+	assertServiceError(t, err, models.ErrorCodeInvalidSchedule)
+}
+
+func TestMessageService_CreateEnforcesQuota(t *testing.T) {
+	service, _, _ := newMessageService(t, 2)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		_, err := service.CreateEncrypted(ctx, 1, 2, servicePayload, nil, messages.CreateOptions{})
+		require.NoError(t, err)
+	}
+
+	_, err := service.CreateEncrypted(ctx, 1, 2, servicePayload, nil, messages.CreateOptions{})
+	assertServiceError(t, err, models.ErrorCodeRecipientInboxFull)
+
+	// The cap is per recipient
+	_, err = service.CreateEncrypted(ctx, 2, 1, servicePayload, nil, messages.CreateOptions{})
+	assert.NoError(t, err)
+}
+
+func TestMessageService_CreateRollsBackWithoutMetadata(t *testing.T) {
+	service, store, metadataRepo := newMessageService(t, 0)
+	ctx := context.Background()
+	metadataRepo.CreateErr = errors.New("database down")
+
+	notified := false
+	_, err := service.CreateEncrypted(ctx, 1, 2, servicePayload, nil, messages.CreateOptions{
+		Notify: func(context.Context, *models.MessageMetadata) error {
+			notified = true
+			return nil
+		},
+	})
+	assertServiceError(t, err, models.ErrorCodeInternal)
+	assert.False(t, notified, "nobody is told about a message that was not created")
+
+	// The payload stored before the metadata failed is gone again
+	metadataRepo.CreateErr = nil
+	metadata, err := service.CreateEncrypted(ctx, 1, 2, servicePayload, nil, messages.CreateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, store.Len(), "only the second message remains")
+	_, err = store.GetAndDelete(ctx, metadata.MessageID)
+	assert.NoError(t, err)
+}
+
+func TestMessageService_CreateRetriesDuplicateIDs(t *testing.T) {
+	service, store, metadataRepo := newMessageService(t, 0)
+	ctx := context.Background()
+
+	// The first ID is taken in Redis, the next by an older message's metadata
+	store.IDCollisions = 1
+	metadataRepo.Collisions = 1
+	metadata, err := service.CreateEncrypted(ctx, 1, 2, servicePayload, nil, messages.CreateOptions{EncryptionKey: "key"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, store.Len(), "the payload stored under the colliding ID is discarded")
+
+	stored, err := metadataRepo.FindByMessageID(ctx, metadata.MessageID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stored.RecipientID)
+	msg, err := store.GetAndDelete(ctx, metadata.MessageID)
+	require.NoError(t, err)
+	assert.Equal(t, "ciphertext", msg.Ciphertext)
+}
+
+func TestMessageService_CreateGivesUpAfterMaxIDAttempts(t *testing.T) {
+	service, store, metadataRepo := newMessageService(t, 0)
+	ctx := context.Background()
+
+	metadataRepo.Collisions = storage.MaxIDAttempts
+	notified := false
+	_, err := service.CreateEncrypted(ctx, 1, 2, servicePayload, nil, messages.CreateOptions{
+		Notify: func(context.Context, *models.MessageMetadata) error {
+			notified = true
+			return nil
+		},
+	})
+	assertServiceError(t, err, models.ErrorCodeInternal)
+	assert.False(t, notified)
+	assert.Equal(t, 0, store.Len(), "no payload is left under any colliding ID")
+	assert.Equal(t, 0, metadataRepo.Collisions, "every attempt got a fresh ID")
+
+	_, err = service.CreateEncrypted(ctx, 1, 2, servicePayload, nil, messages.CreateOptions{})
+	require.NoError(t, err)
+}
+
+func TestMessageService_CreateNotifies(t *testing.T) {
+	service, store, _ := newMessageService(t, 0)
+	ctx := context.Background()
+
+	var notifiedID string
+	metadata, err := service.CreateEncrypted(ctx, 1, 2, servicePayload, nil, messages.CreateOptions{
+		Notify: func(_ context.Context, m *models.MessageMetadata) error {
+			notifiedID = m.MessageID
+			return nil
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, metadata.MessageID, notifiedID)
+
+	// A failed notification keeps the message, which can be shared another way
+	metadata, err = service.CreateEncrypted(ctx, 1, 2, servicePayload, nil, messages.CreateOptions{
+		Notify: func(context.Context, *models.MessageMetadata) error { return errors.New("slack down") },
+	})
+	assert.ErrorIs(t, err, messages.ErrNotifyFailed)
+	require.NotNil(t, metadata)
+	exists, err := store.Exists(ctx, metadata.MessageID)
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestMessageService_Read(t *testing.T) {
+	service, _, metadataRepo := newMessageService(t, 0)
+	ctx := context.Background()
+
+	created, err := service.CreateEncrypted(ctx, 1, 2, servicePayload, nil, messages.CreateOptions{})
+	require.NoError(t, err)
+
+	// Only the recipient may read
+	_, metadata, err := service.Read(ctx, 1, created.MessageID)
+	assertServiceError(t, err, models.ErrorCodeNotRecipient)
+	assert.NotNil(t, metadata, "metadata is returned for the access log")
+
+	msg, _, err := service.Read(ctx, 2, created.MessageID)
+	require.NoError(t, err)
+	assert.Equal(t, servicePayload.Ciphertext, msg.Ciphertext)
+	assert.Equal(t, servicePayload.IV, msg.IV)
+
+	stored, err := metadataRepo.FindByMessageID(ctx, created.MessageID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusRead, stored.Status)
+
+	// Burned on read
+	_, _, err = service.Read(ctx, 2, created.MessageID)
+	assertServiceError(t, err, models.ErrorCodeMessageAlreadyRead)
+}
+
+func TestMessageService_ReadErrors(t *testing.T) {
+	service, _, metadataRepo := newMessageService(t, 0)
+	ctx := context.Background()
+
+	_, _, err := service.Read(ctx, 2, "not an id")
+	assertServiceError(t, err, models.ErrorCodeInvalidMessageID)
+
+	_, metadata, err := service.Read(ctx, 2, "abcdefghijklmnopqrstuvwxyz012345")
+	assertServiceError(t, err, models.ErrorCodeMessageNotFound)
+	assert.Nil(t, metadata)
+
+	// Metadata without a payload: expired in Redis
+	seedMessage(t, metadataRepo, "expiredexpiredexpiredexpiredexpi", 1, 2)
+	_, _, err = service.Read(ctx, 2, "expiredexpiredexpiredexpiredexpi")
+	assertServiceError(t, err, models.ErrorCodeMessageNotFound)
+}
+
+func TestMessageService_Scheduled(t *testing.T) {
+	service, _, _ := newMessageService(t, 0)
+	ctx := context.Background()
+
+	release := time.Now().Add(time.Hour)
+	created, err := service.CreateEncrypted(ctx, 1, 2, servicePayload, nil, messages.CreateOptions{AvailableAt: &release})
+	require.NoError(t, err)
+	require.NotNil(t, created.AvailableAt)
+	assert.WithinDuration(t, release.Add(time.Duration(models.DefaultTTL)*time.Second), created.ExpiresAt, time.Second)
+
+	_, metadata, err := service.Read(ctx, 2, created.MessageID)
+	assertServiceError(t, err, models.ErrorCodeNotYetAvailable)
+	require.NotNil(t, metadata)
+	assert.WithinDuration(t, release, *metadata.AvailableAt, time.Second)
+
+	_, _, _, err = service.Claim(ctx, 2, created.MessageID)
+	assertServiceError(t, err, models.ErrorCodeNotYetAvailable)
+
+	_, _, err = service.Preview(ctx, 2, created.MessageID)
+	assertServiceError(t, err, models.ErrorCodeNotYetAvailable)
+}
+
+func TestMessageService_Claim(t *testing.T) {
+	service, _, metadataRepo := newMessageService(t, 0)
+	ctx := context.Background()
+
+	created, err := service.CreateEncrypted(ctx, 1, 2, servicePayload, nil, messages.CreateOptions{})
+	require.NoError(t, err)
+
+	_, _, _, err = service.Claim(ctx, 1, created.MessageID)
+	assertServiceError(t, err, models.ErrorCodeNotRecipient)
+
+	token, expiresAt, _, err := service.Claim(ctx, 2, created.MessageID)
+	require.NoError(t, err)
+	assert.NotEmpty(t, token)
+	assert.WithinDuration(t, time.Now().Add(models.ClaimWindow), expiresAt, 5*time.Second)
+
+	stored, err := metadataRepo.FindByMessageID(ctx, created.MessageID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusClaimed, stored.Status)
+	assert.WithinDuration(t, expiresAt, stored.ExpiresAt, time.Second, "the message expires with its claim")
+
+	// Claiming again returns the same claim
+	again, _, _, err := service.Claim(ctx, 2, created.MessageID)
+	require.NoError(t, err)
+	assert.Equal(t, token, again)
+
+	// A claimed message is only read with its token
+	_, _, err = service.Read(ctx, 2, created.MessageID)
+	assertServiceError(t, err, models.ErrorCodeMessageClaimed)
+
+	_, _, err = service.ReadClaimed(ctx, 2, created.MessageID, "wrong-token")
+	assertServiceError(t, err, models.ErrorCodeInvalidClaimToken)
+
+	msg, _, err := service.ReadClaimed(ctx, 2, created.MessageID, token)
+	require.NoError(t, err)
+	assert.Equal(t, servicePayload.Ciphertext, msg.Ciphertext)
+	stored, err = metadataRepo.FindByMessageID(ctx, created.MessageID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusRead, stored.Status)
+
+	// The fetch response was lost: the same token fetches it again
+	msg, _, err = service.ReadClaimed(ctx, 2, created.MessageID, token)
+	require.NoError(t, err)
+	assert.Equal(t, servicePayload.Ciphertext, msg.Ciphertext)
+	_, _, err = service.ReadClaimed(ctx, 2, created.MessageID, "wrong-token")
+	assertServiceError(t, err, models.ErrorCodeInvalidClaimToken)
+	_, _, err = service.Read(ctx, 2, created.MessageID)
+	assertServiceError(t, err, models.ErrorCodeMessageAlreadyRead)
+}
+
+func TestMessageService_FetchedClaimLapses(t *testing.T) {
+	service, store, _ := newMessageService(t, 0)
+	ctx := context.Background()
+
+	created, err := service.CreateEncrypted(ctx, 1, 2, servicePayload, nil, messages.CreateOptions{})
+	require.NoError(t, err)
+	token, _, _, err := service.Claim(ctx, 2, created.MessageID)
+	require.NoError(t, err)
+	_, _, err = service.ReadClaimed(ctx, 2, created.MessageID, token)
+	require.NoError(t, err)
+
+	// The claim window ends
+	_, err = store.Delete(ctx, []string{created.MessageID})
+	require.NoError(t, err)
+	_, _, err = service.ReadClaimed(ctx, 2, created.MessageID, token)
+	assertServiceError(t, err, models.ErrorCodeMessageAlreadyRead)
+}
+
+func TestMessageService_UnfetchedClaimExpires(t *testing.T) {
+	service, _, metadataRepo := newMessageService(t, 0)
+	ctx := context.Background()
+
+	created, err := service.CreateEncrypted(ctx, 1, 2, servicePayload, nil, messages.CreateOptions{})
+	require.NoError(t, err)
+	token, _, _, err := service.Claim(ctx, 2, created.MessageID)
+	require.NoError(t, err)
+
+	// The claim lapses without a fetch
+	require.NoError(t, metadataRepo.UpdateExpiresAt(ctx, created.MessageID, time.Now().Add(-time.Second)))
+
+	_, _, err = service.Read(ctx, 2, created.MessageID)
+	assertServiceError(t, err, models.ErrorCodeMessageExpired)
+	_, _, err = service.ReadClaimed(ctx, 2, created.MessageID, token)
+	assertServiceError(t, err, models.ErrorCodeMessageExpired)
+	status, err := service.Status(ctx, 1, created.MessageID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusExpired, status.Status)
+
+	expired, err := metadataRepo.CleanupExpired(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{created.MessageID}, expired, "the janitor expires the lapsed claim")
+}
+
+func TestMessageService_Preview(t *testing.T) {
+	service, store, _ := newMessageService(t, 0)
+	ctx := context.Background()
+
+	ttl := int64(3600)
+	created, err := service.CreateEncrypted(ctx, 1, 2, servicePayload, &ttl, messages.CreateOptions{})
+	require.NoError(t, err)
+
+	_, _, err = service.Preview(ctx, 1, created.MessageID)
+	assertServiceError(t, err, models.ErrorCodeNotRecipient)
+
+	preview, _, err := service.Preview(ctx, 2, created.MessageID)
+	require.NoError(t, err)
+	assert.True(t, preview.OneTime)
+	assert.InDelta(t, 3600, preview.ExpiresInSeconds, 5)
+
+	// Previewing does not burn
+	exists, err := store.Exists(ctx, created.MessageID)
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestMessageService_Status(t *testing.T) {
+	service, _, _ := newMessageService(t, 0)
+	ctx := context.Background()
+
+	created, err := service.CreateEncrypted(ctx, 1, 2, servicePayload, nil, messages.CreateOptions{})
+	require.NoError(t, err)
+
+	for _, userID := range []int64{1, 2} {
+		metadata, err := service.Status(ctx, userID, created.MessageID)
+		require.NoError(t, err)
+		assert.Equal(t, models.StatusPending, metadata.Status)
+	}
+
+	_, err = service.Status(ctx, 3, created.MessageID)
+	assertServiceError(t, err, models.ErrorCodeForbidden)
+
+	_, _, err = service.Read(ctx, 2, created.MessageID)
+	require.NoError(t, err)
+	metadata, err := service.Status(ctx, 1, created.MessageID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusRead, metadata.Status)
+	assert.NotNil(t, metadata.ReadAt)
+}
+
+func TestMessageService_StatusReportsLapsedAsExpired(t *testing.T) {
+	service, _, metadataRepo := newMessageService(t, 0)
+
+	// Pending in the database, but past its expiry
+	require.NoError(t, metadataRepo.Create(context.Background(), &models.MessageMetadata{
+		MessageID:   "lapsedlapsedlapsedlapsedlapsedla",
+		SenderID:    1,
+		RecipientID: 2,
+		Status:      models.StatusPending,
+		CreatedAt:   time.Now().Add(-time.Hour),
+		ExpiresAt:   time.Now().Add(-time.Minute),
+	}))
+
+	metadata, err := service.Status(context.Background(), 1, "lapsedlapsedlapsedlapsedlapsedla")
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusExpired, metadata.Status)
+}
+
+func TestMessageService_Revoke(t *testing.T) {
+	service, store, _ := newMessageService(t, 0)
+	ctx := context.Background()
+
+	created, err := service.CreateEncrypted(ctx, 1, 2, servicePayload, nil, messages.CreateOptions{})
+	require.NoError(t, err)
+
+	err = service.Revoke(ctx, 2, created.MessageID)
+	assertServiceError(t, err, models.ErrorCodeForbidden)
+
+	require.NoError(t, service.Revoke(ctx, 1, created.MessageID))
+	exists, err := store.Exists(ctx, created.MessageID)
+	require.NoError(t, err)
+	assert.False(t, exists, "the payload is burned")
+
+	metadata, err := service.Status(ctx, 1, created.MessageID)
+	require.NoError(t, err)
+	assert.Equal(t, models.StatusExpired, metadata.Status)
+
+	_, _, err = service.Read(ctx, 2, created.MessageID)
+	assertServiceError(t, err, models.ErrorCodeMessageRevoked)
+
+	err = service.Revoke(ctx, 1, created.MessageID)
+	assertServiceError(t, err, models.ErrorCodeMessageNotFound)
+}
+
+func TestMessageService_RevokeAfterRead(t *testing.T) {
+	service, _, _ := newMessageService(t, 0)
+	ctx := context.Background()
+
+	created, err := service.CreateEncrypted(ctx, 1, 2, servicePayload, nil, messages.CreateOptions{})
+	require.NoError(t, err)
+	_, _, err = service.Read(ctx, 2, created.MessageID)
+	require.NoError(t, err)
+
+	err = service.Revoke(ctx, 1, created.MessageID)
+	assertServiceError(t, err, models.ErrorCodeMessageAlreadyRead)
+}
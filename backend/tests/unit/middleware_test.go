@@ -1,55 +1,255 @@
 package unit
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/milkiss/vanish/backend/internal/api"
 	"github.com/milkiss/vanish/backend/internal/auth"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/requestid"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestSecurityHeadersMiddleware(t *testing.T) {
+// serveWithSecurityHeaders runs one request through SecurityHeadersMiddleware
+// as forwarded by a trusted proxy
+func serveWithSecurityHeaders(cfg config.SecurityHeadersConfig, forwardedProto string) *httptest.ResponseRecorder {
+	return serveWithSecurityHeadersFrom(cfg, "10.0.0.5:4000", forwardedProto)
+}
+
+// serveWithSecurityHeadersFrom runs one request from remoteAddr through
+// SecurityHeadersMiddleware, behind proxies in 10.0.0.0/8
+func serveWithSecurityHeadersFrom(cfg config.SecurityHeadersConfig, remoteAddr, forwardedProto string) *httptest.ResponseRecorder {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
-	router.Use(api.SecurityHeadersMiddleware())
+	proxies, _ := api.ConfigureTrustedProxies(router, []string{"10.0.0.0/8"})
+	router.Use(api.SecurityHeadersMiddleware(cfg, proxies))
 	router.GET("/test", func(c *gin.Context) {
 		c.String(http.StatusOK, "OK")
 	})
 
 	req, _ := http.NewRequest("GET", "/test", nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedProto != "" {
+		req.Header.Set("X-Forwarded-Proto", forwardedProto)
+	}
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	w := serveWithSecurityHeaders(config.DefaultSecurityHeaders(), "https")
 
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
 	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
 	assert.Equal(t, "1; mode=block", w.Header().Get("X-XSS-Protection"))
-	assert.Contains(t, w.Header().Get("Strict-Transport-Security"), "max-age=31536000")
+	assert.Equal(t, "max-age=31536000; includeSubDomains", w.Header().Get("Strict-Transport-Security"))
 	assert.Equal(t, "default-src 'self'", w.Header().Get("Content-Security-Policy"))
+	assert.Equal(t, config.DefaultPermissionsPolicy, w.Header().Get("Permissions-Policy"))
 	assert.Equal(t, "no-referrer", w.Header().Get("Referrer-Policy"))
 }
 
-func TestCORSMiddleware(t *testing.T) {
+func TestSecurityHeadersMiddleware_HSTS(t *testing.T) {
+	tests := []struct {
+		name           string
+		enabled        bool
+		maxAge         int64
+		forwardedProto string
+		expected       string
+	}{
+		{"plain HTTP skips HSTS", true, 0, "", ""},
+		{"forwarded HTTP skips HSTS", true, 0, "http", ""},
+		{"forwarded HTTPS sends default max-age", true, 0, "https", "max-age=31536000; includeSubDomains"},
+		{"custom max-age", true, 300, "https", "max-age=300; includeSubDomains"},
+		{"disabled", false, 300, "https", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultSecurityHeaders()
+			cfg.HSTSEnabled = tt.enabled
+			cfg.HSTSMaxAge = tt.maxAge
+
+			w := serveWithSecurityHeaders(cfg, tt.forwardedProto)
+			assert.Equal(t, tt.expected, w.Header().Get("Strict-Transport-Security"))
+		})
+	}
+}
+
+func TestSecurityHeadersMiddleware_HSTSOnlyFromTrustedProxies(t *testing.T) {
+	cfg := config.DefaultSecurityHeaders()
+	cfg.HSTSEnabled = true
+
+	w := serveWithSecurityHeadersFrom(cfg, "198.51.100.9:4000", "https")
+	assert.Empty(t, w.Header().Get("Strict-Transport-Security"), "a client cannot claim HTTPS for itself")
+
+	w = serveWithSecurityHeadersFrom(cfg, "10.0.0.5:4000", "https")
+	assert.NotEmpty(t, w.Header().Get("Strict-Transport-Security"))
+
+	// Without TRUSTED_PROXIES only TLS to the server itself counts
+	router := gin.New()
+	router.Use(api.SecurityHeadersMiddleware(cfg, nil))
+	router.GET("/test", func(c *gin.Context) {
+		c.String(http.StatusOK, "OK")
+	})
+	req, _ := http.NewRequest("GET", "/test", nil)
+	req.RemoteAddr = "10.0.0.5:4000"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Empty(t, w.Header().Get("Strict-Transport-Security"))
+
+	req.TLS = &tls.ConnectionState{}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.NotEmpty(t, w.Header().Get("Strict-Transport-Security"))
+}
+
+func TestSecurityHeadersMiddleware_CSPAndFrameAncestors(t *testing.T) {
+	tests := []struct {
+		name           string
+		csp            string
+		frameAncestors string
+		expectedCSP    string
+		expectedXFO    string
+	}{
+		{"defaults", "", "", "default-src 'self'", "DENY"},
+		{"custom CSP", "default-src 'self' https://app.example.com", "", "default-src 'self' https://app.example.com", "DENY"},
+		{"frame-ancestors none", "", "'none'", "default-src 'self'; frame-ancestors 'none'", "DENY"},
+		{"frame-ancestors self", "", "'self'", "default-src 'self'; frame-ancestors 'self'", "SAMEORIGIN"},
+		{"frame-ancestors origin list", "", "https://portal.example.com", "default-src 'self'; frame-ancestors https://portal.example.com", ""},
+		{"CSP already sets frame-ancestors", "default-src 'self'; frame-ancestors 'self'", "https://x.example.com", "default-src 'self'; frame-ancestors 'self'", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultSecurityHeaders()
+			cfg.ContentSecurityPolicy = tt.csp
+			cfg.FrameAncestors = tt.frameAncestors
+
+			w := serveWithSecurityHeaders(cfg, "")
+			assert.Equal(t, tt.expectedCSP, w.Header().Get("Content-Security-Policy"))
+			assert.Equal(t, tt.expectedXFO, w.Header().Get("X-Frame-Options"))
+		})
+	}
+}
+
+func TestSecurityHeadersMiddleware_CustomPermissionsPolicy(t *testing.T) {
+	cfg := config.DefaultSecurityHeaders()
+	cfg.PermissionsPolicy = "camera=(self)"
+
+	w := serveWithSecurityHeaders(cfg, "")
+	assert.Equal(t, "camera=(self)", w.Header().Get("Permissions-Policy"))
+}
+
+// corsRequest sends a GET with the given Origin through CORSMiddleware
+func corsRequest(t *testing.T, allowedOrigins []string, origin string) *httptest.ResponseRecorder {
 	gin.SetMode(gin.TestMode)
+	corsMiddleware, err := api.CORSMiddleware(allowedOrigins, false)
+	require.NoError(t, err)
+
 	router := gin.New()
-	router.Use(api.CORSMiddleware([]string{"http://localhost:5173"}))
+	router.Use(corsMiddleware)
 	router.GET("/test", func(c *gin.Context) {
 		c.String(http.StatusOK, "OK")
 	})
 
 	req, _ := http.NewRequest("GET", "/test", nil)
-	req.Header.Set("Origin", "http://localhost:5173")
+	req.Header.Set("Origin", origin)
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSMiddleware(t *testing.T) {
+	w := corsRequest(t, []string{"http://localhost:5173"}, "http://localhost:5173")
 
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Equal(t, "http://localhost:5173", w.Header().Get("Access-Control-Allow-Origin"))
 }
 
+func TestCORSMiddleware_WildcardSubdomains(t *testing.T) {
+	allowed := []string{"https://*.vanish.dev", "http://localhost:5173"}
+
+	tests := []struct {
+		name    string
+		origin  string
+		allowed bool
+	}{
+		{"preview deployment", "https://pr-123.vanish.dev", true},
+		{"uppercase origin", "https://PR-123.Vanish.dev", true},
+		{"exact origin still allowed", "http://localhost:5173", true},
+		{"apex domain is not a subdomain", "https://vanish.dev", false},
+		{"suffix without dot", "https://evil-vanish.dev", false},
+		{"suffix as prefix of attacker domain", "https://pr-1.vanish.dev.evil.com", false},
+		{"nested subdomain", "https://a.b.vanish.dev", false},
+		{"empty label", "https://.vanish.dev", false},
+		{"trailing dot", "https://pr-1.vanish.dev.", false},
+		{"scheme downgrade", "http://pr-1.vanish.dev", false},
+		{"unexpected port", "https://pr-1.vanish.dev:8443", false},
+		{"userinfo trick", "https://pr-1.vanish.dev@evil.com", false},
+		{"userinfo trick reversed", "https://evil.com@pr-1.vanish.dev", false},
+		{"path smuggling", "https://evil.com/.vanish.dev", false},
+		{"encoded dot", "https://evil%2Evanish.dev", false},
+		{"null origin", "null", false},
+		{"other domain", "https://attacker.example", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := corsRequest(t, allowed, tt.origin)
+
+			if tt.allowed {
+				assert.Equal(t, http.StatusOK, w.Code)
+				assert.Equal(t, tt.origin, w.Header().Get("Access-Control-Allow-Origin"))
+			} else {
+				assert.Equal(t, http.StatusForbidden, w.Code)
+				assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+			}
+		})
+	}
+}
+
+func TestCORSMiddleware_InvalidConfiguration(t *testing.T) {
+	tests := []struct {
+		name        string
+		origins     []string
+		credentials bool
+	}{
+		{"no origins", nil, false},
+		{"star with credentials", []string{"*"}, true},
+		{"star among others with credentials", []string{"https://vanish.dev", "*"}, true},
+		{"missing scheme", []string{"vanish.dev"}, false},
+		{"unsupported scheme", []string{"ftp://vanish.dev"}, false},
+		{"wildcard inside label", []string{"https://*vanish.dev"}, false},
+		{"wildcard in middle", []string{"https://pr.*.vanish.dev"}, false},
+		{"wildcard on public suffix", []string{"https://*.dev"}, false},
+		{"origin with path", []string{"https://vanish.dev/app"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := api.CORSMiddleware(tt.origins, tt.credentials)
+			assert.Error(t, err)
+		})
+	}
+
+	// Credentials are fine with explicit origins
+	_, err := api.CORSMiddleware([]string{"https://*.vanish.dev"}, true)
+	assert.NoError(t, err)
+}
+
 func TestAuthMiddleware_Success(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	jwtManager := auth.NewJWTManager("test-secret-key", 24*time.Hour)
@@ -154,3 +354,314 @@ func TestAuthMiddleware_ExpiredToken(t *testing.T) {
 
 	assert.Equal(t, http.StatusUnauthorized, w.Code)
 }
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(api.RequestIDMiddleware())
+	router.GET("/test", func(c *gin.Context) {
+		// Gin context and request context must agree
+		assert.Equal(t, c.GetString("request_id"), requestid.FromContext(c.Request.Context()))
+		c.String(http.StatusOK, c.GetString("request_id"))
+	})
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"no header generates ID", "", false},
+		{"valid header is reused", "client-abc_123.4:5", true},
+		{"header with spaces is replaced", "bad id", false},
+		{"header with control characters is replaced", "id\nInjected: yes", false},
+		{"overlong header is replaced", string(make([]byte, 200)), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/test", nil)
+			if tt.incoming != "" {
+				req.Header.Set(requestid.Header, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			id := w.Header().Get(requestid.Header)
+			assert.True(t, requestid.Valid(id))
+			assert.Equal(t, id, w.Body.String())
+			if tt.keep {
+				assert.Equal(t, tt.incoming, id)
+			} else {
+				assert.NotEqual(t, tt.incoming, id)
+				assert.Len(t, id, 36)
+			}
+		})
+	}
+}
+
+func TestRequestIDInErrorResponse(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	jwtManager := auth.NewJWTManager("test-secret-key", 24*time.Hour)
+
+	router := gin.New()
+	router.Use(api.RequestIDMiddleware())
+	router.Use(api.AuthMiddleware(jwtManager))
+	router.GET("/protected", func(c *gin.Context) {
+		c.String(http.StatusOK, "OK")
+	})
+
+	req, _ := http.NewRequest("GET", "/protected", nil)
+	req.Header.Set(requestid.Header, "trace-42")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	var response models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "trace-42", response.RequestID)
+	assert.Equal(t, "trace-42", w.Header().Get(requestid.Header))
+}
+
+func TestClientIP_TrustedProxies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		trusted    []string
+		remoteAddr string
+		forwarded  string
+		expected   string
+	}{
+		{"no proxy", []string{"10.0.0.0/8"}, "198.51.100.9:4000", "", "198.51.100.9"},
+		{"trusted proxy forwards client", []string{"10.0.0.0/8"}, "10.0.0.5:4000", "203.0.113.7", "203.0.113.7"},
+		{"forged header from untrusted peer", []string{"10.0.0.0/8"}, "198.51.100.9:4000", "203.0.113.7", "198.51.100.9"},
+		{"client-prepended entry behind trusted proxy", []string{"10.0.0.0/8"}, "10.0.0.5:4000", "1.2.3.4, 203.0.113.7", "203.0.113.7"},
+		{"chain of trusted proxies", []string{"10.0.0.0/8"}, "10.0.0.5:4000", "203.0.113.7, 10.0.0.9", "203.0.113.7"},
+		{"no trusted proxies configured", nil, "10.0.0.5:4000", "203.0.113.7", "10.0.0.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			_, err := api.ConfigureTrustedProxies(router, tt.trusted)
+			require.NoError(t, err)
+			router.GET("/ip", func(c *gin.Context) {
+				c.String(http.StatusOK, api.ClientIP(c))
+			})
+
+			req, _ := http.NewRequest("GET", "/ip", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			// Only X-Forwarded-For is honoured
+			req.Header.Set("X-Real-IP", "192.0.2.99")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expected, w.Body.String())
+		})
+	}
+}
+
+func TestSetupRouter_InvalidTrustedProxies(t *testing.T) {
+	deps := testDependencies()
+	deps.Config.Server.TrustedProxies = []string{"not-an-ip"}
+
+	router, err := api.SetupRouter(deps)
+	assert.Error(t, err)
+	assert.Nil(t, router)
+}
+
+var testCookieConfig = config.AuthCookieConfig{Enabled: true, Name: "vanish_session", Secure: true}
+
+// cookieAuthRouter mounts cookie-aware auth plus CSRF protection the way
+// SetupRouter does for the protected group
+func cookieAuthRouter(cookies *api.SessionCookies, jwtManager *auth.JWTManager) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(api.SessionAuthMiddleware(jwtManager, cookies, nil))
+	router.Use(api.CSRFMiddleware())
+	ok := func(c *gin.Context) { c.String(http.StatusOK, "OK") }
+	router.GET("/protected", ok)
+	router.POST("/protected", ok)
+	router.GET("/burn", api.RequireCSRF(), ok)
+	return router
+}
+
+// cookieRequest builds a request carrying the session cookie and, when
+// csrfCookie is non-empty, the CSRF cookie and the given header value
+func cookieRequest(method, path, token, csrfCookie, csrfHeader string) *http.Request {
+	req, _ := http.NewRequest(method, path, nil)
+	req.AddCookie(&http.Cookie{Name: testCookieConfig.Name, Value: token})
+	if csrfCookie != "" {
+		req.AddCookie(&http.Cookie{Name: api.CSRFCookieName, Value: csrfCookie})
+	}
+	if csrfHeader != "" {
+		req.Header.Set(api.CSRFHeader, csrfHeader)
+	}
+	return req
+}
+
+func TestSessionCookies_Attributes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cookies := api.NewSessionCookies(testCookieConfig, 2*time.Hour)
+
+	router := gin.New()
+	router.POST("/login", func(c *gin.Context) {
+		require.NoError(t, cookies.Set(c, "jwt-value"))
+		c.Status(http.StatusOK)
+	})
+	req, _ := http.NewRequest("POST", "/login", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	byName := map[string]*http.Cookie{}
+	for _, cookie := range w.Result().Cookies() {
+		byName[cookie.Name] = cookie
+	}
+
+	session := byName["vanish_session"]
+	require.NotNil(t, session)
+	assert.Equal(t, "jwt-value", session.Value)
+	assert.True(t, session.HttpOnly)
+	assert.True(t, session.Secure)
+	assert.Equal(t, http.SameSiteLaxMode, session.SameSite)
+	assert.Equal(t, 7200, session.MaxAge)
+	assert.Equal(t, "/", session.Path)
+
+	csrf := byName[api.CSRFCookieName]
+	require.NotNil(t, csrf)
+	assert.False(t, csrf.HttpOnly, "the CSRF cookie must be readable by the frontend")
+	assert.NotEmpty(t, csrf.Value)
+}
+
+func TestSessionCookies_DisabledIsNil(t *testing.T) {
+	assert.Nil(t, api.NewSessionCookies(config.AuthCookieConfig{Name: "vanish_session"}, time.Hour))
+}
+
+func TestSessionAuth_CookieAndCSRF(t *testing.T) {
+	jwtManager := auth.NewJWTManager("test-secret-key", time.Hour)
+	token, err := jwtManager.Generate(7, "cookie@example.com")
+	require.NoError(t, err)
+	router := cookieAuthRouter(api.NewSessionCookies(testCookieConfig, time.Hour), jwtManager)
+
+	bearerPost, _ := http.NewRequest("POST", "/protected", nil)
+	bearerPost.Header.Set("Authorization", "Bearer "+token)
+
+	badBearerWithCookie := cookieRequest("GET", "/protected", token, "", "")
+	badBearerWithCookie.Header.Set("Authorization", "Bearer not-a-jwt")
+
+	tests := []struct {
+		name     string
+		req      *http.Request
+		expected int
+	}{
+		{"cookie GET needs no CSRF", cookieRequest("GET", "/protected", token, "", ""), http.StatusOK},
+		{"cookie POST without CSRF", cookieRequest("POST", "/protected", token, "", ""), http.StatusForbidden},
+		{"cookie POST with header but no CSRF cookie", cookieRequest("POST", "/protected", token, "", "guess"), http.StatusForbidden},
+		{"cookie POST with mismatched CSRF", cookieRequest("POST", "/protected", token, "csrf-1", "csrf-2"), http.StatusForbidden},
+		{"cookie POST with matching CSRF", cookieRequest("POST", "/protected", token, "csrf-1", "csrf-1"), http.StatusOK},
+		{"cookie GET on burning route without CSRF", cookieRequest("GET", "/burn", token, "csrf-1", ""), http.StatusForbidden},
+		{"cookie GET on burning route with CSRF", cookieRequest("GET", "/burn", token, "csrf-1", "csrf-1"), http.StatusOK},
+		{"invalid cookie", cookieRequest("GET", "/protected", "not-a-jwt", "", ""), http.StatusUnauthorized},
+		{"bearer POST needs no CSRF", bearerPost, http.StatusOK},
+		{"header takes precedence over cookie", badBearerWithCookie, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, tt.req)
+			assert.Equal(t, tt.expected, w.Code)
+		})
+	}
+}
+
+func TestSessionAuth_CookieIgnoredWhenDisabled(t *testing.T) {
+	jwtManager := auth.NewJWTManager("test-secret-key", time.Hour)
+	token, err := jwtManager.Generate(7, "cookie@example.com")
+	require.NoError(t, err)
+	router := cookieAuthRouter(nil, jwtManager)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, cookieRequest("GET", "/protected", token, "", ""))
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestSetupRouter_CookieLoginAndLogout(t *testing.T) {
+	deps := testDependencies()
+	deps.Config.Cookie = testCookieConfig
+	deps.Config.JWT.TokenDuration = 1
+	hashed, err := models.HashPassword("password123")
+	require.NoError(t, err)
+	require.NoError(t, deps.UserStore.Create(context.Background(), &models.User{
+		Email: "cookie@example.com", Name: "Cookie", Password: hashed,
+	}))
+	router, err := api.SetupRouter(deps)
+	require.NoError(t, err)
+
+	login, _ := http.NewRequest("POST", "/api/v1/auth/login",
+		strings.NewReader(`{"email":"cookie@example.com","password":"password123"}`))
+	login.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, login)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var session, csrf *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		switch cookie.Name {
+		case "vanish_session":
+			session = cookie
+		case api.CSRFCookieName:
+			csrf = cookie
+		}
+	}
+	require.NotNil(t, session)
+	require.NotNil(t, csrf)
+
+	// The cookie alone authenticates /auth/me
+	me := cookieRequest("GET", "/api/v1/auth/me", session.Value, "", "")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, me)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Logout expires both cookies
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, cookieRequest("POST", "/api/v1/auth/logout", session.Value, csrf.Value, csrf.Value))
+	require.Equal(t, http.StatusOK, w.Code)
+	for _, cookie := range w.Result().Cookies() {
+		assert.Less(t, cookie.MaxAge, 0, cookie.Name)
+	}
+}
+
+func TestSetupRouter_CookieAuthRejectsWildcardOrigin(t *testing.T) {
+	deps := testDependencies()
+	deps.Config.Cookie = testCookieConfig
+	deps.Config.Server.AllowedOrigins = []string{"*"}
+
+	_, err := api.SetupRouter(deps)
+	assert.Error(t, err)
+}
+
+func TestCORS_AllowsCSRFHeader(t *testing.T) {
+	middleware, err := api.CORSMiddleware([]string{"https://app.example.com"}, true)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(middleware)
+	router.POST("/x", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req, _ := http.NewRequest("OPTIONS", "/x", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "POST")
+	req.Header.Set("Access-Control-Request-Headers", api.CSRFHeader)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Contains(t, strings.ToLower(w.Header().Get("Access-Control-Allow-Headers")), strings.ToLower(api.CSRFHeader))
+}
@@ -2,10 +2,12 @@ package unit
 
 import (
 	"testing"
+	"time"
 
 	"github.com/milkiss/vanish/backend/internal/models"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestValidateTTL_Default(t *testing.T) {
@@ -47,6 +49,21 @@ func TestValidateTTL_BoundaryValues(t *testing.T) {
 	assert.Equal(t, maxTTL, ttl)
 }
 
+func TestValidateSchedule(t *testing.T) {
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+
+	assert.NoError(t, models.ValidateSchedule(nil, models.MaxTTL, now))
+	assert.NoError(t, models.ValidateSchedule(at(time.Hour), models.DefaultTTL, now))
+	assert.NoError(t, models.ValidateSchedule(at(6*24*time.Hour), models.DefaultTTL, now))
+	assert.ErrorIs(t, models.ValidateSchedule(at(0), models.DefaultTTL, now), models.ErrAvailableAtPast)
+	assert.ErrorIs(t, models.ValidateSchedule(at(-time.Minute), models.DefaultTTL, now), models.ErrAvailableAtPast)
+	assert.ErrorIs(t, models.ValidateSchedule(at(time.Minute), models.MaxTTL, now), models.ErrScheduleTooFar)
+}
+
 func TestHashPassword(t *testing.T) {
 	password := "mySecurePassword123"
 	hash, err := models.HashPassword(password)
@@ -67,6 +84,37 @@ func TestHashPassword_DifferentHashesForSamePassword(t *testing.T) {
 	assert.NotEqual(t, hash1, hash2)
 }
 
+func TestSetPasswordCost(t *testing.T) {
+	t.Cleanup(func() { require.NoError(t, models.SetPasswordCost(bcrypt.DefaultCost)) })
+
+	require.NoError(t, models.SetPasswordCost(bcrypt.MinCost))
+	assert.Equal(t, bcrypt.MinCost, models.PasswordCost())
+	hash, err := models.HashPassword("password123")
+	require.NoError(t, err)
+	cost, err := bcrypt.Cost([]byte(hash))
+	require.NoError(t, err)
+	assert.Equal(t, bcrypt.MinCost, cost)
+
+	// Hashes made at another cost still verify
+	require.NoError(t, models.SetPasswordCost(bcrypt.DefaultCost))
+	user := &models.User{Password: hash}
+	assert.True(t, user.CheckPassword("password123"))
+
+	assert.Error(t, models.SetPasswordCost(bcrypt.MinCost-1))
+	assert.Error(t, models.SetPasswordCost(bcrypt.MaxCost+1))
+	assert.Equal(t, bcrypt.DefaultCost, models.PasswordCost())
+}
+
+func TestRejectPassword(t *testing.T) {
+	assert.False(t, models.RejectPassword(""))
+	assert.False(t, models.RejectPassword("vanish-dummy-password"))
+
+	// Accounts without a password match nothing, not even an empty one
+	user := &models.User{}
+	assert.False(t, user.CheckPassword(""))
+	assert.False(t, user.CheckPassword("anything"))
+}
+
 func TestUser_CheckPassword_Success(t *testing.T) {
 	password := "mySecurePassword123"
 	hash, err := models.HashPassword(password)
@@ -121,3 +169,38 @@ func TestUser_ToUserInfo_NoPasswordLeak(t *testing.T) {
 	assert.NotNil(t, userInfo)
 	assert.Equal(t, user.ID, userInfo.ID)
 }
+
+func TestSenderLabel(t *testing.T) {
+	tests := []struct {
+		name        string
+		senderName  string
+		senderType  models.SenderType
+		integration string
+		want        string
+	}{
+		{"user", "Alice", models.SenderTypeUser, "", "Alice"},
+		{"slack on behalf of a user", "Alice", models.SenderTypeIntegration, models.IntegrationSlack, "Alice via Slack integration"},
+		{"service account", "CI Bot", models.SenderTypeIntegration, "CI Bot", "CI Bot integration"},
+		{"legacy row without type", "Alice", "", "", "Alice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, models.SenderLabel(tt.senderName, tt.senderType, tt.integration))
+		})
+	}
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, hash, err := models.GenerateAPIKey()
+	require.NoError(t, err)
+
+	assert.True(t, models.IsAPIKey(key))
+	assert.Equal(t, models.HashAPIKey(key), hash)
+	assert.NotContains(t, hash, key)
+	assert.Len(t, models.APIKeyDisplayPrefix(key), len(models.APIKeyPrefix)+6)
+
+	other, _, err := models.GenerateAPIKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+}
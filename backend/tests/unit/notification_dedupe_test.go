@@ -0,0 +1,319 @@
+package unit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/integrations/email"
+	"github.com/milkiss/vanish/backend/internal/integrations/slack"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// slackCall is one chat.postMessage or chat.update received by a fake Slack API
+type slackCall struct {
+	Method  string
+	Channel string `json:"channel"`
+	TS      string `json:"ts"`
+	Text    string `json:"text"`
+}
+
+// slackWorkspace is a Slack API stand-in that records posted and updated
+// messages, numbering their timestamps, and fails the next posts or
+// updates when told to
+type slackWorkspace struct {
+	mu          sync.Mutex
+	calls       []slackCall
+	failPosts   int
+	failUpdates int
+}
+
+func newSlackWorkspace(t *testing.T) (*slackWorkspace, *slack.Client) {
+	ws := &slackWorkspace{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		ws.mu.Lock()
+		defer ws.mu.Unlock()
+
+		method := strings.TrimPrefix(r.URL.Path, "/")
+		switch method {
+		case "users.lookupByEmail":
+			// One DM channel per recipient
+			fmt.Fprintf(w, `{"ok":true,"user":{"id":%q}}`, r.URL.Query().Get("email"))
+			return
+		case "conversations.open":
+			var req struct{ Users string }
+			_ = json.NewDecoder(r.Body).Decode(&req)
+			fmt.Fprintf(w, `{"ok":true,"channel":{"id":%q}}`, "D-"+req.Users)
+			return
+		case "chat.postMessage":
+			if ws.failPosts > 0 {
+				ws.failPosts--
+				fmt.Fprint(w, `{"ok":false,"error":"ratelimited"}`)
+				return
+			}
+		case "chat.update":
+			if ws.failUpdates > 0 {
+				ws.failUpdates--
+				fmt.Fprint(w, `{"ok":false,"error":"message_not_found"}`)
+				return
+			}
+		}
+
+		call := slackCall{Method: method}
+		_ = json.NewDecoder(r.Body).Decode(&call)
+		if method == "chat.postMessage" {
+			call.TS = fmt.Sprintf("%d.0", len(ws.calls)+1)
+		}
+		ws.calls = append(ws.calls, call)
+		fmt.Fprintf(w, `{"ok":true,"channel":%q,"ts":%q}`, call.Channel, call.TS)
+	}))
+	t.Cleanup(server.Close)
+	return ws, slack.NewClient(&slack.Config{BotToken: "xoxb-test", APIURL: server.URL})
+}
+
+func (ws *slackWorkspace) Calls() []slackCall {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return append([]slackCall(nil), ws.calls...)
+}
+
+func (ws *slackWorkspace) Posts() []slackCall {
+	var posts []slackCall
+	for _, call := range ws.Calls() {
+		if call.Method == "chat.postMessage" {
+			posts = append(posts, call)
+		}
+	}
+	return posts
+}
+
+// newSMTPServer starts an SMTP server that accepts every message and
+// returns the bodies received
+func newSMTPServer(t *testing.T) (*email.Client, func() []string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	var mu sync.Mutex
+	var mails []string
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				fmt.Fprint(conn, "220 localhost\r\n")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					switch strings.ToUpper(strings.Fields(line + " x")[0]) {
+					case "DATA":
+						fmt.Fprint(conn, "354 go ahead\r\n")
+						var body strings.Builder
+						for {
+							line, err := r.ReadString('\n')
+							if err != nil || line == ".\r\n" {
+								break
+							}
+							body.WriteString(line)
+						}
+						mu.Lock()
+						mails = append(mails, body.String())
+						mu.Unlock()
+						fmt.Fprint(conn, "250 queued\r\n")
+					case "EHLO":
+						fmt.Fprint(conn, "250-localhost\r\n250 AUTH PLAIN\r\n")
+					case "AUTH":
+						fmt.Fprint(conn, "235 accepted\r\n")
+					case "QUIT":
+						fmt.Fprint(conn, "221 bye\r\n")
+						return
+					default:
+						fmt.Fprint(conn, "250 ok\r\n")
+					}
+				}
+			}()
+		}
+	}()
+
+	port := listener.Addr().(*net.TCPAddr).Port
+	client := email.NewClient(&email.Config{SMTPHost: "127.0.0.1", SMTPPort: port, FromAddress: "noreply@vanish.local"})
+	return client, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), mails...)
+	}
+}
+
+// dedupeRouter serves the notification endpoints with a deduper over
+// window; senders of requests with an X-Integration header authenticate
+// as that integration's service account
+func dedupeRouter(t *testing.T, users *fakes.UserStore, clients api.IntegrationClients, window time.Duration) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	deduper := api.NewNotificationDeduper(config.NotificationConfig{DedupeWindow: window}, fakes.NewStorage())
+	handler := api.NewNotificationHandler(users, fakes.NewMetadataStore(users), api.NewIntegrations(clients), nil, deduper, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(1), func(c *gin.Context) {
+		if integration := c.GetHeader("X-Integration"); integration != "" {
+			c.Set("integration_name", integration)
+		}
+	})
+	router.POST("/notifications/send-slack", handler.SendSlackNotification)
+	router.POST("/notifications/send-email", handler.SendEmailNotification)
+	return router
+}
+
+func notifyRecipient(t *testing.T, router *gin.Engine, channel string, recipientID int64, link, integration string) {
+	body, _ := json.Marshal(api.SendNotificationRequest{RecipientID: recipientID, MessageURL: link})
+	req := httptest.NewRequest("POST", "/notifications/send-"+channel, strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	if integration != "" {
+		req.Header.Set("X-Integration", integration)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestNotificationDeduper_CollapsesRepeatsIntoFirstSlackMessage(t *testing.T) {
+	ws, slackClient := newSlackWorkspace(t)
+	router := dedupeRouter(t, seedUsers(t), api.IntegrationClients{Slack: slackClient}, 10*time.Minute)
+
+	for i := 1; i <= 5; i++ {
+		notifyRecipient(t, router, "slack", 2, fmt.Sprintf("http://localhost:5173/m/msg%d#key%d", i, i), "")
+	}
+
+	calls := ws.Calls()
+	require.Len(t, ws.Posts(), 1, "only the first notification is posted")
+	require.Len(t, calls, 5)
+	first := calls[0]
+	assert.NotContains(t, first.Text, "(x")
+	for i, call := range calls[1:] {
+		assert.Equal(t, "chat.update", call.Method)
+		assert.Equal(t, first.Channel, call.Channel)
+		assert.Equal(t, first.TS, call.TS, "repeats edit the first message")
+		assert.Contains(t, call.Text, fmt.Sprintf("(x%d)", i+2))
+	}
+	last := calls[4].Text
+	assert.Contains(t, last, "New Secure Message from Sender* (x5)")
+	assert.Contains(t, last, "http://localhost:5173/m/msg5#key5", "the latest link replaces the earlier ones")
+}
+
+func TestNotificationDeduper_DistinctNotificationsAreNotSuppressed(t *testing.T) {
+	ws, slackClient := newSlackWorkspace(t)
+	emailClient, mails := newSMTPServer(t)
+	users := seedUsers(t)
+	require.NoError(t, users.Create(context.Background(), &models.User{Email: "other@example.com", Name: "Other"}))
+	router := dedupeRouter(t, users, api.IntegrationClients{Slack: slackClient, Email: emailClient}, 10*time.Minute)
+
+	notifyRecipient(t, router, "slack", 2, "http://localhost:5173/m/a#ka", "")
+	notifyRecipient(t, router, "slack", 3, "http://localhost:5173/m/b#kb", "")             // another recipient
+	notifyRecipient(t, router, "slack", 2, "http://localhost:5173/m/c#kc", "Bulk Rotator") // another sender label
+	notifyRecipient(t, router, "email", 2, "http://localhost:5173/m/d#kd", "")             // another channel
+
+	posts := ws.Posts()
+	require.Len(t, posts, 3)
+	for _, post := range posts {
+		assert.NotContains(t, post.Text, "(x")
+	}
+	assert.NotEqual(t, posts[0].Channel, posts[1].Channel)
+	assert.Contains(t, posts[2].Text, "Bulk Rotator")
+	require.Len(t, mails(), 1)
+	assert.Contains(t, mails()[0], "http://localhost:5173/m/d#kd")
+
+	// A repeat by email is dropped: email cannot edit what it sent
+	notifyRecipient(t, router, "email", 2, "http://localhost:5173/m/e#ke", "")
+	assert.Len(t, mails(), 1)
+}
+
+func TestNotificationDeduper_WindowExpires(t *testing.T) {
+	ws, slackClient := newSlackWorkspace(t)
+	router := dedupeRouter(t, seedUsers(t), api.IntegrationClients{Slack: slackClient}, 50*time.Millisecond)
+
+	notifyRecipient(t, router, "slack", 2, "http://localhost:5173/m/a#ka", "")
+	time.Sleep(100 * time.Millisecond)
+	notifyRecipient(t, router, "slack", 2, "http://localhost:5173/m/b#kb", "")
+
+	posts := ws.Posts()
+	require.Len(t, posts, 2)
+	assert.NotContains(t, posts[1].Text, "(x")
+}
+
+func TestNotificationDeduper_Disabled(t *testing.T) {
+	ws, slackClient := newSlackWorkspace(t)
+	router := dedupeRouter(t, seedUsers(t), api.IntegrationClients{Slack: slackClient}, 0)
+
+	notifyRecipient(t, router, "slack", 2, "http://localhost:5173/m/a#ka", "")
+	notifyRecipient(t, router, "slack", 2, "http://localhost:5173/m/b#kb", "")
+
+	assert.Len(t, ws.Posts(), 2)
+}
+
+func TestNotificationDeduper_FailedSendIsNotCollapsed(t *testing.T) {
+	ws, slackClient := newSlackWorkspace(t)
+	router := dedupeRouter(t, seedUsers(t), api.IntegrationClients{Slack: slackClient}, 10*time.Minute)
+
+	ws.failPosts = 1
+	w := postNotification(router, "/notifications/send-slack", api.SendNotificationRequest{RecipientID: 2, MessageURL: "http://localhost:5173/m/a#ka"})
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+
+	// The retry is the first notification the recipient gets
+	notifyRecipient(t, router, "slack", 2, "http://localhost:5173/m/a#ka", "")
+	posts := ws.Posts()
+	require.Len(t, posts, 1)
+	assert.NotContains(t, posts[0].Text, "(x")
+}
+
+func TestNotificationDeduper_RepostsWhenFirstMessageIsGone(t *testing.T) {
+	ws, slackClient := newSlackWorkspace(t)
+	router := dedupeRouter(t, seedUsers(t), api.IntegrationClients{Slack: slackClient}, 10*time.Minute)
+
+	notifyRecipient(t, router, "slack", 2, "http://localhost:5173/m/a#ka", "")
+	ws.failUpdates = 1
+	notifyRecipient(t, router, "slack", 2, "http://localhost:5173/m/b#kb", "")
+	notifyRecipient(t, router, "slack", 2, "http://localhost:5173/m/c#kc", "")
+
+	posts := ws.Posts()
+	require.Len(t, posts, 2)
+	assert.Contains(t, posts[1].Text, "(x2)")
+	assert.Contains(t, posts[1].Text, "http://localhost:5173/m/b#kb")
+
+	// Later repeats edit the message posted in its place
+	calls := ws.Calls()
+	last := calls[len(calls)-1]
+	assert.Equal(t, "chat.update", last.Method)
+	assert.Equal(t, posts[1].TS, last.TS)
+	assert.Contains(t, last.Text, "(x3)")
+}
+
+func TestLoad_NotificationDedupeWindow(t *testing.T) {
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, cfg.Notify.DedupeWindow)
+
+	t.Setenv("NOTIFICATION_DEDUPE_WINDOW", "-1m")
+	_, err = config.Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "NOTIFICATION_DEDUPE_WINDOW")
+}
@@ -0,0 +1,224 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/integrations/slack"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/urlbuilder"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeSlackAPI starts a Slack Web API stand-in that counts calls
+func newFakeSlackAPI(t *testing.T) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ok":true,"user":{"id":"U1"},"channel":{"id":"D1"}}`)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+// seedUsers creates a sender (ID 1) and recipient (ID 2)
+func seedUsers(t *testing.T) *fakes.UserStore {
+	users := fakes.NewUserStore()
+	for _, u := range []*models.User{
+		{Email: "sender@example.com", Name: "Sender"},
+		{Email: "recipient@example.com", Name: "Recipient"},
+	} {
+		require.NoError(t, users.Create(context.Background(), u))
+	}
+	return users
+}
+
+func postNotification(router *gin.Engine, path string, payload interface{}) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(payload)
+	req, _ := http.NewRequest("POST", path, bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSendSlackNotification_Enabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	slackAPI, calls := newFakeSlackAPI(t)
+	users := seedUsers(t)
+	slackClient := slack.NewClient(&slack.Config{BotToken: "xoxb-test", APIURL: slackAPI.URL})
+	handler := api.NewNotificationHandler(users, fakes.NewMetadataStore(users), api.NewIntegrations(api.IntegrationClients{Slack: slackClient}), nil, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(1))
+	router.POST("/notifications/send-slack", handler.SendSlackNotification)
+
+	w := postNotification(router, "/notifications/send-slack", api.SendNotificationRequest{
+		RecipientID: 2,
+		MessageURL:  "http://localhost:5173/m/abc#key",
+	})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Greater(t, atomic.LoadInt32(calls), int32(0))
+}
+
+func TestSendSlackNotification_UnknownRecipient(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	slackAPI, _ := newFakeSlackAPI(t)
+	users := seedUsers(t)
+	slackClient := slack.NewClient(&slack.Config{BotToken: "xoxb-test", APIURL: slackAPI.URL})
+	handler := api.NewNotificationHandler(users, fakes.NewMetadataStore(users), api.NewIntegrations(api.IntegrationClients{Slack: slackClient}), nil, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(1))
+	router.POST("/notifications/send-slack", handler.SendSlackNotification)
+
+	w := postNotification(router, "/notifications/send-slack", api.SendNotificationRequest{
+		RecipientID: 99,
+		MessageURL:  "http://localhost:5173/m/abc#key",
+	})
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestNotifications_Disabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	users := seedUsers(t)
+	handler := api.NewNotificationHandler(users, fakes.NewMetadataStore(users), nil, nil, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(1))
+	router.POST("/notifications/send-slack", handler.SendSlackNotification)
+	router.POST("/notifications/send-email", handler.SendEmailNotification)
+
+	payload := api.SendNotificationRequest{RecipientID: 2, MessageURL: "http://localhost:5173/m/abc#key"}
+
+	for _, path := range []string{"/notifications/send-slack", "/notifications/send-email"} {
+		w := postNotification(router, path, payload)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code, path)
+
+		var response models.ErrorResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		assert.Contains(t, response.Error, "integration not enabled")
+	}
+}
+
+func TestNotifications_Unauthorized(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	deps := testDependencies()
+	deps.Config.Slack.Enabled = true
+	router, err := api.SetupRouter(deps)
+	require.NoError(t, err)
+
+	payload := api.SendNotificationRequest{RecipientID: 2, MessageURL: "http://localhost:5173/m/abc#key"}
+
+	for _, path := range []string{"/api/notifications/send-slack", "/api/notifications/send-email"} {
+		w := postNotification(router, path, payload)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, path)
+	}
+}
+
+// resendRouter serves POST /messages/:id/resend-notification as userID for a
+// pending message "msg-1" sent from user 1 to user 2 with a stored key;
+// change, if set, adjusts the message before it is stored
+func resendRouter(t *testing.T, userID int64, slackAPIURL string, change func(m *models.MessageMetadata)) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	users := seedUsers(t)
+	metadataStore := fakes.NewMetadataStore(users)
+	message := &models.MessageMetadata{
+		MessageID:     "msg-1",
+		SenderID:      1,
+		RecipientID:   2,
+		EncryptionKey: "test-key",
+		Status:        models.StatusPending,
+		CreatedAt:     time.Now().UTC(),
+		ExpiresAt:     time.Now().UTC().Add(time.Hour),
+	}
+	if change != nil {
+		change(message)
+	}
+	require.NoError(t, metadataStore.Create(context.Background(), message))
+
+	links, err := urlbuilder.New("http://localhost:5173")
+	require.NoError(t, err)
+	slackClient := slack.NewClient(&slack.Config{BotToken: "xoxb-test", APIURL: slackAPIURL})
+	handler := api.NewNotificationHandler(users, metadataStore, api.NewIntegrations(api.IntegrationClients{Slack: slackClient}), links, nil, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(userID))
+	router.POST("/messages/:id/resend-notification", handler.ResendNotification)
+	return router
+}
+
+func TestResendNotification_RateLimited(t *testing.T) {
+	dms := make(chan string, 10)
+	slackAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chat.postMessage" {
+			body, _ := io.ReadAll(r.Body)
+			dms <- string(body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ok":true,"user":{"id":"U1"},"channel":{"id":"D1"}}`)
+	}))
+	t.Cleanup(slackAPI.Close)
+	router := resendRouter(t, 1, slackAPI.URL, nil)
+
+	w := postNotification(router, "/messages/msg-1/resend-notification", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response models.ResendNotificationResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, models.NotificationChannelSlack, response.Channel)
+	assert.Contains(t, <-dms, "http://localhost:5173/m/msg-1#test-key")
+
+	// Once per resend interval
+	w = postNotification(router, "/messages/msg-1/resend-notification", nil)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), models.ErrorCodeQuotaExceeded)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+}
+
+func TestResendNotification_Refused(t *testing.T) {
+	slackAPI, calls := newFakeSlackAPI(t)
+
+	tests := []struct {
+		name   string
+		userID int64
+		change func(m *models.MessageMetadata)
+		status int
+		code   string
+	}{
+		{"recipient", 2, nil, http.StatusForbidden, models.ErrorCodeForbidden},
+		{"read", 1, func(m *models.MessageMetadata) { m.Status = models.StatusRead }, http.StatusGone, models.ErrorCodeMessageAlreadyRead},
+		{"expired", 1, func(m *models.MessageMetadata) { m.ExpiresAt = time.Now().Add(-time.Minute) }, http.StatusNotFound, models.ErrorCodeMessageNotFound},
+		{"zero-knowledge", 1, func(m *models.MessageMetadata) { m.EncryptionKey = "" }, http.StatusConflict, models.ErrorCodeCannotResend},
+		{"sealed key", 1, func(m *models.MessageMetadata) { m.EncryptionKey, m.SealedKey = "", "sealed" }, http.StatusConflict, models.ErrorCodeCannotResend},
+		{"scheduled", 1, func(m *models.MessageMetadata) {
+			release := time.Now().Add(time.Hour)
+			m.AvailableAt = &release
+		}, http.StatusTooEarly, models.ErrorCodeNotYetAvailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := resendRouter(t, tt.userID, slackAPI.URL, tt.change)
+
+			w := postNotification(router, "/messages/msg-1/resend-notification", nil)
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			assert.Contains(t, w.Body.String(), tt.code)
+		})
+	}
+	assert.Zero(t, atomic.LoadInt32(calls))
+}
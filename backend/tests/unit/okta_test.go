@@ -0,0 +1,209 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/auth"
+	"github.com/milkiss/vanish/backend/internal/integrations/okta"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOkta serves OIDC discovery plus scripted introspect/userinfo responses
+// Each handler receives the 1-based call number for its endpoint
+type fakeOkta struct {
+	server         *httptest.Server
+	introspect     func(w http.ResponseWriter, call int32)
+	userinfo       func(w http.ResponseWriter, call int32)
+	introspectHits int32
+	userinfoHits   int32
+}
+
+func newFakeOkta(t *testing.T) *fakeOkta {
+	f := &fakeOkta{
+		introspect: func(w http.ResponseWriter, _ int32) { fmt.Fprint(w, `{"active":true,"sub":"00u1"}`) },
+		userinfo: func(w http.ResponseWriter, _ int32) {
+			fmt.Fprint(w, `{"sub":"00u1","email":"okta.user@example.com","name":"Okta User"}`)
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                f.server.URL,
+			"authorization_endpoint":                f.server.URL + "/oauth2/v1/authorize",
+			"token_endpoint":                        f.server.URL + "/oauth2/v1/token",
+			"jwks_uri":                              f.server.URL + "/oauth2/v1/keys",
+			"userinfo_endpoint":                     f.server.URL + "/oauth2/v1/userinfo",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/oauth2/default/v1/introspect", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		f.introspect(w, atomic.AddInt32(&f.introspectHits, 1))
+	})
+	mux.HandleFunc("/oauth2/default/v1/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		f.userinfo(w, atomic.AddInt32(&f.userinfoHits, 1))
+	})
+
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeOkta) client(t *testing.T, timeout time.Duration) *okta.Client {
+	client, err := okta.NewClient(context.Background(), &okta.Config{
+		Domain:   "example.okta.com",
+		ClientID: "client-id",
+		BaseURL:  f.server.URL,
+		Timeout:  timeout,
+	})
+	require.NoError(t, err)
+	return client
+}
+
+func status(code int) func(http.ResponseWriter, int32) {
+	return func(w http.ResponseWriter, _ int32) { w.WriteHeader(code) }
+}
+
+func TestOktaValidateAccessToken_Success(t *testing.T) {
+	f := newFakeOkta(t)
+
+	info, err := f.client(t, time.Second).ValidateAccessToken(context.Background(), "token")
+
+	require.NoError(t, err)
+	assert.Equal(t, "okta.user@example.com", info.Email)
+}
+
+func TestOktaValidateAccessToken_FailureModes(t *testing.T) {
+	tests := []struct {
+		name           string
+		introspect     func(http.ResponseWriter, int32)
+		userinfo       func(http.ResponseWriter, int32)
+		endpoint       string
+		status         int
+		introspectHits int32
+	}{
+		{"introspect 502 twice", status(http.StatusBadGateway), nil, "introspect", http.StatusBadGateway, 2},
+		{"introspect 400 not retried", status(http.StatusBadRequest), nil, "introspect", http.StatusBadRequest, 1},
+		{"introspect 401 bad client credentials", status(http.StatusUnauthorized), nil, "introspect", http.StatusUnauthorized, 1},
+		{"userinfo 401", nil, status(http.StatusUnauthorized), "userinfo", http.StatusUnauthorized, 1},
+		{"userinfo 500 twice", nil, status(http.StatusInternalServerError), "userinfo", http.StatusInternalServerError, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeOkta(t)
+			if tt.introspect != nil {
+				f.introspect = tt.introspect
+			}
+			if tt.userinfo != nil {
+				f.userinfo = tt.userinfo
+			}
+
+			_, err := f.client(t, time.Second).ValidateAccessToken(context.Background(), "token")
+
+			var statusErr *okta.StatusError
+			require.ErrorAs(t, err, &statusErr)
+			assert.Equal(t, tt.endpoint, statusErr.Endpoint)
+			assert.Equal(t, tt.status, statusErr.StatusCode)
+			assert.NotErrorIs(t, err, okta.ErrTokenInactive)
+			assert.Equal(t, tt.introspectHits, atomic.LoadInt32(&f.introspectHits))
+		})
+	}
+}
+
+func TestOktaValidateAccessToken_RetriesOnce(t *testing.T) {
+	f := newFakeOkta(t)
+	f.introspect = func(w http.ResponseWriter, call int32) {
+		if call == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"active":true}`)
+	}
+
+	info, err := f.client(t, time.Second).ValidateAccessToken(context.Background(), "token")
+
+	require.NoError(t, err)
+	assert.Equal(t, "okta.user@example.com", info.Email)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&f.introspectHits))
+}
+
+func TestOktaValidateAccessToken_Inactive(t *testing.T) {
+	f := newFakeOkta(t)
+	f.introspect = func(w http.ResponseWriter, _ int32) { fmt.Fprint(w, `{"active":false}`) }
+
+	_, err := f.client(t, time.Second).ValidateAccessToken(context.Background(), "token")
+
+	assert.ErrorIs(t, err, okta.ErrTokenInactive)
+	assert.Zero(t, atomic.LoadInt32(&f.userinfoHits))
+}
+
+func TestOktaValidateAccessToken_MalformedBody(t *testing.T) {
+	f := newFakeOkta(t)
+	f.introspect = func(w http.ResponseWriter, _ int32) { fmt.Fprint(w, `<html>gateway</html>`) }
+
+	_, err := f.client(t, time.Second).ValidateAccessToken(context.Background(), "token")
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "okta introspect")
+}
+
+func TestOktaValidateAccessToken_Timeout(t *testing.T) {
+	f := newFakeOkta(t)
+	client := f.client(t, 100*time.Millisecond)
+	f.introspect = func(w http.ResponseWriter, _ int32) {
+		time.Sleep(500 * time.Millisecond)
+		fmt.Fprint(w, `{"active":true}`)
+	}
+
+	start := time.Now()
+	_, err := client.ValidateAccessToken(context.Background(), "token")
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "okta introspect")
+	assert.Less(t, time.Since(start), 400*time.Millisecond)
+}
+
+func TestValidateOktaToken_UpstreamFailureIsNotUnauthorized(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		introspect func(http.ResponseWriter, int32)
+		expected   int
+	}{
+		{"okta down", status(http.StatusBadGateway), http.StatusBadGateway},
+		{"token inactive", func(w http.ResponseWriter, _ int32) { fmt.Fprint(w, `{"active":false}`) }, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeOkta(t)
+			f.introspect = tt.introspect
+			handler := api.NewOktaHandler(api.NewIntegrations(api.IntegrationClients{Okta: f.client(t, time.Second)}), fakes.NewUserStore(), auth.NewJWTManager("test-secret", time.Hour), nil)
+
+			router := gin.New()
+			router.GET("/okta/validate", handler.ValidateOktaToken)
+
+			req, _ := http.NewRequest("GET", "/okta/validate", nil)
+			req.Header.Set("Authorization", "Bearer token")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expected, w.Code)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package unit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/openapi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetOpenAPISpec(t *testing.T) {
+	router, err := api.SetupRouter(testDependencies())
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest("GET", "/api/openapi.json", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+
+	var spec map[string]interface{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &spec))
+	assert.Equal(t, "3.0.3", spec["openapi"])
+	assert.NotEmpty(t, spec["paths"])
+}
+
+func TestOpenAPISpec_DocumentsEveryRoute(t *testing.T) {
+	router, err := api.SetupRouter(testDependencies())
+	require.NoError(t, err)
+
+	validator, err := openapi.NewValidator()
+	require.NoError(t, err)
+
+	for _, route := range router.Routes() {
+		// Legacy aliases are validated as their /api/v1 equivalent
+		if strings.HasPrefix(route.Path, api.APIVersionPrefix+"/") || route.Path == "/health" {
+			path := strings.ReplaceAll(route.Path, ":id", "1")
+			assert.True(t, validator.HasOperation(route.Method, path), "%s %s is not in openapi.yaml", route.Method, route.Path)
+		}
+	}
+}
+
+func TestOpenAPIValidator_DetectsDrift(t *testing.T) {
+	validator, err := openapi.NewValidator()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		status  int
+		body    string
+		wantErr bool
+	}{
+		{"valid user", "GET", "/api/v1/auth/me", 200, `{"id":1,"email":"a@example.com","name":"A","is_admin":false}`, false},
+		{"legacy alias", "GET", "/api/auth/me", 200, `{"id":1,"email":"a@example.com","name":"A","is_admin":false}`, false},
+		{"missing field", "GET", "/api/v1/auth/me", 200, `{"id":1,"email":"a@example.com","name":"A"}`, true},
+		{"undocumented field", "GET", "/api/v1/auth/me", 200, `{"id":1,"email":"a@example.com","name":"A","is_admin":false,"password":"x"}`, true},
+		{"wrong type", "GET", "/api/v1/auth/me", 200, `{"id":"1","email":"a@example.com","name":"A","is_admin":false}`, true},
+		{"bad enum", "GET", "/api/v1/history", 200, `[{"message_id":"m","sender_name":"","recipient_name":"","status":"lost","created_at":"2024-01-01T00:00:00Z","expires_at":"2024-01-02T00:00:00Z","is_sender":true,"is_recipient":false}]`, true},
+		{"history page", "GET", "/api/v1/history", 200, `{"messages":[],"next_cursor":"c"}`, false},
+		{"undocumented page field", "GET", "/api/v1/history", 200, `{"messages":[],"cursor":"c"}`, true},
+		{"undocumented status", "GET", "/api/v1/auth/me", 418, `{"error":"teapot"}`, true},
+		{"undocumented route", "GET", "/api/v1/nope", 200, `{}`, true},
+		{"unknown route 404", "GET", "/api/v1/nope", 404, `404 page not found`, false},
+		{"admin literal path", "POST", "/api/v1/admin/users/import", 200, `{"created":1,"failed":0,"errors":[]}`, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validator.ValidateResponse(tt.method, tt.path, tt.status, "application/json; charset=utf-8", []byte(tt.body))
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// orphanFixture stores messages with metadata, orphans older than an hour
+// and orphans created just now, enough of them to need several batches
+type orphanFixture struct {
+	store    *fakes.Storage
+	metadata *fakes.MetadataStore
+	kept     []string // with metadata
+	orphans  []string // without metadata, two hours old
+	recent   []string // without metadata, just stored
+}
+
+func newOrphanFixture(t *testing.T, metadata *fakes.MetadataStore) *orphanFixture {
+	t.Helper()
+	ctx := context.Background()
+	f := &orphanFixture{store: fakes.NewStorage(), metadata: metadata}
+	store := func(createdAt time.Time) string {
+		id, err := f.store.Store(ctx, &models.Message{Ciphertext: "c", IV: "iv", CreatedAt: createdAt}, 24*time.Hour)
+		require.NoError(t, err)
+		return id
+	}
+
+	for i := 0; i < 250; i++ {
+		id := store(time.Now().Add(-2 * time.Hour))
+		seedMessage(t, metadata, id, 1, 2)
+		f.kept = append(f.kept, id)
+	}
+	for i := 0; i < 150; i++ {
+		f.orphans = append(f.orphans, store(time.Now().Add(-2*time.Hour)))
+	}
+	// Stored before messages recorded when; old enough by definition
+	f.orphans = append(f.orphans, store(time.Time{}))
+	for i := 0; i < 3; i++ {
+		f.recent = append(f.recent, store(time.Now()))
+	}
+	return f
+}
+
+func (f *orphanFixture) exists(t *testing.T, id string) bool {
+	ok, err := f.store.Exists(context.Background(), id)
+	require.NoError(t, err)
+	return ok
+}
+
+func TestOrphanScanner(t *testing.T) {
+	users := fakes.NewUserStore()
+	f := newOrphanFixture(t, fakes.NewMetadataStore(users))
+	scanner := api.NewOrphanScanner(f.store, f.metadata, time.Hour)
+	ctx := context.Background()
+
+	report, err := scanner.Scan(ctx, false)
+	require.NoError(t, err)
+	assert.EqualValues(t, 404, report.Scanned)
+	assert.EqualValues(t, 151, report.Orphans)
+	assert.EqualValues(t, 3, report.Recent)
+	assert.Zero(t, report.Deleted)
+	assert.EqualValues(t, 3600, report.GracePeriodSeconds)
+	assert.Equal(t, 404, f.store.Len(), "a report deletes nothing")
+
+	report, err = scanner.Scan(ctx, true)
+	require.NoError(t, err)
+	assert.EqualValues(t, 151, report.Deleted)
+	for _, id := range f.orphans {
+		assert.False(t, f.exists(t, id), "orphan %s deleted", id)
+	}
+	for _, id := range append(f.kept, f.recent...) {
+		assert.True(t, f.exists(t, id), "message %s kept", id)
+	}
+
+	report, err = scanner.Scan(ctx, true)
+	require.NoError(t, err)
+	assert.EqualValues(t, 253, report.Scanned)
+	assert.Zero(t, report.Orphans)
+}
+
+func TestOrphanScanner_StopsWhenCancelled(t *testing.T) {
+	users := fakes.NewUserStore()
+	f := newOrphanFixture(t, fakes.NewMetadataStore(users))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	report, err := api.NewOrphanScanner(f.store, f.metadata, time.Hour).Scan(ctx, true)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, report.Scanned, int64(404), "the scan stops after the batch in progress")
+}
+
+func TestScanOrphans_Endpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	deps := testDependencies()
+	deps.Config.Message.OrphanGracePeriod = time.Hour
+	metadata := deps.MetadataStore.(*fakes.MetadataStore)
+	f := newOrphanFixture(t, metadata)
+	deps.Storage = f.store
+
+	ctx := context.Background()
+	admin := &models.User{Email: "admin@example.com", Name: "Admin", IsAdmin: true}
+	user := &models.User{Email: "user@example.com", Name: "User"}
+	require.NoError(t, deps.UserStore.Create(ctx, admin))
+	require.NoError(t, deps.UserStore.Create(ctx, user))
+	router, err := api.SetupRouter(deps)
+	require.NoError(t, err)
+
+	scan := func(u *models.User, query string) *httptest.ResponseRecorder {
+		token, err := deps.JWTManager.Generate(u.ID, u.Email)
+		require.NoError(t, err)
+		req, _ := http.NewRequest("POST", "/api/v1/admin/maintenance/scan-orphans"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusForbidden, scan(user, "").Code)
+	assert.Equal(t, http.StatusBadRequest, scan(admin, "?delete=maybe").Code)
+
+	w := scan(admin, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var report models.OrphanScanReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.EqualValues(t, 151, report.Orphans)
+	assert.Zero(t, report.Deleted)
+
+	w = scan(admin, "?delete=true")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.EqualValues(t, 151, report.Deleted)
+	assert.Equal(t, len(f.kept)+len(f.recent), f.store.Len())
+}
@@ -0,0 +1,226 @@
+package unit
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportData_AllMessagesWithoutKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	users := seedUsers(t)
+	require.NoError(t, users.Create(context.Background(), &models.User{Email: "other@example.com", Name: "Other"}))
+	metadataStore := fakes.NewMetadataStore(users)
+
+	// More than one export page, in both directions, plus a message the
+	// caller has nothing to do with
+	for i := 0; i < 130; i++ {
+		seedMessage(t, metadataStore, fmt.Sprintf("sent-%d", i), 1, 2)
+	}
+	for i := 0; i < 20; i++ {
+		seedMessage(t, metadataStore, fmt.Sprintf("received-%d", i), 2, 1)
+	}
+	seedMessage(t, metadataStore, "unrelated", 2, 3)
+
+	handler := api.NewProfileHandler(users, metadataStore, fakes.NewStorage())
+	router := gin.New()
+	router.Use(authAs(1))
+	router.GET("/profile/export", handler.ExportData)
+
+	w := requestAs(router, "GET", "/profile/export", 1)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+	assert.NotContains(t, w.Body.String(), "test-key")
+	assert.NotContains(t, w.Body.String(), "password")
+
+	var export struct {
+		Profile  models.User              `json:"profile"`
+		Messages []models.MessageMetadata `json:"messages"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &export))
+	assert.Equal(t, "sender@example.com", export.Profile.Email)
+	require.Len(t, export.Messages, 150)
+
+	seen := make(map[string]bool)
+	for _, m := range export.Messages {
+		assert.False(t, seen[m.MessageID], "duplicate %s", m.MessageID)
+		seen[m.MessageID] = true
+	}
+	assert.False(t, seen["unrelated"])
+	assert.Equal(t, "Recipient", export.Messages[0].RecipientName)
+}
+
+func TestExportData_OncePerHour(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	users := seedUsers(t)
+	handler := api.NewProfileHandler(users, fakes.NewMetadataStore(users), fakes.NewStorage())
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		userID, _ := strconv.ParseInt(c.GetHeader("X-Test-User"), 10, 64)
+		c.Set("user_id", userID)
+		c.Next()
+	})
+	router.GET("/profile/export", handler.ExportData)
+
+	require.Equal(t, http.StatusOK, requestAs(router, "GET", "/profile/export", 1).Code)
+
+	w := requestAs(router, "GET", "/profile/export", 1)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+	require.NoError(t, err)
+	assert.InDelta(t, 3600, retryAfter, 5)
+
+	// The limit is per user
+	assert.Equal(t, http.StatusOK, requestAs(router, "GET", "/profile/export", 2).Code)
+
+	// A failed export does not use up the user's slot
+	assert.Equal(t, http.StatusNotFound, requestAs(router, "GET", "/profile/export", 99).Code)
+	assert.Equal(t, http.StatusNotFound, requestAs(router, "GET", "/profile/export", 99).Code)
+}
+
+func TestUpdatePublicKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	users := seedUsers(t)
+	handler := api.NewProfileHandler(users, fakes.NewMetadataStore(users), fakes.NewStorage())
+
+	router := gin.New()
+	router.Use(authAs(2))
+	router.PUT("/profile/publickey", handler.UpdatePublicKey)
+
+	put := func(key string) int {
+		req, _ := http.NewRequest("PUT", "/profile/publickey", strings.NewReader(`{"public_key":"`+key+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	publicKeyOf := func(id int64) string {
+		list, err := users.ListAll(ctx)
+		require.NoError(t, err)
+		for _, u := range list {
+			if u.ID == id {
+				return u.PublicKey
+			}
+		}
+		return ""
+	}
+
+	key := base64.URLEncoding.EncodeToString(make([]byte, models.PublicKeySize))
+	require.Equal(t, http.StatusOK, put(key))
+	assert.Equal(t, key, publicKeyOf(2))
+	assert.Empty(t, publicKeyOf(1))
+
+	assert.Equal(t, http.StatusBadRequest, put(base64.URLEncoding.EncodeToString([]byte("short"))))
+	assert.Equal(t, http.StatusBadRequest, put("not base64!"))
+	assert.Equal(t, key, publicKeyOf(2), "a rejected key keeps the old one")
+
+	require.Equal(t, http.StatusOK, put(""))
+	assert.Empty(t, publicKeyOf(2))
+}
+
+func TestDeleteAccount_AnonymizesAndKeepsCounterpartHistory(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	deps := testDependencies()
+	store := fakes.NewStorage()
+	deps.Storage = store
+	metadataStore := deps.MetadataStore.(*fakes.MetadataStore)
+
+	hashed, err := models.HashPassword("password123")
+	require.NoError(t, err)
+	for _, u := range []*models.User{
+		{Email: "leaver@example.com", Name: "Leaver", Password: hashed},
+		{Email: "stayer@example.com", Name: "Stayer", Password: hashed},
+	} {
+		require.NoError(t, deps.UserStore.Create(ctx, u))
+	}
+
+	pendingID, err := store.Store(ctx, &models.Message{Ciphertext: "c", IV: "iv"}, time.Hour)
+	require.NoError(t, err)
+	seedMessage(t, metadataStore, pendingID, 1, 2)
+	seedMessage(t, metadataStore, "already-read", 2, 1)
+	require.NoError(t, metadataStore.MarkAsRead(ctx, "already-read"))
+
+	call := apiRouter(t, deps)
+	leaverToken, _ := deps.JWTManager.Generate(1, "leaver@example.com")
+	stayerToken, _ := deps.JWTManager.Generate(2, "stayer@example.com")
+
+	require.Equal(t, http.StatusOK, call("DELETE", "/api/v1/profile", leaverToken, `{"password":"password123"}`).Code)
+
+	// Tokens and credentials are gone
+	assert.Equal(t, http.StatusUnauthorized, call("GET", "/api/v1/auth/me", leaverToken, "").Code)
+	assert.Equal(t, http.StatusUnauthorized,
+		call("POST", "/api/v1/auth/login", "", `{"email":"leaver@example.com","password":"password123"}`).Code)
+
+	// The pending message was expired and burned
+	exists, err := store.Exists(ctx, pendingID)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	// The counterpart still sees both exchanges, attributed to a tombstone
+	w := call("GET", "/api/v1/history", stayerToken, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var history []models.MessageHistoryResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	require.Len(t, history, 2)
+	for _, h := range history {
+		if h.IsRecipient {
+			assert.Equal(t, models.DeletedUserName, h.SenderName)
+			assert.Equal(t, models.StatusExpired, h.Status)
+			assert.Empty(t, h.EncryptionKey)
+		} else {
+			assert.Equal(t, models.DeletedUserName, h.RecipientName)
+			assert.Equal(t, models.StatusRead, h.Status)
+		}
+	}
+	assert.NotContains(t, w.Body.String(), "leaver@example.com")
+
+	// And can no longer pick the deleted account as a recipient
+	w = call("GET", "/api/v1/users", stayerToken, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), models.DeletedUserName)
+}
+
+func TestAdminDeleteAndPurgeUser(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	users := seedUsers(t)
+	handler := api.NewAdminHandler(users, fakes.NewMetadataStore(users), fakes.NewStorage(), nil, &config.Config{}, nil, nil)
+
+	router := gin.New()
+	router.Use(authAs(1))
+	router.DELETE("/admin/users/:id", handler.DeleteUser)
+	router.DELETE("/admin/users/:id/purge", handler.PurgeUser)
+
+	require.Equal(t, http.StatusOK, requestAs(router, "DELETE", "/admin/users/2", 1).Code)
+	tombstone, err := users.FindByID(ctx, 2)
+	require.NoError(t, err, "delete keeps the row")
+	assert.False(t, tombstone.IsActive)
+	assert.Equal(t, models.DeletedUserName, tombstone.Name)
+	assert.NotContains(t, tombstone.Email, "recipient")
+
+	require.Equal(t, http.StatusOK, requestAs(router, "DELETE", "/admin/users/2/purge", 1).Code)
+	_, err = users.FindByID(ctx, 2)
+	assert.Error(t, err, "purge removes the row")
+
+	assert.Equal(t, http.StatusNotFound, requestAs(router, "DELETE", "/admin/users/2", 1).Code)
+	assert.Equal(t, http.StatusBadRequest, requestAs(router, "DELETE", "/admin/users/1/purge", 1).Code)
+}
@@ -0,0 +1,126 @@
+package unit
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/requestid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureLogs sends the default logger to a buffer for the rest of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &logs
+}
+
+// panicRouter serves a route that panics behind the production recovery
+func panicRouter(alerts *api.PanicAlerter) *gin.Engine {
+	router := api.SetupGinWithNoLogging(alerts)
+	router.Use(api.RequestIDMiddleware())
+	router.POST("/boom/:id", func(c *gin.Context) {
+		panic("nil map in handler")
+	})
+	return router
+}
+
+func TestRecovery_PanicBecomesStructured500(t *testing.T) {
+	logs := captureLogs(t)
+	router := panicRouter(nil)
+	before := api.PanicCount()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/boom/k3j5h2g4", strings.NewReader(`{"ciphertext":"do-not-log-me"}`))
+	req.Header.Set(requestid.Header, "req-panic-1")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	var resp models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, models.ErrorCodeInternal, resp.Code)
+	assert.Equal(t, "req-panic-1", resp.RequestID)
+	assert.NotEmpty(t, resp.Error)
+	assert.Equal(t, before+1, api.PanicCount())
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &entry), logs.String())
+	assert.Equal(t, "handler panicked", entry["msg"])
+	assert.Equal(t, "ERROR", entry["level"])
+	assert.Equal(t, "req-panic-1", entry["request_id"])
+	assert.Equal(t, "/boom/:id", entry["route"])
+	assert.Equal(t, "nil map in handler", entry["panic"])
+	assert.Contains(t, entry["stack"], "recovery_test.go")
+	assert.NotContains(t, logs.String(), "do-not-log-me")
+	assert.NotContains(t, logs.String(), "k3j5h2g4", "the raw path holds message IDs")
+}
+
+func TestRecovery_AlertsWebhookOncePerInterval(t *testing.T) {
+	captureLogs(t)
+	received := make(chan models.PanicAlert, 4)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var alert models.PanicAlert
+		if err := json.NewDecoder(r.Body).Decode(&alert); err == nil {
+			received <- alert
+		}
+	}))
+	defer webhook.Close()
+
+	alerts := api.NewPanicAlerter(config.AlertConfig{OnPanic: true, WebhookURL: webhook.URL}, webhook.Client())
+	require.NotNil(t, alerts)
+	router := panicRouter(alerts)
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/boom/k3j5h2g4", nil))
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+	}
+
+	select {
+	case alert := <-received:
+		assert.Equal(t, "server.panic", alert.Event)
+		assert.Equal(t, "POST", alert.Method)
+		assert.Equal(t, "/boom/:id", alert.Route)
+		assert.Equal(t, "nil map in handler", alert.Panic)
+		assert.NotEmpty(t, alert.RequestID)
+		assert.Contains(t, alert.Text, "/boom/:id")
+	case <-time.After(5 * time.Second):
+		t.Fatal("no alert posted")
+	}
+	select {
+	case <-received:
+		t.Error("second panic within the interval was alerted")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	assert.Nil(t, api.NewPanicAlerter(config.AlertConfig{WebhookURL: webhook.URL}, nil), "off without ALERT_ON_PANIC")
+}
+
+func TestLoad_AlertOnPanicNeedsWebhook(t *testing.T) {
+	t.Setenv("ALERT_ON_PANIC", "true")
+	_, err := config.Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ALERT_WEBHOOK_URL")
+
+	t.Setenv("ALERT_WEBHOOK_URL", "http://10.0.0.5/panic")
+	_, err = config.Load()
+	require.Error(t, err, "internal webhooks are refused like the others")
+
+	t.Setenv("OUTBOUND_ALLOWED_NETWORKS", "10.0.0.0/8")
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	assert.True(t, cfg.Alert.OnPanic)
+}
@@ -0,0 +1,346 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/auth"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/integrations/okta"
+	"github.com/milkiss/vanish/backend/internal/messages"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/storage"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// regionClusters stands in for a default and an EU cluster with two
+// databases of the test Redis, emptied first; keys reads the raw keys of
+// a cluster
+type regionClusters struct {
+	store *storage.RegionalStorage
+	keys  map[string]*redis.Client
+}
+
+func setupRegionClusters(t *testing.T) *regionClusters {
+	t.Helper()
+	dbs := map[string]int{models.DefaultRegion: 2, "eu": 3}
+	clusters := &regionClusters{keys: make(map[string]*redis.Client)}
+	stores := make(map[string]storage.Storage)
+	for name, db := range dbs {
+		raw := redis.NewClient(&redis.Options{Addr: "localhost:6379", DB: db})
+		require.NoError(t, raw.FlushDB(context.Background()).Err())
+		t.Cleanup(func() { raw.Close() })
+		clusters.keys[name] = raw
+
+		store, err := storage.NewRedisStorage("localhost:6379", "", db)
+		require.NoError(t, err, "Failed to connect to test Redis")
+		stores[name] = store
+	}
+	defaultStore := stores[models.DefaultRegion]
+	delete(stores, models.DefaultRegion)
+	clusters.store = storage.NewRegionalStorage(defaultStore, stores)
+	t.Cleanup(func() { clusters.store.Close() })
+	return clusters
+}
+
+// holds reports whether the cluster keeps the message stored under the
+// ID the cluster gave it
+func (r *regionClusters) holds(t *testing.T, cluster, clusterID string) bool {
+	n, err := r.keys[cluster].Exists(context.Background(), "vanish:message:"+clusterID).Result()
+	require.NoError(t, err)
+	return n == 1
+}
+
+func TestRegionOf(t *testing.T) {
+	id := strings.Repeat("a", storage.IDLength)
+	tests := []struct {
+		id, want string
+	}{
+		{id, ""},
+		{"eu_" + id, "eu"},
+		{"apac2_" + id, "apac2"},
+		{"EU_" + id, ""},
+		{"default_" + id, ""},
+		{"eu_" + id[1:], ""},
+		{"eu_" + strings.Repeat("A", storage.IDLength), ""},
+		{"eu_4Zq-_Xw8AbCdEfGhIjKlMn==", ""}, // legacy base64url ID
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, storage.RegionOf(tt.id), tt.id)
+	}
+}
+
+func TestRegionalStorage_KeepsMessagesInTheirRegion(t *testing.T) {
+	clusters := setupRegionClusters(t)
+	ctx := context.Background()
+	msg := func(region string) *models.Message {
+		return &models.Message{Ciphertext: "c-" + region, IV: "iv", Region: region, CreatedAt: time.Now().UTC()}
+	}
+
+	euID, err := clusters.store.Store(ctx, msg("eu"), time.Hour)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(euID, "eu_"), euID)
+	assert.True(t, storage.ValidID(euID))
+	assert.Equal(t, "eu", storage.RegionOf(euID))
+	clusterID := strings.TrimPrefix(euID, "eu_")
+	assert.True(t, clusters.holds(t, "eu", clusterID))
+	assert.False(t, clusters.holds(t, models.DefaultRegion, clusterID), "EU ciphertext must not reach the default cluster")
+
+	defaultID, err := clusters.store.Store(ctx, msg(""), time.Hour)
+	require.NoError(t, err)
+	assert.Empty(t, storage.RegionOf(defaultID))
+	assert.True(t, clusters.holds(t, models.DefaultRegion, defaultID))
+	assert.False(t, clusters.holds(t, "eu", defaultID))
+
+	_, err = clusters.store.Store(ctx, msg("us"), time.Hour)
+	assert.ErrorIs(t, err, storage.ErrUnknownRegion, "a region without a cluster is refused, not stored elsewhere")
+
+	// Reads route by the ID alone
+	exists, err := clusters.store.Exists(ctx, euID)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	ttl, err := clusters.store.GetTTL(ctx, euID)
+	require.NoError(t, err)
+	assert.Greater(t, ttl, 59*time.Minute)
+	read, err := clusters.store.GetAndDelete(ctx, euID)
+	require.NoError(t, err)
+	assert.Equal(t, "c-eu", read.Ciphertext)
+	_, err = clusters.store.GetAndDelete(ctx, euID)
+	assert.ErrorIs(t, err, models.ErrMessageNotFound)
+
+	// Claims stay in the region of their message
+	claimID, err := clusters.store.Store(ctx, msg("eu"), time.Hour)
+	require.NoError(t, err)
+	token, _, err := clusters.store.Claim(ctx, claimID, 7, time.Minute)
+	require.NoError(t, err)
+	for cluster, want := range map[string]int64{"eu": 1, models.DefaultRegion: 0} {
+		n, err := clusters.keys[cluster].Exists(ctx, "vanish:claim:"+strings.TrimPrefix(claimID, "eu_")).Result()
+		require.NoError(t, err)
+		assert.Equal(t, want, n, cluster)
+	}
+	claimed, err := clusters.store.FetchClaim(ctx, claimID, 7, token)
+	require.NoError(t, err)
+	assert.Equal(t, "c-eu", claimed.Ciphertext)
+
+	// One delete spans both clusters
+	deleted, err := clusters.store.Delete(ctx, []string{defaultID, euID, "eu_" + strings.Repeat("b", storage.IDLength)})
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted, "only the default message was still stored")
+	assert.False(t, clusters.holds(t, models.DefaultRegion, defaultID))
+}
+
+func TestRegionalStorage_ScanListsEveryCluster(t *testing.T) {
+	clusters := setupRegionClusters(t)
+	ctx := context.Background()
+
+	stored := make(map[string]bool)
+	for i := 0; i < 6; i++ {
+		region := ""
+		if i%2 == 0 {
+			region = "eu"
+		}
+		id, err := clusters.store.Store(ctx, &models.Message{Ciphertext: "c", IV: "iv", Region: region, CreatedAt: time.Now().UTC()}, time.Hour)
+		require.NoError(t, err)
+		stored[id] = true
+	}
+
+	listed := make(map[string]bool)
+	var cursor uint64
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 1000, "the scan ends")
+		batch, next, err := clusters.store.Scan(ctx, cursor, 2)
+		require.NoError(t, err)
+		for _, m := range batch {
+			listed[m.ID] = true
+		}
+		if cursor = next; cursor == 0 {
+			break
+		}
+	}
+	assert.Equal(t, stored, listed, "IDs are listed as clients know them, with their region")
+}
+
+func TestRegionalStorage_PingChecksEveryCluster(t *testing.T) {
+	ctx := context.Background()
+	eu, err := storage.NewRedisStorage("localhost:6379", "", 3)
+	require.NoError(t, err)
+	store := storage.NewRegionalStorage(fakes.NewStorage(), map[string]storage.Storage{"eu": eu})
+	require.NoError(t, store.Ping(ctx))
+	assert.Equal(t, []string{"eu"}, store.Regions())
+
+	require.NoError(t, eu.Close())
+	err = store.Ping(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "region eu")
+}
+
+func TestMessageService_StoresInRecipientRegion(t *testing.T) {
+	users := seedUsers(t)
+	recipient, err := users.FindByID(context.Background(), 2)
+	require.NoError(t, err)
+	recipient.Region = "eu"
+	require.NoError(t, users.Update(context.Background(), recipient))
+
+	eu := fakes.NewStorage()
+	service := messages.NewService(storage.NewRegionalStorage(fakes.NewStorage(), map[string]storage.Storage{"eu": eu}),
+		fakes.NewMetadataStore(users), 0, users, nil)
+
+	metadata, err := service.CreateEncrypted(context.Background(), 1, 2, servicePayload, nil, messages.CreateOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "eu", storage.RegionOf(metadata.MessageID))
+	exists, err := eu.Exists(context.Background(), strings.TrimPrefix(metadata.MessageID, "eu_"))
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	// The read path finds it by ID without looking the region up
+	msg, _, err := service.Read(context.Background(), 2, metadata.MessageID)
+	require.NoError(t, err)
+	assert.Equal(t, servicePayload.Ciphertext, msg.Ciphertext)
+
+	// Moved to a region without a cluster: refused rather than stored elsewhere
+	recipient.Region = "us"
+	require.NoError(t, users.Update(context.Background(), recipient))
+	_, err = service.CreateEncrypted(context.Background(), 1, 2, servicePayload, nil, messages.CreateOptions{})
+	assertServiceError(t, err, models.ErrorCodeUnavailable)
+}
+
+func TestAdminStatistics_ByRegion(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	users := seedUsers(t)
+	metadataStore := fakes.NewMetadataStore(users)
+	id := strings.Repeat("a", storage.IDLength)
+	for i, messageID := range []string{id, "eu_" + id, "eu_" + strings.Repeat("b", storage.IDLength)} {
+		require.NoError(t, metadataStore.Create(context.Background(), &models.MessageMetadata{
+			MessageID: messageID, SenderID: 1, RecipientID: 2, Status: models.StatusPending,
+			CreatedAt: time.Now().Add(time.Duration(i) * time.Second), ExpiresAt: time.Now().Add(time.Hour),
+		}))
+	}
+	store := storage.NewRegionalStorage(fakes.NewStorage(), map[string]storage.Storage{"eu": fakes.NewStorage(), "us": fakes.NewStorage()})
+	handler := api.NewAdminHandler(users, metadataStore, store, nil, &config.Config{}, nil, nil)
+
+	router := gin.New()
+	router.GET("/admin/statistics", handler.GetStatistics)
+	req, _ := http.NewRequest("GET", "/admin/statistics", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var stats models.SystemStatistics
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, map[string]int{models.DefaultRegion: 1, "eu": 2, "us": 0}, stats.Messages.ByRegion)
+}
+
+func TestAdminUpdateUser_Region(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	users := seedUsers(t)
+	handler := api.NewAdminHandler(users, fakes.NewMetadataStore(users), fakes.NewStorage(), nil, &config.Config{}, nil, nil)
+	router := gin.New()
+	router.PUT("/admin/users/:id", handler.UpdateUser)
+
+	update := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PUT", "/admin/users/2", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := update(`{"region":"eu"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"region":"eu"`)
+
+	for _, invalid := range []string{"EU", "eu-west", "default", strings.Repeat("a", models.MaxRegionLength+1)} {
+		w = update(fmt.Sprintf(`{"region":%q}`, invalid))
+		assert.Equal(t, http.StatusBadRequest, w.Code, invalid)
+		assert.Contains(t, w.Body.String(), `"region"`, invalid)
+	}
+
+	w = update(`{"name":"Renamed"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	user, err := users.FindByID(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Equal(t, "eu", user.Region, "an update without region keeps it")
+
+	w = update(`{"region":""}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	user, err = users.FindByID(context.Background(), 2)
+	require.NoError(t, err)
+	assert.Empty(t, user.Region)
+}
+
+func TestOktaRegionClaim(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	f := newFakeOkta(t)
+	claim := `"EU"`
+	f.userinfo = func(w http.ResponseWriter, _ int32) {
+		fmt.Fprintf(w, `{"sub":"00u1","email":"okta.user@example.com","name":"Okta User","data_region":%s}`, claim)
+	}
+	client, err := okta.NewClient(context.Background(), &okta.Config{
+		Domain:      "example.okta.com",
+		ClientID:    "client-id",
+		BaseURL:     f.server.URL,
+		RegionClaim: "data_region",
+	})
+	require.NoError(t, err)
+	users := fakes.NewUserStore()
+	handler := api.NewOktaHandler(api.NewIntegrations(api.IntegrationClients{Okta: client}), users, auth.NewJWTManager("test-secret", time.Hour), nil)
+	router := gin.New()
+	router.GET("/okta/validate", handler.ValidateOktaToken)
+
+	region := func() string {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "/okta/validate", nil)
+		req.Header.Set("Authorization", "Bearer token")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		user, err := users.FindByEmail(context.Background(), "okta.user@example.com")
+		require.NoError(t, err)
+		return user.Region
+	}
+
+	assert.Equal(t, "eu", region(), "set on first sign-in")
+	claim = `"us"`
+	assert.Equal(t, "us", region(), "follows the claim")
+	claim = `"not a region!"`
+	assert.Equal(t, "us", region(), "an invalid claim is ignored")
+	claim = `null`
+	assert.Equal(t, "us", region(), "a missing claim keeps the region")
+}
+
+func TestLoad_RedisRegions(t *testing.T) {
+	t.Setenv("REDIS_REGIONS", "eu, us")
+	t.Setenv("REDIS_EU_ADDRESS", "redis-eu:6379")
+	t.Setenv("REDIS_EU_DB", "2")
+	t.Setenv("REDIS_US_ADDRESS", "redis-us:6379")
+	t.Setenv("REDIS_US_PASSWORD", "secret")
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	assert.Equal(t, []config.RedisRegion{
+		{Name: "eu", Address: "redis-eu:6379", DB: 2},
+		{Name: "us", Address: "redis-us:6379", Password: "secret"},
+	}, cfg.Redis.Regions)
+
+	t.Setenv("REDIS_US_ADDRESS", "")
+	_, err = config.Load()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "REDIS_US_ADDRESS")
+
+	for _, names := range []string{"eu,eu", "EU", "default"} {
+		t.Setenv("REDIS_REGIONS", names)
+		_, err = config.Load()
+		require.Error(t, err, names)
+		assert.Contains(t, err.Error(), "REDIS_REGIONS", names)
+	}
+}
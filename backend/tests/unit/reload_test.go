@@ -0,0 +1,106 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigReload_TogglesSlack(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	deps := testDependencies()
+	require.NoError(t, deps.UserStore.Create(ctx, &models.User{Email: "admin@example.com", Name: "Admin", IsAdmin: true}))
+
+	// Each reload reads whatever next holds, standing in for the environment
+	next := *deps.Config
+	var loadErr error
+	deps.Integrations = api.NewIntegrations(api.IntegrationClients{})
+	deps.Reloader = api.NewConfigReloader(deps.Config, func() (*config.Config, error) {
+		cfg := next
+		return &cfg, loadErr
+	}, deps.Integrations)
+	router, err := api.SetupRouter(deps)
+	require.NoError(t, err)
+
+	call := func(method, path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(""))
+		token, _ := deps.JWTManager.Generate(1, "admin@example.com")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	reload := func() api.ReloadResult {
+		w := call("POST", "/api/v1/admin/reload")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var result api.ReloadResult
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		return result
+	}
+	slackEnabled := func() bool {
+		var settings api.AdminSettingsResponse
+		require.NoError(t, json.Unmarshal(call("GET", "/api/v1/admin/settings").Body.Bytes(), &settings))
+		return settings.Slack.Enabled
+	}
+
+	// Disabled: the Slack routes are mounted but refuse
+	assert.Equal(t, http.StatusServiceUnavailable, call("POST", "/api/v1/slack/commands").Code)
+	assert.False(t, slackEnabled())
+
+	// Enabled by a reload: unsigned requests now reach the signature check
+	next.Slack = config.SlackConfig{Enabled: true, BotToken: "xoxb-test", SigningSecret: "reload-secret"}
+	next.JWT.TokenDuration = 48
+	result := reload()
+	assert.ElementsMatch(t, []string{"SLACK_ENABLED", "SLACK_BOT_TOKEN", "SLACK_SIGNING_SECRET"}, result.Applied)
+	assert.Equal(t, []string{"JWT_DURATION"}, result.RequiresRestart)
+	assert.Equal(t, http.StatusUnauthorized, call("POST", "/api/v1/slack/commands").Code)
+	assert.True(t, slackEnabled())
+	assert.Zero(t, deps.Reloader.Current().JWT.TokenDuration, "settings needing a restart must not change")
+
+	// A failing load keeps what is in effect
+	loadErr = errors.New("SLACK_BOT_TOKEN is required")
+	w := call("POST", "/api/v1/admin/reload")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Contains(t, w.Body.String(), models.ErrorCodeReloadFailed)
+	assert.Equal(t, http.StatusUnauthorized, call("POST", "/api/v1/slack/commands").Code)
+
+	// Disabled again
+	loadErr = nil
+	next.Slack = config.SlackConfig{}
+	reload()
+	assert.Equal(t, http.StatusServiceUnavailable, call("POST", "/api/v1/slack/commands").Code)
+	assert.False(t, slackEnabled())
+}
+
+func TestConfigDiff(t *testing.T) {
+	old := &config.Config{}
+	old.Slack.Enabled = true
+	old.Slack.BotToken = "xoxb-old"
+	old.Server.Port = "8080"
+
+	next := *old
+	next.Slack.BotToken = "xoxb-new"
+	next.Server.Port = "9090"
+
+	changes := config.Diff(old, &next)
+	require.Len(t, changes, 2)
+
+	assert.Equal(t, config.Change{Key: "SERVER_PORT", Old: "8080", New: "9090"}, changes[0])
+	// Secret values are never reported
+	assert.Equal(t, config.Change{Key: "SLACK_BOT_TOKEN", Secret: true, Reloadable: true}, changes[1])
+
+	assert.Empty(t, config.Diff(old, old))
+}
@@ -0,0 +1,280 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/auth"
+	"github.com/milkiss/vanish/backend/internal/buildinfo"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testDependencies returns a complete set of in-memory router dependencies
+func testDependencies() api.Dependencies {
+	users := fakes.NewUserStore()
+	return api.Dependencies{
+		Config: &config.Config{
+			Server: config.ServerConfig{
+				AllowedOrigins:  []string{"http://localhost:5173"},
+				FrontendBaseURL: "http://localhost:5173",
+			},
+		},
+		Storage:        &mockStorage{},
+		UserStore:      users,
+		MetadataStore:  fakes.NewMetadataStore(users),
+		AccessLogStore: fakes.NewAccessLogStore(users),
+		JWTManager:     auth.NewJWTManager("test-secret-key", time.Hour),
+	}
+}
+
+// apiCall sends a JSON request to a router, with token as the bearer
+// token unless it is empty
+type apiCall func(method, path, token, body string) *httptest.ResponseRecorder
+
+// apiRouter serves the full API from deps and returns a caller for it
+func apiRouter(t *testing.T, deps api.Dependencies) apiCall {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	router, err := api.SetupRouter(deps)
+	require.NoError(t, err)
+
+	return func(method, path, token, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+}
+
+func TestSetupRouter_ValidDependencies(t *testing.T) {
+	router, err := api.SetupRouter(testDependencies())
+	require.NoError(t, err)
+	assert.NotNil(t, router)
+}
+
+func TestSetupRouter_MissingRequiredDependencies(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*api.Dependencies)
+	}{
+		{"config", func(d *api.Dependencies) { d.Config = nil }},
+		{"storage", func(d *api.Dependencies) { d.Storage = nil }},
+		{"user store", func(d *api.Dependencies) { d.UserStore = nil }},
+		{"metadata store", func(d *api.Dependencies) { d.MetadataStore = nil }},
+		{"access log store", func(d *api.Dependencies) { d.AccessLogStore = nil }},
+		{"jwt manager", func(d *api.Dependencies) { d.JWTManager = nil }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			deps := testDependencies()
+			tt.mutate(&deps)
+
+			router, err := api.SetupRouter(deps)
+			assert.Error(t, err)
+			assert.Nil(t, router)
+		})
+	}
+}
+
+func TestSetupRouter_VersionedAndLegacyPrefixes(t *testing.T) {
+	deps := testDependencies()
+	require.NoError(t, deps.UserStore.Create(context.Background(), &models.User{Email: "user@example.com", Name: "User"}))
+	token, err := deps.JWTManager.Generate(1, "user@example.com")
+	require.NoError(t, err)
+
+	router, err := api.SetupRouter(deps)
+	require.NoError(t, err)
+
+	get := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, path := range []string{"/auth/me", "/users", "/history"} {
+		t.Run(path, func(t *testing.T) {
+			current := get(api.APIVersionPrefix + path)
+			legacy := get(api.LegacyAPIPrefix + path)
+
+			assert.Equal(t, http.StatusOK, current.Code)
+			assert.Equal(t, current.Code, legacy.Code)
+			assert.JSONEq(t, current.Body.String(), legacy.Body.String())
+
+			assert.Equal(t, api.APIVersion, current.Header().Get(api.APIVersionHeader))
+			assert.Equal(t, api.APIVersion, legacy.Header().Get(api.APIVersionHeader))
+
+			assert.Empty(t, current.Header().Get("Deprecation"))
+			assert.Equal(t, "true", legacy.Header().Get("Deprecation"))
+			assert.Equal(t, "<"+api.APIVersionPrefix+path+`>; rel="successor-version"`, legacy.Header().Get("Link"))
+		})
+	}
+}
+
+func TestSetupRouter_VersionHeaderOnNotFound(t *testing.T) {
+	router, err := api.SetupRouter(testDependencies())
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest("GET", "/api/v1/does-not-exist", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, api.APIVersion, w.Header().Get(api.APIVersionHeader))
+}
+
+func TestSetupRouter_SCIMOnlyWhenEnabled(t *testing.T) {
+	router, err := api.SetupRouter(testDependencies())
+	require.NoError(t, err)
+	for _, route := range router.Routes() {
+		assert.NotContains(t, route.Path, "/scim/", "SCIM is off by default")
+	}
+
+	deps := testDependencies()
+	deps.Config.SCIM = config.SCIMConfig{Enabled: true, Token: "test-scim-token-0123456789abcdefghij"}
+	router, err = api.SetupRouter(deps)
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest("GET", "/scim/v2/Users", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestListAPIVersions(t *testing.T) {
+	router, err := api.SetupRouter(testDependencies())
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest("GET", "/api/versions", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response api.APIVersionsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, api.APIVersion, response.Current)
+
+	prefixes := map[string]api.APIVersionInfo{}
+	for _, v := range response.Versions {
+		prefixes[v.Prefix] = v
+	}
+	assert.Equal(t, "current", prefixes[api.APIVersionPrefix].Status)
+	assert.True(t, prefixes[api.LegacyAPIPrefix].Deprecated)
+	assert.Equal(t, api.APIVersionPrefix, prefixes[api.LegacyAPIPrefix].AliasOf)
+}
+
+func TestGetServerVersion(t *testing.T) {
+	defer func(v, c, d string) { buildinfo.Version, buildinfo.Commit, buildinfo.BuildDate = v, c, d }(
+		buildinfo.Version, buildinfo.Commit, buildinfo.BuildDate)
+	buildinfo.Version, buildinfo.Commit, buildinfo.BuildDate = "1.5.0", "abc1234", "2025-06-01T12:00:00Z"
+
+	deps := testDependencies()
+	deps.Config.Server.MinClientVersion = "1.2.0"
+	router, err := api.SetupRouter(deps)
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest("GET", "/api/version", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response api.ServerVersionResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "1.5.0", response.Version)
+	assert.Equal(t, "abc1234", response.Commit)
+	assert.Equal(t, "2025-06-01T12:00:00Z", response.BuildDate)
+	assert.Equal(t, api.APIVersion, response.APIVersion)
+	assert.Equal(t, "1.2.0", response.MinClientVersion)
+
+	// Every response names the release, not just /api/version
+	req, _ = http.NewRequest("GET", "/health", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "1.5.0", w.Header().Get(api.ServerVersionHeader))
+}
+
+// adminProbe sends path with the token of a new user, or none when admin
+// is nil, and returns the response
+func adminProbe(t *testing.T, stealth bool, admin *bool, path string) *httptest.ResponseRecorder {
+	deps := testDependencies()
+	deps.Config.Server.AdminStealthMode = stealth
+	router, err := api.SetupRouter(deps)
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest("GET", path, nil)
+	if admin != nil {
+		user := &models.User{Email: "probe@example.com", Name: "Probe", IsAdmin: *admin}
+		require.NoError(t, deps.UserStore.Create(context.Background(), user))
+		token, err := deps.JWTManager.Generate(user.ID, user.Email)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminMiddleware_ForbiddenByDefault(t *testing.T) {
+	regular, admin := false, true
+
+	w := adminProbe(t, false, &regular, "/api/v1/admin/statistics")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), models.ErrorCodeForbidden)
+
+	w = adminProbe(t, false, &admin, "/api/v1/admin/statistics")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = adminProbe(t, false, nil, "/api/v1/admin/statistics")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAdminMiddleware_StealthMode(t *testing.T) {
+	regular, admin := false, true
+
+	// A non-admin cannot tell an admin route from one that does not exist
+	unknown := adminProbe(t, true, &regular, "/api/v1/no-such-route")
+	require.Equal(t, http.StatusNotFound, unknown.Code)
+	for _, path := range []string{"/api/v1/admin/statistics", "/api/admin/users/by-email/a@example.com"} {
+		w := adminProbe(t, true, &regular, path)
+		assert.Equal(t, http.StatusNotFound, w.Code, path)
+		assert.Equal(t, unknown.Body.String(), w.Body.String(), path)
+		assert.Equal(t, unknown.Header().Get("Content-Type"), w.Header().Get("Content-Type"), path)
+	}
+
+	// Admins are unaffected, and callers without a token still get 401
+	w := adminProbe(t, true, &admin, "/api/v1/admin/statistics")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = adminProbe(t, true, nil, "/api/v1/admin/statistics")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestLoad_AdminStealthMode(t *testing.T) {
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	assert.False(t, cfg.Server.AdminStealthMode)
+
+	t.Setenv("ADMIN_STEALTH_MODE", "true")
+	cfg, err = config.Load()
+	require.NoError(t, err)
+	assert.True(t, cfg.Server.AdminStealthMode)
+}
@@ -0,0 +1,196 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/integrations/slack"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/urlbuilder"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingSlackAPI is a Slack API that passes the text of each DM to dms
+func recordingSlackAPI(t *testing.T) (*httptest.Server, chan string) {
+	dms := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/chat.postMessage" {
+			body, _ := io.ReadAll(r.Body)
+			dms <- string(body)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ok":true,"user":{"id":"U1"},"channel":{"id":"D1"}}`)
+	}))
+	t.Cleanup(server.Close)
+	return server, dms
+}
+
+func TestScheduledMessage_HeldUntilRelease(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	slackAPI, dms := recordingSlackAPI(t)
+
+	store := fakes.NewStorage()
+	deps := testDependencies()
+	deps.Storage = store
+	deps.Config.Slack.Enabled = true
+	deps.SlackClient = slack.NewClient(&slack.Config{BotToken: "xoxb-test", APIURL: slackAPI.URL})
+	require.NoError(t, deps.UserStore.Create(ctx, &models.User{Email: "sender@example.com", Name: "Sender"}))
+	require.NoError(t, deps.UserStore.Create(ctx, &models.User{Email: "recipient@example.com", Name: "Recipient"}))
+	router, err := api.SetupRouter(deps)
+	require.NoError(t, err)
+
+	call := func(method, path string, userID int64, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		token, _ := deps.JWTManager.Generate(userID, "user@example.com")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	availableAt := time.Now().UTC().Add(48 * time.Hour).Truncate(time.Second)
+	w := call("POST", "/api/v1/messages", 1, fmt.Sprintf(
+		`{"ciphertext":"Yw==","iv":"aXY=","recipient_id":2,"encryption_key":"k","ttl":3600,"available_at":%q}`,
+		availableAt.Format(time.RFC3339)))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.CreateMessageResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.NotNil(t, created.AvailableAt)
+	assert.True(t, availableAt.Equal(*created.AvailableAt))
+
+	// The TTL counts from the release, so Redis keeps the wait plus the TTL
+	assert.True(t, availableAt.Add(time.Hour).Equal(created.ExpiresAt))
+	ttl, err := store.GetTTL(ctx, created.ID)
+	require.NoError(t, err)
+	assert.InDelta(t, (49 * time.Hour).Seconds(), ttl.Seconds(), 5)
+
+	// The recipient gets 425 with the release time from every read path
+	for _, tt := range []struct{ method, path string }{
+		{"GET", "/api/v1/messages/" + created.ID},
+		{"GET", "/api/v1/messages/" + created.ID + "/preview"},
+		{"POST", "/api/v1/messages/" + created.ID + "/claim"},
+	} {
+		w := call(tt.method, tt.path, 2, "")
+		require.Equal(t, http.StatusTooEarly, w.Code, "%s %s: %s", tt.method, tt.path, w.Body.String())
+		var body models.NotYetAvailableResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		assert.Equal(t, models.ErrorCodeNotYetAvailable, body.Code)
+		assert.True(t, availableAt.Equal(body.AvailableAt))
+		retryAfter, err := strconv.Atoi(w.Header().Get("Retry-After"))
+		require.NoError(t, err)
+		assert.InDelta(t, (48 * time.Hour).Seconds(), retryAfter, 5)
+	}
+
+	// Someone else still learns nothing but 403
+	assert.Equal(t, http.StatusForbidden, call("GET", "/api/v1/messages/"+created.ID, 1, "").Code)
+
+	// The payload survived the early attempts
+	exists, err := store.Exists(ctx, created.ID)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	// Notifications wait for the release instead of going out now
+	w = call("POST", "/api/v1/notifications/send-slack", 1, fmt.Sprintf(
+		`{"recipient_id":2,"message_url":"http://localhost:5173/m/%s#k"}`, created.ID))
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var scheduled models.ScheduledNotificationResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &scheduled))
+	assert.True(t, availableAt.Equal(scheduled.ScheduledFor))
+	assert.Len(t, dms, 0)
+
+	pending := deps.MetadataStore.(*fakes.MetadataStore).Scheduled()
+	require.Len(t, pending, 1)
+	assert.Equal(t, models.NotificationChannelSlack, pending[0].Channel)
+	assert.Equal(t, "Sender", pending[0].SenderLabel)
+	assert.True(t, availableAt.Equal(pending[0].SendAt))
+}
+
+func TestCreateMessage_InvalidSchedule(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := api.NewMessageHandler(fakes.NewStorage(), fakes.NewMetadataStore(nil), 0, nil, nil, nil, nil)
+	router := gin.New()
+	router.Use(authAs(1))
+	router.POST("/messages", handler.CreateMessage)
+
+	now := time.Now().UTC()
+	tests := map[string]string{
+		"past":     fmt.Sprintf(`"ttl":3600,"available_at":%q`, now.Add(-time.Minute).Format(time.RFC3339)),
+		"too late": fmt.Sprintf(`"ttl":86400,"available_at":%q`, now.Add(6*24*time.Hour+time.Hour).Format(time.RFC3339)),
+	}
+	for name, fields := range tests {
+		t.Run(name, func(t *testing.T) {
+			body := `{"ciphertext":"Yw==","iv":"aXY=","recipient_id":2,"encryption_key":"k",` + fields + `}`
+			req, _ := http.NewRequest("POST", "/messages", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code, w.Body.String())
+			assert.Contains(t, w.Body.String(), models.ErrorCodeInvalidSchedule)
+		})
+	}
+}
+
+func TestDispatchDue_SendsReleasedNotifications(t *testing.T) {
+	ctx := context.Background()
+	slackAPI, dms := recordingSlackAPI(t)
+	users := seedUsers(t)
+	metadataStore := fakes.NewMetadataStore(users)
+
+	released := time.Now().UTC().Add(-time.Second)
+	seed := func(id string, change func(*models.MessageMetadata)) {
+		m := &models.MessageMetadata{
+			MessageID:     id,
+			SenderID:      1,
+			RecipientID:   2,
+			EncryptionKey: "key-" + id,
+			Status:        models.StatusPending,
+			CreatedAt:     time.Now().UTC().Add(-time.Hour),
+			ExpiresAt:     time.Now().UTC().Add(time.Hour),
+			AvailableAt:   &released,
+		}
+		if change != nil {
+			change(m)
+		}
+		require.NoError(t, metadataStore.Create(ctx, m))
+		require.NoError(t, metadataStore.ScheduleNotification(ctx, &models.ScheduledNotification{
+			MessageID:   id,
+			Channel:     models.NotificationChannelSlack,
+			SenderLabel: "Sender",
+			SendAt:      *m.AvailableAt,
+		}))
+	}
+	seed("due", nil)
+	seed("discarded", func(m *models.MessageMetadata) { m.Status = models.StatusExpired })
+	later := time.Now().UTC().Add(time.Hour)
+	seed("later", func(m *models.MessageMetadata) { m.AvailableAt = &later })
+
+	links, err := urlbuilder.New("http://localhost:5173")
+	require.NoError(t, err)
+	slackClient := slack.NewClient(&slack.Config{BotToken: "xoxb-test", APIURL: slackAPI.URL})
+	handler := api.NewNotificationHandler(users, metadataStore, api.NewIntegrations(api.IntegrationClients{Slack: slackClient}), links, nil, nil, nil)
+
+	handler.DispatchDue(ctx)
+
+	require.Len(t, dms, 1)
+	assert.Contains(t, <-dms, "http://localhost:5173/m/due#key-due")
+
+	// Only the notification not yet due is left
+	left := metadataStore.Scheduled()
+	require.Len(t, left, 1)
+	assert.Equal(t, "later", left[0].MessageID)
+}
@@ -0,0 +1,167 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/milkiss/vanish/backend/internal/messages"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchBannedDomain(t *testing.T) {
+	banned := []*models.BannedDomain{{Domain: "gmail.com"}, {Domain: "bücher.example"}}
+	tests := []struct {
+		email string
+		want  string
+	}{
+		{"alice@gmail.com", "gmail.com"},
+		{"alice@GMail.COM", "gmail.com"},
+		{"alice@gmail.com.", "gmail.com"},
+		{"alice@mail.gmail.com", "gmail.com"},
+		{"alice@notgmail.com", ""},
+		{"alice@gmail.com.evil.example", ""},
+		{"alice@example.com", ""},
+		{"not an address", ""},
+
+		// Homographs: Cyrillic "а", Greek "ο", digit one for "l", "rn" for "m"
+		{"alice@gmаil.com", "gmail.com"},
+		{"alice@gmail.cοm", "gmail.com"},
+		{"alice@gmai1.com", "gmail.com"},
+		{"alice@grnail.com", "gmail.com"},
+		// Fullwidth letters and an ideographic full stop, folded by NFKC and IDNA
+		{"alice@ｇｍａｉｌ.com", "gmail.com"},
+		{"alice@gmail。com", "gmail.com"},
+		// Punycode is decoded before comparing, both ways
+		{"alice@xn--gmil-63d.com", "gmail.com"},
+		{"alice@xn--bcher-kva.example", "bücher.example"},
+		{"alice@shop.bücher.example", "bücher.example"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			match := models.MatchBannedDomain(banned, tt.email)
+			if tt.want == "" {
+				assert.Nil(t, match)
+				return
+			}
+			require.NotNil(t, match)
+			assert.Equal(t, tt.want, match.Domain)
+		})
+	}
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	for input, want := range map[string]string{
+		"Gmail.COM":             "gmail.com",
+		"gmail.com.":            "gmail.com",
+		"xn--bcher-kva.example": "bücher.example",
+		"BÜCHER.example":        "bücher.example",
+	} {
+		got, err := models.NormalizeDomain(input)
+		require.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+	for _, input := range []string{"", "localhost", "alice@gmail.com", "*.gmail.com", "a b.com"} {
+		_, err := models.NormalizeDomain(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestDLPPatternRequest_Validate(t *testing.T) {
+	assert.Nil(t, (&models.DLPPatternRequest{Pattern: `\b(?:\d[ -]?){13,16}\b`}).Validate())
+	assert.Contains(t, (&models.DLPPatternRequest{Pattern: `(unclosed`}).Validate(), "pattern")
+}
+
+func TestMessageService_BannedExternalDomain(t *testing.T) {
+	policies := fakes.NewTTLPolicyStore()
+	_, err := policies.PutBannedDomain(context.Background(), &models.BannedDomain{Domain: "gmail.com"})
+	require.NoError(t, err)
+	users := seedUsers(t)
+	service := messages.NewService(fakes.NewStorage(), fakes.NewMetadataStore(users), 0, users, policies)
+
+	_, err = service.CreateEncrypted(context.Background(), 1, 0, servicePayload, nil,
+		messages.CreateOptions{EncryptionKey: "key", ExternalRecipientEmail: "contractor@mail.gmаil.com"})
+	var failure *messages.Error
+	require.ErrorAs(t, err, &failure)
+	assert.Equal(t, models.ErrorCodeDomainBanned, failure.Code)
+
+	_, err = service.CreateEncrypted(context.Background(), 1, 0, servicePayload, nil,
+		messages.CreateOptions{EncryptionKey: "key", ExternalRecipientEmail: "contractor@partner.example"})
+	assert.NoError(t, err)
+
+	// Registered recipients are not checked: the ban is about who gets in
+	_, err = policies.PutBannedDomain(context.Background(), &models.BannedDomain{Domain: "example.com"})
+	require.NoError(t, err)
+	_, err = service.CreateEncrypted(context.Background(), 1, 2, servicePayload, nil, messages.CreateOptions{})
+	assert.NoError(t, err)
+}
+
+func TestSenderPolicy_AdminAndRetrieval(t *testing.T) {
+	do := ttlPolicyRouter(t)
+
+	// Empty until admins configure it
+	w := do("GET", "/api/v1/policy", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"banned_domains": [], "dlp_patterns": []}`, w.Body.String())
+
+	w = do("PUT", "/api/v1/admin/banned-domains/GMail.com", models.BannedDomainRequest{Reason: "personal mail"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = do("PUT", "/api/v1/admin/banned-domains/gmail.com", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	w = do("PUT", "/api/v1/admin/banned-domains/xn--bcher-kva.example", nil)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = do("PUT", "/api/v1/admin/banned-domains/alice@gmail.com", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	cardPattern := `\b(?:\d[ -]?){13,16}\b`
+	w = do("PUT", "/api/v1/admin/dlp-patterns/credit-card", models.DLPPatternRequest{Pattern: cardPattern, Description: "Looks like a card number"})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	w = do("PUT", "/api/v1/admin/dlp-patterns/broken", models.DLPPatternRequest{Pattern: `[a-`})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = do("GET", "/api/v1/policy", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var policy models.SenderPolicy
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &policy))
+	assert.Equal(t, []string{"bücher.example", "gmail.com"}, policy.BannedDomains)
+	require.Len(t, policy.DLPPatterns, 1)
+	assert.Equal(t, cardPattern, policy.DLPPatterns[0].Pattern)
+	assert.Equal(t, "Looks like a card number", policy.DLPPatterns[0].Description)
+
+	// The reason stays with admins
+	w = do("GET", "/api/v1/admin/banned-domains", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var domains []models.BannedDomain
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &domains))
+	require.Len(t, domains, 2)
+	assert.Equal(t, "", domains[1].Reason, "replaced without a reason")
+
+	w = do("DELETE", "/api/v1/admin/banned-domains/gmail.com", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do("DELETE", "/api/v1/admin/banned-domains/gmail.com", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), models.ErrorCodeBannedDomainNotFound)
+	w = do("DELETE", "/api/v1/admin/dlp-patterns/credit-card", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do("DELETE", "/api/v1/admin/dlp-patterns/credit-card", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestRegister_BannedDomain(t *testing.T) {
+	do := ttlPolicyRouter(t)
+	w := do("PUT", "/api/v1/admin/banned-domains/gmail.com", nil)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	w = do("POST", "/api/v1/auth/register", models.RegisterRequest{Email: "alice@googlemail.gmail.com", Name: "Alice", Password: "password123"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	var resp models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, models.ErrorCodeDomainBanned, resp.Code)
+
+	w = do("POST", "/api/v1/auth/register", models.RegisterRequest{Email: "alice@corp.example", Name: "Alice", Password: "password123"})
+	assert.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+}
@@ -0,0 +1,137 @@
+package unit
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startTimeoutServer serves an upload route with a generous per-route
+// timeout behind a server whose default read timeout is short
+func startTimeoutServer(t *testing.T, serverRead, uploadTimeout time.Duration) string {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	upload := func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.String(http.StatusRequestTimeout, "read failed")
+			return
+		}
+		c.String(http.StatusOK, "%d", len(body))
+	}
+	router.POST("/upload", api.RouteTimeoutMiddleware(uploadTimeout), upload)
+	router.POST("/default", upload)
+
+	server := api.NewServer(config.ServerConfig{
+		Timeouts: config.TimeoutConfig{
+			ReadHeader: 200 * time.Millisecond,
+			Read:       serverRead,
+			Write:      serverRead,
+			Idle:       time.Second,
+		},
+	}, router)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+
+	return listener.Addr().String()
+}
+
+// slowPost sends a request whose body trickles in over chunks*interval
+func slowPost(t *testing.T, addr, path string, chunks int, interval time.Duration) (*http.Response, error) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	_, err = io.WriteString(conn, "POST "+path+" HTTP/1.1\r\nHost: test\r\nContent-Type: text/csv\r\nContent-Length: "+
+		strconv.Itoa(chunks)+"\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+
+	for i := 0; i < chunks; i++ {
+		time.Sleep(interval)
+		if _, err := conn.Write([]byte("x")); err != nil {
+			return nil, err
+		}
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	return http.ReadResponse(bufio.NewReader(conn), nil)
+}
+
+func TestRouteTimeout_SlowUploadUnderLimitSucceeds(t *testing.T) {
+	addr := startTimeoutServer(t, 300*time.Millisecond, 3*time.Second)
+
+	// ~800ms total: longer than the server read timeout, within the route limit
+	resp, err := slowPost(t, addr, "/upload", 10, 80*time.Millisecond)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "10", string(body))
+}
+
+func TestRouteTimeout_DefaultRouteKeepsServerLimit(t *testing.T) {
+	addr := startTimeoutServer(t, 300*time.Millisecond, 3*time.Second)
+
+	resp, err := slowPost(t, addr, "/default", 10, 80*time.Millisecond)
+	if err == nil {
+		defer resp.Body.Close()
+		assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+	}
+}
+
+func TestRouteTimeout_StalledUploadIsReaped(t *testing.T) {
+	addr := startTimeoutServer(t, 300*time.Millisecond, 500*time.Millisecond)
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Promise a body, send part of it, then stall
+	_, err = io.WriteString(conn, "POST /upload HTTP/1.1\r\nHost: test\r\nContent-Length: 100\r\n\r\npartial")
+	require.NoError(t, err)
+
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err == nil {
+		resp.Body.Close()
+		assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+	}
+	assert.Less(t, time.Since(start), 2*time.Second, "stalled connection should be reaped by the route deadline")
+}
+
+func TestServer_StalledHeadersAreReaped(t *testing.T) {
+	addr := startTimeoutServer(t, 300*time.Millisecond, 3*time.Second)
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Never finish the header block
+	_, err = io.WriteString(conn, "POST /upload HTTP/1.1\r\nHost: te")
+	require.NoError(t, err)
+
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.ReadAll(conn)
+	assert.NoError(t, err, "server should close the connection rather than hang")
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
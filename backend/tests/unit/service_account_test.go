@@ -0,0 +1,152 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serviceAccountRouter serves the full API with an admin (user 1) and a
+// regular user (user 2). call sends a request with the given bearer token
+func serviceAccountRouter(t *testing.T) (call apiCall, adminToken, userToken string) {
+	t.Helper()
+	ctx := context.Background()
+
+	deps := testDependencies()
+	hashed, err := models.HashPassword("password123")
+	require.NoError(t, err)
+	require.NoError(t, deps.UserStore.Create(ctx, &models.User{Email: "admin@example.com", Name: "Admin", Password: hashed, IsAdmin: true}))
+	require.NoError(t, deps.UserStore.Create(ctx, &models.User{Email: "user@example.com", Name: "User", Password: hashed}))
+
+	adminToken, _ = deps.JWTManager.Generate(1, "admin@example.com")
+	userToken, _ = deps.JWTManager.Generate(2, "user@example.com")
+	return apiRouter(t, deps), adminToken, userToken
+}
+
+// createServiceAccount creates a service account with one API key and
+// returns the account and the key
+func createServiceAccount(t *testing.T, call apiCall, adminToken string) (*models.UserInfo, *models.CreateAPIKeyResponse) {
+	t.Helper()
+
+	w := call("POST", "/api/v1/admin/service-accounts", adminToken, `{"email":"ci@example.com","name":"CI Bot"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var account models.UserInfo
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &account))
+	require.True(t, account.IsService)
+
+	w = call("POST", "/api/v1/admin/service-accounts/"+strconv.FormatInt(account.ID, 10)+"/keys", adminToken, `{"name":"deploy pipeline"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.CreateAPIKeyResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	require.True(t, models.IsAPIKey(created.Key))
+	assert.True(t, strings.HasPrefix(created.Key, created.APIKey.Prefix))
+
+	return &account, &created
+}
+
+func TestServiceAccount_APIKeyCreatesIntegrationMessage(t *testing.T) {
+	call, adminToken, userToken := serviceAccountRouter(t)
+	_, created := createServiceAccount(t, call, adminToken)
+
+	w := call("POST", "/api/v1/messages", created.Key, `{"ciphertext":"Yw==","iv":"aXY=","recipient_id":2,"encryption_key":"k"}`)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+
+	w = call("GET", "/api/v1/history", userToken, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var history []models.MessageHistoryResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	require.Len(t, history, 1)
+	assert.Equal(t, models.SenderTypeIntegration, history[0].SenderType)
+	assert.Equal(t, "CI Bot", history[0].IntegrationName)
+	assert.Equal(t, "CI Bot integration", history[0].SenderLabel)
+}
+
+func TestServiceAccount_CannotLogIn(t *testing.T) {
+	call, adminToken, userToken := serviceAccountRouter(t)
+	createServiceAccount(t, call, adminToken)
+
+	w := call("POST", "/api/v1/auth/login", "", `{"email":"ci@example.com","password":""}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = call("POST", "/api/v1/auth/login", "", `{"email":"ci@example.com","password":"anything"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), models.ErrorCodeInvalidCredentials)
+
+	// Service accounts cannot receive messages, so they are not listed
+	w = call("GET", "/api/v1/users", userToken, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "ci@example.com")
+}
+
+func TestServiceAccount_RevokedKeyIsRefused(t *testing.T) {
+	call, adminToken, _ := serviceAccountRouter(t)
+	account, created := createServiceAccount(t, call, adminToken)
+	keysPath := "/api/v1/admin/service-accounts/" + strconv.FormatInt(account.ID, 10) + "/keys"
+
+	require.Equal(t, http.StatusOK, call("GET", "/api/v1/auth/me", created.Key, "").Code)
+
+	w := call("DELETE", keysPath+"/"+strconv.FormatInt(created.APIKey.ID, 10), adminToken, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = call("GET", "/api/v1/auth/me", created.Key, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), models.ErrorCodeUnauthorized)
+
+	w = call("DELETE", keysPath+"/"+strconv.FormatInt(created.APIKey.ID, 10), adminToken, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), models.ErrorCodeAPIKeyNotFound)
+
+	// Listings keep revoked keys but never the key itself
+	w = call("GET", keysPath, adminToken, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Key)
+	var keys []models.APIKey
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &keys))
+	require.Len(t, keys, 1)
+	assert.NotNil(t, keys[0].RevokedAt)
+	assert.NotNil(t, keys[0].LastUsedAt)
+}
+
+func TestServiceAccount_DeletedAccountKeysAreRevoked(t *testing.T) {
+	deps := testDependencies()
+	require.NoError(t, deps.UserStore.Create(context.Background(), &models.User{Email: "admin@example.com", Name: "Admin", IsAdmin: true}))
+	adminToken, _ := deps.JWTManager.Generate(1, "admin@example.com")
+	call := apiRouter(t, deps)
+	account, created := createServiceAccount(t, call, adminToken)
+	require.Equal(t, http.StatusOK, call("GET", "/api/v1/auth/me", created.Key, "").Code)
+
+	w := call("DELETE", "/api/v1/admin/users/"+strconv.FormatInt(account.ID, 10), adminToken, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = call("GET", "/api/v1/auth/me", created.Key, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// The key is revoked, not just refused while the account is inactive
+	keys, err := deps.UserStore.ListAPIKeys(context.Background(), account.ID)
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.NotNil(t, keys[0].RevokedAt)
+}
+
+func TestServiceAccount_KeysOnlyForServiceAccounts(t *testing.T) {
+	call, adminToken, userToken := serviceAccountRouter(t)
+
+	// Regular users cannot hold API keys
+	w := call("POST", "/api/v1/admin/service-accounts/2/keys", adminToken, `{"name":"k"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), models.ErrorCodeUserNotFound)
+
+	// Only admins manage service accounts
+	w = call("POST", "/api/v1/admin/service-accounts", userToken, `{"email":"ci@example.com","name":"CI Bot"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Unknown keys are refused like bad tokens
+	w = call("GET", "/api/v1/auth/me", models.APIKeyPrefix+"unknown", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,335 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/integrations/slack"
+	"github.com/milkiss/vanish/backend/internal/messages"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// modalRouter serves the Slack interaction endpoint without signature checks
+// The fake Slack API resolves every user to sender@example.com
+func modalRouter(t *testing.T, store *mockStorage) *gin.Engine {
+	router, _ := modalRouterWithKeyMode(t, store, true)
+	return router
+}
+
+// modalRouterWithKeyMode is modalRouter with an explicit SLACK_STORE_KEY mode
+// It also returns the metadata store so tests can inspect persisted keys
+func modalRouterWithKeyMode(t *testing.T, store *mockStorage, storeKey bool) (*gin.Engine, *fakes.MetadataStore) {
+	gin.SetMode(gin.TestMode)
+
+	slackAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ok":true,"user":{"id":"U1","profile":{"email":"sender@example.com"}},"channel":{"id":"D1"}}`)
+	}))
+	t.Cleanup(slackAPI.Close)
+
+	users := seedUsers(t)
+	client := slack.NewClient(&slack.Config{BotToken: "xoxb-test", APIURL: slackAPI.URL})
+	metadata := fakes.NewMetadataStore(users)
+	handler := api.NewSlackHandler(api.NewIntegrations(api.IntegrationClients{Slack: client}), nil, messages.NewService(store, metadata, 0, nil, nil), users, testLinks(t), storeKey, nil)
+
+	router := gin.New()
+	router.POST("/slack/interactions", handler.HandleInteraction)
+	return router, metadata
+}
+
+// submitModal posts a view_submission with the given block values
+func submitModal(router *gin.Engine, values map[string]map[string]api.InteractionValue) *httptest.ResponseRecorder {
+	payload, _ := json.Marshal(api.InteractionPayload{
+		Type: "view_submission",
+		User: api.InteractionUser{ID: "U1"},
+		View: &api.InteractionView{State: api.InteractionViewState{Values: values}},
+	})
+	form := url.Values{"payload": {string(payload)}}
+
+	req, _ := http.NewRequest("POST", "/slack/interactions", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func modalValues(recipient, secret string) map[string]map[string]api.InteractionValue {
+	return map[string]map[string]api.InteractionValue{
+		"recipient_block": {"recipient_input": {Type: "plain_text_input", Value: recipient}},
+		"password_block":  {"password_input": {Type: "plain_text_input", Value: secret}},
+	}
+}
+
+// fieldErrors decodes a response_action=errors body
+func fieldErrors(t *testing.T, w *httptest.ResponseRecorder) map[string]string {
+	t.Helper()
+	var body struct {
+		ResponseAction string            `json:"response_action"`
+		Errors         map[string]string `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "errors", body.ResponseAction)
+	return body.Errors
+}
+
+func TestSlackModal_MissingTTLBlockUsesDefault(t *testing.T) {
+	var storedTTL time.Duration
+	store := &mockStorage{storeFunc: func(ctx context.Context, msg *models.Message, ttl time.Duration) (string, error) {
+		storedTTL = ttl
+		return "msg-1", nil
+	}}
+	router := modalRouter(t, store)
+
+	// No ttl_block at all: previously a nil pointer dereference
+	w := submitModal(router, modalValues("recipient@example.com", "hunter2"))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Body.String(), "successful submission closes the modal")
+	assert.Equal(t, time.Duration(models.DefaultTTL)*time.Second, storedTTL)
+}
+
+func TestSlackModal_TTLBlockWithoutSelectionUsesDefault(t *testing.T) {
+	var storedTTL time.Duration
+	store := &mockStorage{storeFunc: func(ctx context.Context, msg *models.Message, ttl time.Duration) (string, error) {
+		storedTTL = ttl
+		return "msg-1", nil
+	}}
+	router := modalRouter(t, store)
+
+	values := modalValues("recipient@example.com", "hunter2")
+	values["ttl_block"] = map[string]api.InteractionValue{"ttl_input": {Type: "static_select"}}
+	w := submitModal(router, values)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, time.Duration(models.DefaultTTL)*time.Second, storedTTL)
+}
+
+func TestSlackModal_FieldErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]map[string]api.InteractionValue
+		block  string
+	}{
+		{"no blocks", nil, "recipient_block"},
+		{"empty recipient", modalValues("  ", "hunter2"), "recipient_block"},
+		{"malformed recipient", modalValues("not-an-email", "hunter2"), "recipient_block"},
+		{"display name recipient", modalValues("Bob <bob@example.com>", "hunter2"), "recipient_block"},
+		{"empty secret", modalValues("recipient@example.com", " \n "), "password_block"},
+		{"ttl out of range", func() map[string]map[string]api.InteractionValue {
+			v := modalValues("recipient@example.com", "hunter2")
+			v["ttl_block"] = map[string]api.InteractionValue{"ttl_input": {
+				SelectedOption: &api.InteractionOption{Value: "999999999"},
+			}}
+			return v
+		}(), "ttl_block"},
+		{"ttl not a number", func() map[string]map[string]api.InteractionValue {
+			v := modalValues("recipient@example.com", "hunter2")
+			v["ttl_block"] = map[string]api.InteractionValue{"ttl_input": {
+				SelectedOption: &api.InteractionOption{Value: "soon"},
+			}}
+			return v
+		}(), "ttl_block"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := false
+			store := &mockStorage{storeFunc: func(ctx context.Context, msg *models.Message, ttl time.Duration) (string, error) {
+				stored = true
+				return "msg-1", nil
+			}}
+			router := modalRouter(t, store)
+
+			w := submitModal(router, tt.values)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, fieldErrors(t, w), tt.block)
+			assert.False(t, stored, "invalid submissions must not create a message")
+		})
+	}
+}
+
+func TestSlackModal_KeyRetention(t *testing.T) {
+	for _, storeKey := range []bool{true, false} {
+		t.Run(fmt.Sprintf("store_key=%v", storeKey), func(t *testing.T) {
+			router, metadata := modalRouterWithKeyMode(t, &mockStorage{}, storeKey)
+
+			w := submitModal(router, modalValues("recipient@example.com", "hunter2"))
+			require.Equal(t, http.StatusOK, w.Code)
+
+			// Recipient (ID 2) history reflects whether the key was kept
+			history, err := metadata.GetUserHistory(context.Background(), 2, "", models.Page{Limit: 10})
+			require.NoError(t, err)
+			require.Len(t, history, 1)
+
+			assert.Equal(t, storeKey, history[0].KeyRetained)
+			if storeKey {
+				assert.NotEmpty(t, history[0].EncryptionKey)
+			} else {
+				assert.Empty(t, history[0].EncryptionKey, "discarded key must not be offered for link regeneration")
+			}
+		})
+	}
+}
+
+func TestSlackModal_RecordsIntegrationSender(t *testing.T) {
+	router, metadata := modalRouterWithKeyMode(t, &mockStorage{}, true)
+
+	w := submitModal(router, modalValues("recipient@example.com", "hunter2"))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	history, err := metadata.GetUserHistory(context.Background(), 2, "", models.Page{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+
+	assert.Equal(t, models.SenderTypeIntegration, history[0].SenderType)
+	assert.Equal(t, models.IntegrationSlack, history[0].IntegrationName)
+	assert.Equal(t, models.ClientSlack, history[0].CreatedVia)
+	assert.Equal(t, "Sender", history[0].SenderName)
+	assert.Equal(t, "Sender via Slack integration", history[0].SenderLabel)
+}
+
+func TestAdminSettings_ExplainsSlackKeyHandling(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	for _, storeKey := range []bool{true, false} {
+		cfg := &config.Config{Slack: config.SlackConfig{Enabled: true, StoreKey: storeKey, BotToken: "xoxb-secret"}}
+		handler := api.NewAdminHandler(fakes.NewUserStore(), fakes.NewMetadataStore(nil), fakes.NewStorage(), nil, cfg, nil, nil)
+
+		router := gin.New()
+		router.GET("/admin/settings", handler.GetSettings)
+
+		req, _ := http.NewRequest("GET", "/admin/settings", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotContains(t, w.Body.String(), "xoxb-secret")
+
+		var settings api.AdminSettingsResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &settings))
+		assert.True(t, settings.Slack.Enabled)
+		assert.Equal(t, storeKey, settings.Slack.StoreKey)
+		if storeKey {
+			assert.Contains(t, settings.Slack.KeyHandling, "can decrypt")
+		} else {
+			assert.Contains(t, settings.Slack.KeyHandling, "discarded")
+		}
+	}
+}
+
+// Example request and signature published in Slack's "Verifying requests
+// from Slack" documentation
+const (
+	slackFixtureSecret    = "8f742231b10e8888abcd99yyyzzz85a5"
+	slackFixtureTimestamp = "1531420618"
+	slackFixtureBody      = "token=xyzz0WbapA4vBCDEFasx0q6G&team_id=T1DC2JH3J&team_domain=testteamnow&channel_id=G8PSS9T3V&channel_name=foobar&user_id=U2CERLKJA&user_name=roadrunner&command=%2Fwebhook-collect&text=&response_url=https%3A%2F%2Fhooks.slack.com%2Fcommands%2FT1DC2JH3J%2F397700885554%2F96rGlfmibIGlgcZRskXaIFfN&trigger_id=398738663015.47445629121.803a0bc887a14d10d2c447fce8b6703c"
+	slackFixtureSignature = "v0=a2114d57b48eac39b9ad189dd8316235a7b4a8d21a10bd27519666489c69b503"
+)
+
+func TestSlackVerifySignature_Fixture(t *testing.T) {
+	fixtureTime := time.Unix(1531420618, 0)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		signature string
+		body      string
+		now       time.Time
+		expected  error
+	}{
+		{"recorded request", slackFixtureSecret, slackFixtureTimestamp, slackFixtureSignature, slackFixtureBody, fixtureTime.Add(10 * time.Second), nil},
+		{"tampered body", slackFixtureSecret, slackFixtureTimestamp, slackFixtureSignature, slackFixtureBody + "&text=x", fixtureTime, slack.ErrInvalidSignature},
+		{"wrong secret", "other-secret", slackFixtureTimestamp, slackFixtureSignature, slackFixtureBody, fixtureTime, slack.ErrInvalidSignature},
+		{"replayed later", slackFixtureSecret, slackFixtureTimestamp, slackFixtureSignature, slackFixtureBody, fixtureTime.Add(6 * time.Minute), slack.ErrStaleTimestamp},
+		{"timestamp in the future", slackFixtureSecret, slackFixtureTimestamp, slackFixtureSignature, slackFixtureBody, fixtureTime.Add(-6 * time.Minute), slack.ErrStaleTimestamp},
+		{"missing signature", slackFixtureSecret, slackFixtureTimestamp, "", slackFixtureBody, fixtureTime, slack.ErrMissingSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := slack.VerifySignature(tt.secret, tt.timestamp, tt.signature, []byte(tt.body), tt.now)
+			if tt.expected == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestSlackSign_MatchesFixture(t *testing.T) {
+	assert.Equal(t, slackFixtureSignature, slack.Sign(slackFixtureSecret, slackFixtureTimestamp, []byte(slackFixtureBody)))
+}
+
+func TestSlackSlashCommand_SignedFormIsBound(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// Capture the trigger_id the handler passes to views.open
+	triggers := make(chan string, 1)
+	slackAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			TriggerID string `json:"trigger_id"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		triggers <- body.TriggerID
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	defer slackAPI.Close()
+
+	const secret = "unit-test-signing-secret"
+	client := slack.NewClient(&slack.Config{BotToken: "xoxb-test", SigningSecret: secret, APIURL: slackAPI.URL})
+	users := fakes.NewUserStore()
+	handler := api.NewSlackHandler(api.NewIntegrations(api.IntegrationClients{Slack: client}), nil, messages.NewService(&mockStorage{}, fakes.NewMetadataStore(users), 0, nil, nil), users, testLinks(t), true, nil)
+
+	router := gin.New()
+	router.POST("/slack/commands", handler.HandleSlashCommand)
+
+	send := func(body, signature string) *httptest.ResponseRecorder {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		if signature == "" {
+			signature = slack.Sign(secret, timestamp, []byte(body))
+		}
+		req, _ := http.NewRequest("POST", "/slack/commands", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Slack-Request-Timestamp", timestamp)
+		req.Header.Set("X-Slack-Signature", signature)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Percent-encoded characters must be signed exactly as sent
+	body := "command=%2FvanishPW&user_id=U123&text=a%20b%2Bc&trigger_id=trigger%3A42"
+
+	w := send(body, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	select {
+	case trigger := <-triggers:
+		assert.Equal(t, "trigger:42", trigger, "form must be parsed after verification")
+	case <-time.After(time.Second):
+		t.Fatal("modal was not opened")
+	}
+
+	w = send(body, "v0=deadbeef")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = send("%zz", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,273 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/config"
+	"github.com/milkiss/vanish/backend/internal/integrations/slack"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testSlackClientID     = "123.456"
+	testSlackClientSecret = "slack-client-secret"
+	testSlackRedirectURL  = "https://vanish.example.com/api/slack/oauth/callback"
+	testSlackAuthorizeURL = "https://slack.example.com/oauth/v2/authorize"
+)
+
+// fakeSlackOAuth is a Slack API that installs the app into the workspace
+// of each known code and records the bot token of every other call
+type fakeSlackOAuth struct {
+	server *httptest.Server
+
+	mu     sync.Mutex
+	tokens []string // Authorization headers of calls other than oauth.v2.access
+}
+
+func newFakeSlackOAuth(t *testing.T) *fakeSlackOAuth {
+	f := &fakeSlackOAuth{}
+	teams := map[string][2]string{
+		"acme-code":  {"T1", "Acme"},
+		"other-code": {"T9", "Other"},
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/oauth.v2.access" {
+			f.mu.Lock()
+			f.tokens = append(f.tokens, r.Header.Get("Authorization"))
+			f.mu.Unlock()
+			fmt.Fprint(w, `{"ok":true}`)
+			return
+		}
+
+		id, secret, _ := r.BasicAuth()
+		team, known := teams[r.FormValue("code")]
+		switch {
+		case id != testSlackClientID || secret != testSlackClientSecret:
+			fmt.Fprint(w, `{"ok":false,"error":"invalid_client_id"}`)
+		case r.FormValue("redirect_uri") != testSlackRedirectURL:
+			fmt.Fprint(w, `{"ok":false,"error":"bad_redirect_uri"}`)
+		case !known:
+			fmt.Fprint(w, `{"ok":false,"error":"invalid_code"}`)
+		default:
+			fmt.Fprintf(w, `{"ok":true,"access_token":"xoxb-%s","token_type":"bot","scope":"commands,chat:write",`+
+				`"bot_user_id":"B1","team":{"id":%q,"name":%q},"authed_user":{"id":"U1"}}`, team[0], team[0], team[1])
+		}
+	}))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// seenTokens returns the Authorization headers Slack received so far
+func (f *fakeSlackOAuth) seenTokens() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.tokens...)
+}
+
+// slackInstallRouter serves the API with Slack enabled against the fake
+// Slack, the given default bot token and installation allowlist, and no
+// signing secret
+func slackInstallRouter(t *testing.T, slackAPI *fakeSlackOAuth, botToken string, allowedTeams ...string) (*gin.Engine, *fakes.SlackInstallationStore) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	cfg := config.SlackConfig{
+		Enabled:      true,
+		BotToken:     botToken,
+		ClientID:     testSlackClientID,
+		ClientSecret: testSlackClientSecret,
+		RedirectURL:  testSlackRedirectURL,
+		AllowedTeams: allowedTeams,
+	}
+	deps := testDependencies()
+	deps.Config.Slack = cfg
+	deps.Storage = fakes.NewStorage()
+	installations := fakes.NewSlackInstallationStore()
+	deps.SlackInstallations = installations
+	deps.SlackClient = slack.NewClient(&slack.Config{
+		BotToken:     cfg.BotToken,
+		APIURL:       slackAPI.server.URL,
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		AuthorizeURL: testSlackAuthorizeURL,
+		AllowedTeams: cfg.AllowedTeams,
+	})
+
+	router, err := api.SetupRouter(deps)
+	require.NoError(t, err)
+	return router, installations
+}
+
+func get(router *gin.Engine, path string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", path, nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// startInstall follows GET /api/slack/install and returns the state Slack
+// would send back
+func startInstall(t *testing.T, router *gin.Engine) string {
+	t.Helper()
+	w := get(router, "/api/slack/install")
+	require.Equal(t, http.StatusFound, w.Code, w.Body.String())
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	require.Equal(t, testSlackAuthorizeURL, location.Scheme+"://"+location.Host+location.Path)
+	return location.Query().Get("state")
+}
+
+func TestSlackInstall_StoresWorkspaceToken(t *testing.T) {
+	slackAPI := newFakeSlackOAuth(t)
+	router, installations := slackInstallRouter(t, slackAPI, "")
+
+	w := get(router, "/api/slack/install")
+	require.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	query := location.Query()
+	assert.Equal(t, testSlackClientID, query.Get("client_id"))
+	assert.Equal(t, testSlackRedirectURL, query.Get("redirect_uri"))
+	assert.Equal(t, strings.Join(slack.DefaultScopes, ","), query.Get("scope"))
+	state := query.Get("state")
+	require.NotEmpty(t, state)
+
+	callback := "/api/slack/oauth/callback?state=" + url.QueryEscape(state) + "&code=acme-code"
+	w = get(router, callback)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var installed models.SlackInstallResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &installed))
+	assert.Equal(t, models.SlackInstallResponse{TeamID: "T1", TeamName: "Acme"}, installed)
+	assert.NotContains(t, w.Body.String(), "xoxb-", "the token is never returned")
+
+	stored, err := installations.FindSlackInstallation(context.Background(), "T1")
+	require.NoError(t, err)
+	assert.Equal(t, "xoxb-T1", stored.BotToken)
+	assert.Equal(t, "B1", stored.BotUserID)
+	assert.Equal(t, "U1", stored.InstalledBy)
+
+	// A state is accepted once
+	w = get(router, callback)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestSlackInstall_Refusals(t *testing.T) {
+	slackAPI := newFakeSlackOAuth(t)
+	router, installations := slackInstallRouter(t, slackAPI, "", "T1")
+
+	tests := []struct {
+		name   string
+		query  func(state string) string
+		status int
+	}{
+		{"unknown state", func(string) string { return "state=forged&code=acme-code" }, http.StatusBadRequest},
+		{"install declined", func(s string) string { return "state=" + s + "&error=access_denied" }, http.StatusBadRequest},
+		{"missing code", func(s string) string { return "state=" + s }, http.StatusBadRequest},
+		{"code rejected by Slack", func(s string) string { return "state=" + s + "&code=expired-code" }, http.StatusBadGateway},
+		{"workspace not allowed", func(s string) string { return "state=" + s + "&code=other-code" }, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := url.QueryEscape(startInstall(t, router))
+			w := get(router, "/api/slack/oauth/callback?"+tt.query(state))
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+		})
+	}
+
+	_, err := installations.FindSlackInstallation(context.Background(), "T9")
+	assert.ErrorIs(t, err, models.ErrSlackNotInstalled)
+}
+
+func TestSlackInstall_UnavailableWithoutOAuth(t *testing.T) {
+	deps := testDependencies()
+	deps.Config.Slack = config.SlackConfig{Enabled: true, BotToken: "xoxb-default"}
+	deps.SlackInstallations = fakes.NewSlackInstallationStore()
+	router, err := api.SetupRouter(deps)
+	require.NoError(t, err)
+
+	for _, path := range []string{"/api/slack/install", "/api/slack/oauth/callback?state=s&code=c"} {
+		w := get(router, path)
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code, path)
+		assert.Contains(t, w.Body.String(), models.ErrorCodeIntegrationDisabled)
+	}
+}
+
+func TestSlackCommands_UseWorkspaceToken(t *testing.T) {
+	command := func(router *gin.Engine, teamID string) *httptest.ResponseRecorder {
+		form := url.Values{"command": {"/vanishPW"}, "team_id": {teamID}, "user_id": {"U1"}, "trigger_id": {"trigger-1"}}
+		req, _ := http.NewRequest("POST", "/api/slack/commands", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("installed workspaces use their token, others the default", func(t *testing.T) {
+		slackAPI := newFakeSlackOAuth(t)
+		router, installations := slackInstallRouter(t, slackAPI, "xoxb-default")
+		require.NoError(t, installations.SaveSlackInstallation(context.Background(),
+			&models.SlackInstallation{TeamID: "T1", BotToken: "xoxb-acme"}))
+
+		require.Equal(t, http.StatusOK, command(router, "T1").Code)
+		require.Equal(t, http.StatusOK, command(router, "T2").Code)
+		assert.Equal(t, []string{"Bearer xoxb-acme", "Bearer xoxb-default"}, slackAPI.seenTokens())
+	})
+
+	t.Run("no installation and no default token", func(t *testing.T) {
+		slackAPI := newFakeSlackOAuth(t)
+		router, _ := slackInstallRouter(t, slackAPI, "")
+
+		w := command(router, "T2")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "not installed in this workspace")
+		assert.Empty(t, slackAPI.seenTokens())
+	})
+}
+
+func TestLoad_SlackOAuth(t *testing.T) {
+	t.Setenv("SLACK_CLIENT_ID", testSlackClientID)
+	_, err := config.Load()
+	assert.ErrorContains(t, err, "SLACK_CLIENT_SECRET")
+
+	t.Setenv("SLACK_CLIENT_SECRET", testSlackClientSecret)
+	_, err = config.Load()
+	assert.ErrorContains(t, err, "SLACK_REDIRECT_URL")
+
+	t.Setenv("SLACK_REDIRECT_URL", "/api/slack/oauth/callback")
+	_, err = config.Load()
+	assert.ErrorContains(t, err, "SLACK_REDIRECT_URL")
+
+	t.Setenv("SLACK_REDIRECT_URL", testSlackRedirectURL)
+	t.Setenv("SLACK_ALLOWED_TEAMS", "T1, T2")
+	cfg, err := config.Load()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"T1", "T2"}, cfg.Slack.AllowedTeams)
+	assert.Empty(t, cfg.Slack.Scopes)
+}
+
+// The state lives in shared storage, so it expires there too
+func TestFakeStorage_OAuthStateExpires(t *testing.T) {
+	store := fakes.NewStorage()
+	ctx := context.Background()
+	require.NoError(t, store.SaveOAuthState(ctx, "s", 10*time.Millisecond))
+	time.Sleep(20 * time.Millisecond)
+	ok, err := store.TakeOAuthState(ctx, "s")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
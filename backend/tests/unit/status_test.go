@@ -0,0 +1,167 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/persistence"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueueLevelOf(t *testing.T) {
+	assert.Equal(t, models.QueueUnknown, models.QueueLevelOf(-1))
+	assert.Equal(t, models.QueueEmpty, models.QueueLevelOf(0))
+	assert.Equal(t, models.QueueNormal, models.QueueLevelOf(49))
+	assert.Equal(t, models.QueueElevated, models.QueueLevelOf(50))
+	assert.Equal(t, models.QueueElevated, models.QueueLevelOf(499))
+	assert.Equal(t, models.QueueBacklogged, models.QueueLevelOf(500))
+}
+
+func TestSummarizeHealth(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	ok := func(ago time.Duration, depth int) models.HealthSample {
+		return models.HealthSample{At: now.Add(-ago), Redis: true, Postgres: true, QueueDepth: depth}
+	}
+
+	status := models.SummarizeHealth(nil, 15*time.Minute)
+	assert.Equal(t, models.ServiceUnknown, status.Status)
+	assert.Equal(t, 15, status.WindowMinutes)
+	assert.Nil(t, status.CheckedAt)
+	assert.Equal(t, models.ComponentUnknown, status.Redis)
+	assert.Equal(t, models.QueueUnknown, status.NotificationQueue)
+
+	status = models.SummarizeHealth([]models.HealthSample{ok(time.Minute, 700), ok(0, 3)}, 15*time.Minute)
+	assert.Equal(t, models.ServiceOperational, status.Status)
+	assert.Equal(t, now, *status.CheckedAt)
+	assert.Equal(t, models.ComponentOK, status.Postgres)
+	assert.Equal(t, models.QueueNormal, status.NotificationQueue, "the latest depth counts")
+
+	// One failed check degrades the component for the whole window
+	down := ok(10*time.Minute, -1)
+	down.Postgres = false
+	status = models.SummarizeHealth([]models.HealthSample{down, ok(0, 0)}, 15*time.Minute)
+	assert.Equal(t, models.ServiceDegraded, status.Status)
+	assert.Equal(t, models.ComponentOK, status.Redis)
+	assert.Equal(t, models.ComponentDegraded, status.Postgres)
+	assert.Equal(t, models.QueueEmpty, status.NotificationQueue)
+
+	status = models.SummarizeHealth([]models.HealthSample{ok(0, 500)}, 15*time.Minute)
+	assert.Equal(t, models.ServiceDegraded, status.Status)
+	assert.Equal(t, models.QueueBacklogged, status.NotificationQueue)
+}
+
+// unreachableMetadata is a metadata store whose database is down
+type unreachableMetadata struct{ *fakes.MetadataStore }
+
+func (unreachableMetadata) CountDueNotifications(ctx context.Context, now time.Time) (int, error) {
+	return 0, errors.New("connection refused")
+}
+
+func TestStatusSampler_Sample(t *testing.T) {
+	ctx := context.Background()
+	store := fakes.NewStorage()
+	metadata := fakes.NewMetadataStore(fakes.NewUserStore())
+	for i, sendAt := range []time.Time{time.Now().Add(-time.Minute), time.Now().Add(-time.Second), time.Now().Add(time.Hour)} {
+		id := fmt.Sprintf("scheduled-%d", i)
+		require.NoError(t, metadata.Create(ctx, &models.MessageMetadata{
+			MessageID: id, SenderID: 1, RecipientID: 2, Status: models.StatusPending,
+			CreatedAt: time.Now(), ExpiresAt: time.Now().Add(2 * time.Hour),
+		}))
+		require.NoError(t, metadata.ScheduleNotification(ctx, &models.ScheduledNotification{
+			MessageID: id, Channel: models.NotificationChannelEmail, SendAt: sendAt,
+		}))
+	}
+
+	api.NewStatusSampler(metadata, store).Sample(ctx)
+	store.PingErr = errors.New("connection refused")
+	api.NewStatusSampler(unreachableMetadata{metadata}, store).Sample(ctx)
+
+	samples, err := store.HealthSamples(ctx, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+	require.Len(t, samples, 2)
+	assert.True(t, samples[0].Redis)
+	assert.True(t, samples[0].Postgres)
+	assert.Equal(t, 2, samples[0].QueueDepth, "only due notifications are queued")
+	assert.False(t, samples[1].Redis)
+	assert.False(t, samples[1].Postgres)
+	assert.Equal(t, -1, samples[1].QueueDepth)
+}
+
+// untouchedUsers and untouchedMetadata panic on any call, proving a route
+// never reaches PostgreSQL
+type untouchedUsers struct{ persistence.UserStore }
+type untouchedMetadata struct{ persistence.MetadataStore }
+type untouchedAccessLog struct{ persistence.AccessLogStore }
+
+func TestGetStatus_ReadsOnlyRedis(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	deps := testDependencies()
+	deps.UserStore = untouchedUsers{}
+	deps.MetadataStore = untouchedMetadata{}
+	deps.AccessLogStore = untouchedAccessLog{}
+	store := fakes.NewStorage()
+	deps.Storage = store
+	now := time.Now()
+	require.NoError(t, store.RecordHealthSample(context.Background(),
+		models.HealthSample{At: now.Add(-20 * time.Minute), Postgres: false, QueueDepth: -1}, time.Hour))
+	require.NoError(t, store.RecordHealthSample(context.Background(),
+		models.HealthSample{At: now, Redis: true, Postgres: true, QueueDepth: 120}, time.Hour))
+
+	router, err := api.SetupRouter(deps)
+	require.NoError(t, err)
+	get := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/api/status", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get()
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "public, max-age=30, stale-while-revalidate=30", w.Header().Get("Cache-Control"))
+	var status models.ServiceStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, models.ServiceOperational, status.Status, "the failure is outside the window")
+	assert.Equal(t, models.ComponentOK, status.Postgres)
+	assert.Equal(t, models.QueueElevated, status.NotificationQueue)
+	assert.NotContains(t, w.Body.String(), "120")
+
+	// Repeated checks are answered from the cache
+	store.HealthErr = errors.New("connection refused")
+	w = get()
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, models.ServiceOperational, status.Status)
+}
+
+func TestGetStatus_RedisUnreadable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	deps := testDependencies()
+	store := fakes.NewStorage()
+	store.HealthErr = errors.New("connection refused")
+	deps.Storage = store
+	router, err := api.SetupRouter(deps)
+	require.NoError(t, err)
+
+	req, _ := http.NewRequest("GET", "/api/status", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var status models.ServiceStatus
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &status))
+	assert.Equal(t, models.ServiceDegraded, status.Status)
+	assert.Equal(t, models.ComponentDegraded, status.Redis)
+	assert.Equal(t, models.ComponentUnknown, status.Postgres)
+	assert.Equal(t, models.QueueUnknown, status.NotificationQueue)
+}
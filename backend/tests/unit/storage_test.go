@@ -2,11 +2,16 @@ package unit
 
 import (
 	"context"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/milkiss/vanish/backend/internal/models"
 	"github.com/milkiss/vanish/backend/internal/storage"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -155,6 +160,31 @@ func TestExists(t *testing.T) {
 	assert.False(t, exists)
 }
 
+func TestDelete(t *testing.T) {
+	store := setupTestStorage(t)
+	defer store.Close()
+
+	ctx := context.Background()
+	stored := storeClaimable(t, store)
+	claimed := storeClaimable(t, store)
+	_, _, err := store.Claim(ctx, claimed, 1, time.Minute)
+	require.NoError(t, err)
+
+	deleted, err := store.Delete(ctx, []string{stored, claimed, "missing"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+
+	exists, err := store.Exists(ctx, stored)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	_, _, err = store.Claim(ctx, claimed, 2, time.Minute)
+	assert.ErrorIs(t, err, models.ErrMessageNotFound, "the claim is gone too")
+
+	deleted, err = store.Delete(ctx, nil)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+}
+
 func TestMessageNotFound(t *testing.T) {
 	store := setupTestStorage(t)
 	defer store.Close()
@@ -175,3 +205,401 @@ func TestPing(t *testing.T) {
 	err := store.Ping(ctx)
 	assert.NoError(t, err)
 }
+
+func TestStoreGeneratesShortUnpaddedIDs(t *testing.T) {
+	store := setupTestStorage(t)
+	defer store.Close()
+
+	id, err := store.Store(context.Background(), &models.Message{Ciphertext: "c", IV: "iv"}, time.Minute)
+	require.NoError(t, err)
+
+	assert.Regexp(t, `^[a-z2-7]{26}$`, id)
+	assert.Len(t, id, storage.IDLength)
+	assert.True(t, storage.ValidID(id))
+}
+
+func TestValidID(t *testing.T) {
+	tests := []struct {
+		id    string
+		valid bool
+	}{
+		{"abcdefghijklmnopqrstuvwxyz", true},
+		{"q7Zx_3-0aB9cDeFgHiJkLw==", true}, // legacy padded base64url
+		{"q7Zx_3-0aB9cDeFgHiJkLw", true},
+		{"", false},
+		{"==", false},
+		{"ab=c", false},
+		{"ab+c/d", false},
+		{"../etc", false},
+		{"with space", false},
+		{strings.Repeat("a", 65), false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.valid, storage.ValidID(tt.id), tt.id)
+	}
+}
+
+func storeClaimable(t *testing.T, store storage.Storage) string {
+	t.Helper()
+	id, err := store.Store(context.Background(), &models.Message{Ciphertext: "claim-data", IV: "claim-iv"}, time.Hour)
+	require.NoError(t, err)
+	return id
+}
+
+func TestClaim_OnlyOneUserWins(t *testing.T) {
+	store := setupTestStorage(t)
+	defer store.Close()
+	id := storeClaimable(t, store)
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		winners []int64
+	)
+	for user := int64(1); user <= 20; user++ {
+		wg.Add(1)
+		go func(user int64) {
+			defer wg.Done()
+			_, _, err := store.Claim(context.Background(), id, user, time.Minute)
+			if err == nil {
+				mu.Lock()
+				winners = append(winners, user)
+				mu.Unlock()
+				return
+			}
+			assert.ErrorIs(t, err, models.ErrMessageClaimed)
+		}(user)
+	}
+	wg.Wait()
+
+	require.Len(t, winners, 1)
+
+	// The message left the main keyspace, so a plain read finds nothing
+	_, err := store.GetAndDelete(context.Background(), id)
+	assert.Error(t, err)
+}
+
+func TestClaim_RepeatClaimReturnsSameToken(t *testing.T) {
+	store := setupTestStorage(t)
+	defer store.Close()
+	id := storeClaimable(t, store)
+	ctx := context.Background()
+
+	token, expiresAt, err := store.Claim(ctx, id, 7, time.Minute)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), expiresAt, 2*time.Second)
+
+	again, againExpiresAt, err := store.Claim(ctx, id, 7, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, token, again)
+	assert.False(t, againExpiresAt.After(expiresAt.Add(time.Second)), "a repeat claim must not extend the window")
+}
+
+func TestFetchClaim(t *testing.T) {
+	store := setupTestStorage(t)
+	defer store.Close()
+	id := storeClaimable(t, store)
+	ctx := context.Background()
+
+	token, _, err := store.Claim(ctx, id, 7, time.Minute)
+	require.NoError(t, err)
+
+	_, err = store.FetchClaim(ctx, id, 7, "wrong-token")
+	assert.Equal(t, models.ErrInvalidClaim, err)
+	_, err = store.FetchClaim(ctx, id, 8, token)
+	assert.Equal(t, models.ErrInvalidClaim, err)
+
+	msg, err := store.FetchClaim(ctx, id, 7, token)
+	require.NoError(t, err)
+	assert.Equal(t, "claim-data", msg.Ciphertext)
+
+	// The claim outlives a fetch, so a lost response can be fetched again
+	msg, err = store.FetchClaim(ctx, id, 7, token)
+	require.NoError(t, err)
+	assert.Equal(t, "claim-data", msg.Ciphertext)
+	_, err = store.FetchClaim(ctx, id, 8, token)
+	assert.Equal(t, models.ErrInvalidClaim, err)
+}
+
+func TestReadIntent_ReusedUntilTaken(t *testing.T) {
+	store := setupTestStorage(t)
+	defer store.Close()
+	id := storeClaimable(t, store)
+	ctx := context.Background()
+
+	token, expiresAt, err := store.IssueReadIntent(ctx, id, time.Minute)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), expiresAt, 2*time.Second)
+
+	again, againExpiresAt, err := store.IssueReadIntent(ctx, id, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, token, again)
+	assert.False(t, againExpiresAt.After(expiresAt.Add(time.Second)), "a repeat preview must not extend the window")
+
+	taken, err := store.TakeReadIntent(ctx, id, "wrong-token")
+	require.NoError(t, err)
+	assert.False(t, taken)
+	taken, err = store.TakeReadIntent(ctx, id, token)
+	require.NoError(t, err)
+	assert.True(t, taken)
+	taken, err = store.TakeReadIntent(ctx, id, token)
+	require.NoError(t, err)
+	assert.False(t, taken, "each intent is taken once")
+
+	fresh, _, err := store.IssueReadIntent(ctx, id, time.Minute)
+	require.NoError(t, err)
+	assert.NotEqual(t, token, fresh)
+}
+
+func TestClaim_Expires(t *testing.T) {
+	store := setupTestStorage(t)
+	defer store.Close()
+	id := storeClaimable(t, store)
+	ctx := context.Background()
+
+	token, _, err := store.Claim(ctx, id, 7, 50*time.Millisecond)
+	require.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+
+	_, err = store.FetchClaim(ctx, id, 7, token)
+	assert.Equal(t, models.ErrClaimNotFound, err)
+}
+
+func TestGetTTL(t *testing.T) {
+	store := setupTestStorage(t)
+	defer store.Close()
+	ctx := context.Background()
+
+	id, err := store.Store(ctx, &models.Message{Ciphertext: "c", IV: "iv"}, 10*time.Minute)
+	require.NoError(t, err)
+
+	ttl, err := store.GetTTL(ctx, id)
+	require.NoError(t, err)
+	assert.InDelta(t, float64(10*time.Minute), float64(ttl), float64(5*time.Second))
+
+	_, err = store.GetTTL(ctx, "missing")
+	assert.Equal(t, models.ErrMessageNotFound, err)
+
+	// A key whose expiry was removed reports NoExpiry
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379", DB: 1})
+	defer client.Close()
+	require.NoError(t, client.Persist(ctx, "vanish:message:"+id).Err())
+
+	ttl, err = store.GetTTL(ctx, id)
+	require.NoError(t, err)
+	assert.Equal(t, storage.NoExpiry, ttl)
+
+	// Reading the message removes it, and with it the TTL
+	_, err = store.GetAndDelete(ctx, id)
+	require.NoError(t, err)
+	_, err = store.GetTTL(ctx, id)
+	assert.Equal(t, models.ErrMessageNotFound, err)
+}
+
+func TestGetTTL_MemoryStorage(t *testing.T) {
+	store := fakes.NewStorage()
+	ctx := context.Background()
+
+	id, err := store.Store(ctx, &models.Message{Ciphertext: "c", IV: "iv"}, 10*time.Minute)
+	require.NoError(t, err)
+
+	ttl, err := store.GetTTL(ctx, id)
+	require.NoError(t, err)
+	assert.InDelta(t, float64(10*time.Minute), float64(ttl), float64(5*time.Second))
+
+	_, err = store.GetTTL(ctx, "missing")
+	assert.Equal(t, models.ErrMessageNotFound, err)
+
+	expiring, err := store.Store(ctx, &models.Message{Ciphertext: "c", IV: "iv"}, 10*time.Millisecond)
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	_, err = store.GetTTL(ctx, expiring)
+	assert.Equal(t, models.ErrMessageNotFound, err)
+}
+
+// Run with -race: a Redis restart drops the script cache, and every
+// goroutine then hits NOSCRIPT and reloads at the same time
+func TestGetAndDelete_ConcurrentScriptReload(t *testing.T) {
+	// An in-process Redis, so the script cache can be flushed freely
+	mr := miniredis.RunT(t)
+	store, err := storage.NewRedisStorage(mr.Addr(), "", 0)
+	require.NoError(t, err)
+	defer store.Close()
+	ctx := context.Background()
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+
+	const messages = 200
+	ids := make([]string, messages)
+	for i := range ids {
+		id, err := store.Store(ctx, &models.Message{Ciphertext: "c", IV: "iv"}, time.Minute)
+		require.NoError(t, err)
+		ids[i] = id
+	}
+
+	// Forget the scripts before the first read and again while reading
+	require.NoError(t, client.ScriptFlush(ctx).Err())
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		read    = make(map[string]int)
+		errs    []error
+		jobs    = make(chan string)
+		readers = 16
+	)
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for id := range jobs {
+				_, err := store.GetAndDelete(ctx, id)
+				mu.Lock()
+				if err != nil {
+					errs = append(errs, err)
+				} else {
+					read[id]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for i, id := range ids {
+		if i == messages/2 {
+			require.NoError(t, client.ScriptFlush(ctx).Err())
+		}
+		jobs <- id
+	}
+	close(jobs)
+	wg.Wait()
+
+	assert.Empty(t, errs)
+	assert.Len(t, read, messages, "every message is read")
+	for id, n := range read {
+		assert.Equal(t, 1, n, "message %s read more than once", id)
+	}
+}
+
+func TestRecordNotification(t *testing.T) {
+	redisStore := setupTestStorage(t)
+	defer redisStore.Close()
+
+	for name, store := range map[string]storage.Storage{"redis": redisStore, "memory": fakes.NewStorage()} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			key := "test-" + strings.ReplaceAll(time.Now().Format(time.RFC3339Nano), ":", "")
+
+			// The reference is only stored while the window is open
+			require.NoError(t, store.SetNotificationRef(ctx, key, "too early"))
+			count, ref, err := store.RecordNotification(ctx, key, 100*time.Millisecond)
+			require.NoError(t, err)
+			assert.Equal(t, 1, count)
+			assert.Empty(t, ref)
+
+			require.NoError(t, store.SetNotificationRef(ctx, key, "D1 1.1"))
+			count, ref, err = store.RecordNotification(ctx, key, 100*time.Millisecond)
+			require.NoError(t, err)
+			assert.Equal(t, 2, count)
+			assert.Equal(t, "D1 1.1", ref)
+
+			// Repeats do not extend the window
+			time.Sleep(150 * time.Millisecond)
+			count, ref, err = store.RecordNotification(ctx, key, 100*time.Millisecond)
+			require.NoError(t, err)
+			assert.Equal(t, 1, count)
+			assert.Empty(t, ref)
+
+			require.NoError(t, store.ForgetNotification(ctx, key))
+			count, _, err = store.RecordNotification(ctx, key, 100*time.Millisecond)
+			require.NoError(t, err)
+			assert.Equal(t, 1, count)
+		})
+	}
+}
+
+func TestHealthSamples(t *testing.T) {
+	redisStore := setupTestStorage(t)
+	defer redisStore.Close()
+	client := redis.NewClient(&redis.Options{Addr: "localhost:6379", DB: 1})
+	defer client.Close()
+	require.NoError(t, client.Del(context.Background(), "vanish:health_samples").Err())
+
+	for name, store := range map[string]storage.Storage{"redis": redisStore, "memory": fakes.NewStorage()} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			base := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+			sample := func(offset time.Duration, depth int) models.HealthSample {
+				return models.HealthSample{At: base.Add(offset), Redis: true, Postgres: true, QueueDepth: depth}
+			}
+
+			require.NoError(t, store.RecordHealthSample(ctx, sample(0, 1), 2*time.Minute))
+			require.NoError(t, store.RecordHealthSample(ctx, sample(time.Minute, 2), 2*time.Minute))
+			samples, err := store.HealthSamples(ctx, base.Add(30*time.Second))
+			require.NoError(t, err)
+			require.Len(t, samples, 1)
+			assert.Equal(t, 2, samples[0].QueueDepth)
+			assert.True(t, samples[0].At.Equal(base.Add(time.Minute)))
+
+			// Samples older than keep are dropped as new ones arrive
+			require.NoError(t, store.RecordHealthSample(ctx, sample(150*time.Second, 3), 2*time.Minute))
+			samples, err = store.HealthSamples(ctx, base)
+			require.NoError(t, err)
+			require.Len(t, samples, 2)
+			assert.Equal(t, 2, samples[0].QueueDepth)
+			assert.Equal(t, 3, samples[1].QueueDepth)
+		})
+	}
+}
+
+func TestScan(t *testing.T) {
+	redisStore := setupTestStorage(t)
+	defer redisStore.Close()
+
+	for name, store := range map[string]storage.Storage{"redis": redisStore, "memory": fakes.NewStorage()} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			createdAt := time.Now().UTC().Add(-time.Hour).Truncate(time.Millisecond)
+			stored := make(map[string]time.Time)
+			for i := 0; i < 5; i++ {
+				id, err := store.Store(ctx, &models.Message{Ciphertext: strings.Repeat("c", 500), IV: "iv", CreatedAt: createdAt}, time.Hour)
+				require.NoError(t, err)
+				stored[id] = createdAt
+			}
+			compressed, err := store.Store(ctx, &models.Message{Ciphertext: "c", IV: "iv",
+				ContentEncoding: models.ContentEncodingGzip, CreatedAt: createdAt}, time.Hour)
+			require.NoError(t, err)
+			stored[compressed] = createdAt
+			// A message stored before messages recorded their creation time
+			old, err := store.Store(ctx, &models.Message{Ciphertext: "c", IV: "iv"}, time.Hour)
+			require.NoError(t, err)
+			stored[old] = time.Time{}
+			_, _, err = store.RecordNotification(ctx, "scan-test", time.Minute)
+			require.NoError(t, err)
+
+			listed := make(map[string]time.Time)
+			var cursor uint64
+			for pages := 0; ; pages++ {
+				require.Less(t, pages, 1000, "the scan ends")
+				batch, next, err := store.Scan(ctx, cursor, 2)
+				require.NoError(t, err)
+				for _, m := range batch {
+					assert.NotContains(t, m.ID, ":", "only messages are listed")
+					listed[m.ID] = m.CreatedAt
+				}
+				if cursor = next; cursor == 0 {
+					break
+				}
+			}
+
+			for id, want := range stored {
+				got, ok := listed[id]
+				if assert.True(t, ok, "message %s listed", id) {
+					assert.True(t, want.Equal(got), "created_at of %s: got %v, want %v", id, got, want)
+				}
+				_, _ = store.GetAndDelete(ctx, id)
+			}
+		})
+	}
+}
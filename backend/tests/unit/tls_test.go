@@ -0,0 +1,145 @@
+package unit
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/milkiss/vanish/backend/internal/tlsutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSelfSignedCert writes a fresh self-signed certificate for commonName
+func writeSelfSignedCert(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{commonName},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+}
+
+// servedCommonName returns the CN of the certificate the reloader serves
+func servedCommonName(t *testing.T, r *tlsutil.CertReloader) string {
+	t.Helper()
+
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+
+	writeSelfSignedCert(t, certFile, keyFile, "first.example.com")
+	reloader, err := tlsutil.NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, "first.example.com", servedCommonName(t, reloader))
+
+	// Renewed certificate is picked up on reload
+	writeSelfSignedCert(t, certFile, keyFile, "renewed.example.com")
+	require.NoError(t, reloader.Reload())
+	assert.Equal(t, "renewed.example.com", servedCommonName(t, reloader))
+
+	// A broken renewal keeps the previous certificate
+	require.NoError(t, os.WriteFile(certFile, []byte("not a certificate"), 0o600))
+	assert.Error(t, reloader.Reload())
+	assert.Equal(t, "renewed.example.com", servedCommonName(t, reloader))
+}
+
+func TestNewCertReloader_MissingFiles(t *testing.T) {
+	dir := t.TempDir()
+	_, err := tlsutil.NewCertReloader(filepath.Join(dir, "missing.crt"), filepath.Join(dir, "missing.key"))
+	assert.Error(t, err)
+}
+
+func TestServerConfig_Minimums(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	writeSelfSignedCert(t, certFile, keyFile, "localhost")
+
+	reloader, err := tlsutil.NewCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	cfg := tlsutil.ServerConfig(reloader)
+
+	assert.Equal(t, uint16(tls.VersionTLS12), cfg.MinVersion)
+	for _, suite := range tls.InsecureCipherSuites() {
+		assert.NotContains(t, cfg.CipherSuites, suite.ID, suite.Name)
+	}
+
+	// A TLS 1.1-only client is refused
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = cfg
+	server.StartTLS()
+	defer server.Close()
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		InsecureSkipVerify: true,
+		MaxVersion:         tls.VersionTLS11,
+	}}}
+	_, err = client.Get(server.URL)
+	assert.Error(t, err)
+
+	modern := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	resp, err := modern.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		httpsPort string
+		host      string
+		target    string
+		expected  string
+	}{
+		{"default port", "443", "vanish.example.com", "/api/v1/users?limit=5", "https://vanish.example.com/api/v1/users?limit=5"},
+		{"custom port", "8443", "vanish.example.com:8080", "/health", "https://vanish.example.com:8443/health"},
+		{"ipv6 host", "443", "[::1]:8080", "/", "https://[::1]/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.target, nil)
+			req.Host = tt.host
+			w := httptest.NewRecorder()
+			tlsutil.RedirectHandler(tt.httpsPort).ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+			assert.Equal(t, tt.expected, w.Header().Get("Location"))
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package unit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/integrations/slack"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// spanNamed returns the only exported span called name
+func spanNamed(t *testing.T, spans tracetest.SpanStubs, name string) tracetest.SpanStub {
+	t.Helper()
+	var found []tracetest.SpanStub
+	for _, span := range spans {
+		if span.Name == name {
+			found = append(found, span)
+		}
+	}
+	require.Len(t, found, 1, "spans named %q", name)
+	return found[0]
+}
+
+// childNames lists the names of the direct children of parent
+func childNames(spans tracetest.SpanStubs, parent tracetest.SpanStub) []string {
+	var names []string
+	for _, span := range spans {
+		if span.Parent.SpanID() == parent.SpanContext.SpanID() {
+			names = append(names, span.Name)
+		}
+	}
+	return names
+}
+
+// attribute returns the value of key on span, or ""
+func attribute(span tracetest.SpanStub, key string) string {
+	for _, kv := range span.Attributes {
+		if string(kv.Key) == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestTracing_CreateAndReadSpanHierarchy(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+
+	// Tracing must be set up before the clients it instruments are created
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown, err := tracing.Setup(ctx, tracing.Options{ServiceName: "vanish-test", Exporter: exporter})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = shutdown(context.Background()) })
+
+	store := setupTestStorage(t)
+	defer store.Close()
+
+	traceparents := make(chan string, 10)
+	slackAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparents <- r.Header.Get("traceparent")
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"ok":true,"user":{"id":"U1"},"channel":{"id":"D1"}}`)
+	}))
+	t.Cleanup(slackAPI.Close)
+
+	deps := testDependencies()
+	deps.Storage = store
+	deps.Config.Slack.Enabled = true
+	deps.SlackClient = slack.NewClient(&slack.Config{BotToken: "xoxb-test", APIURL: slackAPI.URL})
+	require.NoError(t, deps.UserStore.Create(ctx, &models.User{Email: "sender@example.com", Name: "Sender"}))
+	require.NoError(t, deps.UserStore.Create(ctx, &models.User{Email: "recipient@example.com", Name: "Recipient"}))
+	router, err := api.SetupRouter(deps)
+	require.NoError(t, err)
+	senderToken, _ := deps.JWTManager.Generate(1, "sender@example.com")
+	recipientToken, _ := deps.JWTManager.Generate(2, "recipient@example.com")
+
+	call := func(method, path, token, body string, header http.Header) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The create request continues the caller's trace
+	upstream := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	w := call("POST", "/api/v1/messages", senderToken,
+		`{"ciphertext":"Yw==","iv":"aXY=","recipient_id":2,"encryption_key":"k"}`,
+		http.Header{"Traceparent": {upstream}, "X-Request-Id": {"req-create-1"}})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created models.CreateMessageResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	id := created.ID
+
+	w = call("POST", "/api/v1/notifications/send-slack", senderToken,
+		`{"recipient_id":2,"message_url":"http://localhost:5173/m/`+id+`#key"}`, nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	w = call("GET", "/api/v1/messages/"+id, recipientToken, "", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	spans := exporter.GetSpans()
+
+	createSpan := spanNamed(t, spans, "POST /api/v1/messages")
+	assert.Equal(t, trace.SpanKindServer, createSpan.SpanKind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", createSpan.SpanContext.TraceID().String())
+	assert.Equal(t, "req-create-1", attribute(createSpan, "vanish.request_id"))
+	assert.Equal(t, "/api/v1/messages", attribute(createSpan, "http.route"))
+	assert.Equal(t, tracing.HashID(id), attribute(createSpan, "vanish.message_id_hash"))
+	assert.Contains(t, childNames(spans, createSpan), "redis SET")
+
+	notifySpan := spanNamed(t, spans, "POST /api/v1/notifications/send-slack")
+	outbound := childNames(spans, notifySpan)
+	require.NotEmpty(t, outbound)
+	for _, name := range outbound {
+		assert.True(t, strings.HasPrefix(name, "HTTP "), name)
+	}
+	// Slack receives the trace context of the request that called it
+	traceparent := <-traceparents
+	assert.Contains(t, traceparent, notifySpan.SpanContext.TraceID().String())
+
+	readSpan := spanNamed(t, spans, "GET /api/v1/messages/:id")
+	assert.Equal(t, tracing.HashID(id), attribute(readSpan, "vanish.message_id_hash"))
+	assert.NotEmpty(t, attribute(readSpan, "vanish.request_id"))
+	assert.Equal(t, "200", attribute(readSpan, "http.response.status_code"))
+	assert.Contains(t, childNames(spans, readSpan), "redis EVALSHA")
+
+	// Message IDs, keys and URL paths never reach a span
+	for _, span := range spans {
+		assert.NotContains(t, span.Name, id)
+		for _, kv := range span.Attributes {
+			assert.NotContains(t, kv.Value.Emit(), id, "span %q attribute %s", span.Name, kv.Key)
+			assert.NotContains(t, kv.Value.Emit(), "message:", "span %q attribute %s", span.Name, kv.Key)
+			assert.NotContains(t, kv.Value.Emit(), "chat.postMessage", "span %q attribute %s", span.Name, kv.Key)
+			assert.NotContains(t, kv.Value.Emit(), "recipient@example.com", "span %q attribute %s", span.Name, kv.Key)
+		}
+	}
+}
+
+func TestTracing_DisabledIsNoop(t *testing.T) {
+	require.False(t, tracing.Enabled())
+
+	ctx := context.Background()
+	spanCtx, span := tracing.Start(ctx, "unused")
+	assert.False(t, span.IsRecording())
+	assert.Equal(t, ctx, spanCtx)
+	tracing.SetMessageID(ctx, "abc")
+	span.End()
+}
+
+func TestHashID(t *testing.T) {
+	assert.Len(t, tracing.HashID("abc"), 16)
+	assert.Equal(t, tracing.HashID("abc"), tracing.HashID("abc"))
+	assert.NotEqual(t, tracing.HashID("abc"), tracing.HashID("abd"))
+}
@@ -0,0 +1,275 @@
+package unit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/milkiss/vanish/backend/internal/api"
+	"github.com/milkiss/vanish/backend/internal/messages"
+	"github.com/milkiss/vanish/backend/internal/models"
+	"github.com/milkiss/vanish/backend/tests/fakes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchTTLPolicy_FirstMatchWins(t *testing.T) {
+	rules := []*models.TTLPolicyRule{
+		{ID: 1, RecipientDomainGlob: "vanish.example.com"},
+		{ID: 2, RecipientDomainGlob: "*.example.com"},
+		{ID: 3, RecipientDomainGlob: "EXAMPLE.com"},
+		{ID: 4, RecipientDomainGlob: "*"},
+	}
+	tests := []struct {
+		email string
+		want  int64 // 0 for no match
+	}{
+		{"alice@vanish.example.com", 1},
+		{"bob@eu.example.com", 2},
+		{"carol@Example.COM", 3},
+		{"dave@partner.org", 4},
+		{"not-an-email", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			rule := models.MatchTTLPolicy(rules, tt.email)
+			if tt.want == 0 {
+				assert.Nil(t, rule)
+				return
+			}
+			require.NotNil(t, rule)
+			assert.Equal(t, tt.want, rule.ID)
+		})
+	}
+
+	assert.Nil(t, models.MatchTTLPolicy(rules[:3], "dave@partner.org"), "no catch-all, no rule")
+}
+
+func TestTTLPolicyRuleRequest_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		req     models.TTLPolicyRuleRequest
+		invalid []string
+	}{
+		{"valid", models.TTLPolicyRuleRequest{RecipientDomainGlob: "*.example.com", DefaultTTL: 3600, MaxTTL: 86400}, nil},
+		{"bad glob", models.TTLPolicyRuleRequest{RecipientDomainGlob: "[a-", DefaultTTL: 3600, MaxTTL: 3600}, []string{"recipient_domain_glob"}},
+		{"email not domain", models.TTLPolicyRuleRequest{RecipientDomainGlob: "a@example.com", DefaultTTL: 3600, MaxTTL: 3600}, []string{"recipient_domain_glob"}},
+		{"max above global", models.TTLPolicyRuleRequest{RecipientDomainGlob: "*", DefaultTTL: 3600, MaxTTL: models.MaxTTL + 1}, []string{"max_ttl"}},
+		{"default above max", models.TTLPolicyRuleRequest{RecipientDomainGlob: "*", DefaultTTL: 7200, MaxTTL: 3600}, []string{"default_ttl"}},
+		{"default below min", models.TTLPolicyRuleRequest{RecipientDomainGlob: "*", DefaultTTL: 60, MaxTTL: 3600}, []string{"default_ttl"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := tt.req.Validate()
+			var fields []string
+			for field := range problems {
+				fields = append(fields, field)
+			}
+			assert.ElementsMatch(t, tt.invalid, fields)
+		})
+	}
+}
+
+// policyService returns a message service to user 2 (recipient@example.com)
+// with the given rules in order
+func policyService(t *testing.T, rules ...models.TTLPolicyRule) *messages.Service {
+	t.Helper()
+	users := seedUsers(t)
+	policies := fakes.NewTTLPolicyStore()
+	for i := range rules {
+		require.NoError(t, policies.CreateTTLPolicy(context.Background(), &rules[i], nil))
+	}
+	return messages.NewService(fakes.NewStorage(), fakes.NewMetadataStore(users), 0, users, policies)
+}
+
+func TestMessageService_TTLPolicy(t *testing.T) {
+	external := models.TTLPolicyRule{RecipientDomainGlob: "example.com", DefaultTTL: 3600, MaxTTL: 7200}
+	ttl := func(seconds int64) *int64 { return &seconds }
+	tests := []struct {
+		name        string
+		rules       []models.TTLPolicyRule
+		ttl         *int64
+		wantTTL     time.Duration
+		wantLimited bool
+	}{
+		{"default from policy", []models.TTLPolicyRule{external}, nil, time.Hour, false},
+		{"within max", []models.TTLPolicyRule{external}, ttl(5400), 90 * time.Minute, false},
+		{"cut to max", []models.TTLPolicyRule{external}, ttl(86400), 2 * time.Hour, true},
+		{"no matching rule", []models.TTLPolicyRule{{RecipientDomainGlob: "other.org", DefaultTTL: 3600, MaxTTL: 3600}}, nil, time.Duration(models.DefaultTTL) * time.Second, false},
+		{"earlier rule wins", []models.TTLPolicyRule{{RecipientDomainGlob: "*", DefaultTTL: 7200, MaxTTL: 7200}, external}, nil, 2 * time.Hour, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := policyService(t, tt.rules...)
+
+			metadata, err := service.CreateEncrypted(context.Background(), 1, 2, servicePayload, tt.ttl, messages.CreateOptions{})
+			require.NoError(t, err)
+			assert.WithinDuration(t, time.Now().Add(tt.wantTTL), metadata.ExpiresAt, 5*time.Second)
+			assert.Equal(t, tt.wantLimited, metadata.TTLLimitedByPolicy)
+		})
+	}
+}
+
+func TestMessageService_TTLPolicyKeepsGlobalLimits(t *testing.T) {
+	service := policyService(t, models.TTLPolicyRule{RecipientDomainGlob: "*", DefaultTTL: 3600, MaxTTL: 7200})
+
+	tooLong := int64(models.MaxTTL + 1)
+	_, err := service.CreateEncrypted(context.Background(), 1, 2, servicePayload, &tooLong, messages.CreateOptions{})
+	assertServiceError(t, err, models.ErrorCodeTTLOutOfRange)
+}
+
+// ttlPolicyRouter returns a function calling the router as admin user 3,
+// with user 2 (recipient@example.com) to send to
+func ttlPolicyRouter(t *testing.T) func(method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	deps := testDependencies()
+	deps.Storage = fakes.NewStorage()
+	deps.TTLPolicyStore = fakes.NewTTLPolicyStore()
+	ctx := context.Background()
+	for _, u := range []*models.User{
+		{Email: "sender@example.com", Name: "Sender"},
+		{Email: "recipient@example.com", Name: "Recipient"},
+		{Email: "admin@example.com", Name: "Admin", IsAdmin: true},
+	} {
+		require.NoError(t, deps.UserStore.Create(ctx, u))
+	}
+	router, err := api.SetupRouter(deps)
+	require.NoError(t, err)
+
+	do := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		if body != nil {
+			require.NoError(t, json.NewEncoder(&buf).Encode(body))
+		}
+		token, err := deps.JWTManager.Generate(3, "admin@example.com")
+		require.NoError(t, err)
+		req, _ := http.NewRequest(method, path, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	return do
+}
+
+func TestTTLPolicies_CRUD(t *testing.T) {
+	do := ttlPolicyRouter(t)
+	position := func(p int) *int { return &p }
+
+	create := func(req models.TTLPolicyRuleRequest) models.TTLPolicyRule {
+		t.Helper()
+		w := do("POST", "/api/v1/admin/ttl-policies", req)
+		require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+		var rule models.TTLPolicyRule
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rule))
+		return rule
+	}
+	list := func() []models.TTLPolicyRule {
+		t.Helper()
+		w := do("GET", "/api/v1/admin/ttl-policies", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		var rules []models.TTLPolicyRule
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &rules))
+		return rules
+	}
+
+	catchAll := create(models.TTLPolicyRuleRequest{RecipientDomainGlob: "*", DefaultTTL: 3600, MaxTTL: 3600})
+	internal := create(models.TTLPolicyRuleRequest{RecipientDomainGlob: "example.com", DefaultTTL: 86400, MaxTTL: 604800})
+	assert.Equal(t, 0, catchAll.Position)
+	assert.Equal(t, 1, internal.Position, "appended after the others")
+	rules := list()
+	require.Len(t, rules, 2)
+	assert.Equal(t, catchAll.ID, rules[0].ID)
+
+	// Move the internal rule ahead of the catch-all
+	w := do("PUT", "/api/v1/admin/ttl-policies/"+strconv.FormatInt(internal.ID, 10), models.TTLPolicyRuleRequest{
+		Position: position(-1), RecipientDomainGlob: "example.com", DefaultTTL: 86400, MaxTTL: 604800,
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "negative position")
+	w = do("PUT", "/api/v1/admin/ttl-policies/"+strconv.FormatInt(catchAll.ID, 10), models.TTLPolicyRuleRequest{
+		Position: position(5), RecipientDomainGlob: "*", DefaultTTL: 3600, MaxTTL: 7200,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	rules = list()
+	assert.Equal(t, []int64{internal.ID, catchAll.ID}, []int64{rules[0].ID, rules[1].ID})
+	assert.Equal(t, int64(7200), rules[1].MaxTTL)
+
+	// Settings report the same rules
+	w = do("GET", "/api/v1/admin/settings", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var settings api.AdminSettingsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &settings))
+	require.Len(t, settings.TTLPolicies, 2)
+	assert.Equal(t, internal.ID, settings.TTLPolicies[0].ID)
+
+	w = do("DELETE", "/api/v1/admin/ttl-policies/"+strconv.FormatInt(internal.ID, 10), nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, list(), 1)
+
+	for _, missing := range []*httptest.ResponseRecorder{
+		do("DELETE", "/api/v1/admin/ttl-policies/"+strconv.FormatInt(internal.ID, 10), nil),
+		do("PUT", "/api/v1/admin/ttl-policies/"+strconv.FormatInt(internal.ID, 10), models.TTLPolicyRuleRequest{RecipientDomainGlob: "*", DefaultTTL: 3600, MaxTTL: 3600}),
+	} {
+		require.Equal(t, http.StatusNotFound, missing.Code)
+		var errResp models.ErrorResponse
+		require.NoError(t, json.Unmarshal(missing.Body.Bytes(), &errResp))
+		assert.Equal(t, models.ErrorCodeTTLPolicyNotFound, errResp.Code)
+	}
+}
+
+func TestTTLPolicies_RejectInvalidRule(t *testing.T) {
+	do := ttlPolicyRouter(t)
+
+	w := do("POST", "/api/v1/admin/ttl-policies", models.TTLPolicyRuleRequest{RecipientDomainGlob: "*", DefaultTTL: 7200, MaxTTL: 3600})
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	var errResp models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &errResp))
+	assert.Equal(t, models.ErrorCodeValidationFailed, errResp.Code)
+	assert.Contains(t, errResp.Details, "default_ttl")
+
+	w = do("PUT", "/api/v1/admin/ttl-policies/abc", models.TTLPolicyRuleRequest{RecipientDomainGlob: "*", DefaultTTL: 3600, MaxTTL: 3600})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCreateMessage_ReportsTTLLimitedByPolicy(t *testing.T) {
+	do := ttlPolicyRouter(t)
+	w := do("POST", "/api/v1/admin/ttl-policies", models.TTLPolicyRuleRequest{RecipientDomainGlob: "example.com", DefaultTTL: 3600, MaxTTL: 3600})
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	ttl := int64(86400)
+	item := bulkItem(2)
+	item.TTL = &ttl
+	w = do("POST", "/api/v1/messages", item)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var resp models.CreateMessageResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.True(t, resp.TTLLimitedByPolicy)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), resp.ExpiresAt, 5*time.Second)
+
+	w = do("POST", "/api/v1/messages/bulk", models.BulkCreateMessageRequest{Messages: []models.CreateMessageRequest{item, bulkItem(2)}})
+	require.Equal(t, http.StatusMultiStatus, w.Code)
+	var bulk models.BulkCreateMessageResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &bulk))
+	assert.True(t, bulk.Results[0].TTLLimitedByPolicy)
+	assert.False(t, bulk.Results[1].TTLLimitedByPolicy, "the policy default is not a truncation")
+}
+
+func TestTTLPolicies_UnavailableWithoutStore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := api.NewAdminHandler(fakes.NewUserStore(), fakes.NewMetadataStore(nil), fakes.NewStorage(), nil, testDependencies().Config, nil, nil)
+	router := gin.New()
+	router.GET("/admin/ttl-policies", handler.ListTTLPolicies)
+
+	req, _ := http.NewRequest("GET", "/admin/ttl-policies", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
@@ -0,0 +1,93 @@
+package unit
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/milkiss/vanish/backend/internal/urlbuilder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testLinks returns a URL builder for the default local frontend
+func testLinks(t *testing.T) *urlbuilder.Builder {
+	t.Helper()
+	links, err := urlbuilder.New("http://localhost:5173")
+	require.NoError(t, err)
+	return links
+}
+
+func TestURLBuilder_ValidatesBaseURL(t *testing.T) {
+	tests := []struct {
+		base  string
+		valid bool
+	}{
+		{"http://localhost:5173", true},
+		{"https://vanish.example.com", true},
+		{"https://example.com/vanish", true},
+		{"https://vanish.example.com/", false},
+		{"vanish.example.com", false},
+		{"/relative", false},
+		{"ftp://vanish.example.com", false},
+		{"https://vanish.example.com?x=1", false},
+		{"https://vanish.example.com#top", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.base, func(t *testing.T) {
+			_, err := urlbuilder.New(tt.base)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestURLBuilder_MessageURLKeepsKeyInFragment(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{"standard base64 with padding", "ab+/cd=="},
+		{"url-safe base64 with padding", "ab-_cd=="},
+		{"no padding", "abcd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link := testLinks(t).MessageURL("msg-1", tt.key)
+
+			assert.Equal(t, "http://localhost:5173/m/msg-1#"+tt.key, link)
+
+			parsed, err := url.Parse(link)
+			require.NoError(t, err)
+			assert.Equal(t, tt.key, parsed.Fragment)
+			assert.Empty(t, parsed.RawQuery)
+		})
+	}
+}
+
+func TestURLBuilder_EscapesUnsafeCharacters(t *testing.T) {
+	links, err := urlbuilder.New("https://example.com/vanish")
+	require.NoError(t, err)
+
+	link := links.MessageURL("a/b?c", "k y#")
+
+	assert.Equal(t, "https://example.com/vanish/m/a%2Fb%3Fc#k%20y%23", link)
+}
+
+func TestURLBuilder_AuthCallbackURL(t *testing.T) {
+	link := testLinks(t).AuthCallbackURL("header.payload.sig")
+
+	assert.Equal(t, "http://localhost:5173/auth/callback#token=header.payload.sig", link)
+}
+
+func TestURLBuilder_ExternalMessageURL(t *testing.T) {
+	links := testLinks(t)
+
+	assert.Equal(t, links.Base()+"/m/abc123/1767225600.c2lnbmF0dXJl#a2V5+/=",
+		links.ExternalMessageURL("abc123", "1767225600.c2lnbmF0dXJl", "a2V5+/="))
+}
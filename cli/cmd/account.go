@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/zafrem/vanish/shared/config"
+	"github.com/zafrem/vanish/shared/crypto"
+	"github.com/zafrem/vanish/shared/models"
+)
+
+// Configure is `vanish config`: it asks on in for the server URL and token
+// and saves them with the connection flags
+func (a *App) Configure(args []string, in io.Reader, out io.Writer) error {
+	fs := a.flags("config", true)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(in)
+
+	fmt.Fprint(out, "Enter Vanish Server URL [http://localhost:8080]: ")
+	url, _ := reader.ReadString('\n')
+	url = strings.TrimSpace(url)
+	if url == "" {
+		url = "http://localhost:8080"
+	}
+
+	fmt.Fprint(out, "Enter API Token (get from local storage/login): ")
+	token, _ := reader.ReadString('\n')
+	token = strings.TrimSpace(token)
+
+	cfg := &config.Config{
+		BaseURL: url,
+		Token:   token,
+	}
+
+	// Keep saved connection settings unless flags replace them
+	if existing, err := a.LoadConfig(); err == nil {
+		cfg.CABundle, cfg.ClientCert, cfg.ClientKey, cfg.Proxy = existing.CABundle, existing.ClientCert, existing.ClientKey, existing.Proxy
+	}
+	a.applyConnectionFlags(cfg)
+
+	if err := a.SaveConfig(cfg); err != nil {
+		return fail(ExitConfig, fmt.Errorf("saving config: %w", err))
+	}
+
+	fmt.Fprintln(out, "Configuration saved successfully!")
+	return nil
+}
+
+// Inbox is `vanish inbox`: the unread secrets waiting for us
+func (a *App) Inbox(args []string, in io.Reader, out io.Writer) error {
+	fs := a.flags("inbox", true)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	cfg, apiClient, err := a.connect()
+	if err != nil {
+		return err
+	}
+	inbox, err := apiClient.GetInbox()
+	if err != nil {
+		return failAction("listing inbox", err)
+	}
+
+	if len(inbox) == 0 {
+		fmt.Fprintln(out, "No secrets waiting for you.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "EXPIRES IN\tFROM\tLINK")
+	for _, m := range inbox {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", formatCountdown(time.Duration(m.ExpiresInSeconds)*time.Second), m.SenderLabel, inboxLink(cfg.BaseURL, m))
+	}
+	w.Flush()
+	fmt.Fprintln(out, "\nOpen one with: vanish receive <link>")
+	return nil
+}
+
+// History is `vanish history`: the secrets we sent and received
+func (a *App) History(args []string, in io.Reader, out io.Writer) error {
+	fs := a.flags("history", true)
+	search := fs.String("search", "", "Only show secrets whose counterpart or category contains this text")
+	limit := fs.Int("limit", 50, "Maximum number of secrets to show")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	_, apiClient, err := a.connect()
+	if err != nil {
+		return err
+	}
+	history, err := apiClient.SearchMessageHistory(*search, *limit)
+	if err != nil {
+		return failAction("listing history", err)
+	}
+
+	if len(history) == 0 {
+		if *search != "" {
+			fmt.Fprintf(out, "No secrets match %q.\n", *search)
+		} else {
+			fmt.Fprintln(out, "No secrets sent or received yet.")
+		}
+		return nil
+	}
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CREATED\tWITH\tCATEGORY\tSTATUS\tID")
+	for _, h := range history {
+		category := h.Category
+		if category == "" {
+			category = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", h.CreatedAt.Local().Format("2006-01-02 15:04"), counterpart(h), category, h.Status, h.MessageID)
+	}
+	w.Flush()
+	return nil
+}
+
+// counterpart names the other party of a history entry, with an arrow for
+// the direction: "→ Dana" for a secret sent to Dana, "← Dana" for one
+// received from Dana. A secret sent to oneself reads as sent
+func counterpart(h models.MessageHistoryResponse) string {
+	if h.IsSender {
+		return "→ " + h.RecipientName
+	}
+	label := h.SenderLabel
+	if label == "" {
+		label = h.SenderName
+	}
+	return "← " + label
+}
+
+// inboxLink is what the inbox shows to open a message: its link when the
+// server keeps the key, otherwise where the key is. Sealed messages open
+// from the link without a key, like those `vanish send` prints
+func inboxLink(baseURL string, m models.InboxMessage) string {
+	switch {
+	case m.URL != "":
+		return m.URL
+	case m.SealedKey != "":
+		return fmt.Sprintf("%s/m/%s (sealed to your key)", baseURL, m.MessageID)
+	default:
+		return fmt.Sprintf("%s (key only in your Slack DM)", m.MessageID)
+	}
+}
+
+// formatCountdown renders a remaining time as e.g. "2d 3h", "1h 05m" or "42s"
+func formatCountdown(d time.Duration) string {
+	if d <= 0 {
+		return "expiring"
+	}
+	d = d.Round(time.Second)
+	days := int(d / (24 * time.Hour))
+	hours := int(d % (24 * time.Hour) / time.Hour)
+	minutes := int(d % time.Hour / time.Minute)
+	seconds := int(d % time.Minute / time.Second)
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %02dm", hours, minutes)
+	case minutes > 0:
+		return fmt.Sprintf("%dm %02ds", minutes, seconds)
+	default:
+		return fmt.Sprintf("%ds", seconds)
+	}
+}
+
+// Export is `vanish export`: everything the server stores about us,
+// written to a private file
+func (a *App) Export(args []string, in io.Reader, out io.Writer) error {
+	fs := a.flags("export", true)
+	path := fs.String("o", "vanish-export.json", "File to write the export to")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	_, apiClient, err := a.connect()
+	if err != nil {
+		return err
+	}
+	data, err := apiClient.ExportData()
+	if err != nil {
+		return failAction("exporting data", err)
+	}
+
+	// The export names everyone you exchanged secrets with; keep it private
+	if err := os.WriteFile(*path, data, 0600); err != nil {
+		return fail(ExitFailure, fmt.Errorf("writing %s: %w", *path, err))
+	}
+
+	fmt.Fprintf(out, "✓ Data export written to %s\n", *path)
+	return nil
+}
+
+// Resend is `vanish resend <message-id>`: notify the recipient of an
+// unread secret again
+func (a *App) Resend(args []string, in io.Reader, out io.Writer) error {
+	fs := a.flags("resend", true)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usage("vanish resend <message-id>")
+	}
+
+	_, apiClient, err := a.connect()
+	if err != nil {
+		return err
+	}
+	channel, err := apiClient.ResendNotification(fs.Arg(0))
+	if err != nil {
+		return failAction("resending notification", err)
+	}
+
+	fmt.Fprintf(out, "✓ Recipient notified again via %s\n", channel)
+	return nil
+}
+
+// Keygen is `vanish keygen`: it creates an X25519 key pair, keeps the
+// private key in ~/.vanish/identity and uploads the public key so senders
+// seal link keys to it instead of storing them on the server
+func (a *App) Keygen(args []string, in io.Reader, out io.Writer) error {
+	fs := a.flags("keygen", true)
+	force := fs.Bool("force", false, "Replace an existing key pair")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	_, apiClient, err := a.connect()
+	if err != nil {
+		return err
+	}
+
+	if existing, err := config.LoadIdentity(); err == nil && !*force {
+		fmt.Fprintf(out, "Public key: %s\n", existing.PublicKey)
+		return fail(ExitUsage, errors.New("a key pair already exists. Use -force to replace it; messages already sealed to it can then no longer be opened"))
+	}
+
+	publicKey, privateKey, err := crypto.GenerateKeyPair()
+	if err != nil {
+		return fail(ExitFailure, err)
+	}
+
+	// Save locally first so an uploaded key always has its private half
+	if err := config.SaveIdentity(&config.Identity{PublicKey: publicKey, PrivateKey: privateKey}); err != nil {
+		return fail(ExitConfig, fmt.Errorf("saving key pair: %w", err))
+	}
+
+	if err := apiClient.SetPublicKey(publicKey); err != nil {
+		return failAction("uploading public key", err)
+	}
+
+	path, _ := config.GetIdentityPath()
+	fmt.Fprintf(out, "✓ Key pair saved to %s\n", path)
+	fmt.Fprintf(out, "Public key: %s\n", publicKey)
+	fmt.Fprintln(out, "Keep the private key safe: without it, secrets sealed to you cannot be opened.")
+	return nil
+}
@@ -0,0 +1,246 @@
+// Package cmd implements the vanish commands. Each command is a method of
+// App taking its arguments, the input it reads and the output it writes its
+// results to, and returns an error instead of exiting, so the flows can be
+// tested against a fake server. Errors carry their exit status; see
+// ExitStatus and Report
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/zafrem/vanish/shared/client"
+	"github.com/zafrem/vanish/shared/config"
+	"golang.org/x/term"
+)
+
+// App holds what the commands depend on. New fills in the real ones; tests
+// replace them
+type App struct {
+	Version   string // CLI release, e.g. "1.4.0"; "dev" for local builds
+	BuildTime string
+
+	// Stderr receives warnings and flag errors; results go to the writer
+	// each command is given
+	Stderr io.Writer
+
+	// LoadConfig and SaveConfig read and write the saved configuration
+	LoadConfig func() (*config.Config, error)
+	SaveConfig func(*config.Config) error
+	// NewClient connects to the server of a configuration
+	NewClient func(*config.Config) (*client.Client, error)
+	// Now is the clock schedules and countdowns are computed from
+	Now func() time.Time
+	// IsTerminal reports whether in is a person typing at a terminal rather
+	// than a pipe or file; ReadPassword reads a line from it without echo
+	IsTerminal   func(in io.Reader) bool
+	ReadPassword func(in io.Reader) (string, error)
+
+	conn connFlags
+}
+
+// New returns an App working on the real configuration, server, clock and
+// terminal
+func New(version, buildTime string) *App {
+	return &App{
+		Version:    version,
+		BuildTime:  buildTime,
+		Stderr:     os.Stderr,
+		LoadConfig: config.LoadConfig,
+		SaveConfig: config.SaveConfig,
+		NewClient: func(cfg *config.Config) (*client.Client, error) {
+			opts := client.OptionsFromConfig(cfg)
+			opts.Kind = client.KindCLI
+			return client.NewClientWithOptions(cfg, opts)
+		},
+		Now:          time.Now,
+		IsTerminal:   isTerminal,
+		ReadPassword: readPassword,
+	}
+}
+
+// isTerminal reports whether in is a terminal
+func isTerminal(in io.Reader) bool {
+	f, ok := in.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// readPassword reads a line from the terminal in without echoing it
+func readPassword(in io.Reader) (string, error) {
+	f, ok := in.(*os.File)
+	if !ok {
+		return "", errors.New("not a terminal")
+	}
+	secret, err := term.ReadPassword(int(f.Fd()))
+	return string(secret), err
+}
+
+// connFlags holds the connection flags; values that were given override
+// both the config file and the VANISH_* environment variables
+type connFlags struct {
+	caBundle, clientCert, clientKey, proxy string
+}
+
+// addConnectionFlags adds the connection flags to fs, for every command
+// that talks to the server
+func (a *App) addConnectionFlags(fs *flag.FlagSet) {
+	fs.StringVar(&a.conn.caBundle, "ca-bundle", "", "PEM file of extra trusted CAs")
+	fs.StringVar(&a.conn.clientCert, "client-cert", "", "Client certificate for mutual TLS")
+	fs.StringVar(&a.conn.clientKey, "client-key", "", "Client key for mutual TLS")
+	fs.StringVar(&a.conn.proxy, "proxy", "", "Proxy URL")
+}
+
+// applyConnectionFlags copies the connection flags that were given into cfg
+func (a *App) applyConnectionFlags(cfg *config.Config) {
+	if a.conn.caBundle != "" {
+		cfg.CABundle = a.conn.caBundle
+	}
+	if a.conn.clientCert != "" {
+		cfg.ClientCert = a.conn.clientCert
+	}
+	if a.conn.clientKey != "" {
+		cfg.ClientKey = a.conn.clientKey
+	}
+	if a.conn.proxy != "" {
+		cfg.Proxy = a.conn.proxy
+	}
+}
+
+// loadConfig loads the saved configuration with connection flags applied,
+// failing with ExitConfig when there is no usable configuration
+func (a *App) loadConfig() (*config.Config, error) {
+	cfg, err := a.LoadConfig()
+	if err == nil {
+		a.applyConnectionFlags(cfg)
+		err = cfg.Validate()
+	}
+	if err != nil {
+		return nil, fail(ExitConfig, fmt.Errorf("loading config: %w", err))
+	}
+	return cfg, nil
+}
+
+// connect loads the configuration and creates a client for its server
+func (a *App) connect() (*config.Config, *client.Client, error) {
+	cfg, err := a.loadConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	apiClient, err := a.NewClient(cfg)
+	if err != nil {
+		return nil, nil, fail(ExitConfig, fmt.Errorf("configuring connection: %w", err))
+	}
+	return cfg, apiClient, nil
+}
+
+// flags creates the flag set of a command; withConnection adds the
+// connection flags
+func (a *App) flags(name string, withConnection bool) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.Stderr)
+	if withConnection {
+		a.addConnectionFlags(fs)
+	}
+	return fs
+}
+
+// parse parses args into fs. The flag package has already explained a bad
+// flag on Stderr, so the error is not reported again; -h is not an error
+func parse(fs *flag.FlagSet, args []string) error {
+	err := fs.Parse(args)
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return &ExitError{Status: ExitOK, Err: err, reported: true}
+	case err != nil:
+		return &ExitError{Status: ExitUsage, Err: err, reported: true}
+	}
+	return nil
+}
+
+// parseInterspersed parses fs from args, allowing flags after positional
+// arguments (vanish submit payload.json -to ...), and returns the positionals
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := parse(fs, args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// PrintHelp writes the list of commands and their flags to w
+func PrintHelp(w io.Writer) {
+	fmt.Fprint(w, help)
+}
+
+const help = `Vanish CLI Tool
+
+Usage:
+  vanish config             Configure the CLI (interactive)
+  vanish send <email> [msg] Send a secret to a user
+  vanish send               Pick a recipient and type the secret (interactive)
+  vanish receive <link>     Read (and burn) a secret sent to you
+  vanish inbox              List unread secrets waiting for you
+  vanish history            List secrets you sent and received
+  vanish export             Download everything Vanish stores about you
+  vanish resend <id>        Notify the recipient of an unread secret again
+  vanish encrypt [msg]      Encrypt a secret offline and print the payload
+  vanish submit <file>      Send a payload created by encrypt
+  vanish version            Show CLI and server versions
+  vanish update             Replace this binary with the latest release
+  vanish keygen             Create a key pair so senders can seal link keys to you
+
+Flags for send:
+  -ttl <seconds>            Expiration time (default 86400)
+  -batch <file.json>        Send many secrets at once: [{"email": ..., "secret": ..., "ttl": ...}]
+  -from-command "<cmd>"     Use the output of a shell command as the secret (e.g. "op read ...")
+  -from-env <VAR>           Use the value of an environment variable as the secret
+  -command-timeout <dur>    Time limit for -from-command (default 30s)
+  -notify <channels>        slack, email, both or none (default both; channels the server lacks are skipped)
+  -at <time>                Schedule: the secret cannot be opened before this RFC 3339 time
+  -delay <duration>         Schedule: the secret opens after this long (e.g. 2h)
+  -json                     Print the link and per-channel notification status as JSON
+  -raw                      Send the secret byte for byte; no newline or whitespace is removed
+  -dry-run                  Check that the server would accept the secret; nothing is sent
+
+Flags for receive:
+  -y                        Skip the confirmation prompt
+
+Flags for history:
+  -search <text>            Only secrets whose counterpart's name or email, or category, contains the text
+  -limit <n>                Maximum number of secrets (default 50, at most 200)
+
+Flags for export:
+  -o <file>                 Output file (default vanish-export.json)
+
+Flags for encrypt:
+  -f <file>                 Read the plaintext from a file (default: arguments or stdin)
+  -key-out <file>           Write the key to a separate file (mode 0600)
+
+Flags for submit:
+  -to <email>               Recipient (required)
+  -ttl <duration>           Expiration time (default 24h)
+  -key-file <file>          Key written by encrypt -key-out
+
+Flags for keygen:
+  -force                    Replace an existing key pair (unread sealed messages become unreadable)
+
+Flags for update:
+  -url <url>                Release download URL (or VANISH_UPDATE_URL)
+
+Connection flags (config saves them; other commands use them once):
+  -ca-bundle <file>         PEM file of extra trusted CAs (or VANISH_CA_BUNDLE)
+  -client-cert <file>       Client certificate for mutual TLS (or VANISH_CLIENT_CERT)
+  -client-key <file>        Client key for mutual TLS (or VANISH_CLIENT_KEY)
+  -proxy <url>              Proxy URL (default: HTTPS_PROXY/HTTP_PROXY)
+`
@@ -0,0 +1,244 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zafrem/vanish/shared/client"
+	"github.com/zafrem/vanish/shared/config"
+	"github.com/zafrem/vanish/shared/crypto"
+	"github.com/zafrem/vanish/shared/models"
+	"github.com/zafrem/vanish/shared/vanish"
+)
+
+// fakeServer is a Vanish server knowing Bob and Carol that keeps the
+// messages and notifications it receives
+type fakeServer struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	created       []models.CreateMessageRequest
+	notifications []string // "slack" or "email"
+}
+
+func newFakeServer(t *testing.T) *fakeServer {
+	f := &fakeServer{}
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Vanish-API-Version", client.APIVersion)
+		w.Header().Set("Content-Type", "application/json")
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/api/v1/users":
+			json.NewEncoder(w).Encode([]models.User{
+				{ID: 2, Email: "bob@example.com", Name: "Bob"},
+				{ID: 3, Email: "carol@example.com", Name: "Carol"},
+			})
+		case r.URL.Path == "/api/v1/messages" && r.Method == http.MethodPost:
+			var req models.CreateMessageRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("decoding message: %v", err)
+			}
+			f.created = append(f.created, req)
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(models.CreateMessageResponse{
+				ID:          "msg-1",
+				ExpiresAt:   time.Date(2026, 1, 3, 9, 0, 0, 0, time.UTC),
+				AvailableAt: req.AvailableAt,
+			})
+		case strings.HasPrefix(r.URL.Path, "/api/v1/notifications/send-"):
+			f.notifications = append(f.notifications, strings.TrimPrefix(r.URL.Path, "/api/v1/notifications/send-"))
+			w.Write([]byte(`{"status":"sent"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(models.ErrorResponse{Error: "Not found", Code: models.ErrorCodeInvalidRequest})
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// secret decrypts the i-th message the server received with the key from
+// the link the CLI printed
+func (f *fakeServer) secret(t *testing.T, i int, output string) string {
+	t.Helper()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.created) <= i {
+		t.Fatalf("server received %d messages, want at least %d", len(f.created), i+1)
+	}
+
+	start := strings.Index(output, f.URL+"/m/")
+	if start < 0 {
+		t.Fatalf("output has no link:\n%s", output)
+	}
+	link := strings.Fields(output[start:])[0]
+	_, key, err := vanish.ParseLink(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := f.created[i]
+	secret, err := crypto.DecryptEncoded(req.Ciphertext, req.IV, key, req.ContentEncoding)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return secret
+}
+
+// testApp is an App configured for server at a fixed time, with a piped
+// stdin unless a test says otherwise
+func testApp(server *fakeServer) (*App, *bytes.Buffer) {
+	stderr := &bytes.Buffer{}
+	app := New("1.4.0", "")
+	app.Stderr = stderr
+	app.LoadConfig = func() (*config.Config, error) {
+		return &config.Config{BaseURL: server.URL, Token: "test-token"}, nil
+	}
+	app.SaveConfig = func(*config.Config) error { return errors.New("read-only in tests") }
+	app.Now = func() time.Time { return time.Date(2026, 1, 2, 9, 0, 0, 0, time.UTC) }
+	app.IsTerminal = func(io.Reader) bool { return false }
+	app.ReadPassword = func(io.Reader) (string, error) { return "", io.EOF }
+	return app, stderr
+}
+
+func TestSend_FullFlow(t *testing.T) {
+	server := newFakeServer(t)
+	app, stderr := testApp(server)
+
+	var out bytes.Buffer
+	err := app.Send([]string{"-delay", "2h", "bob@example.com", "correct", "horse"}, strings.NewReader(""), &out)
+	if err != nil {
+		t.Fatalf("Send() = %v\nstderr: %s", err, stderr)
+	}
+
+	if got := server.secret(t, 0, out.String()); got != "correct horse" {
+		t.Errorf("secret = %q, want the arguments joined", got)
+	}
+	req := server.created[0]
+	if req.RecipientID != 2 || req.TTL == nil || *req.TTL != 86400 {
+		t.Errorf("request = %+v, want Bob with the default TTL", req)
+	}
+	if want := app.Now().Add(2 * time.Hour); req.AvailableAt == nil || !req.AvailableAt.Equal(want) {
+		t.Errorf("available_at = %v, want %v from the injected clock", req.AvailableAt, want)
+	}
+	if strings.Join(server.notifications, ",") != "slack,email" {
+		t.Errorf("notifications = %v, want slack then email", server.notifications)
+	}
+	for _, want := range []string{"✓ Secret created successfully!", "⏰ Opens", "slack: sent when the secret is released"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output lacks %q:\n%s", want, out.String())
+		}
+	}
+	if stderr.Len() != 0 {
+		t.Errorf("stderr = %q, want nothing on success", stderr)
+	}
+}
+
+func TestSend_Stdin(t *testing.T) {
+	server := newFakeServer(t)
+	app, _ := testApp(server)
+
+	var out bytes.Buffer
+	err := app.Send([]string{"-notify", "none", "-json", "carol@example.com"}, strings.NewReader(testPEM), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var result sendOutput
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out.String())
+	}
+	if result.ID != "msg-1" || len(result.Notifications) != 0 {
+		t.Errorf("result = %+v, want msg-1 and no notifications", result)
+	}
+	if got := server.secret(t, 0, result.URL); got != testPEM {
+		t.Errorf("secret = %q, want piped input byte for byte", got)
+	}
+
+	err = app.Send([]string{"carol@example.com"}, strings.NewReader(""), io.Discard)
+	if ExitStatus(err) != ExitInvalid {
+		t.Errorf("empty stdin: status %d (%v), want ExitInvalid", ExitStatus(err), err)
+	}
+}
+
+func TestSend_Prompts(t *testing.T) {
+	server := newFakeServer(t)
+	app, _ := testApp(server)
+	app.IsTerminal = func(io.Reader) bool { return true }
+	app.ReadPassword = func(io.Reader) (string, error) { return "typed s3cret", nil }
+
+	// Search "car", pick the match, keep the default expiry, confirm
+	in := strings.NewReader("car\n1\n\ny\n")
+	var out bytes.Buffer
+	if err := app.Send([]string{"-notify", "email"}, in, &out); err != nil {
+		t.Fatalf("Send() = %v\n%s", err, out.String())
+	}
+
+	if got := server.secret(t, 0, out.String()); got != "typed s3cret" {
+		t.Errorf("secret = %q, want what was typed", got)
+	}
+	if req := server.created[0]; req.RecipientID != 3 {
+		t.Errorf("recipient = %d, want Carol", req.RecipientID)
+	}
+	if !strings.Contains(out.String(), "Send a secret to Carol <carol@example.com>, expiring after 24h?") {
+		t.Errorf("no confirmation asked:\n%s", out.String())
+	}
+
+	// Declining sends nothing
+	err := app.Send(nil, strings.NewReader("bob\n\n\nn\n"), io.Discard)
+	if err == nil || len(server.created) != 1 {
+		t.Errorf("declined: Send() = %v with %d messages sent, want an error and none", err, len(server.created)-1)
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	server := newFakeServer(t)
+	app, stderr := testApp(server)
+	unconfigured, _ := testApp(server)
+	unconfigured.LoadConfig = func() (*config.Config, error) { return nil, errors.New("no config file") }
+
+	tests := []struct {
+		name string
+		run  func(args []string, in io.Reader, out io.Writer) error
+		args []string
+		want int
+	}{
+		{"help flag", app.Inbox, []string{"-h"}, ExitOK},
+		{"bad flag", app.Send, []string{"-ttl", "soon"}, ExitUsage},
+		{"missing argument", app.Receive, nil, ExitUsage},
+		{"unknown recipient", app.Send, []string{"nobody@example.com", "s3cret"}, ExitNotFound},
+		{"past delay", app.Send, []string{"-delay", "-1h", "bob@example.com", "s3cret"}, ExitInvalid},
+		{"not configured", unconfigured.History, nil, ExitConfig},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stderr.Reset()
+			err := tt.run(tt.args, strings.NewReader(""), io.Discard)
+			if got := ExitStatus(err); got != tt.want {
+				t.Fatalf("status = %d (%v), want %d", got, err, tt.want)
+			}
+
+			var report bytes.Buffer
+			Report(&report, err)
+			flagError := tt.want == ExitOK || tt.name == "bad flag"
+			if flagError && report.Len() != 0 {
+				t.Errorf("Report() = %q; the flag package already explained it", report.String())
+			}
+			if flagError && stderr.Len() == 0 {
+				t.Error("nothing written to Stderr for a flag error")
+			}
+			if !flagError && !strings.HasPrefix(report.String(), "Error: ") {
+				t.Errorf("Report() = %q, want an error line", report.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/zafrem/vanish/shared/client"
+	"github.com/zafrem/vanish/shared/models"
+)
+
+// Exit statuses, so scripts can tell why a command failed without parsing
+// its output. The numbers are a contract: never renumber them, only add.
+// Flags that cannot be parsed fail with ExitUsage
+const (
+	ExitOK       = 0
+	ExitFailure  = 1  // anything not listed below
+	ExitUsage    = 2  // wrong arguments or conflicting flags
+	ExitConfig   = 3  // no configuration, or one that cannot be used: run 'vanish config'
+	ExitAuth     = 4  // not signed in, or the token is invalid or expired
+	ExitNotFound = 5  // the recipient or user does not exist
+	ExitInvalid  = 6  // the secret, TTL, schedule or input file was refused
+	ExitNetwork  = 7  // the server could not be reached (DNS, TCP, TLS or proxy)
+	ExitServer   = 8  // the server failed to handle the request
+	ExitGone     = 9  // message already read, expired, revoked or unknown
+	ExitDenied   = 10 // the message is for someone else, or the action is not allowed
+	ExitLimited  = 11 // recipient inbox full or rate limited; retry later
+
+	ExitInterrupted = 130 // Ctrl-C at an interactive prompt, as shells report SIGINT
+)
+
+// exitStatus picks the exit status for err from its API error code, or how
+// the request failed when the server did not answer with one
+func exitStatus(err error) int {
+	switch client.ErrorCode(err) {
+	case models.ErrorCodeUnauthorized, models.ErrorCodeInvalidCredentials, models.ErrorCodeAccountInactive:
+		return ExitAuth
+	case models.ErrorCodeUserNotFound:
+		return ExitNotFound
+	case models.ErrorCodeInvalidRequest, models.ErrorCodeValidationFailed, models.ErrorCodeInvalidMessageID,
+		models.ErrorCodeTTLOutOfRange, models.ErrorCodeInvalidSchedule, models.ErrorCodeBatchSize,
+		models.ErrorCodeInvalidPublicKey, models.ErrorCodeRequestTooLarge:
+		return ExitInvalid
+	case models.ErrorCodeInternal, models.ErrorCodeUnavailable, models.ErrorCodeUpstreamFailed:
+		return ExitServer
+	case models.ErrorCodeMessageNotFound, models.ErrorCodeMessageAlreadyRead, models.ErrorCodeMessageExpired,
+		models.ErrorCodeMessageRevoked:
+		return ExitGone
+	case models.ErrorCodeNotRecipient, models.ErrorCodeForbidden:
+		return ExitDenied
+	case models.ErrorCodeRecipientInboxFull, models.ErrorCodeQuotaExceeded:
+		return ExitLimited
+	}
+
+	var apiErr *client.APIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized:
+		return ExitAuth
+	case errors.As(err, &apiErr) && apiErr.StatusCode >= 500:
+		return ExitServer
+	case client.IsConnectionError(err):
+		return ExitNetwork
+	default:
+		return ExitFailure
+	}
+}
+
+// errorHint suggests what to do next for errors users can act on
+func errorHint(status int, err error) string {
+	switch status {
+	case ExitConfig:
+		return "Run 'vanish config' first."
+	case ExitNetwork:
+		return "Check the server URL in 'vanish config' and your network, proxy and CA settings."
+	}
+
+	switch client.ErrorCode(err) {
+	case models.ErrorCodeMessageNotFound:
+		return "Secrets can be read only once and expire. Ask the sender for a new link."
+	case models.ErrorCodeMessageAlreadyRead:
+		return "Secrets can be read only once. If you did not read it, tell the sender: someone else may have."
+	case models.ErrorCodeMessageExpired:
+		return "Nobody read it in time. Ask the sender for a new link."
+	case models.ErrorCodeMessageRevoked:
+		return "The sender or an administrator withdrew it. Ask the sender whether to expect a new link."
+	case models.ErrorCodeNotRecipient:
+		return "Only the intended recipient can open this message. Check which account 'vanish config' uses."
+	case models.ErrorCodeRecipientInboxFull:
+		return "Wait until the recipient reads or discards some messages, then send again."
+	case models.ErrorCodeMessageClaimed:
+		return "Another session is reading this message; if that was not you, tell the sender."
+	case models.ErrorCodeCannotResend:
+		return "The server does not keep this message's key. Send the link to the recipient yourself."
+	case models.ErrorCodeNotYetAvailable:
+		return "The sender scheduled this message; open the link again once it is released."
+	case models.ErrorCodeInvalidSchedule:
+		return "-at must be in the future, and the release time plus -ttl within 7 days."
+	default:
+		return ""
+	}
+}
+
+// ExitError is a failure that carries the exit status it should end the
+// process with
+type ExitError struct {
+	Status int
+	Err    error
+
+	// reported is set when the failure was already explained, as the flag
+	// package does for flags it cannot parse
+	reported bool
+}
+
+func (e *ExitError) Error() string { return e.Err.Error() }
+
+func (e *ExitError) Unwrap() error { return e.Err }
+
+// fail wraps err with the exit status it should end the process with
+func fail(status int, err error) error {
+	return &ExitError{Status: status, Err: err}
+}
+
+// failAction reports a failed action, with the status matching the error
+func failAction(action string, err error) error {
+	return fail(exitStatus(err), fmt.Errorf("%s: %w", action, err))
+}
+
+// usage reports wrong arguments, showing the command's usage line
+func usage(line string) error {
+	return fail(ExitUsage, fmt.Errorf("usage: %s", line))
+}
+
+// ExitStatus is the status the process should exit with after err: the one
+// err carries, or else the one its API error code or failed request maps
+// to. A nil error is ExitOK
+func ExitStatus(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.Status
+	}
+	return exitStatus(err)
+}
+
+// Report writes err to w, with a hint when there is one. Every failing
+// command ends here, so stdout only ever carries results
+func Report(w io.Writer, err error) {
+	var exitErr *ExitError
+	if err == nil || errors.As(err, &exitErr) && exitErr.reported {
+		return
+	}
+	status := ExitStatus(err)
+	fmt.Fprintf(w, "Error: %v\n", err)
+	if hint := errorHint(status, err); hint != "" {
+		fmt.Fprintln(w, hint)
+	}
+}
@@ -0,0 +1,318 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/zafrem/vanish/shared/crypto"
+	"github.com/zafrem/vanish/shared/models"
+	"golang.org/x/term"
+)
+
+// errCancelled ends the interactive flow on Ctrl-D or a declined confirmation
+var errCancelled = errors.New("cancelled")
+
+// pickerSize caps the recipients listed per search
+const pickerSize = 10
+
+// ttlChoice is an entry of the expiry menu
+type ttlChoice struct {
+	label   string
+	seconds int64
+}
+
+// ttlChoices is the expiry menu; the -ttl value is added when it differs
+var ttlChoices = []ttlChoice{
+	{"1 hour", 3600},
+	{"24 hours", 86400},
+	{"7 days", 7 * 86400},
+}
+
+// prompter asks the questions of the interactive send. readSecret reads a
+// line without echoing it
+type prompter struct {
+	in         *bufio.Reader
+	out        io.Writer
+	readSecret func() (string, error)
+}
+
+// ask prints question and returns the trimmed answer; Ctrl-D cancels
+func (p *prompter) ask(question string) (string, error) {
+	fmt.Fprint(p.out, question)
+	answer, err := p.in.ReadString('\n')
+	if err != nil && (answer == "" || !errors.Is(err, io.EOF)) {
+		fmt.Fprintln(p.out)
+		return "", errCancelled
+	}
+	return strings.TrimSpace(answer), nil
+}
+
+// pickRecipient lets the user narrow users down by typing part of a name
+// or email, then choose one by number
+func (p *prompter) pickRecipient(users []models.User) (*models.User, error) {
+	query := ""
+	for {
+		matches := fuzzyFilter(users, query)
+		if len(matches) == 0 {
+			fmt.Fprintf(p.out, "No users match %q.\n", query)
+		}
+		for i, u := range matches {
+			if i == pickerSize {
+				fmt.Fprintf(p.out, "  ... %d more; type to narrow down\n", len(matches)-pickerSize)
+				break
+			}
+			fmt.Fprintf(p.out, "  %2d) %s <%s>\n", i+1, u.Name, u.Email)
+		}
+
+		answer, err := p.ask("Recipient (number, or text to search): ")
+		if err != nil {
+			return nil, err
+		}
+		if n, err := strconv.Atoi(answer); err == nil {
+			if n >= 1 && n <= len(matches) && n <= pickerSize {
+				return &matches[n-1], nil
+			}
+			fmt.Fprintln(p.out, "Pick a number from the list.")
+			continue
+		}
+		if len(matches) == 1 && answer == "" {
+			return &matches[0], nil
+		}
+		query = answer
+	}
+}
+
+// pickTTL offers ttlChoices, defaulting to the -ttl value
+func (p *prompter) pickTTL(defaultTTL int64) (int64, error) {
+	choices := ttlChoices
+	known := false
+	for _, c := range choices {
+		known = known || c.seconds == defaultTTL
+	}
+	if !known {
+		choices = append(choices[:len(choices):len(choices)], ttlChoice{formatTTL(defaultTTL), defaultTTL})
+	}
+
+	def := 0
+	for i, c := range choices {
+		marker := ""
+		if c.seconds == defaultTTL {
+			def, marker = i+1, " (default)"
+		}
+		fmt.Fprintf(p.out, "  %d) %s%s\n", i+1, c.label, marker)
+	}
+	for {
+		answer, err := p.ask(fmt.Sprintf("Expires after [%d]: ", def))
+		if err != nil {
+			return 0, err
+		}
+		if answer == "" {
+			return defaultTTL, nil
+		}
+		if n, err := strconv.Atoi(answer); err == nil && n >= 1 && n <= len(choices) {
+			return choices[n-1].seconds, nil
+		}
+		fmt.Fprintf(p.out, "Pick a number from 1 to %d.\n", len(choices))
+	}
+}
+
+// askSecret reads the secret without echo, as typed, asking again when it
+// is empty
+func (p *prompter) askSecret() (string, error) {
+	for {
+		fmt.Fprint(p.out, "Secret (not shown): ")
+		secret, err := p.readSecret()
+		fmt.Fprintln(p.out)
+		if err != nil {
+			return "", errCancelled
+		}
+		if !isEmptySecret(secret) {
+			return secret, nil
+		}
+		fmt.Fprintln(p.out, "The secret cannot be empty.")
+	}
+}
+
+// confirm asks a yes/no question that defaults to yes
+func (p *prompter) confirm(question string) error {
+	answer, err := p.ask(question + " [Y/n]: ")
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(answer) {
+	case "", "y", "yes":
+		return nil
+	}
+	return errCancelled
+}
+
+// interactiveSend is what the prompts decided
+type interactiveSend struct {
+	recipient *models.User
+	secret    string
+	ttl       int64
+}
+
+// run asks for the recipient, the secret and the expiry, then confirms
+func (p *prompter) run(users []models.User, defaultTTL int64) (*interactiveSend, error) {
+	recipient, err := p.pickRecipient(users)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := p.askSecret()
+	if err != nil {
+		return nil, err
+	}
+	ttl, err := p.pickTTL(defaultTTL)
+	if err != nil {
+		return nil, err
+	}
+	question := fmt.Sprintf("Send a secret to %s <%s>, expiring after %s?", recipient.Name, recipient.Email, formatTTL(ttl))
+	if err := p.confirm(question); err != nil {
+		return nil, err
+	}
+	return &interactiveSend{recipient: recipient, secret: secret, ttl: ttl}, nil
+}
+
+// sendInteractive is `vanish send` without arguments at a terminal. When
+// in is the terminal itself, Ctrl-C at any prompt restores it, echo
+// included, and exits
+func (a *App) sendInteractive(defaultTTL int64, opts sendOptions, in io.Reader, out io.Writer) error {
+	cfg, err := a.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	interrupts := make(chan os.Signal, 1)
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		fd := int(f.Fd())
+		state, err := term.GetState(fd)
+		if err != nil {
+			return fail(ExitFailure, err)
+		}
+		signal.Notify(interrupts, os.Interrupt)
+		go func() {
+			if _, ok := <-interrupts; !ok {
+				return
+			}
+			_ = term.Restore(fd, state)
+			fmt.Fprintln(out)
+			os.Exit(ExitInterrupted)
+		}()
+	}
+	defer func() {
+		signal.Stop(interrupts)
+		close(interrupts)
+	}()
+
+	apiClient, err := a.NewClient(cfg)
+	if err != nil {
+		return fail(ExitConfig, fmt.Errorf("configuring connection: %w", err))
+	}
+	users, err := apiClient.ListUsers()
+	if err != nil {
+		return failAction("listing users", err)
+	}
+
+	p := &prompter{
+		in:         bufio.NewReader(in),
+		out:        out,
+		readSecret: func() (string, error) { return a.ReadPassword(in) },
+	}
+	choice, err := p.run(users, defaultTTL)
+	if err != nil {
+		return fail(ExitFailure, fmt.Errorf("nothing sent: %w", err))
+	}
+
+	a.warnDLP(apiClient, choice.secret)
+
+	encrypted, err := crypto.EncryptSecret(choice.secret)
+	if err != nil {
+		return fail(ExitFailure, fmt.Errorf("encrypting message: %w", err))
+	}
+	return sendEncrypted(apiClient, choice.recipient.Email, encrypted, choice.ttl, opts, out)
+}
+
+// fuzzyFilter returns the users whose name or email contains the letters
+// of query in order, best matches first; an empty query keeps everyone,
+// sorted by name
+func fuzzyFilter(users []models.User, query string) []models.User {
+	type match struct {
+		user  models.User
+		score int
+	}
+	var matches []match
+	for _, u := range users {
+		best, ok := fuzzyScore(u.Name, query)
+		if s, found := fuzzyScore(u.Email, query); found && (!ok || s > best) {
+			best, ok = s, true
+		}
+		if ok {
+			matches = append(matches, match{u, best})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return strings.ToLower(matches[i].user.Name) < strings.ToLower(matches[j].user.Name)
+	})
+
+	users = make([]models.User, len(matches))
+	for i, m := range matches {
+		users[i] = m.user
+	}
+	return users
+}
+
+// fuzzyScore matches the letters of query in order within s, ignoring
+// case and spaces in query. Consecutive letters and letters starting a
+// word score higher, so "jsm" ranks "John Smith" above "Jasmine"
+func fuzzyScore(s, query string) (int, bool) {
+	target := []rune(strings.ToLower(s))
+	score, next, prev := 0, 0, -2
+	for _, r := range strings.ToLower(query) {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		for next < len(target) && target[next] != r {
+			next++
+		}
+		if next == len(target) {
+			return 0, false
+		}
+		score++
+		if next == prev+1 {
+			score += 2
+		}
+		if next == 0 || !unicode.IsLetter(target[next-1]) && !unicode.IsDigit(target[next-1]) {
+			score += 3
+		}
+		prev = next
+		next++
+	}
+	return score, true
+}
+
+// formatTTL renders a TTL in seconds for the prompts, e.g. 24h0m0s as "24h"
+func formatTTL(seconds int64) string {
+	d := time.Duration(seconds) * time.Second
+	switch {
+	case d%(24*time.Hour) == 0 && d >= 48*time.Hour:
+		return fmt.Sprintf("%d days", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return d.String()
+}
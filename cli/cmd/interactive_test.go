@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/zafrem/vanish/shared/models"
+)
+
+var pickerUsers = []models.User{
+	{ID: 1, Name: "Jasmine Ortiz", Email: "jasmine@example.com"},
+	{ID: 2, Name: "John Smith", Email: "john.smith@example.com"},
+	{ID: 3, Name: "Ops Bot", Email: "ops@example.com"},
+	{ID: 4, Name: "Amy Chen", Email: "achen@example.com"},
+}
+
+func TestFuzzyFilter(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		{"", []int64{4, 1, 2, 3}},
+		{"jsm", []int64{2, 1}},
+		{"JOHN", []int64{2}},
+		{"ops@", []int64{3}},
+		{"amy chen", []int64{4}},
+		{"zz", []int64{}},
+	}
+	for _, tt := range tests {
+		got := []int64{}
+		for _, u := range fuzzyFilter(pickerUsers, tt.query) {
+			got = append(got, u.ID)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("fuzzyFilter(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+// scriptedPrompter answers the line prompts from input and the secret
+// prompt from secrets, in order
+func scriptedPrompter(input string, secrets ...string) (*prompter, *strings.Builder) {
+	out := &strings.Builder{}
+	return &prompter{
+		in:  bufio.NewReader(strings.NewReader(input)),
+		out: out,
+		readSecret: func() (string, error) {
+			if len(secrets) == 0 {
+				return "", io.EOF
+			}
+			secret := secrets[0]
+			secrets = secrets[1:]
+			return secret, nil
+		},
+	}, out
+}
+
+func TestPrompterRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		secrets    []string
+		defaultTTL int64
+		wantID     int64
+		wantSecret string
+		wantTTL    int64
+		wantErr    error
+	}{
+		{
+			name:  "search, pick and keep the default expiry",
+			input: "smith\n1\n\n\n", secrets: []string{"hunter2"}, defaultTTL: 86400,
+			wantID: 2, wantSecret: "hunter2", wantTTL: 86400,
+		},
+		{
+			name:  "pick from the full list and choose an expiry",
+			input: "2\n3\ny\n", secrets: []string{"", " s3cret "}, defaultTTL: 86400,
+			wantID: 1, wantSecret: " s3cret ", wantTTL: 7 * 86400,
+		},
+		{
+			name:  "single match picked with enter, -ttl offered as default",
+			input: "ops\n\n\n\n", secrets: []string{"token"}, defaultTTL: 900,
+			wantID: 3, wantSecret: "token", wantTTL: 900,
+		},
+		{
+			name:  "declined",
+			input: "1\n\nn\n", secrets: []string{"token"}, defaultTTL: 86400,
+			wantErr: errCancelled,
+		},
+		{
+			name:  "Ctrl-D at the picker",
+			input: "", defaultTTL: 86400,
+			wantErr: errCancelled,
+		},
+		{
+			name:  "Ctrl-D at the secret",
+			input: "1\n", defaultTTL: 86400,
+			wantErr: errCancelled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, out := scriptedPrompter(tt.input, tt.secrets...)
+			got, err := p.run(pickerUsers, tt.defaultTTL)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("run() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("run() error = %v\n%s", err, out)
+			}
+			if got.recipient.ID != tt.wantID || got.secret != tt.wantSecret || got.ttl != tt.wantTTL {
+				t.Errorf("run() = {%d %q %d}, want {%d %q %d}", got.recipient.ID, got.secret, got.ttl, tt.wantID, tt.wantSecret, tt.wantTTL)
+			}
+			if strings.Contains(out.String(), tt.wantSecret) {
+				t.Error("the secret was echoed")
+			}
+		})
+	}
+}
+
+func TestFormatTTL(t *testing.T) {
+	for seconds, want := range map[int64]string{3600: "1h", 86400: "24h", 7 * 86400: "7 days", 900: "15m", 90: "1m30s"} {
+		if got := formatTTL(seconds); got != want {
+			t.Errorf("formatTTL(%d) = %q, want %q", seconds, got, want)
+		}
+	}
+}
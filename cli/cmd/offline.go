@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zafrem/vanish/shared/crypto"
+)
+
+// encryptedPayload is the JSON printed by `vanish encrypt` and read by
+// `vanish submit`. Key is empty when encrypt wrote it to -key-out
+type encryptedPayload struct {
+	Ciphertext      string `json:"ciphertext"`
+	IV              string `json:"iv"`
+	Key             string `json:"key,omitempty"`
+	ContentEncoding string `json:"content_encoding,omitempty"`
+}
+
+// encryptPayload encrypts plaintext and returns the payload JSON. With
+// keyOut set, the key goes to that file (mode 0600) instead of the payload
+func encryptPayload(plaintext, keyOut string) ([]byte, error) {
+	encrypted, err := crypto.EncryptSecret(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := encryptedPayload{Ciphertext: encrypted.Ciphertext, IV: encrypted.IV, Key: encrypted.Key, ContentEncoding: encrypted.ContentEncoding}
+	if keyOut != "" {
+		if err := writePrivateFile(keyOut, []byte(encrypted.Key+"\n")); err != nil {
+			return nil, fmt.Errorf("failed to write key: %w", err)
+		}
+		payload.Key = ""
+	}
+
+	data, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// writePrivateFile writes data to path readable only by the owner, also
+// when the file already existed with looser permissions
+func writePrivateFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readPayloadFile loads a payload written by encrypt. keyFile, when set,
+// supplies the key for payloads encrypted with -key-out
+func readPayloadFile(path, keyFile string) (*crypto.EncryptedMessage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var payload encryptedPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, fmt.Errorf("invalid payload file: %w", err)
+	}
+	if payload.Ciphertext == "" || payload.IV == "" {
+		return nil, errors.New("invalid payload file: ciphertext and iv are required")
+	}
+
+	if keyFile != "" {
+		key, err := os.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		payload.Key = strings.TrimSpace(string(key))
+	}
+	if payload.Key == "" {
+		return nil, errors.New("payload has no key; pass the file written by encrypt -key-out with -key-file")
+	}
+
+	if payload.ContentEncoding != "" && payload.ContentEncoding != crypto.ContentEncodingGzip {
+		return nil, fmt.Errorf("invalid payload file: unsupported content_encoding %q", payload.ContentEncoding)
+	}
+
+	return &crypto.EncryptedMessage{Ciphertext: payload.Ciphertext, IV: payload.IV, Key: payload.Key, ContentEncoding: payload.ContentEncoding}, nil
+}
+
+// Encrypt is `vanish encrypt`: it encrypts a secret from the arguments, -f
+// or in without a configuration or server, and prints the payload
+func (a *App) Encrypt(args []string, in io.Reader, out io.Writer) error {
+	fs := a.flags("encrypt", false)
+	inputFile := fs.String("f", "", "Read the plaintext from a file")
+	keyOut := fs.String("key-out", "", "Write the key to this file instead of the payload")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+	args = fs.Args()
+
+	var plaintext string
+	switch {
+	case *inputFile != "" && len(args) > 0:
+		return fail(ExitUsage, errors.New("give the secret as arguments or with -f, not both"))
+	case *inputFile != "":
+		data, err := os.ReadFile(*inputFile)
+		if err != nil {
+			return fail(ExitFailure, fmt.Errorf("reading %s: %w", *inputFile, err))
+		}
+		plaintext = string(data)
+	case len(args) > 0:
+		plaintext = strings.Join(args, " ")
+	default:
+		var err error
+		plaintext, err = readSecretFromStdin(in, a.Stderr, false)
+		if err != nil {
+			return fail(ExitFailure, fmt.Errorf("reading stdin: %w", err))
+		}
+	}
+	if isEmptySecret(plaintext) {
+		return fail(ExitInvalid, errors.New("secret message cannot be empty"))
+	}
+
+	// No config or server needed: this runs fine on an offline machine
+	payload, err := encryptPayload(plaintext, *keyOut)
+	if err != nil {
+		return fail(ExitFailure, fmt.Errorf("encrypting message: %w", err))
+	}
+	_, err = out.Write(payload)
+	return err
+}
+
+// Submit is `vanish submit <payload.json> -to <email>`: it sends a payload
+// created by encrypt as-is
+func (a *App) Submit(args []string, in io.Reader, out io.Writer) error {
+	fs := a.flags("submit", true)
+	recipientEmail := fs.String("to", "", "Recipient email")
+	ttl := fs.Duration("ttl", 24*time.Hour, "Time to live (e.g. 1h, 24h)")
+	keyFile := fs.String("key-file", "", "Read the key from this file (written by encrypt -key-out)")
+	args, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := a.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if len(args) != 1 || *recipientEmail == "" {
+		return usage("vanish submit <payload.json> -to <email> [-ttl 24h] [-key-file <file>]")
+	}
+	if *ttl < time.Second {
+		return fail(ExitInvalid, errors.New("-ttl must be at least 1s"))
+	}
+
+	// The payload is sent as-is; no encryption happens here
+	encrypted, err := readPayloadFile(args[0], *keyFile)
+	if err != nil {
+		return fail(ExitInvalid, fmt.Errorf("reading payload: %w", err))
+	}
+
+	apiClient, err := a.NewClient(cfg)
+	if err != nil {
+		return fail(ExitConfig, fmt.Errorf("configuring connection: %w", err))
+	}
+	return sendEncrypted(apiClient, *recipientEmail, encrypted, int64(*ttl/time.Second), sendOptions{notify: notifyChannels}, out)
+}
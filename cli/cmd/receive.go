@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/zafrem/vanish/shared/client"
+	"github.com/zafrem/vanish/shared/config"
+	"github.com/zafrem/vanish/shared/crypto"
+	"github.com/zafrem/vanish/shared/vanish"
+)
+
+// Receive is `vanish receive [-y] <link>`: it previews the message, asks on
+// in whether to read it, then burns and decrypts it
+func (a *App) Receive(args []string, in io.Reader, out io.Writer) error {
+	fs := a.flags("receive", true)
+	assumeYes := fs.Bool("y", false, "Read without asking for confirmation")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	cfg, err := a.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() != 1 {
+		return usage("vanish receive [-y] <link>")
+	}
+
+	messageID, key, err := vanish.ParseLink(fs.Arg(0))
+	if err != nil {
+		return fail(ExitUsage, err)
+	}
+
+	apiClient, err := a.NewClient(cfg)
+	if err != nil {
+		return fail(ExitConfig, fmt.Errorf("configuring connection: %w", err))
+	}
+
+	// A link without #key is opened with the key sealed to us, if any
+	if key == "" {
+		key, err = openSealedKey(apiClient, messageID)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 1. Preview without burning so the user can back out
+	preview, err := apiClient.GetMessagePreview(messageID)
+	if err != nil {
+		return failAction("checking message", err)
+	}
+
+	fmt.Fprintf(out, "From:    %s\n", preview.SenderName)
+	fmt.Fprintf(out, "Sent:    %s\n", preview.CreatedAt.Local().Format(time.RFC1123))
+	// Prefer the server's remaining TTL; older servers only send expires_at
+	remaining := time.Duration(preview.ExpiresInSeconds) * time.Second
+	if preview.ExpiresInSeconds == 0 {
+		remaining = preview.ExpiresAt.Sub(a.Now())
+	}
+	fmt.Fprintf(out, "Expires: in %s\n", remaining.Round(time.Minute))
+	if preview.OneTime {
+		fmt.Fprintln(out, "This message can be read only once and is destroyed when shown.")
+	}
+
+	// 2. Confirm
+	if !*assumeYes {
+		fmt.Fprint(out, "Read it now? [y/N]: ")
+		answer, _ := bufio.NewReader(in).ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		if answer != "y" && answer != "yes" {
+			fmt.Fprintln(out, "Not read. The message is still waiting for you.")
+			return nil
+		}
+	}
+
+	// 3. Fetch (burns the message) and decrypt locally
+	msg, err := apiClient.GetMessage(messageID)
+	if err != nil {
+		return failAction("reading message", err)
+	}
+
+	secret, err := crypto.DecryptEncoded(msg.Ciphertext, msg.IV, key, msg.ContentEncoding)
+	if err != nil {
+		return fail(ExitFailure, fmt.Errorf("decrypting message: %w", err))
+	}
+
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, secret)
+	return nil
+}
+
+// openSealedKey finds the key sealed to us for messageID in our history and
+// opens it with the private key saved by keygen
+func openSealedKey(apiClient *client.Client, messageID string) (string, error) {
+	identity, err := config.LoadIdentity()
+	if err != nil {
+		return "", fmt.Errorf("the link has no #key part and %w", err)
+	}
+
+	history, err := apiClient.GetMessageHistory(500)
+	if err != nil {
+		return "", err
+	}
+	for _, h := range history {
+		if h.MessageID != messageID || !h.IsRecipient {
+			continue
+		}
+		if h.SealedKey == "" {
+			return "", fmt.Errorf("the link has no #key part and the message was not sealed to you")
+		}
+		return crypto.OpenSealed(h.SealedKey, identity.PrivateKey)
+	}
+
+	return "", fmt.Errorf("the link has no #key part and no pending message %s was found for you", messageID)
+}
@@ -0,0 +1,581 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/zafrem/vanish/shared/client"
+	"github.com/zafrem/vanish/shared/crypto"
+	"github.com/zafrem/vanish/shared/models"
+)
+
+// Send is `vanish send`: a secret from the arguments, -from-command,
+// -from-env or in, a -batch file, or, at a terminal without arguments, the
+// interactive prompts
+func (a *App) Send(args []string, in io.Reader, out io.Writer) error {
+	fs := a.flags("send", true)
+	ttl := fs.Int64("ttl", 86400, "Time to live in seconds (default 24h)")
+	batch := fs.String("batch", "", "JSON file of messages to send in one request")
+	fromCommand := fs.String("from-command", "", "Read the secret from the stdout of a shell command")
+	fromEnv := fs.String("from-env", "", "Read the secret from an environment variable")
+	commandTimeout := fs.Duration("command-timeout", 30*time.Second, "How long -from-command may run")
+	notify := fs.String("notify", "both", "Notify the recipient: slack, email, both or none")
+	at := fs.String("at", "", "Release the secret at this time (RFC 3339)")
+	delay := fs.Duration("delay", 0, "Release the secret after this long (e.g. 2h)")
+	jsonOutput := fs.Bool("json", false, "Print the result as JSON")
+	raw := fs.Bool("raw", false, "Send the secret exactly as given, without trimming whitespace")
+	dryRun := fs.Bool("dry-run", false, "Check that the server would accept the secret, without sending it")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	source := secretSource{command: *fromCommand, env: *fromEnv, timeout: *commandTimeout, raw: *raw, stderr: a.Stderr}
+	channels, err := parseNotifyChannels(*notify)
+	if err != nil {
+		return fail(ExitUsage, err)
+	}
+	availableAt, err := parseSchedule(*at, *delay, a.Now())
+	if err != nil {
+		return fail(ExitInvalid, err)
+	}
+	opts := sendOptions{notify: channels, json: *jsonOutput, availableAt: availableAt, dryRun: *dryRun}
+
+	switch {
+	case *batch != "":
+		if source.set() {
+			return fail(ExitUsage, errors.New("-batch cannot be combined with -from-command or -from-env"))
+		}
+		if *dryRun {
+			return fail(ExitUsage, errors.New("-batch cannot be combined with -dry-run"))
+		}
+		return a.sendBatch(*batch, *ttl, availableAt, out)
+	case fs.NArg() == 0 && !source.set() && a.IsTerminal(in):
+		return a.sendInteractive(*ttl, opts, in, out)
+	default:
+		return a.send(fs.Args(), *ttl, source, opts, in, out)
+	}
+}
+
+// secretSource is where `send` reads the secret from instead of its
+// arguments or stdin, so the secret never appears in shell history
+type secretSource struct {
+	command string        // -from-command
+	env     string        // -from-env
+	timeout time.Duration // limit for command
+	raw     bool          // -raw: keep surrounding whitespace
+	stderr  io.Writer     // where the command's stderr goes
+}
+
+func (s secretSource) set() bool {
+	return s.command != "" || s.env != ""
+}
+
+// read returns the secret from the configured source, trimmed of the
+// whitespace password managers print around it unless raw is set
+// Errors never include the secret itself
+func (s secretSource) read() (string, error) {
+	if s.command != "" && s.env != "" {
+		return "", errors.New("use either -from-command or -from-env, not both")
+	}
+	var secret string
+	var err error
+	if s.env != "" {
+		secret, err = readSecretFromEnv(s.env)
+	} else {
+		secret, err = readSecretFromCommand(s.command, s.timeout, s.stderr)
+	}
+	if err != nil || s.raw {
+		return secret, err
+	}
+	return strings.TrimSpace(secret), nil
+}
+
+// readSecretFromEnv reads a secret from the named environment variable
+func readSecretFromEnv(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	if strings.TrimSpace(value) == "" {
+		return "", fmt.Errorf("environment variable %s is empty", name)
+	}
+	return value, nil
+}
+
+// readSecretFromCommand runs command through the user's shell and returns
+// its stdout. The command gets no terminal on stdin, its stderr is
+// passed through so prompts and errors stay visible, and it is killed after
+// timeout. Empty output is an error so a failed lookup never sends a blank
+// secret
+func readSecretFromCommand(command string, timeout time.Duration, stderr io.Writer) (string, error) {
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout bytes.Buffer
+	cmd := exec.CommandContext(ctx, shell, "-c", command)
+	cmd.Stdin = nil // /dev/null
+	cmd.Stdout = &stdout
+	cmd.Stderr = stderr
+	// Don't wait forever on grandchildren that keep stdout open after a kill
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("command timed out after %s", timeout)
+	}
+	if err != nil {
+		// err is the exit status or a start failure, never the output
+		return "", fmt.Errorf("command failed: %v", err)
+	}
+
+	if strings.TrimSpace(stdout.String()) == "" {
+		return "", errors.New("command produced no output")
+	}
+	return stdout.String(), nil
+}
+
+// send is `vanish send <email> [message]`
+func (a *App) send(args []string, ttl int64, source secretSource, opts sendOptions, in io.Reader, out io.Writer) error {
+	cfg, err := a.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if len(args) < 1 {
+		return usage("vanish send <email> [message]")
+	}
+
+	recipientEmail := args[0]
+	var secret string
+
+	if source.set() {
+		if len(args) > 1 {
+			return fail(ExitUsage, errors.New("give the secret as arguments or with -from-command/-from-env, not both"))
+		}
+		secret, err = source.read()
+		if err != nil {
+			return fail(ExitFailure, fmt.Errorf("reading secret: %w", err))
+		}
+	} else if len(args) > 1 {
+		secret = strings.Join(args[1:], " ")
+	} else {
+		secret, err = readSecretFromStdin(in, out, source.raw)
+		if err != nil {
+			return fail(ExitFailure, fmt.Errorf("reading stdin: %w", err))
+		}
+	}
+	if isEmptySecret(secret) {
+		return fail(ExitInvalid, errors.New("secret message cannot be empty"))
+	}
+
+	apiClient, err := a.NewClient(cfg)
+	if err != nil {
+		return fail(ExitConfig, fmt.Errorf("configuring connection: %w", err))
+	}
+	a.warnDLP(apiClient, secret)
+
+	// Encrypt locally, then send
+	encrypted, err := crypto.EncryptSecret(secret)
+	if err != nil {
+		return fail(ExitFailure, fmt.Errorf("encrypting message: %w", err))
+	}
+
+	return sendEncrypted(apiClient, recipientEmail, encrypted, ttl, opts, out)
+}
+
+// warnDLP warns on Stderr, keeping -json output clean, when secret matches
+// one of the server's DLP patterns. It only warns: the server never sees
+// the plaintext, so the sender decides. A server without the policy
+// endpoint, or failing to answer, gets no check
+func (a *App) warnDLP(apiClient *client.Client, secret string) {
+	policy, err := apiClient.GetSenderPolicy()
+	if err != nil {
+		return
+	}
+	for _, warning := range dlpWarnings(policy, secret) {
+		fmt.Fprintln(a.Stderr, warning)
+	}
+}
+
+// dlpWarnings describes each DLP pattern of policy that secret matches
+func dlpWarnings(policy *models.SenderPolicy, secret string) []string {
+	var warnings []string
+	for _, pattern := range policy.MatchDLP(secret) {
+		warning := "⚠ Warning: the secret matches the DLP pattern " + pattern.Name
+		if pattern.Description != "" {
+			warning += ": " + pattern.Description
+		}
+		warnings = append(warnings, warning)
+	}
+	return warnings
+}
+
+// readSecretFromStdin reads piped input byte for byte, or prompts on
+// prompt when in is a terminal. Only the newline that ends the typed line
+// is dropped, and not even that with raw: piped PEM keys must keep their
+// trailing newline. Readers other than files, as in tests, count as piped
+func readSecretFromStdin(in io.Reader, prompt io.Writer, raw bool) (string, error) {
+	piped := true
+	if f, ok := in.(*os.File); ok {
+		info, err := f.Stat()
+		if err != nil {
+			return "", err
+		}
+		piped = isPiped(info.Mode())
+	}
+
+	if piped {
+		data, err := io.ReadAll(in)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	}
+
+	// Prompt user
+	fmt.Fprint(prompt, "Enter secret: ")
+	secret, _ := bufio.NewReader(in).ReadString('\n')
+	if !raw {
+		secret = strings.TrimSuffix(secret, "\n")
+		secret = strings.TrimSuffix(secret, "\r")
+	}
+	return secret, nil
+}
+
+// isEmptySecret reports whether a secret has nothing to send: no bytes, or
+// only the newline of an empty line
+func isEmptySecret(secret string) bool {
+	return secret == "" || secret == "\n" || secret == "\r\n"
+}
+
+// isPiped reports whether stdin of this mode is a pipe or file rather than
+// a terminal. Pipes are checked first: under Git Bash and other MSYS
+// terminals on Windows a pipe can also report itself as a character device
+func isPiped(mode os.FileMode) bool {
+	return mode&os.ModeNamedPipe != 0 || mode&os.ModeCharDevice == 0
+}
+
+// Notification channels for -notify
+const (
+	channelSlack = "slack"
+	channelEmail = "email"
+)
+
+// notifyChannels is every channel, tried in this order
+var notifyChannels = []string{channelSlack, channelEmail}
+
+// parseNotifyChannels turns a -notify value into the channels to try
+func parseNotifyChannels(value string) ([]string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "both", "":
+		return notifyChannels, nil
+	case channelSlack:
+		return []string{channelSlack}, nil
+	case channelEmail:
+		return []string{channelEmail}, nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("-notify must be slack, email, both or none, not %q", value)
+	}
+}
+
+// parseSchedule turns the -at and -delay flags into a release time; the zero
+// time, when neither is given, sends the secret now
+func parseSchedule(at string, delay time.Duration, now time.Time) (time.Time, error) {
+	switch {
+	case at != "" && delay != 0:
+		return time.Time{}, errors.New("use -at or -delay, not both")
+	case at != "":
+		t, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("-at must be an RFC 3339 time such as 2026-01-02T09:00:00Z: %w", err)
+		}
+		return t, nil
+	case delay < 0:
+		return time.Time{}, errors.New("-delay must be positive")
+	case delay > 0:
+		return now.Add(delay), nil
+	default:
+		return time.Time{}, nil
+	}
+}
+
+// sendOptions controls how sendEncrypted notifies and reports
+type sendOptions struct {
+	notify      []string  // channels to try; empty sends no notification
+	json        bool      // print a sendOutput instead of text
+	availableAt time.Time // release time of a scheduled secret; zero sends now
+	dryRun      bool      // only have the server validate the secret
+}
+
+// Notification outcomes
+const (
+	notifySent      = "sent"
+	notifyScheduled = "scheduled" // the server sends it when the secret is released
+	notifyDisabled  = "disabled"  // the server has the channel turned off
+	notifyFailed    = "failed"
+)
+
+// notificationResult is the outcome of notifying over one channel
+type notificationResult struct {
+	Channel string `json:"channel"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+// sendOutput is what send -json prints
+type sendOutput struct {
+	ID            string               `json:"id"`
+	URL           string               `json:"url,omitempty"` // Empty in a dry run
+	DryRun        bool                 `json:"dry_run,omitempty"`
+	ExpiresAt     time.Time            `json:"expires_at"`
+	AvailableAt   *time.Time           `json:"available_at,omitempty"`
+	Sealed        bool                 `json:"sealed"`
+	Notifications []notificationResult `json:"notifications"`
+}
+
+// notifyRecipient tries each channel in turn. Notifications are best-effort:
+// failures are reported, never fatal
+func notifyRecipient(apiClient *client.Client, channels []string, recipientID int64, url string, scheduled bool) []notificationResult {
+	results := make([]notificationResult, 0, len(channels))
+	for _, channel := range channels {
+		var err error
+		switch channel {
+		case channelSlack:
+			err = apiClient.SendSlackNotification(recipientID, url)
+		case channelEmail:
+			err = apiClient.SendEmailNotification(recipientID, url)
+		}
+
+		result := notificationResult{Channel: channel, Status: notifySent}
+		if scheduled {
+			result.Status = notifyScheduled
+		}
+		switch {
+		case errors.Is(err, client.ErrNotificationDisabled):
+			result.Status = notifyDisabled
+		case err != nil:
+			result.Status = notifyFailed
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// printNotifications summarizes notifyRecipient's results
+func printNotifications(out io.Writer, results []notificationResult) {
+	if len(results) == 0 {
+		return
+	}
+	fmt.Fprintln(out, "\nNotifications:")
+	for _, r := range results {
+		switch r.Status {
+		case notifySent:
+			fmt.Fprintf(out, "  ✓ %s: sent\n", r.Channel)
+		case notifyScheduled:
+			fmt.Fprintf(out, "  ✓ %s: sent when the secret is released\n", r.Channel)
+		case notifyDisabled:
+			fmt.Fprintf(out, "  - %s: not enabled on the server\n", r.Channel)
+		default:
+			fmt.Fprintf(out, "  ✗ %s: %s\n", r.Channel, r.Error)
+		}
+	}
+}
+
+// printJSON writes v to out as indented JSON
+func printJSON(out io.Writer, v interface{}) {
+	data, _ := json.MarshalIndent(v, "", "  ")
+	fmt.Fprintln(out, string(data))
+}
+
+// sendEncrypted stores an already encrypted message for recipientEmail,
+// notifies the recipient and prints its link. Shared by send and submit
+func sendEncrypted(apiClient *client.Client, recipientEmail string, encrypted *crypto.EncryptedMessage, ttl int64, opts sendOptions, out io.Writer) error {
+	// 1. Find the recipient and their public key, if they have one
+	recipient, err := apiClient.FindUser(recipientEmail)
+	if err != nil {
+		return failAction("finding user", err)
+	}
+	recipientID := recipient.ID
+
+	if opts.dryRun {
+		return dryRunEncrypted(apiClient, recipient, encrypted, ttl, opts, out)
+	}
+
+	// 2. Send to API; the key is sealed to the recipient when possible
+	url, created, err := apiClient.SendScheduledMessage(recipientID, recipient.PublicKey, encrypted, ttl, opts.availableAt)
+	if err != nil {
+		return failAction("sending message", err)
+	}
+
+	// 3. Notify; for a scheduled secret the server holds the notification
+	notifications := notifyRecipient(apiClient, opts.notify, recipientID, url, created.AvailableAt != nil)
+
+	if opts.json {
+		printJSON(out, sendOutput{
+			ID:            created.ID,
+			URL:           url,
+			ExpiresAt:     created.ExpiresAt,
+			AvailableAt:   created.AvailableAt,
+			Sealed:        recipient.PublicKey != "",
+			Notifications: notifications,
+		})
+		return nil
+	}
+
+	fmt.Fprintln(out, "✓ Secret created successfully!")
+	fmt.Fprintf(out, "🔗 %s\n", url)
+	if recipient.PublicKey != "" {
+		fmt.Fprintln(out, "🔒 Key sealed to the recipient; the server cannot read it")
+	}
+	if created.AvailableAt != nil {
+		fmt.Fprintf(out, "⏰ Opens %s\n", created.AvailableAt.Local().Format(time.RFC1123))
+	}
+	printNotifications(out, notifications)
+	return nil
+}
+
+// dryRunEncrypted has the server validate the secret for recipient without
+// storing it, so CI can check credentials, connectivity and limits. Nobody
+// is notified
+func dryRunEncrypted(apiClient *client.Client, recipient *models.User, encrypted *crypto.EncryptedMessage, ttl int64, opts sendOptions, out io.Writer) error {
+	checked, err := apiClient.DryRunMessage(recipient.ID, recipient.PublicKey, encrypted, ttl, opts.availableAt)
+	if err != nil {
+		return failAction("validating message", err)
+	}
+
+	if opts.json {
+		printJSON(out, sendOutput{
+			ID:            checked.ID,
+			DryRun:        true,
+			ExpiresAt:     checked.ExpiresAt,
+			AvailableAt:   checked.AvailableAt,
+			Sealed:        recipient.PublicKey != "",
+			Notifications: []notificationResult{},
+		})
+		return nil
+	}
+
+	fmt.Fprintf(out, "✓ Dry run passed: the server would accept this secret for %s\n", recipient.Email)
+	fmt.Fprintln(out, "Nothing was sent and nobody was notified.")
+	return nil
+}
+
+// batchEntry is one message in a -batch file; TTL falls back to -ttl
+type batchEntry struct {
+	Email  string `json:"email"`
+	Secret string `json:"secret"`
+	TTL    int64  `json:"ttl,omitempty"`
+}
+
+// readBatchFile loads and validates a -batch file
+func readBatchFile(path string) ([]batchEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []batchEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid batch file: %w", err)
+	}
+	if len(entries) == 0 || len(entries) > client.MaxBulkMessages {
+		return nil, fmt.Errorf("batch file must contain between 1 and %d entries", client.MaxBulkMessages)
+	}
+	for i, e := range entries {
+		if strings.TrimSpace(e.Email) == "" || strings.TrimSpace(e.Secret) == "" {
+			return nil, fmt.Errorf("entry %d: email and secret are required", i+1)
+		}
+	}
+	return entries, nil
+}
+
+// sendBatch is `vanish send -batch <file>`
+func (a *App) sendBatch(path string, defaultTTL int64, availableAt time.Time, out io.Writer) error {
+	cfg, err := a.loadConfig()
+	if err != nil {
+		return err
+	}
+
+	entries, err := readBatchFile(path)
+	if err != nil {
+		return fail(ExitInvalid, fmt.Errorf("reading batch: %w", err))
+	}
+
+	apiClient, err := a.NewClient(cfg)
+	if err != nil {
+		return fail(ExitConfig, fmt.Errorf("configuring connection: %w", err))
+	}
+
+	// 1. Resolve every recipient with a single user listing
+	users, err := apiClient.ListUsers()
+	if err != nil {
+		return failAction("listing users", err)
+	}
+	byEmail := make(map[string]models.User, len(users))
+	for _, u := range users {
+		byEmail[strings.ToLower(u.Email)] = u
+	}
+
+	// 2. Encrypt locally
+	messages := make([]client.OutgoingMessage, len(entries))
+	for i, e := range entries {
+		recipient, ok := byEmail[strings.ToLower(strings.TrimSpace(e.Email))]
+		if !ok {
+			return fail(ExitNotFound, fmt.Errorf("entry %d: user not found: %s", i+1, e.Email))
+		}
+		encrypted, err := crypto.EncryptSecret(strings.TrimSpace(e.Secret))
+		if err != nil {
+			return fail(ExitFailure, fmt.Errorf("encrypting entry %d: %w", i+1, err))
+		}
+		ttl := e.TTL
+		if ttl == 0 {
+			ttl = defaultTTL
+		}
+		messages[i] = client.OutgoingMessage{
+			RecipientID:        recipient.ID,
+			Encrypted:          encrypted,
+			TTL:                ttl,
+			RecipientPublicKey: recipient.PublicKey,
+			AvailableAt:        availableAt,
+		}
+	}
+
+	// 3. Send in one request; items succeed or fail independently
+	results, err := apiClient.SendMessages(messages)
+	if err != nil {
+		return failAction("sending batch", err)
+	}
+
+	failed := 0
+	for i, r := range results {
+		if r.Err != nil {
+			failed++
+			fmt.Fprintf(out, "✗ %s: %v\n", entries[i].Email, r.Err)
+			continue
+		}
+		fmt.Fprintf(out, "✓ %s: %s\n", entries[i].Email, r.URL)
+	}
+
+	fmt.Fprintf(out, "\n%d sent, %d failed\n", len(results)-failed, failed)
+	if failed > 0 {
+		return fail(ExitFailure, fmt.Errorf("%d of %d secrets were not sent", failed, len(results)))
+	}
+	return nil
+}
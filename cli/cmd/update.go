@@ -0,0 +1,313 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zafrem/vanish/shared/client"
+	"github.com/zafrem/vanish/shared/models"
+)
+
+const (
+	// defaultUpdateURL serves the latest release assets and their SHA256SUMS
+	defaultUpdateURL = "https://github.com/zafrem/Vanish/releases/latest/download"
+
+	// checksumFile lists "<sha256>  <asset>" for every release asset
+	checksumFile = "SHA256SUMS"
+
+	// maxReleaseSize bounds a downloaded binary
+	maxReleaseSize = 200 << 20
+)
+
+// parseVersion splits "v1.2.3" or "1.2.3-rc1" into its numeric parts
+// ok is false for anything that is not a release version, such as "dev"
+func parseVersion(v string) (parts [3]int, ok bool) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(v, "-+"); i >= 0 {
+		v = v[:i]
+	}
+	fields := strings.Split(v, ".")
+	if len(fields) == 0 || len(fields) > 3 {
+		return parts, false
+	}
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil || n < 0 {
+			return parts, false
+		}
+		parts[i] = n
+	}
+	return parts, true
+}
+
+// compareVersions returns -1, 0 or 1 as a is older, equal or newer than b
+// ok is false when either is not a release version
+func compareVersions(a, b string) (int, bool) {
+	pa, okA := parseVersion(a)
+	pb, okB := parseVersion(b)
+	if !okA || !okB {
+		return 0, false
+	}
+	for i := range pa {
+		switch {
+		case pa[i] < pb[i]:
+			return -1, true
+		case pa[i] > pb[i]:
+			return 1, true
+		}
+	}
+	return 0, true
+}
+
+// compatibilityWarning explains why clientVersion may not work with server,
+// or returns "" when it is supported or cannot be checked
+func compatibilityWarning(clientVersion string, server *models.ServerVersion) string {
+	if server.MinClientVersion == "" {
+		return ""
+	}
+	if cmp, ok := compareVersions(clientVersion, server.MinClientVersion); ok && cmp < 0 {
+		return fmt.Sprintf("this CLI (%s) is older than the oldest version the server supports (%s). Run 'vanish update'",
+			clientVersion, server.MinClientVersion)
+	}
+	return ""
+}
+
+// ShowVersion is `vanish version`: this CLI's and the configured server's
+// versions, and whether they work together
+func (a *App) ShowVersion(args []string, in io.Reader, out io.Writer) error {
+	fs := a.flags("version", true)
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "vanish %s", a.Version)
+	if a.BuildTime != "" {
+		fmt.Fprintf(out, " (built %s)", a.BuildTime)
+	}
+	fmt.Fprintf(out, " %s/%s\n", runtime.GOOS, runtime.GOARCH)
+
+	cfg, err := a.loadConfig()
+	if err != nil {
+		fmt.Fprintln(out, "Server:  not configured")
+		return nil
+	}
+	apiClient, err := a.NewClient(cfg)
+	if err != nil {
+		return fail(ExitConfig, fmt.Errorf("configuring connection: %w", err))
+	}
+
+	server, err := apiClient.GetServerVersion()
+	if err != nil {
+		if errors.Is(err, client.ErrVersionUnavailable) {
+			fmt.Fprintf(out, "Server:  %s (version unknown; older than this CLI)\n", cfg.BaseURL)
+			return nil
+		}
+		fmt.Fprintf(out, "Server:  %s (%v)\n", cfg.BaseURL, err)
+		return nil
+	}
+	fmt.Fprintf(out, "Server:  %s %s (API %s)\n", cfg.BaseURL, server.Version, server.APIVersion)
+	if server.Commit != "" {
+		fmt.Fprintf(out, "         commit %s, built %s\n", server.Commit, server.BuildDate)
+	}
+
+	if _, ok := parseVersion(a.Version); !ok && server.MinClientVersion != "" {
+		fmt.Fprintf(out, "Note: development build; compatibility with the server's minimum (%s) not checked\n", server.MinClientVersion)
+	}
+	if warning := compatibilityWarning(a.Version, server); warning != "" {
+		fmt.Fprintf(out, "⚠ Warning: %s\n", warning)
+	}
+	return nil
+}
+
+// releaseAssetName is the release file for a platform, e.g. vanish-linux-amd64
+func releaseAssetName(goos, goarch string) string {
+	name := "vanish-" + goos + "-" + goarch
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// parseChecksums finds asset in a SHA256SUMS file ("<hex>  [*]<name>" lines)
+func parseChecksums(sums []byte, asset string) (string, error) {
+	for _, line := range strings.Split(string(sums), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != asset {
+			continue
+		}
+		if len(fields[0]) != sha256.Size*2 {
+			return "", fmt.Errorf("malformed checksum for %s", asset)
+		}
+		return strings.ToLower(fields[0]), nil
+	}
+	return "", fmt.Errorf("%s not listed in %s", asset, checksumFile)
+}
+
+// download fetches url, refusing bodies larger than limit
+func download(httpClient *http.Client, url string, limit int64) ([]byte, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("GET %s: response larger than %d bytes", url, limit)
+	}
+	return data, nil
+}
+
+// fetchRelease downloads asset from baseURL and verifies it against the
+// SHA256SUMS file published next to it. Only https URLs are accepted
+func fetchRelease(httpClient *http.Client, baseURL, asset string) ([]byte, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("update URL must be an https URL, got %q", baseURL)
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	sums, err := download(httpClient, baseURL+"/"+checksumFile, 1<<20)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download checksums: %w", err)
+	}
+	want, err := parseChecksums(sums, asset)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := download(httpClient, baseURL+"/"+asset, maxReleaseSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", asset, err)
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return nil, fmt.Errorf("checksum mismatch for %s: got %s, want %s", asset, got, want)
+	}
+	return data, nil
+}
+
+// checkWritable reports whether the executable at path can be replaced
+// Replacing is a rename within its directory, so the directory must be
+// writable; the running file itself is never opened for writing
+func checkWritable(path string) error {
+	probe, err := os.CreateTemp(filepath.Dir(path), ".vanish-update-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable", filepath.Dir(path))
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// replaceExecutable atomically replaces path with data, keeping its mode
+// The new binary is written next to the old one and renamed over it, so an
+// interrupted update leaves the old binary intact
+func replaceExecutable(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".new-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(info.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Update is `vanish update`: it replaces this binary with the latest
+// release after checking its checksum
+func (a *App) Update(args []string, in io.Reader, out io.Writer) error {
+	fs := a.flags("update", true)
+	updateURL := fs.String("url", "", "Release download URL (default: VANISH_UPDATE_URL or GitHub releases)")
+	if err := parse(fs, args); err != nil {
+		return err
+	}
+
+	baseURL := *updateURL
+	if baseURL == "" {
+		baseURL = os.Getenv("VANISH_UPDATE_URL")
+	}
+	if baseURL == "" {
+		baseURL = defaultUpdateURL
+	}
+
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		return fail(ExitFailure, fmt.Errorf("locating the vanish binary: %w", err))
+	}
+
+	if err := checkWritable(exe); err != nil {
+		fmt.Fprintln(a.Stderr, "If vanish was installed with a package manager, update it there instead")
+		fmt.Fprintln(a.Stderr, "(e.g. 'brew upgrade vanish' or your distribution's package manager).")
+		return fail(ExitFailure, fmt.Errorf("cannot update %s: %w", exe, err))
+	}
+
+	asset := releaseAssetName(runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(out, "Downloading %s from %s...\n", asset, baseURL)
+
+	// Go through the same proxy and CA settings as API calls, if configured
+	opts := client.Options{Proxy: a.conn.proxy, CABundle: a.conn.caBundle}
+	if cfg, err := a.loadConfig(); err == nil {
+		opts = client.OptionsFromConfig(cfg)
+	}
+	httpClient, err := client.NewHTTPClient(opts, 5*time.Minute)
+	if err != nil {
+		return fail(ExitConfig, fmt.Errorf("configuring connection: %w", err))
+	}
+
+	data, err := fetchRelease(httpClient, baseURL, asset)
+	if err != nil {
+		return err
+	}
+
+	if current, err := os.ReadFile(exe); err == nil && bytes.Equal(current, data) {
+		fmt.Fprintln(out, "✓ Already up to date")
+		return nil
+	}
+
+	if err := replaceExecutable(exe, data); err != nil {
+		return fail(ExitFailure, fmt.Errorf("replacing %s: %w", exe, err))
+	}
+	fmt.Fprintf(out, "✓ Updated %s (checksum verified)\n", exe)
+	return nil
+}
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/zafrem/vanish/shared/client"
+	"github.com/zafrem/vanish/shared/config"
+	"github.com/zafrem/vanish/shared/models"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		want   int
+		wantOK bool
+	}{
+		{"1.2.3", "1.2.3", 0, true},
+		{"v1.2.3", "1.10.0", -1, true},
+		{"2.0", "1.9.9", 1, true},
+		{"1.4.0-rc1", "1.4.0", 0, true},
+		{"dev", "1.0.0", 0, false},
+		{"1.0.0", "", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := compareVersions(tt.a, tt.b)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("compareVersions(%q, %q) = %d, %v; want %d, %v", tt.a, tt.b, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestCompatibilityWarning(t *testing.T) {
+	server := &models.ServerVersion{Version: "2.0.0", MinClientVersion: "1.4.0"}
+
+	if w := compatibilityWarning("1.3.9", server); !strings.Contains(w, "vanish update") {
+		t.Errorf("old client warning = %q", w)
+	}
+	for _, v := range []string{"1.4.0", "1.5.2", "dev"} {
+		if w := compatibilityWarning(v, server); w != "" {
+			t.Errorf("compatibilityWarning(%q) = %q, want none", v, w)
+		}
+	}
+	if w := compatibilityWarning("0.1.0", &models.ServerVersion{Version: "2.0.0"}); w != "" {
+		t.Errorf("no minimum: warning = %q", w)
+	}
+}
+
+func TestGetServerVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/version" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(models.ServerVersion{Version: "2.0.0", APIVersion: "v1", MinClientVersion: "1.4.0"})
+	}))
+	defer server.Close()
+
+	version, err := client.NewClient(&config.Config{BaseURL: server.URL, Token: "t"}).GetServerVersion()
+	if err != nil || version.Version != "2.0.0" || version.MinClientVersion != "1.4.0" {
+		t.Errorf("GetServerVersion() = %+v, %v", version, err)
+	}
+
+	old := httptest.NewServer(http.NotFoundHandler())
+	defer old.Close()
+	_, err = client.NewClient(&config.Config{BaseURL: old.URL, Token: "t"}).GetServerVersion()
+	if !errors.Is(err, client.ErrVersionUnavailable) {
+		t.Errorf("older server error = %v", err)
+	}
+}
+
+// releaseServer serves one release asset and a SHA256SUMS file for it
+func releaseServer(t *testing.T, asset string, binary []byte, sum string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/releases/" + checksumFile:
+			w.Write([]byte(sum + "  *" + asset + "\n" + strings.Repeat("0", 64) + "  vanish-other-arch\n"))
+		case "/releases/" + asset:
+			w.Write(binary)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchRelease(t *testing.T) {
+	asset := releaseAssetName("linux", "amd64")
+	binary := []byte("#!/bin/sh\necho new vanish\n")
+	digest := sha256.Sum256(binary)
+
+	server := releaseServer(t, asset, binary, hex.EncodeToString(digest[:]))
+	data, err := fetchRelease(server.Client(), server.URL+"/releases/", asset)
+	if err != nil || string(data) != string(binary) {
+		t.Fatalf("fetchRelease() = %q, %v", data, err)
+	}
+
+	if _, err := fetchRelease(server.Client(), server.URL+"/releases", "vanish-plan9-arm"); err == nil {
+		t.Error("expected an error for an asset missing from the checksums")
+	}
+
+	tampered := releaseServer(t, asset, binary, strings.Repeat("ab", 32))
+	if _, err := fetchRelease(tampered.Client(), tampered.URL+"/releases", asset); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("tampered release error = %v", err)
+	}
+
+	if _, err := fetchRelease(http.DefaultClient, "http://example.com/releases", asset); err == nil || !strings.Contains(err.Error(), "https") {
+		t.Errorf("plain http error = %v", err)
+	}
+}
+
+func TestReplaceExecutable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vanish")
+	if err := os.WriteFile(path, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkWritable(path); err != nil {
+		t.Fatalf("checkWritable() error = %v", err)
+	}
+	if err := replaceExecutable(path, []byte("new")); err != nil {
+		t.Fatalf("replaceExecutable() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	info, _ := os.Stat(path)
+	if string(data) != "new" {
+		t.Errorf("replaced binary = %q", data)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0755 {
+		t.Errorf("replaced binary mode = %v, want 0755", info.Mode().Perm())
+	}
+
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestCheckWritableReadOnlyDir(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root can write to read-only directories")
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows ignores Unix directory modes")
+	}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "vanish")
+	os.WriteFile(path, []byte("old"), 0755)
+	os.Chmod(dir, 0555)
+	defer os.Chmod(dir, 0755)
+
+	if err := checkWritable(path); err == nil {
+		t.Error("expected an error for a read-only install directory")
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/milkiss/vanish/cli/cmd"
+	"github.com/zafrem/vanish/shared/models"
+)
+
+// buildCLI compiles the vanish binary into a temporary directory
+func buildCLI(t *testing.T) string {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("builds the binary")
+	}
+	bin := filepath.Join(t.TempDir(), "vanish")
+	out, err := exec.Command("go", "build", "-o", bin, ".").CombinedOutput()
+	if err != nil {
+		t.Fatalf("go build: %v\n%s", err, out)
+	}
+	return bin
+}
+
+// exitCodeServer answers by the bearer token: "expired" is refused, "broken"
+// fails, anything else is a signed-in user who knows bob@example.com but
+// whose sends are refused for their TTL
+func exitCodeServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Vanish-API-Version", "1")
+		w.Header().Set("Content-Type", "application/json")
+		fail := func(status int, code, message string) {
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(models.ErrorResponse{Error: message, Code: code})
+		}
+
+		switch r.Header.Get("Authorization") {
+		case "Bearer expired":
+			fail(http.StatusUnauthorized, models.ErrorCodeUnauthorized, "Invalid or expired token")
+			return
+		case "Bearer broken":
+			fail(http.StatusInternalServerError, models.ErrorCodeInternal, "Internal server error")
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/api/v1/inbox":
+			w.Write([]byte("[]"))
+		case r.URL.Path == "/api/v1/users":
+			json.NewEncoder(w).Encode([]models.User{{ID: 2, Email: "bob@example.com", Name: "Bob"}})
+		case r.URL.Path == "/api/v1/messages" && r.Method == http.MethodPost:
+			fail(http.StatusBadRequest, models.ErrorCodeTTLOutOfRange, "TTL must be between 60 and 604800 seconds")
+		case r.URL.Path == "/api/v1/messages/gone/preview":
+			fail(http.StatusGone, models.ErrorCodeMessageAlreadyRead, "Message has already been read and burned")
+		default:
+			fail(http.StatusNotFound, models.ErrorCodeInvalidRequest, "Not found")
+		}
+	}))
+}
+
+// TestExitCodes runs the compiled binary and checks the exit status of each
+// kind of failure, which scripts rely on. Errors go to stderr only
+func TestExitCodes(t *testing.T) {
+	bin := buildCLI(t)
+	server := exitCodeServer()
+	defer server.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	downURL := down.URL
+	down.Close()
+
+	tests := []struct {
+		name     string
+		baseURL  string // empty runs without a configuration
+		token    string
+		args     []string
+		want     int
+		wantHint string
+	}{
+		{"ok", server.URL, "valid", []string{"inbox"}, cmd.ExitOK, ""},
+		{"help", "", "", []string{"help"}, cmd.ExitOK, ""},
+		{"no command", "", "", nil, cmd.ExitUsage, ""},
+		{"unknown command", "", "", []string{"frobnicate"}, cmd.ExitUsage, ""},
+		{"missing argument", server.URL, "valid", []string{"receive"}, cmd.ExitUsage, ""},
+		{"bad flag", server.URL, "valid", []string{"send", "-ttl", "soon"}, cmd.ExitUsage, ""},
+		{"config missing", "", "", []string{"inbox"}, cmd.ExitConfig, "vanish config"},
+		{"token expired", server.URL, "expired", []string{"inbox"}, cmd.ExitAuth, ""},
+		{"recipient not found", server.URL, "valid", []string{"send", "-notify", "none", "nobody@example.com", "s3cret"}, cmd.ExitNotFound, ""},
+		{"ttl refused", server.URL, "valid", []string{"send", "-notify", "none", "-ttl", "5", "bob@example.com", "s3cret"}, cmd.ExitInvalid, ""},
+		{"bad schedule", server.URL, "valid", []string{"send", "-delay", "-1h", "bob@example.com", "s3cret"}, cmd.ExitInvalid, ""},
+		{"server down", downURL, "valid", []string{"inbox"}, cmd.ExitNetwork, "network"},
+		{"server error", server.URL, "broken", []string{"inbox"}, cmd.ExitServer, ""},
+		{"message gone", server.URL, "valid", []string{"receive", "-y", server.URL + "/m/gone#a2V5"}, cmd.ExitGone, "read only once"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if tt.baseURL != "" {
+				data, _ := json.Marshal(map[string]string{"base_url": tt.baseURL, "token": tt.token})
+				if err := os.WriteFile(filepath.Join(dir, "config.json"), data, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var stdout, stderr bytes.Buffer
+			run := exec.Command(bin, tt.args...)
+			run.Env = append(os.Environ(), "VANISH_CONFIG_DIR="+dir, "HOME="+dir, "NO_PROXY=*")
+			run.Stdin = strings.NewReader("")
+			run.Stdout, run.Stderr = &stdout, &stderr
+			err := run.Run()
+
+			status := 0
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				status = exitErr.ExitCode()
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if status != tt.want {
+				t.Fatalf("exit status = %d, want %d\nstdout: %s\nstderr: %s", status, tt.want, stdout.String(), stderr.String())
+			}
+
+			if tt.want == cmd.ExitOK {
+				if stderr.Len() != 0 {
+					t.Errorf("stderr = %q, want nothing on success", stderr.String())
+				}
+				return
+			}
+			if stderr.Len() == 0 {
+				t.Error("failure reported nothing on stderr")
+			}
+			if strings.Contains(stdout.String(), "Error") {
+				t.Errorf("stdout = %q, errors belong on stderr", stdout.String())
+			}
+			if !strings.Contains(stderr.String(), tt.wantHint) {
+				t.Errorf("stderr = %q, want it to mention %q", stderr.String(), tt.wantHint)
+			}
+		})
+	}
+}
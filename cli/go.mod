@@ -2,6 +2,11 @@ module github.com/milkiss/vanish/cli
 
 go 1.23.4
 
-require github.com/zafrem/vanish/shared v0.1.0
+require (
+	github.com/zafrem/vanish/shared v0.1.0
+	golang.org/x/term v0.21.0
+)
+
+require golang.org/x/sys v0.21.0 // indirect
 
 replace github.com/zafrem/vanish/shared => ../shared
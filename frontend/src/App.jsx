@@ -59,6 +59,8 @@ function App() {
                 </ProtectedRoute>
               }
             />
+            {/* Link emailed to a recipient without an account */}
+            <Route path="/m/:id/:token" element={<RetrieveMessage />} />
             <Route
               path="/m/:id"
               element={
@@ -1,6 +1,6 @@
 import React, { useState, useEffect } from 'react';
 import { useAuth } from '../context/AuthContext';
-import { getToken } from '../lib/api';
+import { authHeaders } from '../lib/api';
 
 export default function AdminDashboard() {
   const { user } = useAuth();
@@ -37,7 +37,7 @@ export default function AdminDashboard() {
       setLoading(true);
       const response = await fetch('/api/users', {
         headers: {
-          'Authorization': `Bearer ${getToken()}`,
+          ...authHeaders(),
         },
       });
       if (response.ok) {
@@ -58,7 +58,7 @@ export default function AdminDashboard() {
       setLoading(true);
       const response = await fetch('/api/admin/statistics', {
         headers: {
-          'Authorization': `Bearer ${getToken()}`,
+          ...authHeaders(),
         },
       });
       if (response.ok) {
@@ -83,7 +83,7 @@ export default function AdminDashboard() {
         method: 'POST',
         headers: {
           'Content-Type': 'application/json',
-          'Authorization': `Bearer ${getToken()}`,
+          ...authHeaders(),
         },
         body: JSON.stringify(userForm),
       });
@@ -113,7 +113,7 @@ export default function AdminDashboard() {
         method: 'PUT',
         headers: {
           'Content-Type': 'application/json',
-          'Authorization': `Bearer ${getToken()}`,
+          ...authHeaders(),
         },
         body: JSON.stringify(userForm),
       });
@@ -136,7 +136,7 @@ export default function AdminDashboard() {
   };
 
   const handleDeleteUser = async (userId) => {
-    if (!confirm('Are you sure you want to delete this user?')) return;
+    if (!confirm('Delete this user? Their account is anonymized; message history of other users is kept.')) return;
 
     try {
       setLoading(true);
@@ -144,7 +144,7 @@ export default function AdminDashboard() {
       const response = await fetch(`/api/admin/users/${userId}`, {
         method: 'DELETE',
         headers: {
-          'Authorization': `Bearer ${getToken()}`,
+          ...authHeaders(),
         },
       });
 
@@ -188,13 +188,13 @@ export default function AdminDashboard() {
       const response = await fetch('/api/admin/cleanup', {
         method: 'POST',
         headers: {
-          'Authorization': `Bearer ${getToken()}`,
+          ...authHeaders(),
         },
       });
 
       if (response.ok) {
         const data = await response.json();
-        setSuccess(`Cleanup completed: ${data.expired_count} messages removed`);
+        setSuccess(`Cleanup completed: ${data.expired_metadata} messages expired`);
       } else {
         throw new Error('Failed to run cleanup');
       }
@@ -439,6 +439,28 @@ export default function AdminDashboard() {
                         <span className="text-gray-400">Expired:</span>
                         <span className="font-bold text-red-400">{statistics.messages.expired}</span>
                       </div>
+                      {statistics.messages.by_client && (
+                        <div className="pt-2 border-t border-dark-border">
+                          <span className="text-gray-400">Created via:</span>
+                          {Object.entries(statistics.messages.by_client).map(([client, count]) => (
+                            <div key={client} className="flex justify-between">
+                              <span className="text-gray-500 uppercase text-xs">{client}</span>
+                              <span className="font-bold">{count}</span>
+                            </div>
+                          ))}
+                        </div>
+                      )}
+                      {statistics.messages.by_region && Object.keys(statistics.messages.by_region).length > 1 && (
+                        <div className="pt-2 border-t border-dark-border">
+                          <span className="text-gray-400">Stored in region:</span>
+                          {Object.entries(statistics.messages.by_region).map(([region, count]) => (
+                            <div key={region} className="flex justify-between">
+                              <span className="text-gray-500 uppercase text-xs">{region}</span>
+                              <span className="font-bold">{count}</span>
+                            </div>
+                          ))}
+                        </div>
+                      )}
                     </div>
                   </div>
                 </div>
@@ -547,7 +569,15 @@ export default function AdminDashboard() {
                           <span className="px-2 py-1 bg-red-600 text-white text-xs rounded font-mono">DELETE</span>
                           <code className="text-gray-300">/api/admin/users/:id</code>
                         </div>
-                        <p className="text-gray-500 text-xs">Delete a user</p>
+                        <p className="text-gray-500 text-xs">Delete (anonymize) a user</p>
+                      </div>
+
+                      <div className="bg-slate-900 p-3 rounded">
+                        <div className="flex items-center gap-2 mb-1">
+                          <span className="px-2 py-1 bg-red-600 text-white text-xs rounded font-mono">DELETE</span>
+                          <code className="text-gray-300">/api/admin/users/:id/purge</code>
+                        </div>
+                        <p className="text-gray-500 text-xs">Permanently delete a user and their message metadata</p>
                       </div>
 
                       <div className="bg-slate-900 p-3 rounded">
@@ -558,6 +588,14 @@ export default function AdminDashboard() {
                         <p className="text-gray-500 text-xs">Manually trigger expired message cleanup</p>
                       </div>
 
+                      <div className="bg-slate-900 p-3 rounded">
+                        <div className="flex items-center gap-2 mb-1">
+                          <span className="px-2 py-1 bg-green-600 text-white text-xs rounded font-mono">GET</span>
+                          <code className="text-gray-300">/api/admin/messages/:id/diagnose</code>
+                        </div>
+                        <p className="text-gray-500 text-xs">Explain why a message can or cannot be opened</p>
+                      </div>
+
                       <div className="bg-slate-900 p-3 rounded">
                         <div className="flex items-center gap-2 mb-1">
                           <span className="px-2 py-1 bg-blue-600 text-white text-xs rounded font-mono">POST</span>
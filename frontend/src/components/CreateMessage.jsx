@@ -1,6 +1,7 @@
 import React, { useState, useEffect } from 'react';
 import { generateKey, exportKey, encrypt } from '../lib/crypto';
-import { createMessage, getUsers, sendSlackNotification, sendEmailNotification } from '../lib/api';
+import { createMessage, getUsers, getSenderPolicy, sendSlackNotification, sendEmailNotification } from '../lib/api';
+import { matchDLP } from '../lib/dlp';
 import { generateShareableURL } from '../utils/urlHelpers';
 import { copyToClipboard } from '../lib/clipboard';
 import { useAuth } from '../context/AuthContext';
@@ -23,6 +24,7 @@ export default function CreateMessage() {
   const [selectedUser, setSelectedUser] = useState(null);
   const [notificationStatus, setNotificationStatus] = useState(null); // 'slack_sent', 'email_sent', 'error'
   const [isSendingNotification, setIsSendingNotification] = useState(false);
+  const [senderPolicy, setSenderPolicy] = useState(null);
   const { user } = useAuth();
 
   useEffect(() => {
@@ -43,6 +45,21 @@ export default function CreateMessage() {
     fetchUsers();
   }, [user]);
 
+  useEffect(() => {
+    // DLP warnings are best effort: without a policy the form works as before
+    async function fetchPolicy() {
+      try {
+        setSenderPolicy(await getSenderPolicy());
+      } catch (err) {
+        setSenderPolicy(null);
+      }
+    }
+
+    fetchPolicy();
+  }, []);
+
+  const dlpMatches = matchDLP(senderPolicy, secretText);
+
   // Click outside detection to close dropdown
   useEffect(() => {
     const handleClickOutside = (e) => {
@@ -327,6 +344,17 @@ export default function CreateMessage() {
               className="w-full bg-slate-900 border border-dark-border rounded-lg px-4 py-3 text-gray-100 placeholder-gray-500 focus:outline-none focus:ring-2 focus:ring-blue-500 resize-none"
               disabled={isCreating}
             />
+            {dlpMatches.length > 0 && (
+              <div role="alert" className="mt-2 bg-yellow-900/30 border border-yellow-500 text-yellow-300 px-4 py-3 rounded-lg text-sm">
+                <p className="font-semibold">This looks like sensitive data your organization flags:</p>
+                <ul className="list-disc list-inside mt-1">
+                  {dlpMatches.map((p) => (
+                    <li key={p.name}>{p.description || p.name}</li>
+                  ))}
+                </ul>
+                <p className="mt-1">You can still send it if you intended to.</p>
+              </div>
+            )}
           </div>
 
           <div>
@@ -1,9 +1,12 @@
 import React, { useState, useEffect } from 'react';
-import { getHistory } from '../lib/api';
+import { getHistory, expirePending } from '../lib/api';
 import { useAuth } from '../context/AuthContext';
 import { generateShareableURL } from '../utils/urlHelpers';
 import { copyToClipboard } from '../lib/clipboard';
 
+// Names of the created_via clients shown next to a message; web is the default
+const CLIENT_LABELS = { api: 'API', cli: 'CLI', slack: 'Slack', mcp: 'MCP agent' };
+
 export default function MessageHistory() {
   const [history, setHistory] = useState([]);
   const [loading, setLoading] = useState(true);
@@ -27,6 +30,20 @@ export default function MessageHistory() {
     }
   };
 
+  const pendingReceived = history.filter(h => h.is_recipient && h.status === 'pending');
+
+  const handleClearPending = async () => {
+    if (!window.confirm(`Discard ${pendingReceived.length} unread message(s)? They cannot be recovered.`)) {
+      return;
+    }
+    try {
+      await expirePending(pendingReceived.map(h => h.message_id));
+      await fetchHistory();
+    } catch (err) {
+      setError(err.message);
+    }
+  };
+
   const filteredHistory = history.filter(item => {
     if (filter === 'sent') return item.is_sender;
     if (filter === 'received') return item.is_recipient;
@@ -39,6 +56,8 @@ export default function MessageHistory() {
         return 'text-green-400 bg-green-900/30 border-green-500';
       case 'pending':
         return 'text-yellow-400 bg-yellow-900/30 border-yellow-500';
+      case 'claimed':
+        return 'text-blue-400 bg-blue-900/30 border-blue-500';
       case 'expired':
         return 'text-red-400 bg-red-900/30 border-red-500';
       default:
@@ -52,6 +71,8 @@ export default function MessageHistory() {
         return '✓';
       case 'pending':
         return '⏳';
+      case 'claimed':
+        return '📥';
       case 'expired':
         return '⌛';
       default:
@@ -108,7 +129,17 @@ export default function MessageHistory() {
       <div className="bg-dark-card border border-dark-border rounded-lg shadow-2xl">
         {/* Header */}
         <div className="border-b border-dark-border p-6">
-          <h2 className="text-2xl font-bold mb-4">Message History</h2>
+          <div className="flex items-center justify-between mb-4">
+            <h2 className="text-2xl font-bold">Message History</h2>
+            {pendingReceived.length > 0 && (
+              <button
+                onClick={handleClearPending}
+                className="px-4 py-2 rounded-lg font-medium transition bg-red-900/30 text-red-300 border border-red-500 hover:bg-red-900/50"
+              >
+                Clear unread ({pendingReceived.length})
+              </button>
+            )}
+          </div>
 
           {/* Filter Tabs */}
           <div className="flex gap-2">
@@ -175,11 +206,12 @@ export default function MessageHistory() {
                           {item.is_sender ? (
                             <>To: <span className="text-blue-400">{item.recipient_name}</span></>
                           ) : (
-                            <>From: <span className="text-orange-400">{item.sender_name}</span></>
+                            <>From: <span className="text-orange-400">{item.sender_label || item.sender_name}</span></>
                           )}
                         </p>
                         <p className="text-xs text-gray-500">
                           {formatDate(item.created_at)}
+                          {item.created_via && item.created_via !== 'web' && ` · via ${CLIENT_LABELS[item.created_via] || item.created_via}`}
                         </p>
                       </div>
                     </div>
@@ -192,11 +224,28 @@ export default function MessageHistory() {
                       {item.status === 'pending' && (
                         <p>Expires {formatDate(item.expires_at)}</p>
                       )}
+                      {item.status === 'claimed' && (
+                        <p>Being retrieved by the recipient</p>
+                      )}
                       {item.status === 'expired' && (
                         <p className="text-red-400">Expired without being read</p>
                       )}
                     </div>
 
+                    {/* Key was discarded by the server (Slack with SLACK_STORE_KEY=false) */}
+                    {item.is_recipient && item.status === 'pending' && item.key_retained === false && (
+                      <p className="ml-11 mt-3 text-sm text-gray-400">
+                        🔑 Key not retained — use the link from your Slack DM
+                      </p>
+                    )}
+
+                    {/* Key was sealed to the recipient's CLI key pair (vanish keygen) */}
+                    {item.is_recipient && item.status === 'pending' && item.sealed_key && !item.encryption_key && (
+                      <p className="ml-11 mt-3 text-sm text-gray-400">
+                        🔒 Key sealed to your key pair — open it with <code>vanish receive</code> or the link you were sent
+                      </p>
+                    )}
+
                     {/* Show link for received pending messages */}
                     {item.is_recipient && item.status === 'pending' && item.encryption_key && (
                       <div className="ml-11 mt-3">
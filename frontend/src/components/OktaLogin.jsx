@@ -1,6 +1,7 @@
 import React, { useEffect, useState } from 'react';
 import { useNavigate, useSearchParams } from 'react-router-dom';
 import { useAuth } from '../context/AuthContext';
+import { COOKIE_AUTH } from '../lib/api';
 
 /**
  * OktaCallback component handles the OAuth callback from Okta
@@ -42,9 +43,11 @@ export function OktaCallback() {
 
       const data = await response.json();
 
-      // Store token and user
-      localStorage.setItem('token', data.token);
-      setToken(data.token);
+      // Store token and user (cookie sessions keep the token out of storage)
+      if (!COOKIE_AUTH) {
+        localStorage.setItem('token', data.token);
+        setToken(data.token);
+      }
       setUser(data.user);
 
       // Redirect to home
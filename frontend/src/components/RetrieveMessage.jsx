@@ -1,7 +1,7 @@
 import React, { useState, useEffect } from 'react';
 import { useParams, useNavigate } from 'react-router-dom';
 import { importKey, decrypt } from '../lib/crypto';
-import { getMessage, checkMessageExists } from '../lib/api';
+import { getMessage, checkMessageExists, getMessagePreview } from '../lib/api';
 import { extractKeyFromURL } from '../utils/urlHelpers';
 import { copyToClipboard, clearSensitiveData } from '../lib/clipboard';
 
@@ -10,10 +10,12 @@ import { copyToClipboard, clearSensitiveData } from '../lib/clipboard';
  * CRITICAL: Never renders the secret to DOM - copies directly to clipboard
  */
 export default function RetrieveMessage() {
-  const { id } = useParams();
+  // token is set on links sent to recipients without an account
+  const { id, token } = useParams();
   const navigate = useNavigate();
 
   const [messageExists, setMessageExists] = useState(null);
+  const [preview, setPreview] = useState(null);
   const [isLoading, setIsLoading] = useState(true);
   const [isBurning, setIsBurning] = useState(false);
   const [isBurned, setIsBurned] = useState(false);
@@ -21,7 +23,7 @@ export default function RetrieveMessage() {
 
   useEffect(() => {
     checkMessage();
-  }, [id]);
+  }, [id, token]);
 
   const checkMessage = async () => {
     try {
@@ -34,12 +36,22 @@ export default function RetrieveMessage() {
         return;
       }
 
+      // External recipients cannot check or preview; the read itself says
+      // whether the message is still there
+      if (token) {
+        setMessageExists(true);
+        return;
+      }
+
       // Check if message exists without burning it
       const exists = await checkMessageExists(id);
       setMessageExists(exists);
 
       if (!exists) {
         setError('Message not found or already burned');
+      } else {
+        // Best effort: the page still works without sender/expiry details
+        setPreview(await getMessagePreview(id));
       }
     } catch (err) {
       setError(err.message);
@@ -73,10 +85,10 @@ export default function RetrieveMessage() {
       encryptionKey = await importKey(keyString);
 
       // Step 3: Fetch encrypted message from server (burns it atomically)
-      const { ciphertext, iv } = await getMessage(id);
+      const { ciphertext, iv, content_encoding } = await getMessage(id, token);
 
       // Step 4: Decrypt in memory (NOT in state - stays in closure)
-      decryptedSecret = await decrypt(ciphertext, iv, encryptionKey);
+      decryptedSecret = await decrypt(ciphertext, iv, encryptionKey, content_encoding);
 
       // Step 5: Copy directly to clipboard without rendering
       const result = await copyToClipboard(decryptedSecret);
@@ -174,6 +186,13 @@ export default function RetrieveMessage() {
       <div className="bg-dark-card border border-dark-border rounded-lg p-8 shadow-2xl text-center">
         <div className="text-6xl mb-4">🔒</div>
         <h2 className="text-2xl font-bold mb-4">Secret Message Awaits</h2>
+        {preview && (
+          <div className="text-sm text-gray-300 mb-4 space-y-1">
+            <p>From <span className="font-semibold">{preview.sender_name}</span></p>
+            <p>Expires {new Date(preview.expires_at).toLocaleString()}</p>
+            {preview.one_time && <p>One-time read</p>}
+          </div>
+        )}
         <p className="text-gray-400 mb-6">
           Click the button below to reveal and copy the secret
         </p>
@@ -1,4 +1,5 @@
 import React, { createContext, useContext, useState, useEffect } from 'react';
+import { COOKIE_AUTH, authHeaders } from '../lib/api';
 
 const AuthContext = createContext(null);
 
@@ -6,13 +7,13 @@ const SESSION_TIMEOUT = 60; // 60 seconds (1 minute)
 
 export function AuthProvider({ children }) {
   const [user, setUser] = useState(null);
-  const [token, setToken] = useState(localStorage.getItem('token'));
+  const [token, setToken] = useState(COOKIE_AUTH ? null : localStorage.getItem('token'));
   const [loading, setLoading] = useState(true);
   const [timeLeft, setTimeLeft] = useState(null);
 
   useEffect(() => {
-    // Check if user is logged in on mount
-    if (token) {
+    // Check if user is logged in on mount (the session cookie is sent implicitly)
+    if (token || COOKIE_AUTH) {
       fetchCurrentUser();
     } else {
       setLoading(false);
@@ -40,9 +41,7 @@ export function AuthProvider({ children }) {
   const fetchCurrentUser = async () => {
     try {
       const response = await fetch('/api/auth/me', {
-        headers: {
-          'Authorization': `Bearer ${token}`
-        }
+        headers: authHeaders(),
       });
 
       if (response.ok) {
@@ -79,9 +78,11 @@ export function AuthProvider({ children }) {
     }
 
     const data = await response.json();
-    setToken(data.token);
+    if (!COOKIE_AUTH) {
+      setToken(data.token);
+      localStorage.setItem('token', data.token);
+    }
     setUser(data.user);
-    localStorage.setItem('token', data.token);
     // Only start timer for non-admin users
     if (!data.user.is_admin) {
       setTimeLeft(SESSION_TIMEOUT);
@@ -105,9 +106,11 @@ export function AuthProvider({ children }) {
     }
 
     const data = await response.json();
-    setToken(data.token);
+    if (!COOKIE_AUTH) {
+      setToken(data.token);
+      localStorage.setItem('token', data.token);
+    }
     setUser(data.user);
-    localStorage.setItem('token', data.token);
     // Only start timer for non-admin users
     if (!data.user.is_admin) {
       setTimeLeft(SESSION_TIMEOUT);
@@ -117,6 +120,9 @@ export function AuthProvider({ children }) {
   };
 
   const logout = () => {
+    if (COOKIE_AUTH) {
+      fetch('/api/auth/logout', { method: 'POST' }).catch(() => {});
+    }
     setToken(null);
     setUser(null);
     setTimeLeft(null);
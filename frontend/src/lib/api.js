@@ -4,17 +4,35 @@
 
 const API_BASE = import.meta.env.VITE_API_URL || '/api';
 
+// Cookie sessions (AUTH_COOKIE_ENABLED on the backend): the JWT lives in an
+// HttpOnly cookie and is never written to localStorage
+export const COOKIE_AUTH = import.meta.env.VITE_AUTH_COOKIE === 'true';
+
 // Export token getter for admin components
 export function getToken() {
   return localStorage.getItem('token');
 }
 
+// Double-submit CSRF header, echoing the cookie set by the backend at login
+function csrfHeader() {
+  const match = document.cookie.match(/(?:^|;\s*)vanish_csrf=([^;]+)/);
+  return match ? { 'X-CSRF-Token': decodeURIComponent(match[1]) } : {};
+}
+
+// Credentials for either auth mode: bearer token and/or CSRF header
+export function authHeaders() {
+  const token = getToken();
+  return {
+    ...(token && { 'Authorization': `Bearer ${token}` }),
+    ...csrfHeader(),
+  };
+}
+
 // Helper to get auth headers
 function getAuthHeaders() {
-  const token = localStorage.getItem('token');
   return {
     'Content-Type': 'application/json',
-    ...(token && { 'Authorization': `Bearer ${token}` })
+    ...authHeaders(),
   };
 }
 
@@ -41,7 +59,8 @@ export async function createMessage(ciphertext, iv, recipientId, encryptionKey,
 
   const response = await fetch(`${API_BASE}/messages`, {
     method: 'POST',
-    headers: getAuthHeaders(),
+    // Recorded as created_via, telling web messages apart in audits
+    headers: { ...getAuthHeaders(), 'X-Vanish-Client': 'web' },
     body: JSON.stringify(payload),
   });
 
@@ -56,12 +75,17 @@ export async function createMessage(ciphertext, iv, recipientId, encryptionKey,
 /**
  * Retrieve and burn a message (atomic operation)
  * @param {string} messageId - The message ID
- * @returns {Promise<{ciphertext: string, iv: string}>}
+ * @param {string} [accessToken] - Access token from an external recipient's link
+ * @returns {Promise<{ciphertext: string, iv: string, content_encoding?: string}>}
  */
-export async function getMessage(messageId) {
+export async function getMessage(messageId, accessToken) {
+  // External recipients have no session; the signed link token stands in
+  const headers = accessToken
+    ? { 'Content-Type': 'application/json', 'X-Vanish-Access-Token': accessToken }
+    : getAuthHeaders();
   const response = await fetch(`${API_BASE}/messages/${messageId}`, {
     method: 'GET',
-    headers: getAuthHeaders(),
+    headers,
   });
 
   if (!response.ok) {
@@ -92,6 +116,24 @@ export async function checkMessageExists(messageId) {
   return response.ok;
 }
 
+/**
+ * Describe a message (sender, expiry) without burning it
+ * @param {string} messageId - The message ID
+ * @returns {Promise<{sender_name: string, created_at: string, expires_at: string, one_time: boolean, passphrase_required: boolean}|null>}
+ *   The preview, or null if it is unavailable
+ */
+export async function getMessagePreview(messageId) {
+  const response = await fetch(`${API_BASE}/messages/${messageId}/preview`, {
+    headers: getAuthHeaders(),
+  });
+
+  if (!response.ok) {
+    return null;
+  }
+
+  return response.json();
+}
+
 /**
  * Get list of all users (for recipient selection)
  * @returns {Promise<Array<{id: number, name: string, email: string}>>}
@@ -108,6 +150,22 @@ export async function getUsers() {
   return response.json();
 }
 
+/**
+ * Get the sender policy: banned recipient domains and DLP patterns to warn about
+ * @returns {Promise<{banned_domains: Array<string>, dlp_patterns: Array<{name: string, pattern: string, description: string}>}>}
+ */
+export async function getSenderPolicy() {
+  const response = await fetch(`${API_BASE}/policy`, {
+    headers: getAuthHeaders(),
+  });
+
+  if (!response.ok) {
+    throw new Error('Failed to fetch sender policy');
+  }
+
+  return response.json();
+}
+
 /**
  * Get current user's message history
  * @param {number} limit - Maximum number of messages to return
@@ -125,6 +183,25 @@ export async function getHistory(limit = 50) {
   return response.json();
 }
 
+/**
+ * Expire unread messages addressed to the current user
+ * @param {string[]} messageIds - Pending message IDs to discard (max 500)
+ * @returns {Promise<{expired: string[], count: number}>}
+ */
+export async function expirePending(messageIds) {
+  const response = await fetch(`${API_BASE}/history/expire-pending`, {
+    method: 'POST',
+    headers: getAuthHeaders(),
+    body: JSON.stringify({ message_ids: messageIds }),
+  });
+
+  if (!response.ok) {
+    throw new Error('Failed to expire messages');
+  }
+
+  return response.json();
+}
+
 /**
  * Check backend health
  * @returns {Promise<{status: string}>}
@@ -72,24 +72,47 @@ export async function encrypt(plaintext, key) {
  * @param {string} ciphertextBase64 - Base64-encoded ciphertext
  * @param {string} ivBase64 - Base64-encoded IV
  * @param {CryptoKey} key - The decryption key
+ * @param {string} [contentEncoding] - 'gzip' when the plaintext was compressed before encryption
  * @returns {Promise<string>} Decrypted plaintext
  */
-export async function decrypt(ciphertextBase64, ivBase64, key) {
+export async function decrypt(ciphertextBase64, ivBase64, key, contentEncoding) {
   const ciphertext = base64ToArrayBuffer(ciphertextBase64);
   const iv = base64ToArrayBuffer(ivBase64);
 
+  let decrypted;
   try {
-    const decrypted = await crypto.subtle.decrypt(
+    decrypted = await crypto.subtle.decrypt(
       { name: 'AES-GCM', iv },
       key,
       ciphertext
     );
-
-    const decoder = new TextDecoder();
-    return decoder.decode(decrypted);
   } catch (error) {
     throw new Error('Decryption failed. The key may be incorrect or the message corrupted.');
   }
+
+  if (contentEncoding === 'gzip') {
+    // Decompress only after GCM has authenticated the data
+    decrypted = await gunzip(decrypted);
+  } else if (contentEncoding) {
+    throw new Error(`Unsupported content encoding: ${contentEncoding}`);
+  }
+
+  const decoder = new TextDecoder();
+  return decoder.decode(decrypted);
+}
+
+/**
+ * Decompress gzip data
+ * @param {ArrayBuffer} buffer
+ * @returns {Promise<ArrayBuffer>}
+ */
+async function gunzip(buffer) {
+  try {
+    const stream = new Blob([buffer]).stream().pipeThrough(new DecompressionStream('gzip'));
+    return await new Response(stream).arrayBuffer();
+  } catch (error) {
+    throw new Error('Decompression failed. The message may be corrupted.');
+  }
 }
 
 /**
@@ -0,0 +1,21 @@
+/**
+ * Match a secret against the DLP patterns of a sender policy. The server
+ * never sees the plaintext, so this runs in the browser before encryption
+ * and only warns; patterns the browser cannot compile are skipped
+ * @param {{dlp_patterns?: Array<{name: string, pattern: string, description: string}>}} policy
+ * @param {string} secret - Plaintext about to be encrypted
+ * @returns {Array<{name: string, pattern: string, description: string}>} Matching patterns
+ */
+export function matchDLP(policy, secret) {
+  if (!policy?.dlp_patterns || !secret) {
+    return [];
+  }
+
+  return policy.dlp_patterns.filter((p) => {
+    try {
+      return new RegExp(p.pattern).test(secret);
+    } catch {
+      return false;
+    }
+  });
+}
@@ -33,6 +33,7 @@ describe('API Functions', () => {
           headers: expect.objectContaining({
             'Content-Type': 'application/json',
             'Authorization': 'Bearer test-token',
+            'X-Vanish-Client': 'web',
           }),
         })
       );
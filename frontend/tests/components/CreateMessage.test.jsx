@@ -132,4 +132,29 @@ describe('CreateMessage Component', () => {
     expect(callArgs[0]).not.toBe('my secret password');
     expect(callArgs[0]).toBeDefined(); // Should be ciphertext
   });
+
+  test('should warn when the secret matches a DLP pattern', async () => {
+    vi.spyOn(api, 'getSenderPolicy').mockResolvedValue({
+      banned_domains: [],
+      dlp_patterns: [
+        { name: 'credit-card', pattern: '\\b(?:\\d[ -]?){13,16}\\b', description: 'Looks like a card number' },
+        { name: 'broken', pattern: '(?<', description: '' },
+      ],
+    });
+
+    renderComponent();
+
+    const textarea = await screen.findByPlaceholderText(/Enter password, API key, or sensitive data/i);
+    await waitFor(() => expect(api.getSenderPolicy).toHaveBeenCalled());
+
+    fireEvent.change(textarea, { target: { value: 'hunter2' } });
+    expect(screen.queryByRole('alert')).not.toBeInTheDocument();
+
+    fireEvent.change(textarea, { target: { value: 'card 4111 1111 1111 1111' } });
+    await waitFor(() => {
+      expect(screen.getByRole('alert')).toHaveTextContent('Looks like a card number');
+    });
+    // Warning only: sending stays possible
+    expect(screen.getByRole('alert')).toHaveTextContent(/still send/i);
+  });
 });
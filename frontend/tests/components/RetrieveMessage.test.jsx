@@ -94,4 +94,32 @@ describe('RetrieveMessage Component', () => {
       expect(screen.getByText(/Secret copied to your clipboard/i)).toBeInTheDocument();
     });
   });
+
+  test('should read with the access token of an external link', async () => {
+    vi.clearAllMocks();
+    api.getMessage.mockResolvedValue({
+      ciphertext: 'encrypted-data',
+      iv: 'test-iv',
+    });
+
+    window.history.pushState({}, 'Test page', '/m/test-id/1767175200.c2ln#dGVzdC1rZXk=');
+    render(
+      <BrowserRouter>
+        <Routes>
+          <Route path="/m/:id/:token" element={<RetrieveMessage />} />
+        </Routes>
+      </BrowserRouter>
+    );
+
+    await waitFor(() => {
+      const copyButton = screen.getByRole('button', { name: /Copy to Clipboard & Destroy/i });
+      fireEvent.click(copyButton);
+    });
+
+    await waitFor(() => {
+      expect(screen.getByText(/Message Burned!/i)).toBeInTheDocument();
+    });
+    expect(api.getMessage).toHaveBeenCalledWith('test-id', '1767175200.c2ln');
+    expect(api.checkMessageExists).not.toHaveBeenCalled();
+  });
 });
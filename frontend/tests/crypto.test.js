@@ -41,6 +41,22 @@ describe('Crypto Module', () => {
     expect(decrypted).toBe(plaintext);
   });
 
+  test('should decompress gzip messages after decrypting', async () => {
+    const key = await generateKey();
+    const plaintext = 'export DB_PASSWORD=s3cr3t\n'.repeat(100);
+
+    // Compress, then encrypt, as the CLI does for large secrets
+    const stream = new Blob([plaintext]).stream().pipeThrough(new CompressionStream('gzip'));
+    const compressed = await new Response(stream).arrayBuffer();
+    const iv = crypto.getRandomValues(new Uint8Array(12));
+    const ciphertext = await crypto.subtle.encrypt({ name: 'AES-GCM', iv }, key, compressed);
+    const toBase64 = (buf) => btoa(String.fromCharCode(...new Uint8Array(buf)));
+
+    const decrypted = await decrypt(toBase64(ciphertext), toBase64(iv), key, 'gzip');
+
+    expect(decrypted).toBe(plaintext);
+  });
+
   test('should handle special characters', async () => {
     const key = await generateKey();
     const plaintext = 'Special: !@#$%^&*()_+{}|:"<>?[];\',./`~';
@@ -0,0 +1,187 @@
+// Package confirm holds agent-initiated sends until a human approves them
+// through an MCP elicitation, or until the approval times out
+package confirm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// EnvRequireConfirmation turns confirmation on when set to a true value
+const EnvRequireConfirmation = "MCP_REQUIRE_CONFIRMATION"
+
+// DefaultTimeout is how long a pending send waits for the human
+const DefaultTimeout = 2 * time.Minute
+
+var (
+	// ErrDenied is returned when the human declines or cancels the send
+	ErrDenied = errors.New("the user declined to send the secret")
+	// ErrTimeout is returned when nobody answered in time
+	ErrTimeout = errors.New("the send was not confirmed in time and was cancelled")
+	// ErrUnknownToken is returned for a token that is not pending, because
+	// it was never issued, was already answered or has expired
+	ErrUnknownToken = errors.New("no pending send with this token")
+	// ErrUnsupported is the refusal for clients that cannot elicit a
+	// confirmation; the secret is never sent without one
+	ErrUnsupported = errors.New("this server requires a person to confirm each secret, " +
+		"but the client cannot ask for confirmation; send it with the CLI instead: vanish send <recipient>")
+)
+
+// Required reports whether EnvRequireConfirmation is set to a true value
+func Required() bool {
+	on, err := strconv.ParseBool(os.Getenv(EnvRequireConfirmation))
+	return err == nil && on
+}
+
+// Action describes a send to the human. It never holds the secret itself
+type Action struct {
+	Recipient string
+	TTL       time.Duration
+	Preview   string // See Redact
+}
+
+// Message is the confirmation question shown by the client
+func (a Action) Message() string {
+	return fmt.Sprintf("An agent wants to send a secret to %s, expiring after %s. Secret: %s. Send it?",
+		a.Recipient, a.TTL, a.Preview)
+}
+
+// Redact previews a secret by its length and first 2 characters only
+func Redact(secret string) string {
+	runes := []rune(secret)
+	if len(runes) <= 2 {
+		return fmt.Sprintf("%d characters", len(runes))
+	}
+	return fmt.Sprintf("%d characters starting with %q", len(runes), string(runes[:2]))
+}
+
+// pending is a send waiting for its answer
+type pending struct {
+	action   Action
+	expires  time.Time // The answer must come before then
+	answer   chan bool // Buffered, receives the one answer
+	answered bool
+}
+
+// Store keeps the pending sends of a session, keyed by token
+type Store struct {
+	timeout time.Duration
+
+	mu      sync.Mutex
+	pending map[string]*pending
+}
+
+// NewStore creates a store whose sends wait timeout, counted from Begin,
+// for an answer; 0 uses DefaultTimeout
+func NewStore(timeout time.Duration) *Store {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Store{timeout: timeout, pending: make(map[string]*pending)}
+}
+
+// Begin registers action and returns the token the elicitation answer
+// must carry. It also forgets the sends whose timeout has passed, so
+// sends that were never waited for do not pile up
+func (s *Store) Begin(action Action) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to create pending send token: %w", err)
+	}
+	token := hex.EncodeToString(b)
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for old, p := range s.pending {
+		if !now.Before(p.expires) {
+			delete(s.pending, old)
+		}
+	}
+	s.pending[token] = &pending{action: action, expires: now.Add(s.timeout), answer: make(chan bool, 1)}
+	return token, nil
+}
+
+// lookup returns the pending send of token unless its timeout has
+// passed. Callers hold s.mu
+func (s *Store) lookup(token string) (*pending, bool) {
+	p, ok := s.pending[token]
+	if !ok || !time.Now().Before(p.expires) {
+		return nil, false
+	}
+	return p, true
+}
+
+// Action returns the pending send of token
+func (s *Store) Action(token string) (Action, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.lookup(token)
+	if !ok {
+		return Action{}, ErrUnknownToken
+	}
+	return p.action, nil
+}
+
+// Resolve records the human's answer to token; only the first answer counts
+func (s *Store) Resolve(token string, approved bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.lookup(token)
+	if !ok || p.answered {
+		return ErrUnknownToken
+	}
+	p.answered = true
+	p.answer <- approved
+	return nil
+}
+
+// Wait blocks until token is answered and returns nil only if the send was
+// approved. Either way the token is gone afterwards: a send left unanswered
+// past the timeout, or when ctx ends, is dropped and a late answer gets
+// ErrUnknownToken
+func (s *Store) Wait(ctx context.Context, token string) error {
+	s.mu.Lock()
+	p, ok := s.lookup(token)
+	s.mu.Unlock()
+	if !ok {
+		return ErrUnknownToken
+	}
+	defer s.drop(token)
+
+	timer := time.NewTimer(time.Until(p.expires))
+	defer timer.Stop()
+	select {
+	case approved := <-p.answer:
+		if !approved {
+			return ErrDenied
+		}
+		return nil
+	case <-timer.C:
+		return ErrTimeout
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// drop forgets token
+func (s *Store) drop(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, token)
+}
+
+// Pending returns the number of sends not yet waited for, including
+// expired ones the next Begin forgets
+func (s *Store) Pending() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.pending)
+}
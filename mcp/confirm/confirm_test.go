@@ -0,0 +1,136 @@
+package confirm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func begin(t *testing.T, s *Store) string {
+	t.Helper()
+	token, err := s.Begin(Action{Recipient: "alice@corp.com", TTL: time.Hour, Preview: Redact("hunter2")})
+	if err != nil {
+		t.Fatalf("Begin() error = %v", err)
+	}
+	return token
+}
+
+func TestStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		answer  func(s *Store, token string)
+		wantErr error
+	}{
+		{"approve", func(s *Store, token string) { s.Resolve(token, true) }, nil},
+		{"deny", func(s *Store, token string) { s.Resolve(token, false) }, ErrDenied},
+		{"timeout", func(s *Store, token string) {}, ErrTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStore(50 * time.Millisecond)
+			token := begin(t, s)
+			go tt.answer(s, token)
+
+			if err := s.Wait(context.Background(), token); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Wait() error = %v, want %v", err, tt.wantErr)
+			}
+			if s.Pending() != 0 {
+				t.Errorf("Pending() = %d after the answer, want 0", s.Pending())
+			}
+			if err := s.Resolve(token, true); !errors.Is(err, ErrUnknownToken) {
+				t.Errorf("a second Resolve() error = %v, want ErrUnknownToken", err)
+			}
+		})
+	}
+}
+
+func TestStore_AnswerBeforeWait(t *testing.T) {
+	s := NewStore(time.Minute)
+	token := begin(t, s)
+	if err := s.Resolve(token, false); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	// Only the first answer counts
+	if err := s.Resolve(token, true); !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("a second Resolve() error = %v, want ErrUnknownToken", err)
+	}
+	if err := s.Wait(context.Background(), token); !errors.Is(err, ErrDenied) {
+		t.Errorf("Wait() error = %v, want ErrDenied", err)
+	}
+}
+
+func TestStore_ContextCancelled(t *testing.T) {
+	s := NewStore(time.Minute)
+	token := begin(t, s)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Wait(ctx, token); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Wait() error = %v, want context.Canceled", err)
+	}
+	if _, err := s.Action(token); !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("Action() after cancel error = %v, want ErrUnknownToken", err)
+	}
+}
+
+func TestStore_BeginForgetsExpiredSends(t *testing.T) {
+	s := NewStore(20 * time.Millisecond)
+	abandoned := begin(t, s)
+	begin(t, s)
+	time.Sleep(30 * time.Millisecond)
+
+	// Nobody waited for them, yet they can no longer be answered
+	if _, err := s.Action(abandoned); !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("Action() after the timeout error = %v, want ErrUnknownToken", err)
+	}
+	if err := s.Resolve(abandoned, true); !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("Resolve() after the timeout error = %v, want ErrUnknownToken", err)
+	}
+
+	fresh := begin(t, s)
+	if s.Pending() != 1 {
+		t.Errorf("Pending() = %d after Begin, want only the new send", s.Pending())
+	}
+	if _, err := s.Action(fresh); err != nil {
+		t.Errorf("Action() of the new send error = %v", err)
+	}
+}
+
+func TestStore_UnknownToken(t *testing.T) {
+	s := NewStore(0)
+	if err := s.Resolve("nope", true); !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("Resolve() error = %v, want ErrUnknownToken", err)
+	}
+	if err := s.Wait(context.Background(), "nope"); !errors.Is(err, ErrUnknownToken) {
+		t.Errorf("Wait() error = %v, want ErrUnknownToken", err)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := map[string]string{
+		"hunter2": `7 characters starting with "hu"`,
+		"ab":      "2 characters",
+		"":        "0 characters",
+		"пароль":  `6 characters starting with "па"`,
+	}
+	for secret, want := range tests {
+		if got := Redact(secret); got != want {
+			t.Errorf("Redact(%q) = %q, want %q", secret, got, want)
+		}
+	}
+
+	msg := Action{Recipient: "alice@corp.com", TTL: time.Hour, Preview: Redact("hunter2")}.Message()
+	if strings.Contains(msg, "hunter2") || !strings.Contains(msg, "alice@corp.com") || !strings.Contains(msg, "1h0m0s") {
+		t.Errorf("Message() = %q", msg)
+	}
+}
+
+func TestRequired(t *testing.T) {
+	for value, want := range map[string]bool{"true": true, "1": true, "false": false, "": false, "yes": false} {
+		t.Setenv(EnvRequireConfirmation, value)
+		if got := Required(); got != want {
+			t.Errorf("Required() with %q = %v, want %v", value, got, want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// UsageFileName is the file in the config directory that keeps today's
+// send count across restarts of the MCP server
+const UsageFileName = "mcp-usage.json"
+
+// usage is the content of the usage file
+type usage struct {
+	Date string `json:"date"` // local date, YYYY-MM-DD
+	Sent int    `json:"sent"`
+}
+
+// Counter enforces the daily send cap. The count lives in a file, so
+// restarting the server does not reset it
+type Counter struct {
+	path  string
+	limit int // 0 is no cap
+
+	mu sync.Mutex
+}
+
+// NewCounter creates a counter backed by the file at path
+// and capped at limit sends per day; 0 is no cap
+func NewCounter(path string, limit int) *Counter {
+	return &Counter{path: path, limit: limit}
+}
+
+// DefaultUsagePath returns the usage file next to the policy file
+func DefaultUsagePath() (string, error) {
+	path, err := DefaultPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), UsageFileName), nil
+}
+
+// Take counts one send on the day of now, or refuses it with a Violation
+// once the cap is reached. Call Release if the send then fails
+func (c *Counter) Take(now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	u, err := c.load(now)
+	if err != nil {
+		return err
+	}
+	if c.limit > 0 && u.Sent >= c.limit {
+		return &Violation{Rule: "daily_send_cap", Message: fmt.Sprintf(
+			"Policy allows %d secrets per day and all are used; try again tomorrow or send with the CLI", c.limit)}
+	}
+	u.Sent++
+	return c.save(u)
+}
+
+// Release returns a send taken on the day of now that did not happen
+func (c *Counter) Release(now time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	u, err := c.load(now)
+	if err != nil || u.Sent == 0 {
+		return err
+	}
+	u.Sent--
+	return c.save(u)
+}
+
+// Sent returns the sends counted on the day of now
+func (c *Counter) Sent(now time.Time) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	u, err := c.load(now)
+	return u.Sent, err
+}
+
+// load reads the usage of the day of now; a missing file or an earlier
+// day counts zero
+func (c *Counter) load(now time.Time) (usage, error) {
+	today := usage{Date: now.Local().Format(time.DateOnly)}
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return today, nil
+	}
+	if err != nil {
+		return today, fmt.Errorf("failed to read usage file: %w", err)
+	}
+
+	var u usage
+	if err := json.Unmarshal(data, &u); err != nil {
+		return today, fmt.Errorf("failed to parse usage file %s: %w", c.path, err)
+	}
+	if u.Date != today.Date {
+		return today, nil
+	}
+	return u, nil
+}
+
+// save writes the usage through a temporary file, so a crash never leaves
+// a truncated count behind
+func (c *Counter) save(u usage) error {
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write usage file: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("failed to write usage file: %w", err)
+	}
+	return nil
+}
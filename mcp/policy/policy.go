@@ -0,0 +1,202 @@
+// Package policy holds the guardrails of the MCP server: which recipients
+// an agent may send secrets to, for how long, and how often
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zafrem/vanish/shared/config"
+)
+
+// FileName is the policy file in the config directory, ~/.vanish by default
+const FileName = "mcp.json"
+
+// Policy limits what an agent may do through the send_secret tool. The zero
+// value lets an agent send to anyone, for any TTL the server accepts, as
+// often as it likes, but never create link-only messages
+type Policy struct {
+	// AllowedDomains are the recipient email domains, e.g. "corp.com";
+	// "*.corp.com" also matches its subdomains
+	AllowedDomains []string `json:"allowed_domains,omitempty"`
+	// AllowedEmails are recipients allowed regardless of their domain
+	AllowedEmails []string `json:"allowed_emails,omitempty"`
+	// MaxTTLSeconds caps the TTL; 0 leaves it to the server
+	MaxTTLSeconds int64 `json:"max_ttl_seconds,omitempty"`
+	// AllowLinkOnly permits messages whose link is handed to the agent
+	// instead of being delivered to the recipient
+	AllowLinkOnly bool `json:"allow_link_only"`
+	// DailySendCap caps the secrets sent per local calendar day; 0 is no cap
+	DailySendCap int `json:"daily_send_cap,omitempty"`
+}
+
+// Request is a send_secret call as the policy sees it
+type Request struct {
+	Recipient string
+	TTL       time.Duration
+	LinkOnly  bool
+}
+
+// Violation is a request the policy refuses. Its message explains the
+// rule, so the agent can tell the user why and what would be allowed
+type Violation struct {
+	Rule    string // allowed_recipients, max_ttl_seconds, allow_link_only or daily_send_cap
+	Message string
+}
+
+func (v *Violation) Error() string {
+	return v.Message
+}
+
+// DefaultPath returns the policy file in the config directory
+func DefaultPath() (string, error) {
+	dir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, FileName), nil
+}
+
+// Load reads a policy file; a missing file is the zero Policy
+func Load(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Policy{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse policy file %s: %w", path, err)
+	}
+	if err := p.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// Validate rejects negative limits and malformed entries, and normalizes
+// domains and emails to lower case
+func (p *Policy) Validate() error {
+	if p.MaxTTLSeconds < 0 {
+		return errors.New("max_ttl_seconds cannot be negative")
+	}
+	if p.DailySendCap < 0 {
+		return errors.New("daily_send_cap cannot be negative")
+	}
+	for i, domain := range p.AllowedDomains {
+		domain = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(domain)), ".")
+		if bare := strings.TrimPrefix(domain, "*."); bare == "" || strings.ContainsAny(bare, "@* ") {
+			return fmt.Errorf("allowed_domains: %q is not a domain", p.AllowedDomains[i])
+		}
+		p.AllowedDomains[i] = domain
+	}
+	for i, email := range p.AllowedEmails {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if _, ok := emailDomain(email); !ok {
+			return fmt.Errorf("allowed_emails: %q is not an email address", p.AllowedEmails[i])
+		}
+		p.AllowedEmails[i] = email
+	}
+	return nil
+}
+
+// RestrictsRecipients reports whether only listed recipients are allowed
+func (p *Policy) RestrictsRecipients() bool {
+	return len(p.AllowedDomains) > 0 || len(p.AllowedEmails) > 0
+}
+
+// AllowsRecipient reports whether email is on the allowlist, by address
+// or by domain. Matching ignores case; a domain does not cover its
+// subdomains unless listed as "*.domain"
+func (p *Policy) AllowsRecipient(email string) bool {
+	if !p.RestrictsRecipients() {
+		return true
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	domain, ok := emailDomain(email)
+	if !ok {
+		return false
+	}
+	for _, allowed := range p.AllowedEmails {
+		if email == allowed {
+			return true
+		}
+	}
+	for _, allowed := range p.AllowedDomains {
+		if parent, wildcard := strings.CutPrefix(allowed, "*."); wildcard {
+			if domain == parent || strings.HasSuffix(domain, "."+parent) {
+				return true
+			}
+		} else if domain == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Check refuses a request that breaks the recipient, TTL or link-only
+// rules. The daily cap is enforced by Counter.Take
+func (p *Policy) Check(req Request) error {
+	if req.LinkOnly && !p.AllowLinkOnly {
+		return &Violation{Rule: "allow_link_only", Message: "Policy forbids link-only messages: send the secret to a recipient instead"}
+	}
+	if !req.LinkOnly && !p.AllowsRecipient(req.Recipient) {
+		return &Violation{Rule: "allowed_recipients", Message: fmt.Sprintf(
+			"Policy forbids sending to %s: allowed recipients are %s", req.Recipient, p.describeRecipients())}
+	}
+	if max := time.Duration(p.MaxTTLSeconds) * time.Second; max > 0 && req.TTL > max {
+		return &Violation{Rule: "max_ttl_seconds", Message: fmt.Sprintf(
+			"Policy caps the TTL at %s; %s is too long", max, req.TTL)}
+	}
+	return nil
+}
+
+// Summary is what the get_policy tool reports: the policy and how much of
+// today's cap is left
+type Summary struct {
+	Policy
+	RecipientsRestricted bool `json:"recipients_restricted"`
+	SentToday            int  `json:"sent_today"`
+	RemainingToday       *int `json:"remaining_today,omitempty"` // Omitted without a cap
+}
+
+// Summarize reports p with the sends counter has taken on the day of now
+func Summarize(p *Policy, counter *Counter, now time.Time) (*Summary, error) {
+	sent, err := counter.Sent(now)
+	if err != nil {
+		return nil, err
+	}
+	s := &Summary{Policy: *p, RecipientsRestricted: p.RestrictsRecipients(), SentToday: sent}
+	if p.DailySendCap > 0 {
+		remaining := max(p.DailySendCap-sent, 0)
+		s.RemainingToday = &remaining
+	}
+	return s, nil
+}
+
+// describeRecipients lists the allowlist for violation messages
+func (p *Policy) describeRecipients() string {
+	var allowed []string
+	for _, domain := range p.AllowedDomains {
+		allowed = append(allowed, "anyone @"+domain)
+	}
+	allowed = append(allowed, p.AllowedEmails...)
+	return strings.Join(allowed, ", ")
+}
+
+// emailDomain returns the part after the last @ of a plausible address
+func emailDomain(email string) (string, bool) {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 || strings.ContainsAny(email, " *") {
+		return "", false
+	}
+	return strings.TrimSuffix(email[at+1:], "."), true
+}
@@ -0,0 +1,179 @@
+package policy
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAllowsRecipient(t *testing.T) {
+	p := &Policy{
+		AllowedDomains: []string{"Corp.com", "*.partner.io"},
+		AllowedEmails:  []string{"Contractor@gmail.com"},
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	tests := []struct {
+		email string
+		want  bool
+	}{
+		{"alice@corp.com", true},
+		{"ALICE@CORP.COM", true},
+		{"alice@eng.corp.com", false},
+		{"alice@corp.com.evil.net", false},
+		{"alice@notcorp.com", false},
+		{"bob@partner.io", true},
+		{"bob@eu.partner.io", true},
+		{"bob@evilpartner.io", false},
+		{"contractor@gmail.com", true},
+		{"someone@gmail.com", false},
+		{"corp.com", false},
+		{"@corp.com", false},
+		{"alice@", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := p.AllowsRecipient(tt.email); got != tt.want {
+			t.Errorf("AllowsRecipient(%q) = %v, want %v", tt.email, got, tt.want)
+		}
+	}
+
+	if !(&Policy{}).AllowsRecipient("anyone@anywhere.org") {
+		t.Error("an empty allowlist should allow everyone")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	p := &Policy{AllowedDomains: []string{"corp.com"}, MaxTTLSeconds: 3600}
+
+	tests := []struct {
+		name     string
+		req      Request
+		wantRule string
+	}{
+		{"allowed", Request{Recipient: "a@corp.com", TTL: time.Hour}, ""},
+		{"recipient", Request{Recipient: "a@other.com", TTL: time.Hour}, "allowed_recipients"},
+		{"ttl", Request{Recipient: "a@corp.com", TTL: 2 * time.Hour}, "max_ttl_seconds"},
+		{"link only", Request{LinkOnly: true, TTL: time.Hour}, "allow_link_only"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := p.Check(tt.req)
+			if tt.wantRule == "" {
+				if err != nil {
+					t.Fatalf("Check() error = %v", err)
+				}
+				return
+			}
+			var v *Violation
+			if !errors.As(err, &v) || v.Rule != tt.wantRule {
+				t.Fatalf("Check() error = %v, want a %s violation", err, tt.wantRule)
+			}
+		})
+	}
+
+	p.AllowLinkOnly = true
+	if err := p.Check(Request{LinkOnly: true, TTL: time.Hour}); err != nil {
+		t.Errorf("Check() of an allowed link-only request error = %v", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	p, err := Load(filepath.Join(dir, "missing.json"))
+	if err != nil {
+		t.Fatalf("Load() of a missing file error = %v", err)
+	}
+	if p.RestrictsRecipients() || p.AllowLinkOnly || p.DailySendCap != 0 {
+		t.Errorf("Load() of a missing file = %+v, want the zero policy", p)
+	}
+
+	path := filepath.Join(dir, FileName)
+	if err := os.WriteFile(path, []byte(`{"allowed_domains": [" Corp.com. "], "daily_send_cap": 5}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if p.AllowedDomains[0] != "corp.com" || p.DailySendCap != 5 {
+		t.Errorf("Load() = %+v", p)
+	}
+
+	for _, content := range []string{
+		`{"allowed_domains": ["user@corp.com"]}`,
+		`{"allowed_emails": ["corp.com"]}`,
+		`{"daily_send_cap": -1}`,
+		`{"max_ttl_seconds": "1h"}`,
+	} {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(path); err == nil {
+			t.Errorf("Load(%s) should fail", content)
+		}
+	}
+}
+
+func TestCounterPersistsAcrossRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), UsageFileName)
+	today := time.Date(2026, 3, 10, 9, 0, 0, 0, time.Local)
+
+	first := NewCounter(path, 2)
+	if err := first.Take(today); err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+
+	// A new counter on the same file is a restarted server
+	restarted := NewCounter(path, 2)
+	if err := restarted.Take(today.Add(time.Hour)); err != nil {
+		t.Fatalf("Take() after restart error = %v", err)
+	}
+	var v *Violation
+	if err := restarted.Take(today.Add(2 * time.Hour)); !errors.As(err, &v) || v.Rule != "daily_send_cap" {
+		t.Fatalf("Take() over the cap error = %v, want a daily_send_cap violation", err)
+	}
+
+	if err := restarted.Release(today); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if sent, _ := NewCounter(path, 2).Sent(today); sent != 1 {
+		t.Errorf("Sent() after Release = %d, want 1", sent)
+	}
+
+	tomorrow := today.AddDate(0, 0, 1)
+	if sent, _ := restarted.Sent(tomorrow); sent != 0 {
+		t.Errorf("Sent() the next day = %d, want 0", sent)
+	}
+	if err := restarted.Take(tomorrow); err != nil {
+		t.Errorf("Take() the next day error = %v", err)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), UsageFileName)
+	now := time.Now()
+	p := &Policy{AllowedEmails: []string{"a@corp.com"}, DailySendCap: 3}
+	counter := NewCounter(path, p.DailySendCap)
+	if err := counter.Take(now); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := Summarize(p, counter, now)
+	if err != nil {
+		t.Fatalf("Summarize() error = %v", err)
+	}
+	if !s.RecipientsRestricted || s.SentToday != 1 || s.RemainingToday == nil || *s.RemainingToday != 2 {
+		t.Errorf("Summarize() = %+v", s)
+	}
+
+	s, _ = Summarize(&Policy{}, NewCounter(path, 0), now)
+	if s.RemainingToday != nil {
+		t.Errorf("Summarize() without a cap reports %d remaining", *s.RemainingToday)
+	}
+}
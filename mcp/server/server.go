@@ -0,0 +1,256 @@
+// Package server is the Vanish MCP server. It speaks JSON-RPC 2.0 over
+// stdio, one message per line, and offers agents tools that send secrets
+// through the Vanish API within the limits of the MCP policy
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zafrem/vanish/mcp/confirm"
+	"github.com/zafrem/vanish/mcp/policy"
+	"github.com/zafrem/vanish/shared/client"
+	"github.com/zafrem/vanish/shared/config"
+)
+
+// ProtocolVersion is the MCP revision this server implements
+const ProtocolVersion = "2025-06-18"
+
+// Version is reported to clients in serverInfo
+const Version = "0.1.0"
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// message is a JSON-RPC request, notification or response read from the
+// client. Requests carry an ID and a method, notifications only a method,
+// and responses to the server's own requests an ID and a result or error
+type message struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *rpcError       `json:"error,omitempty"`
+}
+
+// request is a JSON-RPC request the server sends to the client
+type request struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      string `json:"id"`
+	Method  string `json:"method"`
+	Params  any    `json:"params"`
+}
+
+// response is a JSON-RPC response written to the client
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// Options are the optional behaviours of a server
+type Options struct {
+	// RequireConfirmation holds each send until a person approves it
+	// through an elicitation; see confirm.Required
+	RequireConfirmation bool
+	// ConfirmTimeout is how long a send waits for approval; 0 uses
+	// confirm.DefaultTimeout
+	ConfirmTimeout time.Duration
+}
+
+// Server serves one MCP session
+type Server struct {
+	api     *client.Client
+	policy  *policy.Policy
+	counter *policy.Counter
+	confirm *confirm.Store // nil unless sends need confirmation
+	now     func() time.Time
+
+	mu          sync.Mutex
+	elicitation bool // The client declared the elicitation capability
+
+	calls   sync.WaitGroup // Tool calls in progress
+	writeMu sync.Mutex
+	out     *json.Encoder
+}
+
+// NewServer creates a server from the CLI configuration and the policy
+// file in the config directory
+func NewServer() (*Server, error) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	opts := client.OptionsFromConfig(cfg)
+	opts.Kind = client.KindMCP
+	api, err := client.NewClientWithOptions(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := policy.DefaultPath()
+	if err != nil {
+		return nil, err
+	}
+	p, err := policy.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	usagePath, err := policy.DefaultUsagePath()
+	if err != nil {
+		return nil, err
+	}
+	return New(api, p, policy.NewCounter(usagePath, p.DailySendCap), Options{RequireConfirmation: confirm.Required()}), nil
+}
+
+// New creates a server that sends through api, within p and the daily
+// cap kept by counter
+func New(api *client.Client, p *policy.Policy, counter *policy.Counter, opts Options) *Server {
+	s := &Server{api: api, policy: p, counter: counter, now: time.Now}
+	if opts.RequireConfirmation {
+		s.confirm = confirm.NewStore(opts.ConfirmTimeout)
+	}
+	return s
+}
+
+// Run serves the session on in and out until in is closed. Tool calls
+// still in progress then, such as sends waiting for confirmation, are
+// cancelled before Run returns
+func (s *Server) Run(in io.Reader, out io.Writer) error {
+	s.out = json.NewEncoder(out)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer func() {
+		cancel()
+		s.calls.Wait()
+	}()
+
+	reader := bufio.NewReader(in)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			s.handle(ctx, line)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read request: %w", err)
+		}
+	}
+}
+
+// handle answers one message from the client
+func (s *Server) handle(ctx context.Context, line []byte) {
+	var msg message
+	if err := json.Unmarshal(line, &msg); err != nil {
+		s.reply(json.RawMessage("null"), nil, &rpcError{Code: codeParseError, Message: "parse error"})
+		return
+	}
+	if msg.Method == "" {
+		s.handleResponse(msg)
+		return
+	}
+	// Notifications, such as notifications/initialized, need no answer
+	if msg.ID == nil {
+		return
+	}
+
+	switch msg.Method {
+	case "initialize":
+		var params struct {
+			Capabilities struct {
+				Elicitation json.RawMessage `json:"elicitation"`
+			} `json:"capabilities"`
+		}
+		_ = json.Unmarshal(msg.Params, &params)
+		s.mu.Lock()
+		s.elicitation = len(params.Capabilities.Elicitation) > 0 && string(params.Capabilities.Elicitation) != "null"
+		s.mu.Unlock()
+		s.reply(msg.ID, initializeResult{
+			ProtocolVersion: ProtocolVersion,
+			Capabilities:    map[string]any{"tools": struct{}{}},
+			ServerInfo:      implementation{Name: "vanish", Version: Version},
+		}, nil)
+	case "ping":
+		s.reply(msg.ID, struct{}{}, nil)
+	case "tools/list":
+		s.reply(msg.ID, map[string]any{"tools": tools}, nil)
+	case "tools/call":
+		// Calls run beside the read loop, which must stay free to read the
+		// answers to the confirmations they ask for
+		s.calls.Add(1)
+		go func() {
+			defer s.calls.Done()
+			result, rpcErr := s.callTool(ctx, msg.Params)
+			s.reply(msg.ID, result, rpcErr)
+		}()
+	default:
+		s.reply(msg.ID, nil, &rpcError{Code: codeMethodNotFound, Message: "method not found: " + msg.Method})
+	}
+}
+
+// handleResponse routes the client's answer to a confirmation request to
+// the send waiting for it. Anything other than an accepted form with
+// confirm set denies the send; answers to unknown or expired sends are
+// ignored
+func (s *Server) handleResponse(msg message) {
+	var id string
+	if s.confirm == nil || json.Unmarshal(msg.ID, &id) != nil {
+		return
+	}
+	token, ok := strings.CutPrefix(id, confirmIDPrefix)
+	if !ok {
+		return
+	}
+
+	var result struct {
+		Action  string `json:"action"` // accept, decline or cancel
+		Content struct {
+			Confirm bool `json:"confirm"`
+		} `json:"content"`
+	}
+	approved := msg.Error == nil && json.Unmarshal(msg.Result, &result) == nil &&
+		result.Action == "accept" && result.Content.Confirm
+	_ = s.confirm.Resolve(token, approved)
+}
+
+// initializeResult answers initialize
+type initializeResult struct {
+	ProtocolVersion string         `json:"protocolVersion"`
+	Capabilities    map[string]any `json:"capabilities"`
+	ServerInfo      implementation `json:"serverInfo"`
+}
+
+type implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// reply writes the response to the request id
+func (s *Server) reply(id json.RawMessage, result any, rpcErr *rpcError) {
+	s.write(response{JSONRPC: "2.0", ID: id, Result: result, Error: rpcErr})
+}
+
+// write sends one message; calls from concurrent tool calls never interleave
+func (s *Server) write(v any) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_ = s.out.Encode(v) // A client that stopped reading also closes in, which ends Run
+}
@@ -0,0 +1,377 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zafrem/vanish/mcp/policy"
+	"github.com/zafrem/vanish/shared/client"
+	"github.com/zafrem/vanish/shared/config"
+)
+
+// fakeAPI is a Vanish server with two users that counts the calls it gets
+type fakeAPI struct {
+	mu       sync.Mutex
+	calls    int
+	messages int
+	notified int
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/api/v1/users":
+		fmt.Fprint(w, `[{"id": 2, "email": "alice@corp.com", "name": "Alice"}, {"id": 3, "email": "bob@other.com", "name": "Bob"}]`)
+	case "/api/v1/messages":
+		f.messages++
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id": "msg%d", "expires_at": %q}`, f.messages, time.Now().Add(time.Hour).Format(time.RFC3339))
+	case "/api/v1/notifications/send-email":
+		f.notified++
+		fmt.Fprint(w, `{"message": "sent"}`)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeAPI) counts() (calls, messages, notified int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls, f.messages, f.notified
+}
+
+// newServer returns a server that sends to a fake API within p, counting
+// sends in usagePath
+func newServer(t *testing.T, p *policy.Policy, usagePath string, opts Options) (*Server, *fakeAPI) {
+	t.Helper()
+	api := &fakeAPI{}
+	ts := httptest.NewServer(api)
+	t.Cleanup(ts.Close)
+	c := client.NewClient(&config.Config{BaseURL: ts.URL, Token: "test-token"})
+	return New(c, p, policy.NewCounter(usagePath, p.DailySendCap), opts), api
+}
+
+// incoming is a message the server wrote: a response, or a request of its own
+type incoming struct {
+	ID     json.RawMessage `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *rpcError       `json:"error"`
+}
+
+// session is a client connected to a running server
+type session struct {
+	t      *testing.T
+	in     *io.PipeWriter
+	out    *json.Decoder
+	nextID int
+
+	// elicit answers the server's elicitation requests; nil answers none
+	elicit func(message string) any
+}
+
+// start runs srv and initializes a session with a client that cannot
+// elicit
+func start(t *testing.T, srv *Server) *session {
+	return startEliciting(t, srv, nil)
+}
+
+// startEliciting is start with a client that has the elicitation
+// capability and gives elicit's result as the answer to each elicitation
+// request. A nil result leaves the request unanswered
+func startEliciting(t *testing.T, srv *Server, elicit func(message string) any) *session {
+	t.Helper()
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- srv.Run(inR, outW) }()
+	t.Cleanup(func() {
+		inW.Close()
+		outR.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Run() error = %v", err)
+		}
+	})
+
+	s := &session{t: t, in: inW, out: json.NewDecoder(outR), elicit: elicit}
+	capabilities := map[string]any{}
+	if elicit != nil {
+		capabilities["elicitation"] = map[string]any{}
+	}
+	var init initializeResult
+	s.request("initialize", map[string]any{
+		"protocolVersion": ProtocolVersion,
+		"capabilities":    capabilities,
+		"clientInfo":      implementation{Name: "test", Version: "1"},
+	}, &init)
+	if init.ProtocolVersion != ProtocolVersion || init.ServerInfo.Name != "vanish" {
+		t.Fatalf("initialize = %+v", init)
+	}
+	s.write(map[string]any{"jsonrpc": "2.0", "method": "notifications/initialized"})
+	return s
+}
+
+func (s *session) write(v any) {
+	s.t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	if _, err := s.in.Write(append(data, '\n')); err != nil {
+		s.t.Fatalf("write to server: %v", err)
+	}
+}
+
+// request sends method and decodes the result of its response into
+// result, answering the elicitation requests that come first
+func (s *session) request(method string, params, result any) {
+	s.t.Helper()
+	s.nextID++
+	id := s.nextID
+	s.write(map[string]any{"jsonrpc": "2.0", "id": id, "method": method, "params": params})
+
+	for {
+		var msg incoming
+		if err := s.out.Decode(&msg); err != nil {
+			s.t.Fatalf("read from server: %v", err)
+		}
+		if msg.Method == "elicitation/create" && s.elicit != nil {
+			var elicitation struct {
+				Message string `json:"message"`
+			}
+			if err := json.Unmarshal(msg.Params, &elicitation); err != nil {
+				s.t.Fatal(err)
+			}
+			if answer := s.elicit(elicitation.Message); answer != nil {
+				s.write(map[string]any{"jsonrpc": "2.0", "id": msg.ID, "result": answer})
+			}
+			continue
+		}
+		if string(msg.ID) != fmt.Sprint(id) {
+			s.t.Fatalf("unexpected message from server: %+v", msg)
+		}
+		if msg.Error != nil {
+			s.t.Fatalf("%s error = %+v", method, msg.Error)
+		}
+		if err := json.Unmarshal(msg.Result, result); err != nil {
+			s.t.Fatalf("decode %s result: %v", method, err)
+		}
+		return
+	}
+}
+
+// call runs a tool and returns its result
+func (s *session) call(name string, args map[string]any) toolResult {
+	s.t.Helper()
+	var result toolResult
+	s.request("tools/call", map[string]any{"name": name, "arguments": args}, &result)
+	if len(result.Content) != 1 {
+		s.t.Fatalf("%s returned %d content items", name, len(result.Content))
+	}
+	return result
+}
+
+func (r toolResult) text() string {
+	return r.Content[0].Text
+}
+
+func TestToolsList(t *testing.T) {
+	srv, _ := newServer(t, &policy.Policy{}, filepath.Join(t.TempDir(), policy.UsageFileName), Options{})
+	s := start(t, srv)
+
+	var list struct {
+		Tools []tool `json:"tools"`
+	}
+	s.request("tools/list", map[string]any{}, &list)
+	var names []string
+	for _, tl := range list.Tools {
+		names = append(names, tl.Name)
+	}
+	if strings.Join(names, ",") != "send_secret,get_policy" {
+		t.Errorf("tools/list = %v", names)
+	}
+}
+
+func TestSendSecret_EnforcesPolicy(t *testing.T) {
+	p := &policy.Policy{AllowedDomains: []string{"corp.com"}, MaxTTLSeconds: 3600}
+	tests := []struct {
+		name string
+		args map[string]any
+		want string // Part of the error; empty for a successful send
+	}{
+		{"allowed", map[string]any{"recipient": "alice@corp.com", "secret": "hunter2", "ttl_seconds": 600}, ""},
+		{"recipient", map[string]any{"recipient": "bob@other.com", "secret": "hunter2", "ttl_seconds": 600},
+			"Policy forbids sending to bob@other.com: allowed recipients are anyone @corp.com"},
+		{"ttl", map[string]any{"recipient": "alice@corp.com", "secret": "hunter2", "ttl_seconds": 7200},
+			"Policy caps the TTL at 1h0m0s"},
+		{"default ttl over the cap", map[string]any{"recipient": "alice@corp.com", "secret": "hunter2"},
+			"Policy caps the TTL at 1h0m0s"},
+		{"link only", map[string]any{"recipient": "alice@corp.com", "secret": "hunter2", "ttl_seconds": 600, "link_only": true},
+			"Policy forbids link-only messages"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, api := newServer(t, p, filepath.Join(t.TempDir(), policy.UsageFileName), Options{})
+			s := start(t, srv)
+
+			result := s.call("send_secret", tt.args)
+			calls, messages, notified := api.counts()
+			if tt.want == "" {
+				if result.IsError || messages != 1 || notified != 1 {
+					t.Fatalf("send_secret = %q, %d messages and %d notifications", result.text(), messages, notified)
+				}
+				return
+			}
+			if !result.IsError || !strings.Contains(result.text(), tt.want) {
+				t.Errorf("send_secret = %q, want an error containing %q", result.text(), tt.want)
+			}
+			if calls != 0 {
+				t.Errorf("a refused send made %d API calls", calls)
+			}
+		})
+	}
+}
+
+func TestSendSecret_LinkOnly(t *testing.T) {
+	srv, api := newServer(t, &policy.Policy{AllowLinkOnly: true}, filepath.Join(t.TempDir(), policy.UsageFileName), Options{})
+	s := start(t, srv)
+
+	result := s.call("send_secret", map[string]any{"recipient": "alice@corp.com", "secret": "hunter2", "link_only": true})
+	if result.IsError || !strings.Contains(result.text(), "/m/msg1#") {
+		t.Fatalf("send_secret = %q, want the link", result.text())
+	}
+	if _, _, notified := api.counts(); notified != 0 {
+		t.Errorf("a link-only send notified the recipient %d times", notified)
+	}
+}
+
+func TestSendSecret_DailyCapSurvivesRestart(t *testing.T) {
+	p := &policy.Policy{DailySendCap: 1}
+	usage := filepath.Join(t.TempDir(), policy.UsageFileName)
+	srv, _ := newServer(t, p, usage, Options{})
+	s := start(t, srv)
+
+	// A send that fails does not use up the cap
+	if result := s.call("send_secret", map[string]any{"recipient": "nobody@corp.com", "secret": "hunter2"}); !result.IsError {
+		t.Fatalf("send_secret to an unknown user = %q, want an error", result.text())
+	}
+	if result := s.call("send_secret", map[string]any{"recipient": "alice@corp.com", "secret": "hunter2"}); result.IsError {
+		t.Fatalf("send_secret = %q", result.text())
+	}
+
+	// A new server on the same usage file is a restarted one
+	restarted, api := newServer(t, p, usage, Options{})
+	s = start(t, restarted)
+	result := s.call("send_secret", map[string]any{"recipient": "alice@corp.com", "secret": "hunter2"})
+	if !result.IsError || !strings.Contains(result.text(), "Policy allows 1 secrets per day") {
+		t.Errorf("send_secret over the cap = %q, want a daily cap error", result.text())
+	}
+	if calls, _, _ := api.counts(); calls != 0 {
+		t.Errorf("a send over the cap made %d API calls", calls)
+	}
+}
+
+func TestGetPolicy(t *testing.T) {
+	p := &policy.Policy{AllowedEmails: []string{"alice@corp.com"}, MaxTTLSeconds: 3600, DailySendCap: 3}
+	srv, _ := newServer(t, p, filepath.Join(t.TempDir(), policy.UsageFileName), Options{})
+	s := start(t, srv)
+	if result := s.call("send_secret", map[string]any{"recipient": "alice@corp.com", "secret": "hunter2", "ttl_seconds": 60}); result.IsError {
+		t.Fatalf("send_secret = %q", result.text())
+	}
+
+	result := s.call("get_policy", map[string]any{})
+	if result.IsError {
+		t.Fatalf("get_policy = %q", result.text())
+	}
+	var summary policy.Summary
+	data, _ := json.Marshal(result.StructuredContent)
+	if err := json.Unmarshal(data, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if !summary.RecipientsRestricted || summary.AllowedEmails[0] != "alice@corp.com" || summary.MaxTTLSeconds != 3600 ||
+		summary.SentToday != 1 || summary.RemainingToday == nil || *summary.RemainingToday != 2 {
+		t.Errorf("get_policy = %s", result.text())
+	}
+	if !strings.Contains(result.text(), `"remaining_today": 2`) {
+		t.Errorf("get_policy text = %s", result.text())
+	}
+}
+
+func TestSendSecret_Confirmation(t *testing.T) {
+	accept := map[string]any{"action": "accept", "content": map[string]any{"confirm": true}}
+	tests := []struct {
+		name   string
+		answer any // nil leaves the elicitation unanswered
+		want   string
+	}{
+		{"approve", accept, ""},
+		{"unchecked", map[string]any{"action": "accept", "content": map[string]any{"confirm": false}}, "the user declined"},
+		{"decline", map[string]any{"action": "decline"}, "the user declined"},
+		{"cancel", map[string]any{"action": "cancel"}, "the user declined"},
+		{"timeout", nil, "not confirmed in time"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, api := newServer(t, &policy.Policy{DailySendCap: 5}, filepath.Join(t.TempDir(), policy.UsageFileName),
+				Options{RequireConfirmation: true, ConfirmTimeout: 100 * time.Millisecond})
+			var asked []string
+			s := startEliciting(t, srv, func(message string) any {
+				asked = append(asked, message)
+				return tt.answer
+			})
+
+			result := s.call("send_secret", map[string]any{"recipient": "alice@corp.com", "secret": "hunter2", "ttl_seconds": 600})
+			if len(asked) != 1 {
+				t.Fatalf("the client was asked %d times, want once", len(asked))
+			}
+			if !strings.Contains(asked[0], "alice@corp.com") || !strings.Contains(asked[0], `7 characters starting with "hu"`) ||
+				!strings.Contains(asked[0], "10m0s") || strings.Contains(asked[0], "hunter2") {
+				t.Errorf("elicitation message = %q", asked[0])
+			}
+
+			_, messages, _ := api.counts()
+			sent, _ := srv.counter.Sent(time.Now())
+			if tt.want == "" {
+				if result.IsError || messages != 1 || sent != 1 {
+					t.Fatalf("send_secret = %q, %d messages, %d counted", result.text(), messages, sent)
+				}
+			} else {
+				if !result.IsError || !strings.Contains(result.text(), tt.want) {
+					t.Errorf("send_secret = %q, want an error containing %q", result.text(), tt.want)
+				}
+				if messages != 0 || sent != 0 {
+					t.Errorf("an unconfirmed send stored %d messages and counted %d", messages, sent)
+				}
+			}
+			if srv.confirm.Pending() != 0 {
+				t.Errorf("%d sends still pending", srv.confirm.Pending())
+			}
+		})
+	}
+}
+
+func TestSendSecret_ConfirmationUnsupported(t *testing.T) {
+	srv, api := newServer(t, &policy.Policy{}, filepath.Join(t.TempDir(), policy.UsageFileName), Options{RequireConfirmation: true})
+	s := start(t, srv)
+
+	result := s.call("send_secret", map[string]any{"recipient": "alice@corp.com", "secret": "hunter2"})
+	if !result.IsError || !strings.Contains(result.text(), "vanish send <recipient>") {
+		t.Errorf("send_secret = %q, want a refusal pointing to the CLI", result.text())
+	}
+	if calls, _, _ := api.counts(); calls != 0 {
+		t.Errorf("an unconfirmable send made %d API calls", calls)
+	}
+}
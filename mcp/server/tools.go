@@ -0,0 +1,225 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zafrem/vanish/mcp/confirm"
+	"github.com/zafrem/vanish/mcp/policy"
+	"github.com/zafrem/vanish/shared/crypto"
+)
+
+// DefaultTTLSeconds is the TTL of a send_secret call without ttl_seconds,
+// the same as `vanish send`
+const DefaultTTLSeconds = 86400
+
+// tool describes a tool in tools/list
+type tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"inputSchema"`
+}
+
+var tools = []tool{
+	{
+		Name: "send_secret",
+		Description: "Encrypt a secret and send it to a Vanish user, who can read it once. " +
+			"The recipient is emailed the link; with link_only the link is returned instead. " +
+			"Call get_policy first to learn which recipients and TTLs are allowed.",
+		InputSchema: json.RawMessage(`{
+			"type": "object",
+			"properties": {
+				"recipient": {"type": "string", "description": "Email of the Vanish user who may read the secret"},
+				"secret": {"type": "string", "description": "The secret to send"},
+				"ttl_seconds": {"type": "integer", "minimum": 1, "description": "Seconds until the secret expires unread; defaults to 86400"},
+				"link_only": {"type": "boolean", "description": "Return the link instead of emailing it to the recipient"}
+			},
+			"required": ["recipient", "secret"]
+		}`),
+	},
+	{
+		Name:        "get_policy",
+		Description: "Report the limits on send_secret: allowed recipients, the maximum TTL, whether link-only messages are allowed and how many sends are left today.",
+		InputSchema: json.RawMessage(`{"type": "object", "properties": {}}`),
+	},
+}
+
+// toolResult answers tools/call. Failures the agent can act on, such as
+// policy violations, are results with IsError set rather than JSON-RPC
+// errors, so the agent sees the explanation
+type toolResult struct {
+	Content           []content `json:"content"`
+	StructuredContent any       `json:"structuredContent,omitempty"`
+	IsError           bool      `json:"isError,omitempty"`
+}
+
+type content struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+func textResult(text string) *toolResult {
+	return &toolResult{Content: []content{{Type: "text", Text: text}}}
+}
+
+func errorResult(err error) *toolResult {
+	result := textResult(err.Error())
+	result.IsError = true
+	return result
+}
+
+// callTool runs the tool named in params
+func (s *Server) callTool(ctx context.Context, params json.RawMessage) (*toolResult, *rpcError) {
+	var call struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &call); err != nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "invalid tools/call params: " + err.Error()}
+	}
+
+	switch call.Name {
+	case "send_secret":
+		return s.sendSecret(ctx, call.Arguments), nil
+	case "get_policy":
+		return s.getPolicy(), nil
+	default:
+		return nil, &rpcError{Code: codeInvalidParams, Message: "unknown tool: " + call.Name}
+	}
+}
+
+// sendSecretArgs are the arguments of send_secret
+type sendSecretArgs struct {
+	Recipient  string `json:"recipient"`
+	Secret     string `json:"secret"`
+	TTLSeconds int64  `json:"ttl_seconds"`
+	LinkOnly   bool   `json:"link_only"`
+}
+
+// sendSecret enforces the policy and the daily cap, and has a person
+// confirm the send when required, before it makes any API call. Then it
+// encrypts and sends the secret
+func (s *Server) sendSecret(ctx context.Context, raw json.RawMessage) *toolResult {
+	var args sendSecretArgs
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &args); err != nil {
+			return errorResult(fmt.Errorf("invalid arguments: %w", err))
+		}
+	}
+	if args.Recipient == "" || args.Secret == "" {
+		return errorResult(errors.New("recipient and secret are required"))
+	}
+	if args.TTLSeconds == 0 {
+		args.TTLSeconds = DefaultTTLSeconds
+	}
+	if args.TTLSeconds < 0 {
+		return errorResult(errors.New("ttl_seconds must be positive"))
+	}
+	ttl := time.Duration(args.TTLSeconds) * time.Second
+
+	if err := s.policy.Check(policy.Request{Recipient: args.Recipient, TTL: ttl, LinkOnly: args.LinkOnly}); err != nil {
+		return errorResult(err)
+	}
+	now := s.now()
+	if err := s.counter.Take(now); err != nil {
+		return errorResult(err)
+	}
+	if err := s.confirmSend(ctx, args, ttl); err != nil {
+		_ = s.counter.Release(now)
+		return errorResult(err)
+	}
+
+	result, err := s.send(ctx, args)
+	if err != nil {
+		// Nothing was sent, so the send does not count against the cap
+		_ = s.counter.Release(now)
+		return errorResult(fmt.Errorf("failed to send the secret: %w", err))
+	}
+	return result
+}
+
+// confirmIDPrefix starts the IDs of confirmation requests; the pending
+// send's token follows
+const confirmIDPrefix = "confirm-"
+
+// confirmSchema is the form of a confirmation request: one checkbox
+var confirmSchema = json.RawMessage(`{
+	"type": "object",
+	"properties": {
+		"confirm": {"type": "boolean", "title": "Send the secret"}
+	},
+	"required": ["confirm"]
+}`)
+
+// confirmSend asks the client to have a person approve the send and waits
+// for the answer. It returns nil at once when confirmation is off, and
+// confirm.ErrUnsupported for clients that cannot elicit
+func (s *Server) confirmSend(ctx context.Context, args sendSecretArgs, ttl time.Duration) error {
+	if s.confirm == nil {
+		return nil
+	}
+	s.mu.Lock()
+	elicitation := s.elicitation
+	s.mu.Unlock()
+	if !elicitation {
+		return confirm.ErrUnsupported
+	}
+
+	action := confirm.Action{Recipient: args.Recipient, TTL: ttl, Preview: confirm.Redact(args.Secret)}
+	token, err := s.confirm.Begin(action)
+	if err != nil {
+		return err
+	}
+	s.write(request{JSONRPC: "2.0", ID: confirmIDPrefix + token, Method: "elicitation/create", Params: map[string]any{
+		"message":         action.Message(),
+		"requestedSchema": confirmSchema,
+	}})
+	return s.confirm.Wait(ctx, token)
+}
+
+// send encrypts and stores the secret, then emails the recipient the link
+// or, for link_only, returns it. An error means nothing was stored
+func (s *Server) send(ctx context.Context, args sendSecretArgs) (*toolResult, error) {
+	recipient, err := s.api.FindUserContext(ctx, args.Recipient)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := crypto.EncryptSecret(args.Secret)
+	if err != nil {
+		return nil, err
+	}
+	url, created, err := s.api.SendScheduledMessageContext(ctx, recipient.ID, recipient.PublicKey, encrypted, args.TTLSeconds, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	expires := created.ExpiresAt.Format(time.RFC3339)
+	if args.LinkOnly {
+		return textResult(fmt.Sprintf("Created a secret for %s that expires at %s. "+
+			"Hand them this link; it opens once: %s", recipient.Email, expires, url)), nil
+	}
+	// The secret is stored, so the send counts even if the email fails
+	if err := s.api.SendEmailNotification(recipient.ID, url); err != nil {
+		return errorResult(fmt.Errorf("the secret was stored as message %s but %s was not notified: %w; "+
+			"resend the notification with: vanish resend %s", created.ID, recipient.Email, err, created.ID)), nil
+	}
+	return textResult(fmt.Sprintf("Sent the secret to %s, who was emailed the link. It expires at %s.", recipient.Email, expires)), nil
+}
+
+// getPolicy reports the policy and what is left of today's cap
+func (s *Server) getPolicy() *toolResult {
+	summary, err := policy.Summarize(s.policy, s.counter, s.now())
+	if err != nil {
+		return errorResult(err)
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return errorResult(err)
+	}
+	result := textResult(string(data))
+	result.StructuredContent = summary
+	return result
+}
@@ -2,82 +2,171 @@ package client
 
 import (
 	"bytes"
+	"context"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/zafrem/vanish/shared/config"
 )
 
+const (
+	// APIVersion is the API version this client speaks
+	APIVersion = "v1"
+
+	// apiVersionHeader is set by servers that mount the versioned API
+	apiVersionHeader = "X-Vanish-API-Version"
+
+	// requestIDHeader correlates a call with server-side logs
+	requestIDHeader = "X-Request-ID"
+
+	// Headers describing a burned message, or why one can no longer be read
+	messageIDHeader     = "X-Vanish-Message-Id"
+	readAtHeader        = "X-Vanish-Read-At"
+	messageStatusHeader = "X-Vanish-Status"
+
+	// clientHeader names the program calling the server; see Options.Kind
+	clientHeader = "X-Vanish-Client"
+
+	legacyAPIPrefix    = "/api/"
+	versionedAPIPrefix = "/api/" + APIVersion + "/"
+)
+
+// Values of Options.Kind for the programs built on this package
+const (
+	KindCLI = "cli"
+	KindMCP = "mcp"
+)
+
 // Client provides HTTP client functionality for Vanish API
 type Client struct {
 	config     *config.Config
 	httpClient *http.Client
+	kind       string // X-Vanish-Client value; empty to omit
+
+	// legacyAPI is set once the server is found not to serve /api/v1
+	legacyAPI atomic.Bool
 }
 
 // NewClient creates a new API client with the given configuration
+// It uses the default transport settings; see NewClientWithOptions for
+// custom CAs, mutual TLS and proxies
 func NewClient(cfg *config.Config) *Client {
-	return &Client{
-		config: cfg,
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+	c, _ := NewClientWithOptions(cfg, Options{})
+	return c
+}
+
+// NewClientWithOptions creates a new API client that connects as described
+// by opts. It fails when a CA bundle or client certificate cannot be loaded
+func NewClientWithOptions(cfg *config.Config, opts Options) (*Client, error) {
+	httpClient, err := NewHTTPClient(opts, 30*time.Second)
+	if err != nil {
+		return nil, err
 	}
+
+	return &Client{
+		config:     cfg,
+		httpClient: httpClient,
+		kind:       opts.Kind,
+	}, nil
 }
 
 // doRequest performs an HTTP request with authentication
+// API paths are sent under /api/v1 first, falling back to the unversioned
+// /api prefix when the server predates API versioning
 func (c *Client) doRequest(method, path string, body interface{}) (*http.Response, error) {
-	var reqBody io.Reader
+	return c.doRequestContext(context.Background(), method, path, body)
+}
+
+// doRequestContext is doRequest bound to ctx, which cancels the request
+func (c *Client) doRequestContext(ctx context.Context, method, path string, body interface{}) (*http.Response, error) {
+	var jsonData []byte
 	if body != nil {
-		jsonData, err := json.Marshal(body)
+		var err error
+		jsonData, err = json.Marshal(body)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal request body: %w", err)
 		}
-		reqBody = bytes.NewBuffer(jsonData)
 	}
 
 	// Normalize path
-	path = strings.TrimPrefix(path, "/")
-	url := fmt.Sprintf("%s/%s", c.config.BaseURL, path)
+	path = "/" + strings.TrimPrefix(path, "/")
 
-	req, err := http.NewRequest(method, url, reqBody)
+	if strings.HasPrefix(path, legacyAPIPrefix) && !c.legacyAPI.Load() {
+		versioned := versionedAPIPrefix + strings.TrimPrefix(path, legacyAPIPrefix)
+		resp, err := c.send(ctx, method, versioned, jsonData)
+		if err != nil {
+			return nil, err
+		}
+
+		// A versioned server always sets the version header, even on 404
+		if resp.StatusCode != http.StatusNotFound || resp.Header.Get(apiVersionHeader) != "" {
+			return resp, nil
+		}
+
+		// Older server: remember and retry on the unversioned prefix
+		resp.Body.Close()
+		c.legacyAPI.Store(true)
+	}
+
+	return c.send(ctx, method, path, jsonData)
+}
+
+// send issues a single request to path with an optional JSON body
+func (c *Client) send(ctx context.Context, method, path string, jsonData []byte) (*http.Response, error) {
+	var reqBody io.Reader
+	if jsonData != nil {
+		reqBody = bytes.NewReader(jsonData)
+	}
+
+	url := c.config.BaseURL + path
+
+	req, err := http.NewRequestWithContext(ctx, method, url, reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set headers
 	req.Header.Set("Authorization", "Bearer "+c.config.Token)
-	if body != nil {
+	req.Header.Set("Accept-Version", APIVersion)
+	req.Header.Set(requestIDHeader, newRequestID())
+	if c.kind != "" {
+		req.Header.Set(clientHeader, c.kind)
+	}
+	if jsonData != nil {
 		req.Header.Set("Content-Type", "application/json")
 	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %w", err)
+		return nil, connectionError(err)
 	}
 
 	return resp, nil
 }
 
-// handleError processes error responses from the API
-func handleError(resp *http.Response) error {
-	body, _ := io.ReadAll(resp.Body)
-
-	switch resp.StatusCode {
-	case http.StatusUnauthorized:
-		return fmt.Errorf("authentication failed: invalid or expired token. Run 'vanish config' to update credentials")
-	case http.StatusForbidden:
-		return fmt.Errorf("access denied: you don't have permission for this resource")
-	case http.StatusNotFound:
-		return fmt.Errorf("resource not found: %s", string(body))
-	case http.StatusBadRequest:
-		return fmt.Errorf("invalid request: %s", string(body))
-	case http.StatusInternalServerError:
-		return fmt.Errorf("server error: please try again later")
-	default:
-		return fmt.Errorf("unexpected error (status %d): %s", resp.StatusCode, string(body))
+// newRequestID generates a random (version 4) UUID for X-Request-ID
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// requestID returns the correlation ID of a response, preferring the
+// server's echo over the ID this client sent
+func requestID(resp *http.Response) string {
+	if id := resp.Header.Get(requestIDHeader); id != "" {
+		return id
+	}
+	if resp.Request != nil {
+		return resp.Request.Header.Get(requestIDHeader)
 	}
+	return ""
 }
@@ -0,0 +1,155 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zafrem/vanish/shared/models"
+)
+
+// APIError is an error response from the server
+// Callers should branch on Code (a models.ErrorCode* value) with
+// ErrorCode rather than on the text, which is worded for people
+type APIError struct {
+	StatusCode int
+	Code       string // empty for servers that predate error codes
+	Message    string // the server's own message, or the raw body
+	RequestID  string
+
+	// MessageStatus tells why a message can no longer be read (read,
+	// expired or revoked) on 404 and 410; "" when the server did not say
+	MessageStatus models.MessageStatus
+	// ReadAt is when a message was read, with ErrorCodeMessageAlreadyRead,
+	// and ExpiresAt when it expired, with ErrorCodeMessageExpired; nil from
+	// servers that do not say
+	ReadAt    *time.Time
+	ExpiresAt *time.Time
+
+	text string // user-facing description
+}
+
+// Error describes the failure and quotes the request ID so users can pass
+// it to administrators
+func (e *APIError) Error() string {
+	if e.RequestID != "" {
+		return fmt.Sprintf("%s (request ID: %s)", e.text, e.RequestID)
+	}
+	return e.text
+}
+
+// ErrorCode returns the API error code carried by err, or "" when err is
+// not an API error or the server sent no code
+func ErrorCode(err error) string {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return ""
+}
+
+// timeLayout words the times in error descriptions, e.g. "on Mar 12 09:41"
+const timeLayout = "on Jan 2 15:04"
+
+// handleError processes error responses from the API
+func handleError(resp *http.Response) error {
+	return newAPIError(resp, "")
+}
+
+// handleMessageError is handleError for endpoints addressing one message
+// Servers that predate error codes answer a burned message with a bare 404
+// or 410, which is mapped to the codes newer servers send
+func handleMessageError(resp *http.Response) error {
+	legacy := ""
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		legacy = models.ErrorCodeMessageNotFound
+	case http.StatusGone:
+		legacy = models.ErrorCodeMessageAlreadyRead
+	}
+	return newAPIError(resp, legacy)
+}
+
+// newAPIError reads an error response; legacyCode is used when the body
+// carries no code
+func newAPIError(resp *http.Response, legacyCode string) *APIError {
+	body, _ := io.ReadAll(resp.Body)
+
+	e := &APIError{
+		StatusCode: resp.StatusCode,
+		Code:       legacyCode,
+		Message:    strings.TrimSpace(string(body)),
+		RequestID:  requestID(resp),
+
+		MessageStatus: models.MessageStatus(resp.Header.Get(messageStatusHeader)),
+	}
+	var parsed models.MessageGoneResponse
+	if json.Unmarshal(body, &parsed) == nil && parsed.Error != "" {
+		e.Message = parsed.Error
+		if parsed.Code != "" {
+			e.Code = parsed.Code
+		}
+		e.ReadAt, e.ExpiresAt = parsed.ReadAt, parsed.ExpiresAt
+	}
+	e.text = describe(e, resp.Header.Get("Retry-After"))
+	return e
+}
+
+// describe words an API error for users, by code when the server sent one
+// and by status otherwise
+func describe(e *APIError, retryAfter string) string {
+	switch e.Code {
+	case models.ErrorCodeUnauthorized, models.ErrorCodeAccountInactive:
+		return "authentication failed: invalid or expired token. Run 'vanish config' to update credentials"
+	case models.ErrorCodeInvalidCredentials:
+		return "authentication failed: invalid email or password"
+	case models.ErrorCodeMessageNotFound:
+		return "message not found or already burned"
+	case models.ErrorCodeMessageAlreadyRead:
+		if e.ReadAt != nil {
+			return "message already burned: it was read " + e.ReadAt.Local().Format(timeLayout)
+		}
+		return "message already burned: it was read"
+	case models.ErrorCodeMessageExpired:
+		if e.ExpiresAt != nil {
+			return "message expired unread " + e.ExpiresAt.Local().Format(timeLayout)
+		}
+		return "message expired before it was read"
+	case models.ErrorCodeMessageRevoked:
+		return "message was revoked before it was read"
+	case models.ErrorCodeNotRecipient:
+		return "access denied: this message was sent to someone else"
+	case models.ErrorCodeMessageClaimed:
+		return "message is being retrieved elsewhere; try again in a minute"
+	case models.ErrorCodeRecipientInboxFull:
+		return fmt.Sprintf("recipient's inbox is full: %s", e.Message)
+	case models.ErrorCodeUpstreamFailed:
+		return fmt.Sprintf("integration error: %s", e.Message)
+	case models.ErrorCodeTTLOutOfRange, models.ErrorCodeValidationFailed, models.ErrorCodeInvalidRequest:
+		return fmt.Sprintf("invalid request: %s", e.Message)
+	}
+
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		return "authentication failed: invalid or expired token. Run 'vanish config' to update credentials"
+	case http.StatusForbidden:
+		return "access denied: you don't have permission for this resource"
+	case http.StatusNotFound:
+		return fmt.Sprintf("resource not found: %s", e.Message)
+	case http.StatusBadRequest:
+		return fmt.Sprintf("invalid request: %s", e.Message)
+	case http.StatusTooManyRequests:
+		if retryAfter != "" {
+			return fmt.Sprintf("rate limited: try again in %s seconds", retryAfter)
+		}
+		return "rate limited: please try again later"
+	case http.StatusInternalServerError:
+		return "server error: please try again later"
+	default:
+		return fmt.Sprintf("unexpected error (status %d): %s", e.StatusCode, e.Message)
+	}
+}
@@ -1,9 +1,12 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/zafrem/vanish/shared/models"
 )
@@ -11,12 +14,32 @@ import (
 // GetMessageHistory retrieves the message history for the authenticated user
 // limit: maximum number of messages to return (default: 50)
 func (c *Client) GetMessageHistory(limit int) ([]models.MessageHistoryResponse, error) {
+	return c.GetMessageHistoryContext(context.Background(), limit)
+}
+
+// GetMessageHistoryContext is GetMessageHistory bound to ctx
+func (c *Client) GetMessageHistoryContext(ctx context.Context, limit int) ([]models.MessageHistoryResponse, error) {
+	return c.SearchMessageHistoryContext(ctx, "", limit)
+}
+
+// SearchMessageHistory retrieves the messages of the authenticated user's
+// history whose counterpart's name or email, or whose category, contains
+// query, ignoring case. An empty query lists the whole history
+func (c *Client) SearchMessageHistory(query string, limit int) ([]models.MessageHistoryResponse, error) {
+	return c.SearchMessageHistoryContext(context.Background(), query, limit)
+}
+
+// SearchMessageHistoryContext is SearchMessageHistory bound to ctx
+func (c *Client) SearchMessageHistoryContext(ctx context.Context, query string, limit int) ([]models.MessageHistoryResponse, error) {
 	if limit <= 0 {
 		limit = 50
 	}
 
-	path := fmt.Sprintf("/api/history?limit=%d", limit)
-	resp, err := c.doRequest("GET", path, nil)
+	params := url.Values{"limit": {strconv.Itoa(limit)}}
+	if query != "" {
+		params.Set("q", query)
+	}
+	resp, err := c.doRequestContext(ctx, "GET", "/api/history?"+params.Encode(), nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get message history: %w", err)
 	}
@@ -26,10 +49,43 @@ func (c *Client) GetMessageHistory(limit int) ([]models.MessageHistoryResponse,
 		return nil, handleError(resp)
 	}
 
+	// The server returns a bare array; the wrapped HistoryResponse form is
+	// still accepted
+	var body json.RawMessage
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, fmt.Errorf("failed to decode history response: %w", err)
+	}
+
+	var messages []models.MessageHistoryResponse
+	if err := json.Unmarshal(body, &messages); err == nil {
+		return messages, nil
+	}
+
 	var history models.HistoryResponse
-	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+	if err := json.Unmarshal(body, &history); err != nil {
 		return nil, fmt.Errorf("failed to decode history response: %w", err)
 	}
 
 	return history.Messages, nil
 }
+
+// GetInbox lists the pending messages addressed to the authenticated user,
+// soonest to expire first
+func (c *Client) GetInbox() ([]models.InboxMessage, error) {
+	resp, err := c.doRequest("GET", "/api/inbox", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inbox: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, handleError(resp)
+	}
+
+	var inbox []models.InboxMessage
+	if err := json.NewDecoder(resp.Body).Decode(&inbox); err != nil {
+		return nil, fmt.Errorf("failed to decode inbox response: %w", err)
+	}
+
+	return inbox, nil
+}
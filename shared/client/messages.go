@@ -1,10 +1,12 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"time"
 
 	"github.com/zafrem/vanish/shared/crypto"
 	"github.com/zafrem/vanish/shared/models"
@@ -13,15 +15,30 @@ import (
 // SendMessage sends an encrypted message to the API
 // Returns the message URL and response
 func (c *Client) SendMessage(recipientID int64, encrypted *crypto.EncryptedMessage, ttl int64) (string, *models.CreateMessageResponse, error) {
-	payload := models.CreateMessageRequest{
-		Ciphertext:    encrypted.Ciphertext,
-		IV:            encrypted.IV,
-		RecipientID:   recipientID,
-		EncryptionKey: encrypted.Key,
-		TTL:           ttl,
+	return c.SendSealedMessage(recipientID, "", encrypted, ttl)
+}
+
+// SendSealedMessage sends an encrypted message whose key is sealed to the
+// recipient's public key, so the server never stores it in plaintext
+// An empty recipientPublicKey falls back to storing the key like SendMessage
+func (c *Client) SendSealedMessage(recipientID int64, recipientPublicKey string, encrypted *crypto.EncryptedMessage, ttl int64) (string, *models.CreateMessageResponse, error) {
+	return c.SendScheduledMessage(recipientID, recipientPublicKey, encrypted, ttl, time.Time{})
+}
+
+// SendScheduledMessage sends a message the recipient cannot open before
+// availableAt; its TTL counts from then. A zero availableAt sends it now
+func (c *Client) SendScheduledMessage(recipientID int64, recipientPublicKey string, encrypted *crypto.EncryptedMessage, ttl int64, availableAt time.Time) (string, *models.CreateMessageResponse, error) {
+	return c.SendScheduledMessageContext(context.Background(), recipientID, recipientPublicKey, encrypted, ttl, availableAt)
+}
+
+// SendScheduledMessageContext is SendScheduledMessage bound to ctx
+func (c *Client) SendScheduledMessageContext(ctx context.Context, recipientID int64, recipientPublicKey string, encrypted *crypto.EncryptedMessage, ttl int64, availableAt time.Time) (string, *models.CreateMessageResponse, error) {
+	payload, err := createRequest(recipientID, recipientPublicKey, encrypted, ttl, availableAt)
+	if err != nil {
+		return "", nil, err
 	}
 
-	resp, err := c.doRequest("POST", "/api/messages", payload)
+	resp, err := c.doRequestContext(ctx, "POST", "/api/messages", payload)
 	if err != nil {
 		return "", nil, fmt.Errorf("failed to send message: %w", err)
 	}
@@ -43,6 +60,158 @@ func (c *Client) SendMessage(recipientID int64, encrypted *crypto.EncryptedMessa
 	return url, &result, nil
 }
 
+// ErrDryRunUnsupported is returned by DryRunMessage when the server
+// ignored the dry run and stored the message
+var ErrDryRunUnsupported = errors.New("the server does not support dry runs")
+
+// DryRunMessage has the server validate a message as SendScheduledMessage
+// would send it - TTL, schedule, size, recipient and their unread quota -
+// without storing it or notifying anyone. The returned ID is synthetic
+func (c *Client) DryRunMessage(recipientID int64, recipientPublicKey string, encrypted *crypto.EncryptedMessage, ttl int64, availableAt time.Time) (*models.CreateMessageResponse, error) {
+	payload, err := createRequest(recipientID, recipientPublicKey, encrypted, ttl, availableAt)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.doRequest("POST", "/api/messages?dry_run=true", payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, handleError(resp)
+	}
+
+	var result models.CreateMessageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if resp.StatusCode == http.StatusCreated || !result.DryRun {
+		// An older server created a real message; say so, it expires on its own
+		return nil, fmt.Errorf("%w: message %s was created and expires at %s",
+			ErrDryRunUnsupported, result.ID, result.ExpiresAt.Local().Format(time.RFC1123))
+	}
+	return &result, nil
+}
+
+// createRequest builds the request for one message, sealing the key when the
+// recipient has a public key. A ttl of 0 omits the TTL so the server applies
+// its default, or the category's
+func createRequest(recipientID int64, recipientPublicKey string, encrypted *crypto.EncryptedMessage, ttl int64, availableAt time.Time) (models.CreateMessageRequest, error) {
+	req := models.CreateMessageRequest{
+		Ciphertext:      encrypted.Ciphertext,
+		IV:              encrypted.IV,
+		RecipientID:     recipientID,
+		ContentEncoding: encrypted.ContentEncoding,
+	}
+	if ttl != 0 {
+		req.TTL = &ttl
+	}
+	if !availableAt.IsZero() {
+		req.AvailableAt = &availableAt
+	}
+	if recipientPublicKey == "" {
+		req.EncryptionKey = encrypted.Key
+		return req, nil
+	}
+
+	sealed, err := crypto.SealForRecipient(encrypted.Key, recipientPublicKey)
+	if err != nil {
+		return req, fmt.Errorf("failed to seal key for recipient %d: %w", recipientID, err)
+	}
+	req.SealedKey = sealed
+	return req, nil
+}
+
+// MaxBulkMessages is the largest batch SendMessages accepts
+const MaxBulkMessages = 50
+
+// OutgoingMessage is one item for SendMessages
+type OutgoingMessage struct {
+	RecipientID int64
+	Encrypted   *crypto.EncryptedMessage
+	TTL         int64
+
+	// RecipientPublicKey seals the key to the recipient when set
+	RecipientPublicKey string
+
+	// AvailableAt schedules the message when set
+	AvailableAt time.Time
+}
+
+// SendResult is the outcome of one item sent with SendMessages
+// Err is set when the server rejected the item; URL is set otherwise
+type SendResult struct {
+	URL       string
+	ID        string
+	ExpiresAt time.Time
+	Err       error
+}
+
+// SendMessages sends up to MaxBulkMessages encrypted messages in one call
+// Items succeed or fail independently: the returned error covers only the
+// whole batch (transport, auth, oversized batch), while per-item failures
+// are reported in the matching SendResult
+func (c *Client) SendMessages(messages []OutgoingMessage) ([]SendResult, error) {
+	if len(messages) == 0 || len(messages) > MaxBulkMessages {
+		return nil, fmt.Errorf("a batch must contain between 1 and %d messages", MaxBulkMessages)
+	}
+
+	payload := models.BulkCreateMessageRequest{Messages: make([]models.CreateMessageRequest, len(messages))}
+	for i, m := range messages {
+		req, err := createRequest(m.RecipientID, m.RecipientPublicKey, m.Encrypted, m.TTL, m.AvailableAt)
+		if err != nil {
+			return nil, err
+		}
+		payload.Messages[i] = req
+	}
+
+	resp, err := c.doRequest("POST", "/api/messages/bulk", payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send messages: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, handleError(resp)
+	}
+
+	var result models.BulkCreateMessageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	results := make([]SendResult, len(messages))
+	for i := range results {
+		results[i].Err = fmt.Errorf("no result returned for this message")
+	}
+	for _, r := range result.Results {
+		if r.Index < 0 || r.Index >= len(messages) {
+			continue
+		}
+		if r.Status != http.StatusCreated {
+			results[r.Index] = SendResult{Err: &APIError{
+				StatusCode: r.Status,
+				Code:       r.Code,
+				Message:    r.Error,
+				text:       fmt.Sprintf("%s (status %d)", r.Error, r.Status),
+			}}
+			continue
+		}
+		sent := SendResult{
+			ID:  r.ID,
+			URL: fmt.Sprintf("%s/m/%s#%s", c.config.BaseURL, r.ID, messages[r.Index].Encrypted.Key),
+		}
+		if r.ExpiresAt != nil {
+			sent.ExpiresAt = *r.ExpiresAt
+		}
+		results[r.Index] = sent
+	}
+
+	return results, nil
+}
+
 // CheckMessageStatus checks if a message exists (pending) or has been burned (read/expired)
 // Uses HEAD request to minimize data transfer
 func (c *Client) CheckMessageStatus(messageID string) (models.MessageStatus, error) {
@@ -64,48 +233,164 @@ func (c *Client) CheckMessageStatus(messageID string) (models.MessageStatus, err
 	}
 }
 
+// GetMessagePreview describes a message without burning it
+// Call it before GetMessage to let the recipient confirm the one-time read
+func (c *Client) GetMessagePreview(messageID string) (*models.MessagePreviewResponse, error) {
+	resp, err := c.doRequest("GET", fmt.Sprintf("/api/messages/%s/preview", messageID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to preview message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, handleMessageError(resp)
+	}
+
+	var preview models.MessagePreviewResponse
+	if err := json.NewDecoder(resp.Body).Decode(&preview); err != nil {
+		return nil, fmt.Errorf("failed to decode preview response: %w", err)
+	}
+
+	return &preview, nil
+}
+
 // GetMessage retrieves a message by ID
-// Note: This burns the message (one-time read)
+// Note: This burns the message (one-time read). When it is gone, the
+// *APIError's MessageStatus says whether it was read, expired or revoked
 func (c *Client) GetMessage(messageID string) (*models.MessageResponse, error) {
-	resp, err := c.doRequest("GET", fmt.Sprintf("/api/messages/%s", messageID), nil)
+	return c.GetMessageContext(context.Background(), messageID)
+}
+
+// GetMessageContext is GetMessage bound to ctx
+func (c *Client) GetMessageContext(ctx context.Context, messageID string) (*models.MessageResponse, error) {
+	resp, err := c.doRequestContext(ctx, "GET", fmt.Sprintf("/api/messages/%s", messageID), nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get message: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		if resp.StatusCode == http.StatusNotFound {
-			return nil, fmt.Errorf("message not found or already burned")
-		}
-		return nil, handleError(resp)
+		return nil, handleMessageError(resp)
 	}
 
 	var message models.MessageResponse
 	if err := json.NewDecoder(resp.Body).Decode(&message); err != nil {
 		return nil, fmt.Errorf("failed to decode message response: %w", err)
 	}
+	message.ID = resp.Header.Get(messageIDHeader)
+	if readAt, err := time.Parse(time.RFC3339, resp.Header.Get(readAtHeader)); err == nil {
+		message.ReadAt = readAt
+	}
 
 	return &message, nil
 }
 
+// GetMessageStatus reports what happened to a message the caller sent or
+// received - pending, claimed, read, expired or revoked - without burning it
+func (c *Client) GetMessageStatus(messageID string) (*models.MessageStatusResponse, error) {
+	return c.GetMessageStatusContext(context.Background(), messageID)
+}
+
+// GetMessageStatusContext is GetMessageStatus bound to ctx
+func (c *Client) GetMessageStatusContext(ctx context.Context, messageID string) (*models.MessageStatusResponse, error) {
+	resp, err := c.doRequestContext(ctx, "GET", fmt.Sprintf("/api/messages/%s/status", messageID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message status: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, handleMessageError(resp)
+	}
+
+	var status models.MessageStatusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("failed to decode status response: %w", err)
+	}
+
+	return &status, nil
+}
+
+// RevokeMessage burns a message the caller sent before it is read
+func (c *Client) RevokeMessage(messageID string) error {
+	return c.RevokeMessageContext(context.Background(), messageID)
+}
+
+// RevokeMessageContext is RevokeMessage bound to ctx
+func (c *Client) RevokeMessageContext(ctx context.Context, messageID string) error {
+	resp, err := c.doRequestContext(ctx, "DELETE", fmt.Sprintf("/api/messages/%s", messageID), nil)
+	if err != nil {
+		return fmt.Errorf("failed to revoke message: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return handleMessageError(resp)
+	}
+	return nil
+}
+
+// ResendNotification asks the server to notify the recipient of a pending
+// message again, and returns the channel it used. Only the sender may
+// resend, at most once every ten minutes per message
+func (c *Client) ResendNotification(messageID string) (string, error) {
+	resp, err := c.doRequest("POST", fmt.Sprintf("/api/messages/%s/resend-notification", messageID), nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to resend notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", handleMessageError(resp)
+	}
+
+	var result models.ResendNotificationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode resend response: %w", err)
+	}
+
+	return result.Channel, nil
+}
+
+// ErrNotificationDisabled is returned when the server has a notification
+// channel turned off, so callers can tell "not configured" from a failure
+var ErrNotificationDisabled = errors.New("not enabled on the server")
+
 // SendSlackNotification sends a Slack notification to the recipient
 // This is a best-effort operation - errors are non-fatal
 func (c *Client) SendSlackNotification(recipientID int64, messageURL string) error {
+	return c.sendNotification("slack", recipientID, messageURL)
+}
+
+// SendEmailNotification emails the recipient a link to the message
+// This is a best-effort operation - errors are non-fatal
+func (c *Client) SendEmailNotification(recipientID int64, messageURL string) error {
+	return c.sendNotification("email", recipientID, messageURL)
+}
+
+// sendNotification asks the server to notify the recipient over channel
+func (c *Client) sendNotification(channel string, recipientID int64, messageURL string) error {
 	payload := map[string]interface{}{
 		"recipient_id": recipientID,
 		"message_url":  messageURL,
 	}
 
-	resp, err := c.doRequest("POST", "/api/notifications/send-slack", payload)
+	resp, err := c.doRequest("POST", "/api/notifications/send-"+channel, payload)
 	if err != nil {
-		return fmt.Errorf("failed to send Slack notification: %w", err)
+		return fmt.Errorf("failed to send %s notification: %w", channel, err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("slack notification failed (status %d): %s", resp.StatusCode, string(body))
+	// 202: the message is scheduled and the server sends it at release
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusAccepted {
+		return nil
 	}
 
-	return nil
+	apiErr := newAPIError(resp, "")
+	// Servers without error codes use a bare 503 for a disabled channel
+	if apiErr.Code == models.ErrorCodeIntegrationDisabled ||
+		(apiErr.Code == "" && apiErr.StatusCode == http.StatusServiceUnavailable) {
+		return fmt.Errorf("%s notifications are %w", channel, ErrNotificationDisabled)
+	}
+	return fmt.Errorf("%s notification failed: %w", channel, apiErr)
 }
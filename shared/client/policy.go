@@ -0,0 +1,30 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/zafrem/vanish/shared/models"
+)
+
+// GetSenderPolicy returns the banned recipient domains and the DLP patterns
+// to check a secret against before encrypting it
+func (c *Client) GetSenderPolicy() (*models.SenderPolicy, error) {
+	resp, err := c.doRequest("GET", "/api/policy", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sender policy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, handleError(resp)
+	}
+
+	var policy models.SenderPolicy
+	if err := json.NewDecoder(resp.Body).Decode(&policy); err != nil {
+		return nil, fmt.Errorf("failed to decode sender policy: %w", err)
+	}
+
+	return &policy, nil
+}
@@ -0,0 +1,51 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// SetPublicKey uploads the user's X25519 public key so senders can seal link
+// keys to it. An empty key removes it
+func (c *Client) SetPublicKey(publicKey string) error {
+	resp, err := c.doRequest("PUT", "/api/profile/publickey", map[string]string{"public_key": publicKey})
+	if err != nil {
+		return fmt.Errorf("failed to set public key: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return handleError(resp)
+	}
+
+	return nil
+}
+
+// ExportData downloads everything the server stores about the authenticated
+// user as a JSON document. The server allows one export per hour
+func (c *Client) ExportData() ([]byte, error) {
+	resp, err := c.doRequest("GET", "/api/profile/export", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export data: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, handleError(resp)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read export: %w", err)
+	}
+
+	// The server streams the export, so a failure part way through shows up
+	// as a truncated document rather than an error status
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("export was interrupted; please try again later")
+	}
+
+	return data, nil
+}
@@ -0,0 +1,163 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/zafrem/vanish/shared/config"
+)
+
+// Options configures how the client connects to the server
+type Options struct {
+	// CABundle is a PEM file of CA certificates trusted in addition to the
+	// system roots, for servers with certificates from an internal CA
+	CABundle string
+
+	// ClientCert and ClientKey are PEM files presented for mutual TLS
+	ClientCert string
+	ClientKey  string
+
+	// Proxy is an explicit proxy URL. When empty, HTTP_PROXY, HTTPS_PROXY
+	// and NO_PROXY from the environment are used
+	Proxy string
+
+	// Kind is sent as X-Vanish-Client so the server records which program
+	// created a message, e.g. KindCLI; empty leaves the header out
+	Kind string
+}
+
+// OptionsFromConfig returns the connection settings saved in cfg
+func OptionsFromConfig(cfg *config.Config) Options {
+	return Options{
+		CABundle:   cfg.CABundle,
+		ClientCert: cfg.ClientCert,
+		ClientKey:  cfg.ClientKey,
+		Proxy:      cfg.Proxy,
+	}
+}
+
+// NewHTTPClient returns a plain HTTP client that connects as described by
+// opts, for downloads that must use the same proxy and CA settings as the API
+func NewHTTPClient(opts Options, timeout time.Duration) (*http.Client, error) {
+	transport, err := newTransport(opts)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// newTransport builds an HTTP transport for opts
+// The zero Options never fail and behave like http.DefaultTransport
+func newTransport(opts Options) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	transport.Proxy = http.ProxyFromEnvironment
+	if opts.Proxy != "" {
+		proxyURL, err := url.Parse(opts.Proxy)
+		if err != nil || proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", opts.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	// Surface a refused CONNECT as a typed error instead of the bare status text
+	transport.OnProxyConnectResponse = func(ctx context.Context, proxyURL *url.URL, req *http.Request, resp *http.Response) error {
+		if resp.StatusCode != http.StatusOK {
+			return &proxyError{proxy: proxyURL.Host, status: resp.Status}
+		}
+		return nil
+	}
+
+	if opts.CABundle == "" && opts.ClientCert == "" && opts.ClientKey == "" {
+		return transport, nil
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if opts.CABundle != "" {
+		pem, err := os.ReadFile(opts.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", opts.CABundle)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if opts.ClientCert != "" || opts.ClientKey != "" {
+		if opts.ClientCert == "" || opts.ClientKey == "" {
+			return nil, fmt.Errorf("client certificate and key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// proxyError is returned when the proxy refuses a CONNECT request
+type proxyError struct {
+	proxy  string
+	status string
+}
+
+func (e *proxyError) Error() string {
+	return fmt.Sprintf("proxy %s refused the connection: %s", e.proxy, e.status)
+}
+
+// IsConnectionError reports whether err is a request that never got an
+// answer from the server: DNS, TCP, TLS and proxy failures, and timeouts.
+// Errors the server answered with are *APIError instead
+func IsConnectionError(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// connectionError says whether a failed request was a proxy, TLS or DNS
+// problem, so users know which setting to look at
+func connectionError(err error) error {
+	var (
+		proxyErr    *proxyError
+		opErr       *net.OpError
+		dnsErr      *net.DNSError
+		verifyErr   *tls.CertificateVerificationError
+		authErr     x509.UnknownAuthorityError
+		hostErr     x509.HostnameError
+		recordErr   tls.RecordHeaderError
+		invalidCert x509.CertificateInvalidError
+	)
+
+	switch {
+	case errors.As(err, &proxyErr):
+		return fmt.Errorf("proxy error: %w", err)
+	case errors.As(err, &opErr) && opErr.Op == "proxyconnect":
+		return fmt.Errorf("proxy error: could not connect through the proxy: %w", err)
+	case errors.As(err, &dnsErr):
+		return fmt.Errorf("DNS error: could not resolve %s: %w", dnsErr.Name, err)
+	case errors.As(err, &verifyErr), errors.As(err, &authErr), errors.As(err, &hostErr),
+		errors.As(err, &invalidCert):
+		return fmt.Errorf("TLS error: server certificate not trusted (set %s for an internal CA): %w", config.EnvCABundle, err)
+	case errors.As(err, &opErr) && opErr.Op == "remote error", errors.As(err, &recordErr):
+		// "remote error" is a TLS alert from the server
+		return fmt.Errorf("TLS error: handshake failed (does the server require a client certificate?): %w", err)
+	default:
+		return fmt.Errorf("request failed: %w", err)
+	}
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,7 +13,12 @@ import (
 
 // ListUsers retrieves all users from the Vanish system
 func (c *Client) ListUsers() ([]models.User, error) {
-	resp, err := c.doRequest("GET", "/api/users", nil)
+	return c.ListUsersContext(context.Background())
+}
+
+// ListUsersContext is ListUsers bound to ctx
+func (c *Client) ListUsersContext(ctx context.Context) ([]models.User, error) {
+	resp, err := c.doRequestContext(ctx, "GET", "/api/users", nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list users: %w", err)
 	}
@@ -33,29 +39,49 @@ func (c *Client) ListUsers() ([]models.User, error) {
 // FindUserByEmail finds a user by their email address
 // Returns the user ID if found, error otherwise
 func (c *Client) FindUserByEmail(email string) (int64, error) {
-	resp, err := c.doRequest("GET", "/api/users", nil)
+	user, err := c.FindUser(email)
 	if err != nil {
-		return 0, fmt.Errorf("failed to fetch users: %w", err)
+		return 0, err
+	}
+	return user.ID, nil
+}
+
+// FindUser finds a user by their email address, including the public key
+// senders seal link keys to
+func (c *Client) FindUser(email string) (*models.User, error) {
+	return c.FindUserContext(context.Background(), email)
+}
+
+// FindUserContext is FindUser bound to ctx
+func (c *Client) FindUserContext(ctx context.Context, email string) (*models.User, error) {
+	resp, err := c.doRequestContext(ctx, "GET", "/api/users", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch users: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return 0, handleError(resp)
+		return nil, handleError(resp)
 	}
 
 	var users []models.User
 	if err := json.NewDecoder(resp.Body).Decode(&users); err != nil {
-		return 0, fmt.Errorf("failed to decode users response: %w", err)
+		return nil, fmt.Errorf("failed to decode users response: %w", err)
 	}
 
 	// Search for user with matching email (case-insensitive)
-	for _, u := range users {
-		if strings.EqualFold(u.Email, email) {
-			return u.ID, nil
+	for i := range users {
+		if strings.EqualFold(users[i].Email, email) {
+			return &users[i], nil
 		}
 	}
 
-	return 0, fmt.Errorf("user not found: %s", email)
+	// Matched here rather than by the server, but reported like its 404
+	return nil, &APIError{
+		StatusCode: http.StatusNotFound,
+		Code:       models.ErrorCodeUserNotFound,
+		text:       fmt.Sprintf("user not found: %s", email),
+	}
 }
 
 // GetUserByID retrieves a user by their ID
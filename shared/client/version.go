@@ -0,0 +1,38 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/zafrem/vanish/shared/models"
+)
+
+// ErrVersionUnavailable is returned by servers that predate GET /api/version
+var ErrVersionUnavailable = errors.New("server does not report its version")
+
+// GetServerVersion returns the server's release and the oldest client it
+// supports. The endpoint is unversioned, so it bypasses the /api/v1 prefix
+func (c *Client) GetServerVersion() (*models.ServerVersion, error) {
+	resp, err := c.send(context.Background(), "GET", "/api/version", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get server version: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrVersionUnavailable
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, handleError(resp)
+	}
+
+	var version models.ServerVersion
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+		return nil, fmt.Errorf("failed to decode version response: %w", err)
+	}
+
+	return &version, nil
+}
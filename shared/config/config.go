@@ -3,27 +3,72 @@ package config
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 )
 
+// Environment variables that override the connection settings in the file
+const (
+	EnvCABundle   = "VANISH_CA_BUNDLE"
+	EnvClientCert = "VANISH_CLIENT_CERT"
+	EnvClientKey  = "VANISH_CLIENT_KEY"
+)
+
+// EnvConfigDir overrides the directory of the config and identity files
+const EnvConfigDir = "VANISH_CONFIG_DIR"
+
 // Config represents the configuration for Vanish CLI and MCP server
 type Config struct {
 	BaseURL string `json:"base_url"`
 	Token   string `json:"token"`
+
+	// Connection settings for servers behind an internal CA, mutual TLS or
+	// a proxy. Without Proxy, HTTP_PROXY/HTTPS_PROXY/NO_PROXY apply
+	CABundle   string `json:"ca_bundle,omitempty"`   // PEM file of extra trusted CAs
+	ClientCert string `json:"client_cert,omitempty"` // PEM client certificate for mTLS
+	ClientKey  string `json:"client_key,omitempty"`  // PEM key for ClientCert
+	Proxy      string `json:"proxy,omitempty"`       // e.g. http://proxy.corp:3128
 }
 
-// GetConfigPath returns the path to the config file
-func GetConfigPath() (string, error) {
+// GetConfigDir returns the directory of the config and identity files:
+// VANISH_CONFIG_DIR when set, otherwise ~/.vanish. On Windows it is
+// %AppData%\Vanish, unless ~/.vanish was created by an earlier version
+func GetConfigDir() (string, error) {
+	if dir := os.Getenv(EnvConfigDir); dir != "" {
+		return filepath.Abs(dir)
+	}
+
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return "", fmt.Errorf("failed to get home directory: %w", err)
 	}
-	return filepath.Join(home, ".vanish", "config.json"), nil
+	legacy := filepath.Join(home, ".vanish")
+	if runtime.GOOS != "windows" {
+		return legacy, nil
+	}
+	if _, err := os.Stat(legacy); err == nil {
+		return legacy, nil
+	}
+	appData, err := os.UserConfigDir()
+	if err != nil {
+		return legacy, nil
+	}
+	return filepath.Join(appData, "Vanish"), nil
 }
 
-// LoadConfig loads the configuration from ~/.vanish/config.json
+// GetConfigPath returns the path to the config file
+func GetConfigPath() (string, error) {
+	dir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// LoadConfig loads the configuration from config.json in GetConfigDir
 func LoadConfig() (*Config, error) {
 	path, err := GetConfigPath()
 	if err != nil {
@@ -42,6 +87,7 @@ func LoadConfig() (*Config, error) {
 	if err := json.Unmarshal(data, &cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w. The file may be corrupted", err)
 	}
+	cfg.ApplyEnv()
 
 	// Validate config
 	if err := cfg.Validate(); err != nil {
@@ -51,7 +97,9 @@ func LoadConfig() (*Config, error) {
 	return &cfg, nil
 }
 
-// SaveConfig saves the configuration to ~/.vanish/config.json
+// SaveConfig saves the configuration to config.json in GetConfigDir,
+// readable only by the current user. Windows ignores the mode; the file
+// is protected by the ACL of the user's profile instead
 func SaveConfig(cfg *Config) error {
 	if cfg == nil {
 		return fmt.Errorf("config cannot be nil")
@@ -94,8 +142,32 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("token is required")
 	}
 
+	if (c.ClientCert == "") != (c.ClientKey == "") {
+		return fmt.Errorf("client_cert and client_key must be set together")
+	}
+
+	if c.Proxy != "" {
+		if u, err := url.Parse(c.Proxy); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("proxy must be a URL such as http://proxy.example.com:3128")
+		}
+	}
+
 	// Normalize BaseURL (remove trailing slash)
 	c.BaseURL = strings.TrimSuffix(c.BaseURL, "/")
 
 	return nil
 }
+
+// ApplyEnv overrides connection settings with VANISH_CA_BUNDLE,
+// VANISH_CLIENT_CERT and VANISH_CLIENT_KEY when they are set
+func (c *Config) ApplyEnv() {
+	for env, field := range map[string]*string{
+		EnvCABundle:   &c.CABundle,
+		EnvClientCert: &c.ClientCert,
+		EnvClientKey:  &c.ClientKey,
+	} {
+		if v := os.Getenv(env); v != "" {
+			*field = v
+		}
+	}
+}
@@ -4,9 +4,54 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 )
 
+// useTempHome makes dir the home directory on every platform: HOME on
+// Unix, USERPROFILE and APPDATA on Windows
+func useTempHome(t *testing.T, dir string) {
+	t.Helper()
+	t.Setenv("HOME", dir)
+	t.Setenv("USERPROFILE", dir)
+	t.Setenv("APPDATA", filepath.Join(dir, "AppData", "Roaming"))
+	t.Setenv(EnvConfigDir, "")
+}
+
+func TestGetConfigDir(t *testing.T) {
+	home := t.TempDir()
+	useTempHome(t, home)
+
+	dir, err := GetConfigDir()
+	if err != nil {
+		t.Fatalf("GetConfigDir() failed: %v", err)
+	}
+	want := filepath.Join(home, ".vanish")
+	if runtime.GOOS == "windows" {
+		want = filepath.Join(home, "AppData", "Roaming", "Vanish")
+	}
+	if dir != want {
+		t.Errorf("GetConfigDir() = %s, want %s", dir, want)
+	}
+
+	// A directory left by an earlier version keeps being used
+	if err := os.MkdirAll(filepath.Join(home, ".vanish"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if dir, _ := GetConfigDir(); dir != filepath.Join(home, ".vanish") {
+		t.Errorf("GetConfigDir() = %s, want the existing ~/.vanish", dir)
+	}
+
+	override := filepath.Join(t.TempDir(), "vanish-config")
+	t.Setenv(EnvConfigDir, override)
+	if dir, _ := GetConfigDir(); dir != override {
+		t.Errorf("GetConfigDir() = %s, want %s from %s", dir, override, EnvConfigDir)
+	}
+	if path, _ := GetIdentityPath(); path != filepath.Join(override, "identity") {
+		t.Errorf("GetIdentityPath() = %s, want it in %s", path, override)
+	}
+}
+
 func TestGetConfigPath(t *testing.T) {
 	path, err := GetConfigPath()
 	if err != nil {
@@ -30,9 +75,7 @@ func TestSaveAndLoadConfig(t *testing.T) {
 	tmpDir := t.TempDir()
 
 	// Override config path for testing
-	originalHome := os.Getenv("HOME")
-	os.Setenv("HOME", tmpDir)
-	defer os.Setenv("HOME", originalHome)
+	useTempHome(t, tmpDir)
 
 	cfg := &Config{
 		BaseURL: "http://test.example.com",
@@ -61,11 +104,12 @@ func TestSaveAndLoadConfig(t *testing.T) {
 }
 
 func TestSaveConfigFilePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows ignores Unix file modes")
+	}
 	tmpDir := t.TempDir()
 
-	originalHome := os.Getenv("HOME")
-	os.Setenv("HOME", tmpDir)
-	defer os.Setenv("HOME", originalHome)
+	useTempHome(t, tmpDir)
 
 	cfg := &Config{
 		BaseURL: "http://test.example.com",
@@ -106,9 +150,7 @@ func TestSaveConfigFilePermissions(t *testing.T) {
 func TestConfigJSONFormat(t *testing.T) {
 	tmpDir := t.TempDir()
 
-	originalHome := os.Getenv("HOME")
-	os.Setenv("HOME", tmpDir)
-	defer os.Setenv("HOME", originalHome)
+	useTempHome(t, tmpDir)
 
 	cfg := &Config{
 		BaseURL: "http://test.example.com",
@@ -147,9 +189,7 @@ func TestConfigJSONFormat(t *testing.T) {
 func TestLoadConfigNotExists(t *testing.T) {
 	tmpDir := t.TempDir()
 
-	originalHome := os.Getenv("HOME")
-	os.Setenv("HOME", tmpDir)
-	defer os.Setenv("HOME", originalHome)
+	useTempHome(t, tmpDir)
 
 	// Try to load non-existent config
 	_, err := LoadConfig()
@@ -170,9 +210,7 @@ func TestLoadConfigNotExists(t *testing.T) {
 func TestLoadConfigInvalidJSON(t *testing.T) {
 	tmpDir := t.TempDir()
 
-	originalHome := os.Getenv("HOME")
-	os.Setenv("HOME", tmpDir)
-	defer os.Setenv("HOME", originalHome)
+	useTempHome(t, tmpDir)
 
 	// Get config path and create directory
 	path, _ := GetConfigPath()
@@ -217,6 +255,21 @@ func TestConfigValidation(t *testing.T) {
 			config:  &Config{BaseURL: "http://test.com/", Token: "token123"},
 			wantErr: false,
 		},
+		{
+			name:    "client certificate and key",
+			config:  &Config{BaseURL: "http://test.com", Token: "token123", ClientCert: "c.pem", ClientKey: "k.pem"},
+			wantErr: false,
+		},
+		{
+			name:    "client certificate without key",
+			config:  &Config{BaseURL: "http://test.com", Token: "token123", ClientCert: "c.pem"},
+			wantErr: true,
+		},
+		{
+			name:    "proxy without scheme",
+			config:  &Config{BaseURL: "http://test.com", Token: "token123", Proxy: "proxy.corp:3128"},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -246,9 +299,7 @@ func TestSaveConfigNil(t *testing.T) {
 func TestMultipleSaves(t *testing.T) {
 	tmpDir := t.TempDir()
 
-	originalHome := os.Getenv("HOME")
-	os.Setenv("HOME", tmpDir)
-	defer os.Setenv("HOME", originalHome)
+	useTempHome(t, tmpDir)
 
 	configs := []Config{
 		{BaseURL: "http://first.com", Token: "token1"},
@@ -274,3 +325,76 @@ func TestMultipleSaves(t *testing.T) {
 		}
 	}
 }
+
+func TestLoadConfigConnectionSettings(t *testing.T) {
+	useTempHome(t, t.TempDir())
+	t.Setenv(EnvCABundle, "")
+	t.Setenv(EnvClientCert, "")
+	t.Setenv(EnvClientKey, "")
+
+	cfg := &Config{
+		BaseURL:  "https://vanish.corp",
+		Token:    "token",
+		CABundle: "/etc/corp-ca.pem",
+		Proxy:    "http://proxy.corp:3128",
+	}
+	if err := SaveConfig(cfg); err != nil {
+		t.Fatalf("SaveConfig() failed: %v", err)
+	}
+
+	loaded, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() failed: %v", err)
+	}
+	if loaded.CABundle != cfg.CABundle || loaded.Proxy != cfg.Proxy {
+		t.Errorf("connection settings not persisted: %+v", loaded)
+	}
+
+	// Environment variables win over the file
+	t.Setenv(EnvCABundle, "/tmp/other-ca.pem")
+	t.Setenv(EnvClientCert, "/tmp/client.pem")
+	t.Setenv(EnvClientKey, "/tmp/client.key")
+	loaded, err = LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig() failed: %v", err)
+	}
+	if loaded.CABundle != "/tmp/other-ca.pem" || loaded.ClientCert != "/tmp/client.pem" || loaded.ClientKey != "/tmp/client.key" {
+		t.Errorf("environment overrides not applied: %+v", loaded)
+	}
+}
+
+func TestSaveAndLoadIdentity(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	useTempHome(t, tmpDir)
+
+	if _, err := LoadIdentity(); err != ErrNoIdentity {
+		t.Fatalf("LoadIdentity() before keygen: got %v, want ErrNoIdentity", err)
+	}
+
+	id := &Identity{PublicKey: "public", PrivateKey: "private"}
+	if err := SaveIdentity(id); err != nil {
+		t.Fatalf("SaveIdentity() failed: %v", err)
+	}
+
+	path, _ := GetIdentityPath()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat identity file: %v", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("Identity file permissions = %o, want 0600", info.Mode().Perm())
+	}
+
+	loaded, err := LoadIdentity()
+	if err != nil {
+		t.Fatalf("LoadIdentity() failed: %v", err)
+	}
+	if *loaded != *id {
+		t.Errorf("LoadIdentity() = %+v, want %+v", loaded, id)
+	}
+
+	if err := SaveIdentity(&Identity{PublicKey: "public"}); err == nil {
+		t.Error("SaveIdentity() accepted an identity without a private key")
+	}
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrNoIdentity is returned by LoadIdentity before 'vanish keygen' has run
+var ErrNoIdentity = errors.New("no key pair found. Run 'vanish keygen' to create one")
+
+// Identity is the user's X25519 key pair for opening sealed link keys
+// The private key never leaves this machine; only PublicKey is uploaded
+type Identity struct {
+	PublicKey  string `json:"public_key"`
+	PrivateKey string `json:"private_key"`
+}
+
+// GetIdentityPath returns the path to the identity file
+func GetIdentityPath() (string, error) {
+	dir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "identity"), nil
+}
+
+// LoadIdentity loads the key pair from identity in GetConfigDir
+func LoadIdentity() (*Identity, error) {
+	path, err := GetIdentityPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNoIdentity
+		}
+		return nil, fmt.Errorf("failed to read identity file: %w", err)
+	}
+
+	var id Identity
+	if err := json.Unmarshal(data, &id); err != nil {
+		return nil, fmt.Errorf("failed to parse identity file: %w", err)
+	}
+	if id.PublicKey == "" || id.PrivateKey == "" {
+		return nil, fmt.Errorf("identity file %s is incomplete", path)
+	}
+
+	return &id, nil
+}
+
+// SaveIdentity saves the key pair to identity in GetConfigDir, readable
+// only by the current user
+func SaveIdentity(id *Identity) error {
+	if id == nil || id.PublicKey == "" || id.PrivateKey == "" {
+		return fmt.Errorf("identity must have both keys")
+	}
+
+	path, err := GetIdentityPath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(id, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal identity: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write identity file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package crypto
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ContentEncodingGzip marks a message whose plaintext was gzipped before
+// it was encrypted
+const ContentEncodingGzip = "gzip"
+
+// MaxDecompressedSize caps what DecryptCompressed inflates, so a small
+// message cannot expand into gigabytes
+const MaxDecompressedSize = 64 << 20 // 64 MB
+
+// ErrDecompressedTooLarge is returned when a compressed message inflates
+// beyond MaxDecompressedSize
+var ErrDecompressedTooLarge = errors.New("decompressed message is too large")
+
+// CompressThreshold is the plaintext size from which EncryptSecret gzips a
+// secret; smaller ones gain too little to be worth it
+const CompressThreshold = 1 << 10 // 1 KB
+
+// EncryptSecret encrypts a secret for sending, with EncryptCompressed when
+// it is at least CompressThreshold bytes and EncryptMessage otherwise
+func EncryptSecret(secret string) (*EncryptedMessage, error) {
+	if len(secret) < CompressThreshold {
+		return EncryptMessage(secret)
+	}
+	return EncryptCompressed(secret)
+}
+
+// EncryptCompressed gzips plaintext and encrypts the result like
+// EncryptMessage. Compression always happens before encryption: ciphertext
+// does not compress, and the reader then only inflates data GCM has already
+// authenticated, so forged input never reaches the gzip parser
+func EncryptCompressed(plaintext string) (*EncryptedMessage, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(plaintext)); err != nil {
+		return nil, fmt.Errorf("failed to compress message: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress message: %w", err)
+	}
+
+	encrypted, err := EncryptMessage(buf.String())
+	if err != nil {
+		return nil, err
+	}
+	encrypted.ContentEncoding = ContentEncodingGzip
+	return encrypted, nil
+}
+
+// DecryptCompressed decrypts a message encrypted with EncryptCompressed and
+// decompresses the plaintext
+func DecryptCompressed(ciphertext, iv, keyStr string) (string, error) {
+	compressed, err := DecryptMessage(ciphertext, iv, keyStr)
+	if err != nil {
+		return "", err
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader([]byte(compressed)))
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress message: %w", err)
+	}
+	defer zr.Close()
+
+	plaintext, err := io.ReadAll(io.LimitReader(zr, MaxDecompressedSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress message: %w", err)
+	}
+	if len(plaintext) > MaxDecompressedSize {
+		return "", ErrDecompressedTooLarge
+	}
+	return string(plaintext), nil
+}
+
+// DecryptEncoded decrypts a message with the content encoding the server
+// returned for it: DecryptCompressed for gzip, DecryptMessage when empty
+func DecryptEncoded(ciphertext, iv, keyStr, contentEncoding string) (string, error) {
+	switch contentEncoding {
+	case "":
+		return DecryptMessage(ciphertext, iv, keyStr)
+	case ContentEncodingGzip:
+		return DecryptCompressed(ciphertext, iv, keyStr)
+	default:
+		return "", fmt.Errorf("unsupported content encoding %q", contentEncoding)
+	}
+}
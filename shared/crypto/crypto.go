@@ -14,6 +14,10 @@ type EncryptedMessage struct {
 	Ciphertext string
 	IV         string
 	Key        string
+
+	// ContentEncoding is ContentEncodingGzip when the plaintext was
+	// compressed before encryption, and empty otherwise
+	ContentEncoding string
 }
 
 // EncryptMessage encrypts a plaintext message using AES-256-GCM
@@ -1,7 +1,10 @@
 package crypto
 
 import (
+	"crypto/rand"
 	"encoding/base64"
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -223,6 +226,129 @@ func TestCiphertextLength(t *testing.T) {
 }
 
 // Benchmark encryption performance
+func TestSealForRecipient(t *testing.T) {
+	publicKey, privateKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() failed: %v", err)
+	}
+
+	encrypted, err := EncryptMessage("sealed secret")
+	if err != nil {
+		t.Fatalf("EncryptMessage() failed: %v", err)
+	}
+
+	sealed, err := SealForRecipient(encrypted.Key, publicKey)
+	if err != nil {
+		t.Fatalf("SealForRecipient() failed: %v", err)
+	}
+	if strings.Contains(sealed, encrypted.Key) {
+		t.Error("Sealed key contains the plaintext key")
+	}
+
+	again, _ := SealForRecipient(encrypted.Key, publicKey)
+	if again == sealed {
+		t.Error("Sealing twice produced the same blob")
+	}
+
+	opened, err := OpenSealed(sealed, privateKey)
+	if err != nil {
+		t.Fatalf("OpenSealed() failed: %v", err)
+	}
+	if opened != encrypted.Key {
+		t.Errorf("OpenSealed() = %q, want %q", opened, encrypted.Key)
+	}
+
+	// Another user's private key cannot open it
+	_, otherPrivate, _ := GenerateKeyPair()
+	if _, err := OpenSealed(sealed, otherPrivate); err != ErrInvalidSealedKey {
+		t.Errorf("OpenSealed() with the wrong key: got %v, want ErrInvalidSealedKey", err)
+	}
+
+	// Nor can a tampered blob
+	raw, _ := base64.URLEncoding.DecodeString(sealed)
+	raw[len(raw)-1] ^= 1
+	if _, err := OpenSealed(base64.URLEncoding.EncodeToString(raw), privateKey); err != ErrInvalidSealedKey {
+		t.Errorf("OpenSealed() of a tampered blob: got %v, want ErrInvalidSealedKey", err)
+	}
+
+	if _, err := SealForRecipient(encrypted.Key, base64.URLEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Error("SealForRecipient() accepted a short public key")
+	}
+}
+
+func TestEncryptCompressedRoundtrip(t *testing.T) {
+	random := make([]byte, 8<<10)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		plaintext    string
+		compressible bool
+	}{
+		{"compressible", strings.Repeat("export DB_PASSWORD=s3cr3t\n", 400), true},
+		{"incompressible", base64.StdEncoding.EncodeToString(random), false},
+		{"empty", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compressed, err := EncryptCompressed(tt.plaintext)
+			if err != nil {
+				t.Fatalf("EncryptCompressed() failed: %v", err)
+			}
+			if compressed.ContentEncoding != ContentEncodingGzip {
+				t.Errorf("ContentEncoding = %q, want %q", compressed.ContentEncoding, ContentEncodingGzip)
+			}
+
+			decrypted, err := DecryptCompressed(compressed.Ciphertext, compressed.IV, compressed.Key)
+			if err != nil {
+				t.Fatalf("DecryptCompressed() failed: %v", err)
+			}
+			if decrypted != tt.plaintext {
+				t.Error("Decrypted text doesn't match original")
+			}
+			decrypted, err = DecryptEncoded(compressed.Ciphertext, compressed.IV, compressed.Key, compressed.ContentEncoding)
+			if err != nil || decrypted != tt.plaintext {
+				t.Errorf("DecryptEncoded() = %d bytes, %v", len(decrypted), err)
+			}
+
+			// Only text that repeats gets smaller; the rest costs a gzip header
+			plain, _ := EncryptMessage(tt.plaintext)
+			if smaller := len(compressed.Ciphertext) < len(plain.Ciphertext)/4; smaller != tt.compressible {
+				t.Errorf("compressed %d bytes vs %d uncompressed", len(compressed.Ciphertext), len(plain.Ciphertext))
+			}
+		})
+	}
+}
+
+func TestDecryptEncoded(t *testing.T) {
+	plain, _ := EncryptMessage("not compressed")
+	if got, err := DecryptEncoded(plain.Ciphertext, plain.IV, plain.Key, ""); err != nil || got != "not compressed" {
+		t.Errorf("DecryptEncoded() without encoding = %q, %v", got, err)
+	}
+	if _, err := DecryptEncoded(plain.Ciphertext, plain.IV, plain.Key, ContentEncodingGzip); err == nil {
+		t.Error("expected an error decompressing a message that is not gzip")
+	}
+	if _, err := DecryptEncoded(plain.Ciphertext, plain.IV, plain.Key, "br"); err == nil {
+		t.Error("expected an error for an unknown content encoding")
+	}
+}
+
+func TestDecryptCompressedLimitsSize(t *testing.T) {
+	bomb, err := EncryptCompressed(string(make([]byte, MaxDecompressedSize+1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bomb.Ciphertext) > 1<<20 {
+		t.Fatalf("zeros compressed to %d bytes", len(bomb.Ciphertext))
+	}
+	if _, err := DecryptCompressed(bomb.Ciphertext, bomb.IV, bomb.Key); !errors.Is(err, ErrDecompressedTooLarge) {
+		t.Errorf("DecryptCompressed() error = %v, want ErrDecompressedTooLarge", err)
+	}
+}
+
 func BenchmarkEncryptMessage(b *testing.B) {
 	plaintext := "This is a benchmark test message for encryption performance"
 
@@ -0,0 +1,140 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// sealInfo separates keys derived for sealing from any other use of X25519
+const sealInfo = "vanish-seal-v1"
+
+// ErrInvalidSealedKey is returned when a sealed key is malformed or was not
+// sealed to the given private key
+var ErrInvalidSealedKey = errors.New("sealed key cannot be opened with this private key")
+
+// GenerateKeyPair creates an X25519 key pair for receiving sealed link keys
+// Both keys are base64url-encoded like the link key
+func GenerateKeyPair() (publicKey, privateKey string, err error) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate key pair: %w", err)
+	}
+	return base64.URLEncoding.EncodeToString(priv.PublicKey().Bytes()),
+		base64.URLEncoding.EncodeToString(priv.Bytes()), nil
+}
+
+// SealForRecipient encrypts a link key so only the holder of the private key
+// matching recipientPublicKey can read it
+// It is an ECIES construction: an ephemeral X25519 key agrees a secret with
+// the recipient, SHA-256 derives an AES-256-GCM key from it, and the result
+// is base64url(ephemeral public key | nonce | ciphertext)
+func SealForRecipient(plainKey, recipientPublicKey string) (string, error) {
+	recipient, err := parsePublicKey(recipientPublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	shared, err := ephemeral.ECDH(recipient)
+	if err != nil {
+		return "", fmt.Errorf("failed to agree key: %w", err)
+	}
+
+	gcm, err := sealCipher(shared, ephemeral.PublicKey().Bytes(), recipient.Bytes())
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	out := append(ephemeral.PublicKey().Bytes(), nonce...)
+	out = gcm.Seal(out, nonce, []byte(plainKey), nil)
+	return base64.URLEncoding.EncodeToString(out), nil
+}
+
+// OpenSealed recovers a link key sealed with SealForRecipient
+func OpenSealed(sealed, privateKey string) (string, error) {
+	rawPriv, err := base64.URLEncoding.DecodeString(privateKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode private key: %w", err)
+	}
+	priv, err := ecdh.X25519().NewPrivateKey(rawPriv)
+	if err != nil {
+		return "", fmt.Errorf("invalid private key: %w", err)
+	}
+
+	data, err := base64.URLEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", ErrInvalidSealedKey
+	}
+	// 32-byte ephemeral key, 12-byte nonce and a 16-byte tag at least
+	if len(data) < 32+12+16 {
+		return "", ErrInvalidSealedKey
+	}
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(data[:32])
+	if err != nil {
+		return "", ErrInvalidSealedKey
+	}
+	shared, err := priv.ECDH(ephemeral)
+	if err != nil {
+		return "", ErrInvalidSealedKey
+	}
+
+	gcm, err := sealCipher(shared, data[:32], priv.PublicKey().Bytes())
+	if err != nil {
+		return "", err
+	}
+	nonce := data[32 : 32+gcm.NonceSize()]
+	plain, err := gcm.Open(nil, nonce, data[32+gcm.NonceSize():], nil)
+	if err != nil {
+		return "", ErrInvalidSealedKey
+	}
+	return string(plain), nil
+}
+
+// parsePublicKey decodes a base64url X25519 public key
+func parsePublicKey(key string) (*ecdh.PublicKey, error) {
+	raw, err := base64.URLEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode public key: %w", err)
+	}
+	pub, err := ecdh.X25519().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	return pub, nil
+}
+
+// sealCipher derives the AES-256-GCM cipher for one sealed key
+// Both public keys are bound into the derivation so a blob cannot be
+// replayed under another recipient's key
+func sealCipher(shared, ephemeralPublic, recipientPublic []byte) (cipher.AEAD, error) {
+	h := sha256.New()
+	h.Write([]byte(sealInfo))
+	h.Write(shared)
+	h.Write(ephemeralPublic)
+	h.Write(recipientPublic)
+
+	block, err := aes.NewCipher(h.Sum(nil))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return gcm, nil
+}
@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// ErrorResponse is the body of every API error
+type ErrorResponse struct {
+	Error     string            `json:"error"`
+	Code      string            `json:"code,omitempty"` // empty from servers that predate error codes
+	RequestID string            `json:"request_id,omitempty"`
+	Details   map[string]string `json:"details,omitempty"`
+}
+
+// MessageGoneResponse is the 410 body for a message the recipient can no
+// longer read. ReadAt is set with ErrorCodeMessageAlreadyRead and ExpiresAt
+// with ErrorCodeMessageExpired
+type MessageGoneResponse struct {
+	ErrorResponse
+	ReadAt    *time.Time `json:"read_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Error codes returned in ErrorResponse.Code
+// These mirror the server's catalogue; branch on them, not on Error
+const (
+	ErrorCodeInvalidRequest   = "invalid_request"
+	ErrorCodeValidationFailed = "validation_failed"
+	ErrorCodeInvalidMessageID = "invalid_message_id"
+	ErrorCodeTTLOutOfRange    = "ttl_out_of_range"
+	ErrorCodeInvalidSchedule  = "invalid_schedule"
+	ErrorCodeBatchSize        = "batch_size_out_of_range"
+	ErrorCodeInvalidPublicKey = "invalid_public_key"
+	ErrorCodeInvalidCSV       = "invalid_csv"
+	ErrorCodeCannotDeleteSelf = "cannot_delete_self"
+
+	ErrorCodeUnauthorized       = "unauthorized"
+	ErrorCodeInvalidCredentials = "invalid_credentials"
+	ErrorCodeIncorrectPassword  = "incorrect_password"
+	ErrorCodeAccountInactive    = "account_inactive"
+	ErrorCodeForbidden          = "forbidden"
+	ErrorCodeCSRFFailed         = "csrf_failed"
+
+	ErrorCodeMessageNotFound    = "message_not_found"
+	ErrorCodeMessageAlreadyRead = "message_already_read"
+	ErrorCodeMessageExpired     = "message_expired"
+	ErrorCodeMessageRevoked     = "message_revoked"
+	ErrorCodeMessageClaimed     = "message_claimed"
+	ErrorCodeNotRecipient       = "not_recipient"
+	ErrorCodeInvalidClaimToken  = "invalid_claim_token"
+	ErrorCodeClaimNotFound      = "claim_not_found"
+	ErrorCodeRecipientInboxFull = "recipient_inbox_full"
+	ErrorCodeCannotResend       = "cannot_resend"
+	ErrorCodeNotYetAvailable    = "message_not_yet_available"
+
+	ErrorCodeUserExists   = "user_exists"
+	ErrorCodeUserNotFound = "user_not_found"
+
+	ErrorCodeQuotaExceeded       = "quota_exceeded"
+	ErrorCodeRequestTooLarge     = "request_too_large"
+	ErrorCodeIntegrationDisabled = "integration_disabled"
+	ErrorCodeUpstreamFailed      = "upstream_failed"
+	ErrorCodeUnavailable         = "service_unavailable"
+	ErrorCodeInternal            = "internal_error"
+)
@@ -8,10 +8,15 @@ type MessageStatus string
 const (
 	// StatusPending indicates the message was created but not yet read
 	StatusPending MessageStatus = "pending"
+	// StatusClaimed indicates the recipient claimed the message and is fetching it
+	StatusClaimed MessageStatus = "claimed"
 	// StatusRead indicates the message has been read and burned
 	StatusRead MessageStatus = "read"
 	// StatusExpired indicates the message expired before being read
 	StatusExpired MessageStatus = "expired"
+	// StatusRevoked is reported by GET /api/messages/:id for a message
+	// discarded before it expired; history lists such messages as expired
+	StatusRevoked MessageStatus = "revoked"
 )
 
 // MessageHistoryResponse represents a message in the user's history
@@ -27,9 +32,46 @@ type MessageHistoryResponse struct {
 	IsSender      bool          `json:"is_sender"`                    // True if current user is sender
 	IsRecipient   bool          `json:"is_recipient"`                 // True if current user is recipient
 	EncryptionKey string        `json:"encryption_key,omitempty"`     // Only included for recipients with pending messages
+	SealedKey     string        `json:"sealed_key,omitempty"`         // Key sealed to the recipient's public key, instead of EncryptionKey
+
+	// IsCounterpartDeleted is true when the other party's account was
+	// deleted; their name then reads "Deleted user" and no key is included
+	IsCounterpartDeleted bool `json:"is_counterpart_deleted"`
+
+	// SenderType is "integration" for messages created by an integration
+	// such as Slack, named by IntegrationName; SenderLabel then reads e.g.
+	// "Alice via Slack integration"
+	SenderType      string `json:"sender_type,omitempty"`
+	IntegrationName string `json:"integration_name,omitempty"`
+	SenderLabel     string `json:"sender_label,omitempty"`
+
+	// CreatedVia is the client that created the message: api, cli, web,
+	// slack or mcp. Empty from servers that do not record it
+	CreatedVia string `json:"created_via,omitempty"`
+
+	// Category is the category the sender filed the message under; empty
+	// for none
+	Category string `json:"category,omitempty"`
+}
+
+// InboxMessage is a pending message addressed to the authenticated user
+// Returned by GET /api/inbox, soonest to expire first
+type InboxMessage struct {
+	MessageID        string    `json:"message_id"`
+	SenderName       string    `json:"sender_name"`
+	SenderLabel      string    `json:"sender_label"`
+	SenderType       string    `json:"sender_type"`
+	IntegrationName  string    `json:"integration_name,omitempty"`
+	CreatedVia       string    `json:"created_via,omitempty"` // See MessageHistoryResponse.CreatedVia
+	CreatedAt        time.Time `json:"created_at"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	ExpiresInSeconds int64     `json:"expires_in_seconds"`
+	URL              string    `json:"url,omitempty"`        // Full link; empty when the server does not store the key
+	SealedKey        string    `json:"sealed_key,omitempty"` // Key sealed to the recipient's public key, instead of a URL
 }
 
 // HistoryResponse represents the full history response
 type HistoryResponse struct {
-	Messages []MessageHistoryResponse `json:"messages"`
+	Messages   []MessageHistoryResponse `json:"messages"`
+	NextCursor string                   `json:"next_cursor,omitempty"` // Empty on the last page
 }
@@ -3,24 +3,130 @@ package models
 import "time"
 
 // CreateMessageRequest represents the request body for creating a message
-// This is sent from CLI/MCP to the backend API
+// This is sent from CLI/MCP to the backend API and mirrors the backend's
+// models.CreateMessageRequest field for field
 type CreateMessageRequest struct {
-	Ciphertext    string `json:"ciphertext" binding:"required,base64"`
-	IV            string `json:"iv" binding:"required,base64"`
-	TTL           int64  `json:"ttl,omitempty"`                    // Time to live in seconds
-	RecipientID   int64  `json:"recipient_id" binding:"required"`  // Who can read this message
-	EncryptionKey string `json:"encryption_key" binding:"required"` // Client-side encryption key
+	Ciphertext    string `json:"ciphertext"`
+	IV            string `json:"iv"`
+	TTL           *int64 `json:"ttl,omitempty"`            // Time to live in seconds; nil leaves it to the server's default
+	RecipientID   int64  `json:"recipient_id"`             // Who can read this message
+	EncryptionKey string `json:"encryption_key,omitempty"` // Client-side encryption key, for recipients without a public key
+	SealedKey     string `json:"sealed_key,omitempty"`     // The key sealed to the recipient's public key
+
+	// ContentEncoding is "gzip" when the plaintext was compressed before encryption
+	ContentEncoding string `json:"content_encoding,omitempty"`
+
+	// AvailableAt schedules the message; the TTL counts from it
+	AvailableAt *time.Time `json:"available_at,omitempty"`
+
+	// Category files the message under a category whose policy may set its
+	// default and maximum TTL
+	Category string `json:"category,omitempty"`
+
+	// ExternalRecipientEmail addresses the message to someone without an
+	// account instead of RecipientID
+	ExternalRecipientEmail string `json:"external_recipient_email,omitempty"`
 }
 
 // CreateMessageResponse represents the response after creating a message
 type CreateMessageResponse struct {
-	ID        string    `json:"id"`
-	ExpiresAt time.Time `json:"expires_at"`
+	ID          string     `json:"id"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	AvailableAt *time.Time `json:"available_at,omitempty"` // Set for scheduled messages
+	DryRun      bool       `json:"dry_run,omitempty"`      // Set when nothing was stored; ID is synthetic
+
+	// TTLLimitedByPolicy is set when a TTL policy shortened the requested
+	// TTL; ExpiresAt reflects the shorter one
+	TTLLimitedByPolicy bool `json:"ttl_limited_by_policy,omitempty"`
+
+	// Category echoes the requested category; CategoryPolicy is the policy
+	// applied to it, omitted when the category has none
+	Category       string                 `json:"category,omitempty"`
+	CategoryPolicy *AppliedCategoryPolicy `json:"category_policy,omitempty"`
+
+	// AccessToken is set for a message to an external recipient; it goes in
+	// the path of their link, {base}/m/{id}/{token}#{key}
+	AccessToken string `json:"access_token,omitempty"`
+}
+
+// AppliedCategoryPolicy is the category policy a new message was created under
+type AppliedCategoryPolicy struct {
+	Category          string `json:"category"`
+	DefaultTTL        int64  `json:"default_ttl"`
+	MaxTTL            int64  `json:"max_ttl"`
+	NotificationStyle string `json:"notification_style"` // standard, urgent or digest
+}
+
+// BulkCreateMessageRequest creates up to 50 messages in one call
+// Sent to POST /api/messages/bulk
+type BulkCreateMessageRequest struct {
+	Messages []CreateMessageRequest `json:"messages"`
+}
+
+// BulkMessageResult is the outcome of one item in a bulk create
+// Status is 201 for stored items, otherwise the item's error status
+type BulkMessageResult struct {
+	Index              int               `json:"index"`
+	Status             int               `json:"status"`
+	ID                 string            `json:"id,omitempty"`
+	ExpiresAt          *time.Time        `json:"expires_at,omitempty"`
+	TTLLimitedByPolicy bool              `json:"ttl_limited_by_policy,omitempty"`
+	Error              string            `json:"error,omitempty"`
+	Code               string            `json:"code,omitempty"`
+	Details            map[string]string `json:"details,omitempty"` // The problem of each invalid field
+}
+
+// BulkCreateMessageResponse is the 207 Multi-Status envelope for a bulk create
+type BulkCreateMessageResponse struct {
+	Results   []BulkMessageResult `json:"results"`
+	Succeeded int                 `json:"succeeded"`
+	Failed    int                 `json:"failed"`
+	DryRun    bool                `json:"dry_run,omitempty"` // Nothing was stored; successes carry status 200
 }
 
 // MessageResponse represents the response when retrieving a message
 // Not typically used by CLI/MCP but included for completeness
 type MessageResponse struct {
-	Ciphertext string `json:"ciphertext"`
-	IV         string `json:"iv"`
+	Ciphertext      string `json:"ciphertext"`
+	IV              string `json:"iv"`
+	ContentEncoding string `json:"content_encoding,omitempty"` // Pass to crypto.DecryptEncoded
+
+	// Set by client.GetMessage from the response headers; empty and zero
+	// for servers that do not send them
+	ID     string    `json:"-"` // X-Vanish-Message-Id
+	ReadAt time.Time `json:"-"` // X-Vanish-Read-At: when the message was burned
+}
+
+// MessagePreviewResponse describes a pending message without burning it
+// Returned by GET /api/messages/:id/preview; never contains ciphertext or key
+type MessagePreviewResponse struct {
+	SenderName         string    `json:"sender_name"`
+	CreatedAt          time.Time `json:"created_at"`
+	ExpiresAt          time.Time `json:"expires_at"`
+	ExpiresInSeconds   int64     `json:"expires_in_seconds"`
+	OneTime            bool      `json:"one_time"`
+	PassphraseRequired bool      `json:"passphrase_required"`
+}
+
+// MessageStatusResponse is the status of a message for its sender or
+// recipient, from GET /api/messages/:id/status. It never burns the message
+type MessageStatusResponse struct {
+	ID          string        `json:"id"`
+	Status      MessageStatus `json:"status"` // Expired when past its expiry, revoked when discarded before it
+	SenderID    int64         `json:"sender_id"`
+	RecipientID int64         `json:"recipient_id"`
+	CreatedAt   time.Time     `json:"created_at"`
+	ExpiresAt   time.Time     `json:"expires_at"`
+	ReadAt      *time.Time    `json:"read_at,omitempty"`      // Set once read
+	AvailableAt *time.Time    `json:"available_at,omitempty"` // Set for scheduled messages
+
+	// ExternalRecipientEmail is set, and RecipientID 0, for a message to a
+	// recipient without an account
+	ExternalRecipientEmail string `json:"external_recipient_email,omitempty"`
+}
+
+// ResendNotificationResponse names the channel the recipient was notified
+// on again: "slack" or "email"
+type ResendNotificationResponse struct {
+	Channel string `json:"channel"`
 }
@@ -0,0 +1,37 @@
+package models
+
+import "regexp"
+
+// DLPPattern is a regular expression a secret is matched against before it
+// is encrypted, warning the sender on a match
+type DLPPattern struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	Description string `json:"description"`
+}
+
+// SenderPolicy is returned by GET /api/policy
+type SenderPolicy struct {
+	BannedDomains []string     `json:"banned_domains"` // refused by the server as recipients
+	DLPPatterns   []DLPPattern `json:"dlp_patterns"`
+}
+
+// MatchDLP returns the patterns of p that secret matches. Matching happens
+// on the sender's side only: the server never sees the plaintext. A pattern
+// that does not compile is skipped rather than blocking the send
+func (p *SenderPolicy) MatchDLP(secret string) []DLPPattern {
+	if p == nil {
+		return nil
+	}
+	var matched []DLPPattern
+	for _, pattern := range p.DLPPatterns {
+		re, err := regexp.Compile(pattern.Pattern)
+		if err != nil {
+			continue
+		}
+		if re.MatchString(secret) {
+			matched = append(matched, pattern)
+		}
+	}
+	return matched
+}
@@ -9,6 +9,7 @@ type User struct {
 	Email     string    `json:"email"`
 	Name      string    `json:"name"`
 	IsAdmin   bool      `json:"is_admin"`
+	PublicKey string    `json:"public_key,omitempty"` // Set once the user ran 'vanish keygen'
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
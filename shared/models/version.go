@@ -0,0 +1,10 @@
+package models
+
+// ServerVersion is returned by GET /api/version
+type ServerVersion struct {
+	Version          string `json:"version"`
+	Commit           string `json:"commit,omitempty"`
+	BuildDate        string `json:"build_date,omitempty"`
+	APIVersion       string `json:"api_version"`
+	MinClientVersion string `json:"min_client_version,omitempty"`
+}
@@ -0,0 +1,215 @@
+package vanish_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zafrem/vanish/shared/models"
+	"github.com/zafrem/vanish/shared/vanish"
+)
+
+// serverURL is the address of the fake server the examples run against;
+// in real code it is the address of a Vanish server
+var serverURL string
+
+func TestMain(m *testing.M) {
+	server := httptest.NewServer(newFakeServer())
+	serverURL = server.URL
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
+
+// fakeServer serves the part of the Vanish API the SDK uses, for one
+// sender (ID 1) and one recipient (ID 2)
+type fakeServer struct {
+	mu       sync.Mutex
+	messages map[string]*fakeMessage
+	next     int
+}
+
+type fakeMessage struct {
+	request models.CreateMessageRequest
+	status  models.MessageStatusResponse
+}
+
+func newFakeServer() http.Handler {
+	s := &fakeServer{messages: map[string]*fakeMessage{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/users", s.users)
+	mux.HandleFunc("POST /api/v1/messages", s.create)
+	mux.HandleFunc("GET /api/v1/messages/{id}", s.read)
+	mux.HandleFunc("GET /api/v1/messages/{id}/status", s.status)
+	mux.HandleFunc("DELETE /api/v1/messages/{id}", s.revoke)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Vanish-API-Version", "v1")
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (s *fakeServer) users(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, []models.User{
+		{ID: 1, Email: "deploy-bot@example.com", Name: "deploy-bot"},
+		{ID: 2, Email: "alice@example.com", Name: "Alice"},
+	})
+}
+
+func (s *fakeServer) create(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+		return
+	}
+	ttl := int64(86400)
+	if req.TTL != nil {
+		ttl = *req.TTL
+	}
+	s.next++
+	id := fmt.Sprintf("msg%d", s.next)
+	now := time.Now()
+	s.messages[id] = &fakeMessage{request: req, status: models.MessageStatusResponse{
+		ID: id, Status: models.StatusPending, SenderID: 1, RecipientID: req.RecipientID,
+		CreatedAt: now, ExpiresAt: now.Add(time.Duration(ttl) * time.Second),
+	}}
+	writeJSON(w, http.StatusCreated, models.CreateMessageResponse{ID: id, ExpiresAt: s.messages[id].status.ExpiresAt})
+}
+
+func (s *fakeServer) read(w http.ResponseWriter, r *http.Request) {
+	m, ok := s.messages[r.PathValue("id")]
+	switch {
+	case !ok || m.status.Status == models.StatusRevoked:
+		writeJSON(w, http.StatusNotFound, models.ErrorResponse{Error: "message not found", Code: models.ErrorCodeMessageNotFound})
+	case m.status.Status == models.StatusRead:
+		writeJSON(w, http.StatusGone, models.ErrorResponse{Error: "message already read", Code: models.ErrorCodeMessageAlreadyRead})
+	default:
+		now := time.Now()
+		m.status.Status, m.status.ReadAt = models.StatusRead, &now
+		writeJSON(w, http.StatusOK, models.MessageResponse{
+			Ciphertext: m.request.Ciphertext, IV: m.request.IV, ContentEncoding: m.request.ContentEncoding,
+		})
+	}
+}
+
+func (s *fakeServer) status(w http.ResponseWriter, r *http.Request) {
+	m, ok := s.messages[r.PathValue("id")]
+	if !ok {
+		writeJSON(w, http.StatusNotFound, models.ErrorResponse{Error: "message not found", Code: models.ErrorCodeMessageNotFound})
+		return
+	}
+	writeJSON(w, http.StatusOK, m.status)
+}
+
+func (s *fakeServer) revoke(w http.ResponseWriter, r *http.Request) {
+	m, ok := s.messages[r.PathValue("id")]
+	if !ok || m.status.Status != models.StatusPending {
+		writeJSON(w, http.StatusNotFound, models.ErrorResponse{Error: "message not found", Code: models.ErrorCodeMessageNotFound})
+		return
+	}
+	m.status.Status = models.StatusRevoked
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Message revoked"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func ExampleNew() {
+	client, err := vanish.New(serverURL, vanish.Credentials{Token: "api-key"})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	users, err := client.ListUsers(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, u := range users {
+		fmt.Println(u.Name, u.Email)
+	}
+	// Output:
+	// deploy-bot deploy-bot@example.com
+	// Alice alice@example.com
+}
+
+func ExampleClient_Send() {
+	ctx := context.Background()
+	sender, _ := vanish.New(serverURL, vanish.Credentials{Token: "sender-token"})
+	recipient, _ := vanish.New(serverURL, vanish.Credentials{Token: "recipient-token"})
+
+	sent, err := sender.Send(ctx, "alice@example.com", "s3cr3t-db-password", vanish.WithTTL(time.Hour))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(strings.HasPrefix(sent.URL, serverURL+"/m/"+sent.ID+"#"))
+
+	secret, err := recipient.Receive(ctx, sent.URL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(secret)
+
+	// A secret can be read once
+	_, err = recipient.Receive(ctx, sent.URL)
+	fmt.Println(vanish.ErrorCode(err) == vanish.ErrorCodeMessageAlreadyRead)
+	// Output:
+	// true
+	// s3cr3t-db-password
+	// true
+}
+
+func ExampleClient_Status() {
+	ctx := context.Background()
+	client, _ := vanish.New(serverURL, vanish.Credentials{Token: "sender-token"})
+
+	sent, err := client.Send(ctx, "alice@example.com", "rotate me")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	info, err := client.Status(ctx, sent.ID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(info.Status, info.RecipientID)
+	// Output: pending 2
+}
+
+func ExampleClient_Revoke() {
+	ctx := context.Background()
+	client, _ := vanish.New(serverURL, vanish.Credentials{Token: "sender-token"})
+
+	sent, err := client.Send(ctx, "alice@example.com", "sent to the wrong person")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := client.Revoke(ctx, sent.ID); err != nil {
+		log.Fatal(err)
+	}
+
+	info, _ := client.Status(ctx, sent.ID)
+	fmt.Println(info.Status)
+	// Output: revoked
+}
+
+func ExampleErrorCode() {
+	client, _ := vanish.New(serverURL, vanish.Credentials{Token: "sender-token"})
+
+	_, err := client.Send(context.Background(), "nobody@example.com", "secret")
+	var apiErr *vanish.APIError
+	fmt.Println(errors.As(err, &apiErr), vanish.ErrorCode(err))
+	// Output: true user_not_found
+}
@@ -0,0 +1,179 @@
+package vanish
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/zafrem/vanish/shared/crypto"
+	"github.com/zafrem/vanish/shared/models"
+)
+
+// maxHistory bounds the history searched for a sealed key; it is the
+// largest page GET /api/history serves
+const maxHistory = 200
+
+// ErrEmptySecret is returned by Send for an empty secret
+var ErrEmptySecret = errors.New("vanish: secret is empty")
+
+// ErrNoKey is returned by Receive for a link without a #key part when no
+// key was sealed to the user or the Client has no private key to open it
+var ErrNoKey = errors.New("vanish: link has no key and no key sealed to this user could be opened")
+
+// SendOption configures one Send
+type SendOption func(*sendSettings)
+
+type sendSettings struct {
+	ttl         time.Duration
+	availableAt time.Time
+}
+
+// WithTTL sets how long the secret can be read, in whole seconds. Without
+// it the server applies its default, or the policy of the recipient's domain
+func WithTTL(ttl time.Duration) SendOption {
+	return func(s *sendSettings) { s.ttl = ttl }
+}
+
+// WithAvailableAt schedules the secret: it cannot be read before at, and
+// its TTL counts from then
+func WithAvailableAt(at time.Time) SendOption {
+	return func(s *sendSettings) { s.availableAt = at }
+}
+
+// Sent describes a secret stored by Send
+type Sent struct {
+	ID        string
+	URL       string // Share link, {base}/m/{id}#{key}; anyone holding it can read the secret once
+	ExpiresAt time.Time
+
+	// AvailableAt is set for scheduled secrets
+	AvailableAt *time.Time
+
+	// Sealed is set when the key was also sealed to the recipient's public
+	// key, so they can open the secret from a link without #key
+	Sealed bool
+}
+
+// Send encrypts secret locally and stores it for the user with email
+// recipientEmail. Large secrets are compressed before encryption. Nobody
+// is notified: pass Sent.URL on yourself
+func (c *Client) Send(ctx context.Context, recipientEmail, secret string, opts ...SendOption) (*Sent, error) {
+	if secret == "" {
+		return nil, ErrEmptySecret
+	}
+	var s sendSettings
+	for _, opt := range opts {
+		opt(&s)
+	}
+
+	recipient, err := c.api.FindUserContext(ctx, recipientEmail)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := crypto.EncryptSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	link, created, err := c.api.SendScheduledMessageContext(ctx, recipient.ID, recipient.PublicKey, encrypted, int64(s.ttl/time.Second), s.availableAt)
+	if err != nil {
+		return nil, err
+	}
+	return &Sent{
+		ID:          created.ID,
+		URL:         link,
+		ExpiresAt:   created.ExpiresAt,
+		AvailableAt: created.AvailableAt,
+		Sealed:      recipient.PublicKey != "",
+	}, nil
+}
+
+// Receive reads the secret behind link and decrypts it locally. Reading
+// burns the secret: a second Receive fails with ErrorCodeMessageAlreadyRead.
+// Only the recipient can read a secret
+func (c *Client) Receive(ctx context.Context, link string) (string, error) {
+	id, key, err := ParseLink(link)
+	if err != nil {
+		return "", err
+	}
+	if key == "" {
+		if key, err = c.sealedKey(ctx, id); err != nil {
+			return "", err
+		}
+	}
+
+	msg, err := c.api.GetMessageContext(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	return crypto.DecryptEncoded(msg.Ciphertext, msg.IV, key, msg.ContentEncoding)
+}
+
+// sealedKey opens the key of message id sealed to the user, found in their
+// history
+func (c *Client) sealedKey(ctx context.Context, id string) (string, error) {
+	if c.privateKey == "" {
+		return "", ErrNoKey
+	}
+	history, err := c.api.GetMessageHistoryContext(ctx, maxHistory)
+	if err != nil {
+		return "", err
+	}
+	for _, h := range history {
+		if h.MessageID == id && h.IsRecipient && h.SealedKey != "" {
+			return crypto.OpenSealed(h.SealedKey, c.privateKey)
+		}
+	}
+	return "", ErrNoKey
+}
+
+// Status is the state of a secret
+type Status = models.MessageStatus
+
+// States reported by MessageInfo.Status
+const (
+	StatusPending = models.StatusPending
+	StatusClaimed = models.StatusClaimed
+	StatusRead    = models.StatusRead
+	StatusExpired = models.StatusExpired
+	StatusRevoked = models.StatusRevoked
+)
+
+// MessageInfo describes a secret without its content
+type MessageInfo = models.MessageStatusResponse
+
+// Status reports the state of the secret with messageID to its sender or
+// recipient, without burning it
+func (c *Client) Status(ctx context.Context, messageID string) (*MessageInfo, error) {
+	return c.api.GetMessageStatusContext(ctx, messageID)
+}
+
+// Revoke burns the secret with messageID before it is read. Only its
+// sender can revoke it
+func (c *Client) Revoke(ctx context.Context, messageID string) error {
+	return c.api.RevokeMessageContext(ctx, messageID)
+}
+
+// ParseLink splits a share link, {base}/m/{id}#{key}, into the message ID
+// and key. The key is empty for a link without one, which the recipient can
+// still open when the key was sealed to them
+func ParseLink(link string) (messageID, key string, err error) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return "", "", fmt.Errorf("invalid link: %w", err)
+	}
+
+	i := strings.LastIndex(u.Path, "/m/")
+	if i < 0 {
+		return "", "", fmt.Errorf("invalid link: expected .../m/<id>#<key>")
+	}
+	id := u.Path[i+len("/m/"):]
+	if id == "" || strings.Contains(id, "/") {
+		return "", "", fmt.Errorf("invalid link: expected .../m/<id>#<key>")
+	}
+
+	return id, u.Fragment, nil
+}
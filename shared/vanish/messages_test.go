@@ -0,0 +1,30 @@
+package vanish
+
+import "testing"
+
+func TestParseLink(t *testing.T) {
+	tests := []struct {
+		link    string
+		wantID  string
+		wantKey string
+		wantErr bool
+	}{
+		{link: "https://vanish.example.com/m/abc123#a+b/c==", wantID: "abc123", wantKey: "a+b/c=="},
+		{link: "https://example.com/vanish/m/abc123#key", wantID: "abc123", wantKey: "key"},
+		{link: "https://vanish.example.com/m/abc123", wantID: "abc123"}, // key sealed to the recipient
+		{link: "https://vanish.example.com/history#key", wantErr: true},
+		{link: "https://vanish.example.com/m/#key", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.link, func(t *testing.T) {
+			id, key, err := ParseLink(tt.link)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseLink() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if id != tt.wantID || key != tt.wantKey {
+				t.Errorf("ParseLink() = (%q, %q), want (%q, %q)", id, key, tt.wantID, tt.wantKey)
+			}
+		})
+	}
+}
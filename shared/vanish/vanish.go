@@ -0,0 +1,132 @@
+// Package vanish is the Go SDK for Vanish. It sends and receives one-time
+// secrets from Go services, encrypting and decrypting them locally with the
+// same AES-256-GCM scheme as the web client and the CLI, so the server only
+// ever stores ciphertext.
+//
+// Create a Client with New and call its methods; every method takes a
+// context first and is safe for concurrent use.
+//
+// # Stability
+//
+// The exported API of this package follows semantic versioning of the
+// shared module: from v1.0.0 on, a breaking change to it means a new major
+// version. Before v1.0.0 breaking changes are kept to minor releases and
+// named in their release notes. The client, crypto and models packages
+// underneath carry no such guarantee; depend on this package instead.
+package vanish
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/zafrem/vanish/shared/client"
+	"github.com/zafrem/vanish/shared/config"
+	"github.com/zafrem/vanish/shared/models"
+)
+
+// Client talks to one Vanish server as one user
+type Client struct {
+	api        *client.Client
+	privateKey string // opens keys sealed to the user; empty when not given
+}
+
+// Credentials authenticate a Client. Token is a JWT from logging in or an
+// API key of a service account
+type Credentials struct {
+	Token string
+}
+
+// Option configures a Client
+type Option func(*settings)
+
+type settings struct {
+	transport  client.Options
+	privateKey string
+}
+
+// WithCABundle trusts the CA certificates in the PEM file at path in
+// addition to the system roots, for servers with an internal CA
+func WithCABundle(path string) Option {
+	return func(s *settings) { s.transport.CABundle = path }
+}
+
+// WithClientCertificate presents the PEM certificate and key at certFile
+// and keyFile for mutual TLS
+func WithClientCertificate(certFile, keyFile string) Option {
+	return func(s *settings) {
+		s.transport.ClientCert = certFile
+		s.transport.ClientKey = keyFile
+	}
+}
+
+// WithProxy sends requests through the proxy at proxyURL instead of the
+// one named by HTTP_PROXY, HTTPS_PROXY and NO_PROXY
+func WithProxy(proxyURL string) Option {
+	return func(s *settings) { s.transport.Proxy = proxyURL }
+}
+
+// WithPrivateKey lets Receive open links without a #key part, whose key
+// was sealed to the user's public key. privateKey is the base64url X25519
+// key written by 'vanish keygen'
+func WithPrivateKey(privateKey string) Option {
+	return func(s *settings) { s.privateKey = privateKey }
+}
+
+// New returns a Client for the server at baseURL, e.g.
+// https://vanish.example.com. It fails when baseURL is not an absolute
+// http(s) URL or a CA bundle or client certificate cannot be loaded
+func New(baseURL string, credentials Credentials, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, errors.New("vanish: base URL must be an absolute http or https URL")
+	}
+	if credentials.Token == "" {
+		return nil, errors.New("vanish: credentials have no token")
+	}
+
+	var s settings
+	for _, opt := range opts {
+		opt(&s)
+	}
+
+	baseURL = strings.TrimRight(baseURL, "/")
+	api, err := client.NewClientWithOptions(&config.Config{BaseURL: baseURL, Token: credentials.Token}, s.transport)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{api: api, privateKey: s.privateKey}, nil
+}
+
+// User is a possible recipient
+type User = models.User
+
+// ListUsers lists the users secrets can be sent to
+func (c *Client) ListUsers(ctx context.Context) ([]User, error) {
+	return c.api.ListUsersContext(ctx)
+}
+
+// APIError is an error answered by the server. Branch on its Code, one of
+// the ErrorCode* values, rather than on its text
+type APIError = client.APIError
+
+// ErrorCode returns the code of the APIError carried by err, or "" when err
+// is not one
+func ErrorCode(err error) string {
+	return client.ErrorCode(err)
+}
+
+// Error codes of the failures callers most often handle; the server's
+// full catalogue is in the API reference
+const (
+	ErrorCodeUserNotFound       = models.ErrorCodeUserNotFound
+	ErrorCodeMessageNotFound    = models.ErrorCodeMessageNotFound
+	ErrorCodeMessageAlreadyRead = models.ErrorCodeMessageAlreadyRead
+	ErrorCodeMessageExpired     = models.ErrorCodeMessageExpired
+	ErrorCodeMessageRevoked     = models.ErrorCodeMessageRevoked
+	ErrorCodeNotRecipient       = models.ErrorCodeNotRecipient
+	ErrorCodeForbidden          = models.ErrorCodeForbidden
+	ErrorCodeTTLOutOfRange      = models.ErrorCodeTTLOutOfRange
+	ErrorCodeQuotaExceeded      = models.ErrorCodeQuotaExceeded
+)